@@ -23,11 +23,15 @@ package helix
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
 	"github.com/uber-go/go-helix/zk"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
@@ -38,6 +42,9 @@ var (
 	// is not correct or does not exist
 	ErrClusterNotSetup = errors.New("cluster not setup")
 
+	// ErrClusterExists the cluster already exists in zookeeper when it is not expected to
+	ErrClusterExists = errors.New("cluster already exists")
+
 	// ErrNodeAlreadyExists the zookeeper node exists when it is not expected to
 	ErrNodeAlreadyExists = errors.New("node already exists in cluster")
 
@@ -55,6 +62,12 @@ var (
 
 	// ErrResourceNotExists the resource does not exists and cannot be removed
 	ErrResourceNotExists = errors.New("resource not exists in cluster")
+
+	// ErrInstanceNotLive the instance is expected to be live in the cluster
+	ErrInstanceNotLive = errors.New("instance is not live in cluster")
+
+	// ErrPartitionNotInErrorState the partition is expected to be in ERROR state to be reset
+	ErrPartitionNotInErrorState = errors.New("partition is not in ERROR state")
 )
 
 var (
@@ -351,6 +364,8 @@ var (
 // http://helix.apache.org/0.7.0-incubating-docs/Quickstart.html
 type Admin struct {
 	zkClient *zk.Client
+	// sharedClient is set if the ZK client is shared with other managers
+	sharedClient bool
 }
 
 // NewAdmin instantiates Admin
@@ -365,6 +380,25 @@ func NewAdmin(zkConnectString string) (*Admin, error) {
 	return &Admin{zkClient: zkClient}, nil
 }
 
+// NewAdminWithClient instantiates Admin over a ZK client shared with other managers of the
+// process, e.g. a participant, instead of its own session. The client is acquired until Close
+func NewAdminWithClient(zkClient *zk.Client) (*Admin, error) {
+	if err := zkClient.Acquire(); err != nil {
+		return nil, err
+	}
+	return &Admin{zkClient: zkClient, sharedClient: true}, nil
+}
+
+// Close disconnects the admin from Zookeeper, a shared ZK client is released instead.
+// Close is called once
+func (adm Admin) Close() {
+	if adm.sharedClient {
+		adm.zkClient.Release()
+		return
+	}
+	adm.zkClient.Disconnect()
+}
+
 // AddCluster add a cluster to Helix. As a result, a znode will be created in zookeeper
 // root named after the cluster name, and corresponding data structures are populated
 // under this znode.
@@ -495,6 +529,193 @@ func (adm Admin) GetConfig(
 	return result, nil
 }
 
+// GetClusterConfig returns the typed config of the cluster
+func (adm Admin) GetClusterConfig(cluster string) (*model.ClusterConfig, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	if exists, _, err := adm.zkClient.Exists(builder.clusterConfig()); !exists || err != nil {
+		if !exists {
+			return model.NewClusterConfig(cluster), nil
+		}
+		return nil, err
+	}
+	return newDataAccessor(adm.zkClient, builder).ClusterConfig()
+}
+
+// UpdateClusterConfig updates the typed config of the cluster,
+// the updated config is validated before it is written
+func (adm Admin) UpdateClusterConfig(cluster string, update func(config *model.ClusterConfig)) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	return accessor.updateData(builder.clusterConfig(), func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		config := model.NewClusterConfig(cluster)
+		if data != nil {
+			config = &model.ClusterConfig{ZNRecord: *data}
+		}
+		update(config)
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		return &config.ZNRecord, nil
+	})
+}
+
+// GetResourceConfig returns the typed config of the resource
+func (adm Admin) GetResourceConfig(cluster string, resource string) (*model.ResourceConfig, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	if exists, _, err := adm.zkClient.Exists(builder.resourceConfig(resource)); !exists || err != nil {
+		if !exists {
+			return model.NewResourceConfig(resource), nil
+		}
+		return nil, err
+	}
+	return newDataAccessor(adm.zkClient, builder).ResourceConfig(resource)
+}
+
+// UpdateResourceConfig updates the typed config of the resource, the updated config is
+// validated against the replicas of the ideal state before it is written
+func (adm Admin) UpdateResourceConfig(
+	cluster string, resource string, update func(config *model.ResourceConfig)) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	if exists, _, err := adm.zkClient.Exists(builder.idealStateForResource(resource)); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+	idealState, err := accessor.IdealState(resource)
+	if err != nil {
+		return err
+	}
+	return accessor.updateData(builder.resourceConfig(resource), func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		config := model.NewResourceConfig(resource)
+		if data != nil {
+			config = &model.ResourceConfig{ZNRecord: *data}
+		}
+		update(config)
+		if err := config.Validate(idealState.GetReplicas()); err != nil {
+			return nil, err
+		}
+		return &config.ZNRecord, nil
+	})
+}
+
+// ListResourceConfigs returns the typed configs of the resources by resource name
+func (adm Admin) ListResourceConfigs(cluster string) (map[string]*model.ResourceConfig, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	return newDataAccessor(adm.zkClient, &KeyBuilder{cluster}).ResourceConfigs()
+}
+
+// DeleteResourceConfig removes the config of the resource, removing a missing config is a no-op
+func (adm Admin) DeleteResourceConfig(cluster string, resource string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	path := builder.resourceConfig(resource)
+	if exists, _, err := adm.zkClient.Exists(path); !exists || err != nil {
+		return err
+	}
+	return adm.zkClient.Delete(path)
+}
+
+// SetConstraint adds or replaces the constraint item of the ID in the constraints of the type,
+// e.g. a message constraint {MESSAGE_TYPE: STATE_TRANSITION, INSTANCE: .*} with value 1
+// allows one pending state transition per instance
+func (adm Admin) SetConstraint(
+	cluster string, constraintType string, constraintID string, item model.ConstraintItem) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	if err := validateConstraintType(constraintType); err != nil {
+		return err
+	}
+	if err := item.Validate(); err != nil {
+		return errors.Wrapf(err, "constraint %s", constraintID)
+	}
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	return accessor.updateData(builder.constraints(constraintType), func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		constraints := model.NewClusterConstraints(constraintType)
+		if data != nil {
+			constraints = &model.ClusterConstraints{ZNRecord: *data}
+		}
+		constraints.SetConstraintItem(constraintID, item)
+		return &constraints.ZNRecord, nil
+	})
+}
+
+// RemoveConstraint removes the constraint item of the ID, removing a missing item is a no-op
+func (adm Admin) RemoveConstraint(cluster string, constraintType string, constraintID string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	if err := validateConstraintType(constraintType); err != nil {
+		return err
+	}
+	builder := &KeyBuilder{cluster}
+	if exists, _, err := adm.zkClient.Exists(builder.constraints(constraintType)); !exists || err != nil {
+		return err
+	}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	return accessor.updateData(builder.constraints(constraintType), func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		constraints := model.NewClusterConstraints(constraintType)
+		if data != nil {
+			constraints = &model.ClusterConstraints{ZNRecord: *data}
+		}
+		constraints.RemoveConstraintItem(constraintID)
+		return &constraints.ZNRecord, nil
+	})
+}
+
+// GetConstraints returns the constraints of the type, they are empty if none was set
+func (adm Admin) GetConstraints(cluster string, constraintType string) (*model.ClusterConstraints, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	if err := validateConstraintType(constraintType); err != nil {
+		return nil, err
+	}
+	builder := &KeyBuilder{cluster}
+	if exists, _, err := adm.zkClient.Exists(builder.constraints(constraintType)); !exists || err != nil {
+		if !exists {
+			return model.NewClusterConstraints(constraintType), nil
+		}
+		return nil, err
+	}
+	return newDataAccessor(adm.zkClient, builder).Constraints(constraintType)
+}
+
+func validateConstraintType(constraintType string) error {
+	if constraintType != model.ConstraintTypeMessage && constraintType != model.ConstraintTypeState {
+		return errors.Errorf("unknown constraint type %s", constraintType)
+	}
+	return nil
+}
+
 // DropCluster removes a helix cluster from zookeeper. This will remove the
 // znode named after the cluster name from the zookeeper root.
 func (adm Admin) DropCluster(cluster string) error {
@@ -524,10 +745,13 @@ func (adm Admin) AddNode(cluster string, node string) error {
 	}
 
 	// create new node for the participant
-	parts := strings.Split(node, "_")
+	host, port, err := model.ParseInstanceName(node)
+	if err != nil {
+		return err
+	}
 	n := model.NewMsg(node)
-	n.SetSimpleField("HELIX_HOST", parts[0])
-	n.SetSimpleField("HELIX_PORT", parts[1])
+	n.SetSimpleField("HELIX_HOST", host)
+	n.SetSimpleField("HELIX_PORT", strconv.Itoa(port))
 
 	accessor := newDataAccessor(adm.zkClient, builder)
 	accessor.createMsg(path, n)
@@ -567,6 +791,17 @@ func (adm Admin) DropNode(cluster string, node string) error {
 // ./helix-admin.sh --zkSvr localhost:2199 --addResource MYCLUSTER myDB 6 MasterSlave
 func (adm Admin) AddResource(
 	cluster string, resource string, partitions int, stateModel string) error {
+	return adm.addResource(cluster, resource, partitions, stateModel, "")
+}
+
+// AddResourceWithTag adds a resource which can only be hosted by the instances with the tag
+func (adm Admin) AddResourceWithTag(
+	cluster string, resource string, partitions int, stateModel string, tag string) error {
+	return adm.addResource(cluster, resource, partitions, stateModel, tag)
+}
+
+func (adm Admin) addResource(
+	cluster string, resource string, partitions int, stateModel string, tag string) error {
 	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
 		return ErrClusterNotSetup
 	}
@@ -583,7 +818,7 @@ func (adm Admin) AddResource(
 	}
 
 	// make sure the path for the ideal state does not exit
-	isPath := builder.idealStates() + "/" + resource
+	isPath := builder.idealStateForResource(resource)
 	if exists, _, err := adm.zkClient.Exists(isPath); exists || err != nil {
 		if exists {
 			return ErrResourceExists
@@ -600,16 +835,23 @@ func (adm Admin) AddResource(
 	// // save the ideal state in zookeeper
 	// is.Save(conn, cluster)
 
+	accessor := newDataAccessor(adm.zkClient, builder)
+	accessor.createMsg(isPath, newResourceIdealState(resource, partitions, stateModel, tag))
+
+	return nil
+}
+
+// newResourceIdealState returns the ideal state of a new SEMI_AUTO resource without replicas
+func newResourceIdealState(resource string, partitions int, stateModel string, tag string) *model.Message {
 	is := model.NewMsg(resource)
 	is.SetSimpleField("NUM_PARTITIONS", strconv.Itoa(partitions))
 	is.SetSimpleField("REPLICAS", strconv.Itoa(0))
 	is.SetSimpleField("REBALANCE_MODE", strings.ToUpper("SEMI_AUTO"))
 	is.SetStateModelDef(stateModel)
-
-	accessor := newDataAccessor(adm.zkClient, builder)
-	accessor.createMsg(isPath, is)
-
-	return nil
+	if tag != "" {
+		is.SetSimpleField(model.FieldKeyInstanceGroupTag, tag)
+	}
+	return is
 }
 
 // DropResource removes the specified resource from the cluster.
@@ -622,12 +864,44 @@ func (adm Admin) DropResource(cluster string, resource string) error {
 	builder := KeyBuilder{cluster}
 
 	// make sure the path for the ideal state does not exit
-	adm.zkClient.DeleteTree(builder.idealStates() + "/" + resource)
+	adm.zkClient.DeleteTree(builder.idealStateForResource(resource))
 	adm.zkClient.DeleteTree(builder.resourceConfig(resource))
 
 	return nil
 }
 
+// ActivateCluster makes the distributed controllers of the super cluster control the cluster,
+// or stops them from controlling it if not enable. The cluster is a FULL_AUTO LeaderStandby
+// resource of the super cluster with a single partition named after the cluster, and the
+// LEADER of the partition runs the controller of the cluster
+// This mirrors org.apache.helix.tools.ClusterSetup#activateCluster
+func (adm Admin) ActivateCluster(cluster string, superCluster string, enable bool) error {
+	if !enable {
+		return adm.DropResource(superCluster, cluster)
+	}
+	for _, c := range []string{cluster, superCluster} {
+		if ok, err := adm.isClusterSetup(c); !ok || err != nil {
+			return ErrClusterNotSetup
+		}
+	}
+	builder := &KeyBuilder{superCluster}
+	instances, err := adm.zkClient.Children(builder.participantConfigs())
+	if err != nil {
+		return err
+	}
+	idealState := model.NewIdealState(cluster)
+	idealState.SetRebalanceMode(model.RebalanceModeFullAuto)
+	idealState.SetStateModelDefRef(StateModelNameLeaderStandby)
+	idealState.SetNumPartitions(1)
+	// the controllers of the super cluster at activation are the LEADER and the STANDBYs
+	idealState.SetReplicas(len(instances))
+	if len(instances) == 0 {
+		idealState.SetReplicas(1)
+	}
+	idealState.SetListField(cluster, []string{})
+	return newDataAccessor(adm.zkClient, builder).SetProperty(builder.IdealState(cluster), &idealState.ZNRecord)
+}
+
 // EnableResource enables the specified resource in the cluster
 func (adm Admin) EnableResource(cluster string, resource string) error {
 	// make sure the cluster is already setup
@@ -637,7 +911,7 @@ func (adm Admin) EnableResource(cluster string, resource string) error {
 
 	builder := KeyBuilder{cluster}
 
-	isPath := builder.idealStates() + "/" + resource
+	isPath := builder.idealStateForResource(resource)
 
 	if exists, _, err := adm.zkClient.Exists(isPath); !exists || err != nil {
 		if !exists {
@@ -660,7 +934,7 @@ func (adm Admin) DisableResource(cluster string, resource string) error {
 
 	builder := KeyBuilder{cluster}
 
-	isPath := builder.idealStates() + "/" + resource
+	isPath := builder.idealStateForResource(resource)
 
 	if exists, _, err := adm.zkClient.Exists(isPath); !exists || err != nil {
 		if !exists {
@@ -885,6 +1159,440 @@ func (adm Admin) DropInstance(cluster string, instance string) error {
 	return err
 }
 
+// AddInstanceTag adds a tag to the instance config
+// ./helix-admin.sh --zkSvr localhost:2199 --addInstanceTag MYCLUSTER localhost_12913 tag
+func (adm Admin) AddInstanceTag(cluster string, instance string, tag string) error {
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.AddTag(tag)
+	})
+}
+
+// RemoveInstanceTag removes a tag from the instance config
+// ./helix-admin.sh --zkSvr localhost:2199 --removeInstanceTag MYCLUSTER localhost_12913 tag
+func (adm Admin) RemoveInstanceTag(cluster string, instance string, tag string) error {
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.RemoveTag(tag)
+	})
+}
+
+// GetInstancesWithTag returns the instances which have the tag in the cluster
+func (adm Admin) GetInstancesWithTag(cluster string, tag string) ([]string, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	instances, err := adm.zkClient.Children(builder.participantConfigs())
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, instance := range instances {
+		config, err := accessor.InstanceConfig(builder.participantConfig(instance))
+		if err != nil {
+			return nil, err
+		}
+		if config.ContainsTag(tag) {
+			result = append(result, instance)
+		}
+	}
+	return result, nil
+}
+
+// RebalanceResource computes the preference lists of the partitions of a SEMI_AUTO resource
+// and rewrites the list fields of its ideal state, the replicas are capped at the number of
+// instances. Mirrors org.apache.helix.manager.zk.ZKHelixAdmin#rebalance
+func (adm Admin) RebalanceResource(
+	cluster string, resource string, replicas int, constraints RebalanceConstraints) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	path := builder.idealStateForResource(resource)
+	if exists, _, err := adm.zkClient.Exists(path); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+	configs, err := accessor.InstanceConfigs()
+	if err != nil {
+		return err
+	}
+	strategy := constraints.Strategy
+	if strategy == nil {
+		strategy = ConsistentHashingStrategy{}
+		clusterConfig, err := adm.GetClusterConfig(cluster)
+		if err != nil {
+			return err
+		}
+		if clusterConfig.IsTopologyAwareEnabled() {
+			strategy = CrushStrategy{ClusterConfig: clusterConfig}
+		}
+	}
+
+	return accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		if data == nil {
+			return nil, ErrResourceNotExists
+		}
+		idealState := &model.IdealState{ZNRecord: *data}
+		if idealState.GetRebalanceMode() != model.RebalanceModeSemiAuto {
+			return nil, ErrNotSemiAutoResource
+		}
+		tag := constraints.InstanceTag
+		if tag == "" {
+			tag = idealState.GetInstanceGroupTag()
+		}
+		var instances []*model.InstanceConfig
+		for _, config := range configs {
+			if tag == "" || config.ContainsTag(tag) {
+				instances = append(instances, config)
+			}
+		}
+		if len(instances) == 0 {
+			return nil, ErrNoInstancesToPlace
+		}
+		if replicas > len(instances) {
+			replicas = len(instances)
+		}
+
+		partitions := idealState.GetPartitionSet()
+		preferenceLists := strategy.ComputePreferenceLists(partitions, instances, replicas)
+		idealState.ListFields = map[string][]string{}
+		for _, partition := range partitions {
+			idealState.SetPreferenceList(partition, preferenceLists[partition])
+		}
+		idealState.SetReplicas(replicas)
+		return &idealState.ZNRecord, nil
+	})
+}
+
+// ValidateIdealState checks the placement proposed by the ideal state against the configs of the cluster,
+// e.g. before the ideal state is written, see ValidatePlacement
+func (adm Admin) ValidateIdealState(cluster string, idealState *model.IdealState) ([]PlacementViolation, error) {
+	clusterConfig, err := adm.GetClusterConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	resourceConfig, err := adm.GetResourceConfig(cluster, idealState.GetResourceName())
+	if err != nil {
+		return nil, err
+	}
+	instances, err := newDataAccessor(adm.zkClient, &KeyBuilder{cluster}).InstanceConfigs()
+	if err != nil {
+		return nil, err
+	}
+	return ValidatePlacement(idealState, PlacementConstraints{
+		ClusterConfig:  clusterConfig,
+		ResourceConfig: resourceConfig,
+		Instances:      instances,
+	}), nil
+}
+
+// EnableInstance enables the instance in the cluster
+// ./helix-admin.sh --zkSvr localhost:2199 --enableInstance MYCLUSTER localhost_12913 true
+func (adm Admin) EnableInstance(cluster string, instance string) error {
+	return adm.setInstanceEnabled(cluster, instance, true)
+}
+
+// DisableInstance disables the instance in the cluster, the controller moves
+// the partitions of the instance to the initial state
+// ./helix-admin.sh --zkSvr localhost:2199 --enableInstance MYCLUSTER localhost_12913 false
+func (adm Admin) DisableInstance(cluster string, instance string) error {
+	return adm.setInstanceEnabled(cluster, instance, false)
+}
+
+func (adm Admin) setInstanceEnabled(cluster string, instance string, enabled bool) error {
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.SetEnabled(enabled)
+		config.SetEnabledTime(time.Now())
+	})
+}
+
+// EnablePartition enables the partition of the resource on the instance
+// ./helix-admin.sh --zkSvr localhost:2199 --enablePartition true MYCLUSTER localhost_12913 resource partition
+func (adm Admin) EnablePartition(cluster string, instance string, resource string, partition string) error {
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.SetPartitionEnabled(resource, partition, true)
+	})
+}
+
+// DisablePartition disables the partition of the resource on the instance, the controller
+// moves the partition on the instance to the initial state
+// ./helix-admin.sh --zkSvr localhost:2199 --enablePartition false MYCLUSTER localhost_12913 resource partition
+func (adm Admin) DisablePartition(cluster string, instance string, resource string, partition string) error {
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.SetPartitionEnabled(resource, partition, false)
+	})
+}
+
+// GetInstanceConfig returns the typed config of the instance
+func (adm Admin) GetInstanceConfig(cluster string, instance string) (*model.InstanceConfig, error) {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	path := builder.participantConfig(instance)
+	if exists, _, err := adm.zkClient.Exists(path); !exists || err != nil {
+		if !exists {
+			return nil, ErrNodeNotExist
+		}
+		return nil, err
+	}
+	return newDataAccessor(adm.zkClient, builder).InstanceConfig(path)
+}
+
+// SetInstanceDomain sets the location of the instance in the cluster topology,
+// e.g. zone=z1,rack=r1,instance=localhost_12913
+func (adm Admin) SetInstanceDomain(cluster string, instance string, domain string) error {
+	if err := model.NewInstanceConfig(instance).SetDomain(domain); err != nil {
+		return err
+	}
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.SetDomain(domain)
+	})
+}
+
+// SetInstanceCapacityMap sets the capacities of the instance for the WAGED rebalancer by capacity key
+func (adm Admin) SetInstanceCapacityMap(cluster string, instance string, capacity map[string]int) error {
+	if err := model.NewInstanceConfig(instance).SetInstanceCapacityMap(capacity); err != nil {
+		return err
+	}
+	return adm.updateInstanceConfig(cluster, instance, func(config *model.InstanceConfig) {
+		config.SetInstanceCapacityMap(capacity)
+	})
+}
+
+// EnableWagedRebalance switches the resources to the FULL_AUTO mode placed by the WAGED
+// rebalancer of the Java controller, which places the partitions by their weights against
+// the capacities of the instances. The resources are checked to exist before any is updated.
+// Mirrors org.apache.helix.manager.zk.ZKHelixAdmin#enableWagedRebalance
+func (adm Admin) EnableWagedRebalance(cluster string, resources []string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	for _, resource := range resources {
+		if exists, _, err := adm.zkClient.Exists(builder.idealStateForResource(resource)); !exists || err != nil {
+			if !exists {
+				return ErrResourceNotExists
+			}
+			return err
+		}
+	}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	for _, resource := range resources {
+		err := accessor.updateData(builder.idealStateForResource(resource),
+			func(data *model.ZNRecord) (*model.ZNRecord, error) {
+				if data == nil {
+					return nil, ErrResourceNotExists
+				}
+				idealState := &model.IdealState{ZNRecord: *data}
+				idealState.SetRebalanceMode(model.RebalanceModeFullAuto)
+				idealState.SetRebalancerClassName(model.WagedRebalancerClassName)
+				return &idealState.ZNRecord, nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTopology returns the fault zones of the instances of the cluster
+func (adm Admin) GetTopology(cluster string) (*Topology, error) {
+	clusterConfig, err := adm.GetClusterConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := newDataAccessor(adm.zkClient, &KeyBuilder{cluster}).InstanceConfigs()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]*model.InstanceConfig, 0, len(configs))
+	for _, config := range configs {
+		instances = append(instances, config)
+	}
+	return NewTopology(clusterConfig, instances), nil
+}
+
+func (adm Admin) updateInstanceConfig(
+	cluster string, instance string, update func(config *model.InstanceConfig)) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	path := builder.participantConfig(instance)
+	if exists, _, err := adm.zkClient.Exists(path); !exists || err != nil {
+		if !exists {
+			return ErrNodeNotExist
+		}
+		return err
+	}
+
+	accessor := newDataAccessor(adm.zkClient, builder)
+	return accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		if data == nil {
+			return nil, ErrNodeNotExist
+		}
+		config := &model.InstanceConfig{ZNRecord: *data}
+		update(config)
+		return &config.ZNRecord, nil
+	})
+}
+
+// ResetPartition resets partitions of a resource on an instance from the ERROR state,
+// by sending ERROR->{initial state} transitions to the instance.
+// Mirrors org.apache.helix.manager.zk.ZKHelixAdmin#resetPartition
+func (adm Admin) ResetPartition(
+	cluster string, instance string, resource string, partitions []string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	accessor := newDataAccessor(adm.zkClient, &KeyBuilder{cluster})
+	msgs, notInError, err := adm.resetMessages(accessor, instance, resource, partitions, false)
+	if err != nil {
+		return err
+	}
+	if len(notInError) > 0 {
+		return errors.Wrapf(ErrPartitionNotInErrorState, "partition %s", notInError[0])
+	}
+	for _, msg := range msgs {
+		if err := accessor.CreateParticipantMsg(instance, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetMessages returns the ERROR->{initial state} messages of the partitions of the resource
+// in ERROR state on the live instance, and the partitions not in ERROR state. All the partitions
+// in ERROR state are reset if allInError is set
+func (adm Admin) resetMessages(accessor *DataAccessor, instance string, resource string,
+	partitions []string, allInError bool) ([]*model.Message, []string, error) {
+	builder := accessor.keyBuilder
+	if exists, _, err := adm.zkClient.Exists(builder.liveInstance(instance)); !exists || err != nil {
+		if !exists {
+			return nil, nil, ErrInstanceNotLive
+		}
+		return nil, nil, err
+	}
+	liveInstance, err := accessor.LiveInstance(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionID := liveInstance.GetSessionID()
+
+	currentStatePath := builder.currentStateForResource(instance, sessionID, resource)
+	if exists, _, err := adm.zkClient.Exists(currentStatePath); !exists || err != nil {
+		if !exists {
+			if allInError {
+				return nil, nil, nil
+			}
+			return nil, nil, ErrPartitionNotInErrorState
+		}
+		return nil, nil, err
+	}
+	currentState, err := accessor.CurrentState(instance, sessionID, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	if allInError {
+		partitions = nil
+		for partition, state := range currentState.GetPartitionStateMap() {
+			if state == StateModelStateError {
+				partitions = append(partitions, partition)
+			}
+		}
+		sort.Strings(partitions)
+	}
+	var inError, notInError []string
+	for _, partition := range partitions {
+		if currentState.GetState(partition) == StateModelStateError {
+			inError = append(inError, partition)
+		} else {
+			notInError = append(notInError, partition)
+		}
+	}
+	if len(inError) == 0 {
+		return nil, notInError, nil
+	}
+
+	stateModelDefName := currentState.GetStateModelDef()
+	stateModelDefPath := builder.stateModelDef(stateModelDefName)
+	if exists, _, err := adm.zkClient.Exists(stateModelDefPath); !exists || err != nil {
+		if !exists {
+			return nil, nil, ErrStateModelDefNotExist
+		}
+		return nil, nil, err
+	}
+	stateModelDef, err := accessor.StateModelDef(stateModelDefName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs := make([]*model.Message, 0, len(inError))
+	for _, partition := range inError {
+		msg := model.NewMsg(util.NewUUID())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetMsgState(model.MessageStateNew)
+		msg.SetSrcName(getAdminName())
+		msg.SetTargetName(instance)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName(resource)
+		msg.SetPartitionName(partition)
+		msg.SetStateModelDef(stateModelDefName)
+		msg.SetFromState(StateModelStateError)
+		msg.SetToState(stateModelDef.GetInitialState())
+		msg.SetCreateTime(time.Now())
+		msgs = append(msgs, msg)
+	}
+	return msgs, notInError, nil
+}
+
+// SendMessage sends the message to the live instance, the source, target and create time of the
+// message are filled in, and the target session is set to the current session of the instance if empty
+func (adm Admin) SendMessage(cluster string, instance string, msg *model.Message) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+
+	if exists, _, err := adm.zkClient.Exists(builder.liveInstance(instance)); !exists || err != nil {
+		if !exists {
+			return ErrInstanceNotLive
+		}
+		return err
+	}
+	if msg.GetTargetSessionID() == "" {
+		liveInstance, err := accessor.LiveInstance(instance)
+		if err != nil {
+			return err
+		}
+		msg.SetTargetSessionID(liveInstance.GetSessionID())
+	}
+	msg.SetSrcName(getAdminName())
+	msg.SetTargetName(instance)
+	msg.SetCreateTime(time.Now())
+	return accessor.CreateParticipantMsg(instance, msg)
+}
+
 func (adm Admin) isClusterSetup(cluster string) (bool, error) {
 	keyBuilder := KeyBuilder{cluster}
 
@@ -899,3 +1607,13 @@ func (adm Admin) isClusterSetup(cluster string) (bool, error) {
 		keyBuilder.stateModelDefs(),
 	)
 }
+
+// getAdminName mirrors the admin name used as the source of messages sent by
+// org.apache.helix.manager.zk.ZKHelixAdmin
+func getAdminName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return hostname + "-ADMIN"
+}
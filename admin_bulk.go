@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+)
+
+// _bulkBatchSize bounds the ops of the transactions of the bulk operations, keeping the
+// transactions below the jute.maxbuffer of the servers
+const _bulkBatchSize = 100
+
+// ErrPartialFailure is returned by the bulk operations applied on some instances only,
+// the operation succeeded on the instances without a failure
+type ErrPartialFailure struct {
+	// Failures holds the error of each instance the operation failed on
+	Failures map[string]error
+}
+
+func (e *ErrPartialFailure) Error() string {
+	instances := make([]string, 0, len(e.Failures))
+	for instance := range e.Failures {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	failures := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		failures = append(failures, fmt.Sprintf("%s: %v", instance, e.Failures[instance]))
+	}
+	return fmt.Sprintf("bulk operation failed on %d instances: %s", len(instances), strings.Join(failures, "; "))
+}
+
+// partialFailure returns the error of the failures, nil if there is none
+func partialFailure(failures map[string]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return &ErrPartialFailure{Failures: failures}
+}
+
+// EnablePartitions enables the partitions of the resource on each instance,
+// see SetPartitionsEnabled
+func (adm Admin) EnablePartitions(cluster string, resource string, partitions map[string][]string) error {
+	return adm.SetPartitionsEnabled(cluster, resource, partitions, true)
+}
+
+// DisablePartitions disables the partitions of the resource on each instance,
+// see SetPartitionsEnabled
+func (adm Admin) DisablePartitions(cluster string, resource string, partitions map[string][]string) error {
+	return adm.SetPartitionsEnabled(cluster, resource, partitions, false)
+}
+
+// SetPartitionsEnabled enables or disables the partitions of the resource by instance. The
+// configs of the instances are updated in transactions of up to 100 instances, the instances
+// of a failed transaction, e.g. on a concurrent update, are updated one by one. An
+// *ErrPartialFailure reports the instances not updated
+func (adm Admin) SetPartitionsEnabled(
+	cluster string, resource string, partitions map[string][]string, enabled bool) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	update := func(instance string) func(config *model.InstanceConfig) {
+		return func(config *model.InstanceConfig) {
+			for _, partition := range partitions[instance] {
+				config.SetPartitionEnabled(resource, partition, enabled)
+			}
+		}
+	}
+	failures := make(map[string]error)
+	instances := sortedKeys(partitions)
+	for start := 0; start < len(instances); start += _bulkBatchSize {
+		end := start + _bulkBatchSize
+		if end > len(instances) {
+			end = len(instances)
+		}
+		batch := make([]string, 0, end-start)
+		ops := make([]interface{}, 0, end-start)
+		for _, instance := range instances[start:end] {
+			record, err := accessor.record(builder.participantConfig(instance))
+			if errors.Cause(err) == zk.ErrNoNode {
+				failures[instance] = ErrNodeNotExist
+				continue
+			} else if err != nil {
+				failures[instance] = err
+				continue
+			}
+			config := &model.InstanceConfig{ZNRecord: *record}
+			update(instance)(config)
+			data, err := config.Marshal()
+			if err != nil {
+				failures[instance] = err
+				continue
+			}
+			batch = append(batch, instance)
+			ops = append(ops, &zk.SetDataRequest{
+				Path: builder.participantConfig(instance), Data: data, Version: record.Version})
+		}
+		if len(ops) == 0 || adm.zkClient.Multi(ops...) == nil {
+			continue
+		}
+		for _, instance := range batch {
+			if err := adm.updateInstanceConfig(cluster, instance, update(instance)); err != nil {
+				failures[instance] = err
+			}
+		}
+	}
+	return partialFailure(failures)
+}
+
+// ResetPartitions resets the partitions of the resource by instance from the ERROR state, the
+// messages of each instance are created in transactions of up to 100 messages. The partitions
+// in ERROR state are reset even if others of the instance are not, an *ErrPartialFailure
+// reports the instances not reset and the ones with partitions not in ERROR state
+func (adm Admin) ResetPartitions(cluster string, resource string, partitions map[string][]string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	accessor := newDataAccessor(adm.zkClient, &KeyBuilder{cluster})
+	failures := make(map[string]error)
+	for _, instance := range sortedKeys(partitions) {
+		if err := adm.resetInstance(accessor, instance, resource, partitions[instance], false); err != nil {
+			failures[instance] = err
+		}
+	}
+	return partialFailure(failures)
+}
+
+// ResetResource resets all the partitions of the resource in ERROR state on the live instances,
+// an *ErrPartialFailure reports the instances not reset.
+// Mirrors org.apache.helix.manager.zk.ZKHelixAdmin#resetResource
+func (adm Admin) ResetResource(cluster string, resource string) error {
+	// make sure the cluster is already setup
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+
+	builder := &KeyBuilder{cluster}
+	if exists, _, err := adm.zkClient.Exists(builder.idealStateForResource(resource)); !exists || err != nil {
+		if !exists {
+			return ErrResourceNotExists
+		}
+		return err
+	}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	liveInstances, err := accessor.LiveInstances()
+	if err != nil {
+		return err
+	}
+	failures := make(map[string]error)
+	for instance := range liveInstances {
+		if err := adm.resetInstance(accessor, instance, resource, nil, true); err != nil {
+			failures[instance] = err
+		}
+	}
+	return partialFailure(failures)
+}
+
+// resetInstance sends the reset messages of the partitions in ERROR state to the instance,
+// it fails with ErrPartitionNotInErrorState once they are sent if others are not in ERROR state
+func (adm Admin) resetInstance(
+	accessor *DataAccessor, instance string, resource string, partitions []string, allInError bool) error {
+	msgs, notInError, err := adm.resetMessages(accessor, instance, resource, partitions, allInError)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(msgs); start += _bulkBatchSize {
+		end := start + _bulkBatchSize
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		ops := make([]interface{}, 0, end-start)
+		for _, msg := range msgs[start:end] {
+			data, err := msg.Marshal()
+			if err != nil {
+				return err
+			}
+			ops = append(ops, &zk.CreateRequest{
+				Path: accessor.keyBuilder.participantMsg(instance, msg.ID), Data: data, Flags: uzk.FlagsZero})
+		}
+		if err := adm.zkClient.Multi(ops...); err != nil {
+			return err
+		}
+	}
+	if len(notInError) > 0 {
+		return errors.Wrapf(ErrPartitionNotInErrorState, "partitions %s", strings.Join(notInError, ","))
+	}
+	return nil
+}
+
+func sortedKeys(partitions map[string][]string) []string {
+	keys := make([]string, 0, len(partitions))
+	for key := range partitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix/model"
+)
+
+func TestBulkEnableDisablePartitions(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1", "localhost_2")
+	defer cluster.close()
+	admin := cluster.admin
+
+	err := admin.DisablePartitions(TestClusterName, "r", map[string][]string{
+		"localhost_1": {"r_0", "r_1"},
+		"localhost_2": {"r_0"},
+		"localhost_3": {"r_0"},
+	})
+	failure, ok := err.(*ErrPartialFailure)
+	require.True(t, ok)
+	assert.Equal(t, map[string]error{"localhost_3": ErrNodeNotExist}, failure.Failures)
+	config, err := admin.GetInstanceConfig(TestClusterName, "localhost_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r_0", "r_1"}, config.GetDisabledPartitions("r"))
+	config, err = admin.GetInstanceConfig(TestClusterName, "localhost_2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r_0"}, config.GetDisabledPartitions("r"))
+
+	assert.NoError(t, admin.EnablePartitions(TestClusterName, "r", map[string][]string{
+		"localhost_1": {"r_1"},
+		"localhost_2": {"r_0"},
+	}))
+	config, err = admin.GetInstanceConfig(TestClusterName, "localhost_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r_0"}, config.GetDisabledPartitions("r"))
+	config, err = admin.GetInstanceConfig(TestClusterName, "localhost_2")
+	assert.NoError(t, err)
+	assert.Empty(t, config.GetDisabledPartitions("r"))
+}
+
+func TestBulkResetPartitions(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin, keyBuilder, accessor := cluster.admin, cluster.keyBuilder, cluster.accessor
+	assert.NoError(t, admin.AddResource(TestClusterName, "r", 200, StateModelNameOnlineOffline))
+	states := map[string]map[string]string{
+		"localhost_1": {"r_0": StateModelStateError, "r_1": StateModelStateError, "r_2": StateModelStateOnline},
+		"localhost_2": {},
+	}
+	for i := 0; i < 150; i++ {
+		states["localhost_2"][fmt.Sprintf("r_%d", i)] = StateModelStateError
+	}
+	for instance, partitionStates := range states {
+		assert.NoError(t, admin.AddNode(TestClusterName, instance))
+		session := "session_" + instance
+		liveInstance := model.NewLiveInstance(instance, session)
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance(instance), liveInstance.ZNRecord))
+		currentState := &model.CurrentState{ZNRecord: *model.NewRecord("r")}
+		currentState.SetStateModelDef(StateModelNameOnlineOffline)
+		currentState.SetSessionID(session)
+		for partition, state := range partitionStates {
+			currentState.SetState(partition, state)
+		}
+		assert.NoError(t, accessor.createData(keyBuilder.currentStateForResource(instance, session, "r"),
+			currentState.ZNRecord))
+	}
+	resets := func(instance string) map[string]string {
+		records, err := accessor.childRecords(keyBuilder.participantMessages(instance))
+		assert.NoError(t, err)
+		partitions := make(map[string]string, len(records))
+		for _, record := range records {
+			msg := &model.Message{ZNRecord: *record}
+			partition, _ := msg.GetPartitionName()
+			assert.Equal(t, StateModelStateError, msg.GetFromState())
+			partitions[partition] = msg.GetToState()
+		}
+		return partitions
+	}
+
+	// the partitions in ERROR state are reset even if others are not
+	err := admin.ResetPartitions(TestClusterName, "r", map[string][]string{
+		"localhost_1": {"r_0", "r_2"},
+		"localhost_3": {"r_0"},
+	})
+	failure, ok := err.(*ErrPartialFailure)
+	require.True(t, ok)
+	assert.Len(t, failure.Failures, 2)
+	assert.Equal(t, ErrPartitionNotInErrorState, errors.Cause(failure.Failures["localhost_1"]))
+	assert.Equal(t, ErrInstanceNotLive, failure.Failures["localhost_3"])
+	assert.Equal(t, map[string]string{"r_0": StateModelStateOffline}, resets("localhost_1"))
+
+	// all the partitions in ERROR state are reset across the transactions
+	assert.NoError(t, admin.ResetResource(TestClusterName, "r"))
+	assert.Len(t, resets("localhost_1"), 2)
+	assert.Len(t, resets("localhost_2"), 150)
+	assert.Equal(t, ErrResourceNotExists, admin.ResetResource(TestClusterName, "unknown"))
+}
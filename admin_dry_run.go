@@ -0,0 +1,45 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/uber-go/go-helix/zk"
+)
+
+// DryRun calls fn with an Admin whose write operations, e.g. AddResource, RebalanceResource,
+// ApplyClusterSpec or DisableInstance, don't change Zookeeper, and returns the znode mutations
+// they would perform, for change-review workflows. The reads of the dry run Admin see the
+// mutations recorded before, so the operations are planned as if applied in order:
+//
+//	mutations, err := admin.DryRun(func(dryRun *Admin) error {
+//		return dryRun.AddResource("cluster", "resource", 32, "MasterSlave")
+//	})
+//
+// The mutations recorded before fn returns an error are returned with the error
+func (adm Admin) DryRun(fn func(dryRun *Admin) error) ([]zk.Mutation, error) {
+	client, recorder, err := zk.NewDryRunClient(adm.zkClient)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect()
+	err = fn(&Admin{zkClient: client})
+	return recorder.Mutations(), err
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	uzk "github.com/uber-go/go-helix/zk"
+)
+
+func TestAdminDryRun(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin, keyBuilder := cluster.client, cluster.admin, cluster.keyBuilder
+
+	mutations, err := admin.DryRun(func(dryRun *Admin) error {
+		if err := dryRun.AddNode(TestClusterName, "localhost_1"); err != nil {
+			return err
+		}
+		if err := dryRun.AddResource(TestClusterName, "r1", 4, StateModelNameOnlineOffline); err != nil {
+			return err
+		}
+		// the node added in the dry run is seen by the next operations
+		return dryRun.DisableInstance(TestClusterName, "localhost_1")
+	})
+	assert.NoError(t, err)
+	// paths are the first mutation of each path
+	paths := map[string]string{}
+	for _, m := range mutations {
+		if _, ok := paths[m.Path]; !ok {
+			paths[m.Path] = m.Op
+		}
+	}
+	assert.Equal(t, uzk.MutationCreate, paths[keyBuilder.participantConfig("localhost_1")])
+	assert.Equal(t, uzk.MutationCreate, paths[keyBuilder.idealStateForResource("r1")])
+	last := mutations[len(mutations)-1]
+	assert.Equal(t, uzk.MutationSet, last.Op)
+	assert.Equal(t, keyBuilder.participantConfig("localhost_1"), last.Path)
+
+	// nothing is applied
+	exists, _, err := client.Exists(keyBuilder.idealStateForResource("r1"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	exists, _, err = client.Exists(keyBuilder.participantConfig("localhost_1"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// the errors are returned with the mutations recorded before
+	mutations, err = admin.DryRun(func(dryRun *Admin) error {
+		return dryRun.AddResource(TestClusterName, "r1", 4, "missing")
+	})
+	assert.Equal(t, ErrStateModelDefNotExist, err)
+	assert.Empty(t, mutations)
+}
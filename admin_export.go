@@ -0,0 +1,399 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+)
+
+const _restPathPrefix = "/admin/v2/clusters"
+
+// The health of a partition or a resource in the Helix REST API
+const (
+	HealthHealthy        = "HEALTHY"
+	HealthPartialHealthy = "PARTIAL_HEALTHY"
+	HealthUnhealthy      = "UNHEALTHY"
+)
+
+// ClusterSummary is the status of a cluster in the JSON shape of the Helix REST API
+type ClusterSummary struct {
+	ID string `json:"id"`
+	// Controller is the name of the leader controller, empty if there is none
+	Controller    string   `json:"controller"`
+	Instances     []string `json:"instances"`
+	LiveInstances []string `json:"liveInstances"`
+	Resources     []string `json:"resources"`
+	Paused        bool     `json:"paused"`
+	Maintenance   bool     `json:"maintenance"`
+}
+
+// ResourceDetail is a resource in the JSON shape of the Helix REST API, the records are
+// nil if missing
+type ResourceDetail struct {
+	ID             string          `json:"id"`
+	ResourceConfig *model.ZNRecord `json:"resourceConfig"`
+	IdealState     *model.ZNRecord `json:"idealState"`
+	ExternalView   *model.ZNRecord `json:"externalView"`
+}
+
+// InstanceDetail is an instance in the JSON shape of the Helix REST API, LiveInstance is nil
+// if the instance is not live
+type InstanceDetail struct {
+	ID           string          `json:"id"`
+	Config       *model.ZNRecord `json:"config"`
+	LiveInstance *model.ZNRecord `json:"liveInstance"`
+}
+
+// GetClusterSummary returns the status of the cluster
+// This mirrors org.apache.helix.rest.server.resources.helix.ClusterAccessor#getClusterInfo
+func (adm Admin) GetClusterSummary(cluster string) (*ClusterSummary, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	summary := &ClusterSummary{ID: cluster}
+	var err error
+	if summary.Instances, err = adm.sortedChildren(builder.instances()); err != nil {
+		return nil, err
+	}
+	if summary.LiveInstances, err = adm.sortedChildren(builder.liveInstances()); err != nil {
+		return nil, err
+	}
+	if summary.Resources, err = adm.sortedChildren(builder.idealStates()); err != nil {
+		return nil, err
+	}
+	leader, err := adm.zkClient.GetRecordFromPath(builder.controllerLeader())
+	if err == nil {
+		summary.Controller = leader.ID
+	} else if errors.Cause(err) != zk.ErrNoNode {
+		return nil, err
+	}
+	signal, err := adm.GetPauseSignal(cluster)
+	if err != nil {
+		return nil, err
+	}
+	summary.Paused = signal != nil && signal.IsClusterFreeze()
+	if summary.Maintenance, _, err = adm.zkClient.Exists(builder.maintenance()); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// GetResourceDetail returns the config, the ideal state and the external view of the resource
+func (adm Admin) GetResourceDetail(cluster string, resource string) (*ResourceDetail, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	detail := &ResourceDetail{ID: resource}
+	var err error
+	if detail.IdealState, err = adm.zkClient.GetRecordFromPath(builder.idealStateForResource(resource)); err != nil {
+		return nil, err
+	}
+	if detail.ResourceConfig, err = adm.optionalRecord(builder.resourceConfig(resource)); err != nil {
+		return nil, err
+	}
+	if detail.ExternalView, err = adm.optionalRecord(builder.externalViewForResource(resource)); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// GetInstanceDetail returns the config and the live instance of the instance
+func (adm Admin) GetInstanceDetail(cluster string, instance string) (*InstanceDetail, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	detail := &InstanceDetail{ID: instance}
+	var err error
+	if detail.Config, err = adm.zkClient.GetRecordFromPath(builder.participantConfig(instance)); err != nil {
+		return nil, err
+	}
+	if detail.LiveInstance, err = adm.optionalRecord(builder.liveInstance(instance)); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// GetResourceHealth returns the health of the partitions of the resource: HEALTHY if the top
+// state and all the replicas are up, PARTIAL_HEALTHY if the top state is, UNHEALTHY otherwise
+// This mirrors org.apache.helix.rest.server.resources.helix.ResourceAccessor#computePartitionHealth
+func (adm Admin) GetResourceHealth(cluster string, resource string) (map[string]string, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	accessor := newDataAccessor(adm.zkClient, &KeyBuilder{cluster})
+	idealState, err := accessor.IdealState(resource)
+	if err != nil {
+		return nil, err
+	}
+	stateModelDef, err := accessor.StateModelDef(idealState.GetStateModelDefRef())
+	if err != nil {
+		return nil, err
+	}
+	view, err := accessor.ExternalView(resource)
+	if err != nil && errors.Cause(err) != zk.ErrNoNode {
+		return nil, err
+	}
+	topState := ""
+	if states := stateModelDef.GetStatesPriorityList(); len(states) > 0 {
+		topState = states[0]
+	}
+	health := map[string]string{}
+	for _, partition := range idealState.GetPartitionSet() {
+		var states map[string]string
+		if view != nil {
+			states = view.GetStateMap(partition)
+		}
+		health[partition] = partitionHealth(states, topState, stateModelDef.GetInitialState(),
+			idealState.GetReplicas())
+	}
+	return health, nil
+}
+
+// GetResourcesHealth returns the health of the resources of the cluster: HEALTHY if all their
+// partitions are, UNHEALTHY if any is, PARTIAL_HEALTHY otherwise
+func (adm Admin) GetResourcesHealth(cluster string) (map[string]string, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	resources, err := adm.zkClient.Children((&KeyBuilder{cluster}).idealStates())
+	if err != nil {
+		return nil, err
+	}
+	health := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		partitions, err := adm.GetResourceHealth(cluster, resource)
+		if err != nil {
+			return nil, err
+		}
+		health[resource] = HealthHealthy
+		for _, partition := range partitions {
+			if partition == HealthUnhealthy {
+				health[resource] = HealthUnhealthy
+				break
+			}
+			if partition == HealthPartialHealthy {
+				health[resource] = HealthPartialHealthy
+			}
+		}
+	}
+	return health, nil
+}
+
+// partitionHealth returns the health of a partition from its states by instance
+func partitionHealth(states map[string]string, topState string, initialState string, replicas int) string {
+	hasTopState := false
+	up := 0
+	for _, state := range states {
+		if state == topState {
+			hasTopState = true
+		}
+		if state != StateModelStateError && state != initialState && state != StateModelStateDropped {
+			up++
+		}
+	}
+	switch {
+	case hasTopState && up >= replicas:
+		return HealthHealthy
+	case hasTopState:
+		return HealthPartialHealthy
+	default:
+		return HealthUnhealthy
+	}
+}
+
+func (adm Admin) sortedChildren(path string) ([]string, error) {
+	children, err := adm.zkClient.Children(path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// optionalRecord returns the record at the path, nil if missing
+func (adm Admin) optionalRecord(path string) (*model.ZNRecord, error) {
+	record, err := adm.zkClient.GetRecordFromPath(path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	}
+	return record, err
+}
+
+// RESTHandler serves the status of the clusters read-only in the JSON shapes of the Helix REST
+// API, so the dashboards built for it can be pointed at a Go gateway:
+//
+//	GET /admin/v2/clusters
+//	GET /admin/v2/clusters/{cluster}
+//	GET /admin/v2/clusters/{cluster}/resources
+//	GET /admin/v2/clusters/{cluster}/resources/health
+//	GET /admin/v2/clusters/{cluster}/resources/{resource}
+//	GET /admin/v2/clusters/{cluster}/resources/{resource}/{idealState,externalView,health}
+//	GET /admin/v2/clusters/{cluster}/instances
+//	GET /admin/v2/clusters/{cluster}/instances/{instance}
+//	GET /admin/v2/clusters/{cluster}/instances/{instance}/configs
+func (adm Admin) RESTHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeRESTJSON(w, nil, errors.New("the endpoints are read-only"), http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != _restPathPrefix && !strings.HasPrefix(r.URL.Path, _restPathPrefix+"/") {
+			writeRESTJSON(w, nil, errors.New("not found"), http.StatusNotFound)
+			return
+		}
+		var segments []string
+		if path := strings.Trim(strings.TrimPrefix(r.URL.Path, _restPathPrefix), "/"); path != "" {
+			segments = strings.Split(path, "/")
+		}
+		result, err := adm.serveREST(segments)
+		status := http.StatusOK
+		switch {
+		case err == errRESTNotFound || errors.Cause(err) == ErrClusterNotSetup || errors.Cause(err) == zk.ErrNoNode:
+			status = http.StatusNotFound
+		case err != nil:
+			status = http.StatusInternalServerError
+		}
+		writeRESTJSON(w, result, err, status)
+	})
+}
+
+var errRESTNotFound = errors.New("not found")
+
+// serveREST returns the response of the path segments after /admin/v2/clusters
+func (adm Admin) serveREST(segments []string) (interface{}, error) {
+	if len(segments) == 0 {
+		clusters, err := adm.zkClient.Children("/")
+		if err != nil {
+			return nil, err
+		}
+		result := struct {
+			Clusters []string `json:"clusters"`
+		}{Clusters: []string{}}
+		for _, cluster := range clusters {
+			if ok, err := adm.isClusterSetup(cluster); ok && err == nil {
+				result.Clusters = append(result.Clusters, cluster)
+			}
+		}
+		sort.Strings(result.Clusters)
+		return result, nil
+	}
+	cluster := segments[0]
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	switch {
+	case len(segments) == 1:
+		return adm.GetClusterSummary(cluster)
+	case segments[1] == "resources" && len(segments) == 2:
+		idealStates, err := adm.sortedChildren(builder.idealStates())
+		if err != nil {
+			return nil, err
+		}
+		externalViews, err := adm.sortedChildren(builder.externalView())
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			ID            string   `json:"id"`
+			IdealStates   []string `json:"idealStates"`
+			ExternalViews []string `json:"externalViews"`
+		}{"resources", idealStates, externalViews}, nil
+	case segments[1] == "resources" && len(segments) == 3 && segments[2] == "health":
+		return adm.GetResourcesHealth(cluster)
+	case segments[1] == "resources" && len(segments) == 3:
+		return adm.GetResourceDetail(cluster, segments[2])
+	case segments[1] == "resources" && len(segments) == 4:
+		resource := segments[2]
+		switch segments[3] {
+		case "idealState":
+			return adm.zkClient.GetRecordFromPath(builder.idealStateForResource(resource))
+		case "externalView":
+			return adm.zkClient.GetRecordFromPath(builder.externalViewForResource(resource))
+		case "health":
+			return adm.GetResourceHealth(cluster, resource)
+		}
+	case segments[1] == "instances" && len(segments) == 2:
+		return adm.restInstances(cluster)
+	case segments[1] == "instances" && len(segments) == 3:
+		return adm.GetInstanceDetail(cluster, segments[2])
+	case segments[1] == "instances" && len(segments) == 4 && segments[3] == "configs":
+		return adm.zkClient.GetRecordFromPath(builder.participantConfig(segments[2]))
+	}
+	return nil, errRESTNotFound
+}
+
+// restInstances returns the instances of the cluster with the live and the disabled ones
+func (adm Admin) restInstances(cluster string) (interface{}, error) {
+	builder := &KeyBuilder{cluster}
+	instances, err := adm.sortedChildren(builder.instances())
+	if err != nil {
+		return nil, err
+	}
+	live, err := adm.zkClient.Children(builder.liveInstances())
+	if err != nil {
+		return nil, err
+	}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	configs, err := accessor.InstanceConfigs()
+	if err != nil {
+		return nil, err
+	}
+	liveSet := make(map[string]struct{}, len(live))
+	for _, instance := range live {
+		liveSet[instance] = struct{}{}
+	}
+	result := struct {
+		ID        string   `json:"id"`
+		Instances []string `json:"instances"`
+		Online    []string `json:"online"`
+		Disabled  []string `json:"disabled"`
+	}{ID: "instances", Instances: instances, Online: []string{}, Disabled: []string{}}
+	for _, instance := range instances {
+		if _, ok := liveSet[instance]; ok {
+			result.Online = append(result.Online, instance)
+		}
+		// an instance is enabled unless disabled, as in Java Helix
+		if config, ok := configs[instance]; ok && !config.GetBooleanField(model.FieldKeyHelixEnabled, true) {
+			result.Disabled = append(result.Disabled, instance)
+		}
+	}
+	return result, nil
+}
+
+func writeRESTJSON(w http.ResponseWriter, v interface{}, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err != nil {
+		v = map[string]string{"error": err.Error()}
+	}
+	_ = json.NewEncoder(w).Encode(v)
+}
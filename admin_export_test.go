@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix/model"
+)
+
+func TestRESTHandler(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1", "localhost_2")
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	require.NoError(t, admin.DisableInstance(TestClusterName, "localhost_2"))
+	require.NoError(t, admin.AddResource(TestClusterName, "db", 2, StateModelNameOnlineOffline))
+	keyBuilder := &KeyBuilder{TestClusterName}
+	accessor := newDataAccessor(client, keyBuilder)
+	require.NoError(t, accessor.createData(keyBuilder.liveInstance("localhost_1"),
+		model.NewLiveInstance("localhost_1", "s1").ZNRecord))
+	// db_0 is up, db_1 is not
+	view := model.NewExternalView("db")
+	view.SetState("db_0", "localhost_1", StateModelStateOnline)
+	view.SetState("db_1", "localhost_1", StateModelStateError)
+	require.NoError(t, accessor.createData(keyBuilder.externalViewForResource("db"), view.ZNRecord))
+	require.NoError(t, admin.FreezeCluster(TestClusterName, "upgrade"))
+
+	server := httptest.NewServer(admin.RESTHandler())
+	defer server.Close()
+	get := func(path string, result interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+		return resp.StatusCode
+	}
+
+	var clusters map[string][]string
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters", &clusters))
+	assert.Equal(t, []string{TestClusterName}, clusters["clusters"])
+
+	var summary ClusterSummary
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName, &summary))
+	assert.Equal(t, ClusterSummary{ID: TestClusterName, Instances: []string{"localhost_1", "localhost_2"},
+		LiveInstances: []string{"localhost_1"}, Resources: []string{"db"}, Paused: true}, summary)
+
+	var resources map[string]interface{}
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/resources", &resources))
+	assert.Equal(t, []interface{}{"db"}, resources["externalViews"])
+	var health map[string]string
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/resources/health", &health))
+	assert.Equal(t, map[string]string{"db": HealthUnhealthy}, health)
+	var partitionHealth map[string]string
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/resources/db/health", &partitionHealth))
+	assert.Equal(t, map[string]string{"db_0": HealthHealthy, "db_1": HealthUnhealthy}, partitionHealth)
+
+	var resource ResourceDetail
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/resources/db", &resource))
+	assert.Equal(t, "db", resource.IdealState.ID)
+	assert.Equal(t, StateModelStateOnline, resource.ExternalView.GetMapField("db_0", "localhost_1"))
+	assert.Nil(t, resource.ResourceConfig)
+	var record model.ZNRecord
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/resources/db/idealState", &record))
+	assert.Equal(t, "db", record.ID)
+
+	var instances struct {
+		Online   []string `json:"online"`
+		Disabled []string `json:"disabled"`
+	}
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/instances", &instances))
+	assert.Equal(t, []string{"localhost_1"}, instances.Online)
+	assert.Equal(t, []string{"localhost_2"}, instances.Disabled)
+	var instance InstanceDetail
+	assert.Equal(t, http.StatusOK, get("/admin/v2/clusters/"+TestClusterName+"/instances/localhost_1", &instance))
+	assert.Equal(t, "localhost_1", instance.Config.ID)
+	assert.Equal(t, "s1", instance.LiveInstance.GetStringField("SESSION_ID", ""))
+
+	var errResp map[string]string
+	assert.Equal(t, http.StatusNotFound, get("/admin/v2/clusters/other", &errResp))
+	assert.Equal(t, http.StatusNotFound, get("/admin/v2/clusters/"+TestClusterName+"/resources/other", &errResp))
+	assert.NotEmpty(t, errResp["error"])
+	resp, err := http.Post(server.URL+"/admin/v2/clusters", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+)
+
+// FreezeCluster freezes all the partitions of the cluster: the participants complete their
+// in-flight state transitions and hold the new ones until the cluster is unfrozen
+func (adm Admin) FreezeCluster(cluster string, reason string) error {
+	return adm.updatePauseSignal(cluster, reason, func(signal *model.PauseSignal) {
+		signal.SetClusterFreeze(true)
+	})
+}
+
+// UnfreezeCluster removes the pause signal of the cluster, unfreezing the cluster and all the
+// frozen partitions
+func (adm Admin) UnfreezeCluster(cluster string) error {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	err := adm.zkClient.Delete(builder.pause())
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// FreezePartitions freezes the partitions of the resource, their transitions are held
+func (adm Admin) FreezePartitions(cluster string, resource string, partitions []string, reason string) error {
+	return adm.updatePauseSignal(cluster, reason, func(signal *model.PauseSignal) {
+		signal.FreezePartitions(resource, partitions...)
+	})
+}
+
+// UnfreezePartitions unfreezes the partitions of the resource, the pause signal is removed
+// once it freezes nothing
+func (adm Admin) UnfreezePartitions(cluster string, resource string, partitions []string) error {
+	return adm.updatePauseSignal(cluster, "", func(signal *model.PauseSignal) {
+		signal.UnfreezePartitions(resource, partitions...)
+	})
+}
+
+// GetPauseSignal returns the pause signal of the cluster, nil if nothing is frozen
+func (adm Admin) GetPauseSignal(cluster string) (*model.PauseSignal, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	record, err := adm.zkClient.GetRecordFromPath(builder.pause())
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &model.PauseSignal{ZNRecord: *record}, nil
+}
+
+// updatePauseSignal updates the pause signal, created with the reason if missing,
+// and removes it if it freezes nothing anymore
+func (adm Admin) updatePauseSignal(cluster string, reason string, update func(signal *model.PauseSignal)) error {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	path := builder.pause()
+	empty := false
+	accessor := newDataAccessor(adm.zkClient, builder)
+	err := accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		signal := model.NewPauseSignal(reason)
+		if data != nil {
+			signal = &model.PauseSignal{ZNRecord: *data}
+			if reason != "" {
+				signal.SetSimpleField(model.FieldKeyReason, reason)
+			}
+		}
+		update(signal)
+		empty = signal.IsEmpty()
+		return &signal.ZNRecord, nil
+	})
+	if err != nil || !empty {
+		return err
+	}
+	err = adm.zkClient.Delete(path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
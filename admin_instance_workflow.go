@@ -0,0 +1,357 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+const (
+	// DefaultDrainTimeout is the time SwapInstance and EvacuateInstance wait for the drain
+	DefaultDrainTimeout = 10 * time.Minute
+	// DefaultDrainPollInterval is the interval the external views are read at while draining
+	DefaultDrainPollInterval = time.Second
+)
+
+// InstanceWorkflowStep is a step of SwapInstance or EvacuateInstance
+type InstanceWorkflowStep string
+
+// The steps of SwapInstance and EvacuateInstance, in order
+const (
+	// InstanceWorkflowStepDisable disables the instance, the controller moves its partitions
+	// to the initial state
+	InstanceWorkflowStepDisable InstanceWorkflowStep = "DISABLE"
+	// InstanceWorkflowStepDrain waits until the external views hold no replica of the instance
+	// outside the initial, DROPPED and ERROR states
+	InstanceWorkflowStepDrain InstanceWorkflowStep = "DRAIN"
+	// InstanceWorkflowStepUpdateConfigs adds the tags of the old instance to the new one
+	InstanceWorkflowStepUpdateConfigs InstanceWorkflowStep = "UPDATE_CONFIGS"
+	// InstanceWorkflowStepUpdateIdealStates replaces the old instance by the new one in the
+	// preference lists and the partition maps of the ideal states
+	InstanceWorkflowStepUpdateIdealStates InstanceWorkflowStep = "UPDATE_IDEAL_STATES"
+	// InstanceWorkflowStepEnable enables the new instance
+	InstanceWorkflowStepEnable InstanceWorkflowStep = "ENABLE"
+)
+
+// InstanceWorkflowProgress is the progress of SwapInstance or EvacuateInstance
+type InstanceWorkflowProgress struct {
+	Step     InstanceWorkflowStep
+	Instance string
+	// Done is set once the step is completed, the drain is otherwise reported at each poll
+	Done bool
+	// Skipped is set if the step was already completed, e.g. by an interrupted run
+	Skipped bool
+	// Remaining is the number of replicas of the instance left to drain
+	Remaining int
+}
+
+// InstanceWorkflowOption configures SwapInstance and EvacuateInstance
+type InstanceWorkflowOption func(*instanceWorkflow)
+
+type instanceWorkflow struct {
+	adm               Admin
+	cluster           string
+	progress          func(InstanceWorkflowProgress)
+	drainTimeout      time.Duration
+	drainPollInterval time.Duration
+}
+
+// WithWorkflowProgress calls fn with the progress of the workflow
+func WithWorkflowProgress(fn func(InstanceWorkflowProgress)) InstanceWorkflowOption {
+	return func(w *instanceWorkflow) {
+		w.progress = fn
+	}
+}
+
+// WithDrainTimeout sets the time the workflow waits for the instance to drain,
+// DefaultDrainTimeout by default
+func WithDrainTimeout(timeout time.Duration) InstanceWorkflowOption {
+	return func(w *instanceWorkflow) {
+		w.drainTimeout = timeout
+	}
+}
+
+// WithDrainPollInterval sets the interval the external views are read at while draining,
+// DefaultDrainPollInterval by default
+func WithDrainPollInterval(interval time.Duration) InstanceWorkflowOption {
+	return func(w *instanceWorkflow) {
+		w.drainPollInterval = interval
+	}
+}
+
+// SwapInstance replaces the old instance by the new one: it disables the old instance, waits
+// until its partitions are drained, adds its tags to the new instance, replaces it by the new one
+// in the ideal states and enables the new instance. The steps already completed are skipped, so
+// an interrupted or timed out swap is resumed by calling it again. The old instance is left
+// disabled, to be dropped once it is stopped. Both instances must be added to the cluster
+func (adm Admin) SwapInstance(cluster string, oldInstance string, newInstance string,
+	options ...InstanceWorkflowOption) error {
+	w, err := adm.newInstanceWorkflow(cluster, options)
+	if err != nil {
+		return err
+	}
+	oldConfig, err := adm.GetInstanceConfig(cluster, oldInstance)
+	if err != nil {
+		return errors.Wrapf(err, "failed to swap instance %s", oldInstance)
+	}
+	if _, err := adm.GetInstanceConfig(cluster, newInstance); err != nil {
+		return errors.Wrapf(err, "failed to swap instance %s with %s", oldInstance, newInstance)
+	}
+	if err := w.disable(oldConfig); err != nil {
+		return err
+	}
+	if err := w.drain(oldInstance); err != nil {
+		return err
+	}
+	if err := w.copyTags(oldConfig, newInstance); err != nil {
+		return err
+	}
+	if err := w.replaceInIdealStates(oldInstance, newInstance); err != nil {
+		return err
+	}
+	return w.enable(newInstance)
+}
+
+// EvacuateInstance disables the instance and waits until its partitions are drained, so it can
+// be stopped without losing availability once the controller placed the replicas elsewhere.
+// The instance is left disabled, to be dropped or enabled again. Calling it again resumes an
+// interrupted or timed out evacuation
+func (adm Admin) EvacuateInstance(cluster string, instance string, options ...InstanceWorkflowOption) error {
+	w, err := adm.newInstanceWorkflow(cluster, options)
+	if err != nil {
+		return err
+	}
+	config, err := adm.GetInstanceConfig(cluster, instance)
+	if err != nil {
+		return errors.Wrapf(err, "failed to evacuate instance %s", instance)
+	}
+	if err := w.disable(config); err != nil {
+		return err
+	}
+	return w.drain(instance)
+}
+
+func (adm Admin) newInstanceWorkflow(cluster string, options []InstanceWorkflowOption) (*instanceWorkflow, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	w := &instanceWorkflow{
+		adm:               adm,
+		cluster:           cluster,
+		progress:          func(InstanceWorkflowProgress) {},
+		drainTimeout:      DefaultDrainTimeout,
+		drainPollInterval: DefaultDrainPollInterval,
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w, nil
+}
+
+func (w *instanceWorkflow) done(step InstanceWorkflowStep, instance string, skipped bool) {
+	w.progress(InstanceWorkflowProgress{Step: step, Instance: instance, Done: true, Skipped: skipped})
+}
+
+func (w *instanceWorkflow) disable(config *model.InstanceConfig) error {
+	instance := config.ID
+	if !config.GetEnabled() {
+		w.done(InstanceWorkflowStepDisable, instance, true)
+		return nil
+	}
+	if err := w.adm.DisableInstance(w.cluster, instance); err != nil {
+		return errors.Wrapf(err, "failed to disable instance %s", instance)
+	}
+	w.done(InstanceWorkflowStepDisable, instance, false)
+	return nil
+}
+
+func (w *instanceWorkflow) drain(instance string) error {
+	deadline := time.Now().Add(w.drainTimeout)
+	for polls := 0; ; polls++ {
+		remaining, err := w.remainingReplicas(instance)
+		if err != nil {
+			return errors.Wrapf(err, "failed to drain instance %s", instance)
+		}
+		if remaining == 0 {
+			w.done(InstanceWorkflowStepDrain, instance, polls == 0)
+			return nil
+		}
+		w.progress(InstanceWorkflowProgress{Step: InstanceWorkflowStepDrain, Instance: instance, Remaining: remaining})
+		if time.Now().After(deadline) {
+			return errors.Errorf("instance %s not drained in %v, %d replicas left", instance, w.drainTimeout, remaining)
+		}
+		time.Sleep(w.drainPollInterval)
+	}
+}
+
+// remainingReplicas returns the number of replicas of the instance in the external views
+// outside the initial state of their state model, DROPPED and ERROR
+func (w *instanceWorkflow) remainingReplicas(instance string) (int, error) {
+	accessor := newDataAccessor(w.adm.zkClient, &KeyBuilder{w.cluster})
+	views, err := accessor.ExternalViews()
+	if err != nil {
+		return 0, err
+	}
+	idealStates, err := accessor.IdealStates()
+	if err != nil {
+		return 0, err
+	}
+	stateModelDefs, err := accessor.StateModelDefs()
+	if err != nil {
+		return 0, err
+	}
+	remaining := 0
+	for resource, view := range views {
+		initialState := StateModelStateOffline
+		if idealState, ok := idealStates[resource]; ok {
+			if stateModelDef, ok := stateModelDefs[idealState.GetStateModelDefRef()]; ok {
+				initialState = stateModelDef.GetInitialState()
+			}
+		}
+		for _, partition := range view.GetPartitionSet() {
+			state, ok := view.GetStateMap(partition)[instance]
+			if ok && state != initialState && state != StateModelStateDropped && state != StateModelStateError {
+				remaining++
+			}
+		}
+	}
+	return remaining, nil
+}
+
+func (w *instanceWorkflow) copyTags(oldConfig *model.InstanceConfig, newInstance string) error {
+	newConfig, err := w.adm.GetInstanceConfig(w.cluster, newInstance)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update the config of instance %s", newInstance)
+	}
+	var missing []string
+	for _, tag := range oldConfig.GetTags() {
+		if !newConfig.ContainsTag(tag) {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		w.done(InstanceWorkflowStepUpdateConfigs, newInstance, true)
+		return nil
+	}
+	err = w.adm.updateInstanceConfig(w.cluster, newInstance, func(config *model.InstanceConfig) {
+		for _, tag := range missing {
+			config.AddTag(tag)
+		}
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update the config of instance %s", newInstance)
+	}
+	w.done(InstanceWorkflowStepUpdateConfigs, newInstance, false)
+	return nil
+}
+
+func (w *instanceWorkflow) replaceInIdealStates(oldInstance string, newInstance string) error {
+	builder := &KeyBuilder{w.cluster}
+	accessor := newDataAccessor(w.adm.zkClient, builder)
+	idealStates, err := accessor.IdealStates()
+	if err != nil {
+		return errors.Wrap(err, "failed to update the ideal states")
+	}
+	updated := false
+	for resource, idealState := range idealStates {
+		if !replaceInstance(&idealState.ZNRecord, oldInstance, newInstance) {
+			continue
+		}
+		err := accessor.updateData(builder.idealStateForResource(resource),
+			func(data *model.ZNRecord) (*model.ZNRecord, error) {
+				if data == nil {
+					return nil, ErrNodeNotExist
+				}
+				replaceInstance(data, oldInstance, newInstance)
+				return data, nil
+			})
+		if err != nil && err != ErrNodeNotExist {
+			return errors.Wrapf(err, "failed to update the ideal state of %s", resource)
+		}
+		updated = true
+	}
+	w.done(InstanceWorkflowStepUpdateIdealStates, newInstance, !updated)
+	return nil
+}
+
+// replaceInstance replaces the old instance by the new one in the preference lists and the
+// partition maps of the ideal state, it returns whether the record changed
+func replaceInstance(record *model.ZNRecord, oldInstance string, newInstance string) bool {
+	changed := false
+	for partition, instances := range record.ListFields {
+		replaced := make([]string, 0, len(instances))
+		found := false
+		for _, instance := range instances {
+			if instance == oldInstance {
+				found = true
+				instance = newInstance
+			}
+			// the new instance is kept once if it was already listed
+			if instance != newInstance || !containsString(replaced, newInstance) {
+				replaced = append(replaced, instance)
+			}
+		}
+		if found {
+			record.ListFields[partition] = replaced
+			changed = true
+		}
+	}
+	for _, states := range record.MapFields {
+		state, ok := states[oldInstance]
+		if !ok {
+			continue
+		}
+		delete(states, oldInstance)
+		if _, ok := states[newInstance]; !ok {
+			states[newInstance] = state
+		}
+		changed = true
+	}
+	return changed
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *instanceWorkflow) enable(instance string) error {
+	config, err := w.adm.GetInstanceConfig(w.cluster, instance)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enable instance %s", instance)
+	}
+	if config.GetEnabled() {
+		w.done(InstanceWorkflowStepEnable, instance, true)
+		return nil
+	}
+	if err := w.adm.EnableInstance(w.cluster, instance); err != nil {
+		return errors.Wrapf(err, "failed to enable instance %s", instance)
+	}
+	w.done(InstanceWorkflowStepEnable, instance, false)
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func TestSwapInstance(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1", "localhost_2", "localhost_3")
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	// the new instance is enabled by the swap
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_1"))
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_2"))
+	assert.NoError(t, admin.AddInstanceTag(TestClusterName, "localhost_1", "tenant_a"))
+	keyBuilder := &KeyBuilder{TestClusterName}
+	accessor := newDataAccessor(client, keyBuilder)
+	assert.NoError(t, admin.AddResource(TestClusterName, "r1", 2, StateModelNameOnlineOffline))
+	idealState, err := accessor.IdealState("r1")
+	assert.NoError(t, err)
+	idealState.SetPreferenceList("r1_0", []string{"localhost_1", "localhost_2"})
+	idealState.SetPreferenceList("r1_1", []string{"localhost_2", "localhost_3"})
+	idealState.SetMapField("r1_0", "localhost_1", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r1"), &idealState.ZNRecord))
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "localhost_1", StateModelStateOnline)
+	view.SetState("r1_0", "localhost_2", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+
+	// the swap waits until the old instance is drained
+	progress := make(chan InstanceWorkflowProgress, 100)
+	options := []InstanceWorkflowOption{
+		WithWorkflowProgress(func(p InstanceWorkflowProgress) { progress <- p }),
+		WithDrainPollInterval(10 * time.Millisecond),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- admin.SwapInstance(TestClusterName, "localhost_1", "localhost_3", options...)
+	}()
+	assert.Equal(t, InstanceWorkflowProgress{Step: InstanceWorkflowStepDisable, Instance: "localhost_1", Done: true},
+		<-progress)
+	assert.Equal(t, InstanceWorkflowProgress{Step: InstanceWorkflowStepDrain, Instance: "localhost_1", Remaining: 1},
+		<-progress)
+	view.SetState("r1_0", "localhost_1", StateModelStateOffline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	assert.NoError(t, <-errCh)
+	close(progress)
+	var steps []InstanceWorkflowProgress
+	for p := range progress {
+		if p.Done {
+			steps = append(steps, p)
+		}
+	}
+	assert.Equal(t, []InstanceWorkflowProgress{
+		{Step: InstanceWorkflowStepDrain, Instance: "localhost_1", Done: true},
+		{Step: InstanceWorkflowStepUpdateConfigs, Instance: "localhost_3", Done: true},
+		{Step: InstanceWorkflowStepUpdateIdealStates, Instance: "localhost_3", Done: true},
+		{Step: InstanceWorkflowStepEnable, Instance: "localhost_3", Done: true},
+	}, steps)
+
+	idealState, err = accessor.IdealState("r1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost_3", "localhost_2"}, idealState.GetPreferenceList("r1_0"))
+	assert.Equal(t, []string{"localhost_2", "localhost_3"}, idealState.GetPreferenceList("r1_1"))
+	assert.Equal(t, map[string]string{"localhost_3": StateModelStateOnline}, idealState.MapFields["r1_0"])
+	oldConfig, err := admin.GetInstanceConfig(TestClusterName, "localhost_1")
+	assert.NoError(t, err)
+	assert.False(t, oldConfig.GetEnabled())
+	newConfig, err := admin.GetInstanceConfig(TestClusterName, "localhost_3")
+	assert.NoError(t, err)
+	assert.True(t, newConfig.GetEnabled())
+	assert.True(t, newConfig.ContainsTag("tenant_a"))
+
+	// the completed steps are skipped when the swap is resumed
+	var skipped []InstanceWorkflowStep
+	assert.NoError(t, admin.SwapInstance(TestClusterName, "localhost_1", "localhost_3",
+		WithWorkflowProgress(func(p InstanceWorkflowProgress) {
+			if p.Skipped {
+				skipped = append(skipped, p.Step)
+			}
+		})))
+	assert.Equal(t, []InstanceWorkflowStep{InstanceWorkflowStepDisable, InstanceWorkflowStepDrain,
+		InstanceWorkflowStepUpdateConfigs, InstanceWorkflowStepUpdateIdealStates, InstanceWorkflowStepEnable}, skipped)
+
+	assert.Equal(t, ErrNodeNotExist, errors.Cause(admin.SwapInstance(TestClusterName, "localhost_1", "localhost_4")))
+}
+
+func TestEvacuateInstance(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_1"))
+	keyBuilder := &KeyBuilder{TestClusterName}
+	accessor := newDataAccessor(client, keyBuilder)
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "localhost_1", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+
+	// the evacuation times out while the instance holds replicas
+	err := admin.EvacuateInstance(TestClusterName, "localhost_1",
+		WithDrainTimeout(50*time.Millisecond), WithDrainPollInterval(10*time.Millisecond))
+	assert.Error(t, err)
+	config, err := admin.GetInstanceConfig(TestClusterName, "localhost_1")
+	assert.NoError(t, err)
+	assert.False(t, config.GetEnabled())
+
+	view.SetState("r1_0", "localhost_1", StateModelStateDropped)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	assert.NoError(t, admin.EvacuateInstance(TestClusterName, "localhost_1"))
+}
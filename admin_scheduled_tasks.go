@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+// ScheduleTask schedules the task message on the instance, e.g. a periodic maintenance task sent by
+// a cron job. The controller sends the task with the transition of the partition named after the task
+// ID in the SchedulerTaskQueue resource, and the participant executes it with the message handler
+// of its type. The partition is COMPLETED once the task succeeded, or in ERROR state if it failed,
+// and the participant replies to the sender of a task with a correlation ID.
+// Mirrors org.apache.helix.messaging.DefaultSchedulerMessageHandlerFactory
+func (adm Admin) ScheduleTask(cluster string, instance string, task *model.Message) error {
+	if task.ID == "" || task.GetMsgType() == "" {
+		return errors.New("the scheduled task has no ID or no type")
+	}
+	return adm.updateSchedulerTaskQueue(cluster, func(idealState *model.IdealState) {
+		idealState.SetPreferenceList(task.ID, []string{instance})
+		fields := make(map[string]string, len(task.SimpleFields))
+		for key, value := range task.SimpleFields {
+			fields[key] = value
+		}
+		idealState.MapFields[task.ID] = fields
+	})
+}
+
+// RemoveScheduledTask removes the task from the SchedulerTaskQueue resource, its partition is dropped
+func (adm Admin) RemoveScheduledTask(cluster string, taskID string) error {
+	return adm.updateSchedulerTaskQueue(cluster, func(idealState *model.IdealState) {
+		delete(idealState.ListFields, taskID)
+		delete(idealState.MapFields, taskID)
+	})
+}
+
+// updateSchedulerTaskQueue updates the ideal state of the SchedulerTaskQueue resource,
+// created on the first task
+func (adm Admin) updateSchedulerTaskQueue(cluster string, update func(idealState *model.IdealState)) error {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	return accessor.updateData(builder.idealStateForResource(StateModelNameSchedulerTaskQueue),
+		func(data *model.ZNRecord) (*model.ZNRecord, error) {
+			idealState := model.NewIdealState(StateModelNameSchedulerTaskQueue)
+			if data != nil {
+				idealState = &model.IdealState{ZNRecord: *data}
+			}
+			idealState.SetRebalanceMode(model.RebalanceModeSemiAuto)
+			idealState.SetStateModelDefRef(StateModelNameSchedulerTaskQueue)
+			idealState.SetReplicas(1)
+			update(idealState)
+			idealState.SetNumPartitions(len(idealState.ListFields))
+			return &idealState.ZNRecord, nil
+		})
+}
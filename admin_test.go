@@ -411,3 +411,270 @@ func (s *AdminTestSuite) verifyChildrenCount(path string, count int) {
 			"but only have %d children", path, count, len(children))
 	}
 }
+
+func (s *AdminTestSuite) TestResetPartitionOfNonLiveInstance() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestResetPartition_" + now.Format("20060102150405")
+	node := "localhost_19932"
+
+	err := s.Admin.ResetPartition(cluster, node, "resource", []string{"partition"})
+	s.Equal(ErrClusterNotSetup, err)
+
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+	s.NoError(s.Admin.AddNode(cluster, node))
+
+	err = s.Admin.ResetPartition(cluster, node, "resource", []string{"partition"})
+	s.Equal(ErrInstanceNotLive, err)
+}
+
+func (s *AdminTestSuite) TestInstanceTags() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestInstanceTags_" + now.Format("20060102150405")
+	node1, node2 := "localhost_19932", "localhost_19933"
+
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+	s.NoError(s.Admin.AddNode(cluster, node1))
+	s.NoError(s.Admin.AddNode(cluster, node2))
+
+	s.Equal(ErrNodeNotExist, s.Admin.AddInstanceTag(cluster, "localhost_1", "tag"))
+	s.NoError(s.Admin.AddInstanceTag(cluster, node1, "tag"))
+	instances, err := s.Admin.GetInstancesWithTag(cluster, "tag")
+	s.NoError(err)
+	s.Equal([]string{node1}, instances)
+
+	s.NoError(s.Admin.RemoveInstanceTag(cluster, node1, "tag"))
+	instances, err = s.Admin.GetInstancesWithTag(cluster, "tag")
+	s.NoError(err)
+	s.Len(instances, 0)
+
+	resource := "resource"
+	s.NoError(s.Admin.AddResourceWithTag(cluster, resource, 3, StateModelNameOnlineOffline, "tag"))
+	idealState, err := s.Admin.ListIdealState(cluster, resource)
+	s.NoError(err)
+	s.Equal("tag", idealState.GetInstanceGroupTag())
+}
+
+func (s *AdminTestSuite) TestRebalanceResource() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestRebalanceResource_" + now.Format("20060102150405")
+	nodes := []string{"localhost_19932", "localhost_19933", "localhost_19934"}
+
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+	for _, node := range nodes {
+		s.NoError(s.Admin.AddNode(cluster, node))
+	}
+	s.Equal(ErrResourceNotExists, s.Admin.RebalanceResource(cluster, "resource", 2, RebalanceConstraints{}))
+
+	resource := "resource"
+	s.NoError(s.Admin.AddResource(cluster, resource, 4, StateModelNameOnlineOffline))
+	s.NoError(s.Admin.RebalanceResource(cluster, resource, 5, RebalanceConstraints{}))
+	idealState, err := s.Admin.ListIdealState(cluster, resource)
+	s.NoError(err)
+	s.Equal(3, idealState.GetReplicas())
+	s.Len(idealState.ListFields, 4)
+	for _, partition := range idealState.GetPartitionSet() {
+		s.ElementsMatch(nodes, idealState.GetPreferenceList(partition))
+	}
+
+	s.NoError(s.Admin.AddInstanceTag(cluster, nodes[0], "tag"))
+	s.NoError(s.Admin.RebalanceResource(cluster, resource, 2,
+		RebalanceConstraints{Strategy: RackAwareStrategy{}, InstanceTag: "tag"}))
+	idealState, err = s.Admin.ListIdealState(cluster, resource)
+	s.NoError(err)
+	s.Equal(1, idealState.GetReplicas())
+	s.Equal([]string{nodes[0]}, idealState.GetPreferenceList(resource+"_0"))
+	s.Equal(ErrNoInstancesToPlace, s.Admin.RebalanceResource(cluster, resource, 2,
+		RebalanceConstraints{InstanceTag: "unknown"}))
+}
+
+func (s *AdminTestSuite) TestDelayedRebalanceConfig() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestDelayedRebalanceConfig_" + now.Format("20060102150405")
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+
+	s.NoError(s.Admin.UpdateClusterConfig(cluster, func(config *model.ClusterConfig) {
+		config.SetRebalanceDelayTime(time.Minute)
+	}))
+	clusterConfig, err := s.Admin.GetClusterConfig(cluster)
+	s.NoError(err)
+	delay, ok := clusterConfig.GetRebalanceDelayTime()
+	s.True(ok)
+	s.Equal(time.Minute, delay)
+	s.Error(s.Admin.UpdateClusterConfig(cluster, func(config *model.ClusterConfig) {
+		config.SetRebalanceDelayTime(-time.Minute)
+	}))
+
+	resource := "resource"
+	s.Equal(ErrResourceNotExists, s.Admin.UpdateResourceConfig(cluster, resource, func(*model.ResourceConfig) {}))
+	s.NoError(s.Admin.AddResource(cluster, resource, 4, StateModelNameOnlineOffline))
+	resourceConfig, err := s.Admin.GetResourceConfig(cluster, resource)
+	s.NoError(err)
+	s.Equal(-1, resourceConfig.GetMinActiveReplicas())
+	s.NoError(s.Admin.UpdateResourceConfig(cluster, resource, func(config *model.ResourceConfig) {
+		config.SetMinActiveReplicas(1)
+		config.SetRebalanceDelay(time.Second)
+	}))
+	resourceConfig, err = s.Admin.GetResourceConfig(cluster, resource)
+	s.NoError(err)
+	s.Equal(1, resourceConfig.GetMinActiveReplicas())
+	s.Equal(time.Second, resourceConfig.GetEffectiveRebalanceDelay(clusterConfig))
+}
+
+func (s *AdminTestSuite) TestWagedRebalanceConfig() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestWagedRebalanceConfig_" + now.Format("20060102150405")
+	node := "localhost_19933"
+	resource := "resource"
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+
+	s.NoError(s.Admin.UpdateClusterConfig(cluster, func(config *model.ClusterConfig) {
+		config.SetInstanceCapacityKeys([]string{"CPU"})
+		config.SetDefaultPartitionWeightMap(map[string]int{"CPU": 1})
+	}))
+	s.Equal(ErrNodeNotExist, s.Admin.SetInstanceCapacityMap(cluster, node, map[string]int{"CPU": 10}))
+	s.NoError(s.Admin.AddNode(cluster, node))
+	s.Error(s.Admin.SetInstanceCapacityMap(cluster, node, map[string]int{"CPU": -1}))
+	s.NoError(s.Admin.SetInstanceCapacityMap(cluster, node, map[string]int{"CPU": 10}))
+	instanceConfig, err := s.Admin.GetInstanceConfig(cluster, node)
+	s.NoError(err)
+	clusterConfig, err := s.Admin.GetClusterConfig(cluster)
+	s.NoError(err)
+	capacity, err := clusterConfig.GetInstanceCapacity(instanceConfig)
+	s.NoError(err)
+	s.Equal(map[string]int{"CPU": 10}, capacity)
+
+	s.Equal(ErrResourceNotExists, s.Admin.EnableWagedRebalance(cluster, []string{resource}))
+	s.NoError(s.Admin.AddResource(cluster, resource, 4, StateModelNameOnlineOffline))
+	s.NoError(s.Admin.UpdateResourceConfig(cluster, resource, func(config *model.ResourceConfig) {
+		config.SetPartitionCapacityMap(map[string]map[string]int{model.DefaultPartitionCapacityKey: {"CPU": 2}})
+	}))
+	s.NoError(s.Admin.EnableWagedRebalance(cluster, []string{resource}))
+	idealState, err := s.Admin.ListIdealState(cluster, resource)
+	s.NoError(err)
+	s.Equal(model.RebalanceModeFullAuto, idealState.GetRebalanceMode())
+	s.Equal(model.WagedRebalancerClassName, idealState.GetRebalancerClassName())
+	resourceConfig, err := s.Admin.GetResourceConfig(cluster, resource)
+	s.NoError(err)
+	weight, err := resourceConfig.GetPartitionCapacity("resource_0", clusterConfig)
+	s.NoError(err)
+	s.Equal(map[string]int{"CPU": 2}, weight)
+}
+
+func (s *AdminTestSuite) TestEnableDisableInstanceAndPartition() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestEnableDisableInstance_" + now.Format("20060102150405")
+	node := "localhost_19932"
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+	s.NoError(s.Admin.AddNode(cluster, node))
+
+	s.Equal(ErrNodeNotExist, s.Admin.EnableInstance(cluster, "localhost_1"))
+	s.NoError(s.Admin.EnableInstance(cluster, node))
+	config, err := s.Admin.GetInstanceConfig(cluster, node)
+	s.NoError(err)
+	s.True(config.GetEnabled())
+	s.False(config.GetEnabledTime().IsZero())
+	s.NoError(s.Admin.DisableInstance(cluster, node))
+	config, err = s.Admin.GetInstanceConfig(cluster, node)
+	s.NoError(err)
+	s.False(config.GetEnabled())
+
+	s.NoError(s.Admin.DisablePartition(cluster, node, "resource", "resource_1"))
+	s.NoError(s.Admin.DisablePartition(cluster, node, "resource", "resource_0"))
+	config, err = s.Admin.GetInstanceConfig(cluster, node)
+	s.NoError(err)
+	s.Equal([]string{"resource_0", "resource_1"}, config.GetDisabledPartitions("resource"))
+	s.NoError(s.Admin.EnablePartition(cluster, node, "resource", "resource_0"))
+	config, err = s.Admin.GetInstanceConfig(cluster, node)
+	s.NoError(err)
+	s.False(config.IsPartitionEnabled("resource", "resource_1"))
+	s.True(config.IsPartitionEnabled("resource", "resource_0"))
+}
+
+func (s *AdminTestSuite) TestResourceConfigs() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestResourceConfigs_" + now.Format("20060102150405")
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+
+	resource := "resource"
+	s.NoError(s.Admin.AddResource(cluster, resource, 4, StateModelNameOnlineOffline))
+	s.NoError(s.Admin.UpdateResourceConfig(cluster, resource, func(config *model.ResourceConfig) {
+		config.SetBatchMessageMode(true)
+	}))
+	s.Error(s.Admin.UpdateResourceConfig(cluster, resource, func(config *model.ResourceConfig) {
+		config.SetReplicas("three")
+	}))
+	configs, err := s.Admin.ListResourceConfigs(cluster)
+	s.NoError(err)
+	s.Len(configs, 1)
+	s.True(configs[resource].GetBatchMessageMode())
+
+	s.NoError(s.Admin.DeleteResourceConfig(cluster, resource))
+	s.NoError(s.Admin.DeleteResourceConfig(cluster, resource))
+	configs, err = s.Admin.ListResourceConfigs(cluster)
+	s.NoError(err)
+	s.Empty(configs)
+}
+
+func (s *AdminTestSuite) TestTopology() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestTopology_" + now.Format("20060102150405")
+	nodes := []string{"localhost_19932", "localhost_19933", "localhost_19934", "localhost_19935"}
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+	for i, node := range nodes {
+		s.NoError(s.Admin.AddNode(cluster, node))
+		s.NoError(s.Admin.SetInstanceDomain(cluster, node, fmt.Sprintf("zone=z%d,instance=%s", i%2, node)))
+	}
+	s.Error(s.Admin.SetInstanceDomain(cluster, nodes[0], "zone"))
+	s.NoError(s.Admin.UpdateClusterConfig(cluster, func(config *model.ClusterConfig) {
+		config.SetTopology("/zone/instance")
+		config.SetFaultZoneType("zone")
+		config.SetTopologyAwareEnabled(true)
+	}))
+	topology, err := s.Admin.GetTopology(cluster)
+	s.NoError(err)
+	s.Equal([]string{"z0", "z1"}, topology.Zones())
+
+	resource := "resource"
+	s.NoError(s.Admin.AddResource(cluster, resource, 8, StateModelNameOnlineOffline))
+	s.NoError(s.Admin.RebalanceResource(cluster, resource, 2, RebalanceConstraints{}))
+	idealState, err := s.Admin.ListIdealState(cluster, resource)
+	s.NoError(err)
+	for _, partition := range idealState.GetPartitionSet() {
+		s.Len(topology.GroupByZone(idealState.GetPreferenceList(partition)), 2)
+	}
+}
+
+func (s *AdminTestSuite) TestConstraints() {
+	now := time.Now().Local()
+	cluster := "AdminTest_TestConstraints_" + now.Format("20060102150405")
+	s.Admin.AddCluster(cluster, false)
+	defer s.Admin.DropCluster(cluster)
+
+	constraints, err := s.Admin.GetConstraints(cluster, model.ConstraintTypeMessage)
+	s.NoError(err)
+	s.Empty(constraints.GetConstraintItems())
+	item := model.ConstraintItem{
+		Attributes: map[string]string{model.ConstraintAttributeInstance: ".*"},
+		Value:      "1",
+	}
+	s.Error(s.Admin.SetConstraint(cluster, "UNKNOWN_CONSTRAINT", "perInstance", item))
+	s.Error(s.Admin.SetConstraint(cluster, model.ConstraintTypeMessage, "perInstance", model.ConstraintItem{}))
+	s.NoError(s.Admin.SetConstraint(cluster, model.ConstraintTypeMessage, "perInstance", item))
+	constraints, err = s.Admin.GetConstraints(cluster, model.ConstraintTypeMessage)
+	s.NoError(err)
+	s.Equal(map[string]model.ConstraintItem{"perInstance": item}, constraints.GetConstraintItems())
+
+	s.NoError(s.Admin.RemoveConstraint(cluster, model.ConstraintTypeMessage, "perInstance"))
+	s.NoError(s.Admin.RemoveConstraint(cluster, model.ConstraintTypeMessage, "perInstance"))
+	constraints, err = s.Admin.GetConstraints(cluster, model.ConstraintTypeMessage)
+	s.NoError(err)
+	s.Empty(constraints.GetConstraintItems())
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// _runtimeInstanceNodes are the nodes of an instance holding the state of its sessions
+var _runtimeInstanceNodes = util.NewStringSet(
+	"MESSAGES", "CURRENTSTATES", "CUSTOMIZEDSTATES", "STATUSUPDATES", "ERRORS", "HEALTHREPORT")
+
+// ClusterSnapshot is the metadata tree of a cluster exported by Admin.SnapshotCluster,
+// it is written to a portable archive by Write and restored by Admin.RestoreCluster
+type ClusterSnapshot struct {
+	Cluster   string    `json:"cluster"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Nodes are the znodes of the cluster, parents first
+	Nodes []SnapshotNode `json:"nodes"`
+}
+
+// SnapshotNode is a znode of a ClusterSnapshot
+type SnapshotNode struct {
+	// Path is relative to the cluster root, the root is ""
+	Path string `json:"path"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// Write writes the snapshot as gzipped JSON
+func (s *ClusterSnapshot) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return errors.Wrap(err, "failed to write cluster snapshot")
+	}
+	return errors.Wrap(gz.Close(), "failed to write cluster snapshot")
+}
+
+// ReadClusterSnapshot reads a snapshot written by ClusterSnapshot.Write
+func ReadClusterSnapshot(r io.Reader) (*ClusterSnapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cluster snapshot")
+	}
+	defer gz.Close()
+	snapshot := &ClusterSnapshot{}
+	if err := json.NewDecoder(gz).Decode(snapshot); err != nil {
+		return nil, errors.Wrap(err, "failed to read cluster snapshot")
+	}
+	return snapshot, nil
+}
+
+// SnapshotOption configures Admin.SnapshotCluster
+type SnapshotOption func(*snapshotOptions)
+
+type snapshotOptions struct {
+	runtimeState bool
+}
+
+// WithSnapshotRuntimeState also exports the messages, current states, status updates, errors,
+// health reports, external views and controller history. The ephemeral nodes, e.g. the
+// live instances, are never exported
+func WithSnapshotRuntimeState() SnapshotOption {
+	return func(o *snapshotOptions) {
+		o.runtimeState = true
+	}
+}
+
+// SnapshotCluster exports the metadata tree of the cluster: the configs, ideal states, state
+// model definitions, instances and property store. The tree is read node by node, so the
+// snapshot is only consistent if the cluster is not changed meanwhile
+func (adm Admin) SnapshotCluster(cluster string, options ...SnapshotOption) (*ClusterSnapshot, error) {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return nil, ErrClusterNotSetup
+	}
+	o := &snapshotOptions{}
+	for _, option := range options {
+		option(o)
+	}
+	snapshot := &ClusterSnapshot{Cluster: cluster, CreatedAt: time.Now()}
+	root := (&KeyBuilder{cluster}).cluster()
+	if err := adm.snapshotNode(snapshot, root, "", o); err != nil {
+		return nil, errors.Wrapf(err, "failed to snapshot cluster %s", cluster)
+	}
+	return snapshot, nil
+}
+
+func (adm Admin) snapshotNode(snapshot *ClusterSnapshot, root string, relPath string, o *snapshotOptions) error {
+	p := path.Join(root, relPath)
+	data, stat, err := adm.zkClient.Get(p)
+	if err != nil {
+		return err
+	}
+	if stat.EphemeralOwner != 0 {
+		return nil
+	}
+	if len(data) == 0 {
+		data = nil
+	}
+	snapshot.Nodes = append(snapshot.Nodes, SnapshotNode{Path: relPath, Data: data})
+	if !o.runtimeState && isRuntimeStatePath(relPath) {
+		return nil
+	}
+	children, err := adm.zkClient.Children(p)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := adm.snapshotNode(snapshot, root, path.Join(relPath, child), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRuntimeStatePath returns if the children of the node relative to the cluster root
+// hold the runtime state of the cluster instead of its metadata
+func isRuntimeStatePath(relPath string) bool {
+	segments := strings.Split(relPath, "/")
+	switch segments[0] {
+	case "EXTERNALVIEW", "TARGETEXTERNALVIEW", "CUSTOMIZEDVIEW", "LIVEINSTANCES":
+		return len(segments) == 1
+	case "CONTROLLER":
+		return len(segments) == 2
+	case "INSTANCES":
+		return len(segments) == 3 && _runtimeInstanceNodes.Contains(segments[2])
+	}
+	return false
+}
+
+// RestoreOption configures Admin.RestoreCluster
+type RestoreOption func(*restoreOptions)
+
+type restoreOptions struct {
+	cluster   string
+	instances map[string]string
+	overwrite bool
+}
+
+// WithRestoreClusterName restores the snapshot as the named cluster, e.g. to clone a cluster
+func WithRestoreClusterName(cluster string) RestoreOption {
+	return func(o *restoreOptions) {
+		o.cluster = cluster
+	}
+}
+
+// WithRestoreInstanceMapping renames the instances by the mapping of the old names to the new
+// ones, in the paths and in the IDs, keys and values of the records, e.g. in the preference lists.
+// The host and port of a renamed instance in the host_port form are set from its new name
+func WithRestoreInstanceMapping(instances map[string]string) RestoreOption {
+	return func(o *restoreOptions) {
+		o.instances = instances
+	}
+}
+
+// WithRestoreOverwrite drops the cluster before restoring it if it exists
+func WithRestoreOverwrite() RestoreOption {
+	return func(o *restoreOptions) {
+		o.overwrite = true
+	}
+}
+
+// RestoreCluster creates the cluster from the snapshot, it returns ErrClusterExists if the
+// cluster exists unless WithRestoreOverwrite is set. The live instances are not restored,
+// the participants join the restored cluster when they connect to the ensemble
+func (adm Admin) RestoreCluster(snapshot *ClusterSnapshot, options ...RestoreOption) error {
+	o := &restoreOptions{cluster: snapshot.Cluster}
+	for _, option := range options {
+		option(o)
+	}
+	root := (&KeyBuilder{o.cluster}).cluster()
+	exists, _, err := adm.zkClient.Exists(root)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if !o.overwrite {
+			return ErrClusterExists
+		}
+		if err := adm.zkClient.DeleteTree(root); err != nil {
+			return err
+		}
+	}
+	for _, node := range snapshot.Nodes {
+		relPath, data, err := remapSnapshotNode(node, snapshot.Cluster, o)
+		if err != nil {
+			return errors.Wrapf(err, "failed to restore %s", node.Path)
+		}
+		if err := adm.zkClient.CreateDataWithPath(path.Join(root, relPath), data); err != nil {
+			return errors.Wrapf(err, "failed to restore %s", node.Path)
+		}
+	}
+	return nil
+}
+
+// remapSnapshotNode renames the cluster and the instances in the path and the data of the node,
+// the data is returned as is if it is not a record or not renamed
+func remapSnapshotNode(node SnapshotNode, cluster string, o *restoreOptions) (string, []byte, error) {
+	segments := strings.Split(node.Path, "/")
+	for i, segment := range segments {
+		if instance, ok := o.instances[segment]; ok {
+			segments[i] = instance
+		} else if segment == cluster && i == 2 && segments[0] == "CONFIGS" && segments[1] == "CLUSTER" {
+			segments[i] = o.cluster
+		}
+	}
+	relPath := strings.Join(segments, "/")
+	if len(node.Data) == 0 || (len(o.instances) == 0 && o.cluster == cluster) {
+		return relPath, node.Data, nil
+	}
+	record, err := model.NewRecordFromBytes(node.Data)
+	if err != nil {
+		// not a record, e.g. the data of an application in the property store
+		return relPath, node.Data, nil
+	}
+	renames := map[string]string{}
+	for from, to := range o.instances {
+		renames[from] = to
+	}
+	if record.ID == cluster {
+		renames[cluster] = o.cluster
+	}
+	if !remapRecord(record, renames) {
+		return relPath, node.Data, nil
+	}
+	if len(segments) == 3 && segments[0] == "CONFIGS" && segments[1] == "PARTICIPANT" {
+		setInstanceHostPort(record, segments[2])
+	}
+	data, err := record.Marshal()
+	return relPath, data, err
+}
+
+// remapRecord renames the ID, the keys and the values of the record, it returns if any is renamed
+func remapRecord(record *model.ZNRecord, renames map[string]string) bool {
+	renamed := false
+	rename := func(value string) string {
+		if to, ok := renames[value]; ok {
+			renamed = true
+			return to
+		}
+		return value
+	}
+	record.ID = rename(record.ID)
+	for key, value := range record.SimpleFields {
+		record.SimpleFields[key] = rename(value)
+	}
+	listFields := make(map[string][]string, len(record.ListFields))
+	for key, values := range record.ListFields {
+		for i, value := range values {
+			values[i] = rename(value)
+		}
+		listFields[rename(key)] = values
+	}
+	record.ListFields = listFields
+	mapFields := make(map[string]map[string]string, len(record.MapFields))
+	for key, fields := range record.MapFields {
+		renamedFields := make(map[string]string, len(fields))
+		for field, value := range fields {
+			renamedFields[rename(field)] = rename(value)
+		}
+		mapFields[rename(key)] = renamedFields
+	}
+	record.MapFields = mapFields
+	return renamed
+}
+
+// setInstanceHostPort sets the host and port of the instance config from the instance name
+// in the host_port form
+func setInstanceHostPort(record *model.ZNRecord, instance string) {
+	host, port, err := model.ParseInstanceName(instance)
+	if err != nil {
+		return
+	}
+	config := &model.InstanceConfig{ZNRecord: *record}
+	config.SetHost(host)
+	config.SetPort(port)
+	*record = config.ZNRecord
+}
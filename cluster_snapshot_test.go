@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	uzk "github.com/uber-go/go-helix/zk"
+)
+
+func TestSnapshotAndRestoreCluster(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	assert.True(t, admin.AddCluster("snap", false))
+	assert.NoError(t, admin.AddNode("snap", "host1_1"))
+	assert.NoError(t, admin.AddNode("snap", "host2_2"))
+	assert.NoError(t, admin.EnableInstance("snap", "host1_1"))
+	assert.NoError(t, admin.EnableInstance("snap", "host2_2"))
+	assert.NoError(t, admin.AddResource("snap", "db", 2, StateModelNameOnlineOffline))
+	assert.NoError(t, admin.RebalanceResource("snap", "db", 2, RebalanceConstraints{}))
+	keyBuilder := &KeyBuilder{"snap"}
+	assert.NoError(t, client.CreateDataWithPath(keyBuilder.currentStateForResource("host1_1", "s", "db"), []byte("{}")))
+	assert.NoError(t, client.Create(keyBuilder.liveInstance("host1_1"), []byte("{}"), uzk.FlagsEphemeral, uzk.ACLPermAll))
+
+	snapshot, err := admin.SnapshotCluster("snap")
+	assert.NoError(t, err)
+	paths := make(map[string]bool, len(snapshot.Nodes))
+	for _, node := range snapshot.Nodes {
+		paths[node.Path] = true
+	}
+	assert.Equal(t, "", snapshot.Nodes[0].Path, "parents come first")
+	assert.True(t, paths["IDEALSTATES/db"])
+	assert.True(t, paths["INSTANCES/host1_1/CURRENTSTATES"])
+	assert.False(t, paths["INSTANCES/host1_1/CURRENTSTATES/s"], "runtime state is not exported by default")
+	assert.False(t, paths["LIVEINSTANCES/host1_1"], "ephemeral nodes are never exported")
+	withRuntime, err := admin.SnapshotCluster("snap", WithSnapshotRuntimeState())
+	assert.NoError(t, err)
+	assert.Equal(t, len(snapshot.Nodes)+2, len(withRuntime.Nodes))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, snapshot.Write(buf))
+	read, err := ReadClusterSnapshot(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshot.Nodes, read.Nodes)
+
+	// the snapshot is restored as another cluster with an instance renamed
+	assert.Equal(t, ErrClusterExists, admin.RestoreCluster(read))
+	assert.NoError(t, admin.RestoreCluster(read, WithRestoreClusterName("clone"),
+		WithRestoreInstanceMapping(map[string]string{"host1_1": "host3_3"})))
+	instances, err := admin.ListInstances("clone")
+	assert.NoError(t, err)
+	assert.Contains(t, instances, "host3_3")
+	assert.NotContains(t, instances, "host1_1")
+	config, err := admin.GetInstanceConfig("clone", "host3_3")
+	assert.NoError(t, err)
+	assert.Equal(t, "host3", config.GetHost())
+	assert.Equal(t, 3, config.GetPort())
+	assert.True(t, config.GetEnabled())
+	idealState, err := admin.ListIdealState("clone", "db")
+	assert.NoError(t, err)
+	for _, partition := range idealState.GetPartitionSet() {
+		assert.NotContains(t, idealState.GetPreferenceList(partition), "host1_1")
+		assert.Contains(t, idealState.GetPreferenceList(partition), "host3_3")
+	}
+	clusterConfig, err := admin.GetClusterConfig("clone")
+	assert.NoError(t, err)
+	assert.Equal(t, "clone", clusterConfig.ID)
+
+	// the restored cluster is overwritten
+	assert.NoError(t, admin.AddResource("clone", "other", 1, StateModelNameOnlineOffline))
+	assert.NoError(t, admin.RestoreCluster(read, WithRestoreClusterName("clone"), WithRestoreOverwrite()))
+	exists, _, err := client.Exists((&KeyBuilder{"clone"}).idealStateForResource("other"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,628 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ClusterSpec declares the clusters Admin.ApplyClusterSpec converges Zookeeper to. Only the
+// declared fields are converged, the other fields, e.g. written by Helix at runtime, are left as is
+type ClusterSpec struct {
+	Clusters []ClusterDefinition `json:"clusters"`
+}
+
+// ClusterDefinition declares a cluster with its state models, instances and resources
+type ClusterDefinition struct {
+	Name string `json:"name"`
+	// Config is the simple fields of the cluster config
+	Config SpecFields `json:"config,omitempty"`
+	// StateModels are the state model definitions added to the built-in ones
+	StateModels []model.ZNRecord     `json:"stateModels,omitempty"`
+	Instances   []InstanceDefinition `json:"instances,omitempty"`
+	Resources   []ResourceDefinition `json:"resources,omitempty"`
+}
+
+// InstanceDefinition declares an instance of a cluster
+type InstanceDefinition struct {
+	// Name is the instance name in the host_port form
+	Name string `json:"name"`
+	// Enabled enables or disables the instance, it is left as is if not set
+	Enabled *bool `json:"enabled,omitempty"`
+	// Tags are all the tags of the instance, they are left as is if not set
+	Tags   []string `json:"tags,omitempty"`
+	Domain string   `json:"domain,omitempty"`
+	// Config is the simple fields of the instance config
+	Config SpecFields `json:"config,omitempty"`
+}
+
+// ResourceDefinition declares a resource of a cluster
+type ResourceDefinition struct {
+	Name       string `json:"name"`
+	Partitions int    `json:"partitions"`
+	StateModel string `json:"stateModel"`
+	// Replicas is the number of replicas of the partitions, it is left as is if 0
+	Replicas int `json:"replicas,omitempty"`
+	// RebalanceMode is e.g. FULL_AUTO or SEMI_AUTO, it is left as is if empty
+	RebalanceMode string `json:"rebalanceMode,omitempty"`
+	// Tag restricts the resource to the instances with the tag
+	Tag string `json:"tag,omitempty"`
+	// Config is the simple fields of the resource config
+	Config SpecFields `json:"config,omitempty"`
+}
+
+// SpecFields are the simple fields of a config
+type SpecFields map[string]string
+
+// UnmarshalJSON reads the numbers and booleans as strings, e.g. the unquoted values in YAML
+func (f *SpecFields) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+	*f = make(SpecFields, len(fields))
+	for key, value := range fields {
+		switch value := value.(type) {
+		case string:
+			(*f)[key] = value
+		case json.Number, bool:
+			(*f)[key] = fmt.Sprint(value)
+		default:
+			return errors.Errorf("field %s is not a string, number or boolean", key)
+		}
+	}
+	return nil
+}
+
+// ParseClusterSpec reads a ClusterSpec from JSON or YAML, the unknown fields are rejected
+func ParseClusterSpec(data []byte) (*ClusterSpec, error) {
+	// YAML is a superset of JSON, the document is converted to JSON so the spec is
+	// only declared by the JSON tags
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse cluster spec")
+	}
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse cluster spec")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	spec := &ClusterSpec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "failed to parse cluster spec")
+	}
+	return spec, spec.Validate()
+}
+
+// Validate checks the spec declares each object once with the required fields
+func (s *ClusterSpec) Validate() error {
+	clusters := util.NewStringSet()
+	for _, cluster := range s.Clusters {
+		if cluster.Name == "" {
+			return errors.New("cluster spec: cluster without name")
+		}
+		if clusters.Contains(cluster.Name) {
+			return errors.Errorf("cluster spec: cluster %s declared twice", cluster.Name)
+		}
+		clusters.Add(cluster.Name)
+		if err := cluster.validate(); err != nil {
+			return errors.Wrapf(err, "cluster spec: cluster %s", cluster.Name)
+		}
+	}
+	return nil
+}
+
+func (c ClusterDefinition) validate() error {
+	stateModels := util.NewStringSet()
+	for _, stateModel := range c.StateModels {
+		if stateModel.ID == "" {
+			return errors.New("state model without id")
+		}
+		if stateModels.Contains(stateModel.ID) {
+			return errors.Errorf("state model %s declared twice", stateModel.ID)
+		}
+		stateModels.Add(stateModel.ID)
+	}
+	instances := util.NewStringSet()
+	for _, instance := range c.Instances {
+		if _, _, err := model.ParseInstanceName(instance.Name); err != nil {
+			return err
+		}
+		if instances.Contains(instance.Name) {
+			return errors.Errorf("instance %s declared twice", instance.Name)
+		}
+		instances.Add(instance.Name)
+		if instance.Domain != "" {
+			if err := model.NewInstanceConfig(instance.Name).SetDomain(instance.Domain); err != nil {
+				return errors.Wrapf(err, "instance %s", instance.Name)
+			}
+		}
+	}
+	resources := util.NewStringSet()
+	for _, resource := range c.Resources {
+		if resource.Name == "" {
+			return errors.New("resource without name")
+		}
+		if resources.Contains(resource.Name) {
+			return errors.Errorf("resource %s declared twice", resource.Name)
+		}
+		resources.Add(resource.Name)
+		if resource.Partitions <= 0 || resource.StateModel == "" {
+			return errors.Errorf("resource %s needs partitions and a state model", resource.Name)
+		}
+	}
+	return nil
+}
+
+// SpecChangeType is the type of a change made by Admin.ApplyClusterSpec
+type SpecChangeType string
+
+const (
+	// SpecChangeCreate creates the object
+	SpecChangeCreate SpecChangeType = "CREATE"
+	// SpecChangeUpdate updates the fields of the object
+	SpecChangeUpdate SpecChangeType = "UPDATE"
+	// SpecChangeDelete drops the object undeclared in the spec, see WithSpecPrune
+	SpecChangeDelete SpecChangeType = "DELETE"
+)
+
+// The kinds of the objects changed by Admin.ApplyClusterSpec
+const (
+	SpecKindCluster        = "CLUSTER"
+	SpecKindClusterConfig  = "CLUSTER_CONFIG"
+	SpecKindStateModel     = "STATE_MODEL"
+	SpecKindInstance       = "INSTANCE"
+	SpecKindResource       = "RESOURCE"
+	SpecKindResourceConfig = "RESOURCE_CONFIG"
+)
+
+// SpecChange is a change made by Admin.ApplyClusterSpec, or to be made in a dry run
+type SpecChange struct {
+	Type    SpecChangeType
+	Kind    string
+	Cluster string
+	// Name is the name of the changed object, empty for the cluster and its config
+	Name string
+	// Fields are the changed fields in the "FIELD: old -> new" form
+	Fields []string
+}
+
+func (c SpecChange) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Type, c.Kind, c.Cluster)
+	if c.Name != "" {
+		s += "/" + c.Name
+	}
+	if len(c.Fields) > 0 {
+		s += " " + strings.Join(c.Fields, ", ")
+	}
+	return s
+}
+
+// ApplySpecOption configures Admin.ApplyClusterSpec
+type ApplySpecOption func(*specApplier)
+
+// WithSpecDryRun reports the changes without making them
+func WithSpecDryRun() ApplySpecOption {
+	return func(a *specApplier) {
+		a.dryRun = true
+	}
+}
+
+// WithSpecPrune also drops the instances and resources of the declared clusters that are not
+// declared in the spec, the clusters not declared are never dropped
+func WithSpecPrune() ApplySpecOption {
+	return func(a *specApplier) {
+		a.prune = true
+	}
+}
+
+// ApplyClusterSpec converges Zookeeper to the spec: the missing clusters, state models, instances
+// and resources are created and their declared fields that differ are updated. It returns the
+// changes, the changes made before an error are returned with the error.
+// Applying a spec again makes no change, so the spec can be applied on every deployment
+func (adm Admin) ApplyClusterSpec(spec *ClusterSpec, options ...ApplySpecOption) ([]SpecChange, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	a := &specApplier{adm: adm}
+	for _, option := range options {
+		option(a)
+	}
+	for _, cluster := range spec.Clusters {
+		if err := a.applyCluster(cluster); err != nil {
+			return a.changes, errors.Wrapf(err, "failed to apply spec of cluster %s", cluster.Name)
+		}
+	}
+	return a.changes, nil
+}
+
+type specApplier struct {
+	adm     Admin
+	dryRun  bool
+	prune   bool
+	changes []SpecChange
+}
+
+// change records the change and makes it with write unless in a dry run
+func (a *specApplier) change(c SpecChange, write func() error) error {
+	a.changes = append(a.changes, c)
+	if a.dryRun {
+		return nil
+	}
+	return write()
+}
+
+// read returns the record at the path, nil if the path does not exist
+func (a *specApplier) read(path string) (*model.ZNRecord, error) {
+	record, err := a.adm.zkClient.GetRecordFromPath(path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	}
+	return record, err
+}
+
+// children returns the children of the path, none if the path does not exist
+func (a *specApplier) children(path string) ([]string, error) {
+	children, err := a.adm.zkClient.Children(path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	}
+	return children, err
+}
+
+func (a *specApplier) applyCluster(cluster ClusterDefinition) error {
+	isSetup, err := a.adm.isClusterSetup(cluster.Name)
+	if err != nil {
+		return err
+	}
+	if !isSetup {
+		err := a.change(SpecChange{Type: SpecChangeCreate, Kind: SpecKindCluster, Cluster: cluster.Name},
+			func() error {
+				if !a.adm.AddCluster(cluster.Name, false) {
+					return errors.Errorf("failed to add cluster %s", cluster.Name)
+				}
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	for _, apply := range []func(ClusterDefinition) error{
+		a.applyClusterConfig,
+		a.applyStateModels,
+		a.applyInstances,
+		a.applyResources,
+	} {
+		if err := apply(cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *specApplier) applyClusterConfig(cluster ClusterDefinition) error {
+	if len(cluster.Config) == 0 {
+		return nil
+	}
+	current, err := a.read((&KeyBuilder{cluster.Name}).clusterConfig())
+	if err != nil {
+		return err
+	}
+	fields := diffSimpleFields(current, cluster.Config)
+	if len(fields) == 0 {
+		return nil
+	}
+	return a.change(SpecChange{Type: SpecChangeUpdate, Kind: SpecKindClusterConfig, Cluster: cluster.Name,
+		Fields: fields}, func() error {
+		return a.adm.UpdateClusterConfig(cluster.Name, func(config *model.ClusterConfig) {
+			setSimpleFields(&config.ZNRecord, cluster.Config)
+		})
+	})
+}
+
+func (a *specApplier) applyStateModels(cluster ClusterDefinition) error {
+	builder := &KeyBuilder{cluster.Name}
+	accessor := newDataAccessor(a.adm.zkClient, builder)
+	for _, stateModel := range cluster.StateModels {
+		stateModel := stateModel
+		path := builder.stateModelDef(stateModel.ID)
+		current, err := a.read(path)
+		if err != nil {
+			return err
+		}
+		c := SpecChange{Kind: SpecKindStateModel, Cluster: cluster.Name, Name: stateModel.ID}
+		if current == nil {
+			c.Type = SpecChangeCreate
+			err = a.change(c, func() error { return accessor.createData(path, stateModel) })
+		} else if !recordFieldsEqual(current, &stateModel) {
+			c.Type = SpecChangeUpdate
+			err = a.change(c, func() error { return accessor.setData(path, stateModel, current.Version) })
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *specApplier) applyInstances(cluster ClusterDefinition) error {
+	builder := &KeyBuilder{cluster.Name}
+	declared := util.NewStringSet()
+	for _, instance := range cluster.Instances {
+		instance := instance
+		declared.Add(instance.Name)
+		current, err := a.read(builder.participantConfig(instance.Name))
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			err := a.change(SpecChange{Type: SpecChangeCreate, Kind: SpecKindInstance, Cluster: cluster.Name,
+				Name: instance.Name}, func() error { return a.adm.AddNode(cluster.Name, instance.Name) })
+			if err != nil {
+				return err
+			}
+			// the new instance config is disabled without tags and domain
+			current = &model.NewInstanceConfig(instance.Name).ZNRecord
+		}
+		config := &model.InstanceConfig{ZNRecord: *current}
+		fields := diffSimpleFields(current, instance.Config)
+		if instance.Enabled != nil && config.GetEnabled() != *instance.Enabled {
+			fields = append(fields, fmt.Sprintf("%s: %t -> %t",
+				model.FieldKeyHelixEnabled, config.GetEnabled(), *instance.Enabled))
+		}
+		if instance.Tags != nil {
+			tags := util.NewStringSet(config.GetTags()...).ToSortedSlice()
+			desired := util.NewStringSet(instance.Tags...).ToSortedSlice()
+			if !reflect.DeepEqual(tags, desired) {
+				fields = append(fields, fmt.Sprintf("%s: %v -> %v", model.FieldKeyTagList, tags, desired))
+			}
+		}
+		if instance.Domain != "" && config.GetDomain() != instance.Domain {
+			fields = append(fields, fmt.Sprintf("%s: %s -> %s",
+				model.FieldKeyDomain, formatField(config.GetDomain()), instance.Domain))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		err = a.change(SpecChange{Type: SpecChangeUpdate, Kind: SpecKindInstance, Cluster: cluster.Name,
+			Name: instance.Name, Fields: fields}, func() error {
+			return a.adm.updateInstanceConfig(cluster.Name, instance.Name, func(config *model.InstanceConfig) {
+				setSimpleFields(&config.ZNRecord, instance.Config)
+				if instance.Enabled != nil && config.GetEnabled() != *instance.Enabled {
+					config.SetEnabled(*instance.Enabled)
+					config.SetEnabledTime(time.Now())
+				}
+				if instance.Tags != nil {
+					for _, tag := range config.GetTags() {
+						config.RemoveTag(tag)
+					}
+					for _, tag := range instance.Tags {
+						config.AddTag(tag)
+					}
+				}
+				if instance.Domain != "" {
+					// the domain is validated with the spec
+					config.SetDomain(instance.Domain)
+				}
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !a.prune {
+		return nil
+	}
+	instances, err := a.children(builder.participantConfigs())
+	if err != nil {
+		return err
+	}
+	sort.Strings(instances)
+	for _, instance := range instances {
+		if declared.Contains(instance) {
+			continue
+		}
+		instance := instance
+		err := a.change(SpecChange{Type: SpecChangeDelete, Kind: SpecKindInstance, Cluster: cluster.Name,
+			Name: instance}, func() error { return a.adm.DropNode(cluster.Name, instance) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *specApplier) applyResources(cluster ClusterDefinition) error {
+	builder := &KeyBuilder{cluster.Name}
+	accessor := newDataAccessor(a.adm.zkClient, builder)
+	declared := util.NewStringSet()
+	for _, resource := range cluster.Resources {
+		resource := resource
+		declared.Add(resource.Name)
+		path := builder.idealStateForResource(resource.Name)
+		current, err := a.read(path)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			err := a.change(SpecChange{Type: SpecChangeCreate, Kind: SpecKindResource, Cluster: cluster.Name,
+				Name: resource.Name}, func() error {
+				return a.adm.addResource(cluster.Name, resource.Name, resource.Partitions,
+					resource.StateModel, resource.Tag)
+			})
+			if err != nil {
+				return err
+			}
+			current = &newResourceIdealState(resource.Name, resource.Partitions, resource.StateModel,
+				resource.Tag).ZNRecord
+		}
+		idealState := &model.IdealState{ZNRecord: *current}
+		if stateModel := idealState.GetStateModelDefRef(); stateModel != resource.StateModel {
+			return errors.Errorf("state model of resource %s can't be changed from %s to %s",
+				resource.Name, stateModel, resource.StateModel)
+		}
+		var fields []string
+		if idealState.GetNumPartitions() != resource.Partitions {
+			fields = append(fields, fmt.Sprintf("%s: %d -> %d",
+				model.FieldKeyNumPartitions, idealState.GetNumPartitions(), resource.Partitions))
+		}
+		if resource.Replicas > 0 && idealState.GetReplicas() != resource.Replicas {
+			fields = append(fields, fmt.Sprintf("%s: %d -> %d",
+				model.FieldKeyReplicas, idealState.GetReplicas(), resource.Replicas))
+		}
+		if resource.RebalanceMode != "" && idealState.GetRebalanceMode() != resource.RebalanceMode {
+			fields = append(fields, fmt.Sprintf("%s: %s -> %s", model.FieldKeyRebalanceMode,
+				formatField(idealState.GetRebalanceMode()), resource.RebalanceMode))
+		}
+		if idealState.GetInstanceGroupTag() != resource.Tag {
+			fields = append(fields, fmt.Sprintf("%s: %s -> %s", model.FieldKeyInstanceGroupTag,
+				formatField(idealState.GetInstanceGroupTag()), formatField(resource.Tag)))
+		}
+		if len(fields) > 0 {
+			err := a.change(SpecChange{Type: SpecChangeUpdate, Kind: SpecKindResource, Cluster: cluster.Name,
+				Name: resource.Name, Fields: fields}, func() error {
+				return accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+					if data == nil {
+						return nil, ErrResourceNotExists
+					}
+					idealState := &model.IdealState{ZNRecord: *data}
+					idealState.SetNumPartitions(resource.Partitions)
+					if resource.Replicas > 0 {
+						idealState.SetReplicas(resource.Replicas)
+					}
+					if resource.RebalanceMode != "" {
+						idealState.SetRebalanceMode(resource.RebalanceMode)
+					}
+					if resource.Tag != "" {
+						idealState.SetInstanceGroupTag(resource.Tag)
+					} else {
+						delete(idealState.SimpleFields, model.FieldKeyInstanceGroupTag)
+					}
+					return &idealState.ZNRecord, nil
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := a.applyResourceConfig(cluster.Name, resource); err != nil {
+			return err
+		}
+	}
+	if !a.prune {
+		return nil
+	}
+	resources, err := a.children(builder.idealStates())
+	if err != nil {
+		return err
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		if declared.Contains(resource) {
+			continue
+		}
+		resource := resource
+		err := a.change(SpecChange{Type: SpecChangeDelete, Kind: SpecKindResource, Cluster: cluster.Name,
+			Name: resource}, func() error { return a.adm.DropResource(cluster.Name, resource) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *specApplier) applyResourceConfig(cluster string, resource ResourceDefinition) error {
+	if len(resource.Config) == 0 {
+		return nil
+	}
+	current, err := a.read((&KeyBuilder{cluster}).resourceConfig(resource.Name))
+	if err != nil {
+		return err
+	}
+	fields := diffSimpleFields(current, resource.Config)
+	if len(fields) == 0 {
+		return nil
+	}
+	return a.change(SpecChange{Type: SpecChangeUpdate, Kind: SpecKindResourceConfig, Cluster: cluster,
+		Name: resource.Name, Fields: fields}, func() error {
+		return a.adm.UpdateResourceConfig(cluster, resource.Name, func(config *model.ResourceConfig) {
+			setSimpleFields(&config.ZNRecord, resource.Config)
+		})
+	})
+}
+
+// diffSimpleFields returns the fields whose value in the record differs, sorted by key,
+// the record is nil if it does not exist
+func diffSimpleFields(record *model.ZNRecord, fields SpecFields) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var diffs []string
+	for _, key := range keys {
+		current := ""
+		if record != nil {
+			current = record.GetStringField(key, "")
+		}
+		if current != fields[key] {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", key, formatField(current), fields[key]))
+		}
+	}
+	return diffs
+}
+
+func setSimpleFields(record *model.ZNRecord, fields SpecFields) {
+	for key, value := range fields {
+		record.SetSimpleField(key, value)
+	}
+}
+
+// formatField formats an empty value as "-"
+func formatField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// recordFieldsEqual returns if the records have the same fields, the empty and nil fields are equal
+func recordFieldsEqual(r1 *model.ZNRecord, r2 *model.ZNRecord) bool {
+	return (len(r1.SimpleFields) == 0 && len(r2.SimpleFields) == 0 ||
+		reflect.DeepEqual(r1.SimpleFields, r2.SimpleFields)) &&
+		(len(r1.ListFields) == 0 && len(r2.ListFields) == 0 || reflect.DeepEqual(r1.ListFields, r2.ListFields)) &&
+		(len(r1.MapFields) == 0 && len(r2.MapFields) == 0 || reflect.DeepEqual(r1.MapFields, r2.MapFields))
+}
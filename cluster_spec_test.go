@@ -0,0 +1,174 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+const _testClusterSpec = `
+clusters:
+- name: spec_cluster
+  config:
+    allowParticipantAutoJoin: true
+    MAX_PARTITIONS_PER_INSTANCE: 10
+  stateModels:
+  - id: Custom
+    simpleFields:
+      INITIAL_STATE: OFFLINE
+    listFields:
+      STATE_PRIORITY_LIST: [ONLINE, OFFLINE]
+  instances:
+  - name: host1_1
+    enabled: true
+    tags: [a]
+  - name: host2_2
+    domain: zone=z2,instance=host2_2
+  resources:
+  - name: db
+    partitions: 4
+    stateModel: OnlineOffline
+    replicas: 2
+    rebalanceMode: FULL_AUTO
+    tag: a
+    config:
+      MIN_ACTIVE_REPLICAS: 1
+`
+
+func TestParseClusterSpec(t *testing.T) {
+	spec, err := ParseClusterSpec([]byte(_testClusterSpec))
+	assert.NoError(t, err)
+	cluster := spec.Clusters[0]
+	assert.Equal(t, SpecFields{"allowParticipantAutoJoin": "true", "MAX_PARTITIONS_PER_INSTANCE": "10"},
+		cluster.Config)
+	assert.Equal(t, []string{"ONLINE", "OFFLINE"}, cluster.StateModels[0].GetListField("STATE_PRIORITY_LIST"))
+	assert.True(t, *cluster.Instances[0].Enabled)
+	assert.Nil(t, cluster.Instances[1].Enabled)
+	assert.Equal(t, ResourceDefinition{Name: "db", Partitions: 4, StateModel: "OnlineOffline", Replicas: 2,
+		RebalanceMode: "FULL_AUTO", Tag: "a", Config: SpecFields{"MIN_ACTIVE_REPLICAS": "1"}}, cluster.Resources[0])
+
+	// JSON is parsed as YAML
+	spec, err = ParseClusterSpec([]byte(`{"clusters": [{"name": "c", "resources": [
+		{"name": "r", "partitions": 1, "stateModel": "LeaderStandby"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "r", spec.Clusters[0].Resources[0].Name)
+
+	_, err = ParseClusterSpec([]byte("clusters:\n- name: c\n  resource: []\n"))
+	assert.Error(t, err, "unknown fields are rejected")
+	_, err = ParseClusterSpec([]byte("clusters:\n- name: c\n  instances:\n  - name: host\n"))
+	assert.Error(t, err, "instance names are host_port")
+	_, err = ParseClusterSpec([]byte("clusters:\n- name: c\n- name: c\n"))
+	assert.Error(t, err, "clusters are declared once")
+}
+
+func TestApplyClusterSpec(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	spec, err := ParseClusterSpec([]byte(_testClusterSpec))
+	assert.NoError(t, err)
+
+	expected := []string{
+		"CREATE CLUSTER spec_cluster",
+		"UPDATE CLUSTER_CONFIG spec_cluster MAX_PARTITIONS_PER_INSTANCE: - -> 10, allowParticipantAutoJoin: - -> true",
+		"CREATE STATE_MODEL spec_cluster/Custom",
+		"CREATE INSTANCE spec_cluster/host1_1",
+		"UPDATE INSTANCE spec_cluster/host1_1 HELIX_ENABLED: false -> true, TAG_LIST: [] -> [a]",
+		"CREATE INSTANCE spec_cluster/host2_2",
+		"UPDATE INSTANCE spec_cluster/host2_2 DOMAIN: - -> zone=z2,instance=host2_2",
+		"CREATE RESOURCE spec_cluster/db",
+		"UPDATE RESOURCE spec_cluster/db REPLICAS: 0 -> 2, REBALANCE_MODE: SEMI_AUTO -> FULL_AUTO",
+		"UPDATE RESOURCE_CONFIG spec_cluster/db MIN_ACTIVE_REPLICAS: - -> 1",
+	}
+	// the dry run reports the changes without making them
+	changes, err := admin.ApplyClusterSpec(spec, WithSpecDryRun())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, formatSpecChanges(changes))
+	exists, _, err := client.Exists("/spec_cluster")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	changes, err = admin.ApplyClusterSpec(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, formatSpecChanges(changes))
+	accessor := newDataAccessor(client, &KeyBuilder{"spec_cluster"})
+	instance, err := accessor.InstanceConfig((&KeyBuilder{"spec_cluster"}).participantConfig("host1_1"))
+	assert.NoError(t, err)
+	assert.True(t, instance.GetEnabled())
+	assert.Equal(t, []string{"a"}, instance.GetTags())
+	idealState, err := accessor.IdealState("db")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idealState.GetReplicas())
+	assert.Equal(t, "a", idealState.GetInstanceGroupTag())
+	stateModel, err := accessor.StateModelDef("Custom")
+	assert.NoError(t, err)
+	assert.Equal(t, "OFFLINE", stateModel.GetInitialState())
+
+	// applying the spec again makes no change
+	changes, err = admin.ApplyClusterSpec(spec)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// the undeclared fields are left as is and the undeclared objects are only dropped by pruning
+	assert.NoError(t, admin.AddResource("spec_cluster", "undeclared", 1, "OnlineOffline"))
+	spec.Clusters[0].Instances[0].Tags = []string{"b"}
+	spec.Clusters[0].Instances[1].Config = SpecFields{"WEIGHT": "200"}
+	spec.Clusters[0].Resources[0].Tag = ""
+	changes, err = admin.ApplyClusterSpec(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"UPDATE INSTANCE spec_cluster/host1_1 TAG_LIST: [a] -> [b]",
+		"UPDATE INSTANCE spec_cluster/host2_2 WEIGHT: - -> 200",
+		"UPDATE RESOURCE spec_cluster/db INSTANCE_GROUP_TAG: a -> -",
+	}, formatSpecChanges(changes))
+	changes, err = admin.ApplyClusterSpec(spec, WithSpecPrune())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DELETE RESOURCE spec_cluster/undeclared"}, formatSpecChanges(changes))
+	exists, _, err = client.Exists("/spec_cluster/IDEALSTATES/undeclared")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	idealState, err = accessor.IdealState("db")
+	assert.NoError(t, err)
+	assert.Equal(t, "", idealState.GetInstanceGroupTag())
+
+	// the state model of a resource is not changed
+	spec.Clusters[0].Resources[0].StateModel = "Custom"
+	_, err = admin.ApplyClusterSpec(spec)
+	assert.Error(t, err)
+
+	stateModel.SetSimpleField(model.FieldKeyInitialState, "ONLINE")
+	spec.Clusters[0].StateModels[0] = stateModel.ZNRecord
+	spec.Clusters[0].Resources[0].StateModel = "OnlineOffline"
+	changes, err = admin.ApplyClusterSpec(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"UPDATE STATE_MODEL spec_cluster/Custom"}, formatSpecChanges(changes))
+}
+
+func formatSpecChanges(changes []SpecChange) []string {
+	formatted := make([]string, 0, len(changes))
+	for _, change := range changes {
+		formatted = append(formatted, change.String())
+	}
+	return formatted
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// errUsage is returned by the commands called with invalid arguments
+var errUsage = errors.New("invalid arguments")
+
+func listClusters(e *env, args []string) error {
+	clusters, err := e.admin.ListClusters()
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(e.out, clusters)
+	return nil
+}
+
+func listResources(e *env, args []string) error {
+	resources, err := e.admin.ListResources(e.cluster)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(e.out, resources)
+	return nil
+}
+
+func listInstances(e *env, args []string) error {
+	instances, err := e.admin.ListInstances(e.cluster)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(e.out, instances)
+	return nil
+}
+
+func diffResource(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	idealState, err := e.admin.ListIdealState(e.cluster, args[0])
+	if err != nil {
+		return err
+	}
+	externalView, err := e.admin.ListExternalView(e.cluster, args[0])
+	if err != nil {
+		return err
+	}
+	diffs := diffExternalView(idealState, externalView)
+	if len(diffs) == 0 {
+		fmt.Fprintf(e.out, "external view of %s matches the ideal state\n", args[0])
+		return nil
+	}
+	for _, diff := range diffs {
+		fmt.Fprintln(e.out, diff)
+	}
+	return nil
+}
+
+func enableInstance(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return e.admin.EnableInstance(e.cluster, args[0])
+}
+
+func disableInstance(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return e.admin.DisableInstance(e.cluster, args[0])
+}
+
+func rebalanceResource(e *env, args []string) error {
+	flags := flag.NewFlagSet("rebalance", flag.ContinueOnError)
+	tag := flags.String("tag", "", "place the partitions only on the instances with the tag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errUsage
+	}
+	replicas, err := strconv.Atoi(flags.Arg(1))
+	if err != nil {
+		return errors.Errorf("invalid replicas %q", flags.Arg(1))
+	}
+	return e.admin.RebalanceResource(e.cluster, flags.Arg(0), replicas,
+		helix.RebalanceConstraints{InstanceTag: *tag})
+}
+
+// fieldsFlag collects the repeated key=value flags
+type fieldsFlag map[string]string
+
+func (f fieldsFlag) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f fieldsFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return errors.Errorf("expected key=value, got %q", value)
+	}
+	f[kv[0]] = kv[1]
+	return nil
+}
+
+func sendMessage(e *env, args []string) error {
+	flags := flag.NewFlagSet("send-message", flag.ContinueOnError)
+	msgType := flags.String("type", helix.MsgTypeStateTransition, "the message type")
+	fields := fieldsFlag{}
+	flags.Var(fields, "field", "a simple field of the message, e.g. PARTITION_NAME=myDB_0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	msg := model.NewMsg(util.NewUUID())
+	msg.SetMsgType(*msgType)
+	msg.SetMsgState(model.MessageStateNew)
+	for key, value := range fields {
+		msg.SetSimpleField(key, value)
+	}
+	if err := e.admin.SendMessage(e.cluster, flags.Arg(0), msg); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "sent message %s to %s\n", msg.ID, flags.Arg(0))
+	return nil
+}
+
+func verifyCluster(e *env, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 0, "wait up to the timeout for the external views to converge")
+	idealStateFile := flags.String("ideal-state", "",
+		"validate the ideal state in the JSON file against the cluster instead, e.g. before applying it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *idealStateFile != "" {
+		return validateIdealState(e, *idealStateFile)
+	}
+	var options []helix.VerifierOption
+	if flags.NArg() > 0 {
+		options = append(options, helix.WithVerifiedResources(flags.Args()...))
+	}
+	verifier := helix.NewBestPossibleExternalViewVerifier(zap.NewNop(), tally.NoopScope,
+		e.zkConnectString, e.cluster, options...)
+	if err := verifier.Connect(); err != nil {
+		return err
+	}
+	defer verifier.Disconnect()
+
+	if err := verifier.VerifyByPolling(*timeout); err != nil &&
+		errors.Cause(err) != helix.ErrExternalViewNotConverged {
+		return err
+	}
+	mismatches, err := verifier.Verify()
+	if err != nil {
+		return err
+	}
+	if len(mismatches) == 0 {
+		fmt.Fprintln(e.out, "external views match the best possible mapping")
+		return nil
+	}
+	for _, mismatch := range mismatches {
+		fmt.Fprintln(e.out, mismatch)
+	}
+	return errors.Errorf("%d partitions differ from the best possible mapping", len(mismatches))
+}
+
+func validateIdealState(e *env, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	record, err := model.NewRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+	violations, err := e.admin.ValidateIdealState(e.cluster, &model.IdealState{ZNRecord: *record})
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		fmt.Fprintf(e.out, "ideal state of %s satisfies the placement constraints\n", record.ID)
+		return nil
+	}
+	for _, violation := range violations {
+		fmt.Fprintln(e.out, violation)
+	}
+	return errors.Errorf("%d placement constraints violated", len(violations))
+}
+
+func applySpec(e *env, args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the changes without making them")
+	prune := flags.Bool("prune", false, "drop the instances and resources not in the spec")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	spec, err := helix.ParseClusterSpec(data)
+	if err != nil {
+		return err
+	}
+	var options []helix.ApplySpecOption
+	if *dryRun {
+		options = append(options, helix.WithSpecDryRun())
+	}
+	if *prune {
+		options = append(options, helix.WithSpecPrune())
+	}
+	changes, err := e.admin.ApplyClusterSpec(spec, options...)
+	for _, change := range changes {
+		fmt.Fprintln(e.out, change)
+	}
+	if err == nil && len(changes) == 0 {
+		fmt.Fprintln(e.out, "clusters match the spec")
+	}
+	return err
+}
+
+func exportCluster(e *env, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	runtime := flags.Bool("runtime", false, "also export the runtime state, e.g. the current states")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	var options []helix.SnapshotOption
+	if *runtime {
+		options = append(options, helix.WithSnapshotRuntimeState())
+	}
+	snapshot, err := e.admin.SnapshotCluster(e.cluster, options...)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "exported %d nodes of %s\n", len(snapshot.Nodes), e.cluster)
+	return nil
+}
+
+func importCluster(e *env, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	instances := fieldsFlag{}
+	flags.Var(instances, "instance", "rename the instance, e.g. host1_9000=host2_9000")
+	overwrite := flags.Bool("overwrite", false, "drop the cluster first if it exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	snapshot, err := helix.ReadClusterSnapshot(f)
+	if err != nil {
+		return err
+	}
+	cluster := snapshot.Cluster
+	options := []helix.RestoreOption{helix.WithRestoreInstanceMapping(instances)}
+	if e.cluster != "" {
+		cluster = e.cluster
+		options = append(options, helix.WithRestoreClusterName(cluster))
+	}
+	if *overwrite {
+		options = append(options, helix.WithRestoreOverwrite())
+	}
+	if err := e.admin.RestoreCluster(snapshot, options...); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "imported %d nodes of %s into %s\n", len(snapshot.Nodes), snapshot.Cluster, cluster)
+	return nil
+}
+
+func tailCluster(e *env, args []string) error {
+	provider := helix.NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, e.zkConnectString, e.cluster)
+	if err := provider.Connect(); err != nil {
+		return err
+	}
+	defer provider.Disconnect()
+
+	// tables keeps the latest routing table only, the changes are printed against the previous
+	// printed table so none is lost, and the refresh of the provider is never blocked
+	tables := make(chan *helix.RoutingTable, 1)
+	provider.AddListener(func(table *helix.RoutingTable) {
+		select {
+		case <-tables:
+		default:
+		}
+		tables <- table
+	})
+	previous := provider.GetRoutingTable()
+	for _, change := range diffRoutingTables(&helix.RoutingTable{}, previous) {
+		fmt.Fprintln(e.out, change)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	for {
+		select {
+		case table := <-tables:
+			for _, change := range diffRoutingTables(previous, table) {
+				fmt.Fprintln(e.out, change)
+			}
+			previous = table
+		case <-interrupt:
+			return nil
+		}
+	}
+}
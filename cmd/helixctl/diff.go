@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// partitionDiff is a partition whose external view differs from the ideal state
+type partitionDiff struct {
+	partition string
+	// ideal is the instances of the partition by state in the ideal state,
+	// the state is empty if the ideal state only has the preference list
+	ideal    map[string]string
+	external map[string]string
+}
+
+func (d partitionDiff) String() string {
+	return fmt.Sprintf("%s: ideal %s, external %s",
+		d.partition, formatStateMap(d.ideal), formatStateMap(d.external))
+}
+
+// diffExternalView returns the partitions whose instances or states in the external view differ
+// from the ideal state, the states are only compared if the ideal state has the map fields
+func diffExternalView(idealState *model.IdealState, externalView *model.ExternalView) []partitionDiff {
+	partitions := idealState.GetPartitionSet()
+	seen := util.NewStringSet(partitions...)
+	for _, partition := range externalView.GetPartitionSet() {
+		if !seen.Contains(partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+	sort.Strings(partitions)
+
+	var diffs []partitionDiff
+	for _, partition := range partitions {
+		ideal := idealState.MapFields[partition]
+		compareStates := len(ideal) > 0
+		if !compareStates {
+			ideal = map[string]string{}
+			for _, instance := range idealState.GetPreferenceList(partition) {
+				ideal[instance] = ""
+			}
+		}
+		external := externalView.GetStateMap(partition)
+		if !stateMapsMatch(ideal, external, compareStates) {
+			diffs = append(diffs, partitionDiff{partition: partition, ideal: ideal, external: external})
+		}
+	}
+	return diffs
+}
+
+func stateMapsMatch(ideal map[string]string, external map[string]string, compareStates bool) bool {
+	if len(ideal) != len(external) {
+		return false
+	}
+	for instance, state := range ideal {
+		externalState, ok := external[instance]
+		if !ok || (compareStates && externalState != state) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatStateMap formats the states by instance sorted by instance, e.g. [a:ONLINE b]
+func formatStateMap(states map[string]string) string {
+	instances := make([]string, 0, len(states))
+	for instance := range states {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	for i, instance := range instances {
+		if state := states[instance]; state != "" {
+			instances[i] = instance + ":" + state
+		}
+	}
+	return "[" + strings.Join(instances, " ") + "]"
+}
+
+// diffRoutingTables returns the live instances and the partition states changed between the tables
+func diffRoutingTables(previous *helix.RoutingTable, current *helix.RoutingTable) []string {
+	var changes []string
+	previousInstances := util.NewStringSet(previous.GetLiveInstances()...)
+	currentInstances := util.NewStringSet(current.GetLiveInstances()...)
+	for _, instance := range current.GetLiveInstances() {
+		if !previousInstances.Contains(instance) {
+			changes = append(changes, fmt.Sprintf("instance %s joined", instance))
+		}
+	}
+	for _, instance := range previous.GetLiveInstances() {
+		if !currentInstances.Contains(instance) {
+			changes = append(changes, fmt.Sprintf("instance %s left", instance))
+		}
+	}
+
+	resources := util.NewStringSet(previous.GetResources()...)
+	resources.AddAll(current.GetResources()...)
+	for _, resource := range resources.ToSortedSlice() {
+		partitions := util.NewStringSet(previous.GetPartitions(resource)...)
+		partitions.AddAll(current.GetPartitions(resource)...)
+		for _, partition := range partitions.ToSortedSlice() {
+			previousStates := previous.GetStateMap(resource, partition)
+			currentStates := current.GetStateMap(resource, partition)
+			instances := util.NewStringSet()
+			for instance := range previousStates {
+				instances.Add(instance)
+			}
+			for instance := range currentStates {
+				instances.Add(instance)
+			}
+			for _, instance := range instances.ToSortedSlice() {
+				from, to := previousStates[instance], currentStates[instance]
+				if from == to {
+					continue
+				}
+				if from == "" {
+					from = "-"
+				}
+				if to == "" {
+					to = "-"
+				}
+				changes = append(changes, fmt.Sprintf("%s %s on %s: %s -> %s",
+					resource, partition, instance, from, to))
+			}
+		}
+	}
+	return changes
+}
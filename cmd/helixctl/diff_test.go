@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func TestDiffExternalView(t *testing.T) {
+	idealState := &model.IdealState{ZNRecord: *model.NewRecord("db")}
+	idealState.SetPreferenceList("db_0", []string{"a", "b"})
+	idealState.SetPreferenceList("db_1", []string{"a", "b"})
+	idealState.SetMapField("db_2", "a", "MASTER")
+	idealState.SetMapField("db_2", "b", "SLAVE")
+	externalView := model.NewExternalView("db")
+	externalView.SetState("db_0", "a", "ONLINE")
+	externalView.SetState("db_0", "b", "OFFLINE")
+	externalView.SetState("db_1", "a", "ONLINE")
+	externalView.SetState("db_2", "a", "SLAVE")
+	externalView.SetState("db_2", "b", "MASTER")
+	externalView.SetState("db_3", "c", "ONLINE")
+
+	diffs := diffExternalView(idealState, externalView)
+	var lines []string
+	for _, diff := range diffs {
+		lines = append(lines, diff.String())
+	}
+	assert.Equal(t, []string{
+		"db_1: ideal [a b], external [a:ONLINE]",
+		"db_2: ideal [a:MASTER b:SLAVE], external [a:SLAVE b:MASTER]",
+		"db_3: ideal [], external [c:ONLINE]",
+	}, lines)
+}
+
+func TestRunInvalidArguments(t *testing.T) {
+	var out bytes.Buffer
+	assert.EqualError(t, run([]string{}, &out), "missing command")
+	assert.EqualError(t, run([]string{"unknown"}, &out), `unknown command "unknown"`)
+	assert.EqualError(t, run([]string{"resources"}, &out), "resources: missing -cluster")
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// helixctl administers Helix clusters from the command line, mirroring the commands of
+// the helix-admin.sh shell of the Java Helix:
+//
+//	helixctl -zk localhost:2181 clusters
+//	helixctl -zk localhost:2181 -cluster MYCLUSTER diff myDB
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix"
+)
+
+// command is a subcommand of helixctl
+type command struct {
+	usage string
+	help  string
+	// needsCluster fails the command if the -cluster flag is not set
+	needsCluster bool
+	run          func(e *env, args []string) error
+}
+
+// env is the state shared by the commands
+type env struct {
+	zkConnectString string
+	cluster         string
+	out             io.Writer
+	admin           *helix.Admin
+}
+
+var _commands = map[string]command{
+	"clusters": {
+		usage: "clusters",
+		help:  "list the clusters",
+		run:   listClusters,
+	},
+	"resources": {
+		usage:        "resources",
+		help:         "list the resources of the cluster",
+		needsCluster: true,
+		run:          listResources,
+	},
+	"instances": {
+		usage:        "instances",
+		help:         "list the instances of the cluster",
+		needsCluster: true,
+		run:          listInstances,
+	},
+	"diff": {
+		usage:        "diff <resource>",
+		help:         "show the partitions whose external view differs from the ideal state",
+		needsCluster: true,
+		run:          diffResource,
+	},
+	"enable-instance": {
+		usage:        "enable-instance <instance>",
+		help:         "enable the instance",
+		needsCluster: true,
+		run:          enableInstance,
+	},
+	"disable-instance": {
+		usage:        "disable-instance <instance>",
+		help:         "disable the instance",
+		needsCluster: true,
+		run:          disableInstance,
+	},
+	"rebalance": {
+		usage:        "rebalance [-tag tag] <resource> <replicas>",
+		help:         "recompute the preference lists of the SEMI_AUTO resource",
+		needsCluster: true,
+		run:          rebalanceResource,
+	},
+	"send-message": {
+		usage:        "send-message [-type type] [-field key=value]... <instance>",
+		help:         "send a message to the live instance",
+		needsCluster: true,
+		run:          sendMessage,
+	},
+	"verify": {
+		usage:        "verify [-timeout duration] [-ideal-state file] [resource]...",
+		help:         "fail if the external views differ from the best possible mapping or the ideal state file violates the constraints",
+		needsCluster: true,
+		run:          verifyCluster,
+	},
+	"apply": {
+		usage: "apply [-dry-run] [-prune] <spec file>",
+		help:  "converge the clusters to the YAML or JSON spec and print the changes",
+		run:   applySpec,
+	},
+	"export": {
+		usage:        "export [-runtime] <file>",
+		help:         "write the metadata of the cluster to the snapshot file",
+		needsCluster: true,
+		run:          exportCluster,
+	},
+	"import": {
+		usage: "import [-instance old=new]... [-overwrite] <file>",
+		help:  "restore the cluster from the snapshot file, as the -cluster if set",
+		run:   importCluster,
+	},
+	"tail": {
+		usage:        "tail",
+		help:         "print the live instance and partition state changes until interrupted",
+		needsCluster: true,
+		run:          tailCluster,
+	},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "helixctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("helixctl", flag.ContinueOnError)
+	e := &env{out: out}
+	flags.StringVar(&e.zkConnectString, "zk", "localhost:2181", "the Zookeeper connect string")
+	flags.StringVar(&e.cluster, "cluster", "", "the cluster name")
+	flags.Usage = func() {
+		printUsage(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		printUsage(flags)
+		return errors.New("missing command")
+	}
+	name := flags.Arg(0)
+	cmd, ok := _commands[name]
+	if !ok {
+		printUsage(flags)
+		return errors.Errorf("unknown command %q", name)
+	}
+	if cmd.needsCluster && e.cluster == "" {
+		return errors.Errorf("%s: missing -cluster", name)
+	}
+	admin, err := helix.NewAdmin(e.zkConnectString)
+	if err != nil {
+		return err
+	}
+	e.admin = admin
+	if err := cmd.run(e, flags.Args()[1:]); err != errUsage {
+		return err
+	}
+	return errors.Errorf("usage: helixctl %s", cmd.usage)
+}
+
+func printUsage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintln(w, "usage: helixctl [-zk connect string] [-cluster name] <command> [arguments]")
+	fmt.Fprintln(w, "\nflags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(_commands))
+	for name := range _commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-55s %s\n", _commands[name].usage, _commands[name].help)
+	}
+}
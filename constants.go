@@ -23,10 +23,21 @@ package helix
 // Helix constants
 const (
 	StateModelNameOnlineOffline = "OnlineOffline"
+	StateModelNameLeaderStandby = "LeaderStandby"
+	// StateModelNameSchedulerTaskQueue is the state model and the resource of the scheduled tasks,
+	// mirrors DefaultSchedulerMessageHandlerFactory.SCHEDULER_TASK_QUEUE
+	StateModelNameSchedulerTaskQueue = "SchedulerTaskQueue"
 
 	StateModelStateOnline  = "ONLINE"
 	StateModelStateOffline = "OFFLINE"
 	StateModelStateDropped = "DROPPED"
+	StateModelStateError   = "ERROR"
+	StateModelStateLeader  = "LEADER"
+	StateModelStateStandby = "STANDBY"
+	// StateModelStateCompleted is the state of the scheduled tasks once executed
+	StateModelStateCompleted = "COMPLETED"
+
+	StateModelFactoryNameDefault = "DEFAULT"
 
 	TargetController = "CONTROLLER"
 
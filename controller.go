@@ -0,0 +1,437 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// DefaultRebalanceInterval is the default interval a started controller runs its pipeline at
+// without changes of the cluster, e.g. to retry the transitions that failed to be sent
+const DefaultRebalanceInterval = 30 * time.Second
+
+// Controller computes the placements of the resources of a cluster by running
+// the controller pipeline, the placement logic of the USER_DEFINED resources
+// is provided by the registered Rebalancers.
+// A started controller also manages the cluster like the Java controller
+// This mirrors org.apache.helix.controller.GenericHelixController
+type Controller struct {
+	logger       Logger
+	scope        tally.Scope
+	clusterName  string
+	name         string
+	zkClient     *uzk.Client
+	dataAccessor *DataAccessor
+	// propertyCache keeps the cluster data read by the pipeline if it is cached,
+	// it notifies a started controller of the changes of the cluster otherwise
+	propertyCache *PropertyCache
+	useCachedData bool
+
+	rebalancersMu sync.RWMutex
+	rebalancers   map[string]Rebalancer
+
+	// customizedStateTypes are the types of the customized states aggregated into customized views
+	customizedStateTypes []string
+	// stages are run after the built-in stages of the pipeline
+	stages   []PipelineStage
+	pipeline *Pipeline
+	// managedPipeline is run by a started controller, it also sends the state transition
+	// messages and writes the external views
+	managedPipeline *Pipeline
+
+	// zkClientOptions are applied after the default options of the ZK client
+	zkClientOptions []uzk.ClientOption
+	// metricTags are the static tags of the metrics of the controller
+	metricTags map[string]string
+	// strictValidation validates the ideal states and instance configs read
+	strictValidation bool
+	// eventLog records the cluster events observed by the started controller if set
+	eventLog *EventLog
+
+	rebalanceInterval time.Duration
+	leaderGuard       *uzk.EphemeralGuard
+	leaderMu          sync.RWMutex
+	isLeader          bool
+	// eventCh coalesces the changes of the cluster into pipeline runs
+	eventCh chan struct{}
+	// startMu guards stopCh and doneCh, which are nil if the controller is not started
+	startMu sync.Mutex
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// ControllerOption configures optional settings of a Controller
+type ControllerOption func(*Controller)
+
+// WithPipelineStages appends stages to the controller pipeline,
+// they are run after the best possible states are computed
+func WithPipelineStages(stages ...PipelineStage) ControllerOption {
+	return func(c *Controller) {
+		c.stages = append(c.stages, stages...)
+	}
+}
+
+// WithCustomizedViewAggregation aggregates the customized states of the types reported by
+// the participants into the customized views read by the spectators
+func WithCustomizedViewAggregation(stateTypes ...string) ControllerOption {
+	return func(c *Controller) {
+		c.customizedStateTypes = append(c.customizedStateTypes, stateTypes...)
+	}
+}
+
+// WithCachedClusterData keeps the ideal states, live instances, instance configs and
+// current states in a PropertyCache updated by watches instead of reading them on every run
+func WithCachedClusterData() ControllerOption {
+	return func(c *Controller) {
+		c.useCachedData = true
+	}
+}
+
+// WithControllerZkClientOptions configures the ZK client of the controller,
+// e.g. with uzk.WithAuditSink to audit the changes of the ideal states made by the controller
+func WithControllerZkClientOptions(options ...uzk.ClientOption) ControllerOption {
+	return func(c *Controller) {
+		c.zkClientOptions = append(c.zkClientOptions, options...)
+	}
+}
+
+// WithControllerLogger sets the logger of the controller and of its ZK client instead of the zap
+// logger passed to NewController
+func WithControllerLogger(logger Logger) ControllerOption {
+	return func(c *Controller) {
+		c.logger = logger
+	}
+}
+
+// WithControllerMetricTags adds static tags to all the metrics of the controller, including the
+// ones of its ZK client and of its property cache
+func WithControllerMetricTags(tags map[string]string) ControllerOption {
+	return func(c *Controller) {
+		c.metricTags = mergeMetricTags(c.metricTags, tags)
+	}
+}
+
+// WithControllerName sets the name the controller sends the messages and leads the cluster as,
+// the default is the host name followed by -CONTROLLER
+func WithControllerName(name string) ControllerOption {
+	return func(c *Controller) {
+		c.name = name
+	}
+}
+
+// WithRebalanceInterval sets the interval a started controller runs its pipeline at
+// without changes of the cluster, the periodic runs are disabled if the interval is 0
+func WithRebalanceInterval(interval time.Duration) ControllerOption {
+	return func(c *Controller) {
+		c.rebalanceInterval = interval
+	}
+}
+
+// WithControllerStrictValidation validates the ideal states and instance configs read by the
+// controller, a pipeline run reading an invalid record fails with *model.ErrInvalidRecord instead
+// of acting on it. The records cached with WithCachedClusterData are not validated
+func WithControllerStrictValidation() ControllerOption {
+	return func(c *Controller) {
+		c.strictValidation = true
+	}
+}
+
+// WithControllerEventLog records the live instances going up and down, the partitions entering
+// ERROR and the maintenance mode entered and exited, as observed by the started controller
+// leading the cluster, in the EventLog, e.g. with a WebhookPublisher as sink. The state of the
+// cluster when the controller becomes the leader is not reported
+func WithControllerEventLog(eventLog *EventLog) ControllerOption {
+	return func(c *Controller) {
+		c.eventLog = eventLog
+	}
+}
+
+// NewController instantiates a Controller of the cluster
+func NewController(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	clusterName string,
+	options ...ControllerOption,
+) *Controller {
+	c := &Controller{
+		clusterName:       clusterName,
+		name:              getControllerName(),
+		rebalancers:       map[string]Rebalancer{},
+		rebalanceInterval: DefaultRebalanceInterval,
+		eventCh:           make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.logger == nil {
+		c.logger = util.LoggerFromZap(logger)
+	}
+	baseLogger := c.logger
+	c.logger = util.WithLogLevel(c.logger, LogComponentController).With(util.Field("cluster", clusterName))
+	scope = managerScope(scope, ManagerRoleController, clusterName, c.name, c.metricTags)
+	c.scope = scope.SubScope("helix.controller")
+	c.zkClient = uzk.NewClient(logger, scope, append([]uzk.ClientOption{uzk.WithLogger(baseLogger),
+		uzk.WithZkSvr(zkConnectString), uzk.WithSessionTimeout(uzk.DefaultSessionTimeout)},
+		c.zkClientOptions...)...)
+	c.dataAccessor = newDataAccessor(c.zkClient, &KeyBuilder{clusterName})
+	c.dataAccessor.strict = c.strictValidation
+	c.propertyCache = newPropertyCache(baseLogger, scope, c.zkClient, clusterName)
+	c.propertyCache.AddListener(func(PropertyType) { c.trigger() })
+	c.leaderGuard = c.newLeaderGuard()
+
+	readStage := &readClusterDataStage{accessor: c.dataAccessor}
+	if c.useCachedData {
+		readStage.propertyCache = c.propertyCache
+	}
+	stages := []PipelineStage{
+		readStage,
+		&currentStateStage{},
+		&bestPossibleStateStage{logger: c.logger, rebalancer: c.getRebalancer},
+	}
+	managedStages := append(stages[:len(stages):len(stages)],
+		&messageGenerationStage{logger: c.logger, source: c.name},
+		&messageThrottleStage{logger: c.logger},
+		&messageConstraintStage{logger: c.logger},
+		&messageDispatchStage{accessor: c.dataAccessor},
+		&externalViewStage{accessor: c.dataAccessor},
+	)
+	if c.eventLog != nil {
+		managedStages = append(managedStages, &clusterEventStage{
+			logger:      c.logger,
+			accessor:    c.dataAccessor,
+			clusterName: clusterName,
+			eventLog:    c.eventLog,
+		})
+	}
+	if len(c.customizedStateTypes) > 0 {
+		stage := &customizedViewAggregationStage{accessor: c.dataAccessor, stateTypes: c.customizedStateTypes}
+		stages = append(stages, stage)
+		managedStages = append(managedStages, stage)
+	}
+	c.pipeline = newPipeline(c.logger, c.scope, append(stages, c.stages...)...)
+	c.managedPipeline = newPipeline(c.logger, c.scope, append(managedStages, c.stages...)...)
+	return c
+}
+
+// Connect connects the controller to Zookeeper
+func (c *Controller) Connect() error {
+	if c.zkClient.IsConnected() {
+		return nil
+	}
+	if err := c.zkClient.Connect(); err != nil {
+		return errors.Wrap(err, "helix controller")
+	}
+	if c.useCachedData {
+		if err := c.propertyCache.Start(); err != nil {
+			c.zkClient.Disconnect()
+			return errors.Wrap(err, "helix controller")
+		}
+	}
+	return nil
+}
+
+// Disconnect stops the controller if started and disconnects it from Zookeeper
+func (c *Controller) Disconnect() {
+	c.Stop()
+	c.propertyCache.Stop()
+	c.zkClient.Disconnect()
+}
+
+// IsConnected checks if the controller is connected to Zookeeper
+func (c *Controller) IsConnected() bool {
+	return c.zkClient.IsConnected()
+}
+
+// DataAccessor returns the underlying accessor of the cluster data
+func (c *Controller) DataAccessor() *DataAccessor {
+	return c.dataAccessor
+}
+
+// RegisterRebalancer registers the rebalancer for the USER_DEFINED resources
+// whose REBALANCER_CLASS_NAME is the name
+func (c *Controller) RegisterRebalancer(name string, rebalancer Rebalancer) {
+	c.rebalancersMu.Lock()
+	defer c.rebalancersMu.Unlock()
+	c.rebalancers[name] = rebalancer
+}
+
+func (c *Controller) getRebalancer(name string) (Rebalancer, bool) {
+	c.rebalancersMu.RLock()
+	defer c.rebalancersMu.RUnlock()
+	rebalancer, ok := c.rebalancers[name]
+	return rebalancer, ok
+}
+
+// Rebalance runs the controller pipeline once and returns the event
+// holding the computed best possible states
+func (c *Controller) Rebalance() (*ClusterEvent, error) {
+	event := &ClusterEvent{}
+	if err := c.pipeline.Handle(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Start connects the controller and runs the controller pipeline on the changes of the cluster
+// while the controller leads the cluster, the other started controllers stand by.
+// Unlike Rebalance, the pipeline sends the state transition messages moving the partitions
+// towards their best possible states and writes the external views, so the cluster
+// needs no Java controller. The FULL_AUTO resources are placed by consistent hashing
+func (c *Controller) Start() error {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.stopCh != nil {
+		return nil
+	}
+	if err := c.Connect(); err != nil {
+		return err
+	}
+	if !c.useCachedData {
+		if err := c.propertyCache.Start(); err != nil {
+			return errors.Wrap(err, "helix controller")
+		}
+	}
+	c.stopCh = make(chan struct{})
+	c.doneCh = make(chan struct{})
+	go c.run(c.stopCh, c.doneCh)
+	if err := c.leaderGuard.Contend(); err != nil {
+		c.stop()
+		return errors.Wrap(err, "helix controller failed to contend for leadership")
+	}
+	return nil
+}
+
+// Stop stops running the pipeline and gives up the leadership of the cluster,
+// the controller stays connected
+func (c *Controller) Stop() {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	if c.stopCh == nil {
+		return
+	}
+	c.stop()
+	if err := c.leaderGuard.Release(); err != nil {
+		c.logger.Warn("failed to release the leadership", util.ErrorField(err))
+	}
+	c.setLeader(false)
+}
+
+// IsLeader returns if the started controller leads the cluster
+func (c *Controller) IsLeader() bool {
+	c.leaderMu.RLock()
+	defer c.leaderMu.RUnlock()
+	return c.isLeader
+}
+
+func (c *Controller) stop() {
+	close(c.stopCh)
+	<-c.doneCh
+	c.stopCh = nil
+	c.doneCh = nil
+	if !c.useCachedData {
+		c.propertyCache.Stop()
+	}
+}
+
+func (c *Controller) setLeader(isLeader bool) {
+	c.leaderMu.Lock()
+	defer c.leaderMu.Unlock()
+	if c.isLeader != isLeader {
+		c.logger.Info("controller leadership changed", util.Field("controller", c.name),
+			util.Field("isLeader", isLeader))
+	}
+	c.isLeader = isLeader
+	value := 0.0
+	if isLeader {
+		value = 1
+	}
+	c.scope.Gauge("leader").Update(value)
+}
+
+// newLeaderGuard creates the guard of the leader node of the cluster, the controller
+// holding the node leads the cluster
+func (c *Controller) newLeaderGuard() *uzk.EphemeralGuard {
+	data := func() ([]byte, error) {
+		return model.NewLiveInstance(c.name, c.zkClient.GetSessionID()).Marshal()
+	}
+	return uzk.NewEphemeralGuard(c.zkClient, c.dataAccessor.keyBuilder.controllerLeader(), data,
+		uzk.WithEphemeralListener(func(e uzk.EphemeralEvent) {
+			c.setLeader(e.Type == uzk.EphemeralEventCreated)
+			if e.Type == uzk.EphemeralEventCreated {
+				c.trigger()
+			}
+		}),
+	)
+}
+
+// trigger requests a run of the pipeline, the requests are coalesced while the pipeline runs
+func (c *Controller) trigger() {
+	select {
+	case c.eventCh <- struct{}{}:
+	default:
+	}
+}
+
+// run runs the pipeline on the requests and periodically while the controller leads the cluster
+func (c *Controller) run(stopCh chan struct{}, doneCh chan struct{}) {
+	defer close(doneCh)
+	var tickCh <-chan time.Time
+	if c.rebalanceInterval > 0 {
+		ticker := time.NewTicker(c.rebalanceInterval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-c.eventCh:
+		case <-tickCh:
+		}
+		if !c.IsLeader() {
+			continue
+		}
+		event := &ClusterEvent{}
+		if err := c.managedPipeline.Handle(event); err != nil {
+			c.scope.Counter("pipeline-failures").Inc(1)
+			continue
+		}
+		c.scope.Counter("messages-sent").Inc(int64(len(event.Messages)))
+	}
+}
+
+func getControllerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return hostname + "-CONTROLLER"
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// partitionReplica is a partition of a resource on an instance
+type partitionReplica struct {
+	instance  string
+	resource  string
+	partition string
+}
+
+// clusterEventStage records the changes of the cluster between the pipeline runs in the
+// EventLog, the first run only records the initial state of the cluster
+type clusterEventStage struct {
+	logger      Logger
+	accessor    *DataAccessor
+	clusterName string
+	eventLog    *EventLog
+
+	initialized   bool
+	liveInstances util.StringSet
+	errors        map[partitionReplica]struct{}
+	maintenance   bool
+}
+
+func (s *clusterEventStage) Name() string {
+	return "clusterEvent"
+}
+
+func (s *clusterEventStage) Process(event *ClusterEvent) error {
+	liveInstances := util.NewStringSet()
+	for instance := range event.Cache.LiveInstances {
+		liveInstances.Add(instance)
+	}
+	errorReplicas := map[partitionReplica]struct{}{}
+	for instance, currentStates := range event.Cache.CurrentStates {
+		for resource, currentState := range currentStates {
+			for partition, state := range currentState.GetPartitionStateMap() {
+				if state == StateModelStateError {
+					errorReplicas[partitionReplica{instance, resource, partition}] = struct{}{}
+				}
+			}
+		}
+	}
+	maintenance, reason, err := s.readMaintenance()
+	if err != nil {
+		// the other events are still recorded, the maintenance mode is read again next run
+		s.logger.Warn("failed to read the maintenance mode", util.ErrorField(err))
+		maintenance = s.maintenance
+	}
+
+	if s.initialized {
+		for instance := range liveInstances {
+			if !s.liveInstances.Contains(instance) {
+				s.record(Event{Type: EventTypeLiveInstanceUp, Instance: instance})
+			}
+		}
+		for instance := range s.liveInstances {
+			if !liveInstances.Contains(instance) {
+				s.record(Event{Type: EventTypeLiveInstanceDown, Instance: instance})
+			}
+		}
+		for replica := range errorReplicas {
+			if _, ok := s.errors[replica]; !ok {
+				s.record(Event{Type: EventTypePartitionError, Instance: replica.instance,
+					Resource: replica.resource, Partition: replica.partition, ToState: StateModelStateError})
+			}
+		}
+		if maintenance && !s.maintenance {
+			s.record(Event{Type: EventTypeMaintenanceEntered, Reason: reason})
+		} else if !maintenance && s.maintenance {
+			s.record(Event{Type: EventTypeMaintenanceExited})
+		}
+	}
+	s.initialized = true
+	s.liveInstances = liveInstances
+	s.errors = errorReplicas
+	s.maintenance = maintenance
+	return nil
+}
+
+// readMaintenance returns whether the cluster is in the maintenance mode of Java Helix or
+// frozen by a pause signal, and the reason
+func (s *clusterEventStage) readMaintenance() (bool, string, error) {
+	keyBuilder := s.accessor.KeyBuilder()
+	for _, path := range []string{keyBuilder.maintenance(), keyBuilder.pause()} {
+		record, err := s.accessor.zkClient.GetRecordFromPath(path)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return false, "", err
+		}
+		if path == keyBuilder.pause() && !(&model.PauseSignal{ZNRecord: *record}).IsClusterFreeze() {
+			// only some partitions are frozen
+			continue
+		}
+		return true, record.GetStringField(model.FieldKeyReason, ""), nil
+	}
+	return false, "", nil
+}
+
+func (s *clusterEventStage) record(e Event) {
+	e.Cluster = s.clusterName
+	s.eventLog.Record(e)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"go.uber.org/zap"
+)
+
+func TestControllerClusterEvents(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	eventLog := NewEventLog(zap.NewNop(), 10)
+	stage := &clusterEventStage{
+		logger:      util.NopLogger(),
+		accessor:    newDataAccessor(client, &KeyBuilder{TestClusterName}),
+		clusterName: TestClusterName,
+		eventLog:    eventLog,
+	}
+	cache := func(liveInstances []string, errorPartitions ...string) *ClusterEvent {
+		event := &ClusterEvent{Cache: &ClusterDataCache{
+			LiveInstances: map[string]*model.LiveInstance{},
+			CurrentStates: map[string]map[string]*model.CurrentState{},
+		}}
+		for _, instance := range liveInstances {
+			event.Cache.LiveInstances[instance] = model.NewLiveInstance(instance, "s")
+			currentState := &model.CurrentState{ZNRecord: *model.NewRecord("db")}
+			currentState.SetState("db_1", StateModelStateOnline)
+			for _, partition := range errorPartitions {
+				currentState.SetState(partition, StateModelStateError)
+			}
+			event.Cache.CurrentStates[instance] = map[string]*model.CurrentState{"db": currentState}
+		}
+		return event
+	}
+
+	// the initial state is not reported
+	require.NoError(t, stage.Process(cache([]string{"host_1", "host_2"}, "db_0")))
+	assert.Empty(t, eventLog.Events(EventQuery{}))
+
+	require.NoError(t, admin.FreezeCluster(TestClusterName, "upgrade"))
+	require.NoError(t, stage.Process(cache([]string{"host_1"}, "db_0", "db_2")))
+	require.NoError(t, admin.UnfreezeCluster(TestClusterName))
+	require.NoError(t, stage.Process(cache([]string{"host_1"}, "db_0", "db_2")))
+
+	var events []string
+	for _, e := range eventLog.Events(EventQuery{}) {
+		assert.Equal(t, TestClusterName, e.Cluster)
+		events = append(events, string(e.Type)+" "+e.Instance+" "+e.Partition+" "+e.Reason)
+	}
+	assert.Equal(t, []string{
+		"LIVE_INSTANCE_DOWN host_2  ",
+		"PARTITION_ERROR host_1 db_2 ",
+		"MAINTENANCE_ENTERED   upgrade",
+		"MAINTENANCE_EXITED   ",
+	}, events)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+// externalViewStage writes the external views of the resources from the current states of the
+// live instances, the views are only written if changed and the views of the resources without
+// ideal state nor current state are removed
+// This mirrors org.apache.helix.controller.stages.ExternalViewComputeStage
+type externalViewStage struct {
+	accessor *DataAccessor
+}
+
+func (s *externalViewStage) Name() string {
+	return "ExternalView"
+}
+
+func (s *externalViewStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil || event.CurrentStates == nil {
+		return errors.New("current states not computed")
+	}
+	views := map[string]*model.ExternalView{}
+	for resource, idealState := range event.Cache.IdealStates {
+		if idealState.GetRebalanceMode() == model.RebalanceModeTask {
+			continue
+		}
+		view := model.NewExternalView(resource)
+		if bucketSize := idealState.GetBucketSize(); bucketSize > 0 {
+			view.SetBucketSize(bucketSize)
+		}
+		view.CopyRoutingFields(idealState)
+		views[resource] = view
+	}
+	for _, resource := range event.CurrentStates.GetResources() {
+		view, ok := views[resource]
+		if !ok {
+			if _, ok := event.Cache.IdealStates[resource]; ok {
+				continue
+			}
+			view = model.NewExternalView(resource)
+			views[resource] = view
+		}
+		for partition, states := range event.CurrentStates.GetResourceMapping(resource) {
+			for instance, state := range states {
+				if state != "" && state != StateModelStateDropped {
+					view.SetState(partition, instance, state)
+				}
+			}
+		}
+	}
+
+	keyBuilder := s.accessor.KeyBuilder()
+	existing, err := s.accessor.ExternalViews()
+	if err != nil {
+		return err
+	}
+	for resource, view := range views {
+		if previous, ok := existing[resource]; ok && reflect.DeepEqual(previous.MapFields, view.MapFields) &&
+			previous.GetBucketSize() == view.GetBucketSize() && sameRoutingFields(previous, view) {
+			continue
+		}
+		if err := s.accessor.SetProperty(keyBuilder.ExternalView(resource), &view.ZNRecord); err != nil {
+			return err
+		}
+	}
+	for resource := range existing {
+		if _, ok := views[resource]; !ok {
+			if err := s.accessor.RemoveProperty(keyBuilder.ExternalView(resource)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameRoutingFields returns if the external views have the same fields copied from the ideal state
+func sameRoutingFields(a, b *model.ExternalView) bool {
+	return a.GetInstanceGroupTag() == b.GetInstanceGroupTag() &&
+		a.GetResourceGroupName() == b.GetResourceGroupName() &&
+		a.IsGroupRoutingEnabled() == b.IsGroupRoutingEnabled()
+}
@@ -0,0 +1,550 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// messageGenerationStage generates the state transition messages moving the partitions one
+// transition at a time from their current states towards the best possible states. The partitions
+// with a pending message are left alone, and the transitions that would exceed the bound of a state,
+// e.g. a second MASTER, wait for the replicas in that state to be demoted first
+// This mirrors org.apache.helix.controller.stages.MessageGenerationPhase and MessageSelectionStage
+type messageGenerationStage struct {
+	logger Logger
+	// source is the name of the controller sending the messages
+	source string
+}
+
+func (s *messageGenerationStage) Name() string {
+	return "MessageGeneration"
+}
+
+func (s *messageGenerationStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil || event.CurrentStates == nil || event.BestPossibleStates == nil {
+		return errors.New("best possible states not computed")
+	}
+	pending := s.pendingMessages(event)
+	event.pendingMessages = pending
+	pendingByPartition := map[string]map[string]*model.Message{}
+	for _, msg := range pending {
+		key := partitionKey(msg)
+		if pendingByPartition[key] == nil {
+			pendingByPartition[key] = map[string]*model.Message{}
+		}
+		pendingByPartition[key][msg.GetTargetName()] = msg
+	}
+
+	event.Messages = nil
+	resources := util.NewStringSet()
+	for resource := range event.BestPossibleStates {
+		resources.Add(resource)
+	}
+	// the replicas of the resources whose ideal state was removed are dropped
+	droppedResources := map[string]*model.IdealState{}
+	for instance, currentStates := range event.Cache.CurrentStates {
+		for resource, currentState := range currentStates {
+			if _, ok := event.Cache.IdealStates[resource]; ok {
+				continue
+			}
+			if _, ok := event.Cache.LiveInstances[instance]; !ok {
+				continue
+			}
+			idealState := model.NewIdealState(resource)
+			idealState.SetStateModelDefRef(currentState.GetStateModelDef())
+			droppedResources[resource] = idealState
+			resources.Add(resource)
+		}
+	}
+	for _, resource := range resources.ToSortedSlice() {
+		idealState, exists := event.Cache.IdealStates[resource]
+		if !exists {
+			idealState = droppedResources[resource]
+		}
+		stateModelDef, ok := event.Cache.StateModelDefs[idealState.GetStateModelDefRef()]
+		if !ok {
+			s.logger.Warn("no state model definition for resource", util.Field("resource", resource),
+				util.Field("stateModelDef", idealState.GetStateModelDefRef()))
+			continue
+		}
+		bestPossible := event.BestPossibleStates[resource]
+		currentStates := event.CurrentStates.GetResourceMapping(resource)
+		partitions := util.NewStringSet()
+		for partition := range bestPossible {
+			partitions.Add(partition)
+		}
+		for partition := range currentStates {
+			partitions.Add(partition)
+		}
+		for _, partition := range partitions.ToSortedSlice() {
+			transitions := s.partitionTransitions(event.Cache, stateModelDef, resource, partition, !exists,
+				bestPossible[partition], currentStates[partition], pendingByPartition[resource+"/"+partition])
+			for _, transition := range s.selectTransitions(
+				stateModelDef, idealState, event.Cache, currentStates[partition],
+				pendingByPartition[resource+"/"+partition], transitions) {
+				event.Messages = append(event.Messages,
+					s.newMessage(event.Cache, idealState, partition, transition))
+			}
+		}
+	}
+	return nil
+}
+
+// transition is the next transition of a replica of a partition
+type transition struct {
+	instance  string
+	fromState string
+	toState   string
+}
+
+// pendingMessages returns the state transition messages of the sessions of the live instances
+// that are not handled yet, the messages whose transition is already in the current state are
+// being deleted by the participants and are left out
+func (s *messageGenerationStage) pendingMessages(event *ClusterEvent) []*model.Message {
+	var pending []*model.Message
+	for instance, messages := range event.Cache.Messages {
+		liveInstance, ok := event.Cache.LiveInstances[instance]
+		if !ok {
+			continue
+		}
+		for _, msg := range messages {
+			if msg.GetMsgType() != MsgTypeStateTransition ||
+				msg.GetTargetSessionID() != liveInstance.GetSessionID() {
+				continue
+			}
+			partition, _ := msg.GetPartitionName()
+			if event.CurrentStates.GetState(msg.GetResourceName(), partition, instance) == msg.GetToState() {
+				continue
+			}
+			// the messages of the cache are read by the next stages and pipeline runs
+			msg = &model.Message{ZNRecord: *msg.ZNRecord.Copy()}
+			msg.SetTargetName(instance)
+			pending = append(pending, msg)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].GetCreateTimestamp() < pending[j].GetCreateTimestamp()
+	})
+	return pending
+}
+
+// partitionTransitions returns the next transitions of the replicas of the partition without
+// pending messages. The replicas left out of the best possible states are dropped, or moved to the
+// initial state if disabled unless the resource is dropped. The replicas in ERROR state are only
+// dropped and have to be reset otherwise
+func (s *messageGenerationStage) partitionTransitions(cache *ClusterDataCache, stateModelDef *model.StateModelDef,
+	resource string, partition string, resourceDropped bool, bestPossible map[string]string, currentStates map[string]string,
+	pending map[string]*model.Message) []transition {
+	instances := util.NewStringSet()
+	for instance := range bestPossible {
+		instances.Add(instance)
+	}
+	for instance := range currentStates {
+		instances.Add(instance)
+	}
+	var transitions []transition
+	for _, instance := range instances.ToSortedSlice() {
+		if _, ok := cache.LiveInstances[instance]; !ok {
+			continue
+		}
+		if _, ok := pending[instance]; ok {
+			continue
+		}
+		currentState, ok := currentStates[instance]
+		if !ok || currentState == "" {
+			currentState = stateModelDef.GetInitialState()
+		}
+		targetState, ok := bestPossible[instance]
+		if !ok {
+			targetState = StateModelStateDropped
+			if config, ok := cache.InstanceConfigs[instance]; ok && !resourceDropped &&
+				(!config.GetEnabled() || !config.IsPartitionEnabled(resource, partition)) {
+				targetState = stateModelDef.GetInitialState()
+			}
+		}
+		if currentState == targetState ||
+			(currentState == StateModelStateError && targetState != StateModelStateDropped) {
+			continue
+		}
+		nextState := stateModelDef.GetNextState(currentState, targetState)
+		if nextState == "" {
+			s.logger.Warn("no transition to the best possible state",
+				util.Field("instance", instance), util.Field("fromState", currentState),
+				util.Field("toState", targetState))
+			continue
+		}
+		transitions = append(transitions, transition{instance, currentState, nextState})
+	}
+	return transitions
+}
+
+// selectTransitions selects the transitions keeping the replicas of each state within its bound,
+// the replicas count in both their current state and the target state of their pending message
+// until the transition completes. The transitions to the states of higher priority are selected first
+func (s *messageGenerationStage) selectTransitions(stateModelDef *model.StateModelDef,
+	idealState *model.IdealState, cache *ClusterDataCache, currentStates map[string]string,
+	pending map[string]*model.Message, transitions []transition) []transition {
+	counts := map[string]int{}
+	for _, state := range currentStates {
+		counts[state]++
+	}
+	for _, msg := range pending {
+		counts[msg.GetToState()]++
+	}
+	priorities := map[string]int{}
+	for i, state := range stateModelDef.GetStatesPriorityList() {
+		priorities[state] = i
+	}
+	priority := func(state string) int {
+		if p, ok := priorities[state]; ok {
+			return p
+		}
+		return len(priorities)
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return priority(transitions[i].toState) < priority(transitions[j].toState)
+	})
+
+	var selected []transition
+	for _, t := range transitions {
+		if bound, ok := stateBound(cache, stateModelDef, idealState, t.toState); ok &&
+			counts[t.toState]+1 > bound {
+			continue
+		}
+		counts[t.toState]++
+		selected = append(selected, t)
+	}
+	return selected
+}
+
+// stateBound returns the upper bound of the replicas of a partition in the state, if any.
+// The state constraints matching the state override the count of the state model definition
+func stateBound(cache *ClusterDataCache, stateModelDef *model.StateModelDef, idealState *model.IdealState,
+	state string) (int, bool) {
+	counts := []string{stateModelDef.GetStateCount(state)}
+	if constraints, ok := cache.Constraints[model.ConstraintTypeState]; ok {
+		items := constraints.Match(map[string]string{
+			model.ConstraintAttributeState:      state,
+			model.ConstraintAttributeStateModel: stateModelDef.ID,
+			model.ConstraintAttributeResource:   idealState.GetResourceName(),
+		})
+		if len(items) > 0 {
+			counts = counts[:0]
+			for _, item := range items {
+				counts = append(counts, item.Value)
+			}
+		}
+	}
+	bound, bounded := 0, false
+	for _, count := range counts {
+		if b, ok := parseStateCount(count, idealState, len(cache.LiveInstances)); ok && (!bounded || b < bound) {
+			bound, bounded = b, true
+		}
+	}
+	return bound, bounded
+}
+
+// parseStateCount parses the count of a state: a number, "R" for the replicas or "N" for the live instances
+func parseStateCount(count string, idealState *model.IdealState, liveInstances int) (int, bool) {
+	switch count {
+	case "R":
+		if replicas := idealState.GetReplicas(); replicas > 0 {
+			return replicas, true
+		}
+		return 0, false
+	case "N":
+		return liveInstances, true
+	default:
+		bound, err := strconv.Atoi(count)
+		return bound, err == nil && bound >= 0
+	}
+}
+
+func (s *messageGenerationStage) newMessage(cache *ClusterDataCache, idealState *model.IdealState,
+	partition string, t transition) *model.Message {
+	msg := model.NewMsg(util.NewUUID())
+	msg.SetMsgType(MsgTypeStateTransition)
+	msg.SetMsgState(model.MessageStateNew)
+	msg.SetSrcName(s.source)
+	msg.SetTargetName(t.instance)
+	msg.SetTargetSessionID(cache.LiveInstances[t.instance].GetSessionID())
+	msg.SetResourceName(idealState.GetResourceName())
+	msg.SetPartitionName(partition)
+	msg.SetStateModelDef(idealState.GetStateModelDefRef())
+	msg.SetFromState(t.fromState)
+	msg.SetToState(t.toState)
+	msg.SetCreateTime(time.Now())
+	if bucketSize := idealState.GetBucketSize(); bucketSize > 0 {
+		msg.SetIntField(model.FieldKeyBucketSize, bucketSize)
+	}
+	// the transitions of a scheduled task carry the task message, mirrors MessageGenerationPhase
+	if strings.EqualFold(idealState.GetStateModelDefRef(), StateModelNameSchedulerTaskQueue) {
+		if task, ok := idealState.MapFields[partition]; ok {
+			msg.SetInnerMessage(task)
+		}
+	}
+	return msg
+}
+
+func partitionKey(msg *model.Message) string {
+	partition, _ := msg.GetPartitionName()
+	return msg.GetResourceName() + "/" + partition
+}
+
+// messageThrottleStage drops the generated messages exceeding the state transition throttles
+// of the cluster config, the pending messages count towards the partitions in transition.
+// The transitions of the partitions missing some of their best possible replicas are
+// RECOVERY_BALANCE and are selected first, the others are LOAD_BALANCE
+// This mirrors org.apache.helix.controller.stages.IntermediateStateCalcStage
+type messageThrottleStage struct {
+	logger Logger
+}
+
+func (s *messageThrottleStage) Name() string {
+	return "MessageThrottle"
+}
+
+func (s *messageThrottleStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil || event.CurrentStates == nil {
+		return errors.New("current states not computed")
+	}
+	if event.Cache.ClusterConfig == nil || len(event.Messages) == 0 {
+		return nil
+	}
+	configs := event.Cache.ClusterConfig.GetStateTransitionThrottleConfigs()
+	if len(configs) == 0 {
+		return nil
+	}
+	throttle := newTransitionThrottle(configs)
+	for _, msg := range event.pendingMessages {
+		throttle.add(msg, s.rebalanceType(event, msg))
+	}
+	var recovery, load []*model.Message
+	for _, msg := range event.Messages {
+		if s.rebalanceType(event, msg) == model.ThrottleRebalanceTypeRecoveryBalance {
+			recovery = append(recovery, msg)
+		} else {
+			load = append(load, msg)
+		}
+	}
+	var selected []*model.Message
+	for _, msg := range append(recovery, load...) {
+		rebalanceType := s.rebalanceType(event, msg)
+		if !throttle.allows(msg, rebalanceType) {
+			s.logger.Debug("state transition throttled", util.Field("resource", msg.GetResourceName()),
+				util.Field("instance", msg.GetTargetName()), util.Field("toState", msg.GetToState()))
+			continue
+		}
+		throttle.add(msg, rebalanceType)
+		selected = append(selected, msg)
+	}
+	event.Messages = selected
+	return nil
+}
+
+// rebalanceType returns RECOVERY_BALANCE if fewer replicas of the partition of the message
+// are in a best possible state than in the best possible states, LOAD_BALANCE otherwise
+func (s *messageThrottleStage) rebalanceType(event *ClusterEvent, msg *model.Message) string {
+	partition, _ := msg.GetPartitionName()
+	bestPossible := event.BestPossibleStates[msg.GetResourceName()][partition]
+	current := event.CurrentStates.GetPartitionStateMap(msg.GetResourceName(), partition)
+	matching := 0
+	for instance, state := range bestPossible {
+		if current[instance] == state {
+			matching++
+		}
+	}
+	if matching < len(bestPossible) {
+		return model.ThrottleRebalanceTypeRecoveryBalance
+	}
+	return model.ThrottleRebalanceTypeLoadBalance
+}
+
+// transitionThrottle counts the partitions in transition in the scopes of the throttle configs,
+// the partitions of the cluster and resource scopes are counted once however many replicas are
+// in transition, the instance and partition scopes count the replicas
+type transitionThrottle struct {
+	configs []model.StateTransitionThrottleConfig
+	// counts are the partitions in transition by rebalance type and scope
+	counts map[string]map[string]int
+	// partitions are the partitions in transition by rebalance type
+	partitions map[string]util.StringSet
+}
+
+func newTransitionThrottle(configs []model.StateTransitionThrottleConfig) *transitionThrottle {
+	return &transitionThrottle{
+		configs:    configs,
+		counts:     map[string]map[string]int{},
+		partitions: map[string]util.StringSet{},
+	}
+}
+
+// scope returns the scope of the config type the message counts in
+func (t *transitionThrottle) scope(configType string, msg *model.Message) string {
+	switch configType {
+	case model.ThrottleConfigTypeResource:
+		return msg.GetResourceName()
+	case model.ThrottleConfigTypeInstance:
+		return msg.GetTargetName()
+	case model.ThrottleConfigTypePartition:
+		return partitionKey(msg)
+	default:
+		return ""
+	}
+}
+
+// increment returns by how much the message increases the count of the config type
+func (t *transitionThrottle) increment(configType string, rebalanceType string, msg *model.Message) int {
+	switch configType {
+	case model.ThrottleConfigTypeCluster, model.ThrottleConfigTypeResource:
+		if partitions, ok := t.partitions[rebalanceType]; ok && partitions.Contains(partitionKey(msg)) {
+			return 0
+		}
+	}
+	return 1
+}
+
+func (t *transitionThrottle) allows(msg *model.Message, rebalanceType string) bool {
+	for _, config := range t.configs {
+		if config.RebalanceType != model.ThrottleRebalanceTypeAny && config.RebalanceType != rebalanceType {
+			continue
+		}
+		countType := config.RebalanceType
+		count := t.counts[countType][config.ConfigType+"/"+t.scope(config.ConfigType, msg)]
+		if count+t.increment(config.ConfigType, countType, msg) > config.MaxPartitionInTransition {
+			return false
+		}
+	}
+	return true
+}
+
+// add counts the message in transition for its rebalance type and for any rebalance type
+func (t *transitionThrottle) add(msg *model.Message, rebalanceType string) {
+	for _, countType := range []string{model.ThrottleRebalanceTypeAny, rebalanceType} {
+		if t.counts[countType] == nil {
+			t.counts[countType] = map[string]int{}
+			t.partitions[countType] = util.NewStringSet()
+		}
+		for _, configType := range []string{model.ThrottleConfigTypeCluster, model.ThrottleConfigTypeResource,
+			model.ThrottleConfigTypeInstance, model.ThrottleConfigTypePartition} {
+			t.counts[countType][configType+"/"+t.scope(configType, msg)] += t.increment(configType, countType, msg)
+		}
+		t.partitions[countType].Add(partitionKey(msg))
+	}
+}
+
+// messageConstraintStage drops the generated messages exceeding the message constraints of the
+// cluster, the pending messages count towards the constraints but are not dropped
+// This mirrors org.apache.helix.controller.stages.MessageThrottleStage
+type messageConstraintStage struct {
+	logger Logger
+}
+
+func (s *messageConstraintStage) Name() string {
+	return "MessageConstraint"
+}
+
+func (s *messageConstraintStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil {
+		return errors.New("cluster data cache not loaded")
+	}
+	constraints, ok := event.Cache.Constraints[model.ConstraintTypeMessage]
+	if !ok || len(event.Messages) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, msg := range event.pendingMessages {
+		attributes := messageConstraintAttributes(msg)
+		for _, item := range constraints.Match(attributes) {
+			counts[item.Scope(attributes)]++
+		}
+	}
+	var selected []*model.Message
+	for _, msg := range event.Messages {
+		attributes := messageConstraintAttributes(msg)
+		items := constraints.Match(attributes)
+		if !allowedByConstraints(items, attributes, counts) {
+			s.logger.Debug("message exceeds constraints", util.Field("resource", msg.GetResourceName()),
+				util.Field("instance", msg.GetTargetName()), util.Field("toState", msg.GetToState()))
+			continue
+		}
+		for _, item := range items {
+			counts[item.Scope(attributes)]++
+		}
+		selected = append(selected, msg)
+	}
+	event.Messages = selected
+	return nil
+}
+
+// allowedByConstraints returns if one more message of the attributes stays within the values
+// of the constraint items, the items whose value is not a number do not constrain the messages
+func allowedByConstraints(items []model.ConstraintItem, attributes map[string]string, counts map[string]int) bool {
+	for _, item := range items {
+		limit, err := strconv.Atoi(item.Value)
+		if err != nil {
+			continue
+		}
+		if counts[item.Scope(attributes)]+1 > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// messageConstraintAttributes returns the attributes of the message the constraint items match
+func messageConstraintAttributes(msg *model.Message) map[string]string {
+	partition, _ := msg.GetPartitionName()
+	return map[string]string{
+		model.ConstraintAttributeMessageType: msg.GetMsgType(),
+		model.ConstraintAttributeTransition:  msg.GetFromState() + "-" + msg.GetToState(),
+		model.ConstraintAttributeInstance:    msg.GetTargetName(),
+		model.ConstraintAttributeResource:    msg.GetResourceName(),
+		model.ConstraintAttributePartition:   partition,
+		model.ConstraintAttributeStateModel:  msg.GetStateModelDef(),
+	}
+}
+
+// messageDispatchStage sends the generated messages to the participants
+type messageDispatchStage struct {
+	accessor *DataAccessor
+}
+
+func (s *messageDispatchStage) Name() string {
+	return "MessageDispatch"
+}
+
+func (s *messageDispatchStage) Process(event *ClusterEvent) error {
+	for _, msg := range event.Messages {
+		if err := s.accessor.CreateParticipantMsg(msg.GetTargetName(), msg); err != nil {
+			return errors.Wrapf(err, "failed to send message to %s", msg.GetTargetName())
+		}
+	}
+	return nil
+}
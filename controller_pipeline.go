@@ -0,0 +1,384 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// ClusterDataCache is the snapshot of the cluster data the pipeline stages work on
+// This mirrors org.apache.helix.controller.stages.ClusterDataCache
+type ClusterDataCache struct {
+	LiveInstances   map[string]*model.LiveInstance
+	InstanceConfigs map[string]*model.InstanceConfig
+	IdealStates     map[string]*model.IdealState
+	StateModelDefs  map[string]*model.StateModelDef
+	// CurrentStates of the sessions of the live instances, instance->resource->current state
+	CurrentStates map[string]map[string]*model.CurrentState
+	// Messages of the live instances, instance->message ID->message, they are read before the
+	// current states so the handled messages are either gone or in the current states
+	Messages map[string]map[string]*model.Message
+	// ClusterConfig is nil if the cluster has no config
+	ClusterConfig *model.ClusterConfig
+	// Constraints of the cluster by constraint type, e.g. model.ConstraintTypeMessage
+	Constraints map[string]*model.ClusterConstraints
+	// InstanceLoads are the load reports of the live instances publishing one, by instance
+	InstanceLoads map[string]*model.InstanceLoad
+}
+
+// loadClusterDataCache reads the cluster data from Zookeeper
+func loadClusterDataCache(accessor *DataAccessor) (*ClusterDataCache, error) {
+	var err error
+	cache := &ClusterDataCache{CurrentStates: map[string]map[string]*model.CurrentState{}}
+	if cache.LiveInstances, err = accessor.LiveInstances(); err != nil {
+		return nil, err
+	}
+	if cache.InstanceConfigs, err = accessor.InstanceConfigs(); err != nil {
+		return nil, err
+	}
+	if cache.IdealStates, err = accessor.IdealStates(); err != nil {
+		return nil, err
+	}
+	if cache.StateModelDefs, err = accessor.StateModelDefs(); err != nil {
+		return nil, err
+	}
+	if cache.Messages, err = readMessages(accessor, cache.LiveInstances); err != nil {
+		return nil, err
+	}
+	for instance, liveInstance := range cache.LiveInstances {
+		currentStates, err := accessor.CurrentStates(instance, liveInstance.GetSessionID())
+		if err != nil {
+			return nil, err
+		}
+		cache.CurrentStates[instance] = currentStates
+	}
+	if cache.ClusterConfig, err = readClusterConfig(accessor); err != nil {
+		return nil, err
+	}
+	if cache.Constraints, err = readConstraints(accessor); err != nil {
+		return nil, err
+	}
+	if cache.InstanceLoads, err = readInstanceLoads(accessor, cache.LiveInstances); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// readConstraints returns the constraints of the cluster by constraint type
+func readConstraints(accessor *DataAccessor) (map[string]*model.ClusterConstraints, error) {
+	result := map[string]*model.ClusterConstraints{}
+	for _, constraintType := range []string{model.ConstraintTypeMessage, model.ConstraintTypeState} {
+		constraints, err := accessor.Constraints(constraintType)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[constraintType] = constraints
+	}
+	return result, nil
+}
+
+// readMessages returns the messages of the instances by instance and message ID
+func readMessages(accessor *DataAccessor, instances map[string]*model.LiveInstance) (
+	map[string]map[string]*model.Message, error) {
+	messages := make(map[string]map[string]*model.Message, len(instances))
+	for instance := range instances {
+		records, err := accessor.ChildValues(accessor.KeyBuilder().Messages(instance))
+		if err != nil {
+			return nil, err
+		}
+		messages[instance] = make(map[string]*model.Message, len(records))
+		for id, record := range records {
+			messages[instance][id] = &model.Message{ZNRecord: *record}
+		}
+	}
+	return messages, nil
+}
+
+// readClusterConfig returns the config of the cluster, or nil if it does not exist
+func readClusterConfig(accessor *DataAccessor) (*model.ClusterConfig, error) {
+	config, err := accessor.ClusterConfig()
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	}
+	return config, err
+}
+
+// GetEnabledLiveInstances returns the sorted names of the live instances
+// that are enabled in their instance configs
+func (c *ClusterDataCache) GetEnabledLiveInstances() []string {
+	var instances []string
+	for instance := range c.LiveInstances {
+		if config, ok := c.InstanceConfigs[instance]; ok && config.GetEnabled() {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Strings(instances)
+	return instances
+}
+
+// ClusterEvent carries the data through the stages of a pipeline run
+type ClusterEvent struct {
+	Cache         *ClusterDataCache
+	CurrentStates *CurrentStateOutput
+	// BestPossibleStates are the placements computed for the resources by resource name
+	BestPossibleStates map[string]ResourceMapping
+	// Messages are the state transition messages generated towards the best possible states,
+	// only set by the pipeline of a started controller
+	Messages []*model.Message
+	// pendingMessages are the state transition messages sent before and not handled yet
+	pendingMessages []*model.Message
+}
+
+// PipelineStage is a step of the controller pipeline
+// This mirrors org.apache.helix.controller.pipeline.Stage
+type PipelineStage interface {
+	Name() string
+	Process(event *ClusterEvent) error
+}
+
+// Pipeline runs the stages in order for each cluster event
+type Pipeline struct {
+	logger Logger
+	scope  tally.Scope
+	stages []PipelineStage
+}
+
+// NewPipeline creates a Pipeline of the stages
+func NewPipeline(logger *zap.Logger, scope tally.Scope, stages ...PipelineStage) *Pipeline {
+	return newPipeline(util.LoggerFromZap(logger), scope, stages...)
+}
+
+func newPipeline(logger Logger, scope tally.Scope, stages ...PipelineStage) *Pipeline {
+	return &Pipeline{logger: logger, scope: scope, stages: stages}
+}
+
+// Handle runs the stages for the event, it stops at the first stage returning an error
+func (p *Pipeline) Handle(event *ClusterEvent) error {
+	for _, stage := range p.stages {
+		sw := p.scope.Tagged(map[string]string{"stage": stage.Name()}).Timer("stage-latency").Start()
+		err := stage.Process(event)
+		sw.Stop()
+		if err != nil {
+			p.logger.Error("pipeline stage failed", util.Field("stage", stage.Name()), util.ErrorField(err))
+			return errors.Wrapf(err, "pipeline stage %s", stage.Name())
+		}
+	}
+	return nil
+}
+
+// readClusterDataStage fills the cache of the event with the cluster data in Zookeeper,
+// the data kept by the property cache is taken from the cache if it is set
+type readClusterDataStage struct {
+	accessor      *DataAccessor
+	propertyCache *PropertyCache
+}
+
+func (s *readClusterDataStage) Name() string {
+	return "ReadClusterData"
+}
+
+func (s *readClusterDataStage) Process(event *ClusterEvent) error {
+	if s.propertyCache != nil {
+		stateModelDefs, err := s.accessor.StateModelDefs()
+		if err != nil {
+			return err
+		}
+		clusterConfig, err := readClusterConfig(s.accessor)
+		if err != nil {
+			return err
+		}
+		constraints, err := readConstraints(s.accessor)
+		if err != nil {
+			return err
+		}
+		liveInstances := s.propertyCache.LiveInstances()
+		messages, err := readMessages(s.accessor, liveInstances)
+		if err != nil {
+			return err
+		}
+		instanceLoads, err := readInstanceLoads(s.accessor, liveInstances)
+		if err != nil {
+			return err
+		}
+		event.Cache = &ClusterDataCache{
+			LiveInstances:   liveInstances,
+			Messages:        messages,
+			InstanceConfigs: s.propertyCache.InstanceConfigs(),
+			IdealStates:     s.propertyCache.IdealStates(),
+			StateModelDefs:  stateModelDefs,
+			CurrentStates:   s.propertyCache.CurrentStates(),
+			ClusterConfig:   clusterConfig,
+			Constraints:     constraints,
+			InstanceLoads:   instanceLoads,
+		}
+		return nil
+	}
+	cache, err := loadClusterDataCache(s.accessor)
+	if err != nil {
+		return err
+	}
+	event.Cache = cache
+	return nil
+}
+
+// currentStateStage collects the current states of the live instances
+type currentStateStage struct{}
+
+func (s *currentStateStage) Name() string {
+	return "CurrentState"
+}
+
+func (s *currentStateStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil {
+		return errors.New("cluster data cache not loaded")
+	}
+	output := NewCurrentStateOutput()
+	for instance, currentStates := range event.Cache.CurrentStates {
+		for resource, currentState := range currentStates {
+			for partition, state := range currentState.GetPartitionStateMap() {
+				output.SetState(resource, partition, instance, state)
+			}
+		}
+	}
+	event.CurrentStates = output
+	return nil
+}
+
+// bestPossibleStateStage computes the placements of the resources, the USER_DEFINED resources
+// are placed by the registered rebalancers and the others as by the default Helix rebalancers
+type bestPossibleStateStage struct {
+	logger     Logger
+	rebalancer func(name string) (Rebalancer, bool)
+}
+
+func (s *bestPossibleStateStage) Name() string {
+	return "BestPossibleState"
+}
+
+func (s *bestPossibleStateStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil || event.CurrentStates == nil {
+		return errors.New("current states not computed")
+	}
+	event.BestPossibleStates = map[string]ResourceMapping{}
+	for resource, idealState := range event.Cache.IdealStates {
+		if idealState.GetRebalanceMode() == model.RebalanceModeTask {
+			continue
+		}
+		mapping, err := computeBestPossibleMapping(idealState, event.Cache, event.CurrentStates, s.rebalancer)
+		if err != nil {
+			// a failing resource is left as is and does not block the other resources
+			s.logger.Error("failed to compute best possible states of resource",
+				util.Field("resource", resource), util.ErrorField(err))
+			continue
+		}
+		event.BestPossibleStates[resource] = mapping
+	}
+	return nil
+}
+
+// computeBestPossibleMapping computes the mapping the controller converges the resource to,
+// the FULL_AUTO resources are placed by consistent hashing on the enabled live instances
+// with the instance group tag of the resource
+// This mirrors org.apache.helix.controller.rebalancer.AbstractRebalancer
+func computeBestPossibleMapping(idealState *model.IdealState, cache *ClusterDataCache,
+	currentStates *CurrentStateOutput, getRebalancer func(name string) (Rebalancer, bool)) (
+	ResourceMapping, error) {
+	resource := idealState.GetResourceName()
+	if idealState.GetRebalanceMode() == model.RebalanceModeUserDefined {
+		name := idealState.GetRebalancerClassName()
+		rebalancer, ok := getRebalancer(name)
+		if !ok {
+			return nil, errors.Errorf("no rebalancer %s registered for resource %s", name, resource)
+		}
+		return rebalancer.ComputeNewIdealState(resource, cache, currentStates)
+	}
+	stateModelDef, ok := cache.StateModelDefs[idealState.GetStateModelDefRef()]
+	if !ok {
+		return nil, errors.Wrapf(ErrStateModelDefNotExist, "resource %s", resource)
+	}
+	mapping := ResourceMapping{}
+	if !idealState.IsEnabled() {
+		return mapping, nil
+	}
+	liveInstances := cache.GetEnabledLiveInstances()
+	enabled := util.NewStringSet(liveInstances...)
+	assignable := func(instance string, partition string) bool {
+		return enabled.Contains(instance) && cache.InstanceConfigs[instance].IsPartitionEnabled(resource, partition)
+	}
+
+	switch idealState.GetRebalanceMode() {
+	case model.RebalanceModeCustomized:
+		for _, partition := range idealState.GetPartitionSet() {
+			for instance, state := range idealState.MapFields[partition] {
+				if assignable(instance, partition) {
+					mapping.SetState(partition, instance, state)
+				}
+			}
+		}
+		return mapping, nil
+	case model.RebalanceModeFullAuto:
+		var instances []*model.InstanceConfig
+		for _, instance := range liveInstances {
+			config := cache.InstanceConfigs[instance]
+			if tag := idealState.GetInstanceGroupTag(); tag == "" || config.ContainsTag(tag) {
+				instances = append(instances, config)
+			}
+		}
+		replicas := idealState.GetReplicas()
+		if replicas <= 0 || replicas > len(instances) {
+			replicas = len(instances)
+		}
+		preferenceLists := ConsistentHashingStrategy{}.ComputePreferenceLists(
+			idealState.GetPartitionSet(), instances, replicas)
+		for partition, preferenceList := range preferenceLists {
+			assignPartition(mapping, stateModelDef, partition, preferenceList, assignable, len(liveInstances))
+		}
+	default:
+		for _, partition := range idealState.GetPartitionSet() {
+			assignPartition(mapping, stateModelDef, partition, idealState.GetPreferenceList(partition),
+				assignable, len(liveInstances))
+		}
+	}
+	return mapping, nil
+}
+
+// assignPartition assigns the states of the partition to the assignable instances of the preference list
+func assignPartition(mapping ResourceMapping, stateModelDef *model.StateModelDef, partition string,
+	preferenceList []string, assignable func(instance string, partition string) bool, liveInstances int) {
+	var instances []string
+	for _, instance := range preferenceList {
+		if assignable(instance, partition) {
+			instances = append(instances, instance)
+		}
+	}
+	for instance, state := range assignStates(stateModelDef, instances, len(preferenceList), liveInstances) {
+		mapping.SetState(partition, instance, state)
+	}
+}
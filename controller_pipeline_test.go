@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func newTestClusterDataCache() *ClusterDataCache {
+	cache := &ClusterDataCache{
+		LiveInstances:   map[string]*model.LiveInstance{},
+		InstanceConfigs: map[string]*model.InstanceConfig{},
+		IdealStates:     map[string]*model.IdealState{},
+		StateModelDefs:  map[string]*model.StateModelDef{},
+		CurrentStates:   map[string]map[string]*model.CurrentState{},
+	}
+	for _, instance := range []string{"i1", "i2", "i3"} {
+		cache.LiveInstances[instance] = model.NewLiveInstance(instance, "session")
+		config := model.NewInstanceConfig(instance)
+		config.SetEnabled(instance != "i3")
+		cache.InstanceConfigs[instance] = config
+	}
+	currentState := &model.CurrentState{ZNRecord: *model.NewRecord("r1")}
+	currentState.SetState("r1_0", StateModelStateOnline)
+	cache.CurrentStates["i1"] = map[string]*model.CurrentState{"r1": currentState}
+	return cache
+}
+
+func TestClusterDataCacheEnabledLiveInstances(t *testing.T) {
+	cache := newTestClusterDataCache()
+	assert.Equal(t, []string{"i1", "i2"}, cache.GetEnabledLiveInstances())
+}
+
+func TestPipelineBestPossibleState(t *testing.T) {
+	cache := newTestClusterDataCache()
+	for _, resource := range []string{"r1", "r2", "r3"} {
+		idealState := model.NewIdealState(resource)
+		idealState.SetNumPartitions(2)
+		idealState.SetRebalanceMode(model.RebalanceModeUserDefined)
+		idealState.SetRebalancerClassName(resource)
+		cache.IdealStates[resource] = idealState
+	}
+	cache.IdealStates["r3"].SetRebalanceMode(model.RebalanceModeSemiAuto)
+
+	rebalancers := map[string]Rebalancer{
+		// places the partitions round robin on the enabled instances, keeping the current states
+		"r1": RebalancerFunc(func(resource string, cache *ClusterDataCache,
+			currentStates *CurrentStateOutput) (ResourceMapping, error) {
+			mapping := ResourceMapping{}
+			instances := cache.GetEnabledLiveInstances()
+			for i, partition := range cache.IdealStates[resource].GetPartitionSet() {
+				instance := instances[i%len(instances)]
+				assert.Equal(t, currentStates.GetState(resource, partition, instance),
+					currentStates.GetPartitionStateMap(resource, partition)[instance])
+				mapping.SetState(partition, instance, StateModelStateOnline)
+			}
+			return mapping, nil
+		}),
+		"r2": RebalancerFunc(func(string, *ClusterDataCache, *CurrentStateOutput) (ResourceMapping, error) {
+			return nil, errors.New("rebalancer failed")
+		}),
+		"r3": RebalancerFunc(func(string, *ClusterDataCache, *CurrentStateOutput) (ResourceMapping, error) {
+			assert.Fail(t, "rebalancer of a SEMI_AUTO resource should not be called")
+			return nil, nil
+		}),
+	}
+	getRebalancer := func(name string) (Rebalancer, bool) {
+		rebalancer, ok := rebalancers[name]
+		return rebalancer, ok
+	}
+	pipeline := NewPipeline(zap.NewNop(), tally.NoopScope,
+		&currentStateStage{},
+		&bestPossibleStateStage{logger: util.NopLogger(), rebalancer: getRebalancer},
+	)
+	event := &ClusterEvent{Cache: cache}
+	assert.NoError(t, pipeline.Handle(event))
+	assert.Equal(t, []string{"r1"}, event.CurrentStates.GetResources())
+	assert.Equal(t, StateModelStateOnline, event.CurrentStates.GetState("r1", "r1_0", "i1"))
+	assert.Equal(t, map[string]ResourceMapping{
+		"r1": {
+			"r1_0": {"i1": StateModelStateOnline},
+			"r1_1": {"i2": StateModelStateOnline},
+		},
+	}, event.BestPossibleStates)
+}
+
+func TestPipelineStopsAtFailedStage(t *testing.T) {
+	pipeline := NewPipeline(zap.NewNop(), tally.NoopScope,
+		&bestPossibleStateStage{logger: util.NopLogger()},
+		&currentStateStage{},
+	)
+	event := &ClusterEvent{}
+	assert.Error(t, pipeline.Handle(event))
+	assert.Nil(t, event.CurrentStates)
+}
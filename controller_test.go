@@ -0,0 +1,295 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestControllerManagesCluster(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin, keyBuilder, accessor := cluster.admin, cluster.keyBuilder, cluster.accessor
+	instances := []string{"localhost_1", "localhost_2"}
+	for _, instance := range instances {
+		assert.NoError(t, admin.AddNode(TestClusterName, instance))
+		assert.NoError(t, admin.EnableInstance(TestClusterName, instance))
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance(instance),
+			model.NewLiveInstance(instance, "s").ZNRecord))
+	}
+	idealState := model.NewIdealState("r1")
+	idealState.SetRebalanceMode(model.RebalanceModeFullAuto)
+	idealState.SetStateModelDefRef("MasterSlave")
+	idealState.SetNumPartitions(2)
+	idealState.SetReplicas(2)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r1"), &idealState.ZNRecord))
+
+	newController := func(name string) *Controller {
+		return NewController(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+			WithControllerName(name), WithRebalanceInterval(20*time.Millisecond),
+			WithControllerZkClientOptions(cluster.zkClientOptions()...))
+	}
+	leader := newController("c1")
+	assert.NoError(t, leader.Start())
+	defer leader.Disconnect()
+	assert.True(t, leader.IsLeader())
+	standby := newController("c2")
+	assert.NoError(t, standby.Start())
+	defer standby.Disconnect()
+	assert.False(t, standby.IsLeader())
+
+	// the participants are simulated by applying the messages to the current states
+	converge := func(expected map[string]map[string]string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			applyTestMessages(t, accessor, instances)
+			views, err := accessor.ExternalViews()
+			assert.NoError(t, err)
+			actual := map[string]map[string]string{}
+			if view, ok := views["r1"]; ok {
+				actual = view.MapFields
+			}
+			if len(expected) == len(actual) && assert.ObjectsAreEqual(expected, actual) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		views, _ := accessor.ExternalViews()
+		assert.FailNow(t, "external view not converged", "expected %v, external views %v", expected, views)
+	}
+	converge(map[string]map[string]string{
+		"r1_0": {"localhost_1": "SLAVE", "localhost_2": "MASTER"},
+		"r1_1": {"localhost_1": "SLAVE", "localhost_2": "MASTER"},
+	})
+
+	// the standby takes over and moves the replicas off the disabled instance
+	leader.Stop()
+	assert.NoError(t, admin.DisableInstance(TestClusterName, "localhost_1"))
+	converge(map[string]map[string]string{
+		"r1_0": {"localhost_1": "OFFLINE", "localhost_2": "MASTER"},
+		"r1_1": {"localhost_1": "OFFLINE", "localhost_2": "MASTER"},
+	})
+	assert.True(t, standby.IsLeader())
+	assert.False(t, leader.IsLeader())
+
+	// the replicas of the removed resource are dropped
+	assert.NoError(t, accessor.RemoveProperty(keyBuilder.IdealState("r1")))
+	converge(map[string]map[string]string{})
+	views, err := accessor.ExternalViews()
+	assert.NoError(t, err)
+	assert.Empty(t, views)
+}
+
+// applyTestMessages handles the pending messages of the instances like the participants,
+// it fails the test if a partition gets more than one MASTER
+func applyTestMessages(t *testing.T, accessor *DataAccessor, instances []string) {
+	keyBuilder := accessor.KeyBuilder()
+	for _, instance := range instances {
+		records, err := accessor.ChildValues(keyBuilder.Messages(instance))
+		assert.NoError(t, err)
+		for _, record := range records {
+			msg := &model.Message{ZNRecord: *record}
+			partition, _ := msg.GetPartitionName()
+			key := keyBuilder.CurrentState(instance, msg.GetTargetSessionID(), msg.GetResourceName())
+			assert.NoError(t, accessor.UpdateProperty(key, func(record *model.ZNRecord) (*model.ZNRecord, error) {
+				if record == nil {
+					record = &model.NewCurrentStateFromMsg(msg, msg.GetResourceName(), msg.GetTargetSessionID()).ZNRecord
+				}
+				currentState := &model.CurrentState{ZNRecord: *record}
+				fromState := currentState.GetState(partition)
+				if fromState == "" {
+					fromState = StateModelStateOffline
+				}
+				assert.Equal(t, msg.GetFromState(), fromState)
+				if msg.GetToState() == StateModelStateDropped {
+					delete(currentState.MapFields, partition)
+				} else {
+					currentState.SetState(partition, msg.GetToState())
+				}
+				return &currentState.ZNRecord, nil
+			}))
+			assert.NoError(t, accessor.RemoveProperty(keyBuilder.Message(instance, msg.ID)))
+		}
+	}
+	currentStates := NewCurrentStateOutput()
+	for _, instance := range instances {
+		states, err := accessor.CurrentStates(instance, "s")
+		assert.NoError(t, err)
+		for resource, currentState := range states {
+			for partition, state := range currentState.GetPartitionStateMap() {
+				currentStates.SetState(resource, partition, instance, state)
+			}
+		}
+	}
+	for _, resource := range currentStates.GetResources() {
+		for partition, states := range currentStates.GetResourceMapping(resource) {
+			masters := 0
+			for _, state := range states {
+				if state == "MASTER" {
+					masters++
+				}
+			}
+			assert.True(t, masters <= 1, "partition %s has %d masters", partition, masters)
+		}
+	}
+}
+
+func TestMessageThrottleStage(t *testing.T) {
+	cache := newTestClusterDataCache()
+	cache.ClusterConfig = model.NewClusterConfig(TestClusterName)
+	assert.NoError(t, cache.ClusterConfig.SetStateTransitionThrottleConfigs([]model.StateTransitionThrottleConfig{
+		{RebalanceType: model.ThrottleRebalanceTypeAny, ConfigType: model.ThrottleConfigTypeInstance,
+			MaxPartitionInTransition: 1},
+		{RebalanceType: model.ThrottleRebalanceTypeLoadBalance, ConfigType: model.ThrottleConfigTypeCluster,
+			MaxPartitionInTransition: 1},
+	}))
+	newMsg := func(instance string, partition string, toState string) *model.Message {
+		msg := model.NewMsg(instance + partition)
+		msg.SetTargetName(instance)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetToState(toState)
+		return msg
+	}
+	event := &ClusterEvent{
+		Cache:         cache,
+		CurrentStates: NewCurrentStateOutput(),
+		BestPossibleStates: map[string]ResourceMapping{"r1": {
+			"r1_0": {"i1": StateModelStateOnline},
+			"r1_1": {"i2": StateModelStateOnline},
+			"r1_2": {"i3": StateModelStateOnline},
+			"r1_3": {"i3": StateModelStateOnline},
+			"r1_4": {"i1": StateModelStateOnline},
+		}},
+		pendingMessages: []*model.Message{newMsg("i1", "r1_4", StateModelStateOnline)},
+	}
+	for _, partition := range []string{"r1_2", "r1_3"} {
+		event.CurrentStates.SetState("r1", partition, "i3", StateModelStateOnline)
+	}
+	event.CurrentStates.SetState("r1", "r1_2", "i4", StateModelStateOnline)
+	event.CurrentStates.SetState("r1", "r1_3", "i5", StateModelStateOnline)
+	event.Messages = []*model.Message{
+		// throttled by the pending message of the instance
+		newMsg("i1", "r1_0", StateModelStateOnline),
+		// the second load balance message is throttled by the cluster limit
+		newMsg("i4", "r1_2", StateModelStateOffline),
+		newMsg("i5", "r1_3", StateModelStateOffline),
+		// the recovery is selected first
+		newMsg("i2", "r1_1", StateModelStateOnline),
+	}
+	assert.NoError(t, (&messageThrottleStage{logger: util.NopLogger()}).Process(event))
+	var selected []string
+	for _, msg := range event.Messages {
+		selected = append(selected, msg.ID)
+	}
+	assert.Equal(t, []string{"i2r1_1", "i4r1_2"}, selected)
+}
+
+func TestPendingMessagesDoNotModifyCache(t *testing.T) {
+	cache := newTestClusterDataCache()
+	msg := model.NewMsg("m1")
+	msg.SetMsgType(MsgTypeStateTransition)
+	msg.SetTargetSessionID("session")
+	msg.SetResourceName("r1")
+	msg.SetPartitionName("r1_1")
+	msg.SetToState(StateModelStateOnline)
+	cache.Messages = map[string]map[string]*model.Message{"i2": {msg.ID: msg}}
+	event := &ClusterEvent{Cache: cache, CurrentStates: NewCurrentStateOutput()}
+
+	pending := (&messageGenerationStage{logger: util.NopLogger()}).pendingMessages(event)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "i2", pending[0].GetTargetName())
+	// the cached message is read again by the next pipeline runs
+	assert.Empty(t, cache.Messages["i2"]["m1"].GetTargetName())
+}
+
+func TestMessageConstraintStage(t *testing.T) {
+	cache := newTestClusterDataCache()
+	constraints := model.NewClusterConstraints(model.ConstraintTypeMessage)
+	constraints.SetConstraintItem("perInstance", model.ConstraintItem{
+		Attributes: map[string]string{
+			model.ConstraintAttributeMessageType: MsgTypeStateTransition,
+			model.ConstraintAttributeInstance:    ".*",
+		},
+		Value: "1",
+	})
+	cache.Constraints = map[string]*model.ClusterConstraints{model.ConstraintTypeMessage: constraints}
+	newMsg := func(instance string, partition string) *model.Message {
+		msg := model.NewMsg(instance + partition)
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetTargetName(instance)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetToState(StateModelStateOnline)
+		return msg
+	}
+	event := &ClusterEvent{
+		Cache:           cache,
+		pendingMessages: []*model.Message{newMsg("i1", "r1_0")},
+		Messages: []*model.Message{
+			// exceeds the constraint with the pending message of the instance
+			newMsg("i1", "r1_1"),
+			newMsg("i2", "r1_2"),
+			newMsg("i2", "r1_3"),
+		},
+	}
+	assert.NoError(t, (&messageConstraintStage{logger: util.NopLogger()}).Process(event))
+	var selected []string
+	for _, msg := range event.Messages {
+		selected = append(selected, msg.ID)
+	}
+	assert.Equal(t, []string{"i2r1_2"}, selected)
+}
+
+func TestStateConstraintBound(t *testing.T) {
+	cache := newTestClusterDataCache()
+	stateModelDef := &model.StateModelDef{ZNRecord: *model.NewRecord("MasterSlave")}
+	stateModelDef.SetMapField("MASTER.meta", "count", "1")
+	stateModelDef.SetMapField("SLAVE.meta", "count", "R")
+	idealState := model.NewIdealState("r1")
+	idealState.SetReplicas(3)
+	bound, ok := stateBound(cache, stateModelDef, idealState, "SLAVE")
+	assert.True(t, ok)
+	assert.Equal(t, 3, bound)
+
+	constraints := model.NewClusterConstraints(model.ConstraintTypeState)
+	constraints.SetConstraintItem("slaves", model.ConstraintItem{
+		Attributes: map[string]string{
+			model.ConstraintAttributeState:    "SLAVE",
+			model.ConstraintAttributeResource: "r1",
+		},
+		Value: "N",
+	})
+	cache.Constraints = map[string]*model.ClusterConstraints{model.ConstraintTypeState: constraints}
+	bound, ok = stateBound(cache, stateModelDef, idealState, "SLAVE")
+	assert.True(t, ok)
+	assert.Equal(t, len(cache.LiveInstances), bound)
+	bound, ok = stateBound(cache, stateModelDef, idealState, "MASTER")
+	assert.True(t, ok)
+	assert.Equal(t, 1, bound)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+)
+
+// currentStateUpdate is the change of a partition in the current state of a resource,
+// the partition is removed if fields is nil
+type currentStateUpdate struct {
+	partition string
+	fields    map[string]string
+	done      chan error
+}
+
+// currentStateBatcher merges the updates of the current state of a resource made within a window
+// into a single read-modify-write of the znode, e.g. when many partitions of a resource transition
+// at the same time. The callers are blocked until their update is written
+type currentStateBatcher struct {
+	scope    tally.Scope
+	accessor *DataAccessor
+	window   time.Duration
+
+	mu sync.Mutex
+	// path of the current state -> updates to write
+	pending map[string][]*currentStateUpdate
+}
+
+func newCurrentStateBatcher(
+	scope tally.Scope, accessor *DataAccessor, window time.Duration) *currentStateBatcher {
+	return &currentStateBatcher{
+		scope:    scope,
+		accessor: accessor,
+		window:   window,
+		pending:  make(map[string][]*currentStateUpdate),
+	}
+}
+
+// update sets fields of partition in the current state at path,
+// the current state is not created if missing
+func (b *currentStateBatcher) update(path string, partition string, fields map[string]string) error {
+	return b.add(path, &currentStateUpdate{partition: partition, fields: fields, done: make(chan error, 1)})
+}
+
+// remove removes partition from the current state at path
+func (b *currentStateBatcher) remove(path string, partition string) error {
+	return b.add(path, &currentStateUpdate{partition: partition, done: make(chan error, 1)})
+}
+
+func (b *currentStateBatcher) add(path string, update *currentStateUpdate) error {
+	b.mu.Lock()
+	updates, scheduled := b.pending[path]
+	b.pending[path] = append(updates, update)
+	if !scheduled {
+		time.AfterFunc(b.window, func() {
+			b.flush(path)
+		})
+	}
+	b.mu.Unlock()
+	return <-update.done
+}
+
+// flush writes the pending updates of path in one update of the znode
+func (b *currentStateBatcher) flush(path string) {
+	b.mu.Lock()
+	updates := b.pending[path]
+	delete(b.pending, path)
+	b.mu.Unlock()
+
+	err := b.accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		if data == nil {
+			return nil, errors.Wrapf(zk.ErrNoNode, "current state %s does not exist", path)
+		}
+		for _, update := range updates {
+			if update.fields == nil {
+				data.RemoveMapField(update.partition)
+				continue
+			}
+			for key, value := range update.fields {
+				data.SetMapField(update.partition, key, value)
+			}
+		}
+		return data, nil
+	})
+	b.scope.Counter("current-state-writes").Inc(1)
+	b.scope.Counter("current-state-updates").Inc(int64(len(updates)))
+	for _, update := range updates {
+		update.done <- err
+	}
+}
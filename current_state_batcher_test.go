@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+)
+
+func TestCurrentStateBatcher(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, keyBuilder, accessor := cluster.client, cluster.keyBuilder, cluster.accessor
+	path := keyBuilder.currentStateForResource("i1", "s1", "r1")
+	currentState := &model.CurrentState{ZNRecord: *model.NewRecord("r1")}
+	currentState.SetState("r1_0", StateModelStateOnline)
+	assert.NoError(t, client.CreateDataWithPath(path, nil))
+	assert.NoError(t, accessor.setData(path, currentState.ZNRecord, -1))
+
+	scope := tally.NewTestScope("", nil)
+	batcher := newCurrentStateBatcher(scope, accessor, 50*time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(partition string) {
+			defer wg.Done()
+			assert.NoError(t, batcher.update(path, partition,
+				map[string]string{model.FieldKeyCurrentState: StateModelStateOnline}))
+		}(fmt.Sprintf("r1_%d", i))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, batcher.remove(path, "r1_0"))
+	}()
+	wg.Wait()
+
+	currentState, err := accessor.CurrentState("i1", "s1", "r1")
+	assert.NoError(t, err)
+	assert.Len(t, currentState.GetPartitionStateMap(), 10)
+	assert.Equal(t, "", currentState.GetState("r1_0"))
+	assert.Equal(t, StateModelStateOnline, currentState.GetState("r1_10"))
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(1), counters["current-state-writes+"].Value())
+	assert.Equal(t, int64(11), counters["current-state-updates+"].Value())
+
+	// the current state is not created by the updates
+	err = batcher.update(keyBuilder.currentStateForResource("i1", "s1", "r2"), "r2_0",
+		map[string]string{model.FieldKeyCurrentState: StateModelStateOnline})
+	assert.Equal(t, zk.ErrNoNode, errors.Cause(err))
+}
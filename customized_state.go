@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+)
+
+// UpdateCustomizedState sets the customized state of the type of the partition on the participant,
+// e.g. UpdateCustomizedState("REPLICATION_LAG", "myDB", "myDB_0", "CAUGHT_UP"). The controller
+// aggregates the customized states of the types configured by WithCustomizedViewAggregation
+// into the customized views the spectators route with
+func (p *participant) UpdateCustomizedState(stateType string, resource string, partition string, state string) error {
+	path := p.keyBuilder.customizedStateForResource(p.instanceName, stateType, resource)
+	return p.dataAccessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		customizedState := model.NewCustomizedState(resource)
+		if data != nil {
+			customizedState.ZNRecord = *data
+		}
+		customizedState.SetState(partition, state, time.Now())
+		return &customizedState.ZNRecord, nil
+	})
+}
+
+// DeleteCustomizedState removes the customized state of the type of the partition on the participant
+func (p *participant) DeleteCustomizedState(stateType string, resource string, partition string) error {
+	path := p.keyBuilder.customizedStateForResource(p.instanceName, stateType, resource)
+	if err := p.zkClient.RemoveMapFieldKey(path, partition); errors.Cause(err) != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+// customizedViewAggregationStage aggregates the customized states of the live instances
+// into the customized views of the types, the views are only written if changed
+// This mirrors org.apache.helix.controller.stages.CustomizedViewAggregationStage
+type customizedViewAggregationStage struct {
+	accessor   *DataAccessor
+	stateTypes []string
+}
+
+func (s *customizedViewAggregationStage) Name() string {
+	return "CustomizedViewAggregation"
+}
+
+func (s *customizedViewAggregationStage) Process(event *ClusterEvent) error {
+	if event.Cache == nil {
+		return errors.New("cluster data cache not loaded")
+	}
+	keyBuilder := s.accessor.KeyBuilder()
+	for _, stateType := range s.stateTypes {
+		views := map[string]*model.CustomizedView{}
+		for instance := range event.Cache.LiveInstances {
+			customizedStates, err := s.accessor.CustomizedStates(instance, stateType)
+			if err != nil {
+				return err
+			}
+			for resource, customizedState := range customizedStates {
+				view, ok := views[resource]
+				if !ok {
+					view = model.NewCustomizedView(resource)
+					views[resource] = view
+				}
+				for partition, state := range customizedState.GetPartitionStateMap() {
+					if state != "" {
+						view.SetState(partition, instance, state)
+					}
+				}
+			}
+		}
+
+		existing, err := s.accessor.CustomizedViews(stateType)
+		if err != nil {
+			return err
+		}
+		for resource, view := range views {
+			if previous, ok := existing[resource]; ok && reflect.DeepEqual(previous.MapFields, view.MapFields) {
+				continue
+			}
+			if err := s.accessor.SetProperty(keyBuilder.CustomizedView(stateType, resource), &view.ZNRecord); err != nil {
+				return err
+			}
+		}
+		for resource := range existing {
+			if _, ok := views[resource]; !ok {
+				if err := s.accessor.RemoveProperty(keyBuilder.CustomizedView(stateType, resource)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestCustomizedViewAggregation(t *testing.T) {
+	const stateType = "REPLICATION_LAG"
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, client, keyBuilder, accessor := cluster.zk, cluster.client, cluster.keyBuilder, cluster.accessor
+
+	var participants []Participant
+	for _, port := range []int32{1, 2} {
+		p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName,
+			TestResource, testParticipantHost, port,
+			WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+		assert.NoError(t, p.(*participant).zkClient.Connect())
+		defer p.(*participant).zkClient.Disconnect()
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance(p.InstanceName()),
+			model.NewLiveInstance(p.InstanceName(), "s").ZNRecord))
+		participants = append(participants, p)
+	}
+	p1, p2 := participants[0], participants[1]
+	assert.NoError(t, p1.UpdateCustomizedState(stateType, "r1", "r1_0", "CAUGHT_UP"))
+	assert.NoError(t, p1.UpdateCustomizedState(stateType, "r1", "r1_1", "LAGGING"))
+	assert.NoError(t, p2.UpdateCustomizedState(stateType, "r1", "r1_0", "LAGGING"))
+	customizedStates, err := accessor.CustomizedStates(p1.InstanceName(), stateType)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"r1_0": "CAUGHT_UP", "r1_1": "LAGGING"},
+		customizedStates["r1"].GetPartitionStateMap())
+
+	controller := NewController(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithCustomizedViewAggregation(stateType),
+		WithControllerZkClientOptions(cluster.zkClientOptions()...))
+	assert.NoError(t, controller.Connect())
+	defer controller.Disconnect()
+	_, err = controller.Rebalance()
+	assert.NoError(t, err)
+	views, err := accessor.CustomizedViews(stateType)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{p1.InstanceName(): "CAUGHT_UP", p2.InstanceName(): "LAGGING"},
+		views["r1"].GetStateMap("r1_0"))
+	assert.Equal(t, map[string]string{p1.InstanceName(): "LAGGING"}, views["r1"].GetStateMap("r1_1"))
+
+	provider := NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithRoutingCustomizedView(stateType))
+	provider.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	provider.dataAccessor = newDataAccessor(provider.zkClient, keyBuilder)
+	assert.NoError(t, provider.Connect())
+	defer provider.Disconnect()
+	assert.Equal(t, map[string]string{p1.InstanceName(): "LAGGING"},
+		provider.GetRoutingTable().GetStateMap("r1", "r1_1"))
+
+	// the states of the instances no longer live are left out of the views
+	assert.NoError(t, p1.DeleteCustomizedState(stateType, "r1", "r1_1"))
+	assert.NoError(t, p1.DeleteCustomizedState(stateType, "r2", "r2_0"))
+	assert.NoError(t, client.Delete(keyBuilder.liveInstance(p2.InstanceName())))
+	_, err = controller.Rebalance()
+	assert.NoError(t, err)
+	views, err = accessor.CustomizedViews(stateType)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"r1_0"}, views["r1"].GetPartitionSet())
+	assert.Equal(t, map[string]string{p1.InstanceName(): "CAUGHT_UP"}, views["r1"].GetStateMap("r1_0"))
+	waitForRoutingTable(t, provider, func(table *RoutingTable) bool {
+		return len(table.GetPartitions("r1")) == 1
+	})
+}
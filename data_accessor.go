@@ -21,12 +21,23 @@
 package helix
 
 import (
+	"context"
+	"path"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/samuel/go-zookeeper/zk"
 	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
 	uzk "github.com/uber-go/go-helix/zk"
 )
 
+const (
+	// the backoff between the attempts of updateData
+	_updateInitialBackoff = 10 * time.Millisecond
+	_updateMaxBackoff     = time.Second
+)
+
 var (
 	// ErrorNilUpdatedData returns when updateFn returns nil *model.ZNRecord without error
 	ErrorNilUpdatedData = errors.New("data accessor: updated data is nil")
@@ -41,56 +52,83 @@ type updateFn func(data *model.ZNRecord) (*model.ZNRecord, error)
 type DataAccessor struct {
 	zkClient   *uzk.Client
 	keyBuilder *KeyBuilder
+	// strict validates the ideal states, external views, messages and instance configs read
+	strict bool
+	// ctx is the parent of the spans of the ZK round trips, see withContext
+	ctx context.Context
 }
 
 // newDataAccessor creates new DataAccessor with Zookeeper client
 func newDataAccessor(zkClient *uzk.Client, keyBuilder *KeyBuilder) *DataAccessor {
-	return &DataAccessor{zkClient: zkClient, keyBuilder: keyBuilder}
+	return &DataAccessor{zkClient: zkClient, keyBuilder: keyBuilder, ctx: context.Background()}
+}
+
+// withContext returns a copy of the accessor tracing its ZK round trips in the span of ctx
+func (a *DataAccessor) withContext(ctx context.Context) *DataAccessor {
+	copied := *a
+	copied.ctx = ctx
+	return &copied
 }
 
 // Msg helps get Helix property with type Message
 func (a *DataAccessor) Msg(path string) (*model.Message, error) {
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Message{ZNRecord: *record}, nil
+	msg := &model.Message{ZNRecord: *record}
+	if err := a.validate(path, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
 }
 
 // InstanceConfig helps get Helix property with type Message
 func (a *DataAccessor) InstanceConfig(path string) (*model.InstanceConfig, error) {
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
-	return &model.InstanceConfig{ZNRecord: *record}, nil
+	config := &model.InstanceConfig{ZNRecord: *record}
+	if err := a.validate(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // IdealState helps get Helix property with type IdealState
 func (a *DataAccessor) IdealState(resourceName string) (*model.IdealState, error) {
 	path := a.keyBuilder.idealStateForResource(resourceName)
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
-	return &model.IdealState{ZNRecord: *record}, nil
+	idealState := &model.IdealState{ZNRecord: *record}
+	if err := a.validate(path, idealState); err != nil {
+		return nil, err
+	}
+	return idealState, nil
 }
 
 // ExternalView helps get Helix property with type ExternalView
 func (a *DataAccessor) ExternalView(resourceName string) (*model.ExternalView, error) {
 	path := a.keyBuilder.externalViewForResource(resourceName)
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
-	return &model.ExternalView{ZNRecord: *record}, nil
+	view := &model.ExternalView{ZNRecord: *record}
+	if err := a.validate(path, view); err != nil {
+		return nil, err
+	}
+	return view, nil
 }
 
 // CurrentState helps get Helix property with type CurrentState
 func (a *DataAccessor) CurrentState(instanceName, session, resourceName string,
 ) (*model.CurrentState, error) {
 	path := a.keyBuilder.currentStateForResource(instanceName, session, resourceName)
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
@@ -100,32 +138,288 @@ func (a *DataAccessor) CurrentState(instanceName, session, resourceName string,
 // LiveInstance returns Helix property with type LiveInstance
 func (a *DataAccessor) LiveInstance(instanceName string) (*model.LiveInstance, error) {
 	path := a.keyBuilder.liveInstance(instanceName)
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
 	return &model.LiveInstance{ZNRecord: *record}, nil
 }
 
+// ParticipantHistory returns the session history of the instance
+func (a *DataAccessor) ParticipantHistory(instanceName string) (*model.ParticipantHistory, error) {
+	record, err := a.record(a.keyBuilder.participantHistory(instanceName))
+	if err != nil {
+		return nil, err
+	}
+	return &model.ParticipantHistory{ZNRecord: *record}, nil
+}
+
 // StateModelDef helps get Helix property with type StateModelDef
 func (a *DataAccessor) StateModelDef(stateModel string) (*model.StateModelDef, error) {
 	path := a.keyBuilder.stateModelDef(stateModel)
-	record, err := a.zkClient.GetRecordFromPath(path)
+	record, err := a.record(path)
 	if err != nil {
 		return nil, err
 	}
 	return &model.StateModelDef{ZNRecord: *record}, nil
 }
 
+// ClusterConfig helps get Helix property with type ClusterConfig
+func (a *DataAccessor) ClusterConfig() (*model.ClusterConfig, error) {
+	record, err := a.record(a.keyBuilder.clusterConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &model.ClusterConfig{ZNRecord: *record}, nil
+}
+
+// Constraints helps get Helix property with type ClusterConstraints
+func (a *DataAccessor) Constraints(constraintType string) (*model.ClusterConstraints, error) {
+	record, err := a.record(a.keyBuilder.constraints(constraintType))
+	if err != nil {
+		return nil, err
+	}
+	return &model.ClusterConstraints{ZNRecord: *record}, nil
+}
+
+// ResourceConfig helps get Helix property with type ResourceConfig
+func (a *DataAccessor) ResourceConfig(resourceName string) (*model.ResourceConfig, error) {
+	record, err := a.record(a.keyBuilder.resourceConfig(resourceName))
+	if err != nil {
+		return nil, err
+	}
+	return &model.ResourceConfig{ZNRecord: *record}, nil
+}
+
+// ResourceConfigs returns the configs of the resources of the cluster by resource name
+func (a *DataAccessor) ResourceConfigs() (map[string]*model.ResourceConfig, error) {
+	records, err := a.childRecords(a.keyBuilder.resourceConfigs())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.ResourceConfig, len(records))
+	for name, record := range records {
+		result[name] = &model.ResourceConfig{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// LiveInstances returns the live instances of the cluster by instance name
+func (a *DataAccessor) LiveInstances() (map[string]*model.LiveInstance, error) {
+	records, err := a.childRecords(a.keyBuilder.liveInstances())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.LiveInstance, len(records))
+	for name, record := range records {
+		result[name] = &model.LiveInstance{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// InstanceConfigs returns the configs of the instances of the cluster by instance name
+func (a *DataAccessor) InstanceConfigs() (map[string]*model.InstanceConfig, error) {
+	dir := a.keyBuilder.participantConfigs()
+	records, err := a.childRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.InstanceConfig, len(records))
+	for name, record := range records {
+		result[name] = &model.InstanceConfig{ZNRecord: *record}
+		if err := a.validate(path.Join(dir, name), result[name]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// IdealStates returns the ideal states of the cluster by resource name
+func (a *DataAccessor) IdealStates() (map[string]*model.IdealState, error) {
+	dir := a.keyBuilder.idealStates()
+	records, err := a.childRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.IdealState, len(records))
+	for name, record := range records {
+		result[name] = &model.IdealState{ZNRecord: *record}
+		if err := a.validate(path.Join(dir, name), result[name]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ExternalViews returns the external views of the cluster by resource name
+func (a *DataAccessor) ExternalViews() (map[string]*model.ExternalView, error) {
+	dir := a.keyBuilder.externalView()
+	records, err := a.childRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.ExternalView, len(records))
+	for name, record := range records {
+		result[name] = &model.ExternalView{ZNRecord: *record}
+		if err := a.validate(path.Join(dir, name), result[name]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// TargetExternalViews returns the target external views of the cluster by resource name,
+// the placements the controller is moving the partitions to
+func (a *DataAccessor) TargetExternalViews() (map[string]*model.ExternalView, error) {
+	dir := a.keyBuilder.targetExternalView()
+	records, err := a.childRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.ExternalView, len(records))
+	for name, record := range records {
+		result[name] = &model.ExternalView{ZNRecord: *record}
+		if err := a.validate(path.Join(dir, name), result[name]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// StateModelDefs returns the state model definitions of the cluster by name
+func (a *DataAccessor) StateModelDefs() (map[string]*model.StateModelDef, error) {
+	records, err := a.childRecords(a.keyBuilder.stateModelDefs())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.StateModelDef, len(records))
+	for name, record := range records {
+		result[name] = &model.StateModelDef{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// CurrentStates returns the current states of the instance session by resource name
+func (a *DataAccessor) CurrentStates(instanceName, session string) (map[string]*model.CurrentState, error) {
+	records, err := a.childRecords(a.keyBuilder.currentStatesForSession(instanceName, session))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.CurrentState, len(records))
+	for name, record := range records {
+		result[name] = &model.CurrentState{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// CustomizedStates returns the customized states of the type on the instance by resource name
+func (a *DataAccessor) CustomizedStates(instanceName, stateType string) (map[string]*model.CustomizedState, error) {
+	records, err := a.childRecords(a.keyBuilder.customizedStatesForType(instanceName, stateType))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.CustomizedState, len(records))
+	for name, record := range records {
+		result[name] = &model.CustomizedState{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// CustomizedViews returns the customized views of the type by resource name
+func (a *DataAccessor) CustomizedViews(stateType string) (map[string]*model.CustomizedView, error) {
+	records, err := a.childRecords(a.keyBuilder.customizedViewsForType(stateType))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.CustomizedView, len(records))
+	for name, record := range records {
+		result[name] = &model.CustomizedView{ZNRecord: *record}
+	}
+	return result, nil
+}
+
+// KeyBuilder returns the builder of the property keys of the cluster
+func (a *DataAccessor) KeyBuilder() *KeyBuilder {
+	return a.keyBuilder
+}
+
+// Property returns the record at the key, the version of the record is set
+func (a *DataAccessor) Property(key PropertyKey) (*model.ZNRecord, error) {
+	return a.record(key.Path)
+}
+
+// SetProperty writes the record at the key, the znode and its parents are created if missing
+func (a *DataAccessor) SetProperty(key PropertyKey, record *model.ZNRecord) error {
+	err := a.setData(key.Path, *record, -1)
+	if errors.Cause(err) == zk.ErrNoNode {
+		err = a.createData(key.Path, *record)
+	}
+	return err
+}
+
+// UpdateProperty updates the record at the key with a read-modify-write retried with backoff on
+// concurrent changes until the retry timeout of the ZK client, update gets nil if the record does
+// not exist
+func (a *DataAccessor) UpdateProperty(
+	key PropertyKey, update func(record *model.ZNRecord) (*model.ZNRecord, error)) error {
+	return a.updateData(key.Path, update)
+}
+
+// RemoveProperty removes the record at the key and its children, removing a missing key is a no-op
+func (a *DataAccessor) RemoveProperty(key PropertyKey) error {
+	return a.zkClient.DeleteTreeContext(a.ctx, key.Path)
+}
+
+// ChildNames returns the names of the children of the key, e.g. the resources of the
+// IdealStates key, it returns no names if the key does not exist
+func (a *DataAccessor) ChildNames(key PropertyKey) ([]string, error) {
+	children, err := a.zkClient.ChildrenContext(a.ctx, key.Path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil, nil
+	}
+	return children, err
+}
+
+// ChildValues returns the records of the children of the key by child name
+func (a *DataAccessor) ChildValues(key PropertyKey) (map[string]*model.ZNRecord, error) {
+	return a.childRecords(key.Path)
+}
+
+// childRecords returns the records of the children of the path by child name,
+// the children removed after being listed are skipped
+func (a *DataAccessor) childRecords(path string) (map[string]*model.ZNRecord, error) {
+	children, err := a.zkClient.ChildrenContext(a.ctx, path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return map[string]*model.ZNRecord{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*model.ZNRecord, len(children))
+	for _, child := range children {
+		record, err := a.record(path + "/" + child)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result[child] = record
+	}
+	return result, nil
+}
+
 // updateData would update the data in path with updateFn
 // if path does not exist, updateData would create it
 // and updateFn would have a nil *model.ZNRecord as input
+// concurrent changes are retried with backoff until the retry timeout of the ZK client
 func (a *DataAccessor) updateData(path string, update updateFn) error {
 	var err error
 	var record *model.ZNRecord
-	for {
+	backoff := util.Backoff{Initial: _updateInitialBackoff, Max: _updateMaxBackoff}
+	clock := a.zkClient.Clock()
+	startTime := clock.Now()
+	for attempts := 1; ; attempts++ {
 		nodeExists := true
-		record, err = a.zkClient.GetRecordFromPath(path)
+		record, err = a.record(path)
 		cause := errors.Cause(err)
 		if cause == zk.ErrNoNode {
 			nodeExists = false
@@ -147,31 +441,152 @@ func (a *DataAccessor) updateData(path string, update updateFn) error {
 		}
 
 		if cause := errors.Cause(err); cause != nil &&
-			(cause != zk.ErrBadVersion || cause != zk.ErrNoNode) {
+			cause != zk.ErrBadVersion && cause != zk.ErrNoNode && cause != zk.ErrNodeExists {
 			return err
 		}
 
-		// retry for ErrBadVersion or ErrNoNode
+		// retry for ErrBadVersion, ErrNoNode or ErrNodeExists, the data was changed concurrently
 		if err == nil {
 			return nil
 		}
+		if clock.Since(startTime) > a.zkClient.RetryTimeout() {
+			return errors.Wrapf(err, "data accessor gave up updating %s after %d attempts", path, attempts)
+		}
+		clock.Sleep(backoff.Next())
 	}
 }
 
+// validate checks the typed record read at the path in strict mode, the record is not
+// valid if it misses a required field or holds a field of the wrong type
+func (a *DataAccessor) validate(path string, record interface{ Validate() error }) error {
+	if !a.strict {
+		return nil
+	}
+	err := record.Validate()
+	if invalid, ok := err.(*model.ErrInvalidRecord); ok {
+		invalid.Path = path
+	}
+	return err
+}
+
+// record returns the record at the path, assembled from its buckets if it is bucketized
+func (a *DataAccessor) record(path string) (*model.ZNRecord, error) {
+	return readRecord(a.ctx, a.zkClient, path, a.bucketized(path))
+}
+
+// bucketized returns if the record at the path is split into buckets when it has a BUCKET_SIZE,
+// i.e. if it is an ideal state or an external view. The other records, e.g. the current states
+// updated in place by the participants, are always stored whole
+func (a *DataAccessor) bucketized(p string) bool {
+	switch path.Dir(p) {
+	case a.keyBuilder.idealStates(), a.keyBuilder.externalView(), a.keyBuilder.targetExternalView():
+		return true
+	}
+	return false
+}
+
+// readRecord returns the record at the path, a bucketized record with a BUCKET_SIZE is assembled
+// from the buckets stored as its children. Mirrors the reads of
+// org.apache.helix.manager.zk.ZKHelixDataAccessor
+func readRecord(
+	ctx context.Context, zkClient *uzk.Client, path string, bucketized bool) (*model.ZNRecord, error) {
+	record, err := zkClient.GetRecordFromPathContext(ctx, path)
+	if err != nil || !bucketized || record.GetIntField(model.FieldKeyBucketSize, 0) <= 0 {
+		return record, err
+	}
+	children, err := zkClient.ChildrenContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]*model.ZNRecord, 0, len(children))
+	for _, child := range children {
+		bucket, err := zkClient.GetRecordFromPathContext(ctx, path+"/"+child)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	assembled := model.AssembleRecords(record.ID, buckets)
+	if assembled == nil {
+		return record, nil
+	}
+	// the simple fields and the version of the record are the ones of the parent
+	assembled.SimpleFields = record.SimpleFields
+	assembled.Version = record.Version
+	return assembled, nil
+}
+
 func (a *DataAccessor) createData(path string, data model.ZNRecord) error {
-	serialized, err := data.Marshal()
+	parent, buckets := a.bucketizeRecord(path, data)
+	serialized, err := parent.Marshal()
 	if err != nil {
 		return err
 	}
-	return a.zkClient.CreateDataWithPath(path, serialized)
+	if err := a.zkClient.CreateDataWithPathContext(a.ctx, path, serialized); err != nil {
+		return err
+	}
+	return a.writeBuckets(path, buckets)
 }
 
 func (a *DataAccessor) setData(path string, data model.ZNRecord, version int32) error {
-	serialized, err := data.Marshal()
+	parent, buckets := a.bucketizeRecord(path, data)
+	serialized, err := parent.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := a.zkClient.SetDataForPathContext(a.ctx, path, serialized, version); err != nil {
+		return err
+	}
+	return a.writeBuckets(path, buckets)
+}
+
+// bucketizeRecord splits the bucketized record with a BUCKET_SIZE into the parent record holding
+// its simple fields and the buckets holding its list and map fields, the buckets are nil otherwise.
+// Mirrors the writes of org.apache.helix.manager.zk.ZKHelixDataAccessor
+func (a *DataAccessor) bucketizeRecord(path string, record model.ZNRecord) (model.ZNRecord, map[string]*model.ZNRecord) {
+	bucketSize := record.GetIntField(model.FieldKeyBucketSize, 0)
+	if bucketSize <= 0 || !a.bucketized(path) {
+		return record, nil
+	}
+	parent := model.NewRecord(record.ID)
+	parent.SimpleFields = record.SimpleFields
+	return *parent, model.NewZNRecordBucketizer(bucketSize).Bucketize(&record)
+}
+
+// writeBuckets writes the buckets as the children of the path and deletes the stale ones, the
+// parent is written first like in Java Helix so the readers may briefly see the previous buckets
+func (a *DataAccessor) writeBuckets(path string, buckets map[string]*model.ZNRecord) error {
+	if buckets == nil {
+		return nil
+	}
+	children, err := a.zkClient.ChildrenContext(a.ctx, path)
 	if err != nil {
 		return err
 	}
-	return a.zkClient.SetDataForPath(path, serialized, version)
+	for name, bucket := range buckets {
+		serialized, err := bucket.Marshal()
+		if err != nil {
+			return err
+		}
+		err = a.zkClient.SetDataForPathContext(a.ctx, path+"/"+name, serialized, -1)
+		if errors.Cause(err) == zk.ErrNoNode {
+			err = a.zkClient.CreateDataWithPathContext(a.ctx, path+"/"+name, serialized)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, child := range children {
+		if _, ok := buckets[child]; ok {
+			continue
+		}
+		if err := a.zkClient.DeleteContext(a.ctx, path+"/"+child); err != nil && errors.Cause(err) != zk.ErrNoNode {
+			return err
+		}
+	}
+	return nil
 }
 
 // createMsg creates a new message
@@ -23,8 +23,13 @@ package helix
 import (
 	"fmt"
 	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber-go/go-helix/model"
 )
@@ -207,3 +212,214 @@ func (s *DataAccessorTestSuite) assertCurrentState(
 	s.Equal(state.GetPartitionStateMap()[partition], expectedState)
 	s.Equal(state.GetState(partition), expectedState)
 }
+
+func (s *DataAccessorTestSuite) TestClusterData() {
+	p, _ := s.createParticipantAndConnect()
+	s.NotNil(p)
+
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, &KeyBuilder{TestClusterName})
+
+	liveInstances, err := accessor.LiveInstances()
+	s.NoError(err)
+	s.Contains(liveInstances, p.InstanceName())
+	configs, err := accessor.InstanceConfigs()
+	s.NoError(err)
+	s.Contains(configs, p.InstanceName())
+	stateModelDefs, err := accessor.StateModelDefs()
+	s.NoError(err)
+	s.Contains(stateModelDefs, StateModelNameOnlineOffline)
+	_, err = accessor.IdealStates()
+	s.NoError(err)
+	currentStates, err := accessor.CurrentStates(p.InstanceName(), CreateRandomString())
+	s.NoError(err)
+	s.Empty(currentStates)
+}
+
+func (s *DataAccessorTestSuite) TestUpdateDataConcurrently() {
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, _accessorTestKeyBuilder)
+	path := fmt.Sprintf("/test_path/counter/%s", CreateRandomString())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.NoError(accessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+				if data == nil {
+					data = model.NewRecord("counter")
+				}
+				data.SetIntField("count", data.GetIntField("count", 0)+1)
+				return data, nil
+			}))
+		}()
+	}
+	wg.Wait()
+	record, err := client.GetRecordFromPath(path)
+	s.NoError(err)
+	s.Equal(10, record.GetIntField("count", 0))
+}
+
+func (s *DataAccessorTestSuite) TestProperties() {
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	keyBuilder := NewKeyBuilder(CreateRandomString())
+	accessor := newDataAccessor(client, keyBuilder)
+	s.Equal(keyBuilder, accessor.KeyBuilder())
+
+	names, err := accessor.ChildNames(keyBuilder.IdealStates())
+	s.NoError(err)
+	s.Empty(names)
+	key := keyBuilder.IdealState("r1")
+	s.Equal(PropertyTypeIdealStates, key.Type)
+	s.NoError(accessor.SetProperty(key, &model.NewIdealState("r1").ZNRecord))
+	s.NoError(accessor.UpdateProperty(key, func(record *model.ZNRecord) (*model.ZNRecord, error) {
+		record.SetSimpleField("NUM_PARTITIONS", "2")
+		return record, nil
+	}))
+	record, err := accessor.Property(key)
+	s.NoError(err)
+	numPartitions, _ := record.GetSimpleField("NUM_PARTITIONS")
+	s.Equal("2", numPartitions)
+	s.Equal(int32(1), record.Version)
+
+	s.NoError(accessor.SetProperty(keyBuilder.IdealState("r2"), &model.NewIdealState("r2").ZNRecord))
+	names, err = accessor.ChildNames(keyBuilder.IdealStates())
+	s.NoError(err)
+	sort.Strings(names)
+	s.Equal([]string{"r1", "r2"}, names)
+	records, err := accessor.ChildValues(keyBuilder.IdealStates())
+	s.NoError(err)
+	s.Len(records, 2)
+	s.Equal("r2", records["r2"].ID)
+
+	s.NoError(accessor.RemoveProperty(key))
+	s.NoError(accessor.RemoveProperty(key))
+	_, err = accessor.Property(key)
+	s.Error(err)
+}
+
+func TestBucketizedRecords(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, keyBuilder, accessor := cluster.client, cluster.keyBuilder, cluster.accessor
+
+	idealState := model.NewIdealState("db")
+	idealState.SetBucketSize(2)
+	for i := 0; i < 5; i++ {
+		idealState.SetPreferenceList("db_"+strconv.Itoa(i), []string{"host_1"})
+	}
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("db"), &idealState.ZNRecord))
+	path := keyBuilder.idealStateForResource("db")
+	buckets, err := client.Children(path)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db_p0-p1", "db_p2-p3", "db_p4-p5"}, buckets)
+	parent, err := client.GetRecordFromPath(path)
+	assert.NoError(t, err)
+	assert.Empty(t, parent.ListFields)
+
+	// the reads assemble the buckets
+	read, err := accessor.IdealState("db")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host_1"}, read.GetPreferenceList("db_4"))
+	assert.Len(t, read.ListFields, 5)
+	idealStates, err := accessor.IdealStates()
+	assert.NoError(t, err)
+	assert.Equal(t, read.ListFields, idealStates["db"].ListFields)
+
+	// the stale buckets are deleted
+	assert.NoError(t, accessor.UpdateProperty(keyBuilder.IdealState("db"),
+		func(record *model.ZNRecord) (*model.ZNRecord, error) {
+			record.RemoveListField("db_4")
+			return record, nil
+		}))
+	buckets, err = client.Children(path)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"db_p0-p1", "db_p2-p3"}, buckets)
+	read, err = accessor.IdealState("db")
+	assert.NoError(t, err)
+	assert.Len(t, read.ListFields, 4)
+
+	// the other records are stored whole
+	currentState := model.NewCurrentStateFromMsg(model.NewMsg("msg"), "db", "session")
+	currentState.SetBucketSize(2)
+	currentState.SetState("db_0", "ONLINE")
+	statePath := keyBuilder.currentStateForResource("host_1", "session", "db")
+	assert.NoError(t, accessor.createCurrentState(statePath, currentState))
+	children, err := client.Children(statePath)
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
+
+func TestStrictValidation(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	assert.NoError(t, admin.AddResource(TestClusterName, "db", 2, StateModelNameOnlineOffline))
+	keyBuilder := &KeyBuilder{TestClusterName}
+	accessor := newDataAccessor(client, keyBuilder)
+	strict := newDataAccessor(client, keyBuilder)
+	strict.strict = true
+
+	_, err := strict.IdealState("db")
+	assert.NoError(t, err)
+	// a hand edited ideal state is read as is unless strict
+	assert.NoError(t, accessor.UpdateProperty(keyBuilder.IdealState("db"),
+		func(record *model.ZNRecord) (*model.ZNRecord, error) {
+			record.SetSimpleField(model.FieldKeyNumPartitions, "2 ")
+			return record, nil
+		}))
+	_, err = accessor.IdealState("db")
+	assert.NoError(t, err)
+	expected := &model.ErrInvalidRecord{Path: keyBuilder.idealStateForResource("db"), ID: "db",
+		Field: model.FieldKeyNumPartitions, Got: "2 ", Want: "an integer"}
+	_, err = strict.IdealState("db")
+	assert.Equal(t, expected, errors.Cause(err))
+	_, err = strict.IdealStates()
+	assert.Equal(t, expected, errors.Cause(err))
+
+	msg := model.NewMsg("m")
+	path := keyBuilder.participantMsg("localhost_1", "m")
+	assert.NoError(t, accessor.createMsg(path, msg))
+	_, err = strict.Msg(path)
+	assert.Equal(t, &model.ErrInvalidRecord{Path: path, ID: "m", Field: model.FieldKeyMsgType,
+		Want: "a non-empty value"}, errors.Cause(err))
+}
+
+func TestCompressedRecords(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, keyBuilder, accessor := cluster.client, cluster.keyBuilder, cluster.accessor
+
+	// an external view written by Java Helix with compression enabled
+	view := model.NewExternalView("db")
+	view.SetState("db_0", "host_1", StateModelStateOnline)
+	view.SetCompressionEnabled(true)
+	data, err := view.Marshal()
+	assert.NoError(t, err)
+	assert.True(t, model.IsCompressed(data))
+	assert.NoError(t, client.CreateDataWithPath(keyBuilder.externalViewForResource("db"), data))
+
+	read, err := accessor.ExternalView("db")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"host_1": StateModelStateOnline}, read.GetStateMap("db_0"))
+	views, err := accessor.ExternalViews()
+	assert.NoError(t, err)
+	assert.Equal(t, StateModelStateOnline, views["db"].GetStateMap("db_0")["host_1"])
+
+	// the updates keep the compression
+	assert.NoError(t, accessor.UpdateProperty(keyBuilder.ExternalView("db"),
+		func(record *model.ZNRecord) (*model.ZNRecord, error) {
+			record.SetMapField("db_0", "host_2", StateModelStateOffline)
+			return record, nil
+		}))
+	data, _, err = client.Get(keyBuilder.externalViewForResource("db"))
+	assert.NoError(t, err)
+	assert.True(t, model.IsCompressed(data))
+	read, err = accessor.ExternalView("db")
+	assert.NoError(t, err)
+	assert.Len(t, read.GetStateMap("db_0"), 2)
+}
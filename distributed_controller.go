@@ -0,0 +1,197 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	// _distributedControllerApplication is the application the distributed controllers
+	// participate in the super cluster as
+	_distributedControllerApplication = "helix-controller"
+	// _controllerRetryInterval is the interval the start of the controller of a cluster
+	// is retried at while the distributed controller is the LEADER of the cluster
+	_controllerRetryInterval = 5 * time.Second
+)
+
+// DistributedController controls the clusters activated in a super cluster with
+// Admin.ActivateCluster. It joins the super cluster as a participant, and runs the controller
+// of each cluster it is the LEADER of. The super cluster itself is led by one of its distributed
+// controllers, which gives the clusters of a lost controller to the STANDBY controllers
+// This mirrors the DISTRIBUTED mode of org.apache.helix.controller.HelixControllerMain
+type DistributedController struct {
+	logger          *zap.Logger
+	scope           tally.Scope
+	zkConnectString string
+	superCluster    string
+
+	participant Participant
+	// superController runs the pipeline of the super cluster while it leads the super cluster
+	superController *Controller
+	// singleton runs the controllers of the clusters the participant is the LEADER of
+	singleton *Singleton
+
+	controllerOptions  []ControllerOption
+	participantOptions []ParticipantOption
+
+	mu sync.Mutex
+	// cluster -> the started controller of the cluster
+	controllers map[string]*Controller
+}
+
+// DistributedControllerOption configures optional settings of a DistributedController
+type DistributedControllerOption func(*DistributedController)
+
+// WithDistributedControllerOptions configures the controllers of the super cluster and
+// of the controlled clusters
+func WithDistributedControllerOptions(options ...ControllerOption) DistributedControllerOption {
+	return func(d *DistributedController) {
+		d.controllerOptions = append(d.controllerOptions, options...)
+	}
+}
+
+// WithDistributedParticipantOptions configures the participant of the super cluster
+func WithDistributedParticipantOptions(options ...ParticipantOption) DistributedControllerOption {
+	return func(d *DistributedController) {
+		d.participantOptions = append(d.participantOptions, options...)
+	}
+}
+
+// NewDistributedController instantiates a DistributedController participating in the super
+// cluster as the instance of host and port, which is also the name of its controllers.
+// The errors of the participant are sent from the error chan like NewParticipant's
+func NewDistributedController(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	superCluster string,
+	host string,
+	port int32,
+	options ...DistributedControllerOption,
+) (*DistributedController, <-chan error) {
+	name := getInstanceName(host, port)
+	d := &DistributedController{
+		logger:          logger.With(zap.String("superCluster", superCluster), zap.String("controller", name)),
+		scope:           scope.SubScope("helix.distributed_controller").Tagged(map[string]string{"controller": name}),
+		zkConnectString: zkConnectString,
+		superCluster:    superCluster,
+		controllers:     map[string]*Controller{},
+	}
+	for _, option := range options {
+		option(d)
+	}
+	d.controllerOptions = append([]ControllerOption{WithControllerName(name)}, d.controllerOptions...)
+	d.singleton = NewSingleton(d.logger, d.scope, d.control)
+	p, errCh := NewParticipant(logger, scope, zkConnectString, _distributedControllerApplication,
+		superCluster, "", host, port, d.participantOptions...)
+	// the controllers are stopped as soon as the session of the participant expires
+	pImpl := p.(*participant)
+	if pImpl.eventLog == nil {
+		pImpl.eventLog = NewEventLog(d.logger, 1)
+	}
+	pImpl.eventLog.AddSink(d.singleton)
+	p.RegisterStateModel(StateModelNameLeaderStandby, d.singleton.StateModelProcessor())
+	d.participant = p
+	d.superController = NewController(logger, scope, zkConnectString, superCluster, d.controllerOptions...)
+	return d, errCh
+}
+
+// Start joins the super cluster and contends for its leadership
+func (d *DistributedController) Start() error {
+	if err := d.participant.Connect(); err != nil {
+		return errors.Wrap(err, "helix distributed controller")
+	}
+	if err := d.superController.Start(); err != nil {
+		d.participant.Disconnect()
+		return errors.Wrap(err, "helix distributed controller")
+	}
+	return nil
+}
+
+// Disconnect leaves the super cluster and stops the controllers of the clusters,
+// the STANDBY controllers take over the clusters
+func (d *DistributedController) Disconnect() {
+	d.participant.Disconnect()
+	d.singleton.Stop()
+	d.superController.Disconnect()
+}
+
+// IsLeader returns if the distributed controller controls the cluster
+func (d *DistributedController) IsLeader(cluster string) bool {
+	return d.singleton.IsLeader(cluster)
+}
+
+// Controller returns the started controller of the cluster, if the distributed controller controls it
+func (d *DistributedController) Controller(cluster string) (*Controller, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	controller, ok := d.controllers[cluster]
+	return controller, ok
+}
+
+// Clusters returns the clusters whose controllers are started, sorted
+func (d *DistributedController) Clusters() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clusters := make([]string, 0, len(d.controllers))
+	for cluster := range d.controllers {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// control runs the controller of the cluster until ctx is cancelled, the start of the
+// controller is retried until it succeeds
+func (d *DistributedController) control(ctx context.Context, cluster string) error {
+	controller := NewController(d.logger, d.scope, d.zkConnectString, cluster, d.controllerOptions...)
+	defer controller.Disconnect()
+	for {
+		err := controller.Start()
+		if err == nil {
+			break
+		}
+		d.scope.Counter("controller-start-failures").Inc(1)
+		d.logger.Warn("failed to start the controller of the cluster", zap.String("cluster", cluster),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(_controllerRetryInterval):
+		}
+	}
+	d.mu.Lock()
+	d.controllers[cluster] = controller
+	d.mu.Unlock()
+	<-ctx.Done()
+	d.mu.Lock()
+	delete(d.controllers, cluster)
+	d.mu.Unlock()
+	return nil
+}
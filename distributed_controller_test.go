@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestDistributedController(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin := cluster.admin
+	superCluster := "super_cluster"
+	assert.True(t, admin.AddCluster(superCluster, false))
+	assert.Equal(t, ErrClusterNotSetup, admin.ActivateCluster("unknown_cluster", superCluster, true))
+
+	controllers := map[string]*DistributedController{}
+	for _, port := range []int32{1, 2} {
+		name := getInstanceName(testParticipantHost, port)
+		assert.NoError(t, admin.AddNode(superCluster, name))
+		assert.NoError(t, admin.EnableInstance(superCluster, name))
+		controller, _ := NewDistributedController(zap.NewNop(), tally.NoopScope, "", superCluster,
+			testParticipantHost, port,
+			WithDistributedControllerOptions(WithRebalanceInterval(20*time.Millisecond),
+				WithControllerZkClientOptions(cluster.zkClientOptions()...)),
+			WithDistributedParticipantOptions(
+				WithParticipantZkClientOptions(cluster.zkClientOptions()...)))
+		assert.NoError(t, controller.Start())
+		defer controller.Disconnect()
+		controllers[name] = controller
+	}
+	assert.NoError(t, admin.ActivateCluster(TestClusterName, superCluster, true))
+	idealState, err := admin.ListIdealState(superCluster, TestClusterName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{TestClusterName}, idealState.GetPartitionSet())
+	assert.Equal(t, 2, idealState.GetReplicas())
+
+	// waitForLeader returns the only distributed controller leading the cluster
+	waitForLeader := func(candidates map[string]*DistributedController) string {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			var leaders []string
+			for name, controller := range candidates {
+				if c, ok := controller.Controller(TestClusterName); ok && c.IsLeader() {
+					leaders = append(leaders, name)
+				}
+			}
+			if len(leaders) == 1 {
+				return leaders[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.FailNow(t, "no single leader of the cluster elected")
+		return ""
+	}
+	leader := waitForLeader(controllers)
+	assert.True(t, controllers[leader].IsLeader(TestClusterName))
+	assert.Equal(t, []string{TestClusterName}, controllers[leader].Clusters())
+
+	// the standby takes over the cluster of the lost controller
+	controllers[leader].Disconnect()
+	delete(controllers, leader)
+	standby := waitForLeader(controllers)
+	assert.NotEqual(t, leader, standby)
+
+	// the deactivated cluster is not controlled anymore
+	assert.NoError(t, admin.ActivateCluster(TestClusterName, superCluster, false))
+	deadline := time.Now().Add(5 * time.Second)
+	for controllers[standby].IsLeader(TestClusterName) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, controllers[standby].IsLeader(TestClusterName))
+	assert.Empty(t, controllers[standby].Clusters())
+}
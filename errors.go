@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	uzk "github.com/uber-go/go-helix/zk"
+)
+
+// Errors of the ZooKeeper layer, returned wrapped by the Helix APIs. Callers
+// can branch on them with errors.Cause or errors.Is.
+var (
+	// ErrNotConnected is returned by operations called before connecting
+	ErrNotConnected = uzk.ErrNotConnected
+	// ErrSessionExpired is returned when the ZooKeeper session expired during the operation
+	ErrSessionExpired = uzk.ErrSessionExpired
+	// ErrBadVersion is returned when a conditional update lost a concurrent write
+	ErrBadVersion = uzk.ErrBadVersion
+	// ErrNodeExists is returned when creating a znode that already exists
+	ErrNodeExists = uzk.ErrNodeExists
+	// ErrNoNode is returned when the znode of the operation does not exist
+	ErrNoNode = uzk.ErrNoNode
+	// ErrReadOnly is returned by the writes of a read-only client, e.g. of the routing table provider
+	ErrReadOnly = uzk.ErrReadOnly
+	// ErrCircuitOpen is returned by the writes failed fast while ZooKeeper is degraded
+	ErrCircuitOpen = uzk.ErrCircuitOpen
+)
+
+// ErrTransitionTimeout is the error of a state transition not completed in its timeout
+var ErrTransitionTimeout = errors.New("helix participant: state transition timed out")
+
+// ErrInstanceNameCollision is returned when the live instance of the participant is owned by the
+// live session of another process, i.e. two participants use the same instance name
+var ErrInstanceNameCollision = errors.New("helix participant: instance name used by another live participant")
@@ -0,0 +1,203 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EventType is the type of an observed cluster event
+type EventType string
+
+// Types of the cluster events recorded in the EventLog
+const (
+	EventTypeSessionEstablished  EventType = "SESSION_ESTABLISHED"
+	EventTypeSessionExpired      EventType = "SESSION_EXPIRED"
+	EventTypeLiveInstanceUp      EventType = "LIVE_INSTANCE_UP"
+	EventTypeLiveInstanceDown    EventType = "LIVE_INSTANCE_DOWN"
+	EventTypeExternalViewChanged EventType = "EXTERNAL_VIEW_CHANGED"
+	EventTypeMessageReceived     EventType = "MESSAGE_RECEIVED"
+	EventTypeTransitionExecuted  EventType = "TRANSITION_EXECUTED"
+	// the types of the events recorded by a controller created with WithControllerEventLog
+	EventTypePartitionError     EventType = "PARTITION_ERROR"
+	EventTypeMaintenanceEntered EventType = "MAINTENANCE_ENTERED"
+	EventTypeMaintenanceExited  EventType = "MAINTENANCE_EXITED"
+)
+
+// Event is a cluster event observed by the participant or the controller,
+// Instance is the instance the event is about or the observing participant for cluster-wide events
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Cluster   string    `json:"cluster"`
+	Instance  string    `json:"instance,omitempty"`
+	Resource  string    `json:"resource,omitempty"`
+	Partition string    `json:"partition,omitempty"`
+	MsgID     string    `json:"msgId,omitempty"`
+	FromState string    `json:"fromState,omitempty"`
+	ToState   string    `json:"toState,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// EventSink receives every event recorded by the EventLog,
+// e.g. to ship the events to a file or Kafka
+type EventSink interface {
+	Write(e Event) error
+}
+
+// EventSinkFunc adapts a callback to an EventSink
+type EventSinkFunc func(e Event) error
+
+// Write calls the callback
+func (f EventSinkFunc) Write(e Event) error {
+	return f(e)
+}
+
+type writerEventSink struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriterEventSink returns an EventSink writing the events to w as JSON lines,
+// for instance to a log file
+func NewWriterEventSink(w io.Writer) EventSink {
+	return &writerEventSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *writerEventSink) Write(e Event) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.encoder.Encode(e)
+}
+
+// EventQuery selects events from the EventLog, zero values match all events
+type EventQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Types     []EventType
+	Instance  string
+	Resource  string
+	Partition string
+}
+
+func (q EventQuery) matches(e Event) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.Instance != "" && q.Instance != e.Instance {
+		return false
+	}
+	if q.Resource != "" && q.Resource != e.Resource {
+		return false
+	}
+	if q.Partition != "" && q.Partition != e.Partition {
+		return false
+	}
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// EventLog keeps the most recent cluster events in a ring buffer and forwards every event
+// to the sinks, so it can be queried when debugging what happened to the cluster
+type EventLog struct {
+	logger *zap.Logger
+
+	sync.RWMutex
+	events []Event
+	// next is the index the next event is written to
+	next  int
+	full  bool
+	sinks []EventSink
+}
+
+// NewEventLog creates an EventLog keeping up to capacity events
+func NewEventLog(logger *zap.Logger, capacity int, sinks ...EventSink) *EventLog {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &EventLog{
+		logger: logger,
+		events: make([]Event, capacity),
+		sinks:  sinks,
+	}
+}
+
+// AddSink adds a sink receiving the events recorded from now on
+func (l *EventLog) AddSink(sink EventSink) {
+	l.Lock()
+	l.sinks = append(l.sinks, sink)
+	l.Unlock()
+}
+
+// Record adds an event to the log, the oldest event is dropped if the log is full
+func (l *EventLog) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.Lock()
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	sinks := l.sinks
+	l.Unlock()
+
+	for _, sink := range sinks {
+		if err := sink.Write(e); err != nil {
+			l.logger.Warn("failed to write event to sink", zap.Any("event", e), zap.Error(err))
+		}
+	}
+}
+
+// Events returns the events matching the query, from the oldest to the newest
+func (l *EventLog) Events(q EventQuery) []Event {
+	l.RLock()
+	defer l.RUnlock()
+	var res []Event
+	start, size := 0, l.next
+	if l.full {
+		start, size = l.next, len(l.events)
+	}
+	for i := 0; i < size; i++ {
+		e := l.events[(start+i)%len(l.events)]
+		if q.matches(e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
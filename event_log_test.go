@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestEventLogRingBuffer(t *testing.T) {
+	eventLog := NewEventLog(zap.NewNop(), 3)
+	assert.Empty(t, eventLog.Events(EventQuery{}))
+	for _, partition := range []string{"p1", "p2", "p3", "p4"} {
+		eventLog.Record(Event{Type: EventTypeMessageReceived, Partition: partition})
+	}
+	events := eventLog.Events(EventQuery{})
+	assert.Len(t, events, 3)
+	assert.Equal(t, "p2", events[0].Partition)
+	assert.Equal(t, "p4", events[2].Partition)
+	assert.False(t, events[0].Time.IsZero())
+}
+
+func TestEventLogQuery(t *testing.T) {
+	eventLog := NewEventLog(zap.NewNop(), 10)
+	start := time.Date(2018, 1, 1, 2, 0, 0, 0, time.UTC)
+	eventLog.Record(Event{Type: EventTypeLiveInstanceDown, Instance: "i1", Time: start})
+	eventLog.Record(Event{Type: EventTypeMessageReceived, Resource: "r1", Time: start.Add(time.Minute)})
+	eventLog.Record(Event{Type: EventTypeTransitionExecuted, Resource: "r1", Partition: "p1",
+		Time: start.Add(3 * time.Minute)})
+	eventLog.Record(Event{Type: EventTypeTransitionExecuted, Resource: "r2", Time: start.Add(5 * time.Minute)})
+
+	assert.Len(t, eventLog.Events(EventQuery{Resource: "r1"}), 2)
+	assert.Len(t, eventLog.Events(EventQuery{Partition: "p1"}), 1)
+	assert.Len(t, eventLog.Events(EventQuery{Instance: "i1"}), 1)
+	assert.Len(t, eventLog.Events(EventQuery{Types: []EventType{EventTypeTransitionExecuted}}), 2)
+	events := eventLog.Events(EventQuery{Since: start.Add(2 * time.Minute), Until: start.Add(4 * time.Minute)})
+	assert.Len(t, events, 1)
+	assert.Equal(t, "p1", events[0].Partition)
+}
+
+func TestEventLogSinks(t *testing.T) {
+	var buf bytes.Buffer
+	var callbackEvents []Event
+	eventLog := NewEventLog(zap.NewNop(), 10, NewWriterEventSink(&buf))
+	eventLog.AddSink(EventSinkFunc(func(e Event) error {
+		callbackEvents = append(callbackEvents, e)
+		return errors.New("sink errors are only logged")
+	}))
+	eventLog.Record(Event{Type: EventTypeSessionExpired, Cluster: "cluster"})
+	assert.Len(t, callbackEvents, 1)
+
+	var e Event
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+	assert.Equal(t, EventTypeSessionExpired, e.Type)
+	assert.Equal(t, "cluster", e.Cluster)
+}
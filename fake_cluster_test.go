@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/require"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// fakeCluster is the cluster TestClusterName set up in a fake ZK, for the tests without a ZK server
+type fakeCluster struct {
+	zk         *uzk.FakeZk
+	client     *uzk.Client
+	admin      *Admin
+	keyBuilder *KeyBuilder
+	accessor   *DataAccessor
+}
+
+// newFakeCluster connects a client to a new fake ZK and adds the cluster TestClusterName with the
+// instances, the client is disconnected by close
+func newFakeCluster(t *testing.T, instances ...string) *fakeCluster {
+	fakeZK := uzk.NewFakeZk(uzk.DefaultConnectionState(zk.StateHasSession))
+	client := uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	require.NoError(t, client.Connect())
+	admin := &Admin{zkClient: client}
+	require.True(t, admin.AddCluster(TestClusterName, false))
+	for _, instance := range instances {
+		require.NoError(t, admin.AddNode(TestClusterName, instance))
+	}
+	keyBuilder := &KeyBuilder{TestClusterName}
+	return &fakeCluster{
+		zk:         fakeZK,
+		client:     client,
+		admin:      admin,
+		keyBuilder: keyBuilder,
+		accessor:   newDataAccessor(client, keyBuilder),
+	}
+}
+
+func (c *fakeCluster) close() {
+	c.client.Disconnect()
+}
+
+// zkClientOptions connects the ZK clients of the managers to the fake ZK
+func (c *fakeCluster) zkClientOptions() []uzk.ClientOption {
+	return []uzk.ClientOption{uzk.WithConnFactory(c.zk), uzk.WithRetryTimeout(time.Second)}
+}
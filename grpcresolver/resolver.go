@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package grpcresolver resolves gRPC targets to the addresses of the instances of a Helix cluster
+// currently hosting a partition in a state, from the routing table of a RoutingTableProvider.
+//
+// The targets have the form
+//
+//	helix:///{resource}[/{partition}][?state={state}&protocol={protocol}]
+//
+// Without a partition the target resolves to the instances hosting any partition of the resource.
+// The state is ONLINE by default. With a protocol the addresses are the endpoints advertised by the
+// participants with helix.WithAdvertisedEndpoint and the instances not advertising the protocol are
+// skipped, otherwise they are the host:port of the instance configs. The addresses are updated after
+// each refresh of the routing table, and the load balancing policy of the client spreads the requests
+// among them:
+//
+//	conn, err := grpc.Dial("helix:///myDB/myDB_0?protocol=grpc",
+//		grpc.WithResolvers(grpcresolver.NewBuilder(provider)),
+//		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`))
+package grpcresolver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/model"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the default scheme of the targets resolved by the builder
+const Scheme = "helix"
+
+// instanceKey is the key of the instance name in the attributes of the resolved addresses
+type instanceKey struct{}
+
+// InstanceName returns the name of the instance of an address resolved by the builder, e.g. for
+// a custom balancer picking instances, or an empty string for the other addresses
+func InstanceName(address resolver.Address) string {
+	name, _ := address.Attributes.Value(instanceKey{}).(string)
+	return name
+}
+
+// Option configures a Builder
+type Option func(*Builder)
+
+// WithScheme sets the scheme of the targets resolved by the builder, Scheme by default,
+// e.g. to register builders of several clusters
+func WithScheme(scheme string) Option {
+	return func(b *Builder) {
+		b.scheme = scheme
+	}
+}
+
+// Builder builds the resolvers of the targets of a cluster, it implements resolver.Builder.
+// The RoutingTableProvider must be connected by the application
+type Builder struct {
+	provider *helix.RoutingTableProvider
+	scheme   string
+}
+
+// NewBuilder creates a Builder resolving the targets with the routing table of the provider
+func NewBuilder(provider *helix.RoutingTableProvider, options ...Option) *Builder {
+	b := &Builder{
+		provider: provider,
+		scheme:   Scheme,
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Scheme returns the scheme of the targets resolved by the builder
+func (b *Builder) Scheme() string {
+	return b.scheme
+}
+
+// Build creates the resolver of the target, the addresses are sent to the client connection
+// before returning and after each refresh of the routing table until the resolver is closed
+func (b *Builder) Build(
+	target resolver.Target,
+	cc resolver.ClientConn,
+	_ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	query, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	r := &helixResolver{
+		provider: b.provider,
+		query:    query,
+		cc:       cc,
+	}
+	r.unsubscribe = b.provider.Subscribe(func(*helix.RoutingTable) { r.update() })
+	r.update()
+	return r, nil
+}
+
+// query selects the instances of a target
+type query struct {
+	resource  string
+	partition string
+	state     string
+	protocol  string
+}
+
+func parseTarget(target resolver.Target) (query, error) {
+	parts := strings.Split(strings.TrimPrefix(target.URL.Path, "/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] == "") {
+		return query{}, errors.Errorf("invalid helix target %q, expected %s:///{resource}[/{partition}]",
+			target.URL.String(), target.URL.Scheme)
+	}
+	q := query{
+		resource: parts[0],
+		state:    target.URL.Query().Get("state"),
+		protocol: target.URL.Query().Get("protocol"),
+	}
+	if len(parts) == 2 {
+		q.partition = parts[1]
+	}
+	if q.state == "" {
+		q.state = helix.StateModelStateOnline
+	}
+	return q, nil
+}
+
+// addresses returns the addresses of the instances selected in the routing table
+func (q query) addresses(table *helix.RoutingTable) []resolver.Address {
+	var configs []*model.InstanceConfig
+	if q.partition == "" {
+		configs = table.GetInstancesForResource(q.resource, q.state)
+	} else {
+		configs = table.GetInstances(q.resource, q.partition, q.state)
+	}
+	var addresses []resolver.Address
+	for _, config := range configs {
+		address := config.GetAddress()
+		if q.protocol != "" {
+			address, _ = config.GetEndpoint(q.protocol)
+		}
+		if address == "" {
+			continue
+		}
+		addresses = append(addresses, resolver.Address{
+			Addr:       address,
+			Attributes: attributes.New(instanceKey{}, config.ID),
+		})
+	}
+	return addresses
+}
+
+func (q query) String() string {
+	if q.partition == "" {
+		return q.resource + " in state " + q.state
+	}
+	return q.resource + "/" + q.partition + " in state " + q.state
+}
+
+// helixResolver sends the addresses of the instances of a target to a client connection
+type helixResolver struct {
+	provider    *helix.RoutingTableProvider
+	query       query
+	cc          resolver.ClientConn
+	unsubscribe func()
+
+	mu     sync.Mutex
+	closed bool
+	// sent are the addresses last sent, nil until the first update
+	sent []resolver.Address
+}
+
+// update sends the addresses of the latest routing table if they changed. The table is read with
+// the lock held, so concurrent updates never send the addresses of an older table last
+func (r *helixResolver) update() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	addresses := r.query.addresses(r.provider.GetRoutingTable())
+	if r.sent != nil && sameAddresses(r.sent, addresses) {
+		return
+	}
+	r.sent = append([]resolver.Address{}, addresses...)
+	if len(addresses) == 0 {
+		// the client connection backs off and calls ResolveNow
+		r.cc.ReportError(errors.Errorf("no live instance hosts %s", r.query))
+		return
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addresses}); err != nil {
+		// the addresses are sent again on the next ResolveNow
+		r.sent = nil
+	}
+}
+
+func sameAddresses(a, b []resolver.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveNow sends the addresses again, the routing table is kept updated by the provider
+func (r *helixResolver) ResolveNow(resolver.ResolveNowOptions) {
+	r.mu.Lock()
+	r.sent = nil
+	r.mu.Unlock()
+	r.update()
+}
+
+// Close stops sending the addresses of the target
+func (r *helixResolver) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.unsubscribe()
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package grpcresolver
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+)
+
+const testCluster = "grpc_cluster"
+
+// fakeClientConn records the addresses and the errors sent by a resolver
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+	errs   chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{
+		states: make(chan resolver.State, 10),
+		errs:   make(chan error, 10),
+	}
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) error {
+	cc.states <- state
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	cc.errs <- err
+}
+
+func (cc *fakeClientConn) receiveAddresses(t *testing.T) []string {
+	select {
+	case state := <-cc.states:
+		var addresses []string
+		for _, address := range state.Addresses {
+			addresses = append(addresses, address.Addr)
+		}
+		return addresses
+	case err := <-cc.errs:
+		assert.Fail(t, "unexpected resolver error", "%v", err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no addresses received")
+	}
+	return nil
+}
+
+func target(t *testing.T, rawURL string) resolver.Target {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return resolver.Target{URL: *u}
+}
+
+func TestResolver(t *testing.T) {
+	fakeZK := uzk.NewFakeZk(uzk.DefaultConnectionState(zk.StateHasSession))
+	client := uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+	admin, err := helix.NewAdminWithClient(client)
+	require.NoError(t, err)
+	require.True(t, admin.AddCluster(testCluster, false))
+
+	write := func(path string, record model.ZNRecord) {
+		data, err := record.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, client.CreateDataWithPath(path, data))
+	}
+	for _, name := range []string{"::1_1", "localhost_2"} {
+		host, port, err := model.ParseInstanceName(name)
+		require.NoError(t, err)
+		config := model.NewInstanceConfig(name)
+		config.SetHost(host)
+		config.SetPort(port)
+		if name == "::1_1" {
+			require.NoError(t, config.SetEndpoint("grpc", "[::1]:9090"))
+		}
+		write("/"+testCluster+"/CONFIGS/PARTICIPANT/"+name, config.ZNRecord)
+		write("/"+testCluster+"/LIVEINSTANCES/"+name, model.NewLiveInstance(name, "s").ZNRecord)
+	}
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "::1_1", helix.StateModelStateOnline)
+	view.SetState("r1_0", "localhost_2", helix.StateModelStateOnline)
+	view.SetState("r1_1", "localhost_2", helix.StateModelStateOffline)
+	write("/"+testCluster+"/EXTERNALVIEW/r1", view.ZNRecord)
+
+	provider := helix.NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", testCluster,
+		helix.WithRoutingZkClientOptions(uzk.WithConnFactory(fakeZK), uzk.WithRetryTimeout(time.Second)))
+	require.NoError(t, provider.Connect())
+	defer provider.Disconnect()
+	builder := NewBuilder(provider)
+	assert.Equal(t, Scheme, builder.Scheme())
+	assert.Equal(t, "other", NewBuilder(provider, WithScheme("other")).Scheme())
+
+	for _, rawURL := range []string{"helix:///", "helix:///r1/", "helix:///r1/r1_0/x"} {
+		_, err := builder.Build(target(t, rawURL), newFakeClientConn(), resolver.BuildOptions{})
+		assert.Error(t, err, rawURL)
+	}
+
+	// the host:port of the instance configs
+	partitionCC := newFakeClientConn()
+	r, err := builder.Build(target(t, "helix:///r1/r1_0"), partitionCC, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	state := <-partitionCC.states
+	require.Len(t, state.Addresses, 2)
+	assert.Equal(t, "[::1]:1", state.Addresses[0].Addr)
+	assert.Equal(t, "::1_1", InstanceName(state.Addresses[0]))
+	assert.Equal(t, "localhost:2", state.Addresses[1].Addr)
+	assert.Equal(t, "localhost_2", InstanceName(state.Addresses[1]))
+
+	// the advertised endpoints of the protocol
+	grpcCC := newFakeClientConn()
+	r, err = builder.Build(target(t, "helix:///r1/r1_0?protocol=grpc"), grpcCC, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, []string{"[::1]:9090"}, grpcCC.receiveAddresses(t))
+
+	// any partition of the resource in the state
+	resourceCC := newFakeClientConn()
+	r, err = builder.Build(target(t, "helix:///r1?state=OFFLINE"), resourceCC, resolver.BuildOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:2"}, resourceCC.receiveAddresses(t))
+	r.Close()
+
+	// the addresses follow the live instances
+	require.NoError(t, client.Delete("/"+testCluster+"/LIVEINSTANCES/localhost_2"))
+	assert.Equal(t, []string{"[::1]:1"}, partitionCC.receiveAddresses(t))
+	require.NoError(t, client.Delete("/"+testCluster+"/LIVEINSTANCES/::1_1"))
+	select {
+	case err := <-partitionCC.errs:
+		assert.Contains(t, err.Error(), "r1/r1_0")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no resolver error")
+	}
+	select {
+	case err := <-grpcCC.errs:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no resolver error")
+	}
+
+	// the closed resolvers are not updated
+	write("/"+testCluster+"/LIVEINSTANCES/localhost_2", model.NewLiveInstance("localhost_2", "s").ZNRecord)
+	assert.Equal(t, []string{"localhost:2"}, partitionCC.receiveAddresses(t))
+	select {
+	case state := <-resourceCC.states:
+		assert.Fail(t, "unexpected update of a closed resolver", "%+v", state)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
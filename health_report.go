@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+const _defaultHealthReportInterval = time.Minute
+
+// HealthReporter provides the health metrics published by the participant,
+// mirrors org.apache.helix.healthcheck.HealthReportProvider
+type HealthReporter interface {
+	// ReportName returns the name of the report under INSTANCES/{instance}/HEALTHREPORT
+	ReportName() string
+	// Report returns the health stats, stat name -> field -> value
+	Report() (map[string]map[string]string, error)
+}
+
+// WithHealthReporter adds a HealthReporter whose report is published periodically
+// while the participant is connected, and removed when the participant disconnects
+func WithHealthReporter(reporter HealthReporter) ParticipantOption {
+	return func(p *participant) {
+		p.healthReporters = append(p.healthReporters, reporter)
+	}
+}
+
+// WithHealthReportInterval configures how often the health reports are published
+func WithHealthReportInterval(interval time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.healthReportInterval = interval
+	}
+}
+
+// startHealthReports publishes the health reports until the next session or disconnection,
+// reports left by reporters which are no longer registered are removed
+func (p *participant) startHealthReports() {
+	if len(p.healthReporters) == 0 {
+		return
+	}
+	p.stopHealthReports()
+	p.removeStaleHealthReports()
+	p.publishHealthReports()
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	p.healthReportMu.Lock()
+	p.healthReportStopCh = stopCh
+	p.healthReportDoneCh = doneCh
+	p.healthReportMu.Unlock()
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(p.healthReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.publishHealthReports()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stopHealthReports stops publishing the health reports and waits for the publisher to return
+func (p *participant) stopHealthReports() {
+	p.healthReportMu.Lock()
+	stopCh, doneCh := p.healthReportStopCh, p.healthReportDoneCh
+	p.healthReportStopCh, p.healthReportDoneCh = nil, nil
+	p.healthReportMu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
+func (p *participant) publishHealthReports() {
+	for _, reporter := range p.healthReporters {
+		if err := p.publishHealthReport(reporter); err != nil {
+			p.scope.Counter("health-report-errors").Inc(1)
+			p.logger.Warn("failed to publish health report",
+				util.Field("report", reporter.ReportName()), util.ErrorField(err))
+		}
+	}
+}
+
+func (p *participant) publishHealthReport(reporter HealthReporter) error {
+	var stats map[string]map[string]string
+	err := p.safeCall(Crash{Callback: CallbackHealthReporter}, func() error {
+		var err error
+		stats, err = reporter.Report()
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "health reporter failed")
+	}
+	path := p.keyBuilder.healthReportForName(p.instanceName, reporter.ReportName())
+	return p.dataAccessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		report := model.NewHealthStat(reporter.ReportName())
+		if data != nil {
+			report.Version = data.Version
+		}
+		report.SetStats(stats)
+		report.SetTimestamp(time.Now())
+		return &report.ZNRecord, nil
+	})
+}
+
+// removeStaleHealthReports removes the reports which are not published by any registered reporter
+func (p *participant) removeStaleHealthReports() {
+	names := util.NewStringSet()
+	for _, reporter := range p.healthReporters {
+		names.Add(reporter.ReportName())
+	}
+	reports, err := p.zkClient.Children(p.keyBuilder.healthReport(p.instanceName))
+	if err != nil {
+		p.logger.Warn("failed to list health reports", util.ErrorField(err))
+		return
+	}
+	for _, report := range reports {
+		if !names.Contains(report) {
+			p.removeHealthReport(report)
+		}
+	}
+}
+
+func (p *participant) removeHealthReports() {
+	for _, reporter := range p.healthReporters {
+		p.removeHealthReport(reporter.ReportName())
+	}
+}
+
+func (p *participant) removeHealthReport(reportName string) {
+	path := p.keyBuilder.healthReportForName(p.instanceName, reportName)
+	if err := p.zkClient.Delete(path); err != nil && errors.Cause(err) != zk.ErrNoNode {
+		p.logger.Warn("failed to remove health report", util.Field("path", path), util.ErrorField(err))
+	}
+}
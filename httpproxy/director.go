@@ -0,0 +1,219 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package httpproxy routes the HTTP requests of a sharded service to the live instances serving
+// the partitions of their keys, as the Director of an httputil.ReverseProxy:
+//
+//	director := httpproxy.NewDirector(logger, scope, provider, "myDB", 64, httpproxy.HeaderKey("X-Shard-Key"))
+//	proxy := &httputil.ReverseProxy{Director: director.Direct}
+//
+// The key of a request is hashed to a partition of the resource, named {resource}_{index} as Helix
+// names them, and the request is sent to an instance where the partition is ONLINE. The routes are
+// rebuilt after each refresh of the routing table, i.e. on the changes of the external view.
+package httpproxy
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/partitioner"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// ErrNoKey is returned when the request has no partition key
+var ErrNoKey = errors.New("helix proxy: request has no partition key")
+
+// KeyFunc returns the partition key of the request, an empty key if there is none
+type KeyFunc func(req *http.Request) string
+
+// HeaderKey reads the partition key from the header
+func HeaderKey(name string) KeyFunc {
+	return func(req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+// QueryKey reads the partition key from the query parameter
+func QueryKey(name string) KeyFunc {
+	return func(req *http.Request) string {
+		return req.URL.Query().Get(name)
+	}
+}
+
+// Partitioner maps a key to the index of its partition in [0, numPartitions), the partitioner
+// package has the partitioners compatible with the Java ones
+type Partitioner = partitioner.Func
+
+// HashPartitioner is the default Partitioner, the FNV-1a hash of the key modulo the partitions
+func HashPartitioner(key string, numPartitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(numPartitions))
+}
+
+// DirectorOption configures a Director
+type DirectorOption func(*Director)
+
+// WithPartitioner sets how the keys are mapped to partitions, HashPartitioner by default
+func WithPartitioner(partitioner Partitioner) DirectorOption {
+	return func(d *Director) {
+		d.partitioner = partitioner
+	}
+}
+
+// WithState routes to the instances where the partition is in the state, ONLINE by default,
+// e.g. MASTER to send the writes to the master replica
+func WithState(state string) DirectorOption {
+	return func(d *Director) {
+		d.state = state
+	}
+}
+
+// WithProtocol routes to the endpoints of the protocol advertised by the participants with
+// helix.WithAdvertisedEndpoint instead of the host and port of the instances
+func WithProtocol(protocol string) DirectorOption {
+	return func(d *Director) {
+		d.protocol = protocol
+	}
+}
+
+// WithScheme sets the scheme of the proxied requests, http by default
+func WithScheme(scheme string) DirectorOption {
+	return func(d *Director) {
+		d.scheme = scheme
+	}
+}
+
+// Director routes the requests to the instances serving the partitions of their keys
+type Director struct {
+	logger        *zap.Logger
+	scope         tally.Scope
+	resource      string
+	numPartitions int
+	key           KeyFunc
+	partitioner   Partitioner
+	state         string
+	protocol      string
+	scheme        string
+	unsubscribe   func()
+
+	mu sync.RWMutex
+	// routes are the addresses of the instances serving each partition
+	routes map[string][]string
+	// next spreads the requests among the replicas of the partitions
+	next uint32
+}
+
+// NewDirector creates a Director of the resource of numPartitions partitions, routing with the
+// routing table of the provider. The provider must be connected by the application
+func NewDirector(
+	logger *zap.Logger,
+	scope tally.Scope,
+	provider *helix.RoutingTableProvider,
+	resource string,
+	numPartitions int,
+	key KeyFunc,
+	options ...DirectorOption,
+) *Director {
+	d := &Director{
+		logger:        logger.With(zap.String("resource", resource)),
+		scope:         scope.SubScope("helix.proxy").Tagged(map[string]string{"resource": resource}),
+		resource:      resource,
+		numPartitions: numPartitions,
+		key:           key,
+		partitioner:   HashPartitioner,
+		state:         helix.StateModelStateOnline,
+		scheme:        "http",
+	}
+	for _, option := range options {
+		option(d)
+	}
+	d.unsubscribe = provider.Subscribe(d.update)
+	d.update(provider.GetRoutingTable())
+	return d
+}
+
+// update rebuilds the routes from the routing table
+func (d *Director) update(table *helix.RoutingTable) {
+	routes := map[string][]string{}
+	for _, partition := range table.GetPartitions(d.resource) {
+		for _, config := range table.GetInstances(d.resource, partition, d.state) {
+			address := config.GetAddress()
+			if d.protocol != "" {
+				address, _ = config.GetEndpoint(d.protocol)
+			}
+			if address != "" {
+				routes[partition] = append(routes[partition], address)
+			}
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = routes
+}
+
+// Partition returns the name of the partition of the key
+func (d *Director) Partition(key string) string {
+	return d.partitioner.Partition(d.resource, key, d.numPartitions)
+}
+
+// Route returns the address of an instance serving the partition of the key, the requests of
+// a partition are spread among its replicas
+func (d *Director) Route(key string) (string, error) {
+	partition := d.Partition(key)
+	d.mu.RLock()
+	addresses := d.routes[partition]
+	d.mu.RUnlock()
+	if len(addresses) == 0 {
+		return "", errors.Errorf("helix proxy: no live instance serves partition %s in state %s", partition, d.state)
+	}
+	return addresses[int(atomic.AddUint32(&d.next, 1)-1)%len(addresses)], nil
+}
+
+// Direct rewrites the URL of the request to the instance serving the partition of its key, it is
+// the Director of an httputil.ReverseProxy. The host of a request that cannot be routed is left
+// empty, so the proxy fails it with a 502 Bad Gateway
+func (d *Director) Direct(req *http.Request) {
+	req.URL.Scheme = d.scheme
+	req.URL.Host = ""
+	key := d.key(req)
+	if key == "" {
+		d.scope.Counter("no-route").Inc(1)
+		d.logger.Warn("failed to route request", zap.String("path", req.URL.Path), zap.Error(ErrNoKey))
+		return
+	}
+	address, err := d.Route(key)
+	if err != nil {
+		d.scope.Counter("no-route").Inc(1)
+		d.logger.Warn("failed to route request", zap.String("path", req.URL.Path), zap.Error(err))
+		return
+	}
+	req.URL.Host = address
+}
+
+// Close stops rebuilding the routes
+func (d *Director) Close() {
+	d.unsubscribe()
+}
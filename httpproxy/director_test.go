@@ -0,0 +1,140 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package httpproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const testCluster = "proxy_cluster"
+
+func TestHashPartitioner(t *testing.T) {
+	for _, key := range []string{"", "a", "key", "another key"} {
+		partition := HashPartitioner(key, 7)
+		assert.True(t, partition >= 0 && partition < 7)
+		assert.Equal(t, partition, HashPartitioner(key, 7))
+	}
+}
+
+func TestDirector(t *testing.T) {
+	fakeZK := uzk.NewFakeZk(uzk.DefaultConnectionState(zk.StateHasSession))
+	client := uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+	admin, err := helix.NewAdminWithClient(client)
+	require.NoError(t, err)
+	require.True(t, admin.AddCluster(testCluster, false))
+	write := func(path string, record model.ZNRecord) {
+		data, err := record.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, client.CreateDataWithPath(path, data))
+	}
+
+	// one backend per partition, answering with the partition it serves
+	view := model.NewExternalView("r")
+	var instances []string
+	for i := 0; i < 2; i++ {
+		partition := "r_" + strconv.Itoa(i)
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, partition+" "+r.URL.Path)
+		}))
+		defer backend.Close()
+		u, err := url.Parse(backend.URL)
+		require.NoError(t, err)
+		host, port, err := model.ParseInstanceName(u.Hostname() + "_" + u.Port())
+		require.NoError(t, err)
+		name := model.InstanceName(host, port)
+		config := model.NewInstanceConfig(name)
+		config.SetHost(host)
+		config.SetPort(port)
+		write("/"+testCluster+"/CONFIGS/PARTICIPANT/"+name, config.ZNRecord)
+		write("/"+testCluster+"/LIVEINSTANCES/"+name, model.NewLiveInstance(name, "s").ZNRecord)
+		view.SetState(partition, name, helix.StateModelStateOnline)
+		instances = append(instances, name)
+	}
+	write("/"+testCluster+"/EXTERNALVIEW/r", view.ZNRecord)
+
+	provider := helix.NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", testCluster,
+		helix.WithRoutingZkClientOptions(uzk.WithConnFactory(fakeZK), uzk.WithRetryTimeout(time.Second)))
+	require.NoError(t, provider.Connect())
+	defer provider.Disconnect()
+	scope := tally.NewTestScope("", nil)
+	// the keys are the indexes of their partitions
+	partitioner := func(key string, numPartitions int) int {
+		i, _ := strconv.Atoi(key)
+		return i % numPartitions
+	}
+	director := NewDirector(zap.NewNop(), scope, provider, "r", 2, QueryKey("key"),
+		WithPartitioner(partitioner))
+	defer director.Close()
+	assert.Equal(t, "r_1", director.Partition("3"))
+	proxy := httptest.NewServer(&httputil.ReverseProxy{Director: director.Direct})
+	defer proxy.Close()
+
+	get := func(rawQuery string) (int, string) {
+		resp, err := http.Get(proxy.URL + "/path?" + rawQuery)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+	status, body := get("key=0")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "r_0 /path", body)
+	status, body = get("key=1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "r_1 /path", body)
+	status, _ = get("other=1")
+	assert.Equal(t, http.StatusBadGateway, status)
+
+	// the routes follow the live instances
+	require.NoError(t, client.Delete("/"+testCluster+"/LIVEINSTANCES/"+instances[0]))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := director.Route("0"); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	status, _ = get("key=0")
+	assert.Equal(t, http.StatusBadGateway, status)
+	status, _ = get("key=1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), scope.Snapshot().Counters()["helix.proxy.no-route+resource=r"].Value())
+}
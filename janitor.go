@@ -0,0 +1,286 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultJanitorInterval is the default interval the janitor cleans the cluster at
+	DefaultJanitorInterval = 10 * time.Minute
+	// DefaultJanitorRetention is the default age after which the janitor deletes the errors,
+	// the status updates and the current states of the sessions of the instances not live
+	DefaultJanitorRetention = 7 * 24 * time.Hour
+	// DefaultJanitorSessionGrace is the default age of a live instance after which the
+	// current states of its previous sessions are deleted, they are carried over before
+	DefaultJanitorSessionGrace = time.Minute
+	// DefaultJanitorDeleteRate is the default number of znodes the janitor deletes per second
+	DefaultJanitorDeleteRate = 10
+)
+
+// JanitorOption configures optional settings of a Janitor
+type JanitorOption func(*Janitor)
+
+// WithJanitorInterval sets the interval the janitor cleans the cluster at
+func WithJanitorInterval(interval time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.interval = interval
+	}
+}
+
+// WithJanitorRetention sets the age after which the errors, the status updates and the
+// current states of the sessions of the instances not live are deleted
+func WithJanitorRetention(retention time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.retention = retention
+	}
+}
+
+// WithJanitorSessionGrace sets the age of a live instance after which the current states
+// of its previous sessions are deleted
+func WithJanitorSessionGrace(grace time.Duration) JanitorOption {
+	return func(j *Janitor) {
+		j.sessionGrace = grace
+	}
+}
+
+// WithJanitorDeleteRate limits the znodes deleted per second, to spare Zookeeper
+// when a lot of garbage has piled up
+func WithJanitorDeleteRate(perSecond int) JanitorOption {
+	return func(j *Janitor) {
+		j.deleteRate = perSecond
+	}
+}
+
+// Janitor periodically deletes the garbage the participants leave in the INSTANCES of a
+// cluster, which would otherwise grow without bound in long-lived clusters:
+// the CURRENTSTATES of the expired sessions, and the ERRORS and STATUSUPDATES older than
+// the retention. The current states of the previous sessions of a live instance are deleted
+// once the instance is live for the session grace, those of an instance not live once they
+// are older than the retention
+type Janitor struct {
+	logger       *zap.Logger
+	scope        tally.Scope
+	zkClient     *uzk.Client
+	keyBuilder   *KeyBuilder
+	interval     time.Duration
+	retention    time.Duration
+	sessionGrace time.Duration
+	deleteRate   int
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewJanitor creates a Janitor of the cluster
+func NewJanitor(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	clusterName string,
+	options ...JanitorOption,
+) *Janitor {
+	j := &Janitor{
+		logger:       logger.With(zap.String("cluster", clusterName)),
+		scope:        scope.SubScope("helix.janitor").Tagged(map[string]string{"cluster": clusterName}),
+		keyBuilder:   &KeyBuilder{clusterName},
+		interval:     DefaultJanitorInterval,
+		retention:    DefaultJanitorRetention,
+		sessionGrace: DefaultJanitorSessionGrace,
+		deleteRate:   DefaultJanitorDeleteRate,
+	}
+	for _, option := range options {
+		option(j)
+	}
+	j.zkClient = uzk.NewClient(logger, scope, uzk.WithZkSvr(zkConnectString),
+		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout))
+	return j
+}
+
+// Connect connects to Zookeeper and cleans the cluster every interval until Disconnect
+func (j *Janitor) Connect() error {
+	if j.stopCh != nil {
+		return nil
+	}
+	if err := j.zkClient.Connect(); err != nil {
+		return errors.Wrap(err, "helix janitor")
+	}
+	j.stopCh = make(chan struct{})
+	j.doneCh = make(chan struct{})
+	go j.run()
+	return nil
+}
+
+// Disconnect stops cleaning the cluster and disconnects from Zookeeper
+func (j *Janitor) Disconnect() {
+	if j.stopCh != nil {
+		close(j.stopCh)
+		<-j.doneCh
+		j.stopCh = nil
+	}
+	j.zkClient.Disconnect()
+}
+
+// Clean deletes the garbage of the instances of the cluster without waiting for the interval,
+// it returns early if the janitor is disconnected
+func (j *Janitor) Clean() error {
+	// pace paces the deletes at the delete rate, it is nil if the deletes are not limited
+	var pace <-chan time.Time
+	if j.deleteRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(j.deleteRate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	instances, err := j.zkClient.Children(j.keyBuilder.instances())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, instance := range instances {
+		if err := j.cleanCurrentStates(instance, now, pace); err != nil {
+			return errors.Wrapf(err, "failed to clean the current states of %s", instance)
+		}
+		for _, p := range []string{j.keyBuilder.errorsR(instance), j.keyBuilder.statusUpdates(instance)} {
+			if _, err := j.purge(p, now.Add(-j.retention), true, pace); err != nil {
+				return errors.Wrapf(err, "failed to clean %s", p)
+			}
+		}
+	}
+	return nil
+}
+
+// cleanCurrentStates deletes the current states of the expired sessions of the instance
+func (j *Janitor) cleanCurrentStates(instance string, now time.Time, pace <-chan time.Time) error {
+	sessions, err := j.zkClient.Children(j.keyBuilder.currentStates(instance))
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	data, stat, err := j.zkClient.Get(j.keyBuilder.liveInstance(instance))
+	live := err == nil
+	if err != nil && errors.Cause(err) != zk.ErrNoNode {
+		return err
+	}
+	liveSession := ""
+	if live {
+		record, err := model.NewRecordFromBytes(data)
+		if err != nil {
+			return err
+		}
+		liveSession = (&model.LiveInstance{ZNRecord: *record}).GetSessionID()
+		// the previous sessions are carried over once the live instance is created
+		if now.Sub(statTime(stat.Ctime)) < j.sessionGrace {
+			return nil
+		}
+	}
+	for _, session := range sessions {
+		if session == liveSession {
+			continue
+		}
+		// the sessions replaced by the live one are expired whatever their age
+		cutoff := now
+		if !live {
+			cutoff = now.Add(-j.retention)
+		}
+		if _, err := j.purge(j.keyBuilder.currentStatesForSession(instance, session), cutoff, false, pace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge deletes the znodes of the tree at p last modified before the cutoff, deepest first.
+// The parents are deleted once their children are, unless keepRoot. It returns if the whole
+// tree is deleted
+func (j *Janitor) purge(p string, cutoff time.Time, keepRoot bool, pace <-chan time.Time) (bool, error) {
+	children, err := j.zkClient.Children(p)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	empty := true
+	for _, child := range children {
+		deleted, err := j.purge(path.Join(p, child), cutoff, false, pace)
+		if err != nil {
+			return false, err
+		}
+		empty = empty && deleted
+	}
+	if keepRoot || !empty {
+		return false, nil
+	}
+	exists, stat, err := j.zkClient.Exists(p)
+	if err != nil || !exists {
+		return !exists, err
+	}
+	if !statTime(stat.Mtime).Before(cutoff) {
+		return false, nil
+	}
+	if pace != nil {
+		select {
+		case <-pace:
+		case <-j.stopCh:
+			return false, errors.New("helix janitor disconnected")
+		}
+	}
+	err = j.zkClient.Delete(p)
+	if cause := errors.Cause(err); cause == zk.ErrNotEmpty {
+		// a child was created since
+		return false, nil
+	} else if cause != nil && cause != zk.ErrNoNode {
+		return false, err
+	}
+	j.scope.Counter("deleted-znodes").Inc(1)
+	return true, nil
+}
+
+func (j *Janitor) run() {
+	defer close(j.doneCh)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stopCh:
+			return
+		case <-ticker.C:
+			if err := j.Clean(); err != nil {
+				j.scope.Counter("clean-failures").Inc(1)
+				j.logger.Warn("failed to clean the cluster", zap.Error(err))
+			}
+		}
+	}
+}
+
+// statTime returns the time of the milliseconds of a znode stat
+func statTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
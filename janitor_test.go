@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestJanitor(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1", "localhost_2")
+	defer cluster.close()
+	fakeZK, client, keyBuilder, accessor := cluster.zk, cluster.client, cluster.keyBuilder, cluster.accessor
+	assert.NoError(t, accessor.createData(keyBuilder.liveInstance("localhost_1"), model.NewLiveInstance("localhost_1", "live").ZNRecord))
+	paths := []string{
+		keyBuilder.currentStateForResource("localhost_1", "live", "r1"),
+		keyBuilder.currentStateForResource("localhost_1", "expired", "r1"),
+		keyBuilder.currentStateForResource("localhost_2", "last", "r1"),
+		keyBuilder.errors("localhost_1", "live", "r1"),
+		keyBuilder.statusUpdates("localhost_2") + "/last/r1",
+	}
+	for _, p := range paths {
+		assert.NoError(t, client.CreateDataWithPath(p, []byte("{}")))
+	}
+	exists := func(p string) bool {
+		exists, _, err := client.Exists(p)
+		assert.NoError(t, err)
+		return exists
+	}
+
+	scope := tally.NewTestScope("", nil)
+	janitor := NewJanitor(zap.NewNop(), scope, "", TestClusterName, WithJanitorRetention(100*time.Millisecond),
+		WithJanitorSessionGrace(0), WithJanitorDeleteRate(1000))
+	janitor.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	assert.NoError(t, janitor.Connect())
+	defer janitor.Disconnect()
+
+	// only the session replaced by the live one is expired before the retention
+	assert.NoError(t, janitor.Clean())
+	assert.False(t, exists(keyBuilder.currentStatesForSession("localhost_1", "expired")))
+	for _, p := range []string{paths[0], paths[2], paths[3], paths[4]} {
+		assert.True(t, exists(p), p)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, janitor.Clean())
+	assert.True(t, exists(paths[0]))
+	assert.False(t, exists(keyBuilder.currentStatesForSession("localhost_2", "last")))
+	assert.False(t, exists(keyBuilder.errors("localhost_1", "live", "r1")))
+	assert.False(t, exists(keyBuilder.statusUpdates("localhost_2")+"/last"))
+	assert.True(t, exists(keyBuilder.errorsR("localhost_1")))
+	assert.True(t, exists(keyBuilder.statusUpdates("localhost_2")))
+	assert.NotZero(t, scope.Snapshot().Counters()["helix.janitor.deleted-znodes+cluster="+TestClusterName].Value())
+}
@@ -38,14 +38,26 @@ func (b *KeyBuilder) clusterConfig() string {
 	return fmt.Sprintf("/%s/CONFIGS/CLUSTER/%s", b.clusterName, b.clusterName)
 }
 
+func (b *KeyBuilder) constraints(constraintType string) string {
+	return fmt.Sprintf("/%s/CONFIGS/CONSTRAINT/%s", b.clusterName, constraintType)
+}
+
 func (b *KeyBuilder) controller() string {
 	return fmt.Sprintf("/%s/CONTROLLER", b.clusterName)
 }
 
+func (b *KeyBuilder) controllerLeader() string {
+	return fmt.Sprintf("/%s/CONTROLLER/LEADER", b.clusterName)
+}
+
 func (b *KeyBuilder) controllerMessages() string {
 	return fmt.Sprintf("/%s/CONTROLLER/MESSAGES", b.clusterName)
 }
 
+func (b *KeyBuilder) controllerMsg(messageID string) string {
+	return fmt.Sprintf("/%s/CONTROLLER/MESSAGES/%s", b.clusterName, messageID)
+}
+
 func (b *KeyBuilder) controllerErrors() string {
 	return fmt.Sprintf("/%s/CONTROLLER/ERRORS", b.clusterName)
 }
@@ -54,6 +66,15 @@ func (b *KeyBuilder) controllerStatusUpdates() string {
 	return fmt.Sprintf("/%s/CONTROLLER/STATUSUPDATES", b.clusterName)
 }
 
+func (b *KeyBuilder) pause() string {
+	return fmt.Sprintf("/%s/CONTROLLER/PAUSE", b.clusterName)
+}
+
+// maintenance is the signal of the maintenance mode set by Java Helix
+func (b *KeyBuilder) maintenance() string {
+	return fmt.Sprintf("/%s/CONTROLLER/MAINTENANCE", b.clusterName)
+}
+
 func (b *KeyBuilder) controllerHistory() string {
 	return fmt.Sprintf("/%s/CONTROLLER/HISTORY", b.clusterName)
 }
@@ -66,6 +87,14 @@ func (b *KeyBuilder) externalViewForResource(resource string) string {
 	return fmt.Sprintf("/%s/EXTERNALVIEW/%s", b.clusterName, resource)
 }
 
+func (b *KeyBuilder) targetExternalView() string {
+	return fmt.Sprintf("/%s/TARGETEXTERNALVIEW", b.clusterName)
+}
+
+func (b *KeyBuilder) targetExternalViewForResource(resource string) string {
+	return fmt.Sprintf("/%s/TARGETEXTERNALVIEW/%s", b.clusterName, resource)
+}
+
 func (b *KeyBuilder) propertyStore() string {
 	return fmt.Sprintf("/%s/PROPERTYSTORE", b.clusterName)
 }
@@ -107,6 +136,10 @@ func (b *KeyBuilder) instance(participantID string) string {
 	return fmt.Sprintf("/%s/INSTANCES/%s", b.clusterName, participantID)
 }
 
+func (b *KeyBuilder) participantHistory(participantID string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/HISTORY", b.clusterName, participantID)
+}
+
 func (b *KeyBuilder) liveInstance(partipantID string) string {
 	return fmt.Sprintf("/%s/LIVEINSTANCES/%s", b.clusterName, partipantID)
 }
@@ -125,6 +158,32 @@ func (b *KeyBuilder) currentStateForResource(
 		"/%s/INSTANCES/%s/CURRENTSTATES/%s/%s", b.clusterName, participantID, sessionID, resourceID)
 }
 
+func (b *KeyBuilder) customizedStates(participantID string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/CUSTOMIZEDSTATES", b.clusterName, participantID)
+}
+
+func (b *KeyBuilder) customizedStatesForType(participantID string, stateType string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/CUSTOMIZEDSTATES/%s", b.clusterName, participantID, stateType)
+}
+
+func (b *KeyBuilder) customizedStateForResource(
+	participantID string, stateType string, resourceID string) string {
+	return fmt.Sprintf(
+		"/%s/INSTANCES/%s/CUSTOMIZEDSTATES/%s/%s", b.clusterName, participantID, stateType, resourceID)
+}
+
+func (b *KeyBuilder) customizedView() string {
+	return fmt.Sprintf("/%s/CUSTOMIZEDVIEW", b.clusterName)
+}
+
+func (b *KeyBuilder) customizedViewsForType(stateType string) string {
+	return fmt.Sprintf("/%s/CUSTOMIZEDVIEW/%s", b.clusterName, stateType)
+}
+
+func (b *KeyBuilder) customizedViewForResource(stateType string, resource string) string {
+	return fmt.Sprintf("/%s/CUSTOMIZEDVIEW/%s/%s", b.clusterName, stateType, resource)
+}
+
 func (b *KeyBuilder) errorsR(participantID string) string {
 	return fmt.Sprintf("/%s/INSTANCES/%s/ERRORS", b.clusterName, participantID)
 }
@@ -134,10 +193,26 @@ func (b *KeyBuilder) errors(participantID string, sessionID string, resourceID s
 		"/%s/INSTANCES/%s/ERRORS/%s/%s", b.clusterName, participantID, sessionID, resourceID)
 }
 
+func (b *KeyBuilder) stateTransitionStatus(
+	participantID string, sessionID string, resourceID string, recordID string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/STATUSUPDATES/%s/%s/%s",
+		b.clusterName, participantID, sessionID, resourceID, recordID)
+}
+
+func (b *KeyBuilder) stateTransitionError(
+	participantID string, sessionID string, resourceID string, partition string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/ERRORS/%s/%s/%s",
+		b.clusterName, participantID, sessionID, resourceID, partition)
+}
+
 func (b *KeyBuilder) healthReport(participantID string) string {
 	return fmt.Sprintf("/%s/INSTANCES/%s/HEALTHREPORT", b.clusterName, participantID)
 }
 
+func (b *KeyBuilder) healthReportForName(participantID string, reportName string) string {
+	return fmt.Sprintf("/%s/INSTANCES/%s/HEALTHREPORT/%s", b.clusterName, participantID, reportName)
+}
+
 func (b *KeyBuilder) statusUpdates(participantID string) string {
 	return fmt.Sprintf("/%s/INSTANCES/%s/STATUSUPDATES", b.clusterName, participantID)
 }
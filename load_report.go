@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+)
+
+// LoadReporter provides the load of the participant, the usage and the capacity of metrics
+// like CPU, disk or custom gauges, so the rebalancers can factor the live load into the placement
+type LoadReporter interface {
+	// Load returns the current usage and the capacity by metric
+	Load() (load map[string]float64, capacity map[string]float64, err error)
+}
+
+// WithLoadReporter publishes the load of the reporter with the health reports, as the
+// model.InstanceLoad under INSTANCES/{instance}/HEALTHREPORT/LOAD. The rebalancers read
+// the loads of the live instances from ClusterDataCache.InstanceLoads
+func WithLoadReporter(reporter LoadReporter) ParticipantOption {
+	return WithHealthReporter(loadHealthReporter{reporter})
+}
+
+// loadHealthReporter publishes the load of a LoadReporter as a health report
+type loadHealthReporter struct {
+	reporter LoadReporter
+}
+
+func (r loadHealthReporter) ReportName() string {
+	return model.LoadReportName
+}
+
+func (r loadHealthReporter) Report() (map[string]map[string]string, error) {
+	load, capacity, err := r.reporter.Load()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]map[string]string{
+		model.LoadStatLoad:     formatFloats(load),
+		model.LoadStatCapacity: formatFloats(capacity),
+	}, nil
+}
+
+func formatFloats(values map[string]float64) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	return result
+}
+
+// InstanceLoad returns the load report of the instance
+func (a *DataAccessor) InstanceLoad(instanceName string) (*model.InstanceLoad, error) {
+	record, err := a.record(a.keyBuilder.healthReportForName(instanceName, model.LoadReportName))
+	if err != nil {
+		return nil, err
+	}
+	return &model.InstanceLoad{HealthStat: model.HealthStat{ZNRecord: *record}}, nil
+}
+
+// readInstanceLoads returns the load reports of the instances by instance,
+// the instances without load report are left out
+func readInstanceLoads(accessor *DataAccessor, instances map[string]*model.LiveInstance) (
+	map[string]*model.InstanceLoad, error) {
+	loads := make(map[string]*model.InstanceLoad, len(instances))
+	for instance := range instances {
+		load, err := accessor.InstanceLoad(instance)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		loads[instance] = load
+	}
+	return loads, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type testLoadReporter struct{}
+
+func (testLoadReporter) Load() (map[string]float64, map[string]float64, error) {
+	return map[string]float64{"CPU": 2.5}, map[string]float64{"CPU": 10}, nil
+}
+
+func TestLoadReport(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	accessor := cluster.accessor
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithLoadReporter(testLoadReporter{}),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+
+	load, err := accessor.InstanceLoad(p.InstanceName())
+	assert.NoError(t, err)
+	utilization, ok := load.GetUtilization("CPU")
+	assert.True(t, ok)
+	assert.Equal(t, 0.25, utilization)
+	assert.NotZero(t, load.GetTimestamp())
+
+	cache, err := loadClusterDataCache(accessor)
+	assert.NoError(t, err)
+	assert.Contains(t, cache.InstanceLoads, p.InstanceName())
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The components whose log levels are changed at runtime by SetLogLevel
+const (
+	LogComponentZk          = uzk.LogComponent
+	LogComponentParticipant = "participant"
+	LogComponentSpectator   = "spectator"
+	LogComponentController  = "controller"
+)
+
+// SetLogLevel changes the log level of the component at runtime, e.g. to DebugLevel for
+// LogComponentZk while debugging an incident. The level filters the lines of the loggers passed
+// to the components, the lines are written if these loggers also enable their level.
+// The levels start at DebugLevel
+func SetLogLevel(component string, level zapcore.Level) {
+	util.LogLevel(component).SetLevel(level)
+}
+
+// GetLogLevel returns the runtime log level of the component
+func GetLogLevel(component string) zapcore.Level {
+	return util.LogLevel(component).Level()
+}
+
+// LogField is a key-value pair of a structured log line
+type LogField = util.LogField
+
+// Logger is the minimal logger the Helix components log to, for the users of other logging
+// libraries than zap, e.g. logrus or zerolog. The participants, controllers and spectators take
+// it with WithParticipantLogger, WithControllerLogger and WithRoutingLogger, the zk clients with
+// zk.WithLogger. The log lines carry the cluster, instance, resource and partition they are about
+// as fields
+type Logger = util.Logger
+
+// NewZapLogger returns a zap logger writing to the Logger, for the constructors still taking a
+// zap logger, e.g. NewPipeline. The DPanic, Panic and Fatal lines are written as errors
+func NewZapLogger(logger Logger) *zap.Logger {
+	return zap.New(&loggerCore{logger: logger})
+}
+
+// NewLoggerFromZap adapts a zap logger to the Logger interface
+func NewLoggerFromZap(logger *zap.Logger) Logger {
+	return util.LoggerFromZap(logger)
+}
+
+// loggerCore is the zapcore.Core writing to a Logger
+type loggerCore struct {
+	logger Logger
+}
+
+func (c *loggerCore) Enabled(zapcore.Level) bool {
+	// the Logger filters the levels
+	return true
+}
+
+func (c *loggerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &loggerCore{logger: c.logger.With(logFields(fields)...)}
+}
+
+func (c *loggerCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return checked.AddCore(entry, c)
+}
+
+func (c *loggerCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	logger := c.logger
+	if entry.LoggerName != "" {
+		logger = logger.With(LogField{Key: "logger", Value: entry.LoggerName})
+	}
+	switch entry.Level {
+	case zapcore.DebugLevel:
+		logger.Debug(entry.Message, logFields(fields)...)
+	case zapcore.InfoLevel:
+		logger.Info(entry.Message, logFields(fields)...)
+	case zapcore.WarnLevel:
+		logger.Warn(entry.Message, logFields(fields)...)
+	default:
+		logger.Error(entry.Message, logFields(fields)...)
+	}
+	return nil
+}
+
+func (c *loggerCore) Sync() error {
+	return nil
+}
+
+// logFields converts the zap fields to LogFields sorted by key
+func logFields(fields []zapcore.Field) []LogField {
+	if len(fields) == 0 {
+		return nil
+	}
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	result := make([]LogField, 0, len(encoder.Fields))
+	for key, value := range encoder.Fields {
+		result = append(result, LogField{Key: key, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// NewSlogLogger adapts a log/slog logger to the Logger interface
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogAdapter{logger}
+}
+
+// slogAdapter is the Logger writing to a slog logger
+type slogAdapter struct {
+	logger *slog.Logger
+}
+
+func (a slogAdapter) Debug(msg string, fields ...LogField) {
+	a.logger.LogAttrs(context.Background(), slog.LevelDebug, msg, slogAttrs(fields)...)
+}
+
+func (a slogAdapter) Info(msg string, fields ...LogField) {
+	a.logger.LogAttrs(context.Background(), slog.LevelInfo, msg, slogAttrs(fields)...)
+}
+
+func (a slogAdapter) Warn(msg string, fields ...LogField) {
+	a.logger.LogAttrs(context.Background(), slog.LevelWarn, msg, slogAttrs(fields)...)
+}
+
+func (a slogAdapter) Error(msg string, fields ...LogField) {
+	a.logger.LogAttrs(context.Background(), slog.LevelError, msg, slogAttrs(fields)...)
+}
+
+func (a slogAdapter) With(fields ...LogField) Logger {
+	args := make([]interface{}, 0, len(fields))
+	for _, attr := range slogAttrs(fields) {
+		args = append(args, attr)
+	}
+	return slogAdapter{a.logger.With(args...)}
+}
+
+func slogAttrs(fields []LogField) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+	return attrs
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// recordingLogger records the log lines as "LEVEL msg fields"
+type recordingLogger struct {
+	fields []LogField
+	lines  *[]string
+}
+
+func (l recordingLogger) log(level string, msg string, fields []LogField) {
+	*l.lines = append(*l.lines, fmt.Sprintf("%s %s %v", level, msg, append(l.fields[:len(l.fields):len(l.fields)], fields...)))
+}
+
+func (l recordingLogger) Debug(msg string, fields ...LogField) { l.log("DEBUG", msg, fields) }
+func (l recordingLogger) Info(msg string, fields ...LogField)  { l.log("INFO", msg, fields) }
+func (l recordingLogger) Warn(msg string, fields ...LogField)  { l.log("WARN", msg, fields) }
+func (l recordingLogger) Error(msg string, fields ...LogField) { l.log("ERROR", msg, fields) }
+
+func (l recordingLogger) With(fields ...LogField) Logger {
+	return recordingLogger{fields: append(l.fields[:len(l.fields):len(l.fields)], fields...), lines: l.lines}
+}
+
+func TestNewZapLogger(t *testing.T) {
+	var lines []string
+	logger := NewZapLogger(recordingLogger{lines: &lines}).With(zap.String("cluster", "c1"))
+	logger.Debug("debug")
+	logger.Info("info", zap.Int("replicas", 3), zap.String("instance", "localhost_1"))
+	logger.Named("controller").Warn("warn")
+	logger.DPanic("dpanic")
+	assert.Equal(t, []string{
+		"DEBUG debug [{cluster c1}]",
+		"INFO info [{cluster c1} {instance localhost_1} {replicas 3}]",
+		"WARN warn [{cluster c1} {logger controller}]",
+		"ERROR dpanic [{cluster c1}]",
+	}, lines)
+}
+
+func TestNewLoggerFromZap(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewLoggerFromZap(zap.New(core)).With(LogField{Key: "cluster", Value: "c1"})
+	logger.Info("info", LogField{Key: "partition", Value: "r1_0"})
+	logger.Error("error")
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+	assert.Equal(t, map[string]interface{}{"cluster": "c1", "partition": "r1_0"}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+}
+
+func TestNewSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	logger := NewZapLogger(NewSlogLogger(slog.New(handler))).With(zap.String("cluster", "c1"))
+	logger.Debug("debug", zap.String("partition", "r1_0"))
+	logger.Warn("warn")
+	assert.Equal(t, "level=DEBUG msg=debug cluster=c1 partition=r1_0\nlevel=WARN msg=warn cluster=c1\n", buf.String())
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer SetLogLevel(LogComponentSpectator, zapcore.DebugLevel)
+	SetLogLevel(LogComponentSpectator, zapcore.ErrorLevel)
+	assert.Equal(t, zapcore.ErrorLevel, GetLogLevel(LogComponentSpectator))
+	assert.Equal(t, zapcore.DebugLevel, GetLogLevel(LogComponentZk))
+
+	// the levels are also changed through the debug server of the participants
+	handler := (&participant{}).debugHandler()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/debug/helix/loglevel?component=zk",
+		strings.NewReader(`{"level":"warn"}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	defer SetLogLevel(LogComponentZk, zapcore.DebugLevel)
+	assert.Equal(t, zapcore.WarnLevel, GetLogLevel(LogComponentZk))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/helix/loglevel", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestComponentLoggers(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewLoggerFromZap(zap.New(core))
+
+	controller := NewController(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithControllerName("c1"), WithControllerLogger(logger),
+		WithControllerZkClientOptions(cluster.zkClientOptions()...))
+	assert.NoError(t, controller.Start())
+	defer controller.Disconnect()
+	lines := logs.FilterMessage("controller leadership changed").AllUntimed()
+	assert.Len(t, lines, 1)
+	assert.Equal(t, TestClusterName, lines[0].ContextMap()["cluster"])
+
+	// the ZK client of the component logs to the same logger
+	assert.Equal(t, 1, logs.FilterMessage("session established").Len())
+
+	provider := NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithRoutingLogger(logger), WithRoutingZkClientOptions(cluster.zkClientOptions()...))
+	provider.logger.Info("spectator line")
+	assert.Equal(t, 1, logs.FilterMessage("spectator line").Len())
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", "app", TestClusterName, "r1",
+		"localhost", 1, WithParticipantLogger(logger),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.(*participant).logger.Info("participant line")
+	lines = logs.FilterMessage("participant line").AllUntimed()
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "localhost_1", lines[0].ContextMap()["instance"])
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// The roles of the managers created by a ManagerFactory
+const (
+	ManagerRoleParticipant = "PARTICIPANT"
+	ManagerRoleSpectator   = "SPECTATOR"
+	ManagerRoleController  = "CONTROLLER"
+)
+
+// ManagerFactory creates the Helix managers of the clusters served by one process, e.g. a sidecar
+// participating in a cluster and routing to another one, and connects and disconnects them together
+// This mirrors org.apache.helix.HelixManagerFactory
+type ManagerFactory struct {
+	logger          *zap.Logger
+	scope           tally.Scope
+	zkConnectString string
+	zkClientOptions []uzk.ClientOption
+	// metricTags are the static tags of the metrics of all the managers
+	metricTags map[string]string
+	// sharedClient is the ZK client of the managers sharing one session, nil if each manager
+	// has its own session
+	sharedClient *uzk.Client
+	shared       bool
+
+	mu        sync.Mutex
+	managers  []*factoryManager
+	connected bool
+}
+
+// factoryManager is a manager created by the factory, in creation order
+type factoryManager struct {
+	cluster    string
+	role       string
+	connect    func() error
+	disconnect func()
+	// shutdown leaves the cluster gracefully, nil if disconnect is enough
+	shutdown func(ctx context.Context) error
+}
+
+// ManagerFactoryOption configures optional settings of a ManagerFactory
+type ManagerFactoryOption func(*ManagerFactory)
+
+// WithManagerZkClientOptions configures the ZK clients of all the managers created by the factory,
+// the options of each manager are applied after them
+func WithManagerZkClientOptions(options ...uzk.ClientOption) ManagerFactoryOption {
+	return func(f *ManagerFactory) {
+		f.zkClientOptions = append(f.zkClientOptions, options...)
+	}
+}
+
+// WithManagerMetricTags adds static tags to all the metrics of the managers created by the factory,
+// including the ones of the shared ZK client. The metric tags of each manager override them
+func WithManagerMetricTags(tags map[string]string) ManagerFactoryOption {
+	return func(f *ManagerFactory) {
+		f.metricTags = mergeMetricTags(f.metricTags, tags)
+	}
+}
+
+// WithSharedConnection makes the participants, the spectators and the admins created by the factory
+// share one ZK session, released once all of them are disconnected. The controllers keep their own
+// sessions to contend for the leadership of their clusters
+func WithSharedConnection() ManagerFactoryOption {
+	return func(f *ManagerFactory) {
+		f.shared = true
+	}
+}
+
+// NewManagerFactory creates a ManagerFactory of the managers connected to the ZK ensemble
+func NewManagerFactory(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	options ...ManagerFactoryOption,
+) *ManagerFactory {
+	f := &ManagerFactory{
+		logger:          logger,
+		scope:           scope,
+		zkConnectString: zkConnectString,
+	}
+	for _, option := range options {
+		option(f)
+	}
+	if f.shared {
+		f.sharedClient = f.newZkClient()
+	}
+	return f
+}
+
+func (f *ManagerFactory) newZkClient() *uzk.Client {
+	// the shared client serves all the clusters, only the static tags apply to it
+	return uzk.NewClient(f.logger, f.scope.Tagged(f.metricTags), append([]uzk.ClientOption{uzk.WithZkSvr(f.zkConnectString),
+		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout)}, f.zkClientOptions...)...)
+}
+
+// NewParticipant creates a participant of the cluster like NewParticipant,
+// it is connected by Connect with the other managers of the factory
+func (f *ManagerFactory) NewParticipant(
+	application string,
+	clusterName string,
+	resourceName string,
+	host string,
+	port int32,
+	options ...ParticipantOption,
+) (Participant, <-chan error) {
+	options = append([]ParticipantOption{WithParticipantZkClientOptions(f.zkClientOptions...),
+		WithParticipantMetricTags(f.metricTags)}, options...)
+	if f.sharedClient != nil {
+		options = append(options, WithParticipantZkClient(f.sharedClient))
+	}
+	p, errCh := NewParticipant(f.logger, f.scope, f.zkConnectString, application, clusterName, resourceName,
+		host, port, options...)
+	f.add(&factoryManager{
+		cluster:    clusterName,
+		role:       ManagerRoleParticipant,
+		connect:    p.Connect,
+		disconnect: p.Disconnect,
+		shutdown:   p.Shutdown,
+	})
+	return p, errCh
+}
+
+// NewSpectator creates a RoutingTableProvider of the cluster like NewRoutingTableProvider,
+// it is connected by Connect with the other managers of the factory
+func (f *ManagerFactory) NewSpectator(clusterName string, options ...RoutingTableProviderOption) *RoutingTableProvider {
+	options = append([]RoutingTableProviderOption{WithRoutingZkClientOptions(f.zkClientOptions...),
+		WithRoutingMetricTags(f.metricTags)}, options...)
+	if f.sharedClient != nil {
+		options = append(options, WithRoutingZkClient(f.sharedClient))
+	}
+	p := NewRoutingTableProvider(f.logger, f.scope, f.zkConnectString, clusterName, options...)
+	f.add(&factoryManager{
+		cluster:    clusterName,
+		role:       ManagerRoleSpectator,
+		connect:    p.Connect,
+		disconnect: p.Disconnect,
+	})
+	return p
+}
+
+// NewController creates a controller of the cluster like NewController,
+// it is started by Connect with the other managers of the factory
+func (f *ManagerFactory) NewController(clusterName string, options ...ControllerOption) *Controller {
+	options = append([]ControllerOption{WithControllerZkClientOptions(f.zkClientOptions...),
+		WithControllerMetricTags(f.metricTags)}, options...)
+	c := NewController(f.logger, f.scope, f.zkConnectString, clusterName, options...)
+	f.add(&factoryManager{
+		cluster:    clusterName,
+		role:       ManagerRoleController,
+		connect:    c.Start,
+		disconnect: c.Disconnect,
+	})
+	return c
+}
+
+// NewAdmin creates a connected Admin, over the shared session if WithSharedConnection is set.
+// The admin is closed by its owner with Admin.Close
+func (f *ManagerFactory) NewAdmin() (*Admin, error) {
+	if f.sharedClient != nil {
+		return NewAdminWithClient(f.sharedClient)
+	}
+	zkClient := f.newZkClient()
+	if err := zkClient.Connect(); err != nil {
+		return nil, err
+	}
+	return &Admin{zkClient: zkClient}, nil
+}
+
+func (f *ManagerFactory) add(m *factoryManager) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.managers = append(f.managers, m)
+}
+
+// Connect connects the managers in creation order, the managers already connected are kept.
+// If a manager fails to connect, the managers connected before it are disconnected
+func (f *ManagerFactory) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, m := range f.managers {
+		if err := m.connect(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				f.managers[j].disconnect()
+			}
+			f.connected = false
+			return errors.Wrapf(err, "helix manager factory failed to connect the %s of cluster %s",
+				m.role, m.cluster)
+		}
+	}
+	f.connected = true
+	return nil
+}
+
+// Disconnect disconnects the managers in reverse creation order
+func (f *ManagerFactory) Disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.managers) - 1; i >= 0; i-- {
+		f.managers[i].disconnect()
+	}
+	f.connected = false
+}
+
+// Shutdown disconnects the managers in reverse creation order, the participants leave their
+// clusters gracefully with Participant.Shutdown. The first error is returned
+func (f *ManagerFactory) Shutdown(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var firstErr error
+	for i := len(f.managers) - 1; i >= 0; i-- {
+		m := f.managers[i]
+		if m.shutdown == nil {
+			m.disconnect()
+			continue
+		}
+		if err := m.shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "helix manager factory failed to shut down the %s of cluster %s",
+				m.role, m.cluster)
+		}
+	}
+	f.connected = false
+	return firstErr
+}
+
+// IsConnected returns if the managers of the factory are connected by Connect
+func (f *ManagerFactory) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestManagerFactory(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	assert.True(t, admin.AddCluster("cluster_a", false))
+	assert.True(t, admin.AddCluster("cluster_b", false))
+	assert.NoError(t, admin.AddNode("cluster_a", "localhost_1"))
+
+	factory := NewManagerFactory(zap.NewNop(), tally.NoopScope, "",
+		WithManagerZkClientOptions(cluster.zkClientOptions()...))
+	p, _ := factory.NewParticipant(testApplication, "cluster_a", TestResource, "localhost", 1)
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	spectator := factory.NewSpectator("cluster_b")
+	assert.False(t, factory.IsConnected())
+
+	// the managers of both clusters are connected together
+	assert.NoError(t, factory.Connect())
+	assert.True(t, factory.IsConnected())
+	assert.True(t, p.IsConnected())
+	assert.NotNil(t, spectator.stopCh)
+	liveInstance := (&KeyBuilder{"cluster_a"}).liveInstance("localhost_1")
+	exists, _, err := client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// and disconnected together, the fake connections keep their state once closed
+	factory.Disconnect()
+	assert.False(t, factory.IsConnected())
+	assert.Nil(t, spectator.stopCh)
+	exists, _, err = client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// the managers connected before a failing one are disconnected
+	factory = NewManagerFactory(zap.NewNop(), tally.NoopScope, "",
+		WithManagerZkClientOptions(cluster.zkClientOptions()...))
+	spectator = factory.NewSpectator("cluster_b")
+	factory.NewParticipant(testApplication, "missing_cluster", TestResource, "localhost", 1)
+	err = factory.Connect()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PARTICIPANT of cluster missing_cluster")
+	assert.False(t, factory.IsConnected())
+	assert.Nil(t, spectator.stopCh)
+
+	// the participants leave their clusters on shutdown
+	factory = NewManagerFactory(zap.NewNop(), tally.NoopScope, "",
+		WithManagerZkClientOptions(cluster.zkClientOptions()...))
+	p, _ = factory.NewParticipant(testApplication, "cluster_a", TestResource, "localhost", 1)
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	assert.NoError(t, factory.Connect())
+	assert.NoError(t, factory.Shutdown(context.Background()))
+	exists, _, err = client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestManagerMetricTags(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin := cluster.admin
+	assert.True(t, admin.AddCluster("cluster_a", false))
+	assert.True(t, admin.AddCluster("cluster_b", false))
+	assert.NoError(t, admin.AddNode("cluster_a", "localhost_1"))
+
+	scope := tally.NewTestScope("", nil)
+	factory := NewManagerFactory(zap.NewNop(), scope, "",
+		WithManagerZkClientOptions(cluster.zkClientOptions()...),
+		WithManagerMetricTags(map[string]string{"zone": "z1", "deployment": "canary"}))
+	p, _ := factory.NewParticipant(testApplication, "cluster_a", TestResource, "localhost", 1,
+		WithParticipantMetricTags(map[string]string{"zone": "z2"}))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	factory.NewSpectator("cluster_b")
+	assert.NoError(t, factory.Connect())
+	defer factory.Disconnect()
+
+	// the metrics of the managers and of their ZK clients are tagged with their cluster and role
+	p.(*participant).scope.Counter("probe").Inc(1)
+	snapshot := scope.Snapshot()
+	tagsByName := map[string][]map[string]string{}
+	for _, c := range snapshot.Counters() {
+		tagsByName[c.Name()] = append(tagsByName[c.Name()], c.Tags())
+	}
+	for _, g := range snapshot.Gauges() {
+		tagsByName[g.Name()] = append(tagsByName[g.Name()], g.Tags())
+	}
+	hasTags := func(prefix string, expected map[string]string) bool {
+		for name, tagsList := range tagsByName {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+		next:
+			for _, tags := range tagsList {
+				for k, v := range expected {
+					if tags[k] != v {
+						continue next
+					}
+				}
+				return true
+			}
+		}
+		return false
+	}
+	participantTags := map[string]string{"cluster": "cluster_a", "role": "participant",
+		"instance": "localhost_1", "zone": "z2", "deployment": "canary"}
+	assert.True(t, hasTags("helix.participant.", participantTags))
+	assert.True(t, hasTags("helix.zk.", participantTags))
+	spectatorTags := map[string]string{"cluster": "cluster_b", "role": "spectator", "zone": "z1",
+		"deployment": "canary"}
+	assert.True(t, hasTags("helix.routing.", spectatorTags))
+	assert.True(t, hasTags("helix.zk.", spectatorTags))
+}
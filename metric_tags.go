@@ -0,0 +1,63 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"strings"
+
+	"github.com/uber-go/tally"
+)
+
+// The tags set on all the metrics of a manager, including the ones of its ZK client
+const (
+	MetricTagCluster  = "cluster"
+	MetricTagInstance = "instance"
+	MetricTagRole     = "role"
+)
+
+// managerScope tags the scope of a manager of the cluster with the static tags, the cluster,
+// the role of the manager and its instance if any, so that the metrics of the managers of one
+// process are partitioned. The static tags do not override the other ones
+func managerScope(scope tally.Scope, role string, cluster string, instance string,
+	tags map[string]string) tally.Scope {
+	tagged := make(map[string]string, len(tags)+3)
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	tagged[MetricTagCluster] = cluster
+	tagged[MetricTagRole] = strings.ToLower(role)
+	if instance != "" {
+		tagged[MetricTagInstance] = instance
+	}
+	return scope.Tagged(tagged)
+}
+
+// mergeMetricTags returns the tags of both maps, the ones of override winning
+func mergeMetricTags(tags map[string]string, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(tags)+len(override))
+	for k, v := range tags {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
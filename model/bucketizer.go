@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ZNRecordBucketizer splits the list and map fields of a record keyed by partition, e.g. of
+// a resource with too many partitions for a znode, into buckets stored as child znodes.
+// Mirrors org.apache.helix.ZNRecordBucketizer
+type ZNRecordBucketizer struct {
+	bucketSize int
+}
+
+// NewZNRecordBucketizer returns a bucketizer of bucketSize partitions per bucket,
+// 0 keeps the record whole
+func NewZNRecordBucketizer(bucketSize int) *ZNRecordBucketizer {
+	return &ZNRecordBucketizer{bucketSize: bucketSize}
+}
+
+// GetBucketName returns the name of the bucket of the partition, e.g. myDB_p0-p99 for myDB_42
+// and the bucket size 100. It returns "" if the records are not bucketized or the partition name
+// doesn't end with _<number>
+func (b *ZNRecordBucketizer) GetBucketName(partition string) string {
+	if b.bucketSize <= 0 {
+		return ""
+	}
+	i := strings.LastIndex(partition, "_")
+	if i < 0 {
+		return ""
+	}
+	number, err := strconv.Atoi(partition[i+1:])
+	if err != nil || number < 0 {
+		return ""
+	}
+	start := number / b.bucketSize * b.bucketSize
+	return partition[:i] + "_p" + strconv.Itoa(start) + "-p" + strconv.Itoa(start+b.bucketSize-1)
+}
+
+// Bucketize returns the buckets of the record by name, each with the simple fields of the record
+// and the list and map fields of its partitions. The fields not keyed by a partition are dropped
+// like in Java Helix. The record is returned as is if the bucket size is 0
+func (b *ZNRecordBucketizer) Bucketize(record *ZNRecord) map[string]*ZNRecord {
+	if b.bucketSize <= 0 {
+		return map[string]*ZNRecord{record.ID: record}
+	}
+	buckets := map[string]*ZNRecord{}
+	bucket := func(partition string) *ZNRecord {
+		name := b.GetBucketName(partition)
+		if name == "" {
+			return nil
+		}
+		if _, ok := buckets[name]; !ok {
+			buckets[name] = NewRecord(name)
+		}
+		return buckets[name]
+	}
+	for partition, values := range record.ListFields {
+		if r := bucket(partition); r != nil {
+			r.ListFields[partition] = values
+		}
+	}
+	for partition, fields := range record.MapFields {
+		if r := bucket(partition); r != nil {
+			r.MapFields[partition] = fields
+		}
+	}
+	for _, r := range buckets {
+		for key, value := range record.SimpleFields {
+			r.SimpleFields[key] = value
+		}
+	}
+	return buckets
+}
+
+// AssembleRecords merges the buckets of a record, the simple fields are taken from the first
+// bucket in the order of their IDs. It returns nil if there is no bucket.
+// Mirrors org.apache.helix.ZNRecordAssembler
+func AssembleRecords(id string, buckets []*ZNRecord) *ZNRecord {
+	if len(buckets) == 0 {
+		return nil
+	}
+	sorted := make([]*ZNRecord, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	record := NewRecord(id)
+	for key, value := range sorted[0].SimpleFields {
+		record.SimpleFields[key] = value
+	}
+	for _, bucket := range sorted {
+		for partition, values := range bucket.ListFields {
+			record.ListFields[partition] = values
+		}
+		for partition, fields := range bucket.MapFields {
+			record.MapFields[partition] = fields
+		}
+	}
+	return record
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClusterConfig represents the config of a Helix cluster
+type ClusterConfig struct {
+	ZNRecord
+}
+
+// NewClusterConfig creates a new cluster config property
+func NewClusterConfig(cluster string) *ClusterConfig {
+	return &ClusterConfig{*NewRecord(cluster)}
+}
+
+// IsDelayRebalanceEnabled returns if delayed rebalancing is enabled for the cluster,
+// it is enabled unless disabled explicitly
+func (c *ClusterConfig) IsDelayRebalanceEnabled() bool {
+	return c.GetBooleanField(FieldKeyDelayRebalanceEnabled, true)
+}
+
+// SetDelayRebalanceEnabled enables or disables delayed rebalancing for the cluster
+func (c *ClusterConfig) SetDelayRebalanceEnabled(enabled bool) {
+	c.SetBooleanField(FieldKeyDelayRebalanceEnabled, enabled)
+}
+
+// GetRebalanceDelayTime returns the time the rebalancing is delayed after an instance
+// goes offline, it returns false if the delay is not set
+func (c *ClusterConfig) GetRebalanceDelayTime() (time.Duration, bool) {
+	return getDurationMillisField(c.ZNRecord, FieldKeyDelayRebalanceTime)
+}
+
+// SetRebalanceDelayTime sets the time the rebalancing is delayed after an instance goes offline
+func (c *ClusterConfig) SetRebalanceDelayTime(delay time.Duration) {
+	setDurationMillisField(&c.ZNRecord, FieldKeyDelayRebalanceTime, delay)
+}
+
+// GetTopology returns the topology of the instances, e.g. /zone/rack/instance
+func (c *ClusterConfig) GetTopology() string {
+	return c.GetStringField(FieldKeyTopology, "")
+}
+
+// SetTopology sets the topology of the instances
+func (c *ClusterConfig) SetTopology(topology string) {
+	c.SetSimpleField(FieldKeyTopology, topology)
+}
+
+// GetFaultZoneType returns the level of the topology the replicas are spread over, e.g. rack
+func (c *ClusterConfig) GetFaultZoneType() string {
+	return c.GetStringField(FieldKeyFaultZoneType, "")
+}
+
+// SetFaultZoneType sets the level of the topology the replicas are spread over
+func (c *ClusterConfig) SetFaultZoneType(faultZoneType string) {
+	c.SetSimpleField(FieldKeyFaultZoneType, faultZoneType)
+}
+
+// IsTopologyAwareEnabled returns if the placement is aware of the topology
+func (c *ClusterConfig) IsTopologyAwareEnabled() bool {
+	return c.GetBooleanField(FieldKeyTopologyAwareEnabled, false)
+}
+
+// SetTopologyAwareEnabled enables or disables the topology aware placement
+func (c *ClusterConfig) SetTopologyAwareEnabled(enabled bool) {
+	c.SetBooleanField(FieldKeyTopologyAwareEnabled, enabled)
+}
+
+// GetStateTransitionThrottleConfigs returns the throttles of the state transitions,
+// the malformed entries are skipped
+func (c *ClusterConfig) GetStateTransitionThrottleConfigs() []StateTransitionThrottleConfig {
+	var configs []StateTransitionThrottleConfig
+	for _, value := range c.GetListField(FieldKeyStateTransitionThrottles) {
+		var config StateTransitionThrottleConfig
+		if err := json.Unmarshal([]byte(value), &config); err == nil {
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+// SetStateTransitionThrottleConfigs sets the throttles of the state transitions
+func (c *ClusterConfig) SetStateTransitionThrottleConfigs(configs []StateTransitionThrottleConfig) error {
+	values := make([]string, 0, len(configs))
+	for _, config := range configs {
+		data, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(data))
+	}
+	c.SetListField(FieldKeyStateTransitionThrottles, values)
+	return nil
+}
+
+// GetMaxPartitionsPerInstance returns the max partitions placed on an instance, or -1 if unlimited
+func (c *ClusterConfig) GetMaxPartitionsPerInstance() int {
+	return c.GetIntField(FieldKeyMaxPartitionsPerInstance, -1)
+}
+
+// SetMaxPartitionsPerInstance sets the max partitions placed on an instance
+func (c *ClusterConfig) SetMaxPartitionsPerInstance(max int) {
+	c.SetIntField(FieldKeyMaxPartitionsPerInstance, max)
+}
+
+// GetBatchStateTransitionMaxThreads returns the threads of the participants to run
+// the transitions of batch messages, or -1 if not set
+func (c *ClusterConfig) GetBatchStateTransitionMaxThreads() int {
+	return c.GetIntField(FieldKeyBatchStateTransitionLimit, -1)
+}
+
+// SetBatchStateTransitionMaxThreads sets the threads to run the transitions of batch messages
+func (c *ClusterConfig) SetBatchStateTransitionMaxThreads(threads int) {
+	c.SetIntField(FieldKeyBatchStateTransitionLimit, threads)
+}
+
+// IsPersistBestPossibleAssignment returns if the controller persists the best possible states
+func (c *ClusterConfig) IsPersistBestPossibleAssignment() bool {
+	return c.GetBooleanField(FieldKeyPersistBestPossible, false)
+}
+
+// SetPersistBestPossibleAssignment sets if the controller persists the best possible states
+func (c *ClusterConfig) SetPersistBestPossibleAssignment(persist bool) {
+	c.SetBooleanField(FieldKeyPersistBestPossible, persist)
+}
+
+// GetInstanceCapacityKeys returns the keys of the capacities the WAGED rebalancer balances,
+// e.g. CPU and DISK
+func (c *ClusterConfig) GetInstanceCapacityKeys() []string {
+	return c.GetListField(FieldKeyInstanceCapacityKeys)
+}
+
+// SetInstanceCapacityKeys sets the keys of the capacities the WAGED rebalancer balances
+func (c *ClusterConfig) SetInstanceCapacityKeys(keys []string) {
+	c.SetListField(FieldKeyInstanceCapacityKeys, keys)
+}
+
+// GetDefaultInstanceCapacityMap returns the capacities of the instances without their own
+// capacities by capacity key, the malformed entries are skipped
+func (c *ClusterConfig) GetDefaultInstanceCapacityMap() map[string]int {
+	capacity, _ := getIntMapField(c.ZNRecord, FieldKeyDefaultInstanceCapacityMap)
+	return capacity
+}
+
+// SetDefaultInstanceCapacityMap sets the capacities of the instances without their own capacities
+func (c *ClusterConfig) SetDefaultInstanceCapacityMap(capacity map[string]int) {
+	setIntMapField(&c.ZNRecord, FieldKeyDefaultInstanceCapacityMap, capacity)
+}
+
+// GetDefaultPartitionWeightMap returns the weights of the partitions without their own
+// capacities by capacity key, the malformed entries are skipped
+func (c *ClusterConfig) GetDefaultPartitionWeightMap() map[string]int {
+	weight, _ := getIntMapField(c.ZNRecord, FieldKeyDefaultPartitionWeightMap)
+	return weight
+}
+
+// SetDefaultPartitionWeightMap sets the weights of the partitions without their own capacities
+func (c *ClusterConfig) SetDefaultPartitionWeightMap(weight map[string]int) {
+	setIntMapField(&c.ZNRecord, FieldKeyDefaultPartitionWeightMap, weight)
+}
+
+// GetGlobalRebalancePreference returns the weights of the goals of the WAGED rebalancer,
+// e.g. RebalancePreferenceEvenness, the malformed entries are skipped
+func (c *ClusterConfig) GetGlobalRebalancePreference() map[string]int {
+	preference, _ := getIntMapField(c.ZNRecord, FieldKeyRebalancePreference)
+	return preference
+}
+
+// SetGlobalRebalancePreference sets the weights of the goals of the WAGED rebalancer,
+// each between 0 and MaxRebalancePreference
+func (c *ClusterConfig) SetGlobalRebalancePreference(preference map[string]int) {
+	setIntMapField(&c.ZNRecord, FieldKeyRebalancePreference, preference)
+}
+
+// GetInstanceCapacity returns the capacities of the instance by capacity key, its own capacities
+// or else the default ones, it fails if a capacity key is not covered
+// This mirrors org.apache.helix.controller.rebalancer.waged.model.AssignableNode
+func (c *ClusterConfig) GetInstanceCapacity(instance *InstanceConfig) (map[string]int, error) {
+	capacity := instance.GetInstanceCapacityMap()
+	if len(capacity) == 0 {
+		capacity = c.GetDefaultInstanceCapacityMap()
+	}
+	for _, key := range c.GetInstanceCapacityKeys() {
+		if _, ok := capacity[key]; !ok {
+			return nil, errors.Errorf("instance %s has no capacity of %s", instance.ID, key)
+		}
+	}
+	return capacity, nil
+}
+
+// Validate checks the typed fields of the cluster config
+func (c *ClusterConfig) Validate() error {
+	if delay, ok := c.GetRebalanceDelayTime(); ok && delay < 0 {
+		return errors.Errorf("invalid %s %v, must not be negative", FieldKeyDelayRebalanceTime, delay)
+	}
+	if c.IsTopologyAwareEnabled() && c.GetTopology() == "" {
+		return errors.Errorf("%s is required when %s is true", FieldKeyTopology, FieldKeyTopologyAwareEnabled)
+	}
+	if faultZoneType := c.GetFaultZoneType(); faultZoneType != "" && c.GetTopology() != "" &&
+		!strings.Contains(c.GetTopology()+"/", "/"+faultZoneType+"/") {
+		return errors.Errorf("%s %s is not a level of %s %s",
+			FieldKeyFaultZoneType, faultZoneType, FieldKeyTopology, c.GetTopology())
+	}
+	if len(c.GetStateTransitionThrottleConfigs()) != len(c.GetListField(FieldKeyStateTransitionThrottles)) {
+		return errors.Errorf("malformed %s", FieldKeyStateTransitionThrottles)
+	}
+	for _, config := range c.GetStateTransitionThrottleConfigs() {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{FieldKeyDefaultInstanceCapacityMap, FieldKeyDefaultPartitionWeightMap} {
+		if _, err := getIntMapField(c.ZNRecord, key); err != nil {
+			return err
+		}
+	}
+	preference, err := getIntMapField(c.ZNRecord, FieldKeyRebalancePreference)
+	if err != nil {
+		return err
+	}
+	for goal, weight := range preference {
+		if goal != RebalancePreferenceEvenness && goal != RebalancePreferenceLessMovement {
+			return errors.Errorf("invalid %s goal %s", FieldKeyRebalancePreference, goal)
+		}
+		if weight > MaxRebalancePreference {
+			return errors.Errorf("invalid %s %s %d, must not exceed %d",
+				FieldKeyRebalancePreference, goal, weight, MaxRebalancePreference)
+		}
+	}
+	return nil
+}
+
+// getDurationMillisField returns the duration stored in milliseconds,
+// Helix uses -1 for durations not set
+func getDurationMillisField(record ZNRecord, key string) (time.Duration, bool) {
+	millis := record.GetInt64Field(key, -1)
+	if millis == -1 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
+
+func setDurationMillisField(record *ZNRecord, key string, duration time.Duration) {
+	record.SetSimpleField(key, strconv.FormatInt(int64(duration/time.Millisecond), 10))
+}
+
+// getIntMapField returns the non-negative integers of the map field,
+// the malformed entries are skipped and reported by the error
+func getIntMapField(record ZNRecord, key string) (map[string]int, error) {
+	values := record.MapFields[key]
+	if values == nil {
+		return nil, nil
+	}
+	result := make(map[string]int, len(values))
+	var err error
+	for name, value := range values {
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil || n < 0 {
+			err = errors.Errorf("invalid %s %s %q, must be a non-negative number", key, name, value)
+			continue
+		}
+		result[name] = n
+	}
+	return result, err
+}
+
+func setIntMapField(record *ZNRecord, key string, values map[string]int) {
+	record.RemoveMapField(key)
+	for name, value := range values {
+		record.SetMapField(key, name, strconv.Itoa(value))
+	}
+}
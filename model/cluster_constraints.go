@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the cluster constraints
+const (
+	ConstraintTypeMessage = "MESSAGE_CONSTRAINT"
+	ConstraintTypeState   = "STATE_CONSTRAINT"
+)
+
+// Attributes of the constraint items, their values are regular expressions
+// matching the whole value of the attribute
+const (
+	ConstraintAttributeState       = "STATE"
+	ConstraintAttributeStateModel  = "STATE_MODEL"
+	ConstraintAttributeMessageType = "MESSAGE_TYPE"
+	ConstraintAttributeTransition  = "TRANSITION"
+	ConstraintAttributeInstance    = "INSTANCE"
+	ConstraintAttributeResource    = "RESOURCE"
+	ConstraintAttributePartition   = "PARTITION"
+)
+
+// FieldKeyConstraintValue is the key of the value of a constraint item
+const FieldKeyConstraintValue = "CONSTRAINT_VALUE"
+
+var _constraintAttributes = map[string]struct{}{
+	ConstraintAttributeState:       {},
+	ConstraintAttributeStateModel:  {},
+	ConstraintAttributeMessageType: {},
+	ConstraintAttributeTransition:  {},
+	ConstraintAttributeInstance:    {},
+	ConstraintAttributeResource:    {},
+	ConstraintAttributePartition:   {},
+}
+
+// ConstraintItem constrains the messages or states matching all its attributes, e.g.
+// {MESSAGE_TYPE: STATE_TRANSITION, INSTANCE: .*} with value 1 allows one pending state transition
+// per instance. The value is a number, or "R" and "N" for the state constraints
+// Mirrors org.apache.helix.model.ConstraintItem
+type ConstraintItem struct {
+	Attributes map[string]string
+	Value      string
+}
+
+// Validate checks the attributes are known and valid regular expressions
+func (i ConstraintItem) Validate() error {
+	if i.Value == "" {
+		return errors.New("constraint value is empty")
+	}
+	if len(i.Attributes) == 0 {
+		return errors.New("constraint has no attributes")
+	}
+	for attribute, value := range i.Attributes {
+		if _, ok := _constraintAttributes[attribute]; !ok {
+			return errors.Errorf("unknown constraint attribute %s", attribute)
+		}
+		if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return errors.Wrapf(err, "invalid value of constraint attribute %s", attribute)
+		}
+	}
+	return nil
+}
+
+// Match returns if the attributes have all the attributes of the item with matching values
+func (i ConstraintItem) Match(attributes map[string]string) bool {
+	for attribute, pattern := range i.Attributes {
+		value, ok := attributes[attribute]
+		if !ok {
+			return false
+		}
+		if matched, err := regexp.MatchString("^(?:"+pattern+")$", value); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the attributes that are attributes of the item, the values they
+// have are the scope the item constrains, e.g. the instance of a message
+func (i ConstraintItem) Filter(attributes map[string]string) map[string]string {
+	filtered := map[string]string{}
+	for attribute := range i.Attributes {
+		if value, ok := attributes[attribute]; ok {
+			filtered[attribute] = value
+		}
+	}
+	return filtered
+}
+
+// Scope returns the key of the scope the item constrains for the attributes,
+// the attributes of the same scope count against the same value
+func (i ConstraintItem) Scope(attributes map[string]string) string {
+	return constraintScope(i.Filter(attributes))
+}
+
+// ClusterConstraints holds the constraint items of a type by constraint ID
+// Mirrors org.apache.helix.model.ClusterConstraints
+type ClusterConstraints struct {
+	ZNRecord
+}
+
+// NewClusterConstraints creates the constraints of the type, e.g. ConstraintTypeMessage
+func NewClusterConstraints(constraintType string) *ClusterConstraints {
+	return &ClusterConstraints{*NewRecord(constraintType)}
+}
+
+// GetConstraintItems returns the constraint items by constraint ID
+func (c *ClusterConstraints) GetConstraintItems() map[string]ConstraintItem {
+	items := make(map[string]ConstraintItem, len(c.MapFields))
+	for id, fields := range c.MapFields {
+		item := ConstraintItem{Attributes: map[string]string{}}
+		for key, value := range fields {
+			if key == FieldKeyConstraintValue {
+				item.Value = value
+			} else {
+				item.Attributes[key] = value
+			}
+		}
+		items[id] = item
+	}
+	return items
+}
+
+// SetConstraintItem adds or replaces the constraint item of the ID
+func (c *ClusterConstraints) SetConstraintItem(id string, item ConstraintItem) {
+	fields := make(map[string]string, len(item.Attributes)+1)
+	for attribute, value := range item.Attributes {
+		fields[attribute] = value
+	}
+	fields[FieldKeyConstraintValue] = item.Value
+	c.MapFields[id] = fields
+}
+
+// RemoveConstraintItem removes the constraint item of the ID
+func (c *ClusterConstraints) RemoveConstraintItem(id string) {
+	c.RemoveMapField(id)
+}
+
+// Match returns the constraint items matching the attributes, e.g. of a message.
+// Of the items constraining the same scope only the narrowest is kept, that is
+// the one matching the attributes of the others, sorted by constraint ID
+func (c *ClusterConstraints) Match(attributes map[string]string) []ConstraintItem {
+	items := c.GetConstraintItems()
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var scopes []string
+	selected := map[string]ConstraintItem{}
+	for _, id := range ids {
+		item := items[id]
+		if !item.Match(attributes) {
+			continue
+		}
+		scope := item.Scope(attributes)
+		existing, ok := selected[scope]
+		if !ok {
+			scopes = append(scopes, scope)
+			selected[scope] = item
+		} else if existing.Match(item.Attributes) {
+			selected[scope] = item
+		}
+	}
+	result := make([]ConstraintItem, 0, len(scopes))
+	for _, scope := range scopes {
+		result = append(result, selected[scope])
+	}
+	return result
+}
+
+// constraintScope returns the key of the scope of the filtered attributes
+func constraintScope(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	scope := ""
+	for _, key := range keys {
+		scope += key + "=" + attributes[key] + ";"
+	}
+	return scope
+}
@@ -23,6 +23,7 @@ package model
 const (
 	_helixVersion                 = "helix-0.6.8"
 	_defaultStateModelFactoryName = "DEFAULT"
+	_anyLiveInstance              = "ANY_LIVEINSTANCE"
 )
 
 // Field keys commonly shared among Helix models
@@ -42,17 +43,60 @@ const (
 	FieldKeyFromState             = "FROM_STATE"
 	FieldKeyToState               = "TO_STATE"
 	FieldKeyCurrentState          = "CURRENT_STATE"
+	FieldKeyStartTime             = "START_TIME"
+	FieldKeyInfo                  = "INFO"
 	FieldKeyParentMsgID           = "PARENT_MSG_ID"
 	FieldKeyMsgState              = "MSG_STATE"
 	FieldKeyMsgType               = "MSG_TYPE"
 	FieldKeyResourceName          = "RESOURCE_NAME"
+	FieldKeySrcName               = "SRC_NAME"
 	FieldKeyCreateTimestamp       = "CREATE_TIMESTAMP"
 	FieldKeyExecuteStartTimestamp = "EXECUTE_START_TIMESTAMP"
+	FieldKeyExpiryPeriod          = "EXPIRY_PERIOD"
+	FieldKeyTimeout               = "TIMEOUT"
+	FieldKeyCorrelationID         = "CORRELATION_ID"
+	FieldKeySrcInstanceType       = "SRC_INSTANCE_TYPE"
+	FieldKeyMessageResult         = "MESSAGE_RESULT"
+	// FieldKeyInnerMessage is the map field of the task message carried by a transition of a scheduled task
+	FieldKeyInnerMessage = "INNER_MESSAGE"
+)
+
+// Field keys used by the state transition error
+const (
+	FieldKeyMsgID     = "MSG_ID"
+	FieldKeyError     = "ERROR"
+	FieldKeyTimestamp = "TIMESTAMP"
 )
 
 // Field keys used by the ideal state
 const (
-	FieldKeyNumPartitions = "NUM_PARTITIONS"
+	FieldKeyNumPartitions       = "NUM_PARTITIONS"
+	FieldKeyInstanceGroupTag    = "INSTANCE_GROUP_TAG"
+	FieldKeyRebalanceMode       = "REBALANCE_MODE"
+	FieldKeyRebalancerClassName = "REBALANCER_CLASS_NAME"
+	FieldKeyReplicas            = "REPLICAS"
+	FieldKeyStateModelDefRef    = "STATE_MODEL_DEF_REF"
+	FieldKeyResourceGroupName   = "RESOURCE_GROUP_NAME"
+	FieldKeyGroupRoutingEnabled = "GROUP_ROUTING_ENABLED"
+)
+
+// Rebalance modes of the ideal state
+const (
+	RebalanceModeFullAuto    = "FULL_AUTO"
+	RebalanceModeSemiAuto    = "SEMI_AUTO"
+	RebalanceModeCustomized  = "CUSTOMIZED"
+	RebalanceModeUserDefined = "USER_DEFINED"
+	RebalanceModeTask        = "TASK"
+)
+
+// WagedRebalancerClassName is the rebalancer class name of the FULL_AUTO resources placed by
+// the weight-aware globally-even distribution (WAGED) rebalancer of the Java controller
+const WagedRebalancerClassName = "org.apache.helix.controller.rebalancer.waged.WagedRebalancer"
+
+// Global rebalance preferences of the WAGED rebalancer
+const (
+	RebalancePreferenceEvenness     = "EVENNESS"
+	RebalancePreferenceLessMovement = "LESS_MOVEMENT"
 )
 
 // Field keys used by instance config
@@ -60,6 +104,19 @@ const (
 	FieldKeyHelixHost    = "HELIX_HOST"
 	FieldKeyHelixPort    = "HELIX_PORT"
 	FieldKeyHelixEnabled = "HELIX_ENABLED"
+	FieldKeyTagList      = "TAG_LIST"
+	FieldKeyZoneID       = "ZONE_ID"
+	FieldKeyDomain       = "DOMAIN"
+	FieldKeyWeight       = "WEIGHT"
+
+	FieldKeyInstanceCapacityMap = "INSTANCE_CAPACITY_MAP"
+
+	FieldKeyHelixEnabledTimestamp  = "HELIX_ENABLED_TIMESTAMP"
+	FieldKeyHelixDisabledPartition = "HELIX_DISABLED_PARTITION"
+
+	// FieldKeyEndpointPrefix prefixes the fields of the endpoints advertised per protocol,
+	// e.g. ENDPOINT_GRPC=[::1]:9090
+	FieldKeyEndpointPrefix = "ENDPOINT_"
 )
 
 // Field keys used by live instance
@@ -68,7 +125,38 @@ const (
 	FieldKeyLiveInstance = "LIVE_INSTANCE"
 )
 
+// Field keys used by the cluster config and the resource config
+const (
+	FieldKeyDelayRebalanceEnabled = "DELAY_REBALANCE_ENABLED"
+	FieldKeyDelayRebalanceTime    = "DELAY_REBALANCE_TIME"
+	FieldKeyRebalanceDelay        = "REBALANCE_DELAY"
+	FieldKeyMinActiveReplicas     = "MIN_ACTIVE_REPLICAS"
+
+	FieldKeyTopology                  = "TOPOLOGY"
+	FieldKeyFaultZoneType             = "FAULT_ZONE_TYPE"
+	FieldKeyTopologyAwareEnabled      = "TOPOLOGY_AWARE_ENABLED"
+	FieldKeyStateTransitionThrottles  = "STATE_TRANSITION_THROTTLE_CONFIGS"
+	FieldKeyMaxPartitionsPerInstance  = "MAX_PARTITIONS_PER_INSTANCE"
+	FieldKeyBatchStateTransitionLimit = "BATCH_STATE_TRANSITION_MAX_THREADS"
+	FieldKeyPersistBestPossible       = "PERSIST_BEST_POSSIBLE_ASSIGNMENT"
+	FieldKeyMonitoringDisabled        = "MONITORING_DISABLED"
+
+	FieldKeyInstanceCapacityKeys       = "INSTANCE_CAPACITY_KEYS"
+	FieldKeyDefaultInstanceCapacityMap = "DEFAULT_INSTANCE_CAPACITY_MAP"
+	FieldKeyDefaultPartitionWeightMap  = "DEFAULT_PARTITION_WEIGHT_MAP"
+	FieldKeyRebalancePreference        = "REBALANCE_PREFERENCE"
+	FieldKeyPartitionCapacityMap       = "PARTITION_CAPACITY_MAP"
+)
+
+// DefaultPartitionCapacityKey is the key of the partition capacity map of a resource config
+// applied to the partitions without their own capacity
+const DefaultPartitionCapacityKey = "DEFAULT"
+
+// MaxRebalancePreference is the max weight of a global rebalance preference
+const MaxRebalancePreference = 1000
+
 // Field keys used by state model def
 const (
-	FieldKeyInitialState = "INITIAL_STATE"
+	FieldKeyInitialState      = "INITIAL_STATE"
+	FieldKeyStatePriorityList = "STATE_PRIORITY_LIST"
 )
@@ -60,6 +60,11 @@ func (s *CurrentState) GetStateModelDef() string {
 	return s.GetStringField(FieldKeyStateModelDef, "")
 }
 
+// GetStateModelFactoryName returns the state model factory name field
+func (s *CurrentState) GetStateModelFactoryName() string {
+	return s.GetStringField(FieldKeyStateModelFactoryName, _defaultStateModelFactoryName)
+}
+
 // SetBucketSize sets the bucket size field
 func (s *CurrentState) SetBucketSize(size int) {
 	s.SetIntField(FieldKeyBucketSize, size)
@@ -89,3 +94,13 @@ func (s *CurrentState) SetStateModelFactoryName(name string) {
 func (s *CurrentState) SetState(partition string, state string) {
 	s.SetMapField(partition, FieldKeyCurrentState, state)
 }
+
+// GetInfo returns the additional info of a partition, such as the error of the last transition
+func (s *CurrentState) GetInfo(partition string) string {
+	return s.GetMapField(partition, FieldKeyInfo)
+}
+
+// SetInfo sets the additional info of a partition
+func (s *CurrentState) SetInfo(partition string, info string) {
+	s.SetMapField(partition, FieldKeyInfo, info)
+}
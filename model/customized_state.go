@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CustomizedState holds the application defined states of the partitions of a resource
+// on an instance, e.g. the replication lag, for a customized state type
+// Mirrors org.apache.helix.model.CustomizedState
+type CustomizedState struct {
+	ZNRecord
+}
+
+// NewCustomizedState creates a new customized state of the resource
+func NewCustomizedState(resource string) *CustomizedState {
+	return &CustomizedState{*NewRecord(resource)}
+}
+
+// GetPartitionStateMap returns the customized states by partition
+func (s *CustomizedState) GetPartitionStateMap() map[string]string {
+	result := make(map[string]string, len(s.MapFields))
+	for partition, fields := range s.MapFields {
+		result[partition] = fields[FieldKeyCurrentState]
+	}
+	return result
+}
+
+// GetState returns the customized state of the partition
+func (s *CustomizedState) GetState(partition string) string {
+	return s.GetMapField(partition, FieldKeyCurrentState)
+}
+
+// SetState sets the customized state of the partition and the time it was set
+func (s *CustomizedState) SetState(partition string, state string, t time.Time) {
+	s.SetMapField(partition, FieldKeyCurrentState, state)
+	s.SetMapField(partition, FieldKeyStartTime, strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))
+}
+
+// GetStartTime returns when the customized state of the partition was set
+func (s *CustomizedState) GetStartTime(partition string) time.Time {
+	ms, err := strconv.ParseInt(s.GetMapField(partition, FieldKeyStartTime), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// CustomizedView aggregates the customized states of a resource on the live instances
+// for a customized state type, partition->instance->state
+// Mirrors org.apache.helix.model.CustomizedView
+type CustomizedView struct {
+	ZNRecord
+}
+
+// NewCustomizedView creates a new customized view of the resource
+func NewCustomizedView(resource string) *CustomizedView {
+	return &CustomizedView{*NewRecord(resource)}
+}
+
+// GetResourceName returns the name of the resource
+func (v *CustomizedView) GetResourceName() string {
+	return v.ID
+}
+
+// GetPartitionSet returns the sorted partitions of the customized view
+func (v *CustomizedView) GetPartitionSet() []string {
+	partitions := make([]string, 0, len(v.MapFields))
+	for partition := range v.MapFields {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// GetStateMap returns the customized states of the partition by instance
+func (v *CustomizedView) GetStateMap(partition string) map[string]string {
+	return v.MapFields[partition]
+}
+
+// SetState sets the customized state of the partition on the instance
+func (v *CustomizedView) SetState(partition string, instance string, state string) {
+	v.SetMapField(partition, instance, state)
+}
@@ -20,6 +20,8 @@
 
 package model
 
+import "sort"
+
 // ExternalView represents a Helix external view
 type ExternalView struct {
 	ZNRecord
@@ -29,3 +31,69 @@ type ExternalView struct {
 func (s *ExternalView) GetNumPartitions() int {
 	return s.GetIntField(FieldKeyNumPartitions, -1)
 }
+
+// NewExternalView creates a new external view of the resource
+func NewExternalView(resource string) *ExternalView {
+	return &ExternalView{*NewRecord(resource)}
+}
+
+// GetResourceName returns the name of the resource
+func (s *ExternalView) GetResourceName() string {
+	return s.ID
+}
+
+// GetPartitionSet returns the sorted partitions of the external view
+func (s *ExternalView) GetPartitionSet() []string {
+	partitions := make([]string, 0, len(s.MapFields))
+	for partition := range s.MapFields {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// GetStateMap returns the states of the partition by instance
+func (s *ExternalView) GetStateMap(partition string) map[string]string {
+	return s.MapFields[partition]
+}
+
+// SetState sets the state of the partition on the instance
+func (s *ExternalView) SetState(partition string, instance string, state string) {
+	s.SetMapField(partition, instance, state)
+}
+
+// GetBucketSize returns the number of partitions per bucket znode, 0 if the external view is not bucketized
+func (s *ExternalView) GetBucketSize() int {
+	return s.GetIntField(FieldKeyBucketSize, 0)
+}
+
+// SetBucketSize splits the external view into bucket znodes of size partitions when it is written,
+// usually copied from the ideal state of the resource
+func (s *ExternalView) SetBucketSize(size int) {
+	s.SetIntField(FieldKeyBucketSize, size)
+}
+
+// GetInstanceGroupTag returns the tag of the instances hosting the resource, copied from the ideal state
+func (s *ExternalView) GetInstanceGroupTag() string {
+	return s.GetStringField(FieldKeyInstanceGroupTag, "")
+}
+
+// GetResourceGroupName returns the group the resource is routed with, copied from the ideal state
+func (s *ExternalView) GetResourceGroupName() string {
+	return s.GetStringField(FieldKeyResourceGroupName, "")
+}
+
+// IsGroupRoutingEnabled returns if the resource is routed with the other resources of its group
+func (s *ExternalView) IsGroupRoutingEnabled() bool {
+	return s.GetBooleanField(FieldKeyGroupRoutingEnabled, false)
+}
+
+// CopyRoutingFields copies the fields of the ideal state the spectators route with,
+// i.e. the instance group tag, the resource group and if group routing is enabled
+func (s *ExternalView) CopyRoutingFields(idealState *IdealState) {
+	for _, key := range []string{FieldKeyInstanceGroupTag, FieldKeyResourceGroupName, FieldKeyGroupRoutingEnabled} {
+		if value, ok := idealState.SimpleFields[key]; ok {
+			s.SetSimpleField(key, value)
+		}
+	}
+}
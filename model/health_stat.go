@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// HealthStat is a health report published by a participant,
+// it is stored under /{cluster}/INSTANCES/{instance}/HEALTHREPORT/{reportName}
+// and each stat is a map field keyed by the stat name
+type HealthStat struct {
+	ZNRecord
+}
+
+// NewHealthStat creates a new health report with the name
+func NewHealthStat(reportName string) *HealthStat {
+	return &HealthStat{*NewRecord(reportName)}
+}
+
+// SetStats replaces the stats of the report, stat name -> field -> value
+func (s *HealthStat) SetStats(stats map[string]map[string]string) {
+	s.MapFields = make(map[string]map[string]string, len(stats))
+	for stat, fields := range stats {
+		for field, value := range fields {
+			s.SetMapField(stat, field, value)
+		}
+	}
+}
+
+// GetStats returns the stats of the report
+func (s *HealthStat) GetStats() map[string]map[string]string {
+	return s.MapFields
+}
+
+// SetTimestamp sets the time the report is collected
+func (s *HealthStat) SetTimestamp(t time.Time) {
+	tMs := t.UnixNano() / int64(time.Millisecond)
+	s.SetSimpleField(FieldKeyTimestamp, fmt.Sprintf("%d", tMs))
+}
+
+// GetTimestamp returns the time the report is collected in milliseconds
+func (s *HealthStat) GetTimestamp() int64 {
+	return s.GetInt64Field(FieldKeyTimestamp, 0)
+}
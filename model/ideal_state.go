@@ -20,6 +20,11 @@
 
 package model
 
+import (
+	"fmt"
+	"sort"
+)
+
 // IdealState represents a Helix ideal state
 type IdealState struct {
 	ZNRecord
@@ -29,3 +34,139 @@ type IdealState struct {
 func (s *IdealState) GetNumPartitions() int {
 	return s.GetIntField(FieldKeyNumPartitions, -1)
 }
+
+// GetInstanceGroupTag returns the tag of the instances that can host the resource
+func (s *IdealState) GetInstanceGroupTag() string {
+	return s.GetStringField(FieldKeyInstanceGroupTag, "")
+}
+
+// SetInstanceGroupTag constrains the resource to the instances with the tag
+func (s *IdealState) SetInstanceGroupTag(tag string) {
+	s.SetSimpleField(FieldKeyInstanceGroupTag, tag)
+}
+
+// GetResourceGroupName returns the group the resource is routed with if group routing is enabled
+func (s *IdealState) GetResourceGroupName() string {
+	return s.GetStringField(FieldKeyResourceGroupName, "")
+}
+
+// SetResourceGroupName sets the group the resource is routed with
+func (s *IdealState) SetResourceGroupName(group string) {
+	s.SetSimpleField(FieldKeyResourceGroupName, group)
+}
+
+// IsGroupRoutingEnabled returns if the spectators route the resource with the other resources of its group
+func (s *IdealState) IsGroupRoutingEnabled() bool {
+	return s.GetBooleanField(FieldKeyGroupRoutingEnabled, false)
+}
+
+// SetGroupRoutingEnabled sets if the spectators route the resource with the other resources of its group
+func (s *IdealState) SetGroupRoutingEnabled(enabled bool) {
+	s.SetBooleanField(FieldKeyGroupRoutingEnabled, enabled)
+}
+
+// NewIdealState creates a new ideal state of the resource
+func NewIdealState(resource string) *IdealState {
+	return &IdealState{*NewRecord(resource)}
+}
+
+// GetResourceName returns the name of the resource
+func (s *IdealState) GetResourceName() string {
+	return s.ID
+}
+
+// IsEnabled returns false if the resource is disabled, its partitions are then
+// moved to the initial state
+func (s *IdealState) IsEnabled() bool {
+	return s.GetBooleanField(FieldKeyHelixEnabled, true)
+}
+
+// GetRebalanceMode returns the rebalance mode of the resource, e.g. RebalanceModeSemiAuto
+func (s *IdealState) GetRebalanceMode() string {
+	return s.GetStringField(FieldKeyRebalanceMode, "")
+}
+
+// SetRebalanceMode sets the rebalance mode of the resource
+func (s *IdealState) SetRebalanceMode(mode string) {
+	s.SetSimpleField(FieldKeyRebalanceMode, mode)
+}
+
+// GetRebalancerClassName returns the name of the rebalancer of a USER_DEFINED resource
+func (s *IdealState) GetRebalancerClassName() string {
+	return s.GetStringField(FieldKeyRebalancerClassName, "")
+}
+
+// SetRebalancerClassName sets the name of the rebalancer of a USER_DEFINED resource
+func (s *IdealState) SetRebalancerClassName(name string) {
+	s.SetSimpleField(FieldKeyRebalancerClassName, name)
+}
+
+// GetStateModelDefRef returns the state model of the resource,
+// ideal states written by older admins keep it in STATE_MODEL_DEF
+func (s *IdealState) GetStateModelDefRef() string {
+	return s.GetStringField(FieldKeyStateModelDefRef, s.GetStringField(FieldKeyStateModelDef, ""))
+}
+
+// SetStateModelDefRef sets the state model of the resource
+func (s *IdealState) SetStateModelDefRef(stateModel string) {
+	s.SetSimpleField(FieldKeyStateModelDefRef, stateModel)
+}
+
+// GetReplicas returns the number of replicas of each partition
+func (s *IdealState) GetReplicas() int {
+	return s.GetIntField(FieldKeyReplicas, 0)
+}
+
+// SetReplicas sets the number of replicas of each partition
+func (s *IdealState) SetReplicas(replicas int) {
+	s.SetIntField(FieldKeyReplicas, replicas)
+}
+
+// GetBucketSize returns the number of partitions per bucket znode, 0 if the ideal state is not bucketized
+func (s *IdealState) GetBucketSize() int {
+	return s.GetIntField(FieldKeyBucketSize, 0)
+}
+
+// SetBucketSize splits the ideal state into bucket znodes of size partitions when it is written,
+// e.g. for tens of thousands of partitions, 0 stores it in a single znode
+func (s *IdealState) SetBucketSize(size int) {
+	s.SetIntField(FieldKeyBucketSize, size)
+}
+
+// SetNumPartitions sets the number of partitions of the resource
+func (s *IdealState) SetNumPartitions(partitions int) {
+	s.SetIntField(FieldKeyNumPartitions, partitions)
+}
+
+// GetPartitionSet returns the partitions in the list and map fields, or the partitions
+// named <resource>_<i> if the ideal state has no per partition fields
+func (s *IdealState) GetPartitionSet() []string {
+	seen := map[string]struct{}{}
+	var partitions []string
+	for partition := range s.ListFields {
+		seen[partition] = struct{}{}
+		partitions = append(partitions, partition)
+	}
+	for partition := range s.MapFields {
+		if _, ok := seen[partition]; !ok {
+			partitions = append(partitions, partition)
+		}
+	}
+	if len(partitions) == 0 {
+		for i := 0; i < s.GetNumPartitions(); i++ {
+			partitions = append(partitions, fmt.Sprintf("%s_%d", s.ID, i))
+		}
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// GetPreferenceList returns the instances of the partition in the order of preference
+func (s *IdealState) GetPreferenceList(partition string) []string {
+	return s.GetListField(partition)
+}
+
+// SetPreferenceList sets the instances of the partition in the order of preference
+func (s *IdealState) SetPreferenceList(partition string, instances []string) {
+	s.SetListField(partition, instances)
+}
@@ -20,6 +20,16 @@
 
 package model
 
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // InstanceConfig represents configs for a Helix instance
 type InstanceConfig struct {
 	ZNRecord
@@ -30,6 +40,26 @@ func NewInstanceConfig(instanceName string) *InstanceConfig {
 	return &InstanceConfig{*NewRecord(instanceName)}
 }
 
+// InstanceName returns the name of the instance in the host_port form, the brackets of an IPv6
+// literal are removed, e.g. ::1_12000
+func InstanceName(host string, port int) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]") + "_" + strconv.Itoa(port)
+}
+
+// ParseInstanceName splits the name of an instance in the host_port form, the host may be an IPv6
+// literal or contain underscores since the port follows the last one
+func ParseInstanceName(name string) (string, int, error) {
+	i := strings.LastIndex(name, "_")
+	if i <= 0 {
+		return "", 0, errors.Errorf("instance name %q is not in the host_port form", name)
+	}
+	port, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return "", 0, errors.Errorf("instance name %q is not in the host_port form", name)
+	}
+	return name[:i], port, nil
+}
+
 // SetHost sets host of the instance
 func (c *InstanceConfig) SetHost(host string) {
 	c.SetSimpleField(FieldKeyHelixHost, host)
@@ -40,6 +70,64 @@ func (c *InstanceConfig) SetPort(port int) {
 	c.SetIntField(FieldKeyHelixPort, port)
 }
 
+// DefaultInstanceWeight is the weight of the instances without a weight in the config
+const DefaultInstanceWeight = 1000
+
+// GetHost returns host of the instance
+func (c *InstanceConfig) GetHost() string {
+	return c.GetStringField(FieldKeyHelixHost, "")
+}
+
+// GetPort returns port of the instance, or -1 if not set
+func (c *InstanceConfig) GetPort() int {
+	return c.GetIntField(FieldKeyHelixPort, -1)
+}
+
+// GetAddress returns the host:port address of the instance, with the IPv6 hosts in brackets,
+// or an empty string if the host or the port is not set
+func (c *InstanceConfig) GetAddress() string {
+	host, port := c.GetHost(), c.GetPort()
+	if host == "" || port < 0 {
+		return ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// SetEndpoint advertises the host:port address of the endpoint of the instance serving the
+// protocol, e.g. grpc or http, the IPv6 hosts are in brackets. The protocols are case insensitive
+func (c *InstanceConfig) SetEndpoint(protocol string, address string) error {
+	if protocol == "" {
+		return errors.Errorf("empty protocol of endpoint %s", address)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return errors.Wrapf(err, "invalid %s endpoint", protocol)
+	}
+	c.SetSimpleField(FieldKeyEndpointPrefix+strings.ToUpper(protocol), address)
+	return nil
+}
+
+// GetEndpoint returns the address of the endpoint of the instance serving the protocol
+func (c *InstanceConfig) GetEndpoint(protocol string) (string, bool) {
+	address, ok := c.SimpleFields[FieldKeyEndpointPrefix+strings.ToUpper(protocol)]
+	return address, ok && address != ""
+}
+
+// RemoveEndpoint stops advertising the endpoint of the protocol
+func (c *InstanceConfig) RemoveEndpoint(protocol string) {
+	delete(c.SimpleFields, FieldKeyEndpointPrefix+strings.ToUpper(protocol))
+}
+
+// GetEndpoints returns the protocol in lower case -> address of the endpoints of the instance
+func (c *InstanceConfig) GetEndpoints() map[string]string {
+	endpoints := map[string]string{}
+	for key, address := range c.SimpleFields {
+		if strings.HasPrefix(key, FieldKeyEndpointPrefix) && address != "" {
+			endpoints[strings.ToLower(strings.TrimPrefix(key, FieldKeyEndpointPrefix))] = address
+		}
+	}
+	return endpoints
+}
+
 // GetEnabled sets if the instance is enabled
 func (c *InstanceConfig) GetEnabled() bool {
 	return c.GetBooleanField(FieldKeyHelixEnabled, false)
@@ -49,3 +137,187 @@ func (c *InstanceConfig) GetEnabled() bool {
 func (c *InstanceConfig) SetEnabled(enabled bool) {
 	c.SetBooleanField(FieldKeyHelixEnabled, enabled)
 }
+
+// GetEnabledTime returns when the instance was last enabled or disabled,
+// it returns the zero time if not set
+func (c *InstanceConfig) GetEnabledTime() time.Time {
+	millis := c.GetInt64Field(FieldKeyHelixEnabledTimestamp, 0)
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// SetEnabledTime sets when the instance was last enabled or disabled
+func (c *InstanceConfig) SetEnabledTime(t time.Time) {
+	c.SetSimpleField(FieldKeyHelixEnabledTimestamp, strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))
+}
+
+// GetDisabledPartitions returns the sorted disabled partitions of the resource on the instance,
+// they are kept as comma separated partitions of each resource in the map field
+// mirroring org.apache.helix.model.InstanceConfig
+func (c *InstanceConfig) GetDisabledPartitions(resource string) []string {
+	value := c.GetMapField(FieldKeyHelixDisabledPartition, resource)
+	if value == "" {
+		return nil
+	}
+	partitions := strings.Split(value, ",")
+	sort.Strings(partitions)
+	return partitions
+}
+
+// IsPartitionEnabled checks if the partition of the resource is enabled on the instance
+func (c *InstanceConfig) IsPartitionEnabled(resource string, partition string) bool {
+	for _, p := range c.GetDisabledPartitions(resource) {
+		if p == partition {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPartitionEnabled enables or disables the partition of the resource on the instance
+func (c *InstanceConfig) SetPartitionEnabled(resource string, partition string, enabled bool) {
+	var partitions []string
+	for _, p := range c.GetDisabledPartitions(resource) {
+		if p != partition {
+			partitions = append(partitions, p)
+		}
+	}
+	if !enabled {
+		partitions = append(partitions, partition)
+		sort.Strings(partitions)
+	}
+	if len(partitions) == 0 {
+		delete(c.MapFields[FieldKeyHelixDisabledPartition], resource)
+		if len(c.MapFields[FieldKeyHelixDisabledPartition]) == 0 {
+			c.RemoveMapField(FieldKeyHelixDisabledPartition)
+		}
+		return
+	}
+	c.SetMapField(FieldKeyHelixDisabledPartition, resource, strings.Join(partitions, ","))
+}
+
+// GetTags returns the tags of the instance
+func (c *InstanceConfig) GetTags() []string {
+	return c.GetListField(FieldKeyTagList)
+}
+
+// ContainsTag checks if the instance has the tag
+func (c *InstanceConfig) ContainsTag(tag string) bool {
+	for _, t := range c.GetTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag adds a tag to the instance, adding an existing tag is a no-op
+func (c *InstanceConfig) AddTag(tag string) {
+	if c.ContainsTag(tag) {
+		return
+	}
+	c.SetListField(FieldKeyTagList, append(c.GetTags(), tag))
+}
+
+// RemoveTag removes a tag from the instance
+func (c *InstanceConfig) RemoveTag(tag string) {
+	tags := c.GetTags()
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	c.SetListField(FieldKeyTagList, result)
+}
+
+// GetZoneID returns the fault zone, e.g. the rack, of the instance
+func (c *InstanceConfig) GetZoneID() string {
+	return c.GetStringField(FieldKeyZoneID, "")
+}
+
+// SetZoneID sets the fault zone of the instance
+func (c *InstanceConfig) SetZoneID(zoneID string) {
+	c.SetSimpleField(FieldKeyZoneID, zoneID)
+}
+
+// GetDomain returns the location of the instance in the cluster topology,
+// e.g. zone=z1,rack=r1,instance=localhost_12000
+func (c *InstanceConfig) GetDomain() string {
+	return c.GetStringField(FieldKeyDomain, "")
+}
+
+// SetDomain sets the location of the instance in the cluster topology,
+// it returns an error if the domain is not comma separated key=value pairs
+func (c *InstanceConfig) SetDomain(domain string) error {
+	if _, err := parseDomain(domain); err != nil {
+		return err
+	}
+	c.SetSimpleField(FieldKeyDomain, domain)
+	return nil
+}
+
+// GetDomainAsMap returns the location of the instance by topology level,
+// the malformed pairs are skipped
+func (c *InstanceConfig) GetDomainAsMap() map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(c.GetDomain(), ",") {
+		if key, value, ok := parseDomainPair(pair); ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// GetWeight returns the weight of the instance for the capacity of its fault zone
+func (c *InstanceConfig) GetWeight() int {
+	return c.GetIntField(FieldKeyWeight, DefaultInstanceWeight)
+}
+
+// SetWeight sets the weight of the instance
+func (c *InstanceConfig) SetWeight(weight int) {
+	c.SetIntField(FieldKeyWeight, weight)
+}
+
+// GetInstanceCapacityMap returns the capacities of the instance for the WAGED rebalancer
+// by capacity key, the malformed entries are skipped
+func (c *InstanceConfig) GetInstanceCapacityMap() map[string]int {
+	capacity, _ := getIntMapField(c.ZNRecord, FieldKeyInstanceCapacityMap)
+	return capacity
+}
+
+// SetInstanceCapacityMap sets the capacities of the instance, the capacities must not be negative
+func (c *InstanceConfig) SetInstanceCapacityMap(capacity map[string]int) error {
+	for key, value := range capacity {
+		if value < 0 {
+			return errors.Errorf("invalid %s %s %d, must not be negative", FieldKeyInstanceCapacityMap, key, value)
+		}
+	}
+	setIntMapField(&c.ZNRecord, FieldKeyInstanceCapacityMap, capacity)
+	return nil
+}
+
+func parseDomain(domain string) (map[string]string, error) {
+	result := map[string]string{}
+	if domain == "" {
+		return result, nil
+	}
+	for _, pair := range strings.Split(domain, ",") {
+		key, value, ok := parseDomainPair(pair)
+		if !ok {
+			return nil, errors.Errorf("invalid domain %q, expecting key=value pairs", domain)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func parseDomainPair(pair string) (string, string, bool) {
+	kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return "", "", false
+	}
+	return kv[0], kv[1], true
+}
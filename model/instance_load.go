@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"strconv"
+)
+
+// The name and the stats of the load report of a participant
+const (
+	// LoadReportName is the name of the load report under INSTANCES/{instance}/HEALTHREPORT
+	LoadReportName = "LOAD"
+	// LoadStatLoad is the stat of the current usage of each metric, e.g. CPU or DISK
+	LoadStatLoad = "LOAD"
+	// LoadStatCapacity is the stat of the capacity of each metric
+	LoadStatCapacity = "CAPACITY"
+)
+
+// InstanceLoad is the load report of a participant, the usage and the capacity of metrics
+// like CPU, disk or custom gauges the rebalancers can factor into the placement. It is
+// a health report stored under /{cluster}/INSTANCES/{instance}/HEALTHREPORT/LOAD
+type InstanceLoad struct {
+	HealthStat
+}
+
+// NewInstanceLoad creates an empty load report
+func NewInstanceLoad() *InstanceLoad {
+	return &InstanceLoad{*NewHealthStat(LoadReportName)}
+}
+
+// SetLoad sets the current usage of the metric
+func (l *InstanceLoad) SetLoad(metric string, value float64) {
+	l.SetMapField(LoadStatLoad, metric, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// GetLoad returns the current usage of the metric, false if it is not reported
+func (l *InstanceLoad) GetLoad(metric string) (float64, bool) {
+	return l.getFloat(LoadStatLoad, metric)
+}
+
+// GetLoads returns the current usage by metric
+func (l *InstanceLoad) GetLoads() map[string]float64 {
+	return l.getFloats(LoadStatLoad)
+}
+
+// SetCapacity sets the capacity of the metric
+func (l *InstanceLoad) SetCapacity(metric string, value float64) {
+	l.SetMapField(LoadStatCapacity, metric, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// GetCapacity returns the capacity of the metric, false if it is not reported
+func (l *InstanceLoad) GetCapacity(metric string) (float64, bool) {
+	return l.getFloat(LoadStatCapacity, metric)
+}
+
+// GetCapacities returns the capacity by metric
+func (l *InstanceLoad) GetCapacities() map[string]float64 {
+	return l.getFloats(LoadStatCapacity)
+}
+
+// GetUtilization returns the usage of the metric as a fraction of its capacity,
+// false if the usage or a positive capacity is not reported
+func (l *InstanceLoad) GetUtilization(metric string) (float64, bool) {
+	load, ok := l.GetLoad(metric)
+	if !ok {
+		return 0, false
+	}
+	capacity, ok := l.GetCapacity(metric)
+	if !ok || capacity <= 0 {
+		return 0, false
+	}
+	return load / capacity, true
+}
+
+func (l *InstanceLoad) getFloat(stat string, metric string) (float64, bool) {
+	value, ok := l.MapFields[stat][metric]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return f, err == nil
+}
+
+func (l *InstanceLoad) getFloats(stat string) map[string]float64 {
+	result := make(map[string]float64, len(l.MapFields[stat]))
+	for metric := range l.MapFields[stat] {
+		if value, ok := l.getFloat(stat, metric); ok {
+			result[metric] = value
+		}
+	}
+	return result
+}
@@ -45,6 +45,11 @@ func (i *LiveInstance) GetSessionID() string {
 	return i.GetStringField(FieldKeySessionID, "")
 }
 
+// GetProcess returns the pid@hostname of the process of the live instance
+func (i *LiveInstance) GetProcess() string {
+	return i.GetStringField(FieldKeyLiveInstance, "")
+}
+
 // Mirrors Java LiveInstanceName, ManagementFactory.getRuntimeMXBean().getName()
 func getLiveInstanceName(instanceName string) string {
 	hostname, err := os.Hostname()
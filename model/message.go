@@ -56,6 +56,9 @@ type Message struct {
 	ZNRecord
 }
 
+// MsgTypeTaskReply is the type of the messages replying to a handled message
+const MsgTypeTaskReply = "TASK_REPLY"
+
 // MessageState is the state of the Helix message
 // mirrors org.apache.helix.model.Message#MessageState
 type MessageState int
@@ -142,31 +145,71 @@ func (m Message) GetTargetSessionID() string {
 	return m.GetStringField(FieldKeyTargetSessionID, "")
 }
 
+// SetTargetSessionID sets the target session ID of the message
+func (m *Message) SetTargetSessionID(sessionID string) {
+	m.SetSimpleField(FieldKeyTargetSessionID, sessionID)
+}
+
 // GetTargetName returns the target of the message, such as "PARTICIPANT"
 func (m Message) GetTargetName() string {
 	return m.GetStringField(FieldKeyTargetName, "")
 }
 
+// SetTargetName sets the target of the message
+func (m *Message) SetTargetName(targetName string) {
+	m.SetSimpleField(FieldKeyTargetName, targetName)
+}
+
 // GetMsgType returns the message type, such as "STATE_TRANSITION"
 func (m Message) GetMsgType() string {
 	return m.GetStringField(FieldKeyMsgType, "")
 }
 
+// SetMsgType sets the message type
+func (m *Message) SetMsgType(msgType string) {
+	m.SetSimpleField(FieldKeyMsgType, msgType)
+}
+
 // GetResourceName returns the resource name
 func (m Message) GetResourceName() string {
 	return m.GetStringField(FieldKeyResourceName, "")
 }
 
+// SetResourceName sets the resource name
+func (m *Message) SetResourceName(resourceName string) {
+	m.SetSimpleField(FieldKeyResourceName, resourceName)
+}
+
 // GetToState returns the toState
 func (m Message) GetToState() string {
 	return m.GetStringField(FieldKeyToState, "")
 }
 
+// SetToState sets the toState
+func (m *Message) SetToState(state string) {
+	m.SetSimpleField(FieldKeyToState, state)
+}
+
 // GetFromState returns the fromState
 func (m Message) GetFromState() string {
 	return m.GetStringField(FieldKeyFromState, "")
 }
 
+// SetFromState sets the fromState
+func (m *Message) SetFromState(state string) {
+	m.SetSimpleField(FieldKeyFromState, state)
+}
+
+// GetSrcName returns the name of the message sender
+func (m Message) GetSrcName() string {
+	return m.GetStringField(FieldKeySrcName, "")
+}
+
+// SetSrcName sets the name of the message sender
+func (m *Message) SetSrcName(srcName string) {
+	m.SetSimpleField(FieldKeySrcName, srcName)
+}
+
 // GetParentMsgID returns the parent message ID
 func (m Message) GetParentMsgID() string {
 	return m.GetStringField(FieldKeyParentMsgID, "")
@@ -177,6 +220,114 @@ func (m Message) GetCreateTimestamp() int64 {
 	return m.GetInt64Field(FieldKeyCreateTimestamp, 0)
 }
 
+// SetCreateTime sets the message creation timestamp
+func (m *Message) SetCreateTime(t time.Time) {
+	tMs := t.UnixNano() / int64(time.Millisecond)
+	m.SetSimpleField(FieldKeyCreateTimestamp, fmt.Sprintf("%d", tMs))
+}
+
+// GetExpiryPeriod returns the period after the creation the message expires, 0 if it doesn't expire
+func (m Message) GetExpiryPeriod() time.Duration {
+	ms := m.GetInt64Field(FieldKeyExpiryPeriod, -1)
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// SetExpiryPeriod sets the period after the creation the message expires
+func (m *Message) SetExpiryPeriod(period time.Duration) {
+	m.SetSimpleField(FieldKeyExpiryPeriod, fmt.Sprintf("%d", period.Nanoseconds()/int64(time.Millisecond)))
+}
+
+// IsExpired returns if the message was created longer than its expiry period ago,
+// the ttl is used if the message has no expiry period. Messages without create time never expire
+func (m Message) IsExpired(now time.Time, ttl time.Duration) bool {
+	if period := m.GetExpiryPeriod(); period > 0 {
+		ttl = period
+	}
+	createMs := m.GetCreateTimestamp()
+	if ttl <= 0 || createMs <= 0 {
+		return false
+	}
+	created := time.Unix(0, createMs*int64(time.Millisecond))
+	return now.Sub(created) > ttl
+}
+
+// GetExecutionTimeout returns the timeout of handling the message, 0 if the message has no timeout
+func (m Message) GetExecutionTimeout() time.Duration {
+	ms := m.GetInt64Field(FieldKeyTimeout, -1)
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// SetExecutionTimeout sets the timeout of handling the message
+func (m *Message) SetExecutionTimeout(timeout time.Duration) {
+	m.SetSimpleField(FieldKeyTimeout, fmt.Sprintf("%d", timeout.Nanoseconds()/int64(time.Millisecond)))
+}
+
+// GetCorrelationID returns the ID correlating the message and its reply
+func (m Message) GetCorrelationID() string {
+	return m.GetStringField(FieldKeyCorrelationID, "")
+}
+
+// SetCorrelationID sets the ID correlating the message and its reply
+func (m *Message) SetCorrelationID(id string) {
+	m.SetSimpleField(FieldKeyCorrelationID, id)
+}
+
+// GetSrcInstanceType returns the instance type of the sender, CONTROLLER by default
+func (m Message) GetSrcInstanceType() string {
+	return m.GetStringField(FieldKeySrcInstanceType, "CONTROLLER")
+}
+
+// SetSrcInstanceType sets the instance type of the sender, e.g. PARTICIPANT
+func (m *Message) SetSrcInstanceType(instanceType string) {
+	m.SetSimpleField(FieldKeySrcInstanceType, instanceType)
+}
+
+// GetInnerMessage returns the task message carried by the transition of a scheduled task,
+// the message is identified by the partition of the task
+func (m Message) GetInnerMessage() (*Message, bool) {
+	fields, ok := m.MapFields[FieldKeyInnerMessage]
+	if !ok {
+		return nil, false
+	}
+	partition, _ := m.GetPartitionName()
+	inner := NewMsg(partition)
+	for key, value := range fields {
+		inner.SetSimpleField(key, value)
+	}
+	return inner, true
+}
+
+// SetInnerMessage sets the task message carried by the transition of a scheduled task
+func (m *Message) SetInnerMessage(fields map[string]string) {
+	m.MapFields[FieldKeyInnerMessage] = fields
+}
+
+// GetMessageResult returns the result of the message handling carried by a reply message
+func (m Message) GetMessageResult() map[string]string {
+	return m.MapFields[FieldKeyMessageResult]
+}
+
+// NewReplyMsg creates the reply of the message handled by the instance, with the result
+// of the handling. This mirrors org.apache.helix.model.Message#createReplyMessage
+func NewReplyMsg(msg *Message, id string, instanceName string, result map[string]string) *Message {
+	reply := NewMsg(id)
+	reply.SetMsgType(MsgTypeTaskReply)
+	reply.SetCorrelationID(msg.GetCorrelationID())
+	reply.SetSrcName(instanceName)
+	reply.SetTargetName(msg.GetSrcName())
+	reply.SetTargetSessionID("*")
+	reply.SetMsgState(MessageStateNew)
+	reply.SetCreateTime(time.Now())
+	reply.MapFields[FieldKeyMessageResult] = result
+	return reply
+}
+
 // GetBucketSize return the bucket size of the message
 func (m Message) GetBucketSize() int {
 	return m.GetIntField(FieldKeyBucketSize, 0)
@@ -191,3 +342,8 @@ func (m *Message) GetBatchMsgMode() bool {
 func (m *Message) GetStateModelFactoryName() string {
 	return m.GetStringField(FieldKeyStateModelFactoryName, _defaultStateModelFactoryName)
 }
+
+// SetStateModelFactoryName sets the state model factory name
+func (m *Message) SetStateModelFactoryName(name string) {
+	m.SetSimpleField(FieldKeyStateModelFactoryName, name)
+}
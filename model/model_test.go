@@ -21,6 +21,7 @@
 package model
 
 import (
+	"errors"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -100,6 +101,89 @@ func TestMsg(t *testing.T) {
 	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), int64(parsed)) // check rounding
 }
 
+func TestMsgSetters(t *testing.T) {
+	msg := NewMsg("test_id")
+	msg.SetMsgType("STATE_TRANSITION")
+	msg.SetSrcName("localhost-ADMIN")
+	msg.SetTargetName("localhost_12913")
+	msg.SetTargetSessionID("93406067297878252")
+	msg.SetResourceName("myDB")
+	msg.SetFromState("ERROR")
+	msg.SetToState("OFFLINE")
+	now := time.Now()
+	msg.SetCreateTime(now)
+	assert.Equal(t, "STATE_TRANSITION", msg.GetMsgType())
+	assert.Equal(t, "localhost-ADMIN", msg.GetSrcName())
+	assert.Equal(t, "localhost_12913", msg.GetTargetName())
+	assert.Equal(t, "93406067297878252", msg.GetTargetSessionID())
+	assert.Equal(t, "myDB", msg.GetResourceName())
+	assert.Equal(t, "ERROR", msg.GetFromState())
+	assert.Equal(t, "OFFLINE", msg.GetToState())
+	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), msg.GetCreateTimestamp())
+}
+
+func TestMsgExpiry(t *testing.T) {
+	msg := NewMsg("test_id")
+	now := time.Now()
+	assert.False(t, msg.IsExpired(now, time.Minute), "message without create time never expires")
+	msg.SetCreateTime(now.Add(-time.Hour))
+	assert.False(t, msg.IsExpired(now, 0))
+	assert.True(t, msg.IsExpired(now, time.Minute))
+	assert.False(t, msg.IsExpired(now, 2*time.Hour))
+
+	assert.Equal(t, time.Duration(0), msg.GetExpiryPeriod())
+	msg.SetExpiryPeriod(2 * time.Hour)
+	assert.Equal(t, 2*time.Hour, msg.GetExpiryPeriod())
+	assert.False(t, msg.IsExpired(now, time.Minute), "expiry period of the message overrides the ttl")
+	assert.True(t, msg.IsExpired(now.Add(2*time.Hour), time.Minute))
+}
+
+func TestStateTransitionError(t *testing.T) {
+	msg := NewMsg("msg_id")
+	msg.SetFromState("OFFLINE")
+	msg.SetToState("ONLINE")
+	transitionError := NewStateTransitionError("partition_1")
+	assert.Len(t, transitionError.GetErrors(), 0)
+
+	transitionError.AddError(msg, errors.New("test error"), time.Now())
+	assert.Equal(t, map[string]string{"msg_id": "test error"}, transitionError.GetErrors())
+	assert.Equal(t, "OFFLINE", transitionError.GetMapField("msg_id", FieldKeyFromState))
+	assert.Equal(t, "ONLINE", transitionError.GetMapField("msg_id", FieldKeyToState))
+}
+
+func TestInstanceLoad(t *testing.T) {
+	load := NewInstanceLoad()
+	assert.Equal(t, LoadReportName, load.ID)
+	load.SetLoad("CPU", 3)
+	load.SetCapacity("CPU", 4)
+	load.SetLoad("DISK", 0.5)
+	assert.Equal(t, map[string]float64{"CPU": 3, "DISK": 0.5}, load.GetLoads())
+	assert.Equal(t, map[string]float64{"CPU": 4}, load.GetCapacities())
+	utilization, ok := load.GetUtilization("CPU")
+	assert.True(t, ok)
+	assert.Equal(t, 0.75, utilization)
+	_, ok = load.GetUtilization("DISK")
+	assert.False(t, ok)
+	_, ok = load.GetLoad("MEMORY")
+	assert.False(t, ok)
+}
+
+func TestHealthStat(t *testing.T) {
+	stat := NewHealthStat("report")
+	stats := map[string]map[string]string{
+		"latency": {"p99": "10"},
+		"qps":     {"value": "100"},
+	}
+	stat.SetStats(stats)
+	assert.Equal(t, stats, stat.GetStats())
+	now := time.Now()
+	stat.SetTimestamp(now)
+	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), stat.GetTimestamp())
+
+	stat.SetStats(map[string]map[string]string{"qps": {"value": "200"}})
+	assert.Equal(t, map[string]map[string]string{"qps": {"value": "200"}}, stat.GetStats())
+}
+
 func TestInstanceConfig(t *testing.T) {
 	config := NewInstanceConfig("test_instance")
 	assert.False(t, config.GetEnabled())
@@ -115,6 +199,19 @@ func TestInstanceConfig(t *testing.T) {
 	assert.Equal(t, port, config.GetIntField(FieldKeyHelixPort, port+1))
 }
 
+func TestInstanceConfigTags(t *testing.T) {
+	config := NewInstanceConfig("test_instance")
+	assert.Len(t, config.GetTags(), 0)
+	config.AddTag("tag1")
+	config.AddTag("tag2")
+	config.AddTag("tag1")
+	assert.Equal(t, []string{"tag1", "tag2"}, config.GetTags())
+	assert.True(t, config.ContainsTag("tag1"))
+	config.RemoveTag("tag1")
+	assert.False(t, config.ContainsTag("tag1"))
+	assert.Equal(t, []string{"tag2"}, config.GetTags())
+}
+
 func TestLiveInstanceConfig(t *testing.T) {
 	instanceName := "test_instance"
 	instance := NewLiveInstance(instanceName, "test_session")
@@ -140,6 +237,11 @@ func TestCurrentState(t *testing.T) {
 	assert.Equal(t, state.GetState("partition_1"), "state1")
 	assert.Equal(t, state.GetState("partition_2"), "state2")
 	assert.Len(t, state.GetPartitionStateMap(), 2)
+
+	assert.Equal(t, "", state.GetInfo("partition_1"))
+	state.SetInfo("partition_1", "test error")
+	assert.Equal(t, "test error", state.GetInfo("partition_1"))
+	assert.Equal(t, "state1", state.GetState("partition_1"))
 }
 
 func TestIdealState(t *testing.T) {
@@ -149,6 +251,135 @@ func TestIdealState(t *testing.T) {
 	record.SetIntField(FieldKeyNumPartitions, numPartitions)
 	state := &IdealState{ZNRecord: *record}
 	assert.Equal(t, numPartitions, state.GetNumPartitions())
+	assert.Equal(t, "", state.GetInstanceGroupTag())
+	state.SetInstanceGroupTag("tag")
+	assert.Equal(t, "tag", state.GetInstanceGroupTag())
+	assert.True(t, state.IsEnabled())
+	state.SetBooleanField(FieldKeyHelixEnabled, false)
+	assert.False(t, state.IsEnabled())
+}
+
+func TestIdealStateRebalanceFields(t *testing.T) {
+	state := NewIdealState("resource")
+	assert.Equal(t, "resource", state.GetResourceName())
+	state.SetRebalanceMode(RebalanceModeUserDefined)
+	assert.Equal(t, RebalanceModeUserDefined, state.GetRebalanceMode())
+	state.SetRebalancerClassName("rebalancer")
+	assert.Equal(t, "rebalancer", state.GetRebalancerClassName())
+	state.SetReplicas(3)
+	assert.Equal(t, 3, state.GetReplicas())
+
+	state.SetSimpleField(FieldKeyStateModelDef, "OnlineOffline")
+	assert.Equal(t, "OnlineOffline", state.GetStateModelDefRef())
+	state.SetStateModelDefRef("MasterSlave")
+	assert.Equal(t, "MasterSlave", state.GetStateModelDefRef())
+
+	state.SetNumPartitions(2)
+	assert.Equal(t, []string{"resource_0", "resource_1"}, state.GetPartitionSet())
+	state.SetListField("p2", []string{"i1"})
+	state.SetMapField("p1", "i1", "ONLINE")
+	state.SetMapField("p2", "i1", "ONLINE")
+	assert.Equal(t, []string{"p1", "p2"}, state.GetPartitionSet())
+}
+
+func TestStateModelDef(t *testing.T) {
+	record, err := NewRecordFromBytes([]byte(`{
+		"id": "OnlineOffline",
+		"mapFields": {
+			"OFFLINE.next": {"DROPPED": "DROPPED", "ONLINE": "ONLINE"},
+			"ONLINE.next": {"DROPPED": "OFFLINE", "OFFLINE": "OFFLINE"}
+		},
+		"simpleFields": {"INITIAL_STATE": "OFFLINE"}
+	}`))
+	assert.NoError(t, err)
+	def := &StateModelDef{ZNRecord: *record}
+	assert.Equal(t, "OFFLINE", def.GetInitialState())
+	assert.Equal(t, "OFFLINE", def.GetNextState("ONLINE", "DROPPED"))
+	assert.Equal(t, "ONLINE", def.GetNextState("OFFLINE", "ONLINE"))
+	assert.Equal(t, "", def.GetNextState("DROPPED", "ONLINE"))
+	assert.Nil(t, def.GetStatesPriorityList())
+}
+
+func TestStateModelDefStateCounts(t *testing.T) {
+	record, err := NewRecordFromBytes([]byte(`{
+		"id": "MasterSlave",
+		"mapFields": {
+			"MASTER.meta": {"count": "1"},
+			"SLAVE.meta": {"count": "R"},
+			"OFFLINE.meta": {"count": "-1"}
+		},
+		"listFields": {"STATE_PRIORITY_LIST": ["MASTER", "SLAVE", "OFFLINE"]}
+	}`))
+	assert.NoError(t, err)
+	def := &StateModelDef{ZNRecord: *record}
+	assert.Equal(t, []string{"MASTER", "SLAVE", "OFFLINE"}, def.GetStatesPriorityList())
+	assert.Equal(t, "1", def.GetStateCount("MASTER"))
+	assert.Equal(t, "R", def.GetStateCount("SLAVE"))
+	assert.Equal(t, "-1", def.GetStateCount("OFFLINE"))
+	assert.Equal(t, "", def.GetStateCount("ERROR"))
+}
+
+func TestCustomizedState(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	state := NewCustomizedState("resource")
+	assert.Equal(t, "", state.GetState("p0"))
+	assert.True(t, state.GetStartTime("p0").IsZero())
+	state.SetState("p0", "CAUGHT_UP", now)
+	state.SetState("p1", "LAGGING", now)
+	assert.Equal(t, "CAUGHT_UP", state.GetState("p0"))
+	assert.Equal(t, now, state.GetStartTime("p0"))
+	assert.Equal(t, map[string]string{"p0": "CAUGHT_UP", "p1": "LAGGING"}, state.GetPartitionStateMap())
+
+	view := NewCustomizedView("resource")
+	assert.Equal(t, "resource", view.GetResourceName())
+	view.SetState("p1", "i1", "LAGGING")
+	view.SetState("p0", "i1", "CAUGHT_UP")
+	view.SetState("p0", "i2", "LAGGING")
+	assert.Equal(t, []string{"p0", "p1"}, view.GetPartitionSet())
+	assert.Equal(t, map[string]string{"i1": "CAUGHT_UP", "i2": "LAGGING"}, view.GetStateMap("p0"))
+}
+
+func TestMsgTimeoutAndReply(t *testing.T) {
+	msg := NewMsg("test_id")
+	assert.Equal(t, time.Duration(0), msg.GetExecutionTimeout())
+	msg.SetExecutionTimeout(time.Second)
+	assert.Equal(t, time.Second, msg.GetExecutionTimeout())
+	assert.Equal(t, "CONTROLLER", msg.GetSrcInstanceType())
+	msg.SetCorrelationID("correlation")
+	msg.SetSrcName("controller")
+
+	reply := NewReplyMsg(msg, "reply_id", "instance", map[string]string{"SUCCESS": "true"})
+	assert.Equal(t, "reply_id", reply.ID)
+	assert.Equal(t, MsgTypeTaskReply, reply.GetMsgType())
+	assert.Equal(t, "correlation", reply.GetCorrelationID())
+	assert.Equal(t, "instance", reply.GetSrcName())
+	assert.Equal(t, "controller", reply.GetTargetName())
+	assert.Equal(t, "*", reply.GetTargetSessionID())
+	assert.Equal(t, map[string]string{"SUCCESS": "true"}, reply.GetMessageResult())
+}
+
+func TestMsgInnerMessage(t *testing.T) {
+	msg := NewMsg("test_id")
+	_, ok := msg.GetInnerMessage()
+	assert.False(t, ok)
+	msg.SetPartitionName("task_id")
+	msg.SetInnerMessage(map[string]string{FieldKeyMsgType: "COMPACTION", "TABLE": "users"})
+	inner, ok := msg.GetInnerMessage()
+	assert.True(t, ok)
+	assert.Equal(t, "task_id", inner.ID)
+	assert.Equal(t, "COMPACTION", inner.GetMsgType())
+	assert.Equal(t, "users", inner.GetStringField("TABLE", ""))
+}
+
+func TestStateModelDefTransitionTimeout(t *testing.T) {
+	def := &StateModelDef{ZNRecord: *NewRecord("OnlineOffline")}
+	assert.Equal(t, time.Duration(0), def.GetTransitionTimeout("OFFLINE", "ONLINE"))
+	def.SetTransitionTimeout("*", "*", time.Minute)
+	def.SetTransitionTimeout("OFFLINE", "*", 2*time.Minute)
+	def.SetTransitionTimeout("OFFLINE", "ONLINE", time.Second)
+	assert.Equal(t, time.Second, def.GetTransitionTimeout("OFFLINE", "ONLINE"))
+	assert.Equal(t, 2*time.Minute, def.GetTransitionTimeout("OFFLINE", "DROPPED"))
+	assert.Equal(t, time.Minute, def.GetTransitionTimeout("ONLINE", "OFFLINE"))
 }
 
 func TestExternalView(t *testing.T) {
@@ -158,4 +389,465 @@ func TestExternalView(t *testing.T) {
 	record.SetIntField(FieldKeyNumPartitions, numPartitions)
 	state := &ExternalView{ZNRecord: *record}
 	assert.Equal(t, numPartitions, state.GetNumPartitions())
+
+	view := NewExternalView("r")
+	assert.Equal(t, "r", view.GetResourceName())
+	view.SetState("r_1", "i1", "ONLINE")
+	view.SetState("r_0", "i2", "OFFLINE")
+	assert.Equal(t, []string{"r_0", "r_1"}, view.GetPartitionSet())
+	assert.Equal(t, map[string]string{"i1": "ONLINE"}, view.GetStateMap("r_1"))
+
+	idealState := NewIdealState("r")
+	assert.False(t, idealState.IsGroupRoutingEnabled())
+	idealState.SetGroupRoutingEnabled(true)
+	idealState.SetResourceGroupName("g")
+	idealState.SetInstanceGroupTag("tag")
+	view.CopyRoutingFields(idealState)
+	assert.True(t, view.IsGroupRoutingEnabled())
+	assert.Equal(t, "g", view.GetResourceGroupName())
+	assert.Equal(t, "tag", view.GetInstanceGroupTag())
+}
+
+func TestClusterConfigDelayedRebalance(t *testing.T) {
+	config := NewClusterConfig("cluster")
+	assert.True(t, config.IsDelayRebalanceEnabled())
+	_, ok := config.GetRebalanceDelayTime()
+	assert.False(t, ok)
+	config.SetDelayRebalanceEnabled(false)
+	assert.False(t, config.IsDelayRebalanceEnabled())
+	config.SetRebalanceDelayTime(5 * time.Minute)
+	delay, ok := config.GetRebalanceDelayTime()
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, delay)
+	assert.Equal(t, "300000", config.GetStringField(FieldKeyDelayRebalanceTime, ""))
+	assert.NoError(t, config.Validate())
+	config.SetRebalanceDelayTime(-time.Second)
+	assert.Error(t, config.Validate())
+}
+
+func TestResourceConfigDelayedRebalance(t *testing.T) {
+	cluster := NewClusterConfig("cluster")
+	cluster.SetRebalanceDelayTime(time.Minute)
+	config := NewResourceConfig("resource")
+	assert.Equal(t, -1, config.GetMinActiveReplicas())
+	assert.Equal(t, time.Minute, config.GetEffectiveRebalanceDelay(cluster))
+	config.SetRebalanceDelay(time.Second)
+	assert.Equal(t, time.Second, config.GetEffectiveRebalanceDelay(cluster))
+	assert.Equal(t, time.Second, config.GetEffectiveRebalanceDelay(nil))
+	cluster.SetDelayRebalanceEnabled(false)
+	assert.False(t, config.IsDelayRebalanceEnabledInCluster(cluster))
+	assert.Equal(t, time.Duration(0), config.GetEffectiveRebalanceDelay(cluster))
+
+	config.SetMinActiveReplicas(2)
+	assert.Equal(t, 2, config.GetMinActiveReplicas())
+	assert.NoError(t, config.Validate(3))
+	assert.NoError(t, config.Validate(0))
+	assert.Error(t, config.Validate(1))
+	config.SetMinActiveReplicas(-2)
+	assert.Error(t, config.Validate(3))
+	config.SetMinActiveReplicas(1)
+	config.SetRebalanceDelay(-time.Second)
+	assert.Error(t, config.Validate(3))
+}
+
+func TestInstanceConfigEnabledAndDisabledPartitions(t *testing.T) {
+	config := NewInstanceConfig("localhost_123")
+	config.SetHost("localhost")
+	config.SetPort(123)
+	assert.Equal(t, "localhost", config.GetHost())
+	assert.Equal(t, 123, config.GetPort())
+	assert.True(t, config.GetEnabledTime().IsZero())
+	now := time.Unix(1500000000, 0)
+	config.SetEnabledTime(now)
+	assert.Equal(t, now, config.GetEnabledTime())
+
+	assert.True(t, config.IsPartitionEnabled("resource", "p1"))
+	config.SetPartitionEnabled("resource", "p2", false)
+	config.SetPartitionEnabled("resource", "p1", false)
+	config.SetPartitionEnabled("resource", "p1", false)
+	assert.Equal(t, []string{"p1", "p2"}, config.GetDisabledPartitions("resource"))
+	assert.Equal(t, "p1,p2", config.GetMapField(FieldKeyHelixDisabledPartition, "resource"))
+	assert.False(t, config.IsPartitionEnabled("resource", "p1"))
+	assert.True(t, config.IsPartitionEnabled("other", "p1"))
+
+	config.SetPartitionEnabled("resource", "p1", true)
+	assert.Equal(t, []string{"p2"}, config.GetDisabledPartitions("resource"))
+	config.SetPartitionEnabled("resource", "p2", true)
+	assert.Empty(t, config.GetDisabledPartitions("resource"))
+	assert.NotContains(t, config.MapFields, FieldKeyHelixDisabledPartition)
+}
+
+func TestClusterConfigTypedFields(t *testing.T) {
+	config := NewClusterConfig("cluster")
+	assert.Equal(t, -1, config.GetMaxPartitionsPerInstance())
+	assert.Equal(t, -1, config.GetBatchStateTransitionMaxThreads())
+	config.SetTopology("/zone/rack/instance")
+	config.SetFaultZoneType("rack")
+	config.SetTopologyAwareEnabled(true)
+	config.SetMaxPartitionsPerInstance(10)
+	config.SetBatchStateTransitionMaxThreads(4)
+	config.SetPersistBestPossibleAssignment(true)
+	assert.Equal(t, "/zone/rack/instance", config.GetTopology())
+	assert.Equal(t, "rack", config.GetFaultZoneType())
+	assert.True(t, config.IsTopologyAwareEnabled())
+	assert.Equal(t, 10, config.GetMaxPartitionsPerInstance())
+	assert.Equal(t, 4, config.GetBatchStateTransitionMaxThreads())
+	assert.True(t, config.IsPersistBestPossibleAssignment())
+
+	throttles := []StateTransitionThrottleConfig{
+		{ThrottleRebalanceTypeLoadBalance, ThrottleConfigTypeInstance, 10},
+		{ThrottleRebalanceTypeAny, ThrottleConfigTypeCluster, 100},
+	}
+	assert.NoError(t, config.SetStateTransitionThrottleConfigs(throttles))
+	assert.Equal(t, throttles, config.GetStateTransitionThrottleConfigs())
+	assert.Equal(t, `{"rebalanceType":"LOAD_BALANCE","configType":"INSTANCE","maxPartitionInTransition":"10"}`,
+		config.GetListField(FieldKeyStateTransitionThrottles)[0])
+	assert.NoError(t, config.Validate())
+
+	config.SetFaultZoneType("zone_id")
+	assert.Error(t, config.Validate())
+	config.SetFaultZoneType("zone")
+	config.SetListField(FieldKeyStateTransitionThrottles, []string{"{"})
+	assert.Error(t, config.Validate())
+	assert.NoError(t, config.SetStateTransitionThrottleConfigs([]StateTransitionThrottleConfig{
+		{"UNKNOWN", ThrottleConfigTypeInstance, 1},
+	}))
+	assert.Error(t, config.Validate())
+	config.SetListField(FieldKeyStateTransitionThrottles, nil)
+	config.SetTopology("")
+	assert.Error(t, config.Validate())
+}
+
+func TestConfigRoundTripKeepsUnknownFields(t *testing.T) {
+	record, err := NewRecordFromBytes([]byte(`{
+		"id": "resource",
+		"simpleFields": {"REPLICAS": "3", "JAVA_ONLY_FIELD": "value"},
+		"listFields": {"JAVA_ONLY_LIST": ["a", "b"]},
+		"mapFields": {"JAVA_ONLY_MAP": {"k": "v"}}
+	}`))
+	assert.NoError(t, err)
+	config := &ResourceConfig{ZNRecord: *record}
+	assert.Equal(t, "3", config.GetReplicas())
+	config.SetBatchMessageMode(true)
+	config.SetInstanceGroupTag("tag")
+	data, err := config.Marshal()
+	assert.NoError(t, err)
+
+	record, err = NewRecordFromBytes(data)
+	assert.NoError(t, err)
+	config = &ResourceConfig{ZNRecord: *record}
+	assert.True(t, config.GetBatchMessageMode())
+	assert.Equal(t, "tag", config.GetInstanceGroupTag())
+	assert.Equal(t, "value", config.GetStringField("JAVA_ONLY_FIELD", ""))
+	assert.Equal(t, []string{"a", "b"}, config.GetListField("JAVA_ONLY_LIST"))
+	assert.Equal(t, "v", config.GetMapField("JAVA_ONLY_MAP", "k"))
+}
+
+func TestResourceConfigTypedFields(t *testing.T) {
+	config := NewResourceConfig("resource")
+	assert.Equal(t, -1, config.GetNumPartitions())
+	assert.Equal(t, -1, config.GetMaxPartitionsPerInstance())
+	config.SetStateModelDefRef("OnlineOffline")
+	config.SetNumPartitions(8)
+	config.SetMaxPartitionsPerInstance(2)
+	config.SetMonitoringDisabled(true)
+	assert.Equal(t, "OnlineOffline", config.GetStateModelDefRef())
+	assert.Equal(t, 8, config.GetNumPartitions())
+	assert.Equal(t, 2, config.GetMaxPartitionsPerInstance())
+	assert.True(t, config.IsMonitoringDisabled())
+
+	config.SetReplicas("ANY_LIVEINSTANCE")
+	assert.NoError(t, config.Validate(0))
+	config.SetReplicas("three")
+	assert.Error(t, config.Validate(0))
+}
+
+func TestInstanceConfigDomain(t *testing.T) {
+	config := NewInstanceConfig("localhost_123")
+	assert.Empty(t, config.GetDomainAsMap())
+	assert.Equal(t, DefaultInstanceWeight, config.GetWeight())
+	assert.NoError(t, config.SetDomain("zone=z1, rack=r1,instance=localhost_123"))
+	assert.Equal(t, map[string]string{"zone": "z1", "rack": "r1", "instance": "localhost_123"},
+		config.GetDomainAsMap())
+	assert.Error(t, config.SetDomain("zone=z1,rack"))
+	assert.Equal(t, "zone=z1, rack=r1,instance=localhost_123", config.GetDomain())
+	config.SetWeight(10)
+	assert.Equal(t, 10, config.GetWeight())
+}
+
+func TestInstanceName(t *testing.T) {
+	assert.Equal(t, "localhost_123", InstanceName("localhost", 123))
+	assert.Equal(t, "::1_123", InstanceName("[::1]", 123))
+	for name, want := range map[string]struct {
+		host string
+		port int
+	}{
+		"localhost_123":   {"localhost", 123},
+		"::1_123":         {"::1", 123},
+		"fe80::1%eth0_12": {"fe80::1%eth0", 12},
+		"my_host_123":     {"my_host", 123},
+	} {
+		host, port, err := ParseInstanceName(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want.host, host, name)
+		assert.Equal(t, want.port, port, name)
+	}
+	for _, name := range []string{"localhost", "_123", "localhost_", "localhost_abc"} {
+		_, _, err := ParseInstanceName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestInstanceConfigEndpoints(t *testing.T) {
+	config := NewInstanceConfig("::1_123")
+	assert.Empty(t, config.GetAddress())
+	config.SetHost("::1")
+	config.SetPort(123)
+	assert.Equal(t, "[::1]:123", config.GetAddress())
+
+	assert.Empty(t, config.GetEndpoints())
+	assert.NoError(t, config.SetEndpoint("grpc", "[::1]:9090"))
+	assert.NoError(t, config.SetEndpoint("HTTP", "localhost:8080"))
+	assert.Error(t, config.SetEndpoint("grpc", "::1:9090"))
+	assert.Error(t, config.SetEndpoint("", "localhost:8080"))
+	address, ok := config.GetEndpoint("GRPC")
+	assert.True(t, ok)
+	assert.Equal(t, "[::1]:9090", address)
+	assert.Equal(t, map[string]string{"grpc": "[::1]:9090", "http": "localhost:8080"}, config.GetEndpoints())
+	config.RemoveEndpoint("http")
+	_, ok = config.GetEndpoint("http")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]string{"grpc": "[::1]:9090"}, config.GetEndpoints())
+}
+
+func TestWagedRebalanceConfig(t *testing.T) {
+	cluster := NewClusterConfig("cluster")
+	cluster.SetInstanceCapacityKeys([]string{"CPU", "DISK"})
+	cluster.SetDefaultInstanceCapacityMap(map[string]int{"CPU": 100, "DISK": 1000})
+	cluster.SetDefaultPartitionWeightMap(map[string]int{"CPU": 1, "DISK": 10})
+	cluster.SetGlobalRebalancePreference(map[string]int{
+		RebalancePreferenceEvenness: 1, RebalancePreferenceLessMovement: 2,
+	})
+	assert.Equal(t, []string{"CPU", "DISK"}, cluster.GetInstanceCapacityKeys())
+	assert.Equal(t, "100", cluster.GetMapField(FieldKeyDefaultInstanceCapacityMap, "CPU"))
+	assert.Equal(t, map[string]int{"CPU": 1, "DISK": 10}, cluster.GetDefaultPartitionWeightMap())
+	assert.Equal(t, 2, cluster.GetGlobalRebalancePreference()[RebalancePreferenceLessMovement])
+	assert.NoError(t, cluster.Validate())
+
+	instance := NewInstanceConfig("localhost_123")
+	capacity, err := cluster.GetInstanceCapacity(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CPU": 100, "DISK": 1000}, capacity)
+	assert.Error(t, instance.SetInstanceCapacityMap(map[string]int{"CPU": -1}))
+	assert.NoError(t, instance.SetInstanceCapacityMap(map[string]int{"CPU": 50}))
+	assert.Equal(t, map[string]int{"CPU": 50}, instance.GetInstanceCapacityMap())
+	_, err = cluster.GetInstanceCapacity(instance)
+	assert.Error(t, err)
+
+	resource := NewResourceConfig("resource")
+	weight, err := resource.GetPartitionCapacity("resource_0", cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CPU": 1, "DISK": 10}, weight)
+	assert.NoError(t, resource.SetPartitionCapacityMap(map[string]map[string]int{
+		DefaultPartitionCapacityKey: {"CPU": 2, "DISK": 20},
+		"resource_1":                {"CPU": 4, "DISK": 40},
+	}))
+	assert.Equal(t, `{"CPU":4,"DISK":40}`, resource.GetMapField(FieldKeyPartitionCapacityMap, "resource_1"))
+	weight, err = resource.GetPartitionCapacity("resource_0", cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CPU": 2, "DISK": 20}, weight)
+	weight, err = resource.GetPartitionCapacity("resource_1", cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CPU": 4, "DISK": 40}, weight)
+	assert.NoError(t, resource.Validate(0))
+	resource.SetMapField(FieldKeyPartitionCapacityMap, "resource_2", "{")
+	assert.Error(t, resource.Validate(0))
+
+	cluster.SetGlobalRebalancePreference(map[string]int{RebalancePreferenceEvenness: MaxRebalancePreference + 1})
+	assert.Error(t, cluster.Validate())
+	cluster.SetGlobalRebalancePreference(nil)
+	cluster.SetMapField(FieldKeyDefaultInstanceCapacityMap, "CPU", "lots")
+	assert.Error(t, cluster.Validate())
+}
+
+func TestClusterConstraints(t *testing.T) {
+	constraints := NewClusterConstraints(ConstraintTypeMessage)
+	perInstance := ConstraintItem{
+		Attributes: map[string]string{ConstraintAttributeMessageType: "STATE_TRANSITION", ConstraintAttributeInstance: ".*"},
+		Value:      "2",
+	}
+	oneInstance := ConstraintItem{
+		Attributes: map[string]string{ConstraintAttributeMessageType: "STATE_TRANSITION", ConstraintAttributeInstance: "i1"},
+		Value:      "1",
+	}
+	perResource := ConstraintItem{
+		Attributes: map[string]string{ConstraintAttributeResource: "r.*"},
+		Value:      "10",
+	}
+	for _, item := range []ConstraintItem{perInstance, oneInstance, perResource} {
+		assert.NoError(t, item.Validate())
+	}
+	assert.Error(t, ConstraintItem{Attributes: map[string]string{"HOST": ".*"}, Value: "1"}.Validate())
+	assert.Error(t, ConstraintItem{Attributes: map[string]string{ConstraintAttributeInstance: "("}, Value: "1"}.Validate())
+	assert.Error(t, ConstraintItem{Attributes: map[string]string{ConstraintAttributeInstance: ".*"}}.Validate())
+	constraints.SetConstraintItem("a", perInstance)
+	constraints.SetConstraintItem("b", oneInstance)
+	constraints.SetConstraintItem("c", perResource)
+	assert.Equal(t, map[string]ConstraintItem{"a": perInstance, "b": oneInstance, "c": perResource},
+		constraints.GetConstraintItems())
+
+	attributes := map[string]string{
+		ConstraintAttributeMessageType: "STATE_TRANSITION",
+		ConstraintAttributeInstance:    "i1",
+		ConstraintAttributeResource:    "r1",
+	}
+	assert.Equal(t, "INSTANCE=i1;MESSAGE_TYPE=STATE_TRANSITION;", perInstance.Scope(attributes))
+	// the item of the instance is narrower than the item of all the instances
+	assert.Equal(t, []ConstraintItem{oneInstance, perResource}, constraints.Match(attributes))
+	attributes[ConstraintAttributeInstance] = "i2"
+	assert.Equal(t, []ConstraintItem{perInstance, perResource}, constraints.Match(attributes))
+	// the patterns match the whole value
+	attributes[ConstraintAttributeInstance] = "i11"
+	attributes[ConstraintAttributeResource] = "xr1"
+	assert.Equal(t, []ConstraintItem{perInstance}, constraints.Match(attributes))
+
+	constraints.RemoveConstraintItem("a")
+	assert.Empty(t, constraints.Match(attributes))
+}
+
+func TestParticipantHistory(t *testing.T) {
+	history := NewParticipantHistory("localhost_1")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 6*int(time.Millisecond), time.UTC)
+	history.ReportOnline("s0", "localhost", start)
+	assert.Equal(t, []string{
+		"{DATE=2020-01-02T03:04:05:006, HOST=localhost, SESSION=s0, TIME=1577934245006, VERSION=" + _helixVersion + "}",
+	}, history.GetListField(FieldKeyHistory))
+	entries := history.GetSessionHistory()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "s0", entries[0].SessionID)
+	assert.True(t, start.Equal(entries[0].StartTime))
+	assert.Equal(t, "localhost", entries[0].Host)
+	assert.Equal(t, _helixVersion, entries[0].Version)
+
+	// the oldest sessions are dropped
+	for i := 1; i <= MaxParticipantHistorySize; i++ {
+		history.ReportOnline("s"+strconv.Itoa(i), "localhost", start.Add(time.Duration(i)*time.Minute))
+	}
+	entries = history.GetSessionHistory()
+	assert.Len(t, entries, MaxParticipantHistorySize)
+	assert.Equal(t, "s1", entries[0].SessionID)
+	assert.Equal(t, "s"+strconv.Itoa(MaxParticipantHistorySize), entries[len(entries)-1].SessionID)
+}
+
+func TestPauseSignal(t *testing.T) {
+	signal := NewPauseSignal("upgrade")
+	assert.True(t, signal.IsEmpty())
+	signal.FreezePartitions("r1", "r1_1", "r1_0")
+	signal.FreezePartitions("r1", "r1_0")
+	signal.FreezePartitions("r2", "r2_0")
+	assert.Equal(t, []string{"r1_0", "r1_1"}, signal.GetFrozenPartitions("r1"))
+	assert.Equal(t, []string{"r1", "r2"}, signal.GetFrozenResources())
+	assert.True(t, signal.IsFrozen("r1", "r1_0"))
+	assert.False(t, signal.IsFrozen("r1", "r1_2"))
+
+	signal.UnfreezePartitions("r2", "r2_0")
+	assert.Equal(t, []string{"r1"}, signal.GetFrozenResources())
+	signal.UnfreezePartitions("r1", "r1_0", "r1_1")
+	assert.True(t, signal.IsEmpty())
+
+	signal.SetClusterFreeze(true)
+	assert.False(t, signal.IsEmpty())
+	assert.True(t, signal.IsFrozen("r3", "r3_0"))
+	assert.Equal(t, "upgrade", signal.GetReason())
+}
+
+func TestRecordValidation(t *testing.T) {
+	idealState := NewIdealState("r")
+	assert.Equal(t, &ErrInvalidRecord{ID: "r", Field: FieldKeyStateModelDefRef, Want: "a non-empty value"},
+		idealState.Validate())
+	idealState.SetStateModelDefRef("OnlineOffline")
+	idealState.SetSimpleField(FieldKeyNumPartitions, "two")
+	assert.Equal(t, &ErrInvalidRecord{ID: "r", Field: FieldKeyNumPartitions, Got: "two", Want: "an integer"},
+		idealState.Validate())
+	idealState.SetNumPartitions(2)
+	idealState.SetSimpleField(FieldKeyReplicas, "ANY_LIVEINSTANCE")
+	idealState.SetRebalanceMode(RebalanceModeSemiAuto)
+	idealState.SetMapField("r_0", "localhost_1", "ONLINE")
+	assert.Equal(t, "listFields.r_0", idealState.Validate().(*ErrInvalidRecord).Field)
+	idealState.SetPreferenceList("r_0", []string{"localhost_1"})
+	assert.NoError(t, idealState.Validate())
+
+	view := NewExternalView("r")
+	view.SetState("r_0", "localhost_1", "")
+	assert.Equal(t, "mapFields.r_0.localhost_1", view.Validate().(*ErrInvalidRecord).Field)
+
+	msg := NewMsg("m")
+	assert.Equal(t, FieldKeyMsgType, msg.Validate().(*ErrInvalidRecord).Field)
+	msg.SetMsgType("STATE_TRANSITION")
+	msg.SetTargetName("localhost_1")
+	msg.SetResourceName("r")
+	msg.SetPartitionName("r_0")
+	msg.SetStateModelDef("OnlineOffline")
+	msg.SetFromState("OFFLINE")
+	assert.Equal(t, FieldKeyToState, msg.Validate().(*ErrInvalidRecord).Field)
+	msg.SetToState("ONLINE")
+	assert.NoError(t, msg.Validate())
+
+	config := NewInstanceConfig("localhost_1")
+	config.SetHost("localhost")
+	config.SetSimpleField(FieldKeyHelixPort, "1")
+	config.SetSimpleField(FieldKeyHelixEnabled, "yes")
+	err := config.Validate()
+	assert.Equal(t, &ErrInvalidRecord{ID: "localhost_1", Field: FieldKeyHelixEnabled, Got: "yes", Want: "a boolean"}, err)
+	assert.Equal(t, `invalid record localhost_1 at : field HELIX_ENABLED is "yes", want a boolean`, err.Error())
+	config.SetEnabled(true)
+	assert.NoError(t, config.Validate())
+}
+
+func TestRecordMutation(t *testing.T) {
+	record := NewRecord("db")
+	record.SetSimpleField("REPLICAS", "2")
+	record.SetListField("db_0", []string{"host_1"})
+	record.SetMapField("db_0", "host_1", "MASTER")
+
+	mutation := NewRecordMutation(record)
+	assert.Empty(t, mutation.Diff())
+	mutation.SetSimpleField("REPLICAS", "3").
+		AppendListField("db_0", "host_1", "host_2").
+		MergeMapField("db_0", map[string]string{"host_2": "SLAVE"}).
+		SetSimpleField("MODE", "x").
+		RemoveSimpleField("MODE")
+	assert.Equal(t, []string{"host_1", "host_2"}, record.GetListField("db_0"))
+	assert.Equal(t, "MASTER", record.GetMapField("db_0", "host_1"))
+	assert.Equal(t, RecordDiff{
+		{Type: FieldTypeSimple, Key: "REPLICAS", Old: []string{"2"}, New: []string{"3"}},
+		{Type: FieldTypeList, Key: "db_0", Old: []string{"host_1"}, New: []string{"host_1", "host_2"}},
+		{Type: FieldTypeMap, Key: "db_0", Property: "host_2", New: []string{"SLAVE"}},
+	}, mutation.Diff())
+	assert.Equal(t, "~simpleFields.REPLICAS: 2 -> 3; ~listFields.db_0: [host_1] -> [host_1,host_2]; "+
+		"+mapFields.db_0.host_2: SLAVE", mutation.Diff().String())
+
+	assert.Equal(t, "-simpleFields.REPLICAS: 3", DiffRecords(record, nil)[0].String())
+}
+
+func TestRecordCompression(t *testing.T) {
+	view := NewExternalView("db")
+	view.SetState("db_0", "host_1", "ONLINE")
+	data, err := view.Marshal()
+	assert.NoError(t, err)
+	assert.False(t, IsCompressed(data))
+
+	// the views written by Java Helix with compression enabled are gzipped JSON
+	view.SetCompressionEnabled(true)
+	compressed, err := view.Marshal()
+	assert.NoError(t, err)
+	assert.True(t, IsCompressed(compressed))
+	record, err := NewRecordFromBytes(compressed)
+	assert.NoError(t, err)
+	assert.True(t, record.IsCompressionEnabled())
+	assert.Equal(t, "ONLINE", record.GetMapField("db_0", "host_1"))
+	assert.Contains(t, view.String(), `"db_0"`)
+
+	_, err = NewRecordFromBytes(compressed[:len(compressed)/2])
+	assert.Error(t, err)
 }
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxParticipantHistorySize is the number of sessions kept in the history of a participant
+	MaxParticipantHistorySize = 20
+	// FieldKeyHistory is the list field of the session history entries
+	FieldKeyHistory = "HISTORY"
+
+	_historyKeySession = "SESSION"
+	_historyKeyTime    = "TIME"
+	_historyKeyDate    = "DATE"
+	_historyKeyHost    = "HOST"
+	_historyKeyVersion = "VERSION"
+	// _historyDateLayout is the date of the entries without the milliseconds,
+	// which Java formats as yyyy-MM-dd'T'HH:mm:ss:SSS
+	_historyDateLayout = "2006-01-02T15:04:05"
+)
+
+// SessionHistoryEntry is a session a participant connected the cluster with
+type SessionHistoryEntry struct {
+	SessionID string
+	StartTime time.Time
+	Host      string
+	Version   string
+}
+
+// ParticipantHistory is the bounded history of the sessions of a participant, it is stored
+// under /{cluster}/INSTANCES/{instance}/HISTORY. The entries are in the Java format
+// {DATE=..., HOST=..., SESSION=..., TIME=..., VERSION=...}, oldest first
+// Mirrors org.apache.helix.model.ParticipantHistory
+type ParticipantHistory struct {
+	ZNRecord
+}
+
+// NewParticipantHistory creates the empty history of the instance
+func NewParticipantHistory(instance string) *ParticipantHistory {
+	return &ParticipantHistory{*NewRecord(instance)}
+}
+
+// ReportOnline adds the session started at t on the host to the history,
+// the oldest sessions are dropped beyond MaxParticipantHistorySize
+func (h *ParticipantHistory) ReportOnline(sessionID string, host string, t time.Time) {
+	entry := map[string]string{
+		_historyKeySession: sessionID,
+		_historyKeyTime:    strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10),
+		_historyKeyDate:    fmt.Sprintf("%s:%03d", t.UTC().Format(_historyDateLayout), t.Nanosecond()/int(time.Millisecond)),
+		_historyKeyHost:    host,
+		_historyKeyVersion: _helixVersion,
+	}
+	history := append(h.GetListField(FieldKeyHistory), formatHistoryEntry(entry))
+	if len(history) > MaxParticipantHistorySize {
+		history = history[len(history)-MaxParticipantHistorySize:]
+	}
+	h.SetListField(FieldKeyHistory, history)
+}
+
+// GetSessionHistory returns the sessions of the history, oldest first
+func (h *ParticipantHistory) GetSessionHistory() []SessionHistoryEntry {
+	var entries []SessionHistoryEntry
+	for _, value := range h.GetListField(FieldKeyHistory) {
+		fields := parseHistoryEntry(value)
+		entry := SessionHistoryEntry{
+			SessionID: fields[_historyKeySession],
+			Host:      fields[_historyKeyHost],
+			Version:   fields[_historyKeyVersion],
+		}
+		if ms, err := strconv.ParseInt(fields[_historyKeyTime], 10, 64); err == nil {
+			entry.StartTime = time.Unix(0, ms*int64(time.Millisecond))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// formatHistoryEntry formats the entry like java.util.Map#toString, sorted by key
+func formatHistoryEntry(entry map[string]string) string {
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, key+"="+entry[key])
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// parseHistoryEntry parses an entry formatted like java.util.Map#toString
+func parseHistoryEntry(value string) map[string]string {
+	fields := map[string]string{}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}")
+	for _, field := range strings.Split(value, ", ") {
+		if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
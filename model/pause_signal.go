@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"sort"
+)
+
+// The fields of the pause signal
+const (
+	// PauseSignalName is the id of the pause signal record
+	PauseSignalName = "pause"
+	// FieldKeyReason is the reason the cluster or the partitions are frozen
+	FieldKeyReason = "REASON"
+	// FieldKeyClusterFreeze is set if all the partitions of the cluster are frozen
+	FieldKeyClusterFreeze = "CLUSTER_FREEZE"
+	// FieldKeyFromHost is the host which froze the cluster or the partitions
+	FieldKeyFromHost = "FROM_HOST"
+)
+
+// PauseSignal freezes the cluster or some of its partitions: the participants complete the
+// in-flight state transitions of the frozen partitions and hold their new ones until the signal
+// is removed. It is stored at /{cluster}/CONTROLLER/PAUSE, the frozen partitions are listed by
+// resource in the list fields. Mirrors org.apache.helix.model.PauseSignal
+type PauseSignal struct {
+	ZNRecord
+}
+
+// NewPauseSignal creates a pause signal freezing nothing yet
+func NewPauseSignal(reason string) *PauseSignal {
+	s := &PauseSignal{*NewRecord(PauseSignalName)}
+	s.SetSimpleField(FieldKeyReason, reason)
+	return s
+}
+
+// GetReason returns the reason of the freeze
+func (s *PauseSignal) GetReason() string {
+	return s.GetStringField(FieldKeyReason, "")
+}
+
+// SetFromHost sets the host which froze the cluster or the partitions
+func (s *PauseSignal) SetFromHost(host string) {
+	s.SetSimpleField(FieldKeyFromHost, host)
+}
+
+// GetFromHost returns the host which froze the cluster or the partitions
+func (s *PauseSignal) GetFromHost() string {
+	return s.GetStringField(FieldKeyFromHost, "")
+}
+
+// IsClusterFreeze returns whether all the partitions of the cluster are frozen
+func (s *PauseSignal) IsClusterFreeze() bool {
+	return s.GetBooleanField(FieldKeyClusterFreeze, false)
+}
+
+// SetClusterFreeze freezes or unfreezes all the partitions of the cluster
+func (s *PauseSignal) SetClusterFreeze(freeze bool) {
+	s.SetBooleanField(FieldKeyClusterFreeze, freeze)
+}
+
+// FreezePartitions adds the partitions of the resource to the frozen partitions
+func (s *PauseSignal) FreezePartitions(resource string, partitions ...string) {
+	frozen := make(map[string]struct{})
+	for _, partition := range append(s.GetFrozenPartitions(resource), partitions...) {
+		frozen[partition] = struct{}{}
+	}
+	s.setFrozenPartitions(resource, frozen)
+}
+
+// UnfreezePartitions removes the partitions of the resource from the frozen partitions
+func (s *PauseSignal) UnfreezePartitions(resource string, partitions ...string) {
+	frozen := make(map[string]struct{})
+	for _, partition := range s.GetFrozenPartitions(resource) {
+		frozen[partition] = struct{}{}
+	}
+	for _, partition := range partitions {
+		delete(frozen, partition)
+	}
+	s.setFrozenPartitions(resource, frozen)
+}
+
+func (s *PauseSignal) setFrozenPartitions(resource string, frozen map[string]struct{}) {
+	if len(frozen) == 0 {
+		s.RemoveListField(resource)
+		return
+	}
+	partitions := make([]string, 0, len(frozen))
+	for partition := range frozen {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	s.SetListField(resource, partitions)
+}
+
+// GetFrozenPartitions returns the frozen partitions of the resource, excluding the cluster freeze
+func (s *PauseSignal) GetFrozenPartitions(resource string) []string {
+	return s.GetListField(resource)
+}
+
+// GetFrozenResources returns the resources with frozen partitions, excluding the cluster freeze
+func (s *PauseSignal) GetFrozenResources() []string {
+	resources := make([]string, 0, len(s.ListFields))
+	for resource := range s.ListFields {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// IsFrozen returns whether the partition is frozen, by the cluster freeze or by itself
+func (s *PauseSignal) IsFrozen(resource string, partition string) bool {
+	if s.IsClusterFreeze() {
+		return true
+	}
+	for _, frozen := range s.GetFrozenPartitions(resource) {
+		if frozen == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty returns whether the signal freezes nothing
+func (s *PauseSignal) IsEmpty() bool {
+	return !s.IsClusterFreeze() && len(s.ListFields) == 0
+}
@@ -67,20 +67,51 @@ func NewRecord(id string) *ZNRecord {
 	}
 }
 
+// Copy returns a deep copy of the record, e.g. to modify a record shared with other readers
+func (r *ZNRecord) Copy() *ZNRecord {
+	copied := NewRecord(r.ID)
+	copied.Version = r.Version
+	for key, value := range r.SimpleFields {
+		copied.SimpleFields[key] = value
+	}
+	for key, list := range r.ListFields {
+		copied.ListFields[key] = append([]string{}, list...)
+	}
+	for key, properties := range r.MapFields {
+		copied.MapFields[key] = make(map[string]string, len(properties))
+		for property, value := range properties {
+			copied.MapFields[key][property] = value
+		}
+	}
+	return copied
+}
+
 // String returns the beautified JSON string for the ZNRecord
 func (r ZNRecord) String() string {
-	s, _ := r.Marshal()
+	s, _ := json.MarshalIndent(r, "", "    ")
 	return string(s)
 }
 
-// Marshal generates the beautified json in byte array format
+// Marshal generates the beautified json in byte array format, compressed with GZIP
+// if the compression of the record is enabled
 func (r ZNRecord) Marshal() ([]byte, error) {
-	return json.MarshalIndent(r, "", "    ")
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil || !r.IsCompressionEnabled() {
+		return data, err
+	}
+	return compress(data)
 }
 
-// NewRecordFromBytes creates a new znode instance from a byte array
+// NewRecordFromBytes creates a new znode instance from a byte array, the data compressed
+// with GZIP, e.g. by Java Helix, is decompressed first
 func NewRecordFromBytes(data []byte) (*ZNRecord, error) {
 	record := ZNRecord{Version: _defaultRecordVersion}
+	if IsCompressed(data) {
+		var err error
+		if data, err = decompress(data); err != nil {
+			return &record, err
+		}
+	}
 	err := json.Unmarshal(data, &record)
 	return &record, err
 }
@@ -195,3 +226,24 @@ func (r *ZNRecord) SetMapField(key string, property string, value string) {
 func (r *ZNRecord) RemoveMapField(key string) {
 	delete(r.MapFields, key)
 }
+
+// GetListField returns the list value of a key under ListField
+func (r ZNRecord) GetListField(key string) []string {
+	if r.ListFields == nil {
+		return nil
+	}
+	return r.ListFields[key]
+}
+
+// SetListField sets the list value of a key under ListField
+func (r *ZNRecord) SetListField(key string, value []string) {
+	if r.ListFields == nil {
+		r.ListFields = make(map[string][]string)
+	}
+	r.ListFields[key] = value
+}
+
+// RemoveListField deletes a key from ListField
+func (r *ZNRecord) RemoveListField(key string) {
+	delete(r.ListFields, key)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// FieldKeyEnableCompression is the simple field enabling the GZIP compression of a serialized
+// record, set by Java Helix on the large external views and ideal states
+// This mirrors org.apache.helix.zookeeper.datamodel.ZNRecord#ENABLE_COMPRESSION_BOOLEAN_FIELD
+const FieldKeyEnableCompression = "enableCompression"
+
+// IsCompressed returns whether the data starts with the GZIP magic bytes
+// This mirrors org.apache.helix.zookeeper.util.GZipCompressionUtil#isCompressed
+func IsCompressed(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// IsCompressionEnabled returns whether the record is compressed when serialized
+func (r ZNRecord) IsCompressionEnabled() bool {
+	return r.GetBooleanField(FieldKeyEnableCompression, false)
+}
+
+// SetCompressionEnabled sets whether the record is compressed when serialized, e.g. for an
+// external view of many partitions closing on the ZK node size limit
+func (r *ZNRecord) SetCompressionEnabled(enabled bool) {
+	r.SetBooleanField(FieldKeyEnableCompression, enabled)
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldType is the kind of field of a ZNRecord
+type FieldType string
+
+// The kinds of fields of a ZNRecord
+const (
+	FieldTypeSimple FieldType = "simpleFields"
+	FieldTypeList   FieldType = "listFields"
+	FieldTypeMap    FieldType = "mapFields"
+)
+
+// FieldChange is the change of a simple field, a list field or a property of a map field
+type FieldChange struct {
+	Type FieldType
+	Key  string
+	// Property is the changed property of a map field, empty for the other types
+	Property string
+	// Old is the value before the change, nil if the field is added. The simple fields and
+	// the properties of the map fields have a single value
+	Old []string
+	// New is the value after the change, nil if the field is removed
+	New []string
+}
+
+func (c FieldChange) String() string {
+	field := string(c.Type) + "." + c.Key
+	if c.Type == FieldTypeMap {
+		field += "." + c.Property
+	}
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+%s: %s", field, formatFieldValue(c.Type, c.New))
+	case c.New == nil:
+		return fmt.Sprintf("-%s: %s", field, formatFieldValue(c.Type, c.Old))
+	}
+	return fmt.Sprintf("~%s: %s -> %s", field, formatFieldValue(c.Type, c.Old), formatFieldValue(c.Type, c.New))
+}
+
+func formatFieldValue(fieldType FieldType, value []string) string {
+	if fieldType == FieldTypeList {
+		return "[" + strings.Join(value, ",") + "]"
+	}
+	return strings.Join(value, "")
+}
+
+// RecordDiff is the changes of the fields of a record, sorted by type, key and property
+type RecordDiff []FieldChange
+
+func (d RecordDiff) String() string {
+	changes := make([]string, 0, len(d))
+	for _, change := range d {
+		changes = append(changes, change.String())
+	}
+	return strings.Join(changes, "; ")
+}
+
+// DiffRecords returns the changes of the fields from the old to the new record, a nil record
+// has no field. The IDs and versions are not compared
+func DiffRecords(old *ZNRecord, new *ZNRecord) RecordDiff {
+	if old == nil {
+		old = &ZNRecord{}
+	}
+	if new == nil {
+		new = &ZNRecord{}
+	}
+	var diff RecordDiff
+	for _, key := range unionKeys(old.SimpleFields, new.SimpleFields) {
+		oldValue, hadOld := old.SimpleFields[key]
+		newValue, hasNew := new.SimpleFields[key]
+		if hadOld != hasNew || oldValue != newValue {
+			diff = append(diff, FieldChange{Type: FieldTypeSimple, Key: key,
+				Old: optionalValue(oldValue, hadOld), New: optionalValue(newValue, hasNew)})
+		}
+	}
+	for _, key := range unionKeys(old.ListFields, new.ListFields) {
+		oldList, hadOld := old.ListFields[key]
+		newList, hasNew := new.ListFields[key]
+		if hadOld != hasNew || !equalLists(oldList, newList) {
+			diff = append(diff, FieldChange{Type: FieldTypeList, Key: key,
+				Old: optionalList(oldList, hadOld), New: optionalList(newList, hasNew)})
+		}
+	}
+	for _, key := range unionKeys(old.MapFields, new.MapFields) {
+		oldMap, newMap := old.MapFields[key], new.MapFields[key]
+		for _, property := range unionKeys(oldMap, newMap) {
+			oldValue, hadOld := oldMap[property]
+			newValue, hasNew := newMap[property]
+			if hadOld != hasNew || oldValue != newValue {
+				diff = append(diff, FieldChange{Type: FieldTypeMap, Key: key, Property: property,
+					Old: optionalValue(oldValue, hadOld), New: optionalValue(newValue, hasNew)})
+			}
+		}
+	}
+	return diff
+}
+
+// unionKeys returns the sorted keys of the maps, which are map[string]string, map[string][]string
+// or map[string]map[string]string
+func unionKeys(maps ...interface{}) []string {
+	seen := map[string]struct{}{}
+	add := func(key string) {
+		seen[key] = struct{}{}
+	}
+	for _, m := range maps {
+		switch m := m.(type) {
+		case map[string]string:
+			for key := range m {
+				add(key)
+			}
+		case map[string][]string:
+			for key := range m {
+				add(key)
+			}
+		case map[string]map[string]string:
+			for key := range m {
+				add(key)
+			}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func optionalValue(value string, ok bool) []string {
+	if !ok {
+		return nil
+	}
+	return []string{value}
+}
+
+func optionalList(list []string, ok bool) []string {
+	if !ok {
+		return nil
+	}
+	// an empty list is a present field
+	return append([]string{}, list...)
+}
+
+func equalLists(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordMutation mutates a record and returns the diff of the mutations, e.g. for the audit
+// logs or the output of a dry run:
+//
+//	mutation := model.NewRecordMutation(&idealState.ZNRecord)
+//	mutation.SetSimpleField("REPLICAS", "3").MergeMapField("db_0", map[string]string{"host_1": "ONLINE"})
+//	log.Printf("updated ideal state: %v", mutation.Diff())
+type RecordMutation struct {
+	record   *ZNRecord
+	original *ZNRecord
+}
+
+// NewRecordMutation starts the mutations of the record, the diff is taken against its fields
+// at this point
+func NewRecordMutation(record *ZNRecord) *RecordMutation {
+	return &RecordMutation{record: record, original: record.Copy()}
+}
+
+// SetSimpleField sets the simple field
+func (m *RecordMutation) SetSimpleField(key string, value string) *RecordMutation {
+	m.record.SetSimpleField(key, value)
+	return m
+}
+
+// RemoveSimpleField removes the simple field
+func (m *RecordMutation) RemoveSimpleField(key string) *RecordMutation {
+	m.record.RemoveSimpleField(key)
+	return m
+}
+
+// AppendListField appends the values missing from the list field, the list field is created
+// if missing
+func (m *RecordMutation) AppendListField(key string, values ...string) *RecordMutation {
+	list := m.record.GetListField(key)
+	present := make(map[string]struct{}, len(list))
+	for _, value := range list {
+		present[value] = struct{}{}
+	}
+	appended := append([]string{}, list...)
+	for _, value := range values {
+		if _, ok := present[value]; !ok {
+			present[value] = struct{}{}
+			appended = append(appended, value)
+		}
+	}
+	m.record.SetListField(key, appended)
+	return m
+}
+
+// MergeMapField sets the properties of the map field, the other properties are kept
+func (m *RecordMutation) MergeMapField(key string, properties map[string]string) *RecordMutation {
+	for property, value := range properties {
+		m.record.SetMapField(key, property, value)
+	}
+	return m
+}
+
+// Diff returns the changes of the fields made by the mutations so far
+func (m *RecordMutation) Diff() RecordDiff {
+	return DiffRecords(m.original, m.record)
+}
@@ -22,6 +22,7 @@ package model
 
 import (
 	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,4 +53,42 @@ func TestGetDefaultFields(t *testing.T) {
 	mapFieldKey, mapFieldProp, mapFieldVal := "k", "p", "val"
 	r.SetMapField(mapFieldKey, mapFieldProp, mapFieldVal)
 	assert.Equal(t, mapFieldVal, r.GetMapField(mapFieldKey, mapFieldProp))
+	listFieldKey, listFieldVal := "l", []string{"a", "b"}
+	assert.Nil(t, r.GetListField(listFieldKey))
+	r.SetListField(listFieldKey, listFieldVal)
+	assert.Equal(t, listFieldVal, r.GetListField(listFieldKey))
+	r.RemoveListField(listFieldKey)
+	assert.Nil(t, r.GetListField(listFieldKey))
+}
+
+func TestZNRecordBucketizer(t *testing.T) {
+	record := NewRecord("db")
+	record.SetIntField(FieldKeyBucketSize, 2)
+	for i := 0; i < 5; i++ {
+		partition := "db_" + strconv.Itoa(i)
+		record.SetListField(partition, []string{"host"})
+		record.SetMapField(partition, "host", "ONLINE")
+	}
+	record.SetListField("notAPartition", []string{"host"})
+
+	bucketizer := NewZNRecordBucketizer(2)
+	assert.Equal(t, "db_p2-p3", bucketizer.GetBucketName("db_3"))
+	assert.Equal(t, "my_db_p0-p1", bucketizer.GetBucketName("my_db_1"))
+	assert.Equal(t, "", bucketizer.GetBucketName("db"))
+	buckets := bucketizer.Bucketize(record)
+	assert.Len(t, buckets, 3)
+	assert.Equal(t, []string{"host"}, buckets["db_p4-p5"].GetListField("db_4"))
+	assert.Equal(t, "ONLINE", buckets["db_p0-p1"].GetMapField("db_1", "host"))
+	assert.Equal(t, 2, buckets["db_p2-p3"].GetIntField(FieldKeyBucketSize, 0))
+
+	list := make([]*ZNRecord, 0, len(buckets))
+	for _, bucket := range buckets {
+		list = append(list, bucket)
+	}
+	assembled := AssembleRecords("db", list)
+	record.RemoveListField("notAPartition")
+	assert.Equal(t, record, assembled)
+	assert.Nil(t, AssembleRecords("db", nil))
+
+	assert.Equal(t, map[string]*ZNRecord{"db": record}, NewZNRecordBucketizer(0).Bucketize(record))
 }
@@ -0,0 +1,257 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ResourceConfig represents the config of a Helix resource
+type ResourceConfig struct {
+	ZNRecord
+}
+
+// NewResourceConfig creates a new resource config property
+func NewResourceConfig(resource string) *ResourceConfig {
+	return &ResourceConfig{*NewRecord(resource)}
+}
+
+// IsDelayRebalanceEnabled returns if delayed rebalancing is enabled for the resource,
+// it is enabled unless disabled explicitly
+func (c *ResourceConfig) IsDelayRebalanceEnabled() bool {
+	return c.GetBooleanField(FieldKeyDelayRebalanceEnabled, true)
+}
+
+// SetDelayRebalanceEnabled enables or disables delayed rebalancing for the resource
+func (c *ResourceConfig) SetDelayRebalanceEnabled(enabled bool) {
+	c.SetBooleanField(FieldKeyDelayRebalanceEnabled, enabled)
+}
+
+// GetRebalanceDelay returns the rebalance delay overriding the one of the cluster,
+// it returns false if the delay is not set
+func (c *ResourceConfig) GetRebalanceDelay() (time.Duration, bool) {
+	return getDurationMillisField(c.ZNRecord, FieldKeyRebalanceDelay)
+}
+
+// SetRebalanceDelay sets the rebalance delay overriding the one of the cluster
+func (c *ResourceConfig) SetRebalanceDelay(delay time.Duration) {
+	setDurationMillisField(&c.ZNRecord, FieldKeyRebalanceDelay, delay)
+}
+
+// GetMinActiveReplicas returns the number of replicas kept active during the rebalance delay,
+// it returns -1 if not set
+func (c *ResourceConfig) GetMinActiveReplicas() int {
+	return c.GetIntField(FieldKeyMinActiveReplicas, -1)
+}
+
+// SetMinActiveReplicas sets the number of replicas kept active during the rebalance delay
+func (c *ResourceConfig) SetMinActiveReplicas(replicas int) {
+	c.SetIntField(FieldKeyMinActiveReplicas, replicas)
+}
+
+// GetStateModelDefRef returns the state model of the resource
+func (c *ResourceConfig) GetStateModelDefRef() string {
+	return c.GetStringField(FieldKeyStateModelDefRef, "")
+}
+
+// SetStateModelDefRef sets the state model of the resource
+func (c *ResourceConfig) SetStateModelDefRef(stateModel string) {
+	c.SetSimpleField(FieldKeyStateModelDefRef, stateModel)
+}
+
+// GetNumPartitions returns the number of partitions of the resource, or -1 if not set
+func (c *ResourceConfig) GetNumPartitions() int {
+	return c.GetIntField(FieldKeyNumPartitions, -1)
+}
+
+// SetNumPartitions sets the number of partitions of the resource
+func (c *ResourceConfig) SetNumPartitions(partitions int) {
+	c.SetIntField(FieldKeyNumPartitions, partitions)
+}
+
+// GetReplicas returns the replicas of the resource, a number or ANY_LIVEINSTANCE
+func (c *ResourceConfig) GetReplicas() string {
+	return c.GetStringField(FieldKeyReplicas, "")
+}
+
+// SetReplicas sets the replicas of the resource, a number or ANY_LIVEINSTANCE
+func (c *ResourceConfig) SetReplicas(replicas string) {
+	c.SetSimpleField(FieldKeyReplicas, replicas)
+}
+
+// GetInstanceGroupTag returns the tag of the instances that can host the resource
+func (c *ResourceConfig) GetInstanceGroupTag() string {
+	return c.GetStringField(FieldKeyInstanceGroupTag, "")
+}
+
+// SetInstanceGroupTag constrains the resource to the instances with the tag
+func (c *ResourceConfig) SetInstanceGroupTag(tag string) {
+	c.SetSimpleField(FieldKeyInstanceGroupTag, tag)
+}
+
+// GetBatchMessageMode returns if the messages of the resource are sent in batches
+func (c *ResourceConfig) GetBatchMessageMode() bool {
+	return c.GetBooleanField(FieldKeyBatchMsgMode, false)
+}
+
+// SetBatchMessageMode sets if the messages of the resource are sent in batches
+func (c *ResourceConfig) SetBatchMessageMode(batch bool) {
+	c.SetBooleanField(FieldKeyBatchMsgMode, batch)
+}
+
+// GetMaxPartitionsPerInstance returns the max partitions of the resource placed on an instance,
+// or -1 if unlimited
+func (c *ResourceConfig) GetMaxPartitionsPerInstance() int {
+	return c.GetIntField(FieldKeyMaxPartitionsPerInstance, -1)
+}
+
+// SetMaxPartitionsPerInstance sets the max partitions of the resource placed on an instance
+func (c *ResourceConfig) SetMaxPartitionsPerInstance(max int) {
+	c.SetIntField(FieldKeyMaxPartitionsPerInstance, max)
+}
+
+// IsMonitoringDisabled returns if the monitoring of the resource is disabled
+func (c *ResourceConfig) IsMonitoringDisabled() bool {
+	return c.GetBooleanField(FieldKeyMonitoringDisabled, false)
+}
+
+// SetMonitoringDisabled disables or enables the monitoring of the resource
+func (c *ResourceConfig) SetMonitoringDisabled(disabled bool) {
+	c.SetBooleanField(FieldKeyMonitoringDisabled, disabled)
+}
+
+// IsDelayRebalanceEnabledInCluster returns if the rebalance of the resource is delayed,
+// which requires delayed rebalancing to be enabled for both the cluster and the resource
+func (c *ResourceConfig) IsDelayRebalanceEnabledInCluster(cluster *ClusterConfig) bool {
+	return c.IsDelayRebalanceEnabled() && (cluster == nil || cluster.IsDelayRebalanceEnabled())
+}
+
+// GetEffectiveRebalanceDelay returns the rebalance delay of the resource,
+// falling back to the one of the cluster. It returns 0 if delayed rebalancing is disabled
+func (c *ResourceConfig) GetEffectiveRebalanceDelay(cluster *ClusterConfig) time.Duration {
+	if !c.IsDelayRebalanceEnabledInCluster(cluster) {
+		return 0
+	}
+	if delay, ok := c.GetRebalanceDelay(); ok {
+		return delay
+	}
+	if cluster != nil {
+		if delay, ok := cluster.GetRebalanceDelayTime(); ok {
+			return delay
+		}
+	}
+	return 0
+}
+
+// GetPartitionCapacityMap returns the weights of the partitions for the WAGED rebalancer by
+// partition name and capacity key, DefaultPartitionCapacityKey holds the weights of the
+// partitions without their own. Each partition is stored as a JSON object, like the Java
+// ResourceConfig does
+func (c *ResourceConfig) GetPartitionCapacityMap() (map[string]map[string]int, error) {
+	values := c.MapFields[FieldKeyPartitionCapacityMap]
+	if values == nil {
+		return nil, nil
+	}
+	result := make(map[string]map[string]int, len(values))
+	for partition, value := range values {
+		var capacity map[string]int
+		if err := json.Unmarshal([]byte(value), &capacity); err != nil {
+			return nil, errors.Wrapf(err, "malformed %s of %s", FieldKeyPartitionCapacityMap, partition)
+		}
+		for key, weight := range capacity {
+			if weight < 0 {
+				return nil, errors.Errorf("invalid %s %s %s %d, must not be negative",
+					FieldKeyPartitionCapacityMap, partition, key, weight)
+			}
+		}
+		result[partition] = capacity
+	}
+	return result, nil
+}
+
+// SetPartitionCapacityMap sets the weights of the partitions by partition name and capacity key
+func (c *ResourceConfig) SetPartitionCapacityMap(capacities map[string]map[string]int) error {
+	values := make(map[string]string, len(capacities))
+	for partition, capacity := range capacities {
+		for key, weight := range capacity {
+			if weight < 0 {
+				return errors.Errorf("invalid %s %s %s %d, must not be negative",
+					FieldKeyPartitionCapacityMap, partition, key, weight)
+			}
+		}
+		data, err := json.Marshal(capacity)
+		if err != nil {
+			return err
+		}
+		values[partition] = string(data)
+	}
+	c.RemoveMapField(FieldKeyPartitionCapacityMap)
+	for partition, value := range values {
+		c.SetMapField(FieldKeyPartitionCapacityMap, partition, value)
+	}
+	return nil
+}
+
+// GetPartitionCapacity returns the weights of the partition by capacity key, its own weights,
+// or else the default ones of the resource, or else the default ones of the cluster
+func (c *ResourceConfig) GetPartitionCapacity(partition string, cluster *ClusterConfig) (map[string]int, error) {
+	capacities, err := c.GetPartitionCapacityMap()
+	if err != nil {
+		return nil, err
+	}
+	if capacity, ok := capacities[partition]; ok {
+		return capacity, nil
+	}
+	if capacity, ok := capacities[DefaultPartitionCapacityKey]; ok {
+		return capacity, nil
+	}
+	if cluster != nil {
+		return cluster.GetDefaultPartitionWeightMap(), nil
+	}
+	return nil, nil
+}
+
+// Validate checks the typed fields of the resource config against the replicas
+// of the resource, replicas not greater than 0 skip the check of min active replicas
+func (c *ResourceConfig) Validate(replicas int) error {
+	if value := c.GetReplicas(); value != "" && value != _anyLiveInstance {
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return errors.Errorf("invalid %s %q, must be a number or %s", FieldKeyReplicas, value, _anyLiveInstance)
+		}
+	}
+	if delay, ok := c.GetRebalanceDelay(); ok && delay < 0 {
+		return errors.Errorf("invalid %s %v, must not be negative", FieldKeyRebalanceDelay, delay)
+	}
+	minActive := c.GetMinActiveReplicas()
+	if minActive < -1 {
+		return errors.Errorf("invalid %s %d, must not be negative", FieldKeyMinActiveReplicas, minActive)
+	}
+	if replicas > 0 && minActive > replicas {
+		return errors.Errorf("invalid %s %d, must not exceed the replicas %d",
+			FieldKeyMinActiveReplicas, minActive, replicas)
+	}
+	_, err := c.GetPartitionCapacityMap()
+	return err
+}
@@ -20,6 +20,20 @@
 
 package model
 
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	_nextStateSuffix = ".next"
+	_stateMetaSuffix = ".meta"
+	_stateCountKey   = "count"
+	// _transitionTimeoutsKey is the map field of the timeouts in milliseconds by "<from>.<to>",
+	// "*" matches any state
+	_transitionTimeoutsKey = "StateTransitionTimeoutConfig"
+)
+
 // StateModelDef represents a Helix ideal state
 type StateModelDef struct {
 	ZNRecord
@@ -29,3 +43,41 @@ type StateModelDef struct {
 func (s *StateModelDef) GetInitialState() string {
 	return s.GetStringField(FieldKeyInitialState, "")
 }
+
+// GetStatesPriorityList returns the states of the state model from the highest priority
+func (s *StateModelDef) GetStatesPriorityList() []string {
+	return s.GetListField(FieldKeyStatePriorityList)
+}
+
+// GetStateCount returns the upper bound of the replicas of a partition in the state:
+// a number, "R" for the replicas of the resource, "N" for the live instances,
+// or "-1" and empty for no bound
+func (s *StateModelDef) GetStateCount(state string) string {
+	return s.GetMapField(state+_stateMetaSuffix, _stateCountKey)
+}
+
+// GetNextState returns the next state on the path from fromState to toState,
+// or an empty string if toState can't be reached from fromState
+func (s *StateModelDef) GetNextState(fromState string, toState string) string {
+	return s.GetMapField(fromState+_nextStateSuffix, toState)
+}
+
+// GetTransitionTimeout returns the timeout of the transition, 0 if the transition has no timeout
+func (s *StateModelDef) GetTransitionTimeout(fromState string, toState string) time.Duration {
+	for _, key := range []string{fromState + "." + toState, fromState + ".*", "*." + toState, "*.*"} {
+		value := s.GetMapField(_transitionTimeoutsKey, key)
+		if value == "" {
+			continue
+		}
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// SetTransitionTimeout sets the timeout of the transition, "*" matches any state
+func (s *StateModelDef) SetTransitionTimeout(fromState string, toState string, timeout time.Duration) {
+	s.SetMapField(_transitionTimeoutsKey, fromState+"."+toState,
+		strconv.FormatInt(timeout.Nanoseconds()/int64(time.Millisecond), 10))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// StateTransitionError records the failed state transitions of a partition,
+// it is stored under /{cluster}/INSTANCES/{instance}/ERRORS/{session}/{resource}/{partition}
+// and each failed transition is a map field keyed by the message ID
+type StateTransitionError struct {
+	ZNRecord
+}
+
+// NewStateTransitionError creates a new state transition error record for the partition
+func NewStateTransitionError(partition string) *StateTransitionError {
+	return &StateTransitionError{*NewRecord(partition)}
+}
+
+// AddError records the error of the transition requested by the message
+func (e *StateTransitionError) AddError(msg *Message, err error, t time.Time) {
+	tMs := t.UnixNano() / int64(time.Millisecond)
+	e.SetMapField(msg.ID, FieldKeyMsgID, msg.ID)
+	e.SetMapField(msg.ID, FieldKeyFromState, msg.GetFromState())
+	e.SetMapField(msg.ID, FieldKeyToState, msg.GetToState())
+	e.SetMapField(msg.ID, FieldKeyError, err.Error())
+	e.SetMapField(msg.ID, FieldKeyTimestamp, fmt.Sprintf("%d", tMs))
+}
+
+// GetErrors returns a map of message ID and the error of the transition
+func (e *StateTransitionError) GetErrors() map[string]string {
+	result := make(map[string]string, len(e.MapFields))
+	for msgID, val := range e.MapFields {
+		result[msgID] = val[FieldKeyError]
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Rebalance types and config types of the state transition throttles
+const (
+	ThrottleRebalanceTypeLoadBalance     = "LOAD_BALANCE"
+	ThrottleRebalanceTypeRecoveryBalance = "RECOVERY_BALANCE"
+	ThrottleRebalanceTypeAny             = "ANY"
+
+	ThrottleConfigTypeCluster   = "CLUSTER"
+	ThrottleConfigTypeResource  = "RESOURCE"
+	ThrottleConfigTypeInstance  = "INSTANCE"
+	ThrottleConfigTypePartition = "PARTITION"
+)
+
+// StateTransitionThrottleConfig limits the partitions in transition in a scope,
+// mirrors org.apache.helix.api.config.StateTransitionThrottleConfig
+type StateTransitionThrottleConfig struct {
+	RebalanceType            string
+	ConfigType               string
+	MaxPartitionInTransition int
+}
+
+// throttleConfigJSON is the format Helix keeps the throttle config in, all values are strings
+type throttleConfigJSON struct {
+	RebalanceType            string `json:"rebalanceType"`
+	ConfigType               string `json:"configType"`
+	MaxPartitionInTransition string `json:"maxPartitionInTransition"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (c StateTransitionThrottleConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(throttleConfigJSON{
+		RebalanceType:            c.RebalanceType,
+		ConfigType:               c.ConfigType,
+		MaxPartitionInTransition: strconv.Itoa(c.MaxPartitionInTransition),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *StateTransitionThrottleConfig) UnmarshalJSON(data []byte) error {
+	var raw throttleConfigJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	max, err := strconv.Atoi(raw.MaxPartitionInTransition)
+	if err != nil {
+		return errors.Wrap(err, "invalid maxPartitionInTransition")
+	}
+	*c = StateTransitionThrottleConfig{
+		RebalanceType:            raw.RebalanceType,
+		ConfigType:               raw.ConfigType,
+		MaxPartitionInTransition: max,
+	}
+	return nil
+}
+
+// Validate checks the types and the limit of the throttle config
+func (c StateTransitionThrottleConfig) Validate() error {
+	switch c.RebalanceType {
+	case ThrottleRebalanceTypeLoadBalance, ThrottleRebalanceTypeRecoveryBalance, ThrottleRebalanceTypeAny:
+	default:
+		return errors.Errorf("invalid throttle rebalance type %q", c.RebalanceType)
+	}
+	switch c.ConfigType {
+	case ThrottleConfigTypeCluster, ThrottleConfigTypeResource,
+		ThrottleConfigTypeInstance, ThrottleConfigTypePartition:
+	default:
+		return errors.Errorf("invalid throttle config type %q", c.ConfigType)
+	}
+	if c.MaxPartitionInTransition < 0 {
+		return errors.Errorf("invalid maxPartitionInTransition %d, must not be negative",
+			c.MaxPartitionInTransition)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const _msgTypeStateTransition = "STATE_TRANSITION"
+
+// ErrInvalidRecord is the error of a record missing a required field or holding a field of the
+// wrong type, e.g. after a hand edit of its znode
+type ErrInvalidRecord struct {
+	// Path is the znode of the record, set when the record is read by the data accessor
+	Path  string
+	ID    string
+	Field string
+	Got   string
+	Want  string
+}
+
+func (e *ErrInvalidRecord) Error() string {
+	return fmt.Sprintf("invalid record %s at %s: field %s is %q, want %s", e.ID, e.Path, e.Field, e.Got, e.Want)
+}
+
+// recordValidator collects the first violation of the checks of a record
+type recordValidator struct {
+	record *ZNRecord
+	err    *ErrInvalidRecord
+}
+
+func (v *recordValidator) fail(field string, got string, want string) {
+	if v.err == nil {
+		v.err = &ErrInvalidRecord{ID: v.record.ID, Field: field, Got: got, Want: want}
+	}
+}
+
+func (v *recordValidator) required(field string) {
+	if v.record.SimpleFields[field] == "" {
+		v.fail(field, "", "a non-empty value")
+	}
+}
+
+// integer checks the field is an integer if present, or one of the extra values
+func (v *recordValidator) integer(field string, extra ...string) {
+	value, ok := v.record.SimpleFields[field]
+	if !ok {
+		return
+	}
+	for _, e := range extra {
+		if value == e {
+			return
+		}
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		v.fail(field, value, "an integer")
+	}
+}
+
+func (v *recordValidator) boolean(field string) {
+	value, ok := v.record.SimpleFields[field]
+	if !ok {
+		return
+	}
+	if _, err := strconv.ParseBool(value); err != nil {
+		v.fail(field, value, "a boolean")
+	}
+}
+
+func (v *recordValidator) oneOf(field string, values ...string) {
+	value, ok := v.record.SimpleFields[field]
+	if !ok {
+		return
+	}
+	for _, allowed := range values {
+		if value == allowed {
+			return
+		}
+	}
+	v.fail(field, value, fmt.Sprintf("one of %v", values))
+}
+
+func (v *recordValidator) result() error {
+	if v.err == nil {
+		return nil
+	}
+	return v.err
+}
+
+func newRecordValidator(record *ZNRecord) *recordValidator {
+	v := &recordValidator{record: record}
+	if record.ID == "" {
+		v.fail("id", "", "a non-empty value")
+	}
+	return v
+}
+
+// Validate checks the ideal state has a state model, a number of partitions and the preference
+// lists of its partitions in SEMI_AUTO mode. Mirrors org.apache.helix.model.IdealState#isValid
+func (s *IdealState) Validate() error {
+	v := newRecordValidator(&s.ZNRecord)
+	if s.GetStateModelDefRef() == "" {
+		v.fail(FieldKeyStateModelDefRef, "", "a non-empty value")
+	}
+	v.required(FieldKeyNumPartitions)
+	v.integer(FieldKeyNumPartitions)
+	v.integer(FieldKeyReplicas, _anyLiveInstance)
+	v.integer(FieldKeyBucketSize)
+	v.oneOf(FieldKeyRebalanceMode, RebalanceModeFullAuto, RebalanceModeSemiAuto, RebalanceModeCustomized,
+		RebalanceModeUserDefined, RebalanceModeTask)
+	if s.GetRebalanceMode() == RebalanceModeSemiAuto {
+		for partition := range s.MapFields {
+			if _, ok := s.ListFields[partition]; !ok {
+				v.fail("listFields."+partition, "", "the preference list of the partition")
+			}
+		}
+	}
+	return v.result()
+}
+
+// Validate checks the fields of the external view have the expected types
+func (s *ExternalView) Validate() error {
+	v := newRecordValidator(&s.ZNRecord)
+	v.integer(FieldKeyBucketSize)
+	for partition, states := range s.MapFields {
+		for instance, state := range states {
+			if state == "" {
+				v.fail("mapFields."+partition+"."+instance, "", "a state")
+			}
+		}
+	}
+	return v.result()
+}
+
+// Validate checks the message has a type, and the target, partition, state model and states of
+// a state transition. Mirrors org.apache.helix.model.Message#isValid
+func (m *Message) Validate() error {
+	v := newRecordValidator(&m.ZNRecord)
+	v.required(FieldKeyMsgType)
+	v.integer(FieldKeyCreateTimestamp)
+	v.integer(FieldKeyTimeout)
+	if m.GetMsgType() == _msgTypeStateTransition {
+		for _, field := range []string{FieldKeyTargetName, FieldKeyPartitionName, FieldKeyResourceName,
+			FieldKeyStateModelDef, FieldKeyFromState, FieldKeyToState} {
+			v.required(field)
+		}
+	}
+	return v.result()
+}
+
+// Validate checks the instance config has a host and an integer port.
+// Mirrors org.apache.helix.model.InstanceConfig#isValid
+func (c *InstanceConfig) Validate() error {
+	v := newRecordValidator(&c.ZNRecord)
+	v.required(FieldKeyHelixHost)
+	v.required(FieldKeyHelixPort)
+	v.integer(FieldKeyHelixPort)
+	v.boolean(FieldKeyHelixEnabled)
+	v.integer(FieldKeyHelixEnabledTimestamp)
+	return v.result()
+}
@@ -21,10 +21,14 @@
 package helix
 
 import (
-	"fmt"
+	"context"
+	"net/http"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -33,6 +37,7 @@ import (
 	"github.com/uber-go/go-helix/util"
 	uzk "github.com/uber-go/go-helix/zk"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -55,15 +60,24 @@ var (
 type Participant interface {
 	Connect() error
 	Disconnect()
+	Shutdown(ctx context.Context) error
 	IsConnected() bool
 	RegisterStateModel(stateModelName string, processor *StateModelProcessor)
+	RegisterStateModelFactory(stateModelName string, factoryName string, processor *StateModelProcessor)
+	RegisterPartitionStateModelFactory(stateModelName string, factoryName string, factory PartitionStateModelFactory)
+	UpdateCustomizedState(stateType string, resource string, partition string, state string) error
+	DeleteCustomizedState(stateType string, resource string, partition string) error
 	DataAccessor() *DataAccessor
 	InstanceName() string
 	Process(e zk.Event)
+	Stats() ParticipantStats
+	Healthy() error
+	Ready() error
+	RegisterMessageHandler(msgType string, handler MessageHandler)
 }
 
 type participant struct {
-	logger zap.Logger
+	logger Logger
 	scope  tally.Scope
 
 	clusterName  string
@@ -74,15 +88,196 @@ type participant struct {
 	keyBuilder *KeyBuilder
 	zkClient   *uzk.Client
 	// Mirrors org.apache.helix.participant.HelixStateMachineEngine
-	// stateModelName->stateModelProcessor
-	stateModelProcessors     sync.Map
-	stateModelProcessorLocks map[string]*sync.Mutex
-	stateModel               StateModel
+	stateModelRegistry *stateModelRegistry
+	stateModel         StateModel
 	sync.Mutex
 	dataAccessor *DataAccessor
 
 	// fatalErrChan would notify user when a fatal error occurs
 	fatalErrChan chan error
+
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+
+	eventLog *EventLog
+
+	healthReporters      []HealthReporter
+	healthReportInterval time.Duration
+	healthReportMu       sync.Mutex
+	healthReportStopCh   chan struct{}
+	healthReportDoneCh   chan struct{}
+
+	// inflightMu guards shuttingDown and the additions to inflight
+	inflightMu   sync.Mutex
+	shuttingDown bool
+	inflight     sync.WaitGroup
+	// resetPartitionsOnShutdown moves the partitions to the initial state on Shutdown
+	resetPartitionsOnShutdown bool
+	// messageTTL is the age after which the messages without expiry period are dropped
+	messageTTL time.Duration
+	// defaultTransitionTimeout applies to the transitions without timeout in the message
+	// or the state model definition
+	defaultTransitionTimeout time.Duration
+	// currentStateBatchWindow is the window the current state updates of a resource are
+	// merged in, currentStateBatcher is nil if the updates are not batched
+	currentStateBatchWindow time.Duration
+	currentStateBatcher     *currentStateBatcher
+	// zkClientOptions are applied after the default options of the ZK client
+	zkClientOptions []uzk.ClientOption
+	// metricTags are the static tags of the metrics of the participant
+	metricTags map[string]string
+	// strictValidation validates the messages and the instance configs read
+	strictValidation bool
+	// endpoints are the protocol -> address of the endpoints advertised in the instance config
+	endpoints map[string]string
+	// sharedClient is set if the ZK client is shared with other managers, joined is set while
+	// the participant is connected over it
+	sharedClient bool
+	joined       int32
+	// debugAddr is the address of the debug server, the server is not started if empty
+	debugAddr     string
+	debugServerMu sync.Mutex
+	debugServer   *http.Server
+	// activeWatches is the number of watches the participant is waiting on
+	activeWatches int64
+	// autoJoinDomain, autoJoinTags and autoJoinNamePattern are the template and the safeguard
+	// of the instance config created when the participant auto joins the cluster
+	autoJoinDomain      string
+	autoJoinTags        []string
+	autoJoinNamePattern *regexp.Regexp
+	// messageReconcileInterval is the interval the message watch is checked at, messageWatch
+	// is the message watch of the current session
+	messageReconcileInterval time.Duration
+	messageWatchMu           sync.Mutex
+	messageWatch             *messageWatch
+	// liveInstanceGuard re-creates the live instance of the session if it is deleted
+	liveInstanceGuard *uzk.EphemeralGuard
+	// statusUpdateSampleRate is the fraction of the transitions recorded in the status updates
+	statusUpdateSampleRate float64
+	// assignments are the states of the partitions assigned to the participant as last notified
+	// to the assignmentListeners
+	assignmentListeners []PartitionAssignmentListener
+	assignmentMu        sync.Mutex
+	assignments         map[resourcePartition]string
+	// pauseSignal is the freeze of the cluster or of partitions, nil if nothing is frozen,
+	// the freezeListeners are notified of its changes one at a time under freezeNotifyMu
+	freezeMu        sync.RWMutex
+	pauseSignal     *model.PauseSignal
+	freezeListeners []FreezeListener
+	freezeNotifyMu  sync.Mutex
+	// clock measures the message TTLs and the transition timeouts
+	clock util.Clock
+	// crashReporters are notified of the panics recovered from the user callbacks
+	crashReporters []CrashReporter
+
+	// executorSlots bounds the messages handled concurrently if maxConcurrentMessages is set
+	maxConcurrentMessages int
+	executorSlots         chan struct{}
+	// statsMu guards the counts of the queued and in-flight messages
+	statsMu         sync.Mutex
+	queuedMessages  int
+	inflightByState map[string]int
+	// inflightStarts are the start times of the messages being handled by message ID
+	inflightStarts map[string]time.Time
+	// stuckThreshold is the duration of a message handling after which the participant is unhealthy
+	stuckThreshold time.Duration
+
+	// msgHandlers handle the messages of the user defined types by upper case type
+	msgHandlersMu sync.RWMutex
+	msgHandlers   map[string]MessageHandler
+
+	// instanceNameStrategy derives the instance name, instanceNameErr is returned by Connect if it failed
+	instanceNameStrategy InstanceNameStrategy
+	instanceNameErr      error
+}
+
+// ParticipantOption configures optional settings of a Participant
+type ParticipantOption func(*participant)
+
+// WithResetPartitionsOnShutdown configures Shutdown to transition the partitions
+// to the initial state of their state model before leaving the cluster
+func WithResetPartitionsOnShutdown(reset bool) ParticipantOption {
+	return func(p *participant) {
+		p.resetPartitionsOnShutdown = reset
+	}
+}
+
+// WithMessageTTL drops the messages created longer than the ttl ago instead of handling them,
+// e.g. the transitions sent before a long outage. The expiry period of a message overrides the ttl,
+// messages without expiry period never expire by default
+func WithMessageTTL(ttl time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.messageTTL = ttl
+	}
+}
+
+// WithDefaultTransitionTimeout fails the transitions not done within the timeout, unless the
+// message or the state model definition sets the timeout of the transition. The context of the
+// handler is cancelled on timeout and the partition is moved to ERROR state
+func WithDefaultTransitionTimeout(timeout time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.defaultTransitionTimeout = timeout
+	}
+}
+
+// WithCurrentStateBatchWindow merges the current state updates of a resource made within the window
+// into a single write of the current state znode, reducing the writes when many partitions of a
+// resource transition at the same time. The transitions are delayed by up to the window
+func WithCurrentStateBatchWindow(window time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.currentStateBatchWindow = window
+	}
+}
+
+// WithParticipantLogger sets the logger of the participant and of its ZK client instead of the
+// zap logger passed to NewParticipant
+func WithParticipantLogger(logger Logger) ParticipantOption {
+	return func(p *participant) {
+		p.logger = logger
+	}
+}
+
+// WithParticipantClock sets the clock measuring the message TTLs, the transition timeouts, the
+// message polls and the backoffs of the participant and of its ZK client, e.g. a util.FakeClock in
+// tests. util.RealClock by default
+func WithParticipantClock(clock util.Clock) ParticipantOption {
+	return func(p *participant) {
+		p.clock = clock
+	}
+}
+
+// WithParticipantZkClient connects the participant over a ZK client shared with other managers of
+// the process, e.g. a RoutingTableProvider and an Admin, instead of its own session. The client
+// is acquired on Connect and released on Disconnect, the ZK client options are not applied to it
+func WithParticipantZkClient(client *uzk.Client) ParticipantOption {
+	return func(p *participant) {
+		p.zkClient = client
+		p.sharedClient = true
+	}
+}
+
+// WithParticipantZkClientOptions configures the ZK client of the participant,
+// e.g. with uzk.WithAuditSink to audit the changes made by the participant
+func WithParticipantZkClientOptions(options ...uzk.ClientOption) ParticipantOption {
+	return func(p *participant) {
+		p.zkClientOptions = append(p.zkClientOptions, options...)
+	}
+}
+
+// WithParticipantMetricTags adds static tags to all the metrics of the participant, including the
+// ones of its ZK client unless it is shared, e.g. the zone or the deployment of the instance
+func WithParticipantMetricTags(tags map[string]string) ParticipantOption {
+	return func(p *participant) {
+		p.metricTags = mergeMetricTags(p.metricTags, tags)
+	}
+}
+
+// WithParticipantStrictValidation validates the messages and the instance configs read by the
+// participant, the invalid messages are skipped instead of failing their handling
+func WithParticipantStrictValidation() ParticipantOption {
+	return func(p *participant) {
+		p.strictValidation = true
+	}
 }
 
 // NewParticipant instantiates a Participant,
@@ -97,49 +292,93 @@ func NewParticipant(
 	resourceName string,
 	host string,
 	port int32,
+	options ...ParticipantOption,
 ) (Participant, <-chan error) {
-	zkClient := uzk.NewClient(logger, scope, uzk.WithZkSvr(zkConnectString),
-		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout))
 	keyBuilder := &KeyBuilder{clusterName}
-	instanceName := getInstanceName(host, port)
 	fatalErrChan := make(chan error)
-	return &participant{
-		logger: *logger.With(
-			zap.String("application", application),
-			zap.String("cluster", clusterName),
-			zap.String("resource", resourceName),
-			zap.String("instance", instanceName),
-		),
-		scope: scope.SubScope("helix.participant").Tagged(map[string]string{
-			"application": application,
-			"cluster":     clusterName,
-			"resource":    resourceName,
-			"instance":    instanceName,
-		}),
-		clusterName:              clusterName,
-		instanceName:             instanceName,
-		host:                     host,
-		port:                     port,
-		keyBuilder:               keyBuilder,
-		zkClient:                 zkClient,
-		stateModelProcessorLocks: make(map[string]*sync.Mutex),
-		dataAccessor:             newDataAccessor(zkClient, keyBuilder),
-		stateModel:               NewStateModel(),
-		fatalErrChan:             fatalErrChan,
-	}, fatalErrChan
+	p := &participant{
+		clusterName:          clusterName,
+		host:                 host,
+		port:                 port,
+		keyBuilder:           keyBuilder,
+		stateModelRegistry:   newStateModelRegistry(),
+		stateModel:           NewStateModel(),
+		fatalErrChan:         fatalErrChan,
+		healthReportInterval: _defaultHealthReportInterval,
+		clock:                util.RealClock,
+		inflightByState:      map[string]int{},
+		inflightStarts:       map[string]time.Time{},
+		stuckThreshold:       DefaultStuckTransitionThreshold,
+		instanceNameStrategy: HostPortInstanceName,
+		msgHandlers:          map[string]MessageHandler{},
+
+		messageReconcileInterval: _defaultMessageReconcileInterval,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	p.instanceName, p.instanceNameErr = p.instanceNameStrategy(host, port)
+	if p.logger == nil {
+		p.logger = util.LoggerFromZap(logger)
+	}
+	baseLogger := p.logger
+	p.logger = util.WithLogLevel(p.logger, LogComponentParticipant).With(
+		util.Field("application", application),
+		util.Field("cluster", clusterName),
+		util.Field("resource", resourceName),
+		util.Field("instance", p.instanceName),
+	)
+	scope = managerScope(scope, ManagerRoleParticipant, clusterName, p.instanceName, p.metricTags)
+	p.scope = scope.SubScope("helix.participant").Tagged(map[string]string{
+		"application": application,
+		"resource":    resourceName,
+	})
+	p.tracer = newTracer(p.tracerProvider)
+	if !p.sharedClient {
+		p.zkClient = uzk.NewClient(logger, scope, append([]uzk.ClientOption{uzk.WithLogger(baseLogger),
+			uzk.WithZkSvr(zkConnectString),
+			uzk.WithSessionTimeout(uzk.DefaultSessionTimeout), uzk.WithTracerProvider(p.tracerProvider),
+			uzk.WithClock(p.clock)},
+			p.zkClientOptions...)...)
+	}
+	p.dataAccessor = newDataAccessor(p.zkClient, keyBuilder)
+	p.dataAccessor.strict = p.strictValidation
+	if p.currentStateBatchWindow > 0 {
+		p.currentStateBatcher = newCurrentStateBatcher(p.scope, p.dataAccessor, p.currentStateBatchWindow)
+	}
+	if p.maxConcurrentMessages > 0 {
+		p.executorSlots = make(chan struct{}, p.maxConcurrentMessages)
+	}
+	return p, fatalErrChan
 }
 
 // Connect let the participant connect to Zookeeper
 func (p *participant) Connect() error {
+	if p.instanceNameErr != nil {
+		return errors.Wrap(p.instanceNameErr, "helix participant")
+	}
+	if !p.IsConnected() {
+		// a participant shut down accepts the messages again once it joins the cluster again
+		p.inflightMu.Lock()
+		p.shuttingDown = false
+		p.inflightMu.Unlock()
+	}
+	if p.sharedClient {
+		return p.connectShared()
+	}
 	if p.zkClient.IsConnected() {
 		return nil
 	}
 
+	p.liveInstanceGuard = p.newLiveInstanceGuard()
 	err := p.createClient()
 	if err != nil {
 		return errors.Wrap(err, "helix participant")
 	}
 	p.zkClient.AddWatcher(p)
+	if err := p.startDebugServer(); err != nil {
+		return errors.Wrap(err, "helix participant")
+	}
 	return nil
 }
 
@@ -149,18 +388,144 @@ func (p *participant) Disconnect() {
 		p.logger.Warn("helix instance already isDisconnected")
 		return
 	}
-	p.zkClient.Disconnect()
+	if len(p.healthReporters) > 0 {
+		p.stopHealthReports()
+		p.removeHealthReports()
+	}
+	p.stopDebugServer()
+	p.stopMessageWatch()
+	if p.sharedClient {
+		p.disconnectShared()
+	} else {
+		p.liveInstanceGuard.Stop()
+		p.zkClient.Disconnect()
+	}
+	p.removeAssignments()
+}
+
+// Shutdown gracefully leaves the cluster. It stops accepting new messages, waits for
+// the in-flight transitions until ctx is done, moves the partitions to the initial state
+// if configured by WithResetPartitionsOnShutdown, removes the live instance and disconnects.
+// The participant accepts the messages again once connected again
+func (p *participant) Shutdown(ctx context.Context) error {
+	if !p.IsConnected() {
+		p.logger.Warn("helix instance already isDisconnected")
+		return nil
+	}
+	p.inflightMu.Lock()
+	p.shuttingDown = true
+	p.inflightMu.Unlock()
+
+	err := p.waitInflightTransitions(ctx)
+	if err == nil && p.resetPartitionsOnShutdown {
+		err = p.resetPartitions(ctx)
+	}
+
+	if releaseErr := p.liveInstanceGuard.Release(); releaseErr != nil {
+		p.logger.Error("failed to remove live instance on shutdown", util.ErrorField(releaseErr))
+	}
+	p.Disconnect()
+	return err
+}
+
+func (p *participant) waitInflightTransitions(ctx context.Context) error {
+	doneCh := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "helix participant: in-flight transitions not drained")
+	}
+}
+
+// resetPartitions transitions the partitions of the current session to the initial state,
+// following the next states of the state model definition
+func (p *participant) resetPartitions(ctx context.Context) error {
+	sessionID := p.zkClient.GetSessionID()
+	for _, resource := range p.getCurrentResourceNames() {
+		currentState, err := p.dataAccessor.CurrentState(p.instanceName, sessionID, resource)
+		if err != nil {
+			return err
+		}
+		stateModelDef, err := p.dataAccessor.StateModelDef(currentState.GetStateModelDef())
+		if err != nil {
+			return err
+		}
+		initialState := stateModelDef.GetInitialState()
+		for partition, state := range currentState.GetPartitionStateMap() {
+			for state != initialState {
+				if err := ctx.Err(); err != nil {
+					return errors.Wrap(err, "helix participant: partitions not reset")
+				}
+				nextState := stateModelDef.GetNextState(state, initialState)
+				if nextState == "" {
+					p.logger.Warn("no transition to the initial state on shutdown",
+						util.Field("resource", resource), util.Field("partition", partition),
+						util.Field("state", state))
+					break
+				}
+				msg := p.newShutdownTransitionMsg(currentState, resource, partition, state, nextState)
+				if err := p.handleMsg(msg); err != nil {
+					p.logger.Error("failed to reset partition on shutdown",
+						util.Field("resource", resource), util.Field("partition", partition), util.ErrorField(err))
+					break
+				}
+				state = nextState
+			}
+		}
+	}
+	return nil
+}
+
+func (p *participant) newShutdownTransitionMsg(currentState *model.CurrentState,
+	resource string, partition string, fromState string, toState string) *model.Message {
+	msg := model.NewMsg(util.NewUUID())
+	msg.SetMsgType(MsgTypeStateTransition)
+	msg.SetSrcName(p.instanceName)
+	msg.SetTargetName(p.instanceName)
+	msg.SetTargetSessionID(p.zkClient.GetSessionID())
+	msg.SetResourceName(resource)
+	msg.SetPartitionName(partition)
+	msg.SetStateModelDef(currentState.GetStateModelDef())
+	msg.SetStateModelFactoryName(currentState.GetStateModelFactoryName())
+	msg.SetFromState(fromState)
+	msg.SetToState(toState)
+	msg.SetCreateTime(time.Now())
+	msg.SetMsgState(model.MessageStateRead)
+	return msg
 }
 
 // IsConnected checks if the participant is connected to Zookeeper
 func (p *participant) IsConnected() bool {
+	if p.sharedClient && atomic.LoadInt32(&p.joined) == 0 {
+		return false
+	}
 	return p.zkClient.IsConnected()
 }
 
 // RegisterStateModel associates state trasition functions with the participant
 func (p *participant) RegisterStateModel(stateModelName string, processor *StateModelProcessor) {
-	p.stateModelProcessors.Store(stateModelName, processor)
-	p.stateModelProcessorLocks[stateModelName] = &sync.Mutex{}
+	p.RegisterStateModelFactory(stateModelName, StateModelFactoryNameDefault, processor)
+}
+
+// RegisterStateModelFactory associates state transition functions with the participant for the
+// resources of the state model using the factory name, i.e. STATE_MODEL_FACTORY_NAME of the ideal
+// state. Resources with a factory name not registered use the processor of the default factory
+func (p *participant) RegisterStateModelFactory(
+	stateModelName string, factoryName string, processor *StateModelProcessor) {
+	p.stateModelRegistry.register(stateModelName, factoryName, processor)
+}
+
+// RegisterPartitionStateModelFactory registers a factory creating a state model object for each
+// partition of the resources of the state model using the factory name. The state model of a
+// partition is created on its first transition and dropped once the partition is dropped
+func (p *participant) RegisterPartitionStateModelFactory(
+	stateModelName string, factoryName string, factory PartitionStateModelFactory) {
+	p.stateModelRegistry.registerFactory(stateModelName, factoryName, factory)
 }
 
 // DataAccessor returns the underlying accessor to help change Zookeeper data
@@ -196,27 +561,45 @@ func (p *participant) isClusterSetup() (bool, error) {
 
 func (p *participant) createLiveInstance() error {
 	p.logger.Info("start to create live instance")
-	path := p.keyBuilder.liveInstance(p.instanceName)
-	node := model.NewLiveInstance(p.instanceName, p.zkClient.GetSessionID())
-	data, err := node.Marshal()
-	if err != nil {
+	err := p.liveInstanceGuard.Start()
+	if errors.Cause(err) != zk.ErrNodeExists {
 		return err
 	}
-
-	err = p.zkClient.Create(path, data, uzk.FlagsEphemeral, uzk.ACLPermAll)
-	if err == nil {
-		return nil
+	// another session owns the live instance, only a previous session of the same host is waited for
+	if err := p.checkLiveInstanceOwner(); err != nil {
+		return err
 	}
-	// TODO(yulun): re-visit if the infinite loop if ErrNodeExists
-	// in Java is necessary
-	if err == zk.ErrNodeExists {
-		// wait for previous session to time out
-		time.Sleep(uzk.DefaultSessionTimeout + _createLiveInstanceBackoff)
-		err = p.zkClient.Create(path, data, uzk.FlagsEphemeral, uzk.ACLPermAll)
+	// wait for previous session to time out
+	p.clock.Sleep(uzk.DefaultSessionTimeout + _createLiveInstanceBackoff)
+	err = p.liveInstanceGuard.Start()
+	if errors.Cause(err) == zk.ErrNodeExists {
+		return p.instanceNameCollision()
 	}
 	return err
 }
 
+// newLiveInstanceGuard creates the guard re-creating the live instance of the session
+// when it is deleted by another client, e.g. by an operator or a misbehaving tool
+func (p *participant) newLiveInstanceGuard() *uzk.EphemeralGuard {
+	data := func() ([]byte, error) {
+		return model.NewLiveInstance(p.instanceName, p.zkClient.GetSessionID()).Marshal()
+	}
+	return uzk.NewEphemeralGuard(p.zkClient, p.keyBuilder.liveInstance(p.instanceName), data,
+		uzk.WithEphemeralListener(func(e uzk.EphemeralEvent) {
+			if e.Type == uzk.EphemeralEventLost && e.Err == zk.ErrNoNode {
+				p.scope.Counter("live-instance-deleted").Inc(1)
+				p.logger.Warn("live instance deleted by another client, re-creating it",
+					util.Field("sessionID", e.SessionID))
+			}
+			if e.Type == uzk.EphemeralEventConflict {
+				p.scope.Counter("instance-name-collisions").Inc(1)
+				p.logger.Error("live instance owned by another session, the instance name is used twice",
+					util.Field("sessionID", e.SessionID), util.Field("owner", e.Owner))
+			}
+		}),
+	)
+}
+
 func (p *participant) createClient() error {
 	// TODO: refactor out the retry count
 	for retryCount := 0; retryCount < 3; {
@@ -228,11 +611,11 @@ func (p *participant) createClient() error {
 			}
 		}
 		retryCount++
-		if retryCount == 3 {
+		if retryCount == 3 || errors.Cause(err) == ErrInstanceNameCollision {
 			p.Disconnect()
 			return err
 		}
-		p.logger.Warn("failed to connect to zookeeper, will retry", zap.Error(err))
+		p.logger.Warn("failed to connect to zookeeper, will retry", util.ErrorField(err))
 	}
 	return nil
 }
@@ -241,16 +624,30 @@ func (p *participant) createClient() error {
 func (p *participant) Process(e zk.Event) {
 	switch e.State {
 	case zk.StateHasSession:
-		p.logger.Info("zookeeper session created", zap.String("sessionID", p.zkClient.GetSessionID()))
+		p.logger.Info("zookeeper session created", util.Field("sessionID", p.zkClient.GetSessionID()))
+		// spread the re-creation of the live instance and the watches of the participants
+		// reconnecting at once, configured by uzk.WithReconnectJitter
+		if delay := p.zkClient.ReconnectDelay(); delay > 0 {
+			p.clock.Sleep(delay)
+			if !p.zkClient.IsConnected() {
+				p.logger.Info("session lost during the reconnect jitter, waiting for the next session")
+				return
+			}
+		}
 		if err := p.handleNewSession(); err != nil {
-			p.logger.Error("handle new session failed", zap.Error(err))
+			p.logger.Error("handle new session failed", util.ErrorField(err))
 			// handleNewSession() error is fatal, inform user to clean up and restart
 			p.sendFatalError(err)
 		} else {
 			p.logger.Info("handle new session succeed")
 		}
 	case zk.StateExpired:
-		p.logger.Warn("zookeeper session expired", zap.String("sessionID", p.zkClient.GetSessionID()))
+		p.logger.Warn("zookeeper session expired", util.Field("sessionID", p.zkClient.GetSessionID()))
+		p.recordEvent(Event{Type: EventTypeSessionExpired})
+		// the live instance is created again by handleNewSession of the next session
+		p.liveInstanceGuard.Stop()
+		p.stateModelRegistry.resetPartitions()
+		p.removeAssignments()
 	}
 }
 
@@ -270,15 +667,24 @@ func (p *participant) handleNewSession() error {
 	if err != nil {
 		return err
 	}
+	if err := p.advertiseEndpoints(); err != nil {
+		return err
+	}
 	err = p.createLiveInstance()
 	if err != nil {
 		return err
 	}
+	p.recordSessionHistory()
 	err = p.carryOverPreviousCurrentState()
 	if err != nil {
 		return err
 	}
+	// the freeze is read before the messages so the transitions of the frozen partitions are held
+	p.watchPauseSignal()
 	p.setupMsgHandler()
+	p.watchClusterEvents()
+	p.startHealthReports()
+	p.recordEvent(Event{Type: EventTypeSessionEstablished})
 	return nil
 }
 
@@ -309,10 +715,10 @@ func (p *participant) joinCluster() error {
 		return errors.Errorf("cluster %v does not allow auto join", p.clusterName)
 	}
 
-	instanceConfig := model.NewInstanceConfig(p.instanceName)
-	instanceConfig.SetHost(p.host)
-	instanceConfig.SetPort(int(p.port))
-	instanceConfig.SetEnabled(true)
+	instanceConfig, err := p.newAutoJoinInstanceConfig(&model.ClusterConfig{ZNRecord: *c})
+	if err != nil {
+		return err
+	}
 
 	err = p.dataAccessor.createInstanceConfig(participantConfigKey, instanceConfig)
 	if err != nil {
@@ -359,11 +765,15 @@ func (p *participant) joinCluster() error {
 }
 
 func (p *participant) setupMsgHandler() {
-	msgCh, errCh, stopCh := p.watchMessages()
+	watch := p.startMessageWatch()
+	msgCh, errCh, stopCh := p.watchMessages(watch)
 	go p.handleMessages(msgCh, errCh, stopCh)
+	if p.messageReconcileInterval > 0 {
+		go p.reconcileMessages(watch, stopCh)
+	}
 }
 
-func (p *participant) watchMessages() (chan []string, chan error, chan struct{}) {
+func (p *participant) watchMessages(watch *messageWatch) (chan []string, chan error, chan struct{}) {
 	msgCh := make(chan []string)
 	errCh := make(chan error)
 	stopCh := make(chan struct{})
@@ -371,33 +781,42 @@ func (p *participant) watchMessages() (chan []string, chan error, chan struct{})
 
 	go func() {
 		for {
+			select {
+			case <-watch.quitCh:
+				close(stopCh)
+				return
+			default:
+			}
 			msgIDs, eventCh, err := p.zkClient.ChildrenW(path)
 			if err != nil {
 				errCh <- err
 				continue
 			}
+			watch.setDelivered(msgIDs)
 			msgCh <- msgIDs
-			select {
-			case ev, ok := <-eventCh:
-				// eventCh closed after watcher is triggered, recreate the watcher
-				if !ok {
-					continue
-				}
-				if ev.Err != nil {
-					// ev.Err is non-nil when session expires or zkClient is closed.
-					// In either case goroutines spawned in setupMsgHandler should be stopped.
-					// Otherwise the goroutines would leak, when a new session is created after expiration
-					p.logger.Error("watchMessages has watcher error, stopping message watcher", zap.Error(ev.Err))
-					close(stopCh)
-					return
-				}
-				switch ev.Type {
-				case zk.EventNodeChildrenChanged:
-					p.logger.Info("changes in messages detected. rewatch", zap.Any("event", ev))
-					continue
-				}
-				p.logger.Warn("unexpected messages watcher event", zap.Any("event", ev))
+			ev, ok, quit := p.awaitMessageWatch(eventCh, watch)
+			if quit {
+				close(stopCh)
+				return
+			}
+			// eventCh closed after watcher is triggered, or the watch is re-armed, recreate the watcher
+			if !ok {
+				continue
+			}
+			if ev.Err != nil {
+				// ev.Err is non-nil when session expires or zkClient is closed.
+				// In either case goroutines spawned in setupMsgHandler should be stopped.
+				// Otherwise the goroutines would leak, when a new session is created after expiration
+				p.logger.Error("watchMessages has watcher error, stopping message watcher", util.ErrorField(ev.Err))
+				close(stopCh)
+				return
+			}
+			switch ev.Type {
+			case zk.EventNodeChildrenChanged:
+				p.logger.Info("changes in messages detected. rewatch", util.Field("event", ev))
+				continue
 			}
+			p.logger.Warn("unexpected messages watcher event", util.Field("event", ev))
 		}
 	}()
 	return msgCh, errCh, stopCh
@@ -408,10 +827,10 @@ func (p *participant) handleMessages(
 	for {
 		select {
 		case msgIDs := <-msgCh:
-			p.logger.Info("messages watchers received notification", zap.Any("msgIDs", msgIDs))
+			p.logger.Info("messages watchers received notification", util.Field("msgIDs", msgIDs))
 			messages, err := p.getMessages(msgIDs)
 			if err != nil {
-				p.logger.Error("participant failed to fetch messages", zap.Error(err))
+				p.logger.Error("participant failed to fetch messages", util.ErrorField(err))
 				break
 			}
 			p.processMessages(messages)
@@ -419,7 +838,7 @@ func (p *participant) handleMessages(
 			if !ok {
 				break
 			}
-			p.logger.Error("participant message processor has an error after retries", zap.Error(err))
+			p.logger.Error("participant message processor has an error after retries", util.ErrorField(err))
 			p.sendFatalError(err)
 			// TODO(yulun): allow services to pass in callback func to handle conn failures
 		case <-stopCh:
@@ -430,35 +849,53 @@ func (p *participant) handleMessages(
 }
 
 func (p *participant) handleMsg(msg *model.Message) error {
+	if handler, ok := p.messageHandler(msg.GetMsgType()); ok {
+		return p.handleUserMsg(msg, handler)
+	}
 	// locking mirrors org.apache.helix.messaging.handling.HelixStateTransitionHandler#handleMessage
 	// in Java synchronized on _stateModel
-	mu, ok := p.stateModelProcessorLocks[msg.GetStateModelDef()]
+	registered, ok := p.stateModelRegistry.lookup(msg.GetStateModelDef(), msg.GetStateModelFactoryName())
 	if !ok {
-		p.logger.Error("failed to find state model in stateModelProcessorLocks",
-			zap.String("StateModelDefinition", msg.GetStateModelDef()),
-			zap.Any("stateModelProcessorLocks", p.stateModelProcessorLocks))
+		p.logger.Error("failed to find registered state model",
+			util.Field("StateModelDefinition", msg.GetStateModelDef()),
+			util.Field("StateModelFactoryName", msg.GetStateModelFactoryName()),
+			util.Field("registeredStateModels", p.stateModelRegistry.stateModels()))
 		return errMsgMissingStateModelDef
 	}
-	mu.Lock()
-	defer mu.Unlock()
+	registered.Lock()
+	defer registered.Unlock()
 
-	handleMsgErr := p.preHandleMsg(msg)
+	ctx, span := p.startMsgSpan(context.Background(), "helix.handle_message", msg)
+	stateModelDef, handleMsgErr := p.preHandleMsg(ctx, msg)
 	if handleMsgErr == nil {
-		handleMsgErr = p.handleStateTransition(msg)
+		handleMsgErr = p.handleStateTransition(ctx, msg, registered, p.transitionTimeout(msg, stateModelDef))
+		p.recordMsgEvent(EventTypeTransitionExecuted, msg, handleMsgErr)
 	}
+	// the span also covers the post handling which updates the current state
+	defer endSpan(span, handleMsgErr)
 	// TODO: should the message be deleted from ZK after successful processing?
 	// https://github.com/yichen/gohelix/blob/master/participant.go#L364
-	p.postHandleMsg(msg, handleMsgErr)
+	p.postHandleMsg(ctx, msg, handleMsgErr)
+	if handleMsgErr == nil && strings.ToUpper(msg.GetToState()) == StateModelStateDropped {
+		partitionName, _ := msg.GetPartitionName()
+		registered.dropPartition(msg.GetResourceName(), partitionName)
+	}
+	p.notifyAssignment(msg, stateModelDef)
 
 	// similar to HelixTask#call(), delete message even if handling was not successful
 	if msg.GetParentMsgID() == "" {
 		msgPath := p.keyBuilder.participantMsg(p.instanceName, msg.ID)
-		p.logger.Info("deleting message at path", zap.String("msgPath", msgPath))
-		err := p.zkClient.DeleteTree(msgPath)
+		p.logger.Info("deleting message at path", util.Field("msgPath", msgPath))
+		err := p.zkClient.DeleteTreeContext(ctx, msgPath)
 		if err != nil {
-			p.logger.Error("failed to delete msg after handling", zap.Error(err))
+			p.logger.Error("failed to delete msg after handling", util.ErrorField(err))
+		}
+		// mirrors HelixTask#call() which replies to the messages with correlation ID,
+		// the timeouts are also reported to the sender
+		timedOut := errors.Cause(handleMsgErr) == ErrTransitionTimeout
+		if (msg.GetCorrelationID() != "" || timedOut) && msg.GetSrcName() != p.instanceName {
+			p.sendReply(ctx, msg, nil, handleMsgErr)
 		}
-		// TODO(yulun): send reply msg to controller
 	}
 
 	// return error although the caller might not respond, helpful at least for unit tests
@@ -466,13 +903,13 @@ func (p *participant) handleMsg(msg *model.Message) error {
 	return handleMsgErr
 }
 
-func (p *participant) preHandleMsg(msg *model.Message) error {
+func (p *participant) preHandleMsg(ctx context.Context, msg *model.Message) (*model.StateModelDef, error) {
 	//TODO: verify msg is valid
 	fromState := msg.GetFromState()
 	partitionName, _ := msg.GetPartitionName()
-	stateModelDef, err := p.dataAccessor.StateModelDef(msg.GetStateModelDef())
+	stateModelDef, err := p.dataAccessor.withContext(ctx).StateModelDef(msg.GetStateModelDef())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// if there is no local state for the resource/partition, set it to init state
 	localState, exist := p.stateModel.GetState(msg.GetResourceName(), partitionName)
@@ -484,25 +921,64 @@ func (p *participant) preHandleMsg(msg *model.Message) error {
 	if fromState != "" && fromState != "*" &&
 		strings.ToLower(fromState) != strings.ToLower(localState) {
 		p.logger.Warn("get unexpected fromState when handling transition",
-			zap.String("expected", localState),
-			zap.String("actual", fromState),
-			zap.String("partition", partitionName),
+			util.Field("expected", localState),
+			util.Field("actual", fromState),
+			util.Field("partition", partitionName),
 		)
-		return errMismatchState
+		return stateModelDef, errMismatchState
+	}
+	return stateModelDef, nil
+}
+
+// transitionTimeout returns the timeout of the transition of the message, the timeout in the
+// message takes precedence over the one in the state model definition and the default timeout
+func (p *participant) transitionTimeout(msg *model.Message, stateModelDef *model.StateModelDef) time.Duration {
+	if timeout := msg.GetExecutionTimeout(); timeout > 0 {
+		return timeout
+	}
+	if timeout := stateModelDef.GetTransitionTimeout(msg.GetFromState(), msg.GetToState()); timeout > 0 {
+		return timeout
+	}
+	return p.defaultTransitionTimeout
+}
+
+// sendReply sends the result of handling the message to its sender, the result of a message handler
+// is completed with the SUCCESS, INTERRUPTED and ERRORINFO fields read by the Java senders
+func (p *participant) sendReply(
+	ctx context.Context, msg *model.Message, handlerResult map[string]string, handleMsgErr error) {
+	result := make(map[string]string, len(handlerResult)+3)
+	for key, value := range handlerResult {
+		result[key] = value
+	}
+	timedOut := errors.Cause(handleMsgErr) == ErrTransitionTimeout
+	result["SUCCESS"] = strconv.FormatBool(handleMsgErr == nil)
+	result["INTERRUPTED"] = strconv.FormatBool(timedOut)
+	if handleMsgErr != nil {
+		result["ERRORINFO"] = handleMsgErr.Error()
+	}
+	if timedOut {
+		result["TIMEOUT"] = "true"
+	}
+	reply := model.NewReplyMsg(msg, util.NewUUID(), p.instanceName, result)
+	reply.SetSrcInstanceType("PARTICIPANT")
+	path := p.keyBuilder.controllerMsg(reply.ID)
+	if msg.GetSrcInstanceType() == "PARTICIPANT" {
+		path = p.keyBuilder.participantMsg(msg.GetSrcName(), reply.ID)
+	}
+	if err := p.dataAccessor.withContext(ctx).createMsg(path, reply); err != nil {
+		p.logger.Error("failed to send reply message", util.Field("path", path), util.ErrorField(err))
 	}
-	return nil
 }
 
-func (p *participant) postHandleMsg(msg *model.Message, handleMsgErr error) {
+func (p *participant) postHandleMsg(ctx context.Context, msg *model.Message, handleMsgErr error) {
 	// sessionID might change when we update the state model
 	// skip if we are handling an expired session
 	sessionID := p.zkClient.GetSessionID()
 
 	if msg.GetTargetSessionID() != sessionID {
-		p.logger.Info("session has changed, skip postHandleMsg",
-			zap.String("targetSessionID", msg.GetTargetSessionID()),
-			zap.String("sessionID", sessionID),
-			zap.Any("helixMsg", msg))
+		p.msgLogger(msg).Info("session has changed, skip postHandleMsg",
+			util.Field("targetSessionID", msg.GetTargetSessionID()),
+			util.Field("sessionID", sessionID))
 		return
 	}
 
@@ -513,11 +989,9 @@ func (p *participant) postHandleMsg(msg *model.Message, handleMsgErr error) {
 		// from the current state of the instance because the partition is dropped.
 		// In the state model it will stay as OFFLINE, which is OK.
 		if strings.ToUpper(msg.GetToState()) == StateModelStateDropped {
-			currentStateForResourcePath := p.keyBuilder.currentStateForResource(
-				p.instanceName, sessionID, msg.GetResourceName())
-			err := p.zkClient.RemoveMapFieldKey(currentStateForResourcePath, partitionName)
+			err := p.removePartitionCurrentState(ctx, sessionID, msg.GetResourceName(), partitionName)
 			if err != nil {
-				p.logger.Error("error removing dropped partition", zap.Error(err))
+				p.logger.Error("error removing dropped partition", util.ErrorField(err))
 			} else {
 				// update local state only after zk is successfully updated
 				p.stateModel.RemoveState(msg.GetResourceName(), partitionName)
@@ -528,47 +1002,148 @@ func (p *participant) postHandleMsg(msg *model.Message, handleMsgErr error) {
 	} else if handleMsgErr == errMismatchState {
 		targetState, _ = p.stateModel.GetState(msg.GetResourceName(), partitionName)
 	} else {
-		targetState = "ERROR"
-		p.logger.Error("error handling msg", zap.Error(handleMsgErr))
+		targetState = StateModelStateError
+		p.logger.Error("error handling msg", util.ErrorField(handleMsgErr))
 	}
 	// actually set the current state
-	currentStateForResourcePath := p.keyBuilder.currentStateForResource(p.instanceName,
-		sessionID, msg.GetResourceName())
-
-	err := p.zkClient.UpdateMapField(currentStateForResourcePath, partitionName,
+	err := p.updatePartitionCurrentState(ctx, sessionID, msg.GetResourceName(), partitionName,
 		model.FieldKeyCurrentState, targetState)
 	if err != nil {
-		p.logger.Error("failed to update current state in postHandleMsg", zap.Error(err))
+		p.logger.Error("failed to update current state in postHandleMsg", util.ErrorField(err))
 	} else {
 		// update local state only after zk is successfully updated
 		p.stateModel.UpdateState(msg.GetResourceName(), partitionName, targetState)
 	}
+	if targetState == StateModelStateError {
+		p.reportTransitionError(ctx, msg, sessionID, partitionName, handleMsgErr)
+	}
+}
+
+// updatePartitionCurrentState sets a field of the partition in the current state of the resource,
+// the update is batched with the other updates of the resource if batching is enabled
+func (p *participant) updatePartitionCurrentState(ctx context.Context,
+	sessionID string, resource string, partition string, key string, value string) error {
+	path := p.keyBuilder.currentStateForResource(p.instanceName, sessionID, resource)
+	if p.currentStateBatcher != nil {
+		return p.currentStateBatcher.update(path, partition, map[string]string{key: value})
+	}
+	return p.zkClient.UpdateMapFieldContext(ctx, path, partition, key, value)
+}
+
+// removePartitionCurrentState removes the partition from the current state of the resource
+func (p *participant) removePartitionCurrentState(
+	ctx context.Context, sessionID string, resource string, partition string) error {
+	path := p.keyBuilder.currentStateForResource(p.instanceName, sessionID, resource)
+	if p.currentStateBatcher != nil {
+		return p.currentStateBatcher.remove(path, partition)
+	}
+	return p.zkClient.RemoveMapFieldKeyContext(ctx, path, partition)
+}
+
+// reportTransitionError records the error of a failed transition in the INFO field of the
+// current state and in the error znode of the partition under INSTANCES/{instance}/ERRORS,
+// mirrors org.apache.helix.messaging.handling.HelixStateTransitionHandler#postHandleMessage
+func (p *participant) reportTransitionError(ctx context.Context,
+	msg *model.Message, sessionID string, partitionName string, handleMsgErr error) {
+	p.scope.Counter("transition-errors").Inc(1)
+	err := p.updatePartitionCurrentState(ctx, sessionID, msg.GetResourceName(), partitionName,
+		model.FieldKeyInfo, handleMsgErr.Error())
+	if err != nil {
+		p.logger.Error("failed to update current state info of error partition", util.ErrorField(err))
+	}
+
+	errorPath := p.keyBuilder.stateTransitionError(
+		p.instanceName, sessionID, msg.GetResourceName(), partitionName)
+	err = p.dataAccessor.withContext(ctx).updateData(errorPath, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		transitionError := model.NewStateTransitionError(partitionName)
+		if data != nil {
+			transitionError.ZNRecord = *data
+		}
+		transitionError.AddError(msg, handleMsgErr, time.Now())
+		return &transitionError.ZNRecord, nil
+	})
+	if err != nil {
+		p.logger.Error("failed to write state transition error", util.Field("path", errorPath),
+			util.ErrorField(err))
+	}
 }
 
-func (p *participant) handleStateTransition(msg *model.Message) error {
+func (p *participant) handleStateTransition(ctx context.Context,
+	msg *model.Message, registered *registeredStateModel, timeout time.Duration) error {
 	fromState := msg.GetFromState()
 	toState := msg.GetToState()
 	if fromState == "" || toState == "" {
-		p.logger.Info("missing participant state transition info", zap.Any("helixMsg", msg))
+		p.msgLogger(msg).Info("missing participant state transition info")
 		return errMsgMissingFromOrToState
 	}
 
 	// set the msg execution time
 	msg.SetExecuteStartTime(time.Now())
 
-	if val, ok := p.stateModelProcessors.Load(msg.GetStateModelDef()); ok {
-		processor := val.(*StateModelProcessor)
-		if toStateHandler, ok := processor.Transitions[fromState]; ok {
-			if handler, ok := toStateHandler[toState]; ok {
-				// TODO: deal with handler error
-				handler(msg)
-				return nil
-			}
-			return errors.Errorf("handler for to state %v not found", toState)
-		}
-		return errors.Errorf("handlers for from state %v not found", fromState)
+	partitionName, _ := msg.GetPartitionName()
+	// the state model of the partition may be created by the factory of the user
+	var processor *StateModelProcessor
+	err := p.safeCall(msgCrash(CallbackStateModelFactory, msg), func() error {
+		var err error
+		processor, err = registered.partitionProcessor(msg.GetResourceName(), partitionName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if handler, ok := processor.handler(fromState, toState); ok {
+		ctx, span := p.startMsgSpan(ctx, "helix.state_transition", msg)
+		status := p.newTransitionStatus(msg)
+		status.recordStart()
+		err := p.invokeTransitionHandlerWithTimeout(withTransitionStatus(ctx, status), handler, msg, timeout)
+		status.recordEnd(err)
+		endSpan(span, err)
+		return err
+	}
+	// mirrors the default reset of org.apache.helix.participant.statemachine.StateModel,
+	// partitions in ERROR state can be reset without a registered handler
+	if strings.EqualFold(fromState, StateModelStateError) {
+		return nil
+	}
+	if processor.hasFromState(fromState) {
+		return errors.Errorf("handler for to state %v not found", toState)
+	}
+	return errors.Errorf("handlers for from state %v not found", fromState)
+}
+
+// invokeTransitionHandler calls the handler and turns a panic into an error,
+// so the partition is transitioned to ERROR state instead of crashing the participant
+func (p *participant) invokeTransitionHandler(
+	ctx context.Context, handler ContextStateTransitionHandler, msg *model.Message) error {
+	return p.safeCall(msgCrash(CallbackTransition, msg), func() error {
+		return handler(ctx, msg)
+	})
+}
+
+// invokeTransitionHandlerWithTimeout fails the transition if the handler doesn't return within
+// the timeout, the context of the handler is cancelled and the handler is expected to return soon
+func (p *participant) invokeTransitionHandlerWithTimeout(ctx context.Context,
+	handler ContextStateTransitionHandler, msg *model.Message, timeout time.Duration) error {
+	if timeout <= 0 {
+		return p.invokeTransitionHandler(ctx, handler, msg)
+	}
+	// the timeout is measured with the clock of the participant, the context is cancelled when
+	// the timer of the clock fires
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.invokeTransitionHandler(ctx, handler, msg)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-p.clock.After(timeout):
+		cancel()
+		p.scope.Counter("transition-timeouts").Inc(1)
+		p.msgLogger(msg).Error("state transition timed out", util.Field("timeout", timeout))
+		return errors.Wrapf(ErrTransitionTimeout, "timeout %v", timeout)
 	}
-	return errors.Errorf("handler from state %v to state %v not found", fromState, toState)
 }
 
 func (p *participant) getCurrentResourceNames() []string {
@@ -580,13 +1155,21 @@ func (p *participant) getCurrentResourceNamesForSession(sessionID string) []stri
 	currentResourcesPath := p.keyBuilder.currentStatesForSession(p.instanceName, sessionID)
 	resources, err := p.zkClient.Children(currentResourcesPath)
 	if err != nil && errors.Cause(err) != zk.ErrNoNode {
-		p.logger.Error("failed to get resources of CURRENT_STATES", zap.Error(err))
+		p.logger.Error("failed to get resources of CURRENT_STATES", util.ErrorField(err))
 	}
 	return resources
 }
 
 func (p *participant) processMessages(messages []*model.Message) {
+	// the in-flight transitions are only added while the participant is not shutting down
+	p.inflightMu.Lock()
+	defer p.inflightMu.Unlock()
+	if p.shuttingDown {
+		p.logger.Info("participant is shutting down, ignoring new messages", util.Field("count", len(messages)))
+		return
+	}
 	sessionID := p.zkClient.GetSessionID()
+	now := p.clock.Now()
 	var messagesToHandle []*model.Message
 	var msgPathsToUpdate []string
 	var messagesToUpdate []*model.Message
@@ -595,12 +1178,10 @@ func (p *participant) processMessages(messages []*model.Message) {
 	for _, msg := range messages {
 		msgPath := p.keyBuilder.participantMsg(p.instanceName, msg.ID)
 		if msg.GetMsgType() == MsgTypeNoop {
-			p.logger.Info("dropping NO-OP message", zap.Any("helixMsg", msg))
+			p.msgLogger(msg).Info("dropping NO-OP message")
 			err := p.zkClient.DeleteTree(msgPath)
 			if err != nil {
-				p.logger.Error("failed to delete no-op msg",
-					zap.Any("helixMsg", msg),
-					zap.Error(err))
+				p.msgLogger(msg).Error("failed to delete no-op msg", util.ErrorField(err))
 			}
 			continue
 		}
@@ -615,19 +1196,27 @@ func (p *participant) processMessages(messages []*model.Message) {
 		// 3. This is an option for custom controller to use if needed.
 		if targetSessionID != sessionID && targetSessionID != "*" {
 			p.logger.Warn("sessionID doesn't match targetSessionID",
-				zap.String("sessionID", sessionID), zap.String("targetSessionID", targetSessionID))
-			err := p.zkClient.DeleteTree(msgPath)
-			if err != nil {
-				p.logger.Error("failed to delete message with mismatching sessionID",
-					zap.Any("helixMsg", msg), zap.Error(err))
-			}
+				util.Field("sessionID", sessionID), util.Field("targetSessionID", targetSessionID))
+			p.dropStaleMsg(msgPath, msg, "session_mismatch")
+			continue
+		}
+		if msg.IsExpired(now, p.messageTTL) {
+			p.msgLogger(msg).Warn("dropping expired message")
+			p.dropStaleMsg(msgPath, msg, "expired")
 			continue
 		}
 		if msg.GetMsgState() != model.MessageStateNew {
 			continue
 		}
+		if strings.EqualFold(msg.GetMsgType(), MsgTypeStateTransition) && p.isFrozen(msg) {
+			// the message is left new and handled once the partition is unfrozen
+			p.msgLogger(msg).Info("holding the transition of the frozen partition")
+			p.scope.Counter("held-messages").Inc(1)
+			continue
+		}
 		// TODO(yulun): T1270781 will change messagesToHandle to store handler types
 		messagesToHandle = append(messagesToHandle, msg)
+		p.recordMsgEvent(EventTypeMessageReceived, msg, nil)
 		msg.SetMsgState(model.MessageStateRead)
 		msgPathsToUpdate = append(msgPathsToUpdate, msgPath)
 		messagesToUpdate = append(messagesToUpdate, msg)
@@ -651,10 +1240,10 @@ func (p *participant) processMessages(messages []*model.Message) {
 		err := p.dataAccessor.createCurrentState(path, currentStateRecord)
 		if err != nil {
 			p.logger.Error("failed to create current state for msg",
-				zap.String("path", path), zap.Error(err))
+				util.Field("path", path), util.ErrorField(err))
 			continue
 		}
-		p.logger.Info("created current state for msg", zap.String("path", path))
+		p.logger.Info("created current state for msg", util.Field("path", path))
 	}
 	for i := 0; i < len(msgPathsToUpdate); i++ {
 		path := msgPathsToUpdate[i]
@@ -665,15 +1254,33 @@ func (p *participant) processMessages(messages []*model.Message) {
 		// messages to be processed more than once (which relies on the rebalancer to heal)
 		err := p.dataAccessor.setMsg(path, msg)
 		if err != nil {
-			p.logger.Error("failed to update msg to read",
-				zap.Any("helixMsg", msg),
-				zap.Error(err))
+			p.msgLogger(msg).Error("failed to update msg to read", util.ErrorField(err))
 		}
 	}
 	// only start processing when all messages are marked read
 	// mirrors logic in org.apache.helix.manager.zk.CallbackHandler#CallbackInvoker
 	for _, msg := range messagesToHandle {
-		go p.handleMsg(msg)
+		p.inflight.Add(1)
+		go func(msg *model.Message) {
+			defer p.inflight.Done()
+			p.executeMsg(msg)
+		}(msg)
+	}
+}
+
+// msgLogger returns the logger of the participant with the resource and the partition of the message,
+// the resource of the participant is already logged as resource
+func (p *participant) msgLogger(msg *model.Message) Logger {
+	partition, _ := msg.GetPartitionName()
+	return p.logger.With(util.Field("msgResource", msg.GetResourceName()), util.Field("partition", partition),
+		util.Field("helixMsg", msg))
+}
+
+// dropStaleMsg deletes the message that must not be handled
+func (p *participant) dropStaleMsg(msgPath string, msg *model.Message, reason string) {
+	p.scope.Tagged(map[string]string{"reason": reason}).Counter("stale-messages").Inc(1)
+	if err := p.zkClient.DeleteTree(msgPath); err != nil {
+		p.msgLogger(msg).Error("failed to delete stale message", util.Field("reason", reason), util.ErrorField(err))
 	}
 }
 
@@ -682,7 +1289,7 @@ func (p *participant) carryOverPreviousCurrentState() error {
 
 	sessionIDs, err := p.zkClient.Children(currentStatesPath)
 	if err != nil {
-		p.logger.Error("failed to get previous currentStates", zap.Error(err))
+		p.logger.Error("failed to get previous currentStates", util.ErrorField(err))
 		return err
 	}
 
@@ -692,7 +1299,7 @@ func (p *participant) carryOverPreviousCurrentState() error {
 		}
 		if err := p.carryOverPreviousCurrentStateFromSession(sessionID); err != nil {
 			p.logger.Error("failed to carry over previous state",
-				zap.Error(err), zap.String("session", sessionID))
+				util.ErrorField(err), util.Field("session", sessionID))
 			return err
 		}
 	}
@@ -703,10 +1310,10 @@ func (p *participant) carryOverPreviousCurrentState() error {
 			continue
 		}
 		path := currentStatesPath + "/" + sessionID
-		p.logger.Info("removing current states from previous sessionIDs.", zap.String("path", path))
+		p.logger.Info("removing current states from previous sessionIDs.", util.Field("path", path))
 		err = p.zkClient.DeleteTree(path)
 		if err != nil && errors.Cause(err) != zk.ErrNoNode {
-			p.logger.Error("failed to remove previous state", zap.Error(err))
+			p.logger.Error("failed to remove previous state", util.ErrorField(err))
 			return err
 		}
 	}
@@ -716,9 +1323,9 @@ func (p *participant) carryOverPreviousCurrentState() error {
 func (p *participant) carryOverPreviousCurrentStateFromSession(sessionID string) error {
 	for _, resource := range p.getCurrentResourceNamesForSession(sessionID) {
 		p.logger.Info("carry over from old session",
-			zap.String("oldSession", sessionID),
-			zap.String("currentSession", p.zkClient.GetSessionID()),
-			zap.String("resource", resource))
+			util.Field("oldSession", sessionID),
+			util.Field("currentSession", p.zkClient.GetSessionID()),
+			util.Field("resource", resource))
 		lastCurState, err := p.dataAccessor.CurrentState(p.instanceName, sessionID, resource)
 		if err != nil {
 			return err
@@ -726,8 +1333,8 @@ func (p *participant) carryOverPreviousCurrentStateFromSession(sessionID string)
 		stateModelDefString := lastCurState.GetStateModelDef()
 		if stateModelDefString == "" {
 			p.logger.Error("skip carry over as previous current state doesn't have state model definition",
-				zap.String("oldSession", sessionID),
-				zap.String("resource", resource))
+				util.Field("oldSession", sessionID),
+				util.Field("resource", resource))
 			continue
 		}
 		stateModelDef, err := p.dataAccessor.StateModelDef(stateModelDefString)
@@ -771,6 +1378,12 @@ func (p *participant) getMessages(msgIDs []string) ([]*model.Message, error) {
 	for i := 0; i < len(msgIDs); i++ {
 		path := p.keyBuilder.participantMsg(p.instanceName, msgIDs[i])
 		msg, err := p.dataAccessor.Msg(path)
+		if invalid, ok := errors.Cause(err).(*model.ErrInvalidRecord); ok {
+			// the invalid message is left for the operator, it would fail the other messages
+			p.logger.Warn("skipping invalid message", util.ErrorField(invalid))
+			p.scope.Counter("invalid-messages").Inc(1)
+			continue
+		}
 		switch errors.Cause(err) {
 		case nil:
 			res = append(res, msg)
@@ -788,5 +1401,5 @@ func (p *participant) getMessages(msgIDs []string) ([]*model.Message, error) {
 }
 
 func getInstanceName(host string, port int32) string {
-	return fmt.Sprintf("%s_%d", host, port)
+	return model.InstanceName(host, int(port))
 }
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/uber-go/go-helix/model"
+)
+
+// PartitionAssignmentListener is notified of the partitions assigned to the participant and
+// removed from it, for the applications that only care about the ownership of the partitions
+// and not about each transition of the state model. The calls are made one at a time
+type PartitionAssignmentListener interface {
+	// OnPartitionAssigned is called when the partition leaves the initial state of its state
+	// model, and again with the new state on each following transition, e.g. SLAVE then MASTER
+	OnPartitionAssigned(resource, partition, state string)
+	// OnPartitionRemoved is called when the assigned partition returns to the initial state,
+	// is dropped, goes to ERROR or is lost with the session
+	OnPartitionRemoved(resource, partition string)
+}
+
+// WithPartitionAssignmentListener notifies the listener of the partitions assigned to the
+// participant and removed from it, computed from the transitions the participant completes
+func WithPartitionAssignmentListener(listener PartitionAssignmentListener) ParticipantOption {
+	return func(p *participant) {
+		p.assignmentListeners = append(p.assignmentListeners, listener)
+	}
+}
+
+type resourcePartition struct {
+	resource  string
+	partition string
+}
+
+// notifyAssignment notifies the listeners of the change of the assignment of the partition of
+// the message, once its transition is handled and the local state is updated
+func (p *participant) notifyAssignment(msg *model.Message, stateModelDef *model.StateModelDef) {
+	if len(p.assignmentListeners) == 0 {
+		return
+	}
+	partition, _ := msg.GetPartitionName()
+	key := resourcePartition{resource: msg.GetResourceName(), partition: partition}
+	state, ok := p.stateModel.GetState(key.resource, key.partition)
+	assigned := ok && state != StateModelStateError && state != StateModelStateDropped &&
+		(stateModelDef == nil || state != stateModelDef.GetInitialState())
+
+	p.assignmentMu.Lock()
+	defer p.assignmentMu.Unlock()
+	previous, wasAssigned := p.assignments[key]
+	if assigned {
+		if previous == state {
+			return
+		}
+		if p.assignments == nil {
+			p.assignments = map[resourcePartition]string{}
+		}
+		p.assignments[key] = state
+		for _, listener := range p.assignmentListeners {
+			p.safeCall(assignmentCrash(key), func() error {
+				listener.OnPartitionAssigned(key.resource, key.partition, state)
+				return nil
+			})
+		}
+	} else if wasAssigned {
+		delete(p.assignments, key)
+		for _, listener := range p.assignmentListeners {
+			p.safeCall(assignmentCrash(key), func() error {
+				listener.OnPartitionRemoved(key.resource, key.partition)
+				return nil
+			})
+		}
+	}
+}
+
+// removeAssignments notifies the listeners of the removal of all the assigned partitions,
+// when they are lost with the session or the participant disconnects
+func (p *participant) removeAssignments() {
+	p.assignmentMu.Lock()
+	defer p.assignmentMu.Unlock()
+	for key := range p.assignments {
+		for _, listener := range p.assignmentListeners {
+			p.safeCall(assignmentCrash(key), func() error {
+				listener.OnPartitionRemoved(key.resource, key.partition)
+				return nil
+			})
+		}
+	}
+	p.assignments = nil
+}
+
+// assignmentCrash returns the crash of the assignment listeners notified of the partition
+func assignmentCrash(key resourcePartition) Crash {
+	return Crash{Callback: CallbackAssignmentListener, Resource: key.resource, Partition: key.partition}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type testAssignmentListener chan string
+
+func (l testAssignmentListener) OnPartitionAssigned(resource, partition, state string) {
+	l <- fmt.Sprintf("assigned %s %s %s", resource, partition, state)
+}
+
+func (l testAssignmentListener) OnPartitionRemoved(resource, partition string) {
+	l <- fmt.Sprintf("removed %s %s", resource, partition)
+}
+
+func TestPartitionAssignmentListener(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	accessor := cluster.accessor
+
+	listener := make(testAssignmentListener, 10)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithPartitionAssignmentListener(listener),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	sessionID := p.(*participant).zkClient.GetSessionID()
+
+	transition := func(partition string, fromState string, toState string) {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetStateModelDef(StateModelNameOnlineOffline)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetFromState(fromState)
+		msg.SetToState(toState)
+		msg.SetMsgState(model.MessageStateNew)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+	}
+	receive := func() string {
+		select {
+		case e := <-listener:
+			return e
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no assignment change notified")
+			return ""
+		}
+	}
+
+	transition("r1_0", StateModelStateOffline, StateModelStateOnline)
+	assert.Equal(t, "assigned r1 r1_0 ONLINE", receive())
+	transition("r1_0", StateModelStateOnline, StateModelStateOffline)
+	assert.Equal(t, "removed r1 r1_0", receive())
+	// the partitions that are not assigned are not notified when dropped
+	transition("r1_0", StateModelStateOffline, StateModelStateDropped)
+	transition("r1_1", StateModelStateOffline, StateModelStateOnline)
+	assert.Equal(t, "assigned r1 r1_1 ONLINE", receive())
+
+	// the partitions are lost with the session
+	p.Disconnect()
+	assert.Equal(t, "removed r1 r1_1", receive())
+	select {
+	case e := <-listener:
+		assert.Fail(t, "unexpected assignment change", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// WithAutoJoinDomain sets the domain of the instance config created when the participant auto joins
+// the cluster, e.g. zone=z1,rack=r1,instance=localhost_12913. The keys of the domain must be levels
+// of the topology of the cluster, if any, so a typo'd key does not place the instance in a wrong zone
+func WithAutoJoinDomain(domain string) ParticipantOption {
+	return func(p *participant) {
+		p.autoJoinDomain = domain
+	}
+}
+
+// WithAutoJoinTags sets the tags of the instance config created when the participant auto joins the cluster
+func WithAutoJoinTags(tags ...string) ParticipantOption {
+	return func(p *participant) {
+		p.autoJoinTags = append(p.autoJoinTags, tags...)
+	}
+}
+
+// WithAutoJoinNamePattern only lets the participant auto join the cluster if its instance name matches
+// the pattern, so a participant started with a typo'd host fails to connect instead of registering
+// a new instance in the cluster
+func WithAutoJoinNamePattern(pattern *regexp.Regexp) ParticipantOption {
+	return func(p *participant) {
+		p.autoJoinNamePattern = pattern
+	}
+}
+
+// newAutoJoinInstanceConfig creates the instance config of the participant from the auto join template
+// after checking it against the safeguards
+func (p *participant) newAutoJoinInstanceConfig(clusterConfig *model.ClusterConfig) (*model.InstanceConfig, error) {
+	host, port, err := model.ParseInstanceName(p.instanceName)
+	if err != nil || host == "" || strings.Contains(host, "/") || port <= 0 {
+		return nil, errors.Errorf("invalid instance name %s to auto join cluster %s", p.instanceName, p.clusterName)
+	}
+	if p.autoJoinNamePattern != nil && !p.autoJoinNamePattern.MatchString(p.instanceName) {
+		return nil, errors.Errorf("instance name %s does not match %s to auto join cluster %s",
+			p.instanceName, p.autoJoinNamePattern, p.clusterName)
+	}
+
+	instanceConfig := model.NewInstanceConfig(p.instanceName)
+	instanceConfig.SetHost(host)
+	instanceConfig.SetPort(port)
+	instanceConfig.SetEnabled(true)
+	for _, tag := range p.autoJoinTags {
+		instanceConfig.AddTag(tag)
+	}
+	if p.autoJoinDomain == "" {
+		return instanceConfig, nil
+	}
+	if err := instanceConfig.SetDomain(p.autoJoinDomain); err != nil {
+		return nil, err
+	}
+	if topology := clusterConfig.GetTopology(); topology != "" {
+		levels := util.NewStringSet(strings.Split(topology, "/")...)
+		for key := range instanceConfig.GetDomainAsMap() {
+			if key == "" || !levels.Contains(key) {
+				return nil, errors.Errorf("domain key %s of instance %s is not a level of topology %s",
+					key, p.instanceName, topology)
+			}
+		}
+	}
+	return instanceConfig, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantAutoJoinTemplate(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, admin := cluster.zk, cluster.admin
+	assert.NoError(t, admin.SetConfig(TestClusterName, "CLUSTER", map[string]string{
+		_allowParticipantAutoJoinKey: "true",
+	}))
+	assert.NoError(t, admin.UpdateClusterConfig(TestClusterName, func(config *model.ClusterConfig) {
+		config.SetTopology("/zone/rack/instance")
+	}))
+
+	newParticipant := func(host string, port int32, options ...ParticipantOption) *participant {
+		options = append(options, WithParticipantZkClientOptions(uzk.WithConnFactory(fakeZK),
+			uzk.WithRetryTimeout(time.Second)))
+		p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName,
+			TestResource, host, port, options...)
+		return p.(*participant)
+	}
+
+	namePattern := regexp.MustCompile(`^localhost_\d+$`)
+	p := newParticipant(testParticipantHost, 12913, WithAutoJoinDomain("zone=z1,rack=r1,instance=localhost_12913"),
+		WithAutoJoinTags("tag1", "tag2"), WithAutoJoinNamePattern(namePattern))
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	config, err := admin.GetInstanceConfig(TestClusterName, p.InstanceName())
+	assert.NoError(t, err)
+	assert.True(t, config.GetEnabled())
+	assert.Equal(t, testParticipantHost, config.GetHost())
+	assert.Equal(t, 12913, config.GetPort())
+	assert.Equal(t, []string{"tag1", "tag2"}, config.GetTags())
+	assert.Equal(t, map[string]string{"zone": "z1", "rack": "r1", "instance": "localhost_12913"},
+		config.GetDomainAsMap())
+
+	// the typo'd domain key is not a level of the topology
+	p = newParticipant(testParticipantHost, 12914, WithAutoJoinDomain("zome=z1,rack=r1"))
+	assert.Error(t, p.Connect())
+	_, err = admin.GetInstanceConfig(TestClusterName, p.InstanceName())
+	assert.Equal(t, ErrNodeNotExist, err)
+
+	// the instance name does not match the pattern
+	p = newParticipant("lcoalhost", 12915, WithAutoJoinNamePattern(namePattern))
+	assert.Error(t, p.Connect())
+	_, err = admin.GetInstanceConfig(TestClusterName, p.InstanceName())
+	assert.Equal(t, ErrNodeNotExist, err)
+
+	// the existing instance config is kept as is
+	assert.NoError(t, admin.AddNode(TestClusterName, "localhost_12916"))
+	p = newParticipant(testParticipantHost, 12916, WithAutoJoinTags("tag1"))
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	config, err = admin.GetInstanceConfig(TestClusterName, p.InstanceName())
+	assert.NoError(t, err)
+	assert.Empty(t, config.GetTags())
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantClockTransitionTimeout(t *testing.T) {
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithParticipantClock(clock))
+	pImpl := p.(*participant)
+	assert.Equal(t, clock, pImpl.zkClient.Clock())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pImpl.invokeTransitionHandlerWithTimeout(context.Background(),
+			func(ctx context.Context, m *model.Message) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}, model.NewMsg(CreateRandomString()), time.Minute)
+	}()
+	clock.BlockUntil(1)
+	// the transition does not time out before the clock reaches the timeout
+	clock.Advance(time.Minute - time.Second)
+	select {
+	case err := <-errCh:
+		assert.Fail(t, "unexpected transition result", "%v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	select {
+	case err := <-errCh:
+		assert.Equal(t, ErrTransitionTimeout, errors.Cause(err))
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "transition not timed out")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// The user callbacks of the participant whose panics are recovered
+const (
+	CallbackTransition         = "transition"
+	CallbackStateModelFactory  = "state-model-factory"
+	CallbackMessageHandler     = "message-handler"
+	CallbackAssignmentListener = "assignment-listener"
+	CallbackFreezeListener     = "freeze-listener"
+	CallbackHealthReporter     = "health-reporter"
+)
+
+// Crash describes a panic recovered from a user callback of the participant
+type Crash struct {
+	Callback  string
+	Resource  string
+	Partition string
+	MessageID string
+	Panic     interface{}
+	Stack     []byte
+}
+
+// CrashReporter is notified of the panics recovered from the user callbacks,
+// e.g. to forward them to a crash reporting service
+type CrashReporter func(crash Crash)
+
+// WithCrashReporter adds a CrashReporter notified of the panics recovered from the user callbacks
+func WithCrashReporter(reporter CrashReporter) ParticipantOption {
+	return func(p *participant) {
+		p.crashReporters = append(p.crashReporters, reporter)
+	}
+}
+
+// msgCrash returns the crash of the callback handling the message
+func msgCrash(callback string, msg *model.Message) Crash {
+	partition, _ := msg.GetPartitionName()
+	return Crash{Callback: callback, Resource: msg.GetResourceName(), Partition: partition, MessageID: msg.ID}
+}
+
+// safeCall calls the user callback and turns a panic into an error, so a faulty callback fails the
+// partition or the message instead of crashing the participant process
+func (p *participant) safeCall(crash Crash, callback func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Panic = r
+			crash.Stack = debug.Stack()
+			p.reportCrash(crash)
+			err = errors.Errorf("%s panicked: %v", crash.Callback, r)
+		}
+	}()
+	return callback()
+}
+
+func (p *participant) reportCrash(crash Crash) {
+	p.scope.Tagged(map[string]string{"callback": crash.Callback}).Counter("callback-panics").Inc(1)
+	p.logger.Error("user callback panicked", util.Field("callback", crash.Callback),
+		util.Field("msgResource", crash.Resource), util.Field("partition", crash.Partition),
+		util.Field("msgID", crash.MessageID), util.Field("panic", crash.Panic),
+		util.Field("stack", string(crash.Stack)))
+	for _, reporter := range p.crashReporters {
+		func() {
+			// a panicking reporter doesn't crash the participant either
+			defer func() {
+				if r := recover(); r != nil {
+					p.logger.Error("crash reporter panicked", util.Field("panic", r))
+				}
+			}()
+			reporter(crash)
+		}()
+	}
+}
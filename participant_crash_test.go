@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type panickingAssignmentListener struct{}
+
+func (panickingAssignmentListener) OnPartitionAssigned(resource, partition, state string) {
+	panic("assigned")
+}
+
+func (panickingAssignmentListener) OnPartitionRemoved(resource, partition string) {
+	panic("removed")
+}
+
+func TestParticipantCrashReporter(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	accessor := cluster.accessor
+
+	processor := createNoopStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		if partition, _ := m.GetPartitionName(); partition == "r1_0" {
+			panic("transition")
+		}
+		return nil
+	})
+	crashes := make(chan Crash, 10)
+	listener := make(testAssignmentListener, 10)
+	scope := tally.NewTestScope("", nil)
+	p, _ := NewParticipant(zap.NewNop(), scope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithCrashReporter(func(crash Crash) { crashes <- crash }),
+		WithPartitionAssignmentListener(panickingAssignmentListener{}), WithPartitionAssignmentListener(listener),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	sessionID := p.(*participant).zkClient.GetSessionID()
+
+	transition := func(partition string) *model.Message {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetStateModelDef(StateModelNameOnlineOffline)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetFromState(StateModelStateOffline)
+		msg.SetToState(StateModelStateOnline)
+		msg.SetMsgState(model.MessageStateNew)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+		return msg
+	}
+	receiveCrash := func() Crash {
+		select {
+		case crash := <-crashes:
+			return crash
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no crash reported")
+			return Crash{}
+		}
+	}
+
+	// the panic of the transition fails the partition
+	msg := transition("r1_0")
+	crash := receiveCrash()
+	assert.Equal(t, CallbackTransition, crash.Callback)
+	assert.Equal(t, "r1", crash.Resource)
+	assert.Equal(t, "r1_0", crash.Partition)
+	assert.Equal(t, msg.ID, crash.MessageID)
+	assert.Equal(t, "transition", crash.Panic)
+	assert.Contains(t, string(crash.Stack), "TestParticipantCrashReporter")
+	state := ""
+	for deadline := time.Now().Add(5 * time.Second); state != StateModelStateError && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		if currentState, err := accessor.CurrentState(p.InstanceName(), sessionID, "r1"); err == nil {
+			state = currentState.GetState("r1_0")
+		}
+	}
+	assert.Equal(t, StateModelStateError, state)
+
+	// the panic of a listener doesn't stop the other listeners
+	transition("r1_1")
+	crash = receiveCrash()
+	assert.Equal(t, Crash{Callback: CallbackAssignmentListener, Resource: "r1", Partition: "r1_1",
+		Panic: "assigned", Stack: crash.Stack}, crash)
+	select {
+	case e := <-listener:
+		assert.Equal(t, "assigned r1 r1_1 ONLINE", e)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "no assignment notified")
+	}
+	assert.True(t, p.IsConnected())
+	panics := int64(0)
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.participant.callback-panics" {
+			panics += counter.Value()
+		}
+	}
+	assert.Equal(t, int64(2), panics)
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+const _debugPathPrefix = "/debug/helix"
+
+// WithDebugServer serves the internals of the participant on addr while it is connected,
+// e.g. ":8080", for debugging stuck partitions:
+//
+//	GET  /debug/helix                the instance, session, registered state models and watches
+//	GET  /debug/helix/currentstates  the current states of the session by resource and partition
+//	GET  /debug/helix/messages       the pending messages
+//	POST /debug/helix/snapshot       all of the above, also written to the log
+//	GET  /debug/helix/loglevel?component=zk  the runtime log level of the component,
+//	     changed by PUT with {"level":"debug"}, see SetLogLevel
+func WithDebugServer(addr string) ParticipantOption {
+	return func(p *participant) {
+		p.debugAddr = addr
+	}
+}
+
+// debugStatus is the summary of the participant served by the debug server
+type debugStatus struct {
+	Cluster     string   `json:"cluster"`
+	Instance    string   `json:"instance"`
+	SessionID   string   `json:"sessionID"`
+	Connected   bool     `json:"connected"`
+	StateModels []string `json:"stateModels"`
+	Watches     int64    `json:"watches"`
+}
+
+// debugMessage is a pending message served by the debug server
+type debugMessage struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	State      string    `json:"state"`
+	Resource   string    `json:"resource"`
+	Partition  string    `json:"partition"`
+	FromState  string    `json:"fromState"`
+	ToState    string    `json:"toState"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// debugSnapshot is the diagnostic snapshot of the participant
+type debugSnapshot struct {
+	Time          time.Time                    `json:"time"`
+	Status        debugStatus                  `json:"status"`
+	CurrentStates map[string]map[string]string `json:"currentStates"`
+	Messages      []debugMessage               `json:"messages"`
+}
+
+func (p *participant) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(_debugPathPrefix, func(w http.ResponseWriter, r *http.Request) {
+		p.writeDebugJSON(w, p.debugStatus(), nil)
+	})
+	mux.HandleFunc(_debugPathPrefix+"/currentstates", func(w http.ResponseWriter, r *http.Request) {
+		currentStates, err := p.debugCurrentStates()
+		p.writeDebugJSON(w, currentStates, err)
+	})
+	mux.HandleFunc(_debugPathPrefix+"/messages", func(w http.ResponseWriter, r *http.Request) {
+		messages, err := p.debugMessages()
+		p.writeDebugJSON(w, messages, err)
+	})
+	mux.HandleFunc(_debugPathPrefix+"/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST to take a snapshot", http.StatusMethodNotAllowed)
+			return
+		}
+		snapshot, err := p.debugSnapshot()
+		if err == nil {
+			p.logger.Info("participant diagnostic snapshot", util.Field("snapshot", snapshot))
+		}
+		p.writeDebugJSON(w, snapshot, err)
+	})
+	mux.HandleFunc(_debugPathPrefix+"/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		component := r.URL.Query().Get("component")
+		if component == "" {
+			http.Error(w, "the component is missing", http.StatusBadRequest)
+			return
+		}
+		util.LogLevel(component).ServeHTTP(w, r)
+	})
+	return mux
+}
+
+// startDebugServer serves the debug handler if configured by WithDebugServer
+func (p *participant) startDebugServer() error {
+	if p.debugAddr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", p.debugAddr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on debug address %s", p.debugAddr)
+	}
+	server := &http.Server{Handler: p.debugHandler()}
+	p.debugServerMu.Lock()
+	p.debugServer = server
+	p.debugServerMu.Unlock()
+	p.logger.Info("serving participant debug endpoints", util.Field("addr", listener.Addr().String()))
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			p.logger.Error("participant debug server failed", util.ErrorField(err))
+		}
+	}()
+	return nil
+}
+
+func (p *participant) stopDebugServer() {
+	p.debugServerMu.Lock()
+	server := p.debugServer
+	p.debugServer = nil
+	p.debugServerMu.Unlock()
+	if server != nil {
+		server.Close()
+	}
+}
+
+func (p *participant) debugStatus() debugStatus {
+	return debugStatus{
+		Cluster:     p.clusterName,
+		Instance:    p.instanceName,
+		SessionID:   p.zkClient.GetSessionID(),
+		Connected:   p.IsConnected(),
+		StateModels: p.stateModelRegistry.stateModels(),
+		Watches:     atomic.LoadInt64(&p.activeWatches),
+	}
+}
+
+// debugCurrentStates returns resource -> partition -> state of the current session
+func (p *participant) debugCurrentStates() (map[string]map[string]string, error) {
+	currentStates, err := p.dataAccessor.CurrentStates(p.instanceName, p.zkClient.GetSessionID())
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]string, len(currentStates))
+	for resource, currentState := range currentStates {
+		result[resource] = currentState.GetPartitionStateMap()
+	}
+	return result, nil
+}
+
+func (p *participant) debugMessages() ([]debugMessage, error) {
+	records, err := p.dataAccessor.childRecords(p.keyBuilder.participantMessages(p.instanceName))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]debugMessage, 0, len(records))
+	for _, record := range records {
+		msg := &model.Message{ZNRecord: *record}
+		partition, _ := msg.GetPartitionName()
+		messages = append(messages, debugMessage{
+			ID:         msg.ID,
+			Type:       msg.GetMsgType(),
+			State:      msg.GetMsgState().String(),
+			Resource:   msg.GetResourceName(),
+			Partition:  partition,
+			FromState:  msg.GetFromState(),
+			ToState:    msg.GetToState(),
+			CreateTime: time.Unix(0, msg.GetCreateTimestamp()*int64(time.Millisecond)),
+		})
+	}
+	return messages, nil
+}
+
+func (p *participant) debugSnapshot() (*debugSnapshot, error) {
+	snapshot := &debugSnapshot{Time: time.Now(), Status: p.debugStatus()}
+	var err error
+	if snapshot.CurrentStates, err = p.debugCurrentStates(); err != nil {
+		return nil, err
+	}
+	if snapshot.Messages, err = p.debugMessages(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (p *participant) writeDebugJSON(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		p.logger.Warn("failed to write debug response", util.ErrorField(err))
+	}
+}
+
+// awaitWatch waits for the event of a watch set by the participant,
+// the watch is counted as active until it fires
+func (p *participant) awaitWatch(eventCh <-chan zk.Event) (zk.Event, bool) {
+	atomic.AddInt64(&p.activeWatches, 1)
+	defer atomic.AddInt64(&p.activeWatches, -1)
+	ev, ok := <-eventCh
+	return ev, ok
+}
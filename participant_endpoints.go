@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+// WithAdvertisedEndpoint advertises the host:port address of the endpoint of the participant
+// serving the protocol, e.g. grpc or http, in its instance config on each session, so the
+// spectators pick the endpoint of the protocol they speak with RoutingTable.GetEndpoints
+func WithAdvertisedEndpoint(protocol string, address string) ParticipantOption {
+	return func(p *participant) {
+		if p.endpoints == nil {
+			p.endpoints = map[string]string{}
+		}
+		p.endpoints[protocol] = address
+	}
+}
+
+// advertiseEndpoints sets the endpoints of the participant in its instance config,
+// the config is not written if the endpoints are already advertised
+func (p *participant) advertiseEndpoints() error {
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+	path := p.keyBuilder.participantConfig(p.instanceName)
+	if config, err := p.dataAccessor.InstanceConfig(path); err == nil && p.endpointsAdvertised(config) {
+		return nil
+	}
+	return p.dataAccessor.updateData(path, func(data *model.ZNRecord) (*model.ZNRecord, error) {
+		if data == nil {
+			return nil, errors.Errorf("instance config of %s not found", p.instanceName)
+		}
+		config := &model.InstanceConfig{ZNRecord: *data}
+		for protocol, address := range p.endpoints {
+			if err := config.SetEndpoint(protocol, address); err != nil {
+				return nil, errors.Wrapf(err, "failed to advertise endpoint of %s", p.instanceName)
+			}
+		}
+		return &config.ZNRecord, nil
+	})
+}
+
+func (p *participant) endpointsAdvertised(config *model.InstanceConfig) bool {
+	for protocol, address := range p.endpoints {
+		if advertised, ok := config.GetEndpoint(protocol); !ok || advertised != address {
+			return false
+		}
+	}
+	return true
+}
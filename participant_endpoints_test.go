@@ -0,0 +1,53 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantAdvertisedEndpoints(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin := cluster.admin
+	name := model.InstanceName("[::1]", 1)
+	assert.NoError(t, admin.AddNode(TestClusterName, name))
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		"::1", 1, WithAdvertisedEndpoint("grpc", "[::1]:9090"),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	assert.Equal(t, "::1_1", p.InstanceName())
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+
+	config, err := admin.GetInstanceConfig(TestClusterName, name)
+	assert.NoError(t, err)
+	assert.Equal(t, "[::1]:1", config.GetAddress())
+	address, ok := config.GetEndpoint("grpc")
+	assert.True(t, ok)
+	assert.Equal(t, "[::1]:9090", address)
+}
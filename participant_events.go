@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// WithEventLog records the cluster events observed by the participant in the EventLog
+func WithEventLog(eventLog *EventLog) ParticipantOption {
+	return func(p *participant) {
+		p.eventLog = eventLog
+	}
+}
+
+func (p *participant) recordEvent(e Event) {
+	if p.eventLog == nil {
+		return
+	}
+	e.Cluster = p.clusterName
+	if e.Instance == "" {
+		e.Instance = p.instanceName
+	}
+	p.eventLog.Record(e)
+}
+
+func (p *participant) recordMsgEvent(eventType EventType, msg *model.Message, err error) {
+	if p.eventLog == nil {
+		return
+	}
+	partition, _ := msg.GetPartitionName()
+	e := Event{
+		Type:      eventType,
+		Resource:  msg.GetResourceName(),
+		Partition: partition,
+		MsgID:     msg.ID,
+		FromState: msg.GetFromState(),
+		ToState:   msg.GetToState(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	p.recordEvent(e)
+}
+
+// watchClusterEvents records the live instance and external view changes in the event log,
+// the watches stop when the session expires or the participant disconnects
+func (p *participant) watchClusterEvents() {
+	if p.eventLog == nil {
+		return
+	}
+	// the initial watches are set before returning, so no change after the new session is missed
+	instances, instancesEventCh, err := p.zkClient.ChildrenW(p.keyBuilder.liveInstances())
+	if err != nil {
+		p.logger.Warn("failed to watch live instances for event log", util.ErrorField(err))
+	} else {
+		go p.watchLiveInstances(instances, instancesEventCh)
+	}
+	resources, resourcesEventCh, err := p.zkClient.ChildrenW(p.keyBuilder.externalView())
+	if err != nil {
+		p.logger.Warn("failed to watch external views for event log", util.ErrorField(err))
+	} else {
+		go p.watchExternalViews(resources, resourcesEventCh)
+	}
+}
+
+func (p *participant) watchLiveInstances(instances []string, eventCh <-chan zk.Event) {
+	previous := util.NewStringSet(instances...)
+	for {
+		if ev, ok := p.awaitWatch(eventCh); ok && ev.Err != nil {
+			return
+		}
+		var err error
+		instances, eventCh, err = p.zkClient.ChildrenW(p.keyBuilder.liveInstances())
+		if err != nil {
+			p.logger.Warn("stop watching live instances for event log", util.ErrorField(err))
+			return
+		}
+		current := util.NewStringSet(instances...)
+		for instance := range current {
+			if !previous.Contains(instance) {
+				p.recordEvent(Event{Type: EventTypeLiveInstanceUp, Instance: instance})
+			}
+		}
+		for instance := range previous {
+			if !current.Contains(instance) {
+				p.recordEvent(Event{Type: EventTypeLiveInstanceDown, Instance: instance})
+			}
+		}
+		previous = current
+	}
+}
+
+func (p *participant) watchExternalViews(resources []string, eventCh <-chan zk.Event) {
+	// resources with a running external view watcher
+	watched := util.NewStringSet()
+	for {
+		current := util.NewStringSet(resources...)
+		for resource := range watched {
+			// the watcher of a deleted resource stops on the deletion
+			if !current.Contains(resource) {
+				watched.Remove(resource)
+			}
+		}
+		for resource := range current {
+			if !watched.Contains(resource) {
+				watched.Add(resource)
+				go p.watchExternalView(resource)
+			}
+		}
+		if ev, ok := p.awaitWatch(eventCh); ok && ev.Err != nil {
+			return
+		}
+		var err error
+		resources, eventCh, err = p.zkClient.ChildrenW(p.keyBuilder.externalView())
+		if err != nil {
+			p.logger.Warn("stop watching external views for event log", util.ErrorField(err))
+			return
+		}
+	}
+}
+
+func (p *participant) watchExternalView(resource string) {
+	path := p.keyBuilder.externalViewForResource(resource)
+	for initial := true; ; initial = false {
+		_, eventCh, err := p.zkClient.GetW(path)
+		if err != nil {
+			return
+		}
+		if !initial {
+			p.recordEvent(Event{Type: EventTypeExternalViewChanged, Resource: resource})
+		}
+		ev, ok := p.awaitWatch(eventCh)
+		if ok && (ev.Err != nil || ev.Type == zk.EventNodeDeleted) {
+			return
+		}
+	}
+}
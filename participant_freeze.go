@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// FreezeListener is notified when the cluster or some partitions are frozen and unfrozen, so the
+// application can quiesce its background work too. The calls are made one at a time
+type FreezeListener interface {
+	// OnFreeze is called with the pause signal when it is created or changed, the in-flight
+	// transitions of the frozen partitions complete and their new transitions are held
+	OnFreeze(signal *model.PauseSignal)
+	// OnUnfreeze is called when the pause signal is removed, the held transitions are handled
+	OnUnfreeze()
+}
+
+// WithFreezeListener notifies the listener of the freezes of the cluster and of its partitions
+func WithFreezeListener(listener FreezeListener) ParticipantOption {
+	return func(p *participant) {
+		p.freezeListeners = append(p.freezeListeners, listener)
+	}
+}
+
+// watchPauseSignal reads the pause signal and keeps it updated until the session ends
+func (p *participant) watchPauseSignal() {
+	eventCh, err := p.readPauseSignal()
+	if err != nil {
+		p.logger.Warn("failed to watch the pause signal", util.ErrorField(err))
+		return
+	}
+	go func() {
+		for {
+			if ev, ok := p.awaitWatch(eventCh); ok && ev.Err != nil {
+				return
+			}
+			if eventCh, err = p.readPauseSignal(); err != nil {
+				p.logger.Warn("stop watching the pause signal", util.ErrorField(err))
+				return
+			}
+		}
+	}()
+}
+
+// readPauseSignal reads the pause signal and sets a watch on its creation, change and deletion
+func (p *participant) readPauseSignal() (<-chan zk.Event, error) {
+	path := p.keyBuilder.pause()
+	exists, eventCh, err := p.zkClient.ExistsW(path)
+	if err != nil {
+		return nil, err
+	}
+	var signal *model.PauseSignal
+	if exists {
+		record, err := p.zkClient.GetRecordFromPath(path)
+		if err == nil {
+			signal = &model.PauseSignal{ZNRecord: *record}
+		} else if errors.Cause(err) != zk.ErrNoNode {
+			return nil, err
+		}
+	}
+	p.setPauseSignal(signal)
+	return eventCh, nil
+}
+
+// setPauseSignal sets the pause signal and notifies the listeners, the held messages are
+// listed again once partitions may have been unfrozen
+func (p *participant) setPauseSignal(signal *model.PauseSignal) {
+	p.freezeNotifyMu.Lock()
+	defer p.freezeNotifyMu.Unlock()
+	p.freezeMu.Lock()
+	previous := p.pauseSignal
+	p.pauseSignal = signal
+	p.freezeMu.Unlock()
+
+	if signal != nil {
+		p.logger.Info("partitions frozen", util.Field("reason", signal.GetReason()),
+			util.Field("clusterFreeze", signal.IsClusterFreeze()), util.Field("resources", signal.GetFrozenResources()))
+		p.scope.Gauge("frozen").Update(1)
+		for _, listener := range p.freezeListeners {
+			p.safeCall(Crash{Callback: CallbackFreezeListener}, func() error {
+				listener.OnFreeze(signal)
+				return nil
+			})
+		}
+	} else if previous != nil {
+		p.logger.Info("partitions unfrozen")
+		p.scope.Gauge("frozen").Update(0)
+		for _, listener := range p.freezeListeners {
+			p.safeCall(Crash{Callback: CallbackFreezeListener}, func() error {
+				listener.OnUnfreeze()
+				return nil
+			})
+		}
+	}
+	if previous != nil {
+		p.messageWatchMu.Lock()
+		if p.messageWatch != nil {
+			p.messageWatch.rearm()
+		}
+		p.messageWatchMu.Unlock()
+	}
+}
+
+// isFrozen returns whether the partition of the message is frozen
+func (p *participant) isFrozen(msg *model.Message) bool {
+	p.freezeMu.RLock()
+	defer p.freezeMu.RUnlock()
+	if p.pauseSignal == nil {
+		return false
+	}
+	partition, _ := msg.GetPartitionName()
+	return p.pauseSignal.IsFrozen(msg.GetResourceName(), partition)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type testFreezeListener chan string
+
+func (l testFreezeListener) OnFreeze(signal *model.PauseSignal) {
+	l <- fmt.Sprintf("freeze %s %v %v", signal.GetReason(), signal.IsClusterFreeze(), signal.GetFrozenResources())
+}
+
+func (l testFreezeListener) OnUnfreeze() {
+	l <- "unfreeze"
+}
+
+func TestParticipantFreeze(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	admin, accessor := cluster.admin, cluster.accessor
+	assert.NoError(t, admin.FreezePartitions(TestClusterName, "r1", []string{"r1_0"}, "upgrade"))
+
+	// the listener gets the freezes and the assignments in order
+	listener := make(chan string, 10)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithFreezeListener(testFreezeListener(listener)),
+		WithPartitionAssignmentListener(testAssignmentListener(listener)),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	sessionID := p.(*participant).zkClient.GetSessionID()
+
+	transition := func(partition string, fromState string, toState string) {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetStateModelDef(StateModelNameOnlineOffline)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetFromState(fromState)
+		msg.SetToState(toState)
+		msg.SetMsgState(model.MessageStateNew)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+	}
+	receive := func() string {
+		select {
+		case e := <-listener:
+			return e
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no freeze or assignment notified")
+			return ""
+		}
+	}
+	assertNothingReceived := func() {
+		select {
+		case e := <-listener:
+			assert.Fail(t, "unexpected notification", e)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	assert.Equal(t, "freeze upgrade false [r1]", receive())
+	// the transition of the frozen partition is held, the others are handled
+	transition("r1_0", StateModelStateOffline, StateModelStateOnline)
+	transition("r1_1", StateModelStateOffline, StateModelStateOnline)
+	assert.Equal(t, "assigned r1 r1_1 ONLINE", receive())
+	assertNothingReceived()
+
+	// the held transition is handled once the partition is unfrozen
+	assert.NoError(t, admin.UnfreezePartitions(TestClusterName, "r1", []string{"r1_0"}))
+	assert.Equal(t, "unfreeze", receive())
+	assert.Equal(t, "assigned r1 r1_0 ONLINE", receive())
+	signal, err := admin.GetPauseSignal(TestClusterName)
+	assert.NoError(t, err)
+	assert.Nil(t, signal)
+
+	// the cluster freeze holds all the transitions
+	assert.NoError(t, admin.FreezeCluster(TestClusterName, "maintenance"))
+	assert.Equal(t, "freeze maintenance true []", receive())
+	transition("r1_1", StateModelStateOnline, StateModelStateOffline)
+	assertNothingReceived()
+	assert.NoError(t, admin.UnfreezeCluster(TestClusterName))
+	assert.Equal(t, "unfreeze", receive())
+	assert.Equal(t, "removed r1 r1_1", receive())
+}
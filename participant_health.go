@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStuckTransitionThreshold is the default duration of a message handling after which
+// the participant is reported unhealthy
+const DefaultStuckTransitionThreshold = 10 * time.Minute
+
+// WithStuckTransitionThreshold sets the duration of a message handling, e.g. a state transition,
+// after which the participant is reported unhealthy by Healthy, DefaultStuckTransitionThreshold by default
+func WithStuckTransitionThreshold(threshold time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.stuckThreshold = threshold
+	}
+}
+
+// Healthy returns an error if a message, e.g. a state transition, has been handled for longer
+// than the stuck transition threshold, for a liveness probe: restarting the process is the only
+// way to release the partition of a stuck handler. The ZK session is not checked, since
+// restarting does not help during a ZK outage
+func (p *participant) Healthy() error {
+	now := p.clock.Now()
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	for id, start := range p.inflightStarts {
+		if elapsed := now.Sub(start); elapsed > p.stuckThreshold {
+			return errors.Errorf("helix participant: message %s handled for %v", id, elapsed)
+		}
+	}
+	return nil
+}
+
+// Ready returns an error unless the ZK session is alive, the live instance of the session is
+// present, so the controller assigns partitions to the participant, and the participant is healthy,
+// for a readiness probe
+func (p *participant) Ready() error {
+	if !p.IsConnected() {
+		return errors.Wrap(ErrNotConnected, "helix participant")
+	}
+	if p.liveInstanceGuard == nil || !p.liveInstanceGuard.IsHeld() {
+		return errors.Errorf("helix participant: live instance %s is not present", p.instanceName)
+	}
+	return p.Healthy()
+}
+
+// HealthHandler serves the probes of the participant, e.g. for the liveness and readiness probes
+// of Kubernetes:
+//
+//	GET /healthz  200 if Healthy returns nil, 503 with the error otherwise
+//	GET /readyz   200 if Ready returns nil, 503 with the error otherwise
+func HealthHandler(participant Participant) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", probeHandler(participant.Healthy))
+	mux.Handle("/readyz", probeHandler(participant.Ready))
+	return mux
+}
+
+func probeHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantHealth(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		"localhost", 1, WithParticipantClock(clock), WithStuckTransitionThreshold(time.Minute),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	server := httptest.NewServer(HealthHandler(p))
+	defer server.Close()
+	probe := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// alive but not ready before joining the cluster
+	assert.NoError(t, p.Healthy())
+	assert.Error(t, p.Ready())
+	assert.Equal(t, http.StatusOK, probe("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/readyz"))
+
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	assert.NoError(t, p.Ready())
+	assert.Equal(t, http.StatusOK, probe("/readyz"))
+
+	// a message handled for longer than the threshold
+	pImpl := p.(*participant)
+	pImpl.statsMu.Lock()
+	pImpl.inflightStarts["m1"] = clock.Now()
+	pImpl.statsMu.Unlock()
+	clock.Advance(time.Minute)
+	assert.NoError(t, p.Healthy())
+	clock.Advance(time.Second)
+	assert.Error(t, p.Healthy())
+	assert.Error(t, p.Ready())
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/readyz"))
+
+	pImpl.statsMu.Lock()
+	delete(pImpl.inflightStarts, "m1")
+	pImpl.statsMu.Unlock()
+	assert.Equal(t, http.StatusOK, probe("/healthz"))
+	assert.Equal(t, http.StatusOK, probe("/readyz"))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"time"
+
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// recordSessionHistory adds the new session to the history of the participant,
+// the failures are logged as the history is only used to audit the sessions
+func (p *participant) recordSessionHistory() {
+	sessionID := p.zkClient.GetSessionID()
+	err := p.dataAccessor.updateData(p.keyBuilder.participantHistory(p.instanceName),
+		func(record *model.ZNRecord) (*model.ZNRecord, error) {
+			history := model.NewParticipantHistory(p.instanceName)
+			if record != nil {
+				history.ZNRecord = *record
+			}
+			history.ReportOnline(sessionID, p.host, time.Now())
+			return &history.ZNRecord, nil
+		})
+	if err != nil {
+		p.scope.Counter("session-history-failures").Inc(1)
+		p.logger.Warn("failed to record the session history", util.Field("sessionID", sessionID), util.ErrorField(err))
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantHistory(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, admin := cluster.client, cluster.admin
+	instance := getInstanceName(testParticipantHost, 1)
+	assert.NoError(t, admin.AddNode(TestClusterName, instance))
+	accessor := newDataAccessor(client, &KeyBuilder{TestClusterName})
+
+	var sessions []string
+	for i := 0; i < 2; i++ {
+		p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName,
+			TestResource, testParticipantHost, 1,
+			WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+		assert.NoError(t, p.Connect())
+		sessions = append(sessions, p.(*participant).zkClient.GetSessionID())
+		p.Disconnect()
+	}
+	history, err := accessor.ParticipantHistory(instance)
+	assert.NoError(t, err)
+	entries := history.GetSessionHistory()
+	assert.Len(t, entries, 2)
+	for i, entry := range entries {
+		assert.Equal(t, sessions[i], entry.SessionID)
+		assert.Equal(t, testParticipantHost, entry.Host)
+		assert.NotEmpty(t, entry.Version)
+		assert.WithinDuration(t, time.Now(), entry.StartTime, time.Minute)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// PodNameEnv is the environment variable of the pod name read by PodInstanceName, set with the
+// downward API of Kubernetes
+const PodNameEnv = "POD_NAME"
+
+// InstanceNameStrategy derives the name of the instance of a participant from its host and port,
+// the name must stay in the host_port form
+type InstanceNameStrategy func(host string, port int32) (string, error)
+
+// HostPortInstanceName names the instance host_port, the default strategy
+func HostPortInstanceName(host string, port int32) (string, error) {
+	return model.InstanceName(host, int(port)), nil
+}
+
+// HostnameInstanceName names the instance after the hostname of the machine, ignoring the host
+func HostnameInstanceName(_ string, port int32) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to derive the instance name from the hostname")
+	}
+	return model.InstanceName(hostname, int(port)), nil
+}
+
+// PodInstanceName names the instance after the Kubernetes pod of the participant, read from the
+// PodNameEnv variable, so a pod of a StatefulSet keeps its instance name when it is rescheduled
+func PodInstanceName(_ string, port int32) (string, error) {
+	pod := os.Getenv(PodNameEnv)
+	if pod == "" {
+		return "", errors.Errorf("failed to derive the instance name: %s is not set", PodNameEnv)
+	}
+	return model.InstanceName(pod, int(port)), nil
+}
+
+// WithInstanceNameStrategy sets how the instance name is derived, HostPortInstanceName by default.
+// Connect fails if the strategy fails
+func WithInstanceNameStrategy(strategy InstanceNameStrategy) ParticipantOption {
+	return func(p *participant) {
+		p.instanceNameStrategy = strategy
+	}
+}
+
+// checkLiveInstanceOwner returns ErrInstanceNameCollision if the live instance is owned by a process
+// of another host. A previous process of the same host, e.g. before a restart, is waited for since its
+// session times out
+func (p *participant) checkLiveInstanceOwner() error {
+	owner, err := p.dataAccessor.LiveInstance(p.instanceName)
+	if err != nil {
+		// the owner cannot be told, e.g. the live instance was deleted meanwhile
+		p.logger.Warn("failed to read the owner of the live instance", util.ErrorField(err))
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil
+	}
+	process := owner.GetProcess()
+	if i := strings.LastIndex(process, "@"); i >= 0 && process[i+1:] != hostname {
+		return p.instanceNameCollision()
+	}
+	return nil
+}
+
+// instanceNameCollision reports the collision with the current owner of the live instance
+func (p *participant) instanceNameCollision() error {
+	p.scope.Counter("instance-name-collisions").Inc(1)
+	owner, err := p.dataAccessor.LiveInstance(p.instanceName)
+	if err != nil {
+		return errors.Wrapf(ErrInstanceNameCollision, "instance %s", p.instanceName)
+	}
+	return errors.Wrapf(ErrInstanceNameCollision, "instance %s is owned by session %s of %s",
+		p.instanceName, owner.GetSessionID(), owner.GetProcess())
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestInstanceNameStrategy(t *testing.T) {
+	name, err := HostPortInstanceName("::1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "::1_1", name)
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+	name, err = HostnameInstanceName("localhost", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, hostname+"_1", name)
+
+	os.Unsetenv(PodNameEnv)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		"localhost", 1, WithInstanceNameStrategy(PodInstanceName))
+	assert.Error(t, p.Connect())
+	os.Setenv(PodNameEnv, "db-0")
+	defer os.Unsetenv(PodNameEnv)
+	p, _ = NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		"localhost", 1, WithInstanceNameStrategy(PodInstanceName))
+	assert.Equal(t, "db-0_1", p.InstanceName())
+}
+
+func TestInstanceNameCollision(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	client := cluster.client
+	// the live instance of a process of another host
+	liveInstance := model.NewLiveInstance("localhost_1", client.GetSessionID())
+	liveInstance.SetSimpleField(model.FieldKeyLiveInstance, "1@other-host")
+	data, err := liveInstance.Marshal()
+	assert.NoError(t, err)
+	assert.NoError(t, client.Create((&KeyBuilder{TestClusterName}).liveInstance("localhost_1"), data,
+		uzk.FlagsEphemeral, uzk.ACLPermAll))
+
+	scope := tally.NewTestScope("", nil)
+	p, _ := NewParticipant(zap.NewNop(), scope, "", testApplication, TestClusterName, TestResource,
+		"localhost", 1, WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	start := time.Now()
+	err = p.Connect()
+	assert.Equal(t, ErrInstanceNameCollision, errors.Cause(err))
+	assert.Contains(t, err.Error(), "1@other-host")
+	// the collision fails fast instead of waiting for the session timeout
+	assert.True(t, time.Since(start) < uzk.DefaultSessionTimeout)
+	var collisions int64
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.participant.instance-name-collisions" {
+			collisions += counter.Value()
+		}
+	}
+	assert.Equal(t, int64(1), collisions)
+}
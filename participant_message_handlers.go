@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"strings"
+
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// MessageHandler handles a message of a user defined type, e.g. sent by the ClusterMessagingService
+// of a Java service. The result and the error are sent back in the reply to the messages with
+// a correlation ID
+type MessageHandler func(ctx context.Context, msg *model.Message) (result map[string]string, err error)
+
+// RegisterMessageHandler handles the messages of the type with the handler instead of a state model,
+// the types are case insensitive. The handler also executes the scheduled tasks of the type, the
+// SchedulerTaskQueue state model is registered with the first handler. Mirrors registering
+// a MessageHandlerFactory in Java
+func (p *participant) RegisterMessageHandler(msgType string, handler MessageHandler) {
+	p.msgHandlersMu.Lock()
+	defer p.msgHandlersMu.Unlock()
+	if len(p.msgHandlers) == 0 {
+		if _, ok := p.stateModelRegistry.lookup(StateModelNameSchedulerTaskQueue, StateModelFactoryNameDefault); !ok {
+			p.RegisterStateModel(StateModelNameSchedulerTaskQueue, p.scheduledTaskProcessor())
+		}
+	}
+	p.msgHandlers[strings.ToUpper(msgType)] = handler
+}
+
+func (p *participant) messageHandler(msgType string) (MessageHandler, bool) {
+	p.msgHandlersMu.RLock()
+	defer p.msgHandlersMu.RUnlock()
+	handler, ok := p.msgHandlers[strings.ToUpper(msgType)]
+	return handler, ok
+}
+
+// handleUserMsg handles the message with its handler, deletes it and replies to the sender if
+// the message has a correlation ID, mirroring HelixTask#call
+func (p *participant) handleUserMsg(msg *model.Message, handler MessageHandler) error {
+	ctx, span := p.startMsgSpan(context.Background(), "helix.handle_message", msg)
+	var result map[string]string
+	err := p.safeCall(msgCrash(CallbackMessageHandler, msg), func() error {
+		var err error
+		result, err = handler(ctx, msg)
+		return err
+	})
+	// the span also covers the deletion and the reply
+	defer endSpan(span, err)
+	if err != nil {
+		p.msgLogger(msg).Warn("failed to handle message", util.ErrorField(err))
+	}
+
+	msgPath := p.keyBuilder.participantMsg(p.instanceName, msg.ID)
+	if deleteErr := p.zkClient.DeleteTreeContext(ctx, msgPath); deleteErr != nil {
+		p.msgLogger(msg).Error("failed to delete msg after handling", util.ErrorField(deleteErr))
+	}
+	// the replies are never replied to
+	if msg.GetCorrelationID() != "" && !strings.EqualFold(msg.GetMsgType(), model.MsgTypeTaskReply) &&
+		msg.GetSrcName() != p.instanceName {
+		p.sendReply(ctx, msg, result, err)
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantMessageHandlerReply(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1", "java_1")
+	defer cluster.close()
+	client, keyBuilder, accessor := cluster.client, cluster.keyBuilder, cluster.accessor
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1,
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	p.RegisterMessageHandler("user_define_msg", func(ctx context.Context, msg *model.Message) (map[string]string, error) {
+		if msg.GetSrcInstanceType() == "CONTROLLER" {
+			return nil, errors.New("unsupported")
+		}
+		return map[string]string{"ANSWER": "42"}, nil
+	})
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+
+	send := func(srcName, srcInstanceType string) *model.Message {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType("USER_DEFINE_MSG")
+		msg.SetTargetSessionID(p.(*participant).zkClient.GetSessionID())
+		msg.SetMsgState(model.MessageStateNew)
+		msg.SetCorrelationID(CreateRandomString())
+		msg.SetSrcName(srcName)
+		msg.SetSimpleField(model.FieldKeySrcInstanceType, srcInstanceType)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+		return msg
+	}
+	receiveReply := func(path string) *model.Message {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			records, err := accessor.childRecords(path)
+			assert.NoError(t, err)
+			for _, record := range records {
+				return &model.Message{ZNRecord: *record}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.FailNow(t, "no reply received", path)
+		return nil
+	}
+
+	// the reply to a participant carries the result of the handler
+	msg := send("java_1", "PARTICIPANT")
+	reply := receiveReply(keyBuilder.participantMessages("java_1"))
+	assert.Equal(t, model.MsgTypeTaskReply, reply.GetMsgType())
+	assert.Equal(t, msg.GetCorrelationID(), reply.GetCorrelationID())
+	assert.Equal(t, p.InstanceName(), reply.GetSrcName())
+	assert.Equal(t, "PARTICIPANT", reply.GetSrcInstanceType())
+	assert.Equal(t, map[string]string{"ANSWER": "42", "SUCCESS": "true", "INTERRUPTED": "false"},
+		reply.GetMessageResult())
+	exists, _, err := client.Exists(keyBuilder.participantMsg(p.InstanceName(), msg.ID))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// the reply to the controller carries the error
+	msg = send("controller", "CONTROLLER")
+	reply = receiveReply(keyBuilder.controllerMessages())
+	assert.Equal(t, msg.GetCorrelationID(), reply.GetCorrelationID())
+	assert.Equal(t, map[string]string{"SUCCESS": "false", "INTERRUPTED": "false", "ERRORINFO": "unsupported"},
+		reply.GetMessageResult())
+}
+
+func TestParticipantSkipsInvalidMessages(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	accessor := cluster.accessor
+
+	scope := tally.NewTestScope("", nil)
+	p, _ := NewParticipant(zap.NewNop(), scope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithParticipantStrictValidation(),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	handled := make(chan string, 1)
+	p.RegisterMessageHandler("USER_DEFINE_MSG", func(ctx context.Context, msg *model.Message) (map[string]string, error) {
+		handled <- msg.ID
+		return nil, nil
+	})
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+
+	// the state transition without its target state is skipped
+	invalid := model.NewMsg("invalid")
+	invalid.SetMsgType(MsgTypeStateTransition)
+	invalid.SetTargetSessionID(p.(*participant).zkClient.GetSessionID())
+	invalid.SetMsgState(model.MessageStateNew)
+	assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), invalid))
+	valid := model.NewMsg("valid")
+	valid.SetMsgType("USER_DEFINE_MSG")
+	valid.SetTargetSessionID(p.(*participant).zkClient.GetSessionID())
+	valid.SetMsgState(model.MessageStateNew)
+	assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), valid))
+	select {
+	case id := <-handled:
+		assert.Equal(t, "valid", id)
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "valid message not handled")
+	}
+	var skipped int64
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.participant.invalid-messages" {
+			skipped += counter.Value()
+		}
+	}
+	assert.True(t, skipped > 0)
+}
+
+func TestParticipantConnectAfterShutdown(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	fakeZK, client, accessor := cluster.zk, cluster.client, cluster.accessor
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1,
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	handled := make(chan string, 1)
+	p.RegisterMessageHandler("user_define_msg", func(ctx context.Context, msg *model.Message) (map[string]string, error) {
+		handled <- msg.ID
+		return nil, nil
+	})
+	assert.NoError(t, p.Connect())
+	assert.NoError(t, p.Shutdown(context.Background()))
+	// the fake connections keep their state once closed
+	for _, conn := range fakeZK.GetConnections() {
+		if strconv.FormatInt(conn.SessionID(), 10) != client.GetSessionID() {
+			fakeZK.SetState(conn, zk.StateDisconnected)
+		}
+	}
+	assert.False(t, p.IsConnected())
+
+	// the messages are processed again once the participant joins the cluster again
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	msg := model.NewMsg(CreateRandomString())
+	msg.SetMsgType("USER_DEFINE_MSG")
+	msg.SetTargetSessionID(p.(*participant).zkClient.GetSessionID())
+	msg.SetMsgState(model.MessageStateNew)
+	assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+	select {
+	case id := <-handled:
+		assert.Equal(t, msg.ID, id)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "message not processed after the participant connected again")
+	}
+}
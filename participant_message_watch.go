@@ -0,0 +1,184 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+)
+
+const (
+	_defaultMessageReconcileInterval = 30 * time.Second
+	// _messagePollBackoffFactor is the ratio of the reconcile interval to the interval the messages
+	// are polled at right after the message watch is found lost
+	_messagePollBackoffFactor = 16
+)
+
+// WithMessageReconcileInterval sets the interval the messages of the participant are listed at to check
+// the message watch, 30 seconds by default. A message left undelivered by the watch over an interval
+// means the watch was lost: the watch is re-armed and the messages are polled at a shorter interval,
+// backing off to the reconcile interval while the watch delivers the messages again.
+// A non-positive interval disables the reconciliation
+func WithMessageReconcileInterval(interval time.Duration) ParticipantOption {
+	return func(p *participant) {
+		p.messageReconcileInterval = interval
+	}
+}
+
+// messageWatch is the watch of the messages of a session, it tracks the messages the watch delivered
+// so the reconciliation can tell when the watch is lost
+type messageWatch struct {
+	mu        sync.Mutex
+	delivered util.StringSet
+	// rearmCh re-lists the messages and sets the watch again, quitCh stops the watch
+	rearmCh  chan struct{}
+	quitCh   chan struct{}
+	quitOnce sync.Once
+}
+
+func newMessageWatch() *messageWatch {
+	return &messageWatch{
+		delivered: util.NewStringSet(),
+		rearmCh:   make(chan struct{}, 1),
+		quitCh:    make(chan struct{}),
+	}
+}
+
+func (w *messageWatch) setDelivered(msgIDs []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.delivered = util.NewStringSet(msgIDs...)
+}
+
+func (w *messageWatch) undelivered(msgIDs []string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var result []string
+	for _, msgID := range msgIDs {
+		if !w.delivered.Contains(msgID) {
+			result = append(result, msgID)
+		}
+	}
+	return result
+}
+
+func (w *messageWatch) rearm() {
+	select {
+	case w.rearmCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *messageWatch) quit() {
+	w.quitOnce.Do(func() {
+		close(w.quitCh)
+	})
+}
+
+// startMessageWatch replaces the message watch of the previous session, if any
+func (p *participant) startMessageWatch() *messageWatch {
+	watch := newMessageWatch()
+	p.messageWatchMu.Lock()
+	defer p.messageWatchMu.Unlock()
+	if p.messageWatch != nil {
+		p.messageWatch.quit()
+	}
+	p.messageWatch = watch
+	return watch
+}
+
+func (p *participant) stopMessageWatch() {
+	p.messageWatchMu.Lock()
+	defer p.messageWatchMu.Unlock()
+	if p.messageWatch != nil {
+		p.messageWatch.quit()
+		p.messageWatch = nil
+	}
+}
+
+// awaitMessageWatch waits for the message watch to fire like awaitWatch, it returns ok false
+// if the watch is to be re-armed, and quit true if the watch is stopped
+func (p *participant) awaitMessageWatch(
+	eventCh <-chan zk.Event, watch *messageWatch) (ev zk.Event, ok bool, quit bool) {
+	atomic.AddInt64(&p.activeWatches, 1)
+	defer atomic.AddInt64(&p.activeWatches, -1)
+	select {
+	case ev, ok = <-eventCh:
+		return ev, ok, false
+	case <-watch.rearmCh:
+		return zk.Event{}, false, false
+	case <-watch.quitCh:
+		return zk.Event{}, false, true
+	}
+}
+
+// reconcileMessages lists the messages periodically and re-arms the message watch if it is lost
+func (p *participant) reconcileMessages(watch *messageWatch, stopCh <-chan struct{}) {
+	path := p.keyBuilder.participantMessages(p.instanceName)
+	minInterval := p.messageReconcileInterval / _messagePollBackoffFactor
+	interval := p.messageReconcileInterval
+	suspects := util.NewStringSet()
+	for {
+		select {
+		case <-p.clock.After(interval):
+		case <-stopCh:
+			return
+		case <-watch.quitCh:
+			return
+		}
+		msgIDs, err := p.zkClient.Children(path)
+		if err != nil {
+			p.logger.Warn("failed to list messages to reconcile", util.ErrorField(err))
+			continue
+		}
+		// the messages are delivered on the next poll once polling, otherwise a message has to be
+		// left undelivered over an interval as the watch may be about to fire
+		polling := interval < p.messageReconcileInterval
+		undelivered := watch.undelivered(msgIDs)
+		lost := false
+		for _, msgID := range undelivered {
+			if polling || suspects.Contains(msgID) {
+				lost = true
+			}
+		}
+		suspects = util.NewStringSet(undelivered...)
+		if lost {
+			if !polling {
+				p.logger.Warn("message watch lost, polling messages", util.Field("undelivered", undelivered))
+				p.scope.Counter("message-watch-lost").Inc(1)
+			}
+			p.scope.Counter("message-polls").Inc(1)
+			interval = minInterval
+			watch.rearm()
+			continue
+		}
+		if polling {
+			interval *= 2
+			if interval > p.messageReconcileInterval {
+				interval = p.messageReconcileInterval
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestMessageWatchLost(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, client, admin := cluster.zk, cluster.client, cluster.admin
+	assert.NoError(t, admin.SetConfig(TestClusterName, "CLUSTER", map[string]string{
+		_allowParticipantAutoJoinKey: "true",
+	}))
+
+	for _, droppedWatchRate := range []float64{0, 1} {
+		scope := tally.NewTestScope("", nil)
+		factory := uzk.NewFaultConnFactory(fakeZK, uzk.WithDroppedWatchRate(droppedWatchRate))
+		p, _ := NewParticipant(zap.NewNop(), scope, "", testApplication, TestClusterName, TestResource,
+			testParticipantHost, GetRandomPort(), WithMessageReconcileInterval(80*time.Millisecond),
+			WithParticipantZkClientOptions(uzk.WithConnFactory(factory), uzk.WithRetryTimeout(time.Second)))
+		assert.NoError(t, p.Connect())
+
+		// the participant deletes the NO-OP messages it receives
+		for i := 0; i < 3; i++ {
+			msg := model.NewMsg(util.NewUUID())
+			msg.SetMsgType(MsgTypeNoop)
+			assert.NoError(t, admin.SendMessage(TestClusterName, p.InstanceName(), msg))
+			path := (&KeyBuilder{TestClusterName}).participantMsg(p.InstanceName(), msg.ID)
+			deleted := false
+			for start := time.Now(); !deleted && time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+				exists, _, err := client.Exists(path)
+				assert.NoError(t, err)
+				deleted = !exists
+			}
+			assert.True(t, deleted)
+		}
+
+		lost := int64(0)
+		for _, counter := range scope.Snapshot().Counters() {
+			if counter.Name() == "helix.participant.message-watch-lost" {
+				lost += counter.Value()
+			}
+		}
+		assert.Equal(t, droppedWatchRate > 0, lost > 0)
+		p.Disconnect()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// scheduledTaskProcessor executes the scheduled tasks on the transitions of the SchedulerTaskQueue
+// state model. Mirrors org.apache.helix.messaging.handling.ScheduledTaskStateModel
+func (p *participant) scheduledTaskProcessor() *StateModelProcessor {
+	processor := NewStateModelProcessor()
+	processor.AddContextTransition(StateModelStateOffline, StateModelStateCompleted, p.executeScheduledTask)
+	noop := func(*model.Message) error { return nil }
+	processor.AddTransition(StateModelStateOffline, StateModelStateDropped, noop)
+	processor.AddTransition(StateModelStateCompleted, StateModelStateDropped, noop)
+	return processor
+}
+
+// executeScheduledTask executes the task message carried by the transition with the message handler
+// of its type. A failed task puts its partition in ERROR state, and the result is replied to the
+// sender of the task if it has a correlation ID
+func (p *participant) executeScheduledTask(ctx context.Context, msg *model.Message) error {
+	task, ok := msg.GetInnerMessage()
+	if !ok {
+		partition, _ := msg.GetPartitionName()
+		return errors.Errorf("scheduled task %s carries no task message", partition)
+	}
+	handler, ok := p.messageHandler(task.GetMsgType())
+	if !ok {
+		return errors.Errorf("no message handler registered for the scheduled task %s of type %s",
+			task.ID, task.GetMsgType())
+	}
+	scope := p.scope.Tagged(map[string]string{"type": task.GetMsgType()})
+	scope.Counter("scheduled-tasks").Inc(1)
+	result, err := handler(ctx, task)
+	if err != nil {
+		scope.Counter("scheduled-task-failures").Inc(1)
+		p.logger.Warn("scheduled task failed", util.Field("task", task.ID), util.ErrorField(err))
+	}
+	if task.GetCorrelationID() != "" && task.GetSrcName() != p.instanceName {
+		p.sendReply(ctx, task, result, err)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestScheduledTasks(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	admin, keyBuilder, accessor := cluster.admin, cluster.keyBuilder, cluster.accessor
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_1"))
+	assert.NoError(t, admin.AddNode(TestClusterName, "java_1"))
+
+	executed := make(chan string, 10)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1,
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterMessageHandler("COMPACTION", func(ctx context.Context, msg *model.Message) (map[string]string, error) {
+		executed <- msg.ID
+		if msg.GetStringField("TABLE", "") == "" {
+			return nil, errors.New("no table")
+		}
+		return map[string]string{"COMPACTED": msg.GetStringField("TABLE", "")}, nil
+	})
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	controller := NewController(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithRebalanceInterval(20*time.Millisecond),
+		WithControllerZkClientOptions(cluster.zkClientOptions()...))
+	assert.NoError(t, controller.Start())
+	defer controller.Disconnect()
+
+	taskStates := func(expected map[string]map[string]string) {
+		var actual map[string]map[string]string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			views, err := accessor.ExternalViews()
+			assert.NoError(t, err)
+			actual = map[string]map[string]string{}
+			if view, ok := views[StateModelNameSchedulerTaskQueue]; ok {
+				actual = view.MapFields
+			}
+			if assert.ObjectsAreEqual(expected, actual) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.FailNow(t, "scheduled tasks not converged", "expected %v, actual %v", expected, actual)
+	}
+
+	task := model.NewMsg("compact_users")
+	task.SetMsgType("COMPACTION")
+	task.SetSimpleField("TABLE", "users")
+	task.SetCorrelationID("correlation")
+	task.SetSrcName("java_1")
+	task.SetSrcInstanceType("PARTICIPANT")
+	assert.NoError(t, admin.ScheduleTask(TestClusterName, p.InstanceName(), task))
+	invalid := model.NewMsg("compact_nothing")
+	invalid.SetMsgType("COMPACTION")
+	assert.NoError(t, admin.ScheduleTask(TestClusterName, p.InstanceName(), invalid))
+	assert.Error(t, admin.ScheduleTask(TestClusterName, p.InstanceName(), model.NewMsg("untyped")))
+	taskStates(map[string]map[string]string{
+		"compact_users":   {p.InstanceName(): StateModelStateCompleted},
+		"compact_nothing": {p.InstanceName(): StateModelStateError},
+	})
+
+	// the sender of the task receives its result
+	var replies map[string]*model.ZNRecord
+	for deadline := time.Now().Add(5 * time.Second); len(replies) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		replies, err = accessor.childRecords(keyBuilder.participantMessages("java_1"))
+		assert.NoError(t, err)
+	}
+	assert.Len(t, replies, 1)
+	for _, record := range replies {
+		reply := &model.Message{ZNRecord: *record}
+		assert.Equal(t, "correlation", reply.GetCorrelationID())
+		assert.Equal(t, map[string]string{"COMPACTED": "users", "SUCCESS": "true", "INTERRUPTED": "false"},
+			reply.GetMessageResult())
+	}
+
+	// the completed task is executed once and dropped once removed
+	assert.NoError(t, admin.RemoveScheduledTask(TestClusterName, "compact_users"))
+	taskStates(map[string]map[string]string{
+		"compact_nothing": {p.InstanceName(): StateModelStateError},
+	})
+	assert.Len(t, executed, 2)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/util"
+)
+
+// connectShared joins the cluster over the shared ZK client, acquired until Disconnect
+func (p *participant) connectShared() error {
+	if p.IsConnected() {
+		return nil
+	}
+	if err := p.zkClient.Acquire(); err != nil {
+		return errors.Wrap(err, "helix participant")
+	}
+	p.liveInstanceGuard = p.newLiveInstanceGuard()
+	if err := p.handleNewSession(); err != nil {
+		p.liveInstanceGuard.Stop()
+		p.zkClient.Release()
+		return errors.Wrap(err, "helix participant")
+	}
+	atomic.StoreInt32(&p.joined, 1)
+	// the next sessions of the client are handled like the sessions of a dedicated client
+	p.zkClient.AddWatcher(p)
+	if err := p.startDebugServer(); err != nil {
+		return errors.Wrap(err, "helix participant")
+	}
+	return nil
+}
+
+// disconnectShared leaves the cluster and releases the shared ZK client, the session outlives the
+// participant so its live instance is deleted instead of expiring with it
+func (p *participant) disconnectShared() {
+	p.zkClient.RemoveWatcher(p)
+	if err := p.liveInstanceGuard.Release(); err != nil {
+		p.logger.Error("failed to remove live instance", util.ErrorField(err))
+	}
+	atomic.StoreInt32(&p.joined, 0)
+	p.zkClient.Release()
+}
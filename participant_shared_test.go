@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestSharedConnection(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, setup := cluster.client, cluster.admin
+	assert.True(t, setup.AddCluster("cluster_a", false))
+	assert.True(t, setup.AddCluster("cluster_b", false))
+	assert.NoError(t, setup.AddNode("cluster_a", "localhost_1"))
+
+	factory := NewManagerFactory(zap.NewNop(), tally.NoopScope, "", WithSharedConnection(),
+		WithManagerZkClientOptions(cluster.zkClientOptions()...))
+	p, _ := factory.NewParticipant(testApplication, "cluster_a", TestResource, "localhost", 1)
+	p.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	spectator := factory.NewSpectator("cluster_b")
+	assert.False(t, p.IsConnected())
+	assert.NoError(t, factory.Connect())
+	admin, err := factory.NewAdmin()
+	assert.NoError(t, err)
+
+	// the managers share one session
+	shared := p.(*participant).zkClient
+	assert.True(t, shared == spectator.zkClient && shared == admin.zkClient)
+	assert.Equal(t, 3, shared.References())
+	assert.True(t, p.IsConnected())
+	liveInstance := (&KeyBuilder{"cluster_a"}).liveInstance("localhost_1")
+	exists, _, err := client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	clusters, err := admin.ListClusters()
+	assert.NoError(t, err)
+	assert.Contains(t, clusters, "cluster_a")
+
+	// the participant leaves the cluster while the session is kept for the others
+	sessionID := shared.GetSessionID()
+	p.Disconnect()
+	assert.False(t, p.IsConnected())
+	assert.Equal(t, 2, shared.References())
+	exists, _, err = client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.NoError(t, p.Connect())
+	assert.Equal(t, sessionID, shared.GetSessionID())
+	exists, _, err = client.Exists(liveInstance)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// the session is closed once the last manager is disconnected
+	factory.Disconnect()
+	assert.Equal(t, 1, shared.References())
+	admin.Close()
+	assert.Equal(t, 0, shared.References())
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"github.com/uber-go/go-helix/model"
+)
+
+// ParticipantStats is a snapshot of the messages handled by the participant,
+// a participant falling behind the controller has queued messages and a saturated executor
+type ParticipantStats struct {
+	// QueuedMessages is the number of messages waiting for a free slot of the executor
+	QueuedMessages int
+	// InFlightTransitions is the number of messages being handled
+	InFlightTransitions int
+	// InFlightByTargetState is the number of messages being handled by target state
+	InFlightByTargetState map[string]int
+	// MaxConcurrentMessages is the size of the executor, 0 if unbounded
+	MaxConcurrentMessages int
+	// Saturation is the fraction of the slots of the executor in use, 0 if unbounded
+	Saturation float64
+}
+
+// WithMaxConcurrentMessages bounds the number of messages handled concurrently,
+// the other messages are queued until a slot of the executor is free. Unbounded by default
+func WithMaxConcurrentMessages(max int) ParticipantOption {
+	return func(p *participant) {
+		p.maxConcurrentMessages = max
+	}
+}
+
+// Stats returns a snapshot of the messages handled by the participant,
+// the same data is published by the queued-messages, inflight-transitions and executor-saturation gauges
+func (p *participant) Stats() ParticipantStats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	return p.statsLocked()
+}
+
+func (p *participant) statsLocked() ParticipantStats {
+	stats := ParticipantStats{
+		QueuedMessages:        p.queuedMessages,
+		InFlightByTargetState: make(map[string]int, len(p.inflightByState)),
+		MaxConcurrentMessages: p.maxConcurrentMessages,
+	}
+	for state, count := range p.inflightByState {
+		stats.InFlightTransitions += count
+		stats.InFlightByTargetState[state] = count
+	}
+	if p.maxConcurrentMessages > 0 {
+		stats.Saturation = float64(stats.InFlightTransitions) / float64(p.maxConcurrentMessages)
+	}
+	return stats
+}
+
+// executeMsg handles the message once a slot of the executor is free
+func (p *participant) executeMsg(msg *model.Message) {
+	p.updateStats(func() { p.queuedMessages++ }, "")
+	if p.executorSlots != nil {
+		p.executorSlots <- struct{}{}
+		defer func() { <-p.executorSlots }()
+	}
+	toState := msg.GetToState()
+	p.updateStats(func() {
+		p.queuedMessages--
+		p.inflightByState[toState]++
+		p.inflightStarts[msg.ID] = p.clock.Now()
+	}, toState)
+	defer p.updateStats(func() {
+		if p.inflightByState[toState]--; p.inflightByState[toState] == 0 {
+			delete(p.inflightByState, toState)
+		}
+		delete(p.inflightStarts, msg.ID)
+	}, toState)
+
+	// the panics escaping the handling of the message are recovered as well
+	p.safeCall(msgCrash(CallbackMessageHandler, msg), func() error {
+		return p.handleMsg(msg)
+	})
+}
+
+// updateStats applies the update and publishes the gauges, including the gauge of the target state
+func (p *participant) updateStats(update func(), toState string) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	update()
+	stats := p.statsLocked()
+	p.scope.Gauge("queued-messages").Update(float64(stats.QueuedMessages))
+	p.scope.Gauge("inflight-transitions").Update(float64(stats.InFlightTransitions))
+	p.scope.Gauge("executor-saturation").Update(stats.Saturation)
+	if toState != "" {
+		p.scope.Tagged(map[string]string{"state": toState}).Gauge("inflight-transitions-by-state").
+			Update(float64(stats.InFlightByTargetState[toState]))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestParticipantStats(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	accessor := cluster.accessor
+
+	release := make(chan struct{})
+	processor := createNoopStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		<-release
+		return nil
+	})
+	scope := tally.NewTestScope("", nil)
+	p, _ := NewParticipant(zap.NewNop(), scope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithMaxConcurrentMessages(1),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	p.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	sessionID := p.(*participant).zkClient.GetSessionID()
+	assert.Equal(t, ParticipantStats{InFlightByTargetState: map[string]int{}, MaxConcurrentMessages: 1}, p.Stats())
+
+	for _, partition := range []string{"r1_0", "r1_1"} {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetStateModelDef(StateModelNameOnlineOffline)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName(partition)
+		msg.SetFromState(StateModelStateOffline)
+		msg.SetToState(StateModelStateOnline)
+		msg.SetMsgState(model.MessageStateNew)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+	}
+	waitStats := func(expected ParticipantStats) {
+		var stats ParticipantStats
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			if stats = p.Stats(); assert.ObjectsAreEqual(expected, stats) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, expected, stats)
+	}
+
+	// the second message waits for the executor
+	waitStats(ParticipantStats{
+		QueuedMessages:        1,
+		InFlightTransitions:   1,
+		InFlightByTargetState: map[string]int{StateModelStateOnline: 1},
+		MaxConcurrentMessages: 1,
+		Saturation:            1,
+	})
+	for _, gauge := range scope.Snapshot().Gauges() {
+		switch gauge.Name() {
+		case "helix.participant.queued-messages", "helix.participant.inflight-transitions",
+			"helix.participant.executor-saturation":
+			assert.Equal(t, float64(1), gauge.Value(), gauge.Name())
+		case "helix.participant.inflight-transitions-by-state":
+			assert.Equal(t, StateModelStateOnline, gauge.Tags()["state"])
+			assert.Equal(t, float64(1), gauge.Value())
+		}
+	}
+
+	close(release)
+	waitStats(ParticipantStats{InFlightByTargetState: map[string]int{}, MaxConcurrentMessages: 1})
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+)
+
+// The stages of a transition recorded in the status updates
+const (
+	TransitionStageStart    = "START"
+	TransitionStageProgress = "PROGRESS"
+	TransitionStageEnd      = "END"
+	TransitionStageError    = "ERROR"
+)
+
+// The fields of the status update entries, named after the fields of the Java participant
+const (
+	statusUpdateKeyLevel          = "Level"
+	statusUpdateKeyTime           = "Time"
+	statusUpdateKeyStage          = "Stage"
+	statusUpdateKeyAdditionalInfo = "AdditionalInfo"
+)
+
+// WithStatusUpdates records the stages of the state transitions under
+// INSTANCES/{instance}/STATUSUPDATES like the Java participant, so the Helix tools show the
+// transition logs of the participant. sampleRate is the fraction of the transitions recorded,
+// 1 records all of them and 0, the default, none
+func WithStatusUpdates(sampleRate float64) ParticipantOption {
+	return func(p *participant) {
+		p.statusUpdateSampleRate = sampleRate
+	}
+}
+
+// ReportTransitionProgress records the progress of the transition in its status updates,
+// ctx is the context of a ContextStateTransitionHandler. Nothing is recorded if the status
+// updates are disabled or the transition is not sampled
+func ReportTransitionProgress(ctx context.Context, info string) {
+	status, _ := ctx.Value(transitionStatusKey{}).(*transitionStatus)
+	status.record(TransitionStageProgress, "INFO", info)
+}
+
+type transitionStatusKey struct{}
+
+// transitionStatus records the status updates of a transition, a nil transitionStatus records nothing
+type transitionStatus struct {
+	p   *participant
+	msg *model.Message
+	// path is the status update record of the transition, named like the Java records
+	path string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// newTransitionStatus returns the recorder of the status updates of the transition,
+// nil if the transition is not sampled
+func (p *participant) newTransitionStatus(msg *model.Message) *transitionStatus {
+	if p.statusUpdateSampleRate <= 0 || (p.statusUpdateSampleRate < 1 && rand.Float64() >= p.statusUpdateSampleRate) {
+		return nil
+	}
+	partition, _ := msg.GetPartitionName()
+	recordID := fmt.Sprintf("%s Trans:%s->%s %s", partition, msg.GetFromState(), msg.GetToState(), msg.ID)
+	return &transitionStatus{
+		p:    p,
+		msg:  msg,
+		path: p.keyBuilder.stateTransitionStatus(p.instanceName, p.zkClient.GetSessionID(), msg.GetResourceName(), recordID),
+	}
+}
+
+func withTransitionStatus(ctx context.Context, status *transitionStatus) context.Context {
+	if status == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, transitionStatusKey{}, status)
+}
+
+func (s *transitionStatus) recordStart() {
+	s.record(TransitionStageStart, "INFO", "Message handling task begin execute")
+}
+
+// recordEnd records the result of the transition, the stack trace of the error if it failed
+func (s *transitionStatus) recordEnd(err error) {
+	if err != nil {
+		s.record(TransitionStageError, "ERROR", fmt.Sprintf("Message handling task failed: %+v", err))
+		return
+	}
+	s.record(TransitionStageEnd, "INFO", "Message handling task completed successfully")
+}
+
+// record adds an entry to the status update record of the transition, the failures are
+// logged as the status updates are only used to show the transitions
+func (s *transitionStatus) record(stage string, level string, info string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	now := time.Now()
+	// the keys sort in the order of the updates
+	key := fmt.Sprintf("%04d %s", s.seq, stage)
+	partition, _ := s.msg.GetPartitionName()
+	err := s.p.dataAccessor.updateData(s.path, func(record *model.ZNRecord) (*model.ZNRecord, error) {
+		if record == nil {
+			record = model.NewRecord(s.msg.ID)
+			record.SetSimpleField(model.FieldKeyPartitionName, partition)
+			record.SetSimpleField(model.FieldKeyFromState, s.msg.GetFromState())
+			record.SetSimpleField(model.FieldKeyToState, s.msg.GetToState())
+		}
+		record.SetMapField(key, statusUpdateKeyLevel, level)
+		record.SetMapField(key, statusUpdateKeyTime, strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10))
+		record.SetMapField(key, statusUpdateKeyStage, stage)
+		record.SetMapField(key, statusUpdateKeyAdditionalInfo, info)
+		return record, nil
+	})
+	if err != nil {
+		s.p.scope.Counter("status-update-failures").Inc(1)
+		s.p.logger.Warn("failed to record the status update", util.Field("path", s.path), util.ErrorField(err))
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestStatusUpdates(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	keyBuilder, accessor := cluster.keyBuilder, cluster.accessor
+
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithStatusUpdates(1),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	processor := NewStateModelProcessor()
+	processor.AddContextTransition(StateModelStateOffline, StateModelStateOnline,
+		func(ctx context.Context, msg *model.Message) error {
+			ReportTransitionProgress(ctx, "half way")
+			return nil
+		})
+	processor.AddTransition(StateModelStateOnline, StateModelStateOffline, func(*model.Message) error {
+		return errors.New("failed to go offline")
+	})
+	p.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	assert.NoError(t, p.Connect())
+	defer p.Disconnect()
+	sessionID := p.(*participant).zkClient.GetSessionID()
+
+	// transition sends the transition and returns the status updates recorded for it
+	transition := func(fromState string, toState string) map[string]map[string]string {
+		msg := model.NewMsg(CreateRandomString())
+		msg.SetMsgType(MsgTypeStateTransition)
+		msg.SetStateModelDef(StateModelNameOnlineOffline)
+		msg.SetTargetSessionID(sessionID)
+		msg.SetResourceName("r1")
+		msg.SetPartitionName("r1_0")
+		msg.SetFromState(fromState)
+		msg.SetToState(toState)
+		msg.SetMsgState(model.MessageStateNew)
+		assert.NoError(t, accessor.CreateParticipantMsg(p.InstanceName(), msg))
+		path := keyBuilder.stateTransitionStatus(p.InstanceName(), sessionID, "r1",
+			"r1_0 Trans:"+fromState+"->"+toState+" "+msg.ID)
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			record, err := accessor.record(path)
+			if err != nil {
+				continue
+			}
+			if last := lastStatusUpdate(record.MapFields); strings.HasSuffix(last, TransitionStageEnd) ||
+				strings.HasSuffix(last, TransitionStageError) {
+				assert.Equal(t, "r1_0", record.GetStringField(model.FieldKeyPartitionName, ""))
+				return record.MapFields
+			}
+		}
+		assert.FailNow(t, "no status update recorded", path)
+		return nil
+	}
+
+	updates := transition(StateModelStateOffline, StateModelStateOnline)
+	assert.Len(t, updates, 3)
+	assert.Equal(t, "INFO", updates["0001 START"]["Level"])
+	assert.Equal(t, "half way", updates["0002 PROGRESS"]["AdditionalInfo"])
+	assert.NotEmpty(t, updates["0003 END"]["Time"])
+
+	updates = transition(StateModelStateOnline, StateModelStateOffline)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, "ERROR", updates["0002 ERROR"]["Level"])
+	assert.Contains(t, updates["0002 ERROR"]["AdditionalInfo"], "failed to go offline")
+}
+
+// lastStatusUpdate returns the key of the last status update
+func lastStatusUpdate(updates map[string]map[string]string) string {
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[len(keys)-1]
+}
@@ -21,10 +21,16 @@
 package helix
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,6 +41,9 @@ import (
 	"github.com/uber-go/go-helix/util"
 	uzk "github.com/uber-go/go-helix/zk"
 	"github.com/uber-go/tally"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -43,9 +52,7 @@ type ParticipantTestSuite struct {
 }
 
 func TestParticipantTestSuite(t *testing.T) {
-	s := &ParticipantTestSuite{}
-	s.EmbeddedZkPath = "zk/embedded" // TODO (zhijin): remove when moving to github
-	suite.Run(t, s)
+	suite.Run(t, &ParticipantTestSuite{})
 }
 
 func (s *ParticipantTestSuite) TestConnectAndDisconnect() {
@@ -363,6 +370,172 @@ func (s *ParticipantTestSuite) TestProcessMessages() {
 	s.False(exists)
 }
 
+func (s *ParticipantTestSuite) TestExpiredMessagesDropped() {
+	processor := NewStateModelProcessor()
+	var transitions int32
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		atomic.AddInt32(&transitions, 1)
+		return nil
+	})
+	scope := tally.NewTestScope("", nil)
+	p, _ := NewParticipant(zap.NewNop(), scope, s.ZkConnectString, testApplication, TestClusterName,
+		TestResource, testParticipantHost, GetRandomPort(), WithMessageTTL(time.Minute))
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+
+	msg := s.createMsg(pImpl)
+	msg.SetCreateTime(time.Now().Add(-time.Hour))
+	path := keyBuilder.participantMsg(pImpl.InstanceName(), msg.ID)
+	s.NoError(accessor.createMsg(path, msg))
+	time.Sleep(time.Second)
+	exists, _, err := client.Exists(path)
+	s.NoError(err)
+	s.False(exists)
+	s.Equal(int32(0), atomic.LoadInt32(&transitions))
+	dropped := int64(0)
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.participant.stale-messages" && counter.Tags()["reason"] == "expired" {
+			dropped += counter.Value()
+		}
+	}
+	s.Equal(int64(1), dropped)
+
+	// the expiry period of the message overrides the ttl
+	msg = s.createMsg(pImpl)
+	msg.SetCreateTime(time.Now().Add(-time.Hour))
+	msg.SetExpiryPeriod(2 * time.Hour)
+	s.NoError(accessor.createMsg(keyBuilder.participantMsg(pImpl.InstanceName(), msg.ID), msg))
+	time.Sleep(time.Second)
+	s.Equal(int32(1), atomic.LoadInt32(&transitions))
+}
+
+func (s *ParticipantTestSuite) TestMultipleStateModels() {
+	transitions := make(chan string, 10)
+	onlineOffline := NewStateModelProcessor()
+	onlineOffline.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		transitions <- m.GetResourceName()
+		return nil
+	})
+	customOnlineOffline := NewStateModelProcessor()
+	customOnlineOffline.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		transitions <- "custom:" + m.GetResourceName()
+		return nil
+	})
+	unblock := make(chan struct{})
+	leaderStandby := NewStateModelProcessor()
+	leaderStandby.AddTransition(StateModelStateOffline, StateModelStateStandby, func(m *model.Message) error {
+		// the transitions of the other state models do not wait for this one
+		<-unblock
+		transitions <- m.GetResourceName()
+		return nil
+	})
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication, TestClusterName,
+		TestResource, testParticipantHost, GetRandomPort())
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, onlineOffline)
+	pImpl.RegisterStateModelFactory(StateModelNameOnlineOffline, "custom", customOnlineOffline)
+	pImpl.RegisterStateModel(StateModelNameLeaderStandby, leaderStandby)
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+
+	s.NoError(accessor.CreateParticipantMsg(pImpl.InstanceName(), s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, "leader_standby"),
+		setMsgFieldsOp(model.FieldKeyStateModelDef, StateModelNameLeaderStandby),
+		setMsgFieldsOp(model.FieldKeyToState, StateModelStateStandby),
+	)))
+	s.NoError(accessor.CreateParticipantMsg(pImpl.InstanceName(), s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, "online_offline"),
+	)))
+	s.NoError(accessor.CreateParticipantMsg(pImpl.InstanceName(), s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, "online_offline"),
+		setMsgFieldsOp(model.FieldKeyStateModelFactoryName, "custom"),
+	)))
+	received := []string{<-transitions, <-transitions}
+	sort.Strings(received)
+	s.Equal([]string{"custom:online_offline", "online_offline"}, received)
+	close(unblock)
+	s.Equal("leader_standby", <-transitions)
+}
+
+// chanPartitionStateModel reports the lifecycle of the partition state model to a channel
+type chanPartitionStateModel struct {
+	partition string
+	events    chan string
+}
+
+func (m *chanPartitionStateModel) Init() error {
+	m.events <- "init:" + m.partition
+	return nil
+}
+
+func (m *chanPartitionStateModel) Processor() *StateModelProcessor {
+	processor := NewStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(*model.Message) error {
+		m.events <- "online:" + m.partition
+		return nil
+	})
+	processor.AddTransition(StateModelStateOffline, StateModelStateDropped, func(*model.Message) error {
+		return nil
+	})
+	return processor
+}
+
+func (m *chanPartitionStateModel) Reset() {
+	m.events <- "reset:" + m.partition
+}
+
+func (m *chanPartitionStateModel) Drop() {
+	m.events <- "drop:" + m.partition
+}
+
+func (s *ParticipantTestSuite) TestPartitionStateModelFactory() {
+	events := make(chan string, 10)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication, TestClusterName,
+		TestResource, testParticipantHost, GetRandomPort())
+	pImpl := p.(*participant)
+	pImpl.RegisterPartitionStateModelFactory(StateModelNameOnlineOffline, StateModelFactoryNameDefault,
+		func(resource string, partition string) PartitionStateModel {
+			return &chanPartitionStateModel{partition: partition, events: events}
+		})
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+
+	resource := CreateRandomString()
+	s.NoError(accessor.CreateParticipantMsg(pImpl.InstanceName(), s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, "p_0"),
+	)))
+	s.Equal("init:p_0", <-events)
+	s.Equal("online:p_0", <-events)
+
+	s.NoError(accessor.CreateParticipantMsg(pImpl.InstanceName(), s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, "p_1"),
+		setMsgFieldsOp(model.FieldKeyToState, StateModelStateDropped),
+	)))
+	s.Equal("init:p_1", <-events)
+	s.Equal("drop:p_1", <-events)
+}
+
 func (s *ParticipantTestSuite) TestUpdateCurrentState() {
 	p, _ := s.createParticipantAndConnect()
 	defer p.Disconnect()
@@ -443,6 +616,324 @@ func (s *ParticipantTestSuite) TestMismatchStateIsRejected() {
 	s.Equal(currentState.GetState(partition), StateModelStateOnline)
 }
 
+func (s *ParticipantTestSuite) TestTransitionErrorAndResetPartition() {
+	port := GetRandomPort()
+	processor := createNoopStateModelProcessor()
+	processor.AddTransition(
+		StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+			return errors.New("test transition error")
+		})
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope,
+		s.ZkConnectString, testApplication, TestClusterName, TestResource, testParticipantHost, port)
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+
+	resource := CreateRandomString()
+	partition := strconv.Itoa(rand.Int())
+	msg := s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, partition),
+	)
+	accessor.CreateParticipantMsg(pImpl.instanceName, msg)
+	// wait for the participant to process messages
+	time.Sleep(2 * time.Second)
+
+	sessionID := pImpl.zkClient.GetSessionID()
+	currentState, err := accessor.CurrentState(pImpl.instanceName, sessionID, resource)
+	s.NoError(err)
+	s.Equal(StateModelStateError, currentState.GetState(partition))
+	s.Equal("test transition error", currentState.GetInfo(partition))
+	errorPath := keyBuilder.stateTransitionError(pImpl.instanceName, sessionID, resource, partition)
+	record, err := client.GetRecordFromPath(errorPath)
+	s.NoError(err)
+	transitionError := &model.StateTransitionError{ZNRecord: *record}
+	s.Equal("test transition error", transitionError.GetErrors()[msg.ID])
+
+	err = s.Admin.ResetPartition(TestClusterName, pImpl.instanceName, resource, []string{"unknown"})
+	s.Equal(ErrPartitionNotInErrorState, errors.Cause(err))
+	err = s.Admin.ResetPartition(TestClusterName, pImpl.instanceName, resource, []string{partition})
+	s.NoError(err)
+	time.Sleep(2 * time.Second)
+	currentState, err = accessor.CurrentState(pImpl.instanceName, sessionID, resource)
+	s.NoError(err)
+	s.Equal(StateModelStateOffline, currentState.GetState(partition))
+}
+
+func (s *ParticipantTestSuite) TestAdminSendMessage() {
+	p, _ := s.createParticipantAndConnect()
+	defer p.Disconnect()
+
+	resource := CreateRandomString()
+	msg := s.createMsg(p,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, "p_0"),
+		removeMsgFieldsOp(model.FieldKeyTargetSessionID),
+	)
+	s.Equal(ErrInstanceNotLive, s.Admin.SendMessage(TestClusterName, "localhost_1", msg))
+	s.NoError(s.Admin.SendMessage(TestClusterName, p.instanceName, msg))
+	s.Equal(p.zkClient.GetSessionID(), msg.GetTargetSessionID())
+	// wait for the participant to process messages
+	time.Sleep(2 * time.Second)
+
+	currentState, err := p.dataAccessor.CurrentState(p.instanceName, p.zkClient.GetSessionID(), resource)
+	s.NoError(err)
+	s.Equal(StateModelStateOnline, currentState.GetState("p_0"))
+}
+
+func (s *ParticipantTestSuite) TestTransitionTimeout() {
+	processor := createNoopStateModelProcessor()
+	processor.AddContextTransition(
+		StateModelStateOffline, StateModelStateOnline, func(ctx context.Context, m *model.Message) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, GetRandomPort(),
+		WithDefaultTransitionTimeout(time.Hour))
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+
+	resource := CreateRandomString()
+	partition := strconv.Itoa(rand.Int())
+	// the timeout of the message overrides the default timeout
+	msg := s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, partition),
+		setMsgFieldsOp(model.FieldKeySrcName, "controller"),
+	)
+	msg.SetExecutionTimeout(100 * time.Millisecond)
+	s.NoError(accessor.createMsg(keyBuilder.participantMsg(pImpl.instanceName, msg.ID), msg))
+	time.Sleep(time.Second)
+	currentState, err := accessor.CurrentState(pImpl.instanceName, pImpl.zkClient.GetSessionID(), resource)
+	s.NoError(err)
+	s.Equal(StateModelStateError, currentState.GetState(partition))
+
+	// the timeout is replied to the controller
+	replies, err := client.Children(keyBuilder.controllerMessages())
+	s.NoError(err)
+	found := false
+	for _, id := range replies {
+		reply, err := accessor.Msg(keyBuilder.controllerMsg(id))
+		s.NoError(err)
+		if reply.GetTargetName() == "controller" && reply.GetSrcName() == pImpl.instanceName {
+			found = true
+			s.Equal(model.MsgTypeTaskReply, reply.GetMsgType())
+			s.Equal("false", reply.GetMessageResult()["SUCCESS"])
+			s.Equal("true", reply.GetMessageResult()["TIMEOUT"])
+		}
+	}
+	s.True(found)
+}
+
+func (s *ParticipantTestSuite) TestTransitionHandlerPanic() {
+	p, _ := s.createParticipantAndConnect()
+	defer p.Disconnect()
+
+	msg := s.createMsg(p)
+	err := p.invokeTransitionHandler(context.Background(), func(_ context.Context, m *model.Message) error {
+		panic("test panic")
+	}, msg)
+	s.Error(err)
+}
+
+func (s *ParticipantTestSuite) TestTransitionTracing() {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	callbackSpanCh := make(chan trace.SpanContext, 1)
+	processor := createNoopStateModelProcessor()
+	processor.AddContextTransition(StateModelStateOffline, StateModelStateOnline,
+		func(ctx context.Context, m *model.Message) error {
+			callbackSpanCh <- trace.SpanContextFromContext(ctx)
+			return nil
+		})
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, GetRandomPort(), WithTracerProvider(tp))
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	s.NoError(pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	msg := s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, CreateRandomString()),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, strconv.Itoa(rand.Int())),
+	)
+	s.NoError(pImpl.handleMsg(msg))
+	callbackSpan := <-callbackSpanCh
+	s.True(callbackSpan.IsValid())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	s.Contains(spans, "helix.handle_message")
+	s.Contains(spans, "helix.state_transition")
+	s.Contains(spans, "zk.get")
+	transitionSpan := spans["helix.state_transition"]
+	s.Equal(callbackSpan.SpanID(), transitionSpan.SpanContext().SpanID())
+	s.Equal(spans["helix.handle_message"].SpanContext().SpanID(), transitionSpan.Parent().SpanID())
+}
+
+func (s *ParticipantTestSuite) TestEventLog() {
+	eventLog := NewEventLog(zap.NewNop(), 100)
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, GetRandomPort(), WithEventLog(eventLog))
+	s.NoError(p.Connect())
+	defer p.Disconnect()
+	s.Len(eventLog.Events(EventQuery{Types: []EventType{EventTypeSessionEstablished}}), 1)
+
+	other, _ := s.createParticipantAndConnect()
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	resource := CreateRandomString()
+	externalViewPath := (&KeyBuilder{TestClusterName}).externalViewForResource(resource)
+	s.NoError(client.CreateEmptyNode(externalViewPath))
+	defer client.DeleteTree(externalViewPath)
+	time.Sleep(time.Second)
+	s.NoError(client.SetWithDefaultVersion(externalViewPath, []byte("{}")))
+	other.Disconnect()
+	time.Sleep(time.Second)
+
+	query := EventQuery{Instance: other.InstanceName()}
+	query.Types = []EventType{EventTypeLiveInstanceUp}
+	s.Len(eventLog.Events(query), 1)
+	query.Types = []EventType{EventTypeLiveInstanceDown}
+	s.Len(eventLog.Events(query), 1)
+	s.Len(eventLog.Events(EventQuery{Resource: resource}), 1)
+}
+
+type testHealthReporter struct {
+	sync.Mutex
+	qps int
+}
+
+func (r *testHealthReporter) ReportName() string {
+	return "testReport"
+}
+
+func (r *testHealthReporter) Report() (map[string]map[string]string, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.qps++
+	return map[string]map[string]string{"qps": {"value": strconv.Itoa(r.qps)}}, nil
+}
+
+func (s *ParticipantTestSuite) TestHealthReport() {
+	port := GetRandomPort()
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+
+	// a report left by a previous run of the instance
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, port)
+	s.NoError(p.Connect())
+	stalePath := keyBuilder.healthReportForName(p.InstanceName(), "staleReport")
+	s.NoError(client.CreateDataWithPath(stalePath, []byte("{}")))
+	p.Disconnect()
+
+	p, _ = NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, port,
+		WithHealthReporter(&testHealthReporter{}), WithHealthReportInterval(100*time.Millisecond))
+	s.NoError(p.Connect())
+	path := keyBuilder.healthReportForName(p.InstanceName(), "testReport")
+	time.Sleep(500 * time.Millisecond)
+	record, err := client.GetRecordFromPath(path)
+	s.NoError(err)
+	report := &model.HealthStat{ZNRecord: *record}
+	s.True(report.GetTimestamp() > 0)
+	qps, err := strconv.Atoi(report.GetStats()["qps"]["value"])
+	s.NoError(err)
+	s.True(qps > 1, "the report should be published periodically")
+	exists, _, err := client.Exists(stalePath)
+	s.NoError(err)
+	s.False(exists)
+
+	p.Disconnect()
+	exists, _, err = client.Exists(path)
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *ParticipantTestSuite) TestShutdown() {
+	offlineCh := make(chan string, 1)
+	processor := createNoopStateModelProcessor()
+	processor.AddTransition(StateModelStateOnline, StateModelStateOffline, func(m *model.Message) error {
+		partition, _ := m.GetPartitionName()
+		offlineCh <- partition
+		return nil
+	})
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, s.ZkConnectString, testApplication,
+		TestClusterName, TestResource, testParticipantHost, GetRandomPort(),
+		WithResetPartitionsOnShutdown(true))
+	pImpl := p.(*participant)
+	p.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	s.NoError(p.Connect())
+
+	resource := CreateRandomString()
+	partition := strconv.Itoa(rand.Int())
+	msg := s.createMsg(pImpl,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, partition),
+	)
+	s.NoError(pImpl.DataAccessor().CreateParticipantMsg(pImpl.instanceName, msg))
+	time.Sleep(time.Second)
+	state, _ := pImpl.stateModel.GetState(resource, partition)
+	s.Equal(StateModelStateOnline, state)
+
+	s.NoError(p.Shutdown(context.Background()))
+	s.Equal(partition, <-offlineCh)
+	s.False(p.IsConnected())
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	exists, _, err := client.Exists(pImpl.keyBuilder.liveInstance(pImpl.instanceName))
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *ParticipantTestSuite) TestShutdownDrainTimeout() {
+	unblockCh := make(chan struct{})
+	processor := createNoopStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		<-unblockCh
+		return nil
+	})
+	p, _ := s.createParticipantAndConnect()
+	defer close(unblockCh)
+	p.RegisterStateModel(StateModelNameOnlineOffline, processor)
+	msg := s.createMsg(p,
+		setMsgFieldsOp(model.FieldKeyResourceName, CreateRandomString()),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, strconv.Itoa(rand.Int())),
+	)
+	s.NoError(p.DataAccessor().CreateParticipantMsg(p.instanceName, msg))
+	time.Sleep(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	s.Equal(context.DeadlineExceeded, errors.Cause(err))
+	s.False(p.IsConnected())
+}
+
 func (s *ParticipantTestSuite) TestHandleNewSessionCalledAfterZookeeperSessionExpired() {
 	port := GetRandomPort()
 	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope,
@@ -451,27 +942,67 @@ func (s *ParticipantTestSuite) TestHandleNewSessionCalledAfterZookeeperSessionEx
 	defer pImpl.Disconnect()
 	// set default state to StateHasSession so Participant would believe it is connected
 	fakeZK := uzk.NewFakeZk(uzk.DefaultConnectionState(zk.StateHasSession))
+	// the fake data tree starts empty, set up the cluster with a separate connection
+	adminClient := uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	s.NoError(adminClient.Connect())
+	admin := &Admin{zkClient: adminClient}
+	s.True(admin.AddCluster(TestClusterName, false))
+	s.NoError(admin.SetConfig(TestClusterName, "CLUSTER", map[string]string{
+		_allowParticipantAutoJoinKey: "true",
+	}))
+	adminConnections := fakeZK.GetConnections()
+	s.Len(adminConnections, 1)
+
 	pImpl.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
 		uzk.WithRetryTimeout(time.Second))
-	pImpl.Connect()
-	s.Len(fakeZK.GetConnections(), 1)
+	pImpl.dataAccessor = newDataAccessor(pImpl.zkClient, pImpl.keyBuilder)
+	s.NoError(pImpl.Connect())
+	s.Len(fakeZK.GetConnections(), 2)
 
 	// Create(liveInstancePath) will be called if and only if a new session is created
 	// check the times it is called would infer the number of times a new session is created
-	fakeZKConnection := fakeZK.GetConnections()[0]
+	var fakeZKConnection *uzk.FakeZkConn
+	for _, conn := range fakeZK.GetConnections() {
+		if conn != adminConnections[0] {
+			fakeZKConnection = conn
+		}
+	}
 	liveInstancePath := pImpl.keyBuilder.liveInstance(pImpl.InstanceName())
 	methodHistory := fakeZKConnection.GetHistory()
-	historyForChildrenW := methodHistory.GetHistoryForMethod("Create")
-	s.Len(historyForChildrenW, 1)
-	s.Equal(historyForChildrenW[0].Params[0].(string), liveInstancePath)
+	s.Len(liveInstanceCreates(methodHistory, liveInstancePath), 1)
 
 	// simulate a session expiration and reconnection event
 	fakeZK.SetState(fakeZKConnection, zk.StateExpired)
 	fakeZK.SetState(fakeZKConnection, zk.StateHasSession)
 	time.Sleep(1 * time.Second)
-	historyForChildrenW = methodHistory.GetHistoryForMethod("Create")
-	s.Len(historyForChildrenW, 2)
-	s.Equal(historyForChildrenW[1].Params[0].(string), liveInstancePath)
+	s.Len(liveInstanceCreates(methodHistory, liveInstancePath), 2)
+	exists, _, err := adminClient.Exists(liveInstancePath)
+	s.NoError(err)
+	s.True(exists)
+}
+
+func (s *ParticipantTestSuite) TestLiveInstanceRecreatedAfterDeletion() {
+	p, _ := s.createParticipantAndConnect()
+	defer p.Disconnect()
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+
+	s.NoError(client.Delete(p.keyBuilder.liveInstance(p.instanceName)))
+	time.Sleep(time.Second)
+	liveInstance, err := p.DataAccessor().LiveInstance(p.instanceName)
+	s.NoError(err)
+	s.Equal(p.zkClient.GetSessionID(), liveInstance.GetSessionID())
+}
+
+func liveInstanceCreates(history *uzk.MethodCallHistory, liveInstancePath string) []*uzk.MethodCall {
+	var calls []*uzk.MethodCall
+	for _, call := range history.GetHistoryForMethod("Create") {
+		if call.Params[0].(string) == liveInstancePath {
+			calls = append(calls, call)
+		}
+	}
+	return calls
 }
 
 func (s *ParticipantTestSuite) TestFatalErrorCh() {
@@ -516,3 +1047,50 @@ func setMsgFieldsOp(key, val string) msgOp {
 		msg.SetSimpleField(key, val)
 	}
 }
+
+func (s *ParticipantTestSuite) TestDebugHandler() {
+	p, _ := s.createParticipantAndConnect()
+	defer p.Disconnect()
+	handler := p.debugHandler()
+
+	get := func(method string, path string, v interface{}) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if recorder.Code == http.StatusOK {
+			s.NoError(json.Unmarshal(recorder.Body.Bytes(), v))
+		}
+		return recorder.Code
+	}
+
+	var status debugStatus
+	s.Equal(http.StatusOK, get(http.MethodGet, "/debug/helix", &status))
+	s.Equal(p.InstanceName(), status.Instance)
+	s.Equal(p.zkClient.GetSessionID(), status.SessionID)
+	s.True(status.Connected)
+	s.Contains(status.StateModels, StateModelNameOnlineOffline)
+
+	keyBuilder := &KeyBuilder{TestClusterName}
+	client := s.CreateAndConnectClient()
+	defer client.Disconnect()
+	accessor := newDataAccessor(client, keyBuilder)
+	resource := CreateRandomString()
+	s.NoError(accessor.CreateParticipantMsg(p.InstanceName(), s.createMsg(p,
+		setMsgFieldsOp(model.FieldKeyResourceName, resource),
+		setMsgFieldsOp(model.FieldKeyMsgType, MsgTypeStateTransition),
+		setMsgFieldsOp(model.FieldKeyPartitionName, "p_0"),
+	)))
+	var currentStates map[string]map[string]string
+	for i := 0; i < 100 && currentStates[resource]["p_0"] != StateModelStateOnline; i++ {
+		time.Sleep(50 * time.Millisecond)
+		s.Equal(http.StatusOK, get(http.MethodGet, "/debug/helix/currentstates", &currentStates))
+	}
+	s.Equal(StateModelStateOnline, currentStates[resource]["p_0"])
+
+	var messages []debugMessage
+	s.Equal(http.StatusOK, get(http.MethodGet, "/debug/helix/messages", &messages))
+	s.Equal(http.StatusMethodNotAllowed, get(http.MethodGet, "/debug/helix/snapshot", nil))
+	var snapshot debugSnapshot
+	s.Equal(http.StatusOK, get(http.MethodPost, "/debug/helix/snapshot", &snapshot))
+	s.Equal(status.Instance, snapshot.Status.Instance)
+	s.Equal(StateModelStateOnline, snapshot.CurrentStates[resource]["p_0"])
+}
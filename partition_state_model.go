@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import "github.com/pkg/errors"
+
+// PartitionStateModel is the state model object of a single partition, it holds the resources of
+// the partition, e.g. files or connections, for the lifetime of the partition on the participant.
+// Mirrors org.apache.helix.participant.statemachine.StateModel
+type PartitionStateModel interface {
+	// Init is called once the state model is created, before the first transition of the partition.
+	// The transition fails if Init returns an error and the state model is created again next time
+	Init() error
+	// Processor returns the handlers of the transitions of the partition
+	Processor() *StateModelProcessor
+	// Reset is called when the partition is moved back to the initial state without transitions,
+	// i.e. when the ZK session expires
+	Reset()
+	// Drop is called after the partition is dropped, the state model is discarded afterwards
+	Drop()
+}
+
+// PartitionStateModelFactory creates the state model object of a partition,
+// mirrors org.apache.helix.participant.statemachine.StateModelFactory
+type PartitionStateModelFactory func(resource string, partition string) PartitionStateModel
+
+// partitionProcessor returns the processor of the partition, the state model of the partition is
+// created by the factory of the registration if any, the processor of the registration otherwise
+func (r *registeredStateModel) partitionProcessor(resource string, partition string) (*StateModelProcessor, error) {
+	if r.factory == nil {
+		return r.processor, nil
+	}
+	r.partitionsMu.Lock()
+	stateModel, ok := r.partitions[resource][partition]
+	r.partitionsMu.Unlock()
+	if ok {
+		return stateModel.Processor(), nil
+	}
+	stateModel = r.factory(resource, partition)
+	if err := stateModel.Init(); err != nil {
+		return nil, errors.Wrapf(err, "failed to init state model of partition %s", partition)
+	}
+	r.partitionsMu.Lock()
+	if r.partitions[resource] == nil {
+		r.partitions[resource] = make(map[string]PartitionStateModel)
+	}
+	r.partitions[resource][partition] = stateModel
+	r.partitionsMu.Unlock()
+	return stateModel.Processor(), nil
+}
+
+// dropPartition discards the state model of the dropped partition
+func (r *registeredStateModel) dropPartition(resource string, partition string) {
+	r.partitionsMu.Lock()
+	stateModel, ok := r.partitions[resource][partition]
+	delete(r.partitions[resource], partition)
+	if len(r.partitions[resource]) == 0 {
+		delete(r.partitions, resource)
+	}
+	r.partitionsMu.Unlock()
+	if ok {
+		stateModel.Drop()
+	}
+}
+
+// resetPartitions resets the state models of all the partitions
+func (r *registeredStateModel) resetPartitions() {
+	r.partitionsMu.Lock()
+	var stateModels []PartitionStateModel
+	for _, partitions := range r.partitions {
+		for _, stateModel := range partitions {
+			stateModels = append(stateModels, stateModel)
+		}
+	}
+	r.partitionsMu.Unlock()
+	for _, stateModel := range stateModels {
+		stateModel.Reset()
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+type testPartitionStateModel struct {
+	partition string
+	initErr   error
+	events    *[]string
+}
+
+func (m *testPartitionStateModel) Init() error {
+	*m.events = append(*m.events, "init:"+m.partition)
+	return m.initErr
+}
+
+func (m *testPartitionStateModel) Processor() *StateModelProcessor {
+	processor := NewStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(*model.Message) error {
+		*m.events = append(*m.events, "online:"+m.partition)
+		return nil
+	})
+	return processor
+}
+
+func (m *testPartitionStateModel) Reset() {
+	*m.events = append(*m.events, "reset:"+m.partition)
+}
+
+func (m *testPartitionStateModel) Drop() {
+	*m.events = append(*m.events, "drop:"+m.partition)
+}
+
+func TestPartitionStateModels(t *testing.T) {
+	var events []string
+	initErr := errors.New("init failed")
+	registry := newStateModelRegistry()
+	registry.registerFactory(StateModelNameOnlineOffline, StateModelFactoryNameDefault,
+		func(resource string, partition string) PartitionStateModel {
+			m := &testPartitionStateModel{partition: partition, events: &events}
+			if partition == "p_1" && initErr != nil {
+				m.initErr = initErr
+				initErr = nil
+			}
+			return m
+		})
+	registered, ok := registry.lookup(StateModelNameOnlineOffline, StateModelFactoryNameDefault)
+	assert.True(t, ok)
+
+	processor, err := registered.partitionProcessor("r", "p_0")
+	assert.NoError(t, err)
+	handler, ok := processor.handler(StateModelStateOffline, StateModelStateOnline)
+	assert.True(t, ok)
+	assert.NoError(t, handler(context.Background(), model.NewMsg("id")))
+	// the state model is created once per partition
+	_, err = registered.partitionProcessor("r", "p_0")
+	assert.NoError(t, err)
+	// the state model is created again after Init failed
+	_, err = registered.partitionProcessor("r", "p_1")
+	assert.Error(t, err)
+	_, err = registered.partitionProcessor("r", "p_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"init:p_0", "online:p_0", "init:p_1", "init:p_1"}, events)
+
+	events = nil
+	registered.dropPartition("r", "p_0")
+	registered.dropPartition("r", "p_0")
+	registry.resetPartitions()
+	assert.Equal(t, []string{"drop:p_0", "reset:p_1"}, events)
+	_, err = registered.partitionProcessor("r", "p_0")
+	assert.NoError(t, err)
+	assert.Equal(t, "init:p_0", events[len(events)-1], "a dropped partition gets a new state model")
+}
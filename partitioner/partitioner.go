@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package partitioner maps the keys of an application to the partitions of a Helix resource the
+// same way as the common Java partitioners, so Go clients and Java services agree on the partition
+// of each key:
+//
+//	Murmur3  Guava Hashing.consistentHash(Hashing.murmur3_32_fixed().hashString(key, UTF_8), n)
+//	Jump     the jump consistent hash of Lamping and Veach over the murmur3 hash of the key
+//	Murmur2  the default partitioner of Kafka, toPositive(Utils.murmur2(key)) % n
+//	Range    sorted split keys, e.g. of HBase regions
+//
+// The partitions are named {resource}_{index} as Helix names them:
+//
+//	partition := partitioner.Murmur3.Partition("myDB", key, 64)
+package partitioner
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Func maps a key to the index of its partition in [0, numPartitions)
+type Func func(key string, numPartitions int) int
+
+// Partition returns the name of the partition of the key in the resource
+func (f Func) Partition(resource string, key string, numPartitions int) string {
+	return PartitionName(resource, f(key, numPartitions))
+}
+
+// PartitionName returns the Helix name of the partition of the resource at the index
+func PartitionName(resource string, index int) string {
+	return resource + "_" + strconv.Itoa(index)
+}
+
+// Murmur3 maps the unsigned murmur3 hash of the UTF-8 key with Guava's consistent hash,
+// only 1/n of the keys move when a partition is added
+var Murmur3 Func = func(key string, numPartitions int) int {
+	return GuavaConsistentHash(int64(Murmur3Hash([]byte(key))), numPartitions)
+}
+
+// Jump maps the unsigned murmur3 hash of the UTF-8 key with the jump consistent hash,
+// only 1/n of the keys move when a partition is added
+var Jump Func = func(key string, numPartitions int) int {
+	return JumpConsistentHash(uint64(Murmur3Hash([]byte(key))), numPartitions)
+}
+
+// Murmur2 maps the key as the default partitioner of Kafka maps the keys of its records
+var Murmur2 Func = func(key string, numPartitions int) int {
+	return int(Murmur2Hash([]byte(key))&0x7fffffff) % numPartitions
+}
+
+// Range returns the Func of the partitions split at the sorted keys: the partition i holds the keys
+// from splitKeys[i-1] included to splitKeys[i] excluded, compared byte-wise, so there are
+// len(splitKeys)+1 partitions. The keys beyond numPartitions go to the last partition
+func Range(splitKeys ...string) Func {
+	keys := append([]string{}, splitKeys...)
+	sort.Strings(keys)
+	return func(key string, numPartitions int) int {
+		i := sort.Search(len(keys), func(i int) bool { return keys[i] > key })
+		if i >= numPartitions {
+			return numPartitions - 1
+		}
+		return i
+	}
+}
+
+// GuavaConsistentHash assigns the input to one of the buckets like Guava Hashing.consistentHash
+func GuavaConsistentHash(input int64, buckets int) int {
+	state := uint64(input)
+	candidate := 0
+	for {
+		state = 2862933555777941757*state + 1
+		// the int32 overflows as the int of Java does, and then ends the search
+		next := float64(candidate+1) / (float64(int32(state>>33)+1) / (1 << 31))
+		if next < 0 || next >= float64(buckets) {
+			return candidate
+		}
+		candidate = int(next)
+	}
+}
+
+// JumpConsistentHash assigns the key to one of the buckets with the jump consistent hash
+// of "A Fast, Minimal Memory, Consistent Hash Algorithm"
+func JumpConsistentHash(key uint64, buckets int) int {
+	b, j := int64(-1), int64(0)
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package partitioner
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur3Hash(t *testing.T) {
+	assert.Equal(t, uint32(0), Murmur3Hash(nil))
+	assert.Equal(t, uint32(0x248bfa47), Murmur3Hash([]byte("hello")))
+	assert.Equal(t, uint32(0x2e4ff723), Murmur3Hash([]byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestMurmur2Hash(t *testing.T) {
+	// the values of Kafka Utils.murmur2
+	for key, hash := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		assert.Equal(t, hash, Murmur2Hash([]byte(key)), key)
+	}
+}
+
+func TestGuavaConsistentHash(t *testing.T) {
+	// the values of Guava Hashing.consistentHash
+	golden100 := []int{0, 55, 62, 8, 45, 59, 86, 97, 82, 59, 73, 37, 17, 56, 86, 21, 90, 37, 38, 83}
+	for i, bucket := range golden100 {
+		assert.Equal(t, bucket, GuavaConsistentHash(int64(i), 100), i)
+	}
+	assert.Equal(t, 6, GuavaConsistentHash(10863919174838991, 11))
+	assert.Equal(t, 3, GuavaConsistentHash(2016238256797177309, 11))
+	assert.Equal(t, 5, GuavaConsistentHash(1673758223894951030, 11))
+	assert.Equal(t, 80343, GuavaConsistentHash(2, 100001))
+	assert.Equal(t, 22152, GuavaConsistentHash(2201, 100001))
+	assert.Equal(t, 15018, GuavaConsistentHash(2202, 100001))
+}
+
+func TestConsistentFuncs(t *testing.T) {
+	for name, f := range map[string]Func{"murmur3": Murmur3, "jump": Jump} {
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			partition := f(key, 10)
+			assert.True(t, partition >= 0 && partition < 10, name)
+			assert.Equal(t, partition, f(key, 10), name)
+			// a key moves only to the added partition
+			if moved := f(key, 11); moved != partition {
+				assert.Equal(t, 10, moved, name)
+			}
+		}
+	}
+	assert.Equal(t, 0, JumpConsistentHash(0, 1))
+}
+
+func TestMurmur2(t *testing.T) {
+	// toPositive(-973932308) % 10
+	assert.Equal(t, int(int32(-973932308)&0x7fffffff)%10, Murmur2("21", 10))
+	assert.Equal(t, 479470107%10, Murmur2("abc", 10))
+}
+
+func TestRange(t *testing.T) {
+	f := Range("m", "g")
+	for key, partition := range map[string]int{"": 0, "a": 0, "g": 1, "h": 1, "m": 2, "z": 2} {
+		assert.Equal(t, partition, f(key, 3), key)
+	}
+	// the keys beyond the partitions go to the last one
+	assert.Equal(t, 1, f("z", 2))
+	assert.Equal(t, "myDB_2", f.Partition("myDB", "z", 3))
+	assert.Equal(t, "myDB_0", PartitionName("myDB", 0))
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/uber-go/go-helix/model"
+)
+
+// PlacementViolationType is the constraint a placement violates
+type PlacementViolationType string
+
+// Constraints checked by ValidatePlacement
+const (
+	// PlacementViolationReplicaCount the partition is not placed on as many instances as the replicas
+	PlacementViolationReplicaCount PlacementViolationType = "REPLICA_COUNT"
+	// PlacementViolationDuplicateInstance the partition is placed on an instance more than once
+	PlacementViolationDuplicateInstance PlacementViolationType = "DUPLICATE_INSTANCE"
+	// PlacementViolationUnknownInstance the partition is placed on an instance not in the cluster
+	PlacementViolationUnknownInstance PlacementViolationType = "UNKNOWN_INSTANCE"
+	// PlacementViolationInstanceTag the instance does not have the instance group tag of the resource
+	PlacementViolationInstanceTag PlacementViolationType = "INSTANCE_TAG"
+	// PlacementViolationMaxPartitionsPerInstance the instance holds more partitions than allowed
+	PlacementViolationMaxPartitionsPerInstance PlacementViolationType = "MAX_PARTITIONS_PER_INSTANCE"
+	// PlacementViolationZoneSpread a fault zone holds more replicas of the partition than an even spread
+	PlacementViolationZoneSpread PlacementViolationType = "ZONE_SPREAD"
+)
+
+// PlacementViolation is a constraint violated by the placement of a resource,
+// Partition is empty for the violations of an instance
+type PlacementViolation struct {
+	Type      PlacementViolationType
+	Resource  string
+	Partition string
+	Instance  string
+	Message   string
+}
+
+func (v PlacementViolation) String() string {
+	if v.Partition == "" {
+		return fmt.Sprintf("%s %s: %s %s", v.Resource, v.Instance, v.Type, v.Message)
+	}
+	return fmt.Sprintf("%s %s: %s %s", v.Resource, v.Partition, v.Type, v.Message)
+}
+
+// PlacementConstraints are the cluster data a placement is validated against
+type PlacementConstraints struct {
+	// ClusterConfig provides the topology and the max partitions per instance, it can be nil
+	ClusterConfig *model.ClusterConfig
+	// ResourceConfig overrides the max partitions per instance of the cluster, it can be nil
+	ResourceConfig *model.ResourceConfig
+	// Instances are the instance configs of the cluster by instance name
+	Instances map[string]*model.InstanceConfig
+}
+
+// ValidatePlacement checks the placement of the partitions proposed by the ideal state, the preference
+// lists or else the instances of the map fields, and returns the violated constraints sorted by partition
+// then instance. Partitions without placement are only valid in FULL_AUTO mode, whose placements are
+// computed by the controller. The max partitions per instance only counts the partitions of the resource
+func ValidatePlacement(idealState *model.IdealState, constraints PlacementConstraints) []PlacementViolation {
+	resource := idealState.GetResourceName()
+	replicas := idealState.GetReplicas()
+	instances := make([]*model.InstanceConfig, 0, len(constraints.Instances))
+	for _, instance := range constraints.Instances {
+		instances = append(instances, instance)
+	}
+	topology := NewTopology(constraints.ClusterConfig, instances)
+
+	var violations []PlacementViolation
+	partitionsOf := map[string]int{}
+	for _, partition := range idealState.GetPartitionSet() {
+		placement := placedInstances(idealState, partition)
+		if len(placement) == 0 && idealState.GetRebalanceMode() == model.RebalanceModeFullAuto {
+			continue
+		}
+		if replicas > 0 && len(placement) != replicas {
+			violations = append(violations, PlacementViolation{
+				Type: PlacementViolationReplicaCount, Resource: resource, Partition: partition,
+				Message: fmt.Sprintf("placed on %d instances, expected %d", len(placement), replicas),
+			})
+		}
+		placed := map[string]struct{}{}
+		for _, instance := range placement {
+			if _, ok := placed[instance]; ok {
+				violations = append(violations, PlacementViolation{
+					Type: PlacementViolationDuplicateInstance, Resource: resource, Partition: partition,
+					Instance: instance, Message: fmt.Sprintf("placed on %s more than once", instance),
+				})
+				continue
+			}
+			placed[instance] = struct{}{}
+			partitionsOf[instance]++
+		}
+
+		var known []string
+		for instance := range placed {
+			if _, ok := constraints.Instances[instance]; ok {
+				known = append(known, instance)
+			}
+		}
+		maxReplicas := topology.MaxReplicasPerZone(len(known))
+		zones := topology.GroupByZone(known)
+		for _, zone := range topology.Zones() {
+			if len(zones[zone]) > maxReplicas {
+				sort.Strings(zones[zone])
+				violations = append(violations, PlacementViolation{
+					Type: PlacementViolationZoneSpread, Resource: resource, Partition: partition,
+					Message: fmt.Sprintf("fault zone %s holds %d replicas %v, at most %d expected",
+						zone, len(zones[zone]), zones[zone], maxReplicas),
+				})
+			}
+		}
+	}
+
+	tag := idealState.GetInstanceGroupTag()
+	maxPartitions := maxPartitionsPerInstance(constraints)
+	placedOn := make([]string, 0, len(partitionsOf))
+	for instance := range partitionsOf {
+		placedOn = append(placedOn, instance)
+	}
+	sort.Strings(placedOn)
+	for _, instance := range placedOn {
+		config, ok := constraints.Instances[instance]
+		if !ok {
+			violations = append(violations, PlacementViolation{
+				Type: PlacementViolationUnknownInstance, Resource: resource, Instance: instance,
+				Message: "instance is not in the cluster",
+			})
+			continue
+		}
+		if tag != "" && !config.ContainsTag(tag) {
+			violations = append(violations, PlacementViolation{
+				Type: PlacementViolationInstanceTag, Resource: resource, Instance: instance,
+				Message: fmt.Sprintf("instance does not have tag %s", tag),
+			})
+		}
+		if maxPartitions > 0 && partitionsOf[instance] > maxPartitions {
+			violations = append(violations, PlacementViolation{
+				Type: PlacementViolationMaxPartitionsPerInstance, Resource: resource, Instance: instance,
+				Message: fmt.Sprintf("instance holds %d partitions, at most %d allowed",
+					partitionsOf[instance], maxPartitions),
+			})
+		}
+	}
+	return violations
+}
+
+// placedInstances returns the preference list of the partition, or else the instances of its map field
+func placedInstances(idealState *model.IdealState, partition string) []string {
+	if preferenceList := idealState.GetPreferenceList(partition); len(preferenceList) > 0 {
+		return preferenceList
+	}
+	instances := make([]string, 0, len(idealState.MapFields[partition]))
+	for instance := range idealState.MapFields[partition] {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	return instances
+}
+
+// maxPartitionsPerInstance returns the limit of the resource config, or else the one of the cluster config,
+// or -1 if unlimited
+func maxPartitionsPerInstance(constraints PlacementConstraints) int {
+	if constraints.ResourceConfig != nil {
+		if max := constraints.ResourceConfig.GetMaxPartitionsPerInstance(); max > 0 {
+			return max
+		}
+	}
+	if constraints.ClusterConfig != nil {
+		return constraints.ClusterConfig.GetMaxPartitionsPerInstance()
+	}
+	return -1
+}
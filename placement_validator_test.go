@@ -0,0 +1,93 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func violationTypes(violations []PlacementViolation) []PlacementViolationType {
+	var types []PlacementViolationType
+	for _, violation := range violations {
+		types = append(types, violation.Type)
+	}
+	return types
+}
+
+func TestValidatePlacement(t *testing.T) {
+	instances := newTestInstances("z1", "z1", "z2", "z3")
+	constraints := PlacementConstraints{
+		ClusterConfig: model.NewClusterConfig("cluster"),
+		Instances:     map[string]*model.InstanceConfig{},
+	}
+	constraints.ClusterConfig.SetMaxPartitionsPerInstance(2)
+	for _, instance := range instances[:3] {
+		instance.AddTag("tag")
+	}
+	for _, instance := range instances {
+		constraints.Instances[instance.ID] = instance
+	}
+
+	idealState := model.NewIdealState("resource")
+	idealState.SetReplicas(2)
+	idealState.SetInstanceGroupTag("tag")
+	idealState.SetPreferenceList("resource_0", []string{"localhost_12000", "localhost_12002"})
+	assert.Empty(t, ValidatePlacement(idealState, constraints))
+
+	// both replicas in zone z1
+	idealState.SetPreferenceList("resource_1", []string{"localhost_12000", "localhost_12001"})
+	idealState.SetPreferenceList("resource_2", []string{"localhost_12002"})
+	idealState.SetPreferenceList("resource_3", []string{"localhost_12002", "localhost_12002"})
+	idealState.SetMapField("resource_4", "localhost_12003", StateModelStateOnline)
+	idealState.SetMapField("resource_4", "unknown_1", StateModelStateOnline)
+	violations := ValidatePlacement(idealState, constraints)
+	assert.Equal(t, []PlacementViolationType{
+		PlacementViolationZoneSpread,
+		PlacementViolationReplicaCount,
+		PlacementViolationDuplicateInstance,
+		PlacementViolationMaxPartitionsPerInstance,
+		PlacementViolationInstanceTag,
+		PlacementViolationUnknownInstance,
+	}, violationTypes(violations))
+	assert.Equal(t, "resource_1", violations[0].Partition)
+	assert.Equal(t, "resource resource_2: REPLICA_COUNT placed on 1 instances, expected 2", violations[1].String())
+	assert.Equal(t, "localhost_12002", violations[3].Instance)
+	assert.Equal(t, "resource localhost_12003: INSTANCE_TAG instance does not have tag tag", violations[4].String())
+	assert.Equal(t, "unknown_1", violations[5].Instance)
+
+	// the resource config overrides the max partitions per instance of the cluster
+	constraints.ResourceConfig = model.NewResourceConfig("resource")
+	constraints.ResourceConfig.SetMaxPartitionsPerInstance(3)
+	assert.NotContains(t, violationTypes(ValidatePlacement(idealState, constraints)),
+		PlacementViolationMaxPartitionsPerInstance)
+
+	// the partitions without placement are placed by the controller in FULL_AUTO mode
+	idealState = model.NewIdealState("resource")
+	idealState.SetReplicas(2)
+	idealState.SetNumPartitions(2)
+	assert.Equal(t, []PlacementViolationType{PlacementViolationReplicaCount, PlacementViolationReplicaCount},
+		violationTypes(ValidatePlacement(idealState, constraints)))
+	idealState.SetRebalanceMode(model.RebalanceModeFullAuto)
+	assert.Empty(t, ValidatePlacement(idealState, constraints))
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+var (
+	// ErrNotSemiAutoResource the resource is expected to be in SEMI_AUTO rebalance mode
+	ErrNotSemiAutoResource = errors.New("resource is not in SEMI_AUTO rebalance mode")
+
+	// ErrNoInstancesToPlace there is no instance to place the partitions of the resource on
+	ErrNoInstancesToPlace = errors.New("no instances to place the resource on")
+)
+
+const _defaultVirtualNodes = 100
+
+// PlacementStrategy computes the preference lists of the partitions of a resource,
+// partition->instances in the order of preference. The replicas never exceed the instances
+type PlacementStrategy interface {
+	ComputePreferenceLists(partitions []string, instances []*model.InstanceConfig, replicas int) map[string][]string
+}
+
+// RebalanceConstraints constrains the preference lists computed by Admin.RebalanceResource
+type RebalanceConstraints struct {
+	// Strategy computes the preference lists, if nil the CrushStrategy is used for the clusters
+	// with topology awareness enabled and consistent hashing for the others
+	Strategy PlacementStrategy
+	// InstanceTag limits the placement to the instances with the tag,
+	// the instance group tag of the resource is used if empty
+	InstanceTag string
+}
+
+// ConsistentHashingStrategy places the replicas on the next distinct instances
+// of a hash ring, so adding or removing an instance only moves a few partitions
+type ConsistentHashingStrategy struct {
+	// VirtualNodes is the number of points of each instance on the ring
+	VirtualNodes int
+}
+
+// ComputePreferenceLists implements PlacementStrategy
+func (s ConsistentHashingStrategy) ComputePreferenceLists(
+	partitions []string, instances []*model.InstanceConfig, replicas int) map[string][]string {
+	virtualNodes := s.VirtualNodes
+	if virtualNodes <= 0 {
+		virtualNodes = _defaultVirtualNodes
+	}
+	type point struct {
+		hash     uint64
+		instance string
+	}
+	ring := make([]point, 0, len(instances)*virtualNodes)
+	for _, instance := range instances {
+		for i := 0; i < virtualNodes; i++ {
+			ring = append(ring, point{hashOf(instance.ID, strconv.Itoa(i)), instance.ID})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash == ring[j].hash {
+			return ring[i].instance < ring[j].instance
+		}
+		return ring[i].hash < ring[j].hash
+	})
+
+	result := make(map[string][]string, len(partitions))
+	for _, partition := range partitions {
+		h := hashOf(partition)
+		start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		chosen := map[string]struct{}{}
+		var preferenceList []string
+		for i := 0; i < len(ring) && len(preferenceList) < replicas; i++ {
+			instance := ring[(start+i)%len(ring)].instance
+			if _, ok := chosen[instance]; ok {
+				continue
+			}
+			chosen[instance] = struct{}{}
+			preferenceList = append(preferenceList, instance)
+		}
+		result[partition] = preferenceList
+	}
+	return result
+}
+
+// RackAwareStrategy spreads the replicas of each partition over the fault zones
+// of the instances, and evenly over the instances of each zone.
+// The fault zones are the ones of the Topology of the cluster config
+type RackAwareStrategy struct {
+	// ClusterConfig defines the topology, the ZONE_ID of the instances is used if nil
+	ClusterConfig *model.ClusterConfig
+}
+
+// ComputePreferenceLists implements PlacementStrategy
+func (s RackAwareStrategy) ComputePreferenceLists(
+	partitions []string, instances []*model.InstanceConfig, replicas int) map[string][]string {
+	zones := groupByZone(s.ClusterConfig, instances)
+	cursors := make([]int, len(zones))
+	result := make(map[string][]string, len(partitions))
+	for i, partition := range sortedCopy(partitions) {
+		chosen := map[string]struct{}{}
+		var preferenceList []string
+		for r := 0; len(preferenceList) < replicas; r++ {
+			z := (i + r) % len(zones)
+			zone := zones[z]
+			for attempt := 0; attempt < len(zone); attempt++ {
+				instance := zone[cursors[z]%len(zone)]
+				cursors[z]++
+				if _, ok := chosen[instance]; !ok {
+					chosen[instance] = struct{}{}
+					preferenceList = append(preferenceList, instance)
+					break
+				}
+			}
+		}
+		result[partition] = preferenceList
+	}
+	return result
+}
+
+// CrushStrategy is a CRUSH-like placement: each replica picks a fault zone and then
+// an instance of the zone with straw2 draws, so the placement only depends on the
+// partition and the topology and each replica lands in a distinct zone when possible
+type CrushStrategy struct {
+	// ClusterConfig defines the topology, the ZONE_ID of the instances is used if nil
+	ClusterConfig *model.ClusterConfig
+}
+
+// ComputePreferenceLists implements PlacementStrategy
+func (s CrushStrategy) ComputePreferenceLists(
+	partitions []string, instances []*model.InstanceConfig, replicas int) map[string][]string {
+	zones := groupByZone(s.ClusterConfig, instances)
+	result := make(map[string][]string, len(partitions))
+	for _, partition := range partitions {
+		usedZones := map[int]struct{}{}
+		chosen := map[string]struct{}{}
+		var preferenceList []string
+		for r := 0; len(preferenceList) < replicas; r++ {
+			if len(usedZones) == len(zones) {
+				usedZones = map[int]struct{}{}
+			}
+			replica := strconv.Itoa(r)
+			zone, bestDraw := -1, math.Inf(-1)
+			for z, zoneInstances := range zones {
+				if _, ok := usedZones[z]; ok || !hasUnchosen(zoneInstances, chosen) {
+					continue
+				}
+				draw := straw2(hashOf(partition, replica, zoneInstances[0]), float64(len(zoneInstances)))
+				if draw > bestDraw {
+					zone, bestDraw = z, draw
+				}
+			}
+			if zone < 0 {
+				usedZones = map[int]struct{}{}
+				continue
+			}
+			usedZones[zone] = struct{}{}
+			instance, bestDraw := "", math.Inf(-1)
+			for _, candidate := range zones[zone] {
+				if _, ok := chosen[candidate]; ok {
+					continue
+				}
+				if draw := straw2(hashOf(partition, replica, candidate), 1); draw > bestDraw {
+					instance, bestDraw = candidate, draw
+				}
+			}
+			chosen[instance] = struct{}{}
+			preferenceList = append(preferenceList, instance)
+		}
+		result[partition] = preferenceList
+	}
+	return result
+}
+
+// groupByZone returns the sorted instance names of each fault zone, the zones are sorted
+func groupByZone(clusterConfig *model.ClusterConfig, instances []*model.InstanceConfig) [][]string {
+	topology := NewTopology(clusterConfig, instances)
+	zones := make([][]string, 0, len(topology.Zones()))
+	for _, zone := range topology.Zones() {
+		zones = append(zones, topology.InstancesInZone(zone))
+	}
+	return zones
+}
+
+func hasUnchosen(instances []string, chosen map[string]struct{}) bool {
+	for _, instance := range instances {
+		if _, ok := chosen[instance]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// straw2 returns the draw of an item with the weight, the item with the highest draw wins
+func straw2(hash uint64, weight float64) float64 {
+	u := (float64(hash>>11) + 1) / float64(1<<53)
+	return math.Log(u) / weight
+}
+
+func hashOf(keys ...string) uint64 {
+	h := fnv.New64a()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+func sortedCopy(values []string) []string {
+	result := append([]string(nil), values...)
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func newTestInstances(zones ...string) []*model.InstanceConfig {
+	var instances []*model.InstanceConfig
+	for i, zone := range zones {
+		config := model.NewInstanceConfig(fmt.Sprintf("localhost_%d", 12000+i))
+		config.SetZoneID(zone)
+		instances = append(instances, config)
+	}
+	return instances
+}
+
+func newTestPartitions(n int) []string {
+	var partitions []string
+	for i := 0; i < n; i++ {
+		partitions = append(partitions, fmt.Sprintf("resource_%d", i))
+	}
+	return partitions
+}
+
+func assertDistinctReplicas(t *testing.T, lists map[string][]string, partitions []string, replicas int) {
+	assert.Len(t, lists, len(partitions))
+	for _, partition := range partitions {
+		preferenceList := lists[partition]
+		assert.Len(t, preferenceList, replicas)
+		seen := map[string]struct{}{}
+		for _, instance := range preferenceList {
+			seen[instance] = struct{}{}
+		}
+		assert.Len(t, seen, replicas, "replicas of %s are not distinct", partition)
+	}
+}
+
+func zoneOf(instances []*model.InstanceConfig) map[string]string {
+	result := map[string]string{}
+	for _, instance := range instances {
+		result[instance.ID] = instance.GetZoneID()
+	}
+	return result
+}
+
+func TestConsistentHashingStrategy(t *testing.T) {
+	instances := newTestInstances("", "", "", "")
+	partitions := newTestPartitions(64)
+	strategy := ConsistentHashingStrategy{}
+	lists := strategy.ComputePreferenceLists(partitions, instances, 3)
+	assertDistinctReplicas(t, lists, partitions, 3)
+	assert.Equal(t, lists, strategy.ComputePreferenceLists(partitions, instances, 3))
+
+	// removing an instance only moves the partitions it was the top choice for
+	removed := instances[3].ID
+	lessLists := strategy.ComputePreferenceLists(partitions, instances[:3], 1)
+	for _, partition := range partitions {
+		if lists[partition][0] != removed {
+			assert.Equal(t, lists[partition][0], lessLists[partition][0])
+		}
+	}
+}
+
+func TestRackAwareStrategy(t *testing.T) {
+	instances := newTestInstances("r1", "r1", "r2", "r2", "r3", "r3")
+	zones := zoneOf(instances)
+	partitions := newTestPartitions(30)
+	lists := RackAwareStrategy{}.ComputePreferenceLists(partitions, instances, 3)
+	assertDistinctReplicas(t, lists, partitions, 3)
+
+	load := map[string]int{}
+	for _, preferenceList := range lists {
+		seenZones := map[string]struct{}{}
+		for _, instance := range preferenceList {
+			seenZones[zones[instance]] = struct{}{}
+			load[instance]++
+		}
+		assert.Len(t, seenZones, 3)
+	}
+	for _, instance := range instances {
+		assert.Equal(t, 15, load[instance.ID])
+	}
+
+	// more replicas than zones
+	lists = RackAwareStrategy{}.ComputePreferenceLists(partitions, instances[:4], 4)
+	assertDistinctReplicas(t, lists, partitions, 4)
+}
+
+func TestCrushStrategy(t *testing.T) {
+	instances := newTestInstances("r1", "r1", "r2", "r2", "r3", "")
+	zones := zoneOf(instances)
+	partitions := newTestPartitions(30)
+	lists := CrushStrategy{}.ComputePreferenceLists(partitions, instances, 3)
+	assertDistinctReplicas(t, lists, partitions, 3)
+	assert.Equal(t, lists, CrushStrategy{}.ComputePreferenceLists(partitions, instances, 3))
+	for _, preferenceList := range lists {
+		seenZones := map[string]struct{}{}
+		for _, instance := range preferenceList {
+			seenZones[zones[instance]] = struct{}{}
+		}
+		assert.Len(t, seenZones, 3)
+	}
+
+	lists = CrushStrategy{}.ComputePreferenceLists(partitions, instances, 6)
+	assertDistinctReplicas(t, lists, partitions, 6)
+}
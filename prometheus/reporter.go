@@ -0,0 +1,284 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package prometheus exposes the tally metrics of go-helix in the Prometheus text format
+// without depending on the Prometheus client library.
+//
+// The tally names are converted to Prometheus names by replacing the characters other than
+// letters, digits and underscores with underscores, e.g. the counter "helix.participant.fatal-errors"
+// becomes "helix_participant_fatal_errors". The names are then suffixed by the type of the metric:
+//
+//	counters:            <name>_total, e.g. helix_participant_transition_timeouts_total
+//	gauges:              <name>, e.g. helix_zk_watch_count
+//	timers:              <name>_seconds summary with _sum and _count, e.g. helix_zk_op_latency_seconds
+//	duration histograms: <name>_seconds histogram, e.g. helix_zk_op_latency_histogram_seconds
+//	value histograms:    <name> histogram
+//
+// The tags of the metrics become labels. Histograms have no _sum since tally only reports the
+// number of samples of each bucket.
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+)
+
+const (
+	_typeCounter   = "counter"
+	_typeGauge     = "gauge"
+	_typeSummary   = "summary"
+	_typeHistogram = "histogram"
+
+	_contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// _labelEscaper escapes the label values as required by the text format
+var _labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Reporter is a tally.StatsReporter keeping the reported metrics in memory, it is an
+// http.Handler serving them in the Prometheus text format, e.g. on /metrics
+type Reporter struct {
+	mu sync.Mutex
+	// prometheus name -> metric family
+	families map[string]*family
+}
+
+type family struct {
+	typ string
+	// rendered labels -> series
+	series map[string]*series
+}
+
+type series struct {
+	value float64
+	count int64
+	// upper bound -> samples of the histogram bucket
+	buckets map[float64]int64
+}
+
+// NewReporter creates a Reporter, pass it to tally.NewRootScope to collect the metrics:
+//
+//	reporter := prometheus.NewReporter()
+//	scope, closer := tally.NewRootScope(tally.ScopeOptions{Reporter: reporter}, time.Second)
+//	http.Handle("/metrics", reporter)
+func NewReporter() *Reporter {
+	return &Reporter{families: make(map[string]*family)}
+}
+
+// ReportCounter adds the value reported since the last flush to the counter
+func (r *Reporter) ReportCounter(name string, tags map[string]string, value int64) {
+	r.series(promName(name)+"_total", _typeCounter, tags, func(s *series) {
+		s.value += float64(value)
+	})
+}
+
+// ReportGauge sets the gauge
+func (r *Reporter) ReportGauge(name string, tags map[string]string, value float64) {
+	r.series(promName(name), _typeGauge, tags, func(s *series) {
+		s.value = value
+	})
+}
+
+// ReportTimer adds the interval to the summary of the timer
+func (r *Reporter) ReportTimer(name string, tags map[string]string, interval time.Duration) {
+	r.series(promName(name)+"_seconds", _typeSummary, tags, func(s *series) {
+		s.value += interval.Seconds()
+		s.count++
+	})
+}
+
+// ReportHistogramValueSamples adds the samples to the bucket of the histogram
+func (r *Reporter) ReportHistogramValueSamples(name string, tags map[string]string,
+	buckets tally.Buckets, bucketLowerBound, bucketUpperBound float64, samples int64) {
+	if bucketUpperBound == math.MaxFloat64 {
+		bucketUpperBound = math.Inf(1)
+	}
+	r.series(promName(name), _typeHistogram, tags, func(s *series) {
+		s.addSamples(bucketUpperBound, samples)
+	})
+}
+
+// ReportHistogramDurationSamples adds the samples to the bucket of the histogram
+func (r *Reporter) ReportHistogramDurationSamples(name string, tags map[string]string,
+	buckets tally.Buckets, bucketLowerBound, bucketUpperBound time.Duration, samples int64) {
+	upperBound := math.Inf(1)
+	if bucketUpperBound != time.Duration(math.MaxInt64) {
+		upperBound = bucketUpperBound.Seconds()
+	}
+	r.series(promName(name)+"_seconds", _typeHistogram, tags, func(s *series) {
+		s.addSamples(upperBound, samples)
+	})
+}
+
+// Capabilities returns the capabilities of the reporter, it supports tags
+func (r *Reporter) Capabilities() tally.Capabilities {
+	return r
+}
+
+// Reporting returns true
+func (r *Reporter) Reporting() bool {
+	return true
+}
+
+// Tagging returns true
+func (r *Reporter) Tagging() bool {
+	return true
+}
+
+// Flush is a no-op, the metrics are kept in memory
+func (r *Reporter) Flush() {}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (r *Reporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", _contentType)
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w
+func (r *Reporter) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.typ)
+		labels := make([]string, 0, len(f.series))
+		for l := range f.series {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			f.series[l].write(&b, name, f.typ, l)
+		}
+	}
+	r.mu.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (r *Reporter) series(name string, typ string, tags map[string]string, update func(s *series)) {
+	labels := renderLabels(tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{typ: typ, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{}
+		f.series[labels] = s
+	}
+	update(s)
+}
+
+func (s *series) addSamples(upperBound float64, samples int64) {
+	if s.buckets == nil {
+		s.buckets = make(map[float64]int64)
+	}
+	s.buckets[upperBound] += samples
+	s.count += samples
+}
+
+func (s *series) write(b *strings.Builder, name string, typ string, labels string) {
+	switch typ {
+	case _typeSummary:
+		fmt.Fprintf(b, "%s_sum%s %s\n", name, labels, formatFloat(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", name, labels, s.count)
+	case _typeHistogram:
+		bounds := make([]float64, 0, len(s.buckets)+1)
+		for bound := range s.buckets {
+			bounds = append(bounds, bound)
+		}
+		if _, ok := s.buckets[math.Inf(1)]; !ok {
+			bounds = append(bounds, math.Inf(1))
+		}
+		sort.Float64s(bounds)
+		var cumulative int64
+		for _, bound := range bounds {
+			cumulative += s.buckets[bound]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_count%s %d\n", name, labels, s.count)
+	default:
+		fmt.Fprintf(b, "%s%s %s\n", name, labels, formatFloat(s.value))
+	}
+}
+
+// promName replaces the characters not allowed in Prometheus names with underscores
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// renderLabels renders the tags as sorted Prometheus labels, e.g. {cluster="c",op="get"}
+func renderLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, strings.Replace(promName(key), ":", "_", -1),
+			_labelEscaper.Replace(tags[key])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds a label to the rendered labels
+func withLabel(labels string, key string, value string) string {
+	label := fmt.Sprintf(`%s="%s"`, key, _labelEscaper.Replace(value))
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+)
+
+func TestReporter(t *testing.T) {
+	reporter := NewReporter()
+	scope, closer := tally.NewRootScope(tally.ScopeOptions{Reporter: reporter}, time.Hour)
+	participant := scope.SubScope("helix.participant").Tagged(map[string]string{"cluster": `c"1`})
+	participant.Counter("fatal-errors").Inc(2)
+	participant.Gauge("leader").Update(1)
+	zk := scope.SubScope("helix.zk.op").Tagged(map[string]string{"op": "get"})
+	zk.Timer("latency").Record(time.Second)
+	zk.Timer("latency").Record(500 * time.Millisecond)
+	buckets := tally.MustMakeLinearDurationBuckets(time.Second, time.Second, 2)
+	zk.Histogram("latency-histogram", buckets).RecordDuration(1500 * time.Millisecond)
+	zk.Histogram("latency-histogram", buckets).RecordDuration(time.Minute)
+	assert.NoError(t, closer.Close())
+	// the counters add up across the reports
+	reporter.ReportCounter("helix.participant.fatal-errors", map[string]string{"cluster": `c"1`}, 1)
+
+	recorder := httptest.NewRecorder()
+	reporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, _contentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, strings.Join([]string{
+		`# TYPE helix_participant_fatal_errors_total counter`,
+		`helix_participant_fatal_errors_total{cluster="c\"1"} 3`,
+		`# TYPE helix_participant_leader gauge`,
+		`helix_participant_leader{cluster="c\"1"} 1`,
+		`# TYPE helix_zk_op_latency_histogram_seconds histogram`,
+		`helix_zk_op_latency_histogram_seconds_bucket{op="get",le="2"} 1`,
+		`helix_zk_op_latency_histogram_seconds_bucket{op="get",le="+Inf"} 2`,
+		`helix_zk_op_latency_histogram_seconds_count{op="get"} 2`,
+		`# TYPE helix_zk_op_latency_seconds summary`,
+		`helix_zk_op_latency_seconds_sum{op="get"} 1.5`,
+		`helix_zk_op_latency_seconds_count{op="get"} 2`,
+		``,
+	}, "\n"), recorder.Body.String())
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// PropertyCacheListener is notified after the cached data of the type changed,
+// it is called from the watch goroutines and must not block
+type PropertyCacheListener func(propertyType PropertyType)
+
+// PropertyCacheOption configures a PropertyCache
+type PropertyCacheOption func(*PropertyCache)
+
+// WithCacheCoalesceWindow coalesces the changes of a znode within the window into one read
+func WithCacheCoalesceWindow(window time.Duration) PropertyCacheOption {
+	return func(c *PropertyCache) {
+		c.coalesceWindow = window
+	}
+}
+
+// cachedDir holds the records of the children of a watched znode
+type cachedDir struct {
+	propertyType PropertyType
+	// refreshMu serializes the refreshes of the children, watched is guarded by refreshMu
+	refreshMu sync.Mutex
+	watched   map[string]struct{}
+	// records is guarded by PropertyCache.mu
+	records map[string]*model.ZNRecord
+}
+
+// PropertyCache keeps the ideal states, live instances, instance configs and the current states
+// of the live instances of a cluster in memory, the records are refreshed by watches
+// so the readers don't read the whole tree from Zookeeper on every change
+// This mirrors org.apache.helix.store.zk.ZkCallbackCache
+type PropertyCache struct {
+	logger         Logger
+	scope          tally.Scope
+	zkClient       *uzk.Client
+	keyBuilder     *KeyBuilder
+	coalesceWindow time.Duration
+	watches        *uzk.WatchManager
+
+	mu   sync.RWMutex
+	dirs map[string]*cachedDir
+	// sessions of the live instances whose current states are cached, written by the sync goroutine
+	sessions  map[string]string
+	listeners []PropertyCacheListener
+
+	syncCh chan struct{}
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewPropertyCache creates a PropertyCache of the cluster, the client is expected to be
+// connected before Start
+func NewPropertyCache(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkClient *uzk.Client,
+	clusterName string,
+	options ...PropertyCacheOption,
+) *PropertyCache {
+	return newPropertyCache(util.LoggerFromZap(logger), scope, zkClient, clusterName, options...)
+}
+
+func newPropertyCache(
+	logger Logger,
+	scope tally.Scope,
+	zkClient *uzk.Client,
+	clusterName string,
+	options ...PropertyCacheOption,
+) *PropertyCache {
+	c := &PropertyCache{
+		logger:     logger.With(util.Field("cluster", clusterName)),
+		scope:      scope.SubScope("helix.cache").Tagged(map[string]string{"cluster": clusterName}),
+		zkClient:   zkClient,
+		keyBuilder: &KeyBuilder{clusterName},
+		dirs:       map[string]*cachedDir{},
+		sessions:   map[string]string{},
+		syncCh:     make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// AddListener adds a listener notified of the changes of the cached data
+func (c *PropertyCache) AddListener(listener PropertyCacheListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// Start reads the cluster data and sets the watches to keep it updated
+func (c *PropertyCache) Start() error {
+	c.watches = uzk.NewWatchManager(c.zkClient, uzk.WithCoalesceWindow(c.coalesceWindow))
+	dirs := map[string]PropertyType{
+		c.keyBuilder.idealStates():        PropertyTypeIdealStates,
+		c.keyBuilder.liveInstances():      PropertyTypeLiveInstances,
+		c.keyBuilder.participantConfigs(): PropertyTypeInstanceConfigs,
+	}
+	for path, propertyType := range dirs {
+		if err := c.watchDir(path, propertyType); err != nil {
+			c.watches.Close()
+			return errors.Wrapf(err, "property cache failed to watch %s", path)
+		}
+	}
+	c.syncCurrentStateDirs()
+	c.stopCh = make(chan struct{})
+	c.doneCh = make(chan struct{})
+	go c.runSync()
+	return nil
+}
+
+// Stop removes the watches and drops the cached data, it is a no-op if the cache is not started
+func (c *PropertyCache) Stop() {
+	if c.stopCh == nil {
+		return
+	}
+	close(c.stopCh)
+	<-c.doneCh
+	c.stopCh = nil
+	c.watches.Close()
+	c.mu.Lock()
+	c.dirs = map[string]*cachedDir{}
+	c.sessions = map[string]string{}
+	c.mu.Unlock()
+}
+
+// IdealStates returns the cached ideal states by resource name,
+// the records are shared with the cache and must not be modified
+func (c *PropertyCache) IdealStates() map[string]*model.IdealState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	records := c.dirRecords(c.keyBuilder.idealStates())
+	result := make(map[string]*model.IdealState, len(records))
+	for name, record := range records {
+		result[name] = &model.IdealState{ZNRecord: *record}
+	}
+	return result
+}
+
+// LiveInstances returns the cached live instances by instance name,
+// the records are shared with the cache and must not be modified
+func (c *PropertyCache) LiveInstances() map[string]*model.LiveInstance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	records := c.dirRecords(c.keyBuilder.liveInstances())
+	result := make(map[string]*model.LiveInstance, len(records))
+	for name, record := range records {
+		result[name] = &model.LiveInstance{ZNRecord: *record}
+	}
+	return result
+}
+
+// InstanceConfigs returns the cached instance configs by instance name,
+// the records are shared with the cache and must not be modified
+func (c *PropertyCache) InstanceConfigs() map[string]*model.InstanceConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	records := c.dirRecords(c.keyBuilder.participantConfigs())
+	result := make(map[string]*model.InstanceConfig, len(records))
+	for name, record := range records {
+		result[name] = &model.InstanceConfig{ZNRecord: *record}
+	}
+	return result
+}
+
+// CurrentStates returns the cached current states of the sessions of the live instances,
+// instance->resource->current state. The records are shared with the cache and must not be modified
+func (c *PropertyCache) CurrentStates() map[string]map[string]*model.CurrentState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make(map[string]map[string]*model.CurrentState, len(c.sessions))
+	for instance, session := range c.sessions {
+		records := c.dirRecords(c.keyBuilder.currentStatesForSession(instance, session))
+		currentStates := make(map[string]*model.CurrentState, len(records))
+		for resource, record := range records {
+			currentStates[resource] = &model.CurrentState{ZNRecord: *record}
+		}
+		result[instance] = currentStates
+	}
+	return result
+}
+
+// dirRecords returns the records of the watched znode, c.mu is expected to be held
+func (c *PropertyCache) dirRecords(path string) map[string]*model.ZNRecord {
+	if dir, ok := c.dirs[path]; ok {
+		return dir.records
+	}
+	return nil
+}
+
+func (c *PropertyCache) watchDir(path string, propertyType PropertyType) error {
+	c.mu.Lock()
+	if _, ok := c.dirs[path]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.dirs[path] = &cachedDir{
+		propertyType: propertyType,
+		watched:      map[string]struct{}{},
+		records:      map[string]*model.ZNRecord{},
+	}
+	c.mu.Unlock()
+	err := c.watches.Watch(path, uzk.WatchTypeChildren, func(ev uzk.WatchEvent) {
+		if err := c.refreshDir(path, ev.Resync); err != nil {
+			c.logger.Warn("property cache failed to refresh", util.Field("path", path), util.ErrorField(err))
+		}
+	})
+	if err != nil {
+		c.mu.Lock()
+		delete(c.dirs, path)
+		c.mu.Unlock()
+		return err
+	}
+	return c.refreshDir(path, true)
+}
+
+// unwatchDir removes the watches of the znode and its children, and the cached records
+func (c *PropertyCache) unwatchDir(path string) {
+	c.mu.Lock()
+	dir, ok := c.dirs[path]
+	delete(c.dirs, path)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	// no refresh adds children after the watch of the znode is removed
+	c.watches.Unwatch(path, uzk.WatchTypeChildren)
+	dir.refreshMu.Lock()
+	defer dir.refreshMu.Unlock()
+	for name := range dir.watched {
+		c.watches.Unwatch(path+"/"+name, uzk.WatchTypeData)
+	}
+	c.notify(dir.propertyType)
+}
+
+// refreshDir watches the new children of the znode and drops the removed ones,
+// the records of all the children are read again if reload is set
+func (c *PropertyCache) refreshDir(path string, reload bool) error {
+	c.mu.RLock()
+	dir, ok := c.dirs[path]
+	c.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	dir.refreshMu.Lock()
+	defer dir.refreshMu.Unlock()
+
+	children, err := c.zkClient.Children(path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		children = nil
+	} else if err != nil {
+		return err
+	}
+	current := make(map[string]struct{}, len(children))
+	for _, child := range children {
+		current[child] = struct{}{}
+	}
+	changed := false
+	for name := range dir.watched {
+		if _, ok := current[name]; ok {
+			continue
+		}
+		c.watches.Unwatch(path+"/"+name, uzk.WatchTypeData)
+		delete(dir.watched, name)
+		c.mu.Lock()
+		delete(dir.records, name)
+		c.mu.Unlock()
+		changed = true
+	}
+	for name := range current {
+		_, watched := dir.watched[name]
+		if !watched {
+			childName := name
+			err := c.watches.Watch(path+"/"+name, uzk.WatchTypeData, func(uzk.WatchEvent) {
+				if err := c.refreshRecord(path, dir, childName); err != nil {
+					c.logger.Warn("property cache failed to refresh",
+						util.Field("path", path+"/"+childName), util.ErrorField(err))
+				}
+			})
+			if err != nil {
+				return err
+			}
+			dir.watched[name] = struct{}{}
+		}
+		if !watched || reload {
+			if err := c.refreshRecord(path, dir, name); err != nil {
+				return err
+			}
+		}
+	}
+	if changed {
+		c.notify(dir.propertyType)
+	}
+	return nil
+}
+
+// refreshRecord reads the record of the child into the cache
+func (c *PropertyCache) refreshRecord(path string, dir *cachedDir, name string) error {
+	c.scope.Tagged(map[string]string{"type": string(dir.propertyType)}).Counter("reads").Inc(1)
+	record, err := readRecord(context.Background(), c.zkClient, path+"/"+name, dir.propertyType == PropertyTypeIdealStates)
+	if err != nil && errors.Cause(err) != zk.ErrNoNode {
+		return err
+	}
+	c.mu.Lock()
+	if c.dirs[path] != dir {
+		// the znode is no longer watched
+		c.mu.Unlock()
+		return nil
+	}
+	if record == nil {
+		delete(dir.records, name)
+	} else {
+		dir.records[name] = record
+	}
+	c.mu.Unlock()
+	c.notify(dir.propertyType)
+	return nil
+}
+
+func (c *PropertyCache) notify(propertyType PropertyType) {
+	if propertyType == PropertyTypeLiveInstances {
+		select {
+		case c.syncCh <- struct{}{}:
+		default:
+		}
+	}
+	c.mu.RLock()
+	listeners := c.listeners
+	c.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(propertyType)
+	}
+}
+
+func (c *PropertyCache) runSync() {
+	defer close(c.doneCh)
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-c.syncCh:
+			c.syncCurrentStateDirs()
+		}
+	}
+}
+
+// syncCurrentStateDirs watches the current states of the sessions of the live instances,
+// it is only called by Start and the sync goroutine
+func (c *PropertyCache) syncCurrentStateDirs() {
+	c.mu.RLock()
+	sessions := map[string]string{}
+	for instance, record := range c.dirRecords(c.keyBuilder.liveInstances()) {
+		sessions[instance] = (&model.LiveInstance{ZNRecord: *record}).GetSessionID()
+	}
+	previous := c.sessions
+	c.mu.RUnlock()
+
+	synced := map[string]string{}
+	for instance, session := range previous {
+		if sessions[instance] == session {
+			synced[instance] = session
+			continue
+		}
+		c.unwatchDir(c.keyBuilder.currentStatesForSession(instance, session))
+	}
+	for instance, session := range sessions {
+		if _, ok := synced[instance]; ok {
+			continue
+		}
+		path := c.keyBuilder.currentStatesForSession(instance, session)
+		if err := c.watchDir(path, PropertyTypeCurrentStates); err != nil {
+			c.logger.Warn("property cache failed to watch current states",
+				util.Field("instance", instance), util.ErrorField(err))
+			c.unwatchDir(path)
+			continue
+		}
+		synced[instance] = session
+	}
+	c.mu.Lock()
+	c.sessions = synced
+	c.mu.Unlock()
+}
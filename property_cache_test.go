@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestPropertyCache(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, keyBuilder, accessor := cluster.client, cluster.keyBuilder, cluster.accessor
+	assert.NoError(t, accessor.createData(keyBuilder.idealStateForResource("r1"),
+		model.NewIdealState("r1").ZNRecord))
+	assert.NoError(t, accessor.createData(keyBuilder.liveInstance("i1"),
+		model.NewLiveInstance("i1", "s1").ZNRecord))
+	currentState := &model.CurrentState{ZNRecord: *model.NewRecord("r1")}
+	currentState.SetState("r1_0", StateModelStateOnline)
+	assert.NoError(t, client.CreateDataWithPath(keyBuilder.currentStateForResource("i1", "s1", "r1"), nil))
+	assert.NoError(t, accessor.setData(keyBuilder.currentStateForResource("i1", "s1", "r1"),
+		currentState.ZNRecord, -1))
+
+	cache := NewPropertyCache(zap.NewNop(), tally.NoopScope, client, TestClusterName)
+	changes := make(chan PropertyType, 100)
+	cache.AddListener(func(propertyType PropertyType) { changes <- propertyType })
+	assert.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	assert.Contains(t, cache.IdealStates(), "r1")
+	assert.Contains(t, cache.LiveInstances(), "i1")
+	assert.Empty(t, cache.InstanceConfigs())
+	currentStates := cache.CurrentStates()
+	assert.Equal(t, StateModelStateOnline, currentStates["i1"]["r1"].GetState("r1_0"))
+
+	// the changes are applied by watches
+	assert.NoError(t, accessor.createInstanceConfig(keyBuilder.participantConfig("i1"),
+		model.NewInstanceConfig("i1")))
+	waitForPropertyCache(t, func() bool { return len(cache.InstanceConfigs()) == 1 })
+	idealState := model.NewIdealState("r1")
+	idealState.SetNumPartitions(4)
+	assert.NoError(t, accessor.setData(keyBuilder.idealStateForResource("r1"), idealState.ZNRecord, -1))
+	waitForPropertyCache(t, func() bool { return cache.IdealStates()["r1"].GetNumPartitions() == 4 })
+	assert.NoError(t, client.Delete(keyBuilder.idealStateForResource("r1")))
+	waitForPropertyCache(t, func() bool { return len(cache.IdealStates()) == 0 })
+
+	// the current states follow the session of the live instance
+	assert.NoError(t, client.Delete(keyBuilder.liveInstance("i1")))
+	waitForPropertyCache(t, func() bool { return len(cache.CurrentStates()) == 0 })
+	assert.NoError(t, accessor.createData(keyBuilder.liveInstance("i1"),
+		model.NewLiveInstance("i1", "s2").ZNRecord))
+	waitForPropertyCache(t, func() bool { return len(cache.CurrentStates()) == 1 })
+	assert.Empty(t, cache.CurrentStates()["i1"])
+	assert.NoError(t, client.CreateDataWithPath(keyBuilder.currentStateForResource("i1", "s2", "r1"), nil))
+	assert.NoError(t, accessor.setData(keyBuilder.currentStateForResource("i1", "s2", "r1"),
+		currentState.ZNRecord, -1))
+	waitForPropertyCache(t, func() bool {
+		cs, ok := cache.CurrentStates()["i1"]["r1"]
+		return ok && cs.GetState("r1_0") == StateModelStateOnline
+	})
+	assert.NotEmpty(t, changes)
+}
+
+func waitForPropertyCache(t *testing.T, condition func() bool) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	assert.FailNow(t, "timed out waiting for the property cache")
+}
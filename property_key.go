@@ -0,0 +1,190 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+// PropertyType is the type of the Helix data at a PropertyKey
+type PropertyType string
+
+// The types of the Helix data, mirrors org.apache.helix.PropertyType
+const (
+	PropertyTypeIdealStates        PropertyType = "IDEALSTATES"
+	PropertyTypeExternalViews      PropertyType = "EXTERNALVIEW"
+	PropertyTypeTargetExternalView PropertyType = "TARGETEXTERNALVIEW"
+	PropertyTypeLiveInstances      PropertyType = "LIVEINSTANCES"
+	PropertyTypeInstanceConfigs    PropertyType = "CONFIGS"
+	PropertyTypeResourceConfigs    PropertyType = "RESOURCECONFIGS"
+	PropertyTypeClusterConfig      PropertyType = "CLUSTERCONFIG"
+	PropertyTypeConstraints        PropertyType = "CONSTRAINTS"
+	PropertyTypeCurrentStates      PropertyType = "CURRENTSTATES"
+	PropertyTypeMessages           PropertyType = "MESSAGES"
+	PropertyTypeControllerMessages PropertyType = "MESSAGESCONTROLLER"
+	PropertyTypeStateModelDefs     PropertyType = "STATEMODELDEFS"
+	PropertyTypeCustomizedStates   PropertyType = "CUSTOMIZEDSTATES"
+	PropertyTypeCustomizedView     PropertyType = "CUSTOMIZEDVIEW"
+	PropertyTypeParticipantHistory PropertyType = "PARTICIPANT_HISTORY"
+)
+
+// PropertyKey identifies the znode of a Helix property, either a single record
+// or the parent of the records of a type, mirrors org.apache.helix.PropertyKey
+type PropertyKey struct {
+	Type PropertyType
+	Path string
+}
+
+// NewKeyBuilder creates a KeyBuilder for the property keys of the cluster
+func NewKeyBuilder(clusterName string) *KeyBuilder {
+	return &KeyBuilder{clusterName: clusterName}
+}
+
+// IdealStates returns the key of the ideal states of the cluster
+func (b *KeyBuilder) IdealStates() PropertyKey {
+	return PropertyKey{PropertyTypeIdealStates, b.idealStates()}
+}
+
+// IdealState returns the key of the ideal state of the resource
+func (b *KeyBuilder) IdealState(resource string) PropertyKey {
+	return PropertyKey{PropertyTypeIdealStates, b.idealStateForResource(resource)}
+}
+
+// ExternalViews returns the key of the external views of the cluster
+func (b *KeyBuilder) ExternalViews() PropertyKey {
+	return PropertyKey{PropertyTypeExternalViews, b.externalView()}
+}
+
+// ExternalView returns the key of the external view of the resource
+func (b *KeyBuilder) ExternalView(resource string) PropertyKey {
+	return PropertyKey{PropertyTypeExternalViews, b.externalViewForResource(resource)}
+}
+
+// TargetExternalViews returns the key of the target external views of the cluster
+func (b *KeyBuilder) TargetExternalViews() PropertyKey {
+	return PropertyKey{PropertyTypeTargetExternalView, b.targetExternalView()}
+}
+
+// TargetExternalView returns the key of the target external view of the resource
+func (b *KeyBuilder) TargetExternalView(resource string) PropertyKey {
+	return PropertyKey{PropertyTypeTargetExternalView, b.targetExternalViewForResource(resource)}
+}
+
+// LiveInstances returns the key of the live instances of the cluster
+func (b *KeyBuilder) LiveInstances() PropertyKey {
+	return PropertyKey{PropertyTypeLiveInstances, b.liveInstances()}
+}
+
+// LiveInstance returns the key of the live instance
+func (b *KeyBuilder) LiveInstance(instance string) PropertyKey {
+	return PropertyKey{PropertyTypeLiveInstances, b.liveInstance(instance)}
+}
+
+// InstanceConfigs returns the key of the instance configs of the cluster
+func (b *KeyBuilder) InstanceConfigs() PropertyKey {
+	return PropertyKey{PropertyTypeInstanceConfigs, b.participantConfigs()}
+}
+
+// InstanceConfig returns the key of the config of the instance
+func (b *KeyBuilder) InstanceConfig(instance string) PropertyKey {
+	return PropertyKey{PropertyTypeInstanceConfigs, b.participantConfig(instance)}
+}
+
+// ResourceConfigs returns the key of the resource configs of the cluster
+func (b *KeyBuilder) ResourceConfigs() PropertyKey {
+	return PropertyKey{PropertyTypeResourceConfigs, b.resourceConfigs()}
+}
+
+// ResourceConfig returns the key of the config of the resource
+func (b *KeyBuilder) ResourceConfig(resource string) PropertyKey {
+	return PropertyKey{PropertyTypeResourceConfigs, b.resourceConfig(resource)}
+}
+
+// ClusterConfig returns the key of the cluster config
+func (b *KeyBuilder) ClusterConfig() PropertyKey {
+	return PropertyKey{PropertyTypeClusterConfig, b.clusterConfig()}
+}
+
+// Constraints returns the key of the cluster constraints of the type, e.g. model.ConstraintTypeMessage
+func (b *KeyBuilder) Constraints(constraintType string) PropertyKey {
+	return PropertyKey{PropertyTypeConstraints, b.constraints(constraintType)}
+}
+
+// CurrentStates returns the key of the current states of the instance in the session
+func (b *KeyBuilder) CurrentStates(instance string, sessionID string) PropertyKey {
+	return PropertyKey{PropertyTypeCurrentStates, b.currentStatesForSession(instance, sessionID)}
+}
+
+// CurrentState returns the key of the current state of the resource on the instance in the session
+func (b *KeyBuilder) CurrentState(instance string, sessionID string, resource string) PropertyKey {
+	return PropertyKey{PropertyTypeCurrentStates, b.currentStateForResource(instance, sessionID, resource)}
+}
+
+// ParticipantHistory returns the key of the session history of the instance
+func (b *KeyBuilder) ParticipantHistory(instance string) PropertyKey {
+	return PropertyKey{PropertyTypeParticipantHistory, b.participantHistory(instance)}
+}
+
+// CustomizedStates returns the key of the customized states of the type on the instance
+func (b *KeyBuilder) CustomizedStates(instance string, stateType string) PropertyKey {
+	return PropertyKey{PropertyTypeCustomizedStates, b.customizedStatesForType(instance, stateType)}
+}
+
+// CustomizedState returns the key of the customized state of the type of the resource on the instance
+func (b *KeyBuilder) CustomizedState(instance string, stateType string, resource string) PropertyKey {
+	return PropertyKey{PropertyTypeCustomizedStates, b.customizedStateForResource(instance, stateType, resource)}
+}
+
+// CustomizedViews returns the key of the customized views of the type
+func (b *KeyBuilder) CustomizedViews(stateType string) PropertyKey {
+	return PropertyKey{PropertyTypeCustomizedView, b.customizedViewsForType(stateType)}
+}
+
+// CustomizedView returns the key of the customized view of the type of the resource
+func (b *KeyBuilder) CustomizedView(stateType string, resource string) PropertyKey {
+	return PropertyKey{PropertyTypeCustomizedView, b.customizedViewForResource(stateType, resource)}
+}
+
+// Messages returns the key of the messages sent to the instance
+func (b *KeyBuilder) Messages(instance string) PropertyKey {
+	return PropertyKey{PropertyTypeMessages, b.participantMessages(instance)}
+}
+
+// Message returns the key of the message sent to the instance
+func (b *KeyBuilder) Message(instance string, messageID string) PropertyKey {
+	return PropertyKey{PropertyTypeMessages, b.participantMsg(instance, messageID)}
+}
+
+// ControllerMessages returns the key of the messages sent to the controller
+func (b *KeyBuilder) ControllerMessages() PropertyKey {
+	return PropertyKey{PropertyTypeControllerMessages, b.controllerMessages()}
+}
+
+// ControllerMessage returns the key of the message sent to the controller
+func (b *KeyBuilder) ControllerMessage(messageID string) PropertyKey {
+	return PropertyKey{PropertyTypeControllerMessages, b.controllerMsg(messageID)}
+}
+
+// StateModelDefs returns the key of the state model definitions of the cluster
+func (b *KeyBuilder) StateModelDefs() PropertyKey {
+	return PropertyKey{PropertyTypeStateModelDefs, b.stateModelDefs()}
+}
+
+// StateModelDef returns the key of the state model definition
+func (b *KeyBuilder) StateModelDef(stateModel string) PropertyKey {
+	return PropertyKey{PropertyTypeStateModelDefs, b.stateModelDef(stateModel)}
+}
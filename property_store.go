@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	uzk "github.com/uber-go/go-helix/zk"
+)
+
+// PropertyStore stores the values of the applications under the PROPERTYSTORE path of the cluster,
+// serialized by the serializer of the ZK client, see uzk.WithSerializer. The paths are relative
+// to the property store, e.g. /myApp/config
+// This mirrors org.apache.helix.store.zk.ZkHelixPropertyStore
+type PropertyStore struct {
+	zkClient *uzk.Client
+	root     string
+}
+
+// PropertyStore returns the property store of the cluster
+func (a *DataAccessor) PropertyStore() *PropertyStore {
+	return &PropertyStore{zkClient: a.zkClient, root: a.keyBuilder.propertyStore()}
+}
+
+func (s *PropertyStore) path(p string) string {
+	return path.Join(s.root, p)
+}
+
+// Get decodes the value of the path into value, a pointer, and returns the version of the value
+func (s *PropertyStore) Get(p string, value interface{}) (int32, error) {
+	stat, err := s.zkClient.GetValue(s.path(p), value)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Version, nil
+}
+
+// Set creates or updates the value of the path
+func (s *PropertyStore) Set(p string, value interface{}) error {
+	err := s.zkClient.SetValue(s.path(p), value, -1)
+	if errors.Cause(err) != zk.ErrNoNode {
+		return err
+	}
+	err = s.zkClient.CreateValue(s.path(p), value, uzk.FlagsZero)
+	if errors.Cause(err) == zk.ErrNodeExists {
+		// created concurrently
+		return s.zkClient.SetValue(s.path(p), value, -1)
+	}
+	return err
+}
+
+// Update sets the value of the path if its version is still the version read, the version -1
+// matches any version. It fails with zk.ErrBadVersion if the value was changed since
+func (s *PropertyStore) Update(p string, value interface{}, version int32) error {
+	return s.zkClient.SetValue(s.path(p), value, version)
+}
+
+// Exists returns if the path exists
+func (s *PropertyStore) Exists(p string) (bool, error) {
+	exists, _, err := s.zkClient.Exists(s.path(p))
+	return exists, err
+}
+
+// Children returns the children of the path
+func (s *PropertyStore) Children(p string) ([]string, error) {
+	return s.zkClient.Children(s.path(p))
+}
+
+// Remove removes the path and its children, removing a missing path is a no-op
+func (s *PropertyStore) Remove(p string) error {
+	err := s.zkClient.DeleteTree(s.path(p))
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
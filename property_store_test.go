@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertyStore(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	client, keyBuilder := cluster.client, cluster.keyBuilder
+	store := newDataAccessor(client, keyBuilder).PropertyStore()
+
+	type appConfig struct {
+		Shards int    `json:"shards"`
+		Owner  string `json:"owner"`
+	}
+	var config appConfig
+	_, err := store.Get("/myApp/config", &config)
+	assert.Equal(t, zk.ErrNoNode, errors.Cause(err))
+	exists, err := store.Exists("/myApp/config")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, store.Set("/myApp/config", appConfig{Shards: 4, Owner: "team"}))
+	version, err := store.Get("/myApp/config", &config)
+	assert.NoError(t, err)
+	assert.Equal(t, appConfig{Shards: 4, Owner: "team"}, config)
+	data, _, err := client.Get(keyBuilder.propertyStore() + "/myApp/config")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"shards": 4, "owner": "team"}`, string(data))
+
+	assert.NoError(t, store.Set("/myApp/config", appConfig{Shards: 8}))
+	assert.Equal(t, zk.ErrBadVersion, errors.Cause(store.Update("/myApp/config", appConfig{Shards: 2}, version)))
+	version, err = store.Get("/myApp/config", &config)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, config.Shards)
+	assert.NoError(t, store.Update("/myApp/config", appConfig{Shards: 2}, version))
+
+	assert.NoError(t, store.Set("/myApp/owners", []string{"team"}))
+	children, err := store.Children("/myApp")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"config", "owners"}, children)
+	assert.NoError(t, store.Remove("/myApp"))
+	assert.NoError(t, store.Remove("/myApp"))
+	exists, err = store.Exists("/myApp")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+)
+
+// ResourceMapping maps the partitions of a resource to the states of the instances,
+// partition->instance->state
+type ResourceMapping map[string]map[string]string
+
+// SetState sets the state of the partition on the instance
+func (m ResourceMapping) SetState(partition string, instance string, state string) {
+	if _, ok := m[partition]; !ok {
+		m[partition] = map[string]string{}
+	}
+	m[partition][instance] = state
+}
+
+// Rebalancer computes the placement of a resource, it is invoked by the controller
+// pipeline for the resources in USER_DEFINED rebalance mode whose REBALANCER_CLASS_NAME
+// is the name the rebalancer is registered with.
+// This mirrors org.apache.helix.controller.rebalancer.Rebalancer
+type Rebalancer interface {
+	ComputeNewIdealState(
+		resource string, cache *ClusterDataCache, currentStates *CurrentStateOutput) (ResourceMapping, error)
+}
+
+// RebalancerFunc is an adapter to use a function as a Rebalancer
+type RebalancerFunc func(
+	resource string, cache *ClusterDataCache, currentStates *CurrentStateOutput) (ResourceMapping, error)
+
+// ComputeNewIdealState calls f(resource, cache, currentStates)
+func (f RebalancerFunc) ComputeNewIdealState(
+	resource string, cache *ClusterDataCache, currentStates *CurrentStateOutput) (ResourceMapping, error) {
+	return f(resource, cache, currentStates)
+}
+
+// CurrentStateOutput holds the current states of the live instances,
+// resource->partition->instance->state
+type CurrentStateOutput struct {
+	states map[string]ResourceMapping
+}
+
+// NewCurrentStateOutput creates an empty CurrentStateOutput
+func NewCurrentStateOutput() *CurrentStateOutput {
+	return &CurrentStateOutput{states: map[string]ResourceMapping{}}
+}
+
+// SetState sets the current state of the partition on the instance
+func (o *CurrentStateOutput) SetState(resource string, partition string, instance string, state string) {
+	if _, ok := o.states[resource]; !ok {
+		o.states[resource] = ResourceMapping{}
+	}
+	o.states[resource].SetState(partition, instance, state)
+}
+
+// GetState returns the current state of the partition on the instance,
+// or an empty string if the instance does not host the partition
+func (o *CurrentStateOutput) GetState(resource string, partition string, instance string) string {
+	return o.states[resource][partition][instance]
+}
+
+// GetPartitionStateMap returns the current states of the partition by instance
+func (o *CurrentStateOutput) GetPartitionStateMap(resource string, partition string) map[string]string {
+	return o.states[resource][partition]
+}
+
+// GetResourceMapping returns the current states of the partitions of the resource
+func (o *CurrentStateOutput) GetResourceMapping(resource string) ResourceMapping {
+	return o.states[resource]
+}
+
+// GetResources returns the sorted names of the resources having current states
+func (o *CurrentStateOutput) GetResources() []string {
+	resources := make([]string, 0, len(o.states))
+	for resource := range o.states {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// DefaultResourceMonitorInterval is the default interval the resource statuses are computed at
+const DefaultResourceMonitorInterval = 30 * time.Second
+
+// ResourceStatus is the difference between the external view and the ideal state of a resource
+type ResourceStatus struct {
+	Resource   string
+	Partitions int
+	// MissingReplicas is the number of replicas in the ideal state not active in the external view,
+	// a replica is active if it is in a state other than the initial, ERROR and DROPPED states
+	MissingReplicas int
+	// ErrorPartitions is the number of partitions with a replica in ERROR state
+	ErrorPartitions int
+	// BelowMinActivePartitions is the number of partitions with fewer active replicas than
+	// the MIN_ACTIVE_REPLICAS of the resource, 0 if the resource has no minimum
+	BelowMinActivePartitions int
+}
+
+// ResourceMonitorOption configures optional settings of a ResourceMonitor
+type ResourceMonitorOption func(*ResourceMonitor)
+
+// WithResourceMonitorInterval sets the interval the resource statuses are computed at
+func WithResourceMonitorInterval(interval time.Duration) ResourceMonitorOption {
+	return func(m *ResourceMonitor) {
+		m.interval = interval
+	}
+}
+
+// ResourceMonitor periodically compares the external views with the ideal states of a cluster,
+// and reports the statuses of the resources as gauges tagged by resource
+// This mirrors org.apache.helix.monitoring.mbeans.ResourceMonitor
+type ResourceMonitor struct {
+	logger       *zap.Logger
+	scope        tally.Scope
+	zkClient     *uzk.Client
+	dataAccessor *DataAccessor
+	interval     time.Duration
+
+	mu       sync.RWMutex
+	statuses map[string]ResourceStatus
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewResourceMonitor creates a ResourceMonitor of the cluster
+func NewResourceMonitor(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	clusterName string,
+	options ...ResourceMonitorOption,
+) *ResourceMonitor {
+	m := &ResourceMonitor{
+		logger:   logger.With(zap.String("cluster", clusterName)),
+		scope:    scope.SubScope("helix.resource").Tagged(map[string]string{"cluster": clusterName}),
+		interval: DefaultResourceMonitorInterval,
+		statuses: map[string]ResourceStatus{},
+	}
+	for _, option := range options {
+		option(m)
+	}
+	m.zkClient = uzk.NewClient(logger, scope, uzk.WithZkSvr(zkConnectString),
+		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout))
+	m.dataAccessor = newDataAccessor(m.zkClient, &KeyBuilder{clusterName})
+	return m
+}
+
+// Connect connects to Zookeeper and computes the resource statuses, they are recomputed
+// every interval until Disconnect
+func (m *ResourceMonitor) Connect() error {
+	if m.stopCh != nil {
+		return nil
+	}
+	if err := m.zkClient.Connect(); err != nil {
+		return errors.Wrap(err, "helix resource monitor")
+	}
+	if err := m.Refresh(); err != nil {
+		m.zkClient.Disconnect()
+		return errors.Wrap(err, "helix resource monitor")
+	}
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	go m.run()
+	return nil
+}
+
+// Disconnect stops computing the resource statuses and disconnects from Zookeeper
+func (m *ResourceMonitor) Disconnect() {
+	if m.stopCh != nil {
+		close(m.stopCh)
+		<-m.doneCh
+		m.stopCh = nil
+	}
+	m.zkClient.Disconnect()
+}
+
+// GetResourceStatus returns the latest status of the resource
+func (m *ResourceMonitor) GetResourceStatus(resource string) (ResourceStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.statuses[resource]
+	return status, ok
+}
+
+// GetResourceStatuses returns the latest statuses of the resources sorted by resource name
+func (m *ResourceMonitor) GetResourceStatuses() []ResourceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make([]ResourceStatus, 0, len(m.statuses))
+	for _, status := range m.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Resource < statuses[j].Resource
+	})
+	return statuses
+}
+
+// Refresh computes the resource statuses and reports them without waiting for the interval
+func (m *ResourceMonitor) Refresh() error {
+	idealStates, err := m.dataAccessor.IdealStates()
+	if err != nil {
+		return err
+	}
+	externalViews, err := m.dataAccessor.ExternalViews()
+	if err != nil {
+		return err
+	}
+	resourceConfigs, err := m.dataAccessor.ResourceConfigs()
+	if err != nil {
+		return err
+	}
+	stateModelDefs, err := m.dataAccessor.StateModelDefs()
+	if err != nil {
+		return err
+	}
+
+	statuses := make(map[string]ResourceStatus, len(idealStates))
+	for resource, idealState := range idealStates {
+		stateModelDef, ok := stateModelDefs[idealState.GetStateModelDefRef()]
+		if !ok {
+			m.logger.Warn("no state model definition for resource", zap.String("resource", resource),
+				zap.String("stateModel", idealState.GetStateModelDefRef()))
+			continue
+		}
+		minActiveReplicas := idealState.GetIntField(model.FieldKeyMinActiveReplicas, -1)
+		if config, ok := resourceConfigs[resource]; ok && config.GetMinActiveReplicas() >= 0 {
+			minActiveReplicas = config.GetMinActiveReplicas()
+		}
+		externalView, ok := externalViews[resource]
+		if !ok {
+			externalView = model.NewExternalView(resource)
+		}
+		statuses[resource] = computeResourceStatus(idealState, stateModelDef, externalView, minActiveReplicas)
+	}
+
+	m.mu.Lock()
+	previous := m.statuses
+	m.statuses = statuses
+	m.mu.Unlock()
+	for resource, status := range statuses {
+		m.report(resource, status)
+	}
+	for resource := range previous {
+		if _, ok := statuses[resource]; !ok {
+			// the gauges of the dropped resources would otherwise keep their last values
+			m.report(resource, ResourceStatus{Resource: resource})
+		}
+	}
+	return nil
+}
+
+func (m *ResourceMonitor) run() {
+	defer close(m.doneCh)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if err := m.Refresh(); err != nil {
+				m.scope.Counter("refresh-failures").Inc(1)
+				m.logger.Warn("failed to compute the resource statuses", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (m *ResourceMonitor) report(resource string, status ResourceStatus) {
+	scope := m.scope.Tagged(map[string]string{"resource": resource})
+	scope.Gauge("partitions").Update(float64(status.Partitions))
+	scope.Gauge("missing-replicas").Update(float64(status.MissingReplicas))
+	scope.Gauge("error-partitions").Update(float64(status.ErrorPartitions))
+	scope.Gauge("below-min-active-partitions").Update(float64(status.BelowMinActivePartitions))
+}
+
+// computeResourceStatus compares the external view of the resource with its ideal state,
+// the replicas of a partition are the instances of its map field if set, or the REPLICAS of the
+// resource, or the instances of its preference list. No replica is expected if the resource is disabled
+func computeResourceStatus(idealState *model.IdealState, stateModelDef *model.StateModelDef,
+	externalView *model.ExternalView, minActiveReplicas int) ResourceStatus {
+	initialState := stateModelDef.GetInitialState()
+	if !idealState.IsEnabled() {
+		minActiveReplicas = -1
+	}
+	partitions := idealState.GetPartitionSet()
+	status := ResourceStatus{Resource: idealState.GetResourceName(), Partitions: len(partitions)}
+	for _, partition := range partitions {
+		replicas := 0
+		if !idealState.IsEnabled() {
+			replicas = 0
+		} else if states, ok := idealState.MapFields[partition]; ok {
+			replicas = len(activeStates(states, initialState))
+		} else if replicas = idealState.GetReplicas(); replicas <= 0 {
+			replicas = len(idealState.GetPreferenceList(partition))
+		}
+
+		active, hasError := 0, false
+		for _, state := range externalView.GetStateMap(partition) {
+			switch state {
+			case StateModelStateError:
+				hasError = true
+			case initialState, StateModelStateDropped:
+			default:
+				active++
+			}
+		}
+		if active < replicas {
+			status.MissingReplicas += replicas - active
+		}
+		if hasError {
+			status.ErrorPartitions++
+		}
+		if minActiveReplicas > 0 && active < minActiveReplicas {
+			status.BelowMinActivePartitions++
+		}
+	}
+	return status
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestComputeResourceStatus(t *testing.T) {
+	record, err := model.NewRecordFromBytes([]byte(_helixDefaultNodes["MasterSlave"]))
+	assert.NoError(t, err)
+	masterSlave := &model.StateModelDef{ZNRecord: *record}
+
+	idealState := model.NewIdealState("r1")
+	idealState.SetReplicas(3)
+	idealState.SetPreferenceList("r1_0", []string{"i1", "i2", "i3"})
+	idealState.SetPreferenceList("r1_1", []string{"i1", "i2", "i3"})
+	idealState.SetPreferenceList("r1_2", []string{"i1", "i2", "i3"})
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "i1", "MASTER")
+	view.SetState("r1_0", "i2", "SLAVE")
+	view.SetState("r1_0", "i3", "SLAVE")
+	view.SetState("r1_1", "i1", "MASTER")
+	view.SetState("r1_1", "i2", "OFFLINE")
+	view.SetState("r1_1", "i3", StateModelStateError)
+	view.SetState("r1_2", "i1", "SLAVE")
+	assert.Equal(t, ResourceStatus{
+		Resource:                 "r1",
+		Partitions:               3,
+		MissingReplicas:          4,
+		ErrorPartitions:          1,
+		BelowMinActivePartitions: 2,
+	}, computeResourceStatus(idealState, masterSlave, view, 2))
+	assert.Equal(t, 0, computeResourceStatus(idealState, masterSlave, view, -1).BelowMinActivePartitions)
+
+	// the replicas of the customized partitions are the instances of their map fields
+	customized := model.NewIdealState("r2")
+	customized.SetMapField("r2_0", "i1", "MASTER")
+	customized.SetMapField("r2_0", "i2", "OFFLINE")
+	assert.Equal(t, ResourceStatus{Resource: "r2", Partitions: 1, MissingReplicas: 1},
+		computeResourceStatus(customized, masterSlave, model.NewExternalView("r2"), -1))
+
+	idealState.SetBooleanField(model.FieldKeyHelixEnabled, false)
+	assert.Equal(t, ResourceStatus{Resource: "r1", Partitions: 3, ErrorPartitions: 1},
+		computeResourceStatus(idealState, masterSlave, view, 2))
+}
+
+func TestResourceMonitor(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, admin, keyBuilder, accessor := cluster.zk, cluster.admin, cluster.keyBuilder, cluster.accessor
+	idealState := model.NewIdealState("r1")
+	idealState.SetStateModelDefRef(StateModelNameOnlineOffline)
+	idealState.SetPreferenceList("r1_0", []string{"i1", "i2"})
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r1"), &idealState.ZNRecord))
+	config := model.NewResourceConfig("r1")
+	config.SetMinActiveReplicas(2)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ResourceConfig("r1"), &config.ZNRecord))
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "i1", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+
+	scope := tally.NewTestScope("", nil)
+	monitor := NewResourceMonitor(zap.NewNop(), scope, "", TestClusterName,
+		WithResourceMonitorInterval(10*time.Millisecond))
+	monitor.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	monitor.dataAccessor = newDataAccessor(monitor.zkClient, keyBuilder)
+	assert.NoError(t, monitor.Connect())
+	defer monitor.Disconnect()
+
+	expected := ResourceStatus{Resource: "r1", Partitions: 1, MissingReplicas: 1, BelowMinActivePartitions: 1}
+	status, ok := monitor.GetResourceStatus("r1")
+	assert.True(t, ok)
+	assert.Equal(t, expected, status)
+	assert.Equal(t, []ResourceStatus{expected}, monitor.GetResourceStatuses())
+	gauges := scope.Snapshot().Gauges()
+	key := "helix.resource.missing-replicas+cluster=" + TestClusterName + ",resource=r1"
+	if assert.Contains(t, gauges, key) {
+		assert.Equal(t, float64(1), gauges[key].Value())
+	}
+
+	view.SetState("r1_0", "i2", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	for i := 0; i < 100 && status.MissingReplicas > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		status, _ = monitor.GetResourceStatus("r1")
+	}
+	assert.Equal(t, ResourceStatus{Resource: "r1", Partitions: 1}, status)
+
+	assert.NoError(t, admin.DropResource(TestClusterName, "r1"))
+	assert.NoError(t, monitor.Refresh())
+	_, ok = monitor.GetResourceStatus("r1")
+	assert.False(t, ok)
+}
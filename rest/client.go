@@ -0,0 +1,342 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package rest is a client of the Apache Helix REST API (v2), it provides
+// admin operations without direct access to Zookeeper
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultTimeout = 30 * time.Second
+	_apiPrefix      = "/admin/v2"
+)
+
+var (
+	// ErrNotFound means the requested cluster, resource or instance does not exist
+	ErrNotFound = errors.New("helix rest: not found")
+
+	errMissingEndpoint = errors.New("helix rest: endpoint is not configured")
+)
+
+// Client talks to the Helix REST server,
+// mirrors the endpoints of org.apache.helix.rest.server.resources.helix
+type Client struct {
+	logger util.Logger
+	scope  tally.Scope
+
+	endpoint   string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+// ClientOption provides options for the REST client
+type ClientOption func(*Client)
+
+// WithEndpoint configures the address of the Helix REST server, such as http://localhost:8100
+func WithEndpoint(endpoint string) ClientOption {
+	return func(c *Client) {
+		c.endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// WithTimeout configures the timeout of each request
+func WithTimeout(t time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = t
+	}
+}
+
+// WithHTTPClient configures the underlying HTTP client, the timeout option is ignored
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithLogger sets the logger of the client instead of the zap logger passed to NewClient, for
+// the users of other logging libraries than zap
+func WithLogger(logger util.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// NewClient returns new Helix REST client, the client doesn't log if neither the zap logger nor
+// WithLogger is given
+func NewClient(logger *zap.Logger, scope tally.Scope, options ...ClientOption) *Client {
+	c := &Client{
+		timeout: _defaultTimeout,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.logger == nil {
+		c.logger = util.NopLogger()
+		if logger != nil {
+			c.logger = util.LoggerFromZap(logger)
+		}
+	}
+	c.logger = c.logger.With(util.Field("endpoint", c.endpoint))
+	c.scope = scope.SubScope("helix.rest").Tagged(map[string]string{"endpoint": c.endpoint})
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: c.timeout}
+	}
+	return c
+}
+
+// ListClusters returns the names of the clusters
+func (c *Client) ListClusters() ([]string, error) {
+	var resp struct {
+		Clusters []string `json:"clusters"`
+	}
+	err := c.do(http.MethodGet, "/clusters", nil, nil, &resp)
+	return resp.Clusters, err
+}
+
+// AddCluster creates a cluster
+func (c *Client) AddCluster(cluster string) error {
+	return c.do(http.MethodPut, clusterPath(cluster), nil, nil, nil)
+}
+
+// DropCluster removes a cluster
+func (c *Client) DropCluster(cluster string) error {
+	return c.do(http.MethodDelete, clusterPath(cluster), nil, nil, nil)
+}
+
+// EnableMaintenanceMode puts the cluster into maintenance mode, where the controller
+// stops rebalancing the resources
+func (c *Client) EnableMaintenanceMode(cluster string, reason string) error {
+	return c.command(clusterPath(cluster), "enableMaintenanceMode", nil, []byte(reason))
+}
+
+// DisableMaintenanceMode takes the cluster out of maintenance mode
+func (c *Client) DisableMaintenanceMode(cluster string) error {
+	return c.command(clusterPath(cluster), "disableMaintenanceMode", nil, nil)
+}
+
+// IsInMaintenanceMode checks if the cluster is in maintenance mode
+func (c *Client) IsInMaintenanceMode(cluster string) (bool, error) {
+	var resp struct {
+		Maintenance bool `json:"maintenance"`
+	}
+	err := c.do(http.MethodGet, clusterPath(cluster)+"/maintenance", nil, nil, &resp)
+	return resp.Maintenance, err
+}
+
+// ListResources returns the names of the resources in the cluster
+func (c *Client) ListResources(cluster string) ([]string, error) {
+	var resp struct {
+		IdealStates []string `json:"idealStates"`
+	}
+	err := c.do(http.MethodGet, clusterPath(cluster)+"/resources", nil, nil, &resp)
+	return resp.IdealStates, err
+}
+
+// AddResource adds a resource to the cluster with the ideal state
+func (c *Client) AddResource(cluster string, idealState *model.IdealState) error {
+	body, err := idealState.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPut, resourcePath(cluster, idealState.ID), nil, body, nil)
+}
+
+// DropResource removes a resource from the cluster
+func (c *Client) DropResource(cluster string, resource string) error {
+	return c.do(http.MethodDelete, resourcePath(cluster, resource), nil, nil, nil)
+}
+
+// EnableResource enables the resource in the cluster
+func (c *Client) EnableResource(cluster string, resource string) error {
+	return c.command(resourcePath(cluster, resource), "enable", nil, nil)
+}
+
+// DisableResource disables the resource in the cluster
+func (c *Client) DisableResource(cluster string, resource string) error {
+	return c.command(resourcePath(cluster, resource), "disable", nil, nil)
+}
+
+// Rebalance asks Helix to rebalance the resource with the number of replicas
+func (c *Client) Rebalance(cluster string, resource string, replicas int) error {
+	params := url.Values{"replicas": []string{strconv.Itoa(replicas)}}
+	return c.command(resourcePath(cluster, resource), "rebalance", params, nil)
+}
+
+// IdealState returns the ideal state of the resource
+func (c *Client) IdealState(cluster string, resource string) (*model.IdealState, error) {
+	record, err := c.getRecord(resourcePath(cluster, resource) + "/idealState")
+	if err != nil {
+		return nil, err
+	}
+	return &model.IdealState{ZNRecord: *record}, nil
+}
+
+// ExternalView returns the external view of the resource
+func (c *Client) ExternalView(cluster string, resource string) (*model.ExternalView, error) {
+	record, err := c.getRecord(resourcePath(cluster, resource) + "/externalView")
+	if err != nil {
+		return nil, err
+	}
+	return &model.ExternalView{ZNRecord: *record}, nil
+}
+
+// ListInstances returns the names of the instances in the cluster
+func (c *Client) ListInstances(cluster string) ([]string, error) {
+	var resp struct {
+		Instances []string `json:"instances"`
+	}
+	err := c.do(http.MethodGet, clusterPath(cluster)+"/instances", nil, nil, &resp)
+	return resp.Instances, err
+}
+
+// AddInstance adds an instance to the cluster with the instance config
+func (c *Client) AddInstance(cluster string, config *model.InstanceConfig) error {
+	body, err := config.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPut, instancePath(cluster, config.ID), nil, body, nil)
+}
+
+// DropInstance removes an instance from the cluster
+func (c *Client) DropInstance(cluster string, instance string) error {
+	return c.do(http.MethodDelete, instancePath(cluster, instance), nil, nil, nil)
+}
+
+// EnableInstance enables the instance in the cluster
+func (c *Client) EnableInstance(cluster string, instance string) error {
+	return c.command(instancePath(cluster, instance), "enable", nil, nil)
+}
+
+// DisableInstance disables the instance in the cluster
+func (c *Client) DisableInstance(cluster string, instance string) error {
+	return c.command(instancePath(cluster, instance), "disable", nil, nil)
+}
+
+// InstanceConfig returns the config of the instance
+func (c *Client) InstanceConfig(cluster string, instance string) (*model.InstanceConfig, error) {
+	record, err := c.getRecord(instancePath(cluster, instance) + "/configs")
+	if err != nil {
+		return nil, err
+	}
+	return &model.InstanceConfig{ZNRecord: *record}, nil
+}
+
+func (c *Client) getRecord(path string) (*model.ZNRecord, error) {
+	var record model.ZNRecord
+	if err := c.do(http.MethodGet, path, nil, nil, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (c *Client) command(path string, command string, params url.Values, body []byte) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("command", command)
+	return c.do(http.MethodPost, path, params, body, nil)
+}
+
+// do sends the request and decodes the JSON response into result if it is not nil
+func (c *Client) do(
+	method string, path string, params url.Values, body []byte, result interface{}) error {
+	if c.endpoint == "" {
+		return errMissingEndpoint
+	}
+	u := c.endpoint + _apiPrefix + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return errors.Wrapf(err, "helix rest: failed to create request %s %s", method, u)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	startTime := time.Now()
+	resp, err := c.httpClient.Do(req)
+	c.scope.Timer("request-latency").Record(time.Since(startTime))
+	if err != nil {
+		c.scope.Counter("request-errors").Inc(1)
+		return errors.Wrapf(err, "helix rest: failed to send request %s %s", method, u)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.scope.Counter("request-errors").Inc(1)
+		return errors.Wrapf(err, "helix rest: failed to read response of %s %s", method, u)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		c.scope.Counter("request-errors").Inc(1)
+		return errors.Wrapf(ErrNotFound, "%s %s", method, u)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		c.scope.Counter("request-errors").Inc(1)
+		c.logger.Warn("helix rest request failed", util.Field("method", method),
+			util.Field("url", u), util.Field("status", resp.StatusCode), util.Field("body", string(data)))
+		return errors.Errorf("helix rest: %s %s returned status %d: %s",
+			method, u, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return errors.Wrapf(err, "helix rest: failed to decode response of %s %s", method, u)
+	}
+	return nil
+}
+
+func clusterPath(cluster string) string {
+	return fmt.Sprintf("/clusters/%s", url.PathEscape(cluster))
+}
+
+func resourcePath(cluster string, resource string) string {
+	return fmt.Sprintf("%s/resources/%s", clusterPath(cluster), url.PathEscape(resource))
+}
+
+func instancePath(cluster string, instance string) string {
+	return fmt.Sprintf("%s/instances/%s", clusterPath(cluster), url.PathEscape(instance))
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	query  string
+	body   string
+}
+
+func newTestServer(t *testing.T, responses map[string]string) (*httptest.Server, *[]recordedRequest) {
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests = append(requests, recordedRequest{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			body:   string(body),
+		})
+		resp, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	return server, &requests
+}
+
+func newTestClient(server *httptest.Server) *Client {
+	return NewClient(zap.NewNop(), tally.NoopScope, WithEndpoint(server.URL+"/"))
+}
+
+func TestListClustersAndResources(t *testing.T) {
+	server, _ := newTestServer(t, map[string]string{
+		"GET /admin/v2/clusters":                `{"clusters": ["c1", "c2"]}`,
+		"GET /admin/v2/clusters/c1/resources":   `{"idealStates": ["db"], "externalViews": []}`,
+		"GET /admin/v2/clusters/c1/instances":   `{"instances": ["localhost_1"], "online": []}`,
+		"GET /admin/v2/clusters/c1/maintenance": `{"maintenance": true}`,
+		"GET /admin/v2/clusters/c1/resources/db/idealState": `{
+			"id": "db", "simpleFields": {"NUM_PARTITIONS": "3"}}`,
+		"GET /admin/v2/clusters/c1/resources/db/externalView": `{
+			"id": "db", "simpleFields": {"NUM_PARTITIONS": "3"}}`,
+		"GET /admin/v2/clusters/c1/instances/localhost_1/configs": `{
+			"id": "localhost_1", "simpleFields": {"HELIX_ENABLED": "true"}}`,
+	})
+	defer server.Close()
+	client := newTestClient(server)
+
+	clusters, err := client.ListClusters()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1", "c2"}, clusters)
+	resources, err := client.ListResources("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db"}, resources)
+	instances, err := client.ListInstances("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost_1"}, instances)
+	maintenance, err := client.IsInMaintenanceMode("c1")
+	assert.NoError(t, err)
+	assert.True(t, maintenance)
+
+	idealState, err := client.IdealState("c1", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, idealState.GetNumPartitions())
+	externalView, err := client.ExternalView("c1", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, externalView.GetNumPartitions())
+	config, err := client.InstanceConfig("c1", "localhost_1")
+	assert.NoError(t, err)
+	assert.True(t, config.GetEnabled())
+
+	_, err = client.IdealState("c1", "unknown")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+}
+
+func TestMutations(t *testing.T) {
+	server, requests := newTestServer(t, map[string]string{
+		"PUT /admin/v2/clusters/c1":                        "",
+		"DELETE /admin/v2/clusters/c1":                     "",
+		"POST /admin/v2/clusters/c1":                       "",
+		"PUT /admin/v2/clusters/c1/resources/db":           "",
+		"POST /admin/v2/clusters/c1/resources/db":          "",
+		"DELETE /admin/v2/clusters/c1/resources/db":        "",
+		"PUT /admin/v2/clusters/c1/instances/localhost_1":  "",
+		"POST /admin/v2/clusters/c1/instances/localhost_1": "",
+	})
+	defer server.Close()
+	client := newTestClient(server)
+
+	assert.NoError(t, client.AddCluster("c1"))
+	assert.NoError(t, client.EnableMaintenanceMode("c1", "upgrade"))
+	assert.NoError(t, client.DisableMaintenanceMode("c1"))
+	idealState := &model.IdealState{ZNRecord: *model.NewRecord("db")}
+	assert.NoError(t, client.AddResource("c1", idealState))
+	assert.NoError(t, client.Rebalance("c1", "db", 3))
+	assert.NoError(t, client.DisableResource("c1", "db"))
+	assert.NoError(t, client.DropResource("c1", "db"))
+	assert.NoError(t, client.AddInstance("c1", model.NewInstanceConfig("localhost_1")))
+	assert.NoError(t, client.EnableInstance("c1", "localhost_1"))
+	assert.NoError(t, client.DropCluster("c1"))
+	assert.Error(t, client.DropInstance("c1", "localhost_1"))
+
+	expected := []recordedRequest{
+		{method: "PUT", path: "/admin/v2/clusters/c1"},
+		{method: "POST", path: "/admin/v2/clusters/c1", query: "command=enableMaintenanceMode",
+			body: "upgrade"},
+		{method: "POST", path: "/admin/v2/clusters/c1", query: "command=disableMaintenanceMode"},
+		{method: "PUT", path: "/admin/v2/clusters/c1/resources/db", body: idealState.String()},
+		{method: "POST", path: "/admin/v2/clusters/c1/resources/db",
+			query: "command=rebalance&replicas=3"},
+		{method: "POST", path: "/admin/v2/clusters/c1/resources/db", query: "command=disable"},
+		{method: "DELETE", path: "/admin/v2/clusters/c1/resources/db"},
+		{method: "PUT", path: "/admin/v2/clusters/c1/instances/localhost_1",
+			body: model.NewInstanceConfig("localhost_1").String()},
+		{method: "POST", path: "/admin/v2/clusters/c1/instances/localhost_1", query: "command=enable"},
+		{method: "DELETE", path: "/admin/v2/clusters/c1"},
+		{method: "DELETE", path: "/admin/v2/clusters/c1/instances/localhost_1"},
+	}
+	assert.Equal(t, expected, *requests)
+}
+
+func TestServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := newTestClient(server)
+
+	_, err := client.ListClusters()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+	assert.Contains(t, err.Error(), "boom")
+
+	client = NewClient(zap.NewNop(), tally.NoopScope)
+	_, err = client.ListClusters()
+	assert.Equal(t, errMissingEndpoint, err)
+
+	// the failures are logged by the logger of WithLogger
+	core, logs := observer.New(zapcore.WarnLevel)
+	client = NewClient(nil, tally.NoopScope, WithEndpoint(server.URL),
+		WithLogger(util.LoggerFromZap(zap.New(core))))
+	_, err = client.ListClusters()
+	assert.Error(t, err)
+	if assert.Equal(t, 1, logs.Len()) {
+		entry := logs.All()[0]
+		assert.Equal(t, "helix rest request failed", entry.Message)
+		assert.Equal(t, server.URL, entry.ContextMap()["endpoint"])
+		assert.Equal(t, int64(500), entry.ContextMap()["status"])
+	}
+	// the client doesn't log without a logger
+	_, err = NewClient(nil, tally.NoopScope, WithEndpoint(server.URL)).ListClusters()
+	assert.Error(t, err)
+}
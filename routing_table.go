@@ -0,0 +1,772 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// DefaultRoutingPollInterval is the default interval of reading the cluster data in the polling modes
+const DefaultRoutingPollInterval = 30 * time.Second
+
+// RoutingSource is how a RoutingTableProvider learns about the changes of the cluster
+type RoutingSource int
+
+const (
+	// RoutingSourceWatch refreshes the routing table on watch events
+	RoutingSourceWatch RoutingSource = iota
+	// RoutingSourcePoll refreshes the routing table periodically without setting any watch,
+	// for environments where watches are unreliable or the watches per session are capped
+	RoutingSourcePoll
+	// RoutingSourceWatchAndPoll refreshes the routing table on watch events and periodically,
+	// the polls recover the changes whose watch events are missed
+	RoutingSourceWatchAndPoll
+)
+
+func (s RoutingSource) watch() bool {
+	return s == RoutingSourceWatch || s == RoutingSourceWatchAndPoll
+}
+
+func (s RoutingSource) poll() bool {
+	return s == RoutingSourcePoll || s == RoutingSourceWatchAndPoll
+}
+
+// RoutingView is the view of the cluster a RoutingTableProvider routes with
+type RoutingView int
+
+const (
+	// RoutingViewExternal routes with the external views, where the partitions currently are
+	RoutingViewExternal RoutingView = iota
+	// RoutingViewTargetExternal routes with the target external views, where the partitions are
+	// going to be, e.g. to warm up the replicas before they serve the traffic
+	RoutingViewTargetExternal
+)
+
+// RoutingTable is the snapshot of the placements of the partitions on the live instances.
+// A snapshot is never changed once returned by the provider, each refresh creates a new one
+// with the next generation, so it is safe to use concurrently and to keep across refreshes.
+// The returned instance configs and the slices of GetInstances are shared by the callers and
+// must not be modified
+// This mirrors org.apache.helix.spectator.RoutingTable
+type RoutingTable struct {
+	externalViews   map[string]*model.ExternalView
+	liveInstances   map[string]*model.LiveInstance
+	instanceConfigs map[string]*model.InstanceConfig
+	// generation is the number of refreshes of the provider when the snapshot was taken,
+	// 0 before the first one
+	generation  uint64
+	refreshedAt time.Time
+
+	// instancesByState is the index of GetInstances, built once per snapshot
+	indexOnce        sync.Once
+	instancesByState map[string]map[string]map[string][]*model.InstanceConfig
+}
+
+// Generation returns the generation of the snapshot, which increases with each refresh of the
+// provider, so a router can tell if it served from a table older than the latest one
+func (t *RoutingTable) Generation() uint64 {
+	return t.generation
+}
+
+// RefreshedAt returns the time the snapshot was read, zero before the first refresh
+func (t *RoutingTable) RefreshedAt() time.Time {
+	return t.refreshedAt
+}
+
+// GetResources returns the sorted names of the resources in the routing table
+func (t *RoutingTable) GetResources() []string {
+	resources := make([]string, 0, len(t.externalViews))
+	for resource := range t.externalViews {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// GetPartitions returns the sorted partitions of the resource
+func (t *RoutingTable) GetPartitions(resource string) []string {
+	view, ok := t.externalViews[resource]
+	if !ok {
+		return nil
+	}
+	return view.GetPartitionSet()
+}
+
+// GetStateMap returns a copy of the states of the partition of the resource by instance
+func (t *RoutingTable) GetStateMap(resource, partition string) map[string]string {
+	view, ok := t.externalViews[resource]
+	if !ok {
+		return nil
+	}
+	states := view.GetStateMap(partition)
+	if states == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(states))
+	for instance, state := range states {
+		copied[instance] = state
+	}
+	return copied
+}
+
+// GetInstances returns the configs of the live instances where the partition
+// of the resource is in the state, sorted by instance name. The lookups are served from an
+// index of the snapshot and do not allocate, since they happen on every routed request
+func (t *RoutingTable) GetInstances(resource, partition, state string) []*model.InstanceConfig {
+	t.indexOnce.Do(t.buildIndex)
+	return t.instancesByState[resource][partition][state]
+}
+
+// buildIndex precomputes the live instance configs by resource, partition and state. The
+// states and instance names are interned, the same few states repeat across all partitions
+func (t *RoutingTable) buildIndex() {
+	interned := map[string]string{}
+	intern := func(s string) string {
+		if i, ok := interned[s]; ok {
+			return i
+		}
+		interned[s] = s
+		return s
+	}
+	t.instancesByState = make(map[string]map[string]map[string][]*model.InstanceConfig, len(t.externalViews))
+	for resource, view := range t.externalViews {
+		partitions := make(map[string]map[string][]*model.InstanceConfig, len(view.MapFields))
+		for partition, states := range view.MapFields {
+			byState := map[string][]*model.InstanceConfig{}
+			instances := make([]string, 0, len(states))
+			for instance := range states {
+				instances = append(instances, instance)
+			}
+			sort.Strings(instances)
+			for _, instance := range instances {
+				if _, ok := t.liveInstances[instance]; !ok {
+					continue
+				}
+				config, ok := t.instanceConfigs[intern(instance)]
+				if !ok {
+					continue
+				}
+				state := intern(states[instance])
+				byState[state] = append(byState[state], config)
+			}
+			for state, configs := range byState {
+				// an append by the caller copies instead of writing into the shared array
+				byState[state] = configs[:len(configs):len(configs)]
+			}
+			partitions[partition] = byState
+		}
+		t.instancesByState[resource] = partitions
+	}
+}
+
+// GetEndpoints returns the addresses of the endpoints serving the protocol, e.g. grpc, of the live
+// instances where the partition of the resource is in the state, sorted by instance name.
+// The instances not advertising the protocol are skipped
+func (t *RoutingTable) GetEndpoints(resource, partition, state, protocol string) []string {
+	var endpoints []string
+	for _, config := range t.GetInstances(resource, partition, state) {
+		if address, ok := config.GetEndpoint(protocol); ok {
+			endpoints = append(endpoints, address)
+		}
+	}
+	return endpoints
+}
+
+// GetInstancesForResource returns the configs of the live instances where any partition
+// of the resource is in the state, sorted by instance name
+func (t *RoutingTable) GetInstancesForResource(resource, state string) []*model.InstanceConfig {
+	view, ok := t.externalViews[resource]
+	if !ok {
+		return nil
+	}
+	seen := map[string]struct{}{}
+	var instances []string
+	for partition := range view.MapFields {
+		for instance, instanceState := range view.GetStateMap(partition) {
+			if _, ok := seen[instance]; ok || instanceState != state {
+				continue
+			}
+			seen[instance] = struct{}{}
+			instances = append(instances, instance)
+		}
+	}
+	return t.liveInstanceConfigs(instances)
+}
+
+// GetResourcesWithTag returns the sorted resources hosted by the instances with the tag,
+// i.e. whose ideal state has the instance group tag
+func (t *RoutingTable) GetResourcesWithTag(tag string) []string {
+	var resources []string
+	for resource, view := range t.externalViews {
+		if view.GetInstanceGroupTag() == tag {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// GetResourceGroups returns the sorted groups of the resources with group routing enabled
+func (t *RoutingTable) GetResourceGroups() []string {
+	groups := util.NewStringSet()
+	for _, view := range t.externalViews {
+		if view.IsGroupRoutingEnabled() && view.GetResourceGroupName() != "" {
+			groups.Add(view.GetResourceGroupName())
+		}
+	}
+	return groups.ToSortedSlice()
+}
+
+// GetPartitionsForResourceGroup returns the sorted partitions of the resources of the group
+func (t *RoutingTable) GetPartitionsForResourceGroup(group string) []string {
+	partitions := util.NewStringSet()
+	for _, view := range t.groupViews(group, nil) {
+		for partition := range view.MapFields {
+			partitions.Add(partition)
+		}
+	}
+	return partitions.ToSortedSlice()
+}
+
+// GetInstancesForResourceGroup returns the configs of the live instances where the partition
+// of any resource of the group is in the state, sorted by instance name. Only the resources
+// with one of the instance group tags are routed with if tags are given
+// This mirrors org.apache.helix.spectator.RoutingTableProvider#getInstancesForResourceGroup
+func (t *RoutingTable) GetInstancesForResourceGroup(
+	group, partition, state string, tags ...string) []*model.InstanceConfig {
+	instances := util.NewStringSet()
+	for _, view := range t.groupViews(group, tags) {
+		for instance, instanceState := range view.GetStateMap(partition) {
+			if instanceState == state {
+				instances.Add(instance)
+			}
+		}
+	}
+	return t.liveInstanceConfigs(instances.ToSortedSlice())
+}
+
+// GetAllInstancesForResourceGroup returns the configs of the live instances where any partition
+// of any resource of the group is in the state, sorted by instance name. Only the resources
+// with one of the instance group tags are routed with if tags are given
+func (t *RoutingTable) GetAllInstancesForResourceGroup(group, state string, tags ...string) []*model.InstanceConfig {
+	instances := util.NewStringSet()
+	for _, view := range t.groupViews(group, tags) {
+		for partition := range view.MapFields {
+			for instance, instanceState := range view.GetStateMap(partition) {
+				if instanceState == state {
+					instances.Add(instance)
+				}
+			}
+		}
+	}
+	return t.liveInstanceConfigs(instances.ToSortedSlice())
+}
+
+// groupViews returns the external views of the resources of the group with group routing
+// enabled, limited to the resources with one of the tags if any
+func (t *RoutingTable) groupViews(group string, tags []string) []*model.ExternalView {
+	tagSet := util.NewStringSet(tags...)
+	var views []*model.ExternalView
+	for _, view := range t.externalViews {
+		if !view.IsGroupRoutingEnabled() || view.GetResourceGroupName() != group {
+			continue
+		}
+		if len(tags) > 0 && !tagSet.Contains(view.GetInstanceGroupTag()) {
+			continue
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// GetLiveInstances returns the sorted names of the live instances
+func (t *RoutingTable) GetLiveInstances() []string {
+	instances := make([]string, 0, len(t.liveInstances))
+	for instance := range t.liveInstances {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	return instances
+}
+
+func (t *RoutingTable) liveInstanceConfigs(instances []string) []*model.InstanceConfig {
+	sort.Strings(instances)
+	var configs []*model.InstanceConfig
+	for _, instance := range instances {
+		if _, ok := t.liveInstances[instance]; !ok {
+			continue
+		}
+		if config, ok := t.instanceConfigs[instance]; ok {
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+// RoutingTableListener is notified with the new routing table after each refresh
+type RoutingTableListener func(table *RoutingTable)
+
+// RoutingTableProviderOption configures a RoutingTableProvider
+type RoutingTableProviderOption func(*RoutingTableProvider)
+
+// WithRoutingSource sets how the routing table is refreshed, RoutingSourceWatch by default
+func WithRoutingSource(source RoutingSource) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.source = source
+	}
+}
+
+// WithRoutingView sets the view of the cluster routed with, RoutingViewExternal by default
+func WithRoutingView(view RoutingView) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.view = view
+	}
+}
+
+// WithRoutingCustomizedView routes with the customized view of the type instead of the
+// external view, the states of the routing table are then the customized states reported
+// by the participants, e.g. to route to the replicas whose replication lag is low.
+// It takes precedence over WithRoutingView
+func WithRoutingCustomizedView(stateType string) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.customizedStateType = stateType
+	}
+}
+
+// WithRoutingPollInterval sets the interval of the polling modes
+func WithRoutingPollInterval(interval time.Duration) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.pollInterval = interval
+	}
+}
+
+// WithRoutingZkClientOptions configures the ZK client of the routing table provider, the client
+// stays read-only
+func WithRoutingZkClientOptions(options ...uzk.ClientOption) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.zkClientOptions = append(p.zkClientOptions, options...)
+	}
+}
+
+// WithRoutingLogger sets the logger of the routing table provider and of its ZK client instead of
+// the zap logger passed to NewRoutingTableProvider
+func WithRoutingLogger(logger Logger) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.logger = logger
+	}
+}
+
+// WithRoutingMetricTags adds static tags to all the metrics of the routing table provider,
+// including the ones of its ZK client unless it is shared
+func WithRoutingMetricTags(tags map[string]string) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.metricTags = mergeMetricTags(p.metricTags, tags)
+	}
+}
+
+// WithRoutingZkClient reads the routing table over a ZK client shared with other managers of the
+// process, e.g. a participant, instead of its own read-only session. The client is acquired on
+// Connect and released on Disconnect, the ZK client options are not applied to it
+func WithRoutingZkClient(client *uzk.Client) RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.zkClient = client
+		p.sharedClient = true
+	}
+}
+
+// WithRoutingStrictValidation validates the external views read by the routing table provider,
+// the routing table is not refreshed from an invalid external view
+func WithRoutingStrictValidation() RoutingTableProviderOption {
+	return func(p *RoutingTableProvider) {
+		p.strictValidation = true
+	}
+}
+
+// RoutingTableProvider keeps the routing table of a cluster updated from the external views,
+// the watch events and the polls trigger the same refresh, so the sources can be combined
+// This mirrors org.apache.helix.spectator.RoutingTableProvider
+type RoutingTableProvider struct {
+	logger       Logger
+	scope        tally.Scope
+	clusterName  string
+	keyBuilder   *KeyBuilder
+	zkClient     *uzk.Client
+	dataAccessor *DataAccessor
+	source       RoutingSource
+	pollInterval time.Duration
+	view         RoutingView
+	// customizedStateType is the type of the customized view routed with, the view
+	// is routed with if empty
+	customizedStateType string
+	// zkClientOptions are applied after the default options of the ZK client
+	zkClientOptions []uzk.ClientOption
+	// metricTags are the static tags of the metrics of the provider
+	metricTags map[string]string
+	// strictValidation validates the external views read
+	strictValidation bool
+	// sharedClient is set if the ZK client is shared with other managers
+	sharedClient bool
+
+	watches *uzk.WatchManager
+	// watchedViews are the external views with data watches, only accessed by the refresh goroutine
+	watchedViews map[string]struct{}
+
+	mu        sync.RWMutex
+	table     *RoutingTable
+	listeners []*routingListener
+	// generation is the generation of the latest table
+	generation uint64
+	// generationCh is closed and replaced when the generation increases
+	generationCh chan struct{}
+
+	refreshCh chan struct{}
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+// NewRoutingTableProvider creates a RoutingTableProvider of the cluster
+func NewRoutingTableProvider(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	clusterName string,
+	options ...RoutingTableProviderOption,
+) *RoutingTableProvider {
+	p := &RoutingTableProvider{
+		clusterName:  clusterName,
+		keyBuilder:   &KeyBuilder{clusterName},
+		pollInterval: DefaultRoutingPollInterval,
+		table:        &RoutingTable{},
+		generationCh: make(chan struct{}),
+		watchedViews: map[string]struct{}{},
+		refreshCh:    make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	if p.logger == nil {
+		p.logger = util.LoggerFromZap(logger)
+	}
+	zkClientOptions := append([]uzk.ClientOption{uzk.WithLogger(p.logger), uzk.WithZkSvr(zkConnectString),
+		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout)}, p.zkClientOptions...)
+	p.logger = util.WithLogLevel(p.logger, LogComponentSpectator).With(util.Field("cluster", clusterName))
+	scope = managerScope(scope, ManagerRoleSpectator, clusterName, "", p.metricTags)
+	p.scope = scope.SubScope("helix.routing")
+	if !p.sharedClient {
+		// the routing table provider never writes, whatever the options
+		p.zkClient = uzk.NewClient(logger, scope, append(zkClientOptions, uzk.WithReadOnly())...)
+	}
+	p.dataAccessor = newDataAccessor(p.zkClient, p.keyBuilder)
+	p.dataAccessor.strict = p.strictValidation
+	return p
+}
+
+// Connect connects to Zookeeper and reads the routing table, the routing table is
+// kept updated until Disconnect
+func (p *RoutingTableProvider) Connect() error {
+	if p.stopCh != nil {
+		return nil
+	}
+	if err := p.connectClient(); err != nil {
+		return errors.Wrap(err, "helix routing table provider")
+	}
+	p.watches = uzk.NewWatchManager(p.zkClient)
+	if p.source.watch() {
+		if err := p.watchCluster(); err != nil {
+			if !p.source.poll() {
+				p.watches.Close()
+				p.disconnectClient()
+				return errors.Wrap(err, "helix routing table provider")
+			}
+			p.logger.Warn("failed to set watches, the routing table is refreshed by polls", util.ErrorField(err))
+		}
+	}
+	if err := p.refresh("init"); err != nil {
+		p.watches.Close()
+		p.disconnectClient()
+		return errors.Wrap(err, "helix routing table provider")
+	}
+	p.stopCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	go p.run()
+	return nil
+}
+
+// Disconnect stops updating the routing table and disconnects from Zookeeper
+func (p *RoutingTableProvider) Disconnect() {
+	connected := p.stopCh != nil
+	if connected {
+		close(p.stopCh)
+		<-p.doneCh
+		p.stopCh = nil
+		p.watches.Close()
+		p.watchedViews = map[string]struct{}{}
+	}
+	if !p.sharedClient || connected {
+		p.disconnectClient()
+	}
+}
+
+// connectClient connects the dedicated ZK client or acquires the shared one
+func (p *RoutingTableProvider) connectClient() error {
+	if p.sharedClient {
+		return p.zkClient.Acquire()
+	}
+	return p.zkClient.Connect()
+}
+
+// disconnectClient disconnects the dedicated ZK client or releases the shared one
+func (p *RoutingTableProvider) disconnectClient() {
+	if p.sharedClient {
+		p.zkClient.Release()
+		return
+	}
+	p.zkClient.Disconnect()
+}
+
+// GetRoutingTable returns the latest routing table
+func (p *RoutingTableProvider) GetRoutingTable() *RoutingTable {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.table
+}
+
+// Generation returns the generation of the latest routing table, a table with a lower
+// generation is stale
+func (p *RoutingTableProvider) Generation() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.generation
+}
+
+// WaitForGeneration blocks until the routing table reaches the generation and returns it, e.g.
+// to wait for the refresh following a change. It returns the error of ctx if it is done first
+func (p *RoutingTableProvider) WaitForGeneration(ctx context.Context, generation uint64) (*RoutingTable, error) {
+	for {
+		p.mu.RLock()
+		table, generationCh := p.table, p.generationCh
+		p.mu.RUnlock()
+		if table.generation >= generation {
+			return table, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "routing table at generation %d, want %d",
+				table.generation, generation)
+		case <-generationCh:
+		}
+	}
+}
+
+// routingListener is a registered listener, compared by pointer to remove it
+type routingListener struct {
+	notify RoutingTableListener
+}
+
+// AddListener adds a listener notified after each refresh of the routing table
+func (p *RoutingTableProvider) AddListener(listener RoutingTableListener) {
+	p.Subscribe(listener)
+}
+
+// Subscribe adds a listener notified after each refresh of the routing table until the returned
+// function is called, e.g. by a client whose lifetime is shorter than the provider's
+func (p *RoutingTableProvider) Subscribe(listener RoutingTableListener) (unsubscribe func()) {
+	l := &routingListener{notify: listener}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, l)
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for i, other := range p.listeners {
+			if other == l {
+				// copied since refresh may be iterating over the current slice
+				p.listeners = append(p.listeners[:i:i], p.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// watchCluster watches the znodes whose children changes affect the routing table
+func (p *RoutingTableProvider) watchCluster() error {
+	paths := []string{
+		p.viewsPath(),
+		p.keyBuilder.liveInstances(),
+		p.keyBuilder.participantConfigs(),
+	}
+	for _, path := range paths {
+		if err := p.watches.Watch(path, uzk.WatchTypeChildren, p.onWatchEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *RoutingTableProvider) onWatchEvent(uzk.WatchEvent) {
+	select {
+	case p.refreshCh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+func (p *RoutingTableProvider) run() {
+	defer close(p.doneCh)
+	var pollCh <-chan time.Time
+	if p.source.poll() {
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+		pollCh = ticker.C
+	}
+	for {
+		var source string
+		select {
+		case <-p.stopCh:
+			return
+		case <-p.refreshCh:
+			source = "watch"
+		case <-pollCh:
+			source = "poll"
+		}
+		if err := p.refresh(source); err != nil {
+			p.logger.Warn("failed to refresh the routing table", util.Field("source", source), util.ErrorField(err))
+		}
+	}
+}
+
+// refresh reads the cluster data into a new routing table
+func (p *RoutingTableProvider) refresh(source string) error {
+	scope := p.scope.Tagged(map[string]string{"source": source})
+	sw := scope.Timer("refresh-latency").Start()
+	defer sw.Stop()
+	table, err := p.readRoutingTable()
+	if err != nil {
+		scope.Counter("refresh-failures").Inc(1)
+		return err
+	}
+	scope.Counter("refreshes").Inc(1)
+	if p.source.watch() {
+		p.watchExternalViews(table)
+	}
+	// the index is built before the table is published, so no lookup waits for it
+	table.indexOnce.Do(table.buildIndex)
+	p.mu.Lock()
+	p.generation++
+	table.generation = p.generation
+	table.refreshedAt = time.Now()
+	p.table = table
+	close(p.generationCh)
+	p.generationCh = make(chan struct{})
+	listeners := p.listeners
+	p.mu.Unlock()
+	p.scope.Gauge("generation").Update(float64(table.generation))
+	for _, listener := range listeners {
+		listener.notify(table)
+	}
+	return nil
+}
+
+func (p *RoutingTableProvider) readRoutingTable() (*RoutingTable, error) {
+	var err error
+	table := &RoutingTable{}
+	if table.externalViews, err = p.readViews(); err != nil {
+		return nil, err
+	}
+	if table.liveInstances, err = p.dataAccessor.LiveInstances(); err != nil {
+		return nil, err
+	}
+	if table.instanceConfigs, err = p.dataAccessor.InstanceConfigs(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// watchExternalViews keeps a data watch on each external view of the routing table
+func (p *RoutingTableProvider) watchExternalViews(table *RoutingTable) {
+	for resource := range p.watchedViews {
+		if _, ok := table.externalViews[resource]; !ok {
+			p.watches.Unwatch(p.viewPath(resource), uzk.WatchTypeData)
+			delete(p.watchedViews, resource)
+		}
+	}
+	for resource := range table.externalViews {
+		if _, ok := p.watchedViews[resource]; ok {
+			continue
+		}
+		path := p.viewPath(resource)
+		if err := p.watches.Watch(path, uzk.WatchTypeData, p.onWatchEvent); err != nil {
+			p.logger.Warn("failed to watch external view", util.Field("resource", resource), util.ErrorField(err))
+			continue
+		}
+		p.watchedViews[resource] = struct{}{}
+	}
+}
+
+// readViews reads the external or target external views, or the customized views of the
+// customized state type, by resource name
+func (p *RoutingTableProvider) readViews() (map[string]*model.ExternalView, error) {
+	if p.customizedStateType == "" {
+		if p.view == RoutingViewTargetExternal {
+			return p.dataAccessor.TargetExternalViews()
+		}
+		return p.dataAccessor.ExternalViews()
+	}
+	customizedViews, err := p.dataAccessor.CustomizedViews(p.customizedStateType)
+	if err != nil {
+		return nil, err
+	}
+	views := make(map[string]*model.ExternalView, len(customizedViews))
+	for resource, view := range customizedViews {
+		views[resource] = &model.ExternalView{ZNRecord: view.ZNRecord}
+	}
+	return views, nil
+}
+
+func (p *RoutingTableProvider) viewsPath() string {
+	if p.customizedStateType == "" {
+		if p.view == RoutingViewTargetExternal {
+			return p.keyBuilder.targetExternalView()
+		}
+		return p.keyBuilder.externalView()
+	}
+	return p.keyBuilder.customizedViewsForType(p.customizedStateType)
+}
+
+func (p *RoutingTableProvider) viewPath(resource string) string {
+	if p.customizedStateType == "" {
+		if p.view == RoutingViewTargetExternal {
+			return p.keyBuilder.targetExternalViewForResource(resource)
+		}
+		return p.keyBuilder.externalViewForResource(resource)
+	}
+	return p.keyBuilder.customizedViewForResource(p.customizedStateType, resource)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestRoutingTable(t *testing.T) {
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "i1", StateModelStateOnline)
+	view.SetState("r1_0", "i2", StateModelStateOnline)
+	view.SetState("r1_1", "i2", StateModelStateOffline)
+	view.SetState("r1_1", "i3", StateModelStateOnline)
+	table := &RoutingTable{
+		externalViews: map[string]*model.ExternalView{"r1": view},
+		liveInstances: map[string]*model.LiveInstance{
+			"i1": model.NewLiveInstance("i1", "s1"),
+			"i2": model.NewLiveInstance("i2", "s2"),
+		},
+		instanceConfigs: map[string]*model.InstanceConfig{
+			"i1": model.NewInstanceConfig("i1"),
+			"i2": model.NewInstanceConfig("i2"),
+			"i3": model.NewInstanceConfig("i3"),
+		},
+	}
+	assert.Equal(t, []string{"r1"}, table.GetResources())
+	assert.Equal(t, []string{"r1_0", "r1_1"}, table.GetPartitions("r1"))
+	assert.Nil(t, table.GetPartitions("r2"))
+	assert.Equal(t, []string{"i1", "i2"}, table.GetLiveInstances())
+	assert.Equal(t, []string{"i1", "i2"}, instanceNames(table.GetInstances("r1", "r1_0", StateModelStateOnline)))
+	// i3 is not live
+	assert.Empty(t, table.GetInstances("r1", "r1_1", StateModelStateOnline))
+	assert.Equal(t, []string{"i1", "i2"},
+		instanceNames(table.GetInstancesForResource("r1", StateModelStateOnline)))
+	assert.Equal(t, []string{"i2"}, instanceNames(table.GetInstancesForResource("r1", StateModelStateOffline)))
+}
+
+func TestRoutingTableEndpoints(t *testing.T) {
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "::1_1", StateModelStateOnline)
+	view.SetState("r1_0", "::2_1", StateModelStateOnline)
+	view.SetState("r1_0", "::3_1", StateModelStateOnline)
+	configs := map[string]*model.InstanceConfig{}
+	liveInstances := map[string]*model.LiveInstance{}
+	for _, name := range []string{"::1_1", "::2_1", "::3_1"} {
+		configs[name] = model.NewInstanceConfig(name)
+		liveInstances[name] = model.NewLiveInstance(name, "s")
+	}
+	assert.NoError(t, configs["::1_1"].SetEndpoint("grpc", "[::1]:9090"))
+	assert.NoError(t, configs["::2_1"].SetEndpoint("grpc", "[::2]:9090"))
+	assert.NoError(t, configs["::3_1"].SetEndpoint("http", "[::3]:8080"))
+	table := &RoutingTable{
+		externalViews:   map[string]*model.ExternalView{"r1": view},
+		liveInstances:   liveInstances,
+		instanceConfigs: configs,
+	}
+	assert.Equal(t, []string{"[::1]:9090", "[::2]:9090"},
+		table.GetEndpoints("r1", "r1_0", StateModelStateOnline, "grpc"))
+	assert.Equal(t, []string{"[::3]:8080"}, table.GetEndpoints("r1", "r1_0", StateModelStateOnline, "http"))
+	assert.Empty(t, table.GetEndpoints("r1", "r1_0", StateModelStateOffline, "grpc"))
+}
+
+func TestRoutingTableResourceGroups(t *testing.T) {
+	// groupView is the external view of a resource of group g whose partition is ONLINE on the instance
+	groupView := func(resource, tag, instance string) *model.ExternalView {
+		idealState := model.NewIdealState(resource)
+		idealState.SetGroupRoutingEnabled(true)
+		idealState.SetResourceGroupName("g")
+		idealState.SetInstanceGroupTag(tag)
+		view := model.NewExternalView(resource)
+		view.CopyRoutingFields(idealState)
+		view.SetState("g_0", instance, StateModelStateOnline)
+		return view
+	}
+	other := model.NewExternalView("r3")
+	other.SetState("g_0", "i3", StateModelStateOnline)
+	table := &RoutingTable{
+		externalViews: map[string]*model.ExternalView{
+			"r1": groupView("r1", "a", "i1"),
+			"r2": groupView("r2", "b", "i2"),
+			"r3": other,
+		},
+		liveInstances: map[string]*model.LiveInstance{
+			"i1": model.NewLiveInstance("i1", "s1"),
+			"i2": model.NewLiveInstance("i2", "s2"),
+			"i3": model.NewLiveInstance("i3", "s3"),
+		},
+		instanceConfigs: map[string]*model.InstanceConfig{
+			"i1": model.NewInstanceConfig("i1"),
+			"i2": model.NewInstanceConfig("i2"),
+			"i3": model.NewInstanceConfig("i3"),
+		},
+	}
+	assert.Equal(t, []string{"g"}, table.GetResourceGroups())
+	assert.Equal(t, []string{"r1"}, table.GetResourcesWithTag("a"))
+	assert.Equal(t, []string{"r3"}, table.GetResourcesWithTag(""))
+	assert.Equal(t, []string{"g_0"}, table.GetPartitionsForResourceGroup("g"))
+	assert.Empty(t, table.GetPartitionsForResourceGroup("h"))
+	// r3 is not in the group
+	assert.Equal(t, []string{"i1", "i2"},
+		instanceNames(table.GetInstancesForResourceGroup("g", "g_0", StateModelStateOnline)))
+	assert.Equal(t, []string{"i2"},
+		instanceNames(table.GetInstancesForResourceGroup("g", "g_0", StateModelStateOnline, "b")))
+	assert.Equal(t, []string{"i1", "i2"},
+		instanceNames(table.GetAllInstancesForResourceGroup("g", StateModelStateOnline, "a", "b")))
+	assert.Empty(t, table.GetAllInstancesForResourceGroup("g", StateModelStateOffline))
+}
+
+func TestRoutingTableProviderSources(t *testing.T) {
+	for _, source := range []RoutingSource{RoutingSourceWatch, RoutingSourcePoll, RoutingSourceWatchAndPoll} {
+		cluster := newFakeCluster(t)
+		fakeZK, keyBuilder, accessor := cluster.zk, cluster.keyBuilder, cluster.accessor
+		assert.NoError(t, accessor.createInstanceConfig(keyBuilder.participantConfig("i1"),
+			model.NewInstanceConfig("i1")))
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance("i1"),
+			model.NewLiveInstance("i1", "s1").ZNRecord))
+
+		provider := NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+			WithRoutingSource(source), WithRoutingPollInterval(20*time.Millisecond))
+		provider.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+			uzk.WithRetryTimeout(time.Second), uzk.WithReadOnly())
+		provider.dataAccessor = newDataAccessor(provider.zkClient, keyBuilder)
+		assert.NoError(t, provider.Connect())
+		assert.Empty(t, provider.GetRoutingTable().GetResources())
+
+		view := model.NewExternalView("r1")
+		view.SetState("r1_0", "i1", StateModelStateOnline)
+		assert.NoError(t, accessor.createData(keyBuilder.externalViewForResource("r1"), view.ZNRecord))
+		waitForRoutingTable(t, provider, func(table *RoutingTable) bool {
+			return len(table.GetInstances("r1", "r1_0", StateModelStateOnline)) == 1
+		})
+		view.SetState("r1_0", "i1", StateModelStateOffline)
+		assert.NoError(t, accessor.setData(keyBuilder.externalViewForResource("r1"), view.ZNRecord, -1))
+		waitForRoutingTable(t, provider, func(table *RoutingTable) bool {
+			return len(table.GetInstances("r1", "r1_0", StateModelStateOffline)) == 1
+		})
+
+		// no watch is set in the poll mode
+		watchCalls := 0
+		for _, conn := range fakeZK.GetConnections() {
+			for _, method := range []string{"ChildrenW", "GetW", "ExistsW"} {
+				watchCalls += len(conn.GetHistory().GetHistoryForMethod(method))
+			}
+		}
+		assert.Equal(t, source != RoutingSourcePoll, watchCalls > 0)
+		provider.Disconnect()
+		cluster.close()
+	}
+}
+
+func TestRoutingTableProviderTargetExternalView(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, keyBuilder, accessor := cluster.zk, cluster.keyBuilder, cluster.accessor
+	for _, instance := range []string{"i1", "i2"} {
+		assert.NoError(t, accessor.createInstanceConfig(keyBuilder.participantConfig(instance),
+			model.NewInstanceConfig(instance)))
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance(instance),
+			model.NewLiveInstance(instance, "s1").ZNRecord))
+	}
+	// r1_0 is moving from i1 to i2
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "i1", StateModelStateOnline)
+	assert.NoError(t, accessor.createData(keyBuilder.externalViewForResource("r1"), view.ZNRecord))
+	targetView := model.NewExternalView("r1")
+	targetView.SetState("r1_0", "i2", StateModelStateOnline)
+	assert.NoError(t, accessor.createData(keyBuilder.targetExternalViewForResource("r1"), targetView.ZNRecord))
+	targetViews, err := accessor.TargetExternalViews()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"i2": StateModelStateOnline}, targetViews["r1"].GetStateMap("r1_0"))
+
+	providers := make(map[RoutingView]*RoutingTableProvider)
+	for _, routingView := range []RoutingView{RoutingViewExternal, RoutingViewTargetExternal} {
+		provider := NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+			WithRoutingView(routingView))
+		provider.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+			uzk.WithRetryTimeout(time.Second), uzk.WithReadOnly())
+		provider.dataAccessor = newDataAccessor(provider.zkClient, keyBuilder)
+		assert.NoError(t, provider.Connect())
+		defer provider.Disconnect()
+		providers[routingView] = provider
+	}
+	assert.Equal(t, map[string]string{"i1": StateModelStateOnline},
+		providers[RoutingViewExternal].GetRoutingTable().GetStateMap("r1", "r1_0"))
+	assert.Equal(t, map[string]string{"i2": StateModelStateOnline},
+		providers[RoutingViewTargetExternal].GetRoutingTable().GetStateMap("r1", "r1_0"))
+
+	// the target external view provider follows the updates of the target external views only
+	targetView.SetState("r1_0", "i1", StateModelStateOnline)
+	assert.NoError(t, accessor.setData(keyBuilder.targetExternalViewForResource("r1"), targetView.ZNRecord, -1))
+	waitForRoutingTable(t, providers[RoutingViewTargetExternal], func(table *RoutingTable) bool {
+		return len(table.GetInstances("r1", "r1_0", StateModelStateOnline)) == 2
+	})
+	assert.Len(t, providers[RoutingViewExternal].GetRoutingTable().GetInstances("r1", "r1_0",
+		StateModelStateOnline), 1)
+}
+
+func instanceNames(configs []*model.InstanceConfig) []string {
+	var names []string
+	for _, config := range configs {
+		names = append(names, config.ID)
+	}
+	return names
+}
+
+func waitForRoutingTable(t *testing.T, provider *RoutingTableProvider, condition func(*RoutingTable) bool) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if condition(provider.GetRoutingTable()) {
+			return
+		}
+	}
+	assert.FailNow(t, "timed out waiting for the routing table")
+}
+
+func TestRoutingTableGenerations(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, keyBuilder, accessor := cluster.zk, cluster.keyBuilder, cluster.accessor
+
+	provider := NewRoutingTableProvider(zap.NewNop(), tally.NoopScope, "", TestClusterName)
+	provider.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second), uzk.WithReadOnly())
+	provider.dataAccessor = newDataAccessor(provider.zkClient, keyBuilder)
+	assert.Equal(t, uint64(0), provider.GetRoutingTable().Generation())
+	assert.NoError(t, provider.Connect())
+	defer provider.Disconnect()
+	first := provider.GetRoutingTable()
+	assert.Equal(t, uint64(1), first.Generation())
+	assert.False(t, first.RefreshedAt().IsZero())
+
+	// the waiters time out if no refresh happens
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := provider.WaitForGeneration(ctx, 2)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	tableCh := make(chan *RoutingTable)
+	go func() {
+		table, err := provider.WaitForGeneration(context.Background(), 2)
+		assert.NoError(t, err)
+		tableCh <- table
+	}()
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "i1", StateModelStateOnline)
+	assert.NoError(t, accessor.createData(keyBuilder.externalViewForResource("r1"), view.ZNRecord))
+	select {
+	case table := <-tableCh:
+		assert.True(t, table.Generation() >= 2)
+		assert.Equal(t, table.Generation(), provider.Generation())
+	case <-time.After(time.Second):
+		assert.FailNow(t, "timed out waiting for the generation")
+	}
+
+	// the previous snapshot is unchanged and its state maps are copies
+	assert.Empty(t, first.GetResources())
+	states := provider.GetRoutingTable().GetStateMap("r1", "r1_0")
+	states["i1"] = StateModelStateOffline
+	assert.Equal(t, StateModelStateOnline, provider.GetRoutingTable().GetStateMap("r1", "r1_0")["i1"])
+}
+
+func TestRoutingTableLookupsDoNotAllocate(t *testing.T) {
+	table := benchmarkRoutingTable(10, 100, 3)
+	assert.Len(t, table.GetInstances("r0", "r0_0", StateModelStateOnline), 2)
+	allocs := testing.AllocsPerRun(100, func() {
+		table.GetInstances("r5", "r5_50", StateModelStateOnline)
+		table.GetInstances("r5", "r5_50", StateModelStateOffline)
+		table.GetInstances("r11", "r11_0", StateModelStateOnline)
+	})
+	assert.Equal(t, float64(0), allocs)
+
+	// an append does not change the snapshot
+	instances := table.GetInstances("r0", "r0_0", StateModelStateOnline)
+	_ = append(instances, model.NewInstanceConfig("other"))
+	assert.Len(t, table.GetInstances("r0", "r0_0", StateModelStateOnline), 2)
+}
+
+// benchmarkRoutingTable returns a table whose partitions are ONLINE on all the replicas but one,
+// which is OFFLINE
+func benchmarkRoutingTable(resources, partitions, replicas int) *RoutingTable {
+	table := &RoutingTable{
+		externalViews:   map[string]*model.ExternalView{},
+		liveInstances:   map[string]*model.LiveInstance{},
+		instanceConfigs: map[string]*model.InstanceConfig{},
+	}
+	instances := make([]string, 0, 2*replicas)
+	for i := 0; i < 2*replicas; i++ {
+		instance := fmt.Sprintf("host_%d", i)
+		instances = append(instances, instance)
+		table.liveInstances[instance] = model.NewLiveInstance(instance, "s")
+		table.instanceConfigs[instance] = model.NewInstanceConfig(instance)
+	}
+	for r := 0; r < resources; r++ {
+		resource := fmt.Sprintf("r%d", r)
+		view := model.NewExternalView(resource)
+		for p := 0; p < partitions; p++ {
+			partition := fmt.Sprintf("%s_%d", resource, p)
+			for i := 0; i < replicas; i++ {
+				state := StateModelStateOnline
+				if i == 0 {
+					state = StateModelStateOffline
+				}
+				view.SetState(partition, instances[(p+i)%len(instances)], state)
+			}
+		}
+		table.externalViews[resource] = view
+	}
+	return table
+}
+
+func BenchmarkRoutingTableGetInstances(b *testing.B) {
+	table := benchmarkRoutingTable(100, 1000, 3)
+	table.GetInstances("r0", "r0_0", StateModelStateOnline)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.GetInstances("r50", "r50_500", StateModelStateOnline)
+	}
+}
+
+func BenchmarkRoutingTableGetInstancesParallel(b *testing.B) {
+	table := benchmarkRoutingTable(100, 1000, 3)
+	table.GetInstances("r0", "r0_0", StateModelStateOnline)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			table.GetInstances("r50", "r50_500", StateModelStateOnline)
+		}
+	})
+}
+
+func BenchmarkRoutingTableGetEndpoints(b *testing.B) {
+	table := benchmarkRoutingTable(100, 1000, 3)
+	for _, config := range table.instanceConfigs {
+		if err := config.SetEndpoint("grpc", config.ID+":9090"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	table.GetInstances("r0", "r0_0", StateModelStateOnline)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.GetEndpoints("r50", "r50_500", StateModelStateOnline, "grpc")
+	}
+}
+
+func BenchmarkRoutingTableIndex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		table := benchmarkRoutingTable(10, 1000, 3)
+		b.StartTimer()
+		table.buildIndex()
+	}
+}
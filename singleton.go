@@ -0,0 +1,152 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"sync"
+
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// SingletonFunc is the work done by the leader of a partition, ctx is cancelled when the
+// instance loses the leadership and the function is expected to return soon after
+type SingletonFunc func(ctx context.Context, partition string) error
+
+// Singleton runs a SingletonFunc on the instance elected as the leader of each partition of
+// a LeaderStandby resource, so that at most one instance of the cluster runs it at a time.
+// Register the StateModelProcessor of the Singleton with the participant for the LeaderStandby
+// state model. Add the Singleton as an EventSink of the EventLog of the participant to also stop
+// the function as soon as the ZK session expires, before the controller elects a new leader
+type Singleton struct {
+	logger *zap.Logger
+	scope  tally.Scope
+	fn     SingletonFunc
+
+	mu sync.Mutex
+	// partition -> the run of the function on the partition
+	runs map[string]*singletonRun
+}
+
+type singletonRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSingleton creates a Singleton running fn on the leader instance
+func NewSingleton(logger *zap.Logger, scope tally.Scope, fn SingletonFunc) *Singleton {
+	return &Singleton{
+		logger: logger,
+		scope:  scope.SubScope("helix.singleton"),
+		fn:     fn,
+		runs:   make(map[string]*singletonRun),
+	}
+}
+
+// StateModelProcessor returns the processor of the LeaderStandby transitions,
+// the function is started on STANDBY->LEADER and stopped on LEADER->STANDBY
+func (s *Singleton) StateModelProcessor() *StateModelProcessor {
+	processor := NewStateModelProcessor()
+	noop := func(*model.Message) error { return nil }
+	processor.AddTransition(StateModelStateOffline, StateModelStateStandby, noop)
+	processor.AddTransition(StateModelStateStandby, StateModelStateOffline, noop)
+	processor.AddTransition(StateModelStateOffline, StateModelStateDropped, noop)
+	processor.AddTransition(StateModelStateError, StateModelStateOffline, noop)
+	processor.AddTransition(StateModelStateStandby, StateModelStateLeader, func(msg *model.Message) error {
+		partition, _ := msg.GetPartitionName()
+		s.start(partition)
+		return nil
+	})
+	processor.AddTransition(StateModelStateLeader, StateModelStateStandby, func(msg *model.Message) error {
+		partition, _ := msg.GetPartitionName()
+		s.stop(partition)
+		return nil
+	})
+	return processor
+}
+
+// IsLeader returns if the instance is the leader of the partition
+func (s *Singleton) IsLeader(partition string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.runs[partition]
+	return ok
+}
+
+// Write stops the functions when the ZK session expires, the leadership of the partitions
+// is given to other instances by the controller
+func (s *Singleton) Write(e Event) error {
+	if e.Type == EventTypeSessionExpired {
+		s.Stop()
+	}
+	return nil
+}
+
+// Stop cancels the running functions and waits for them to return
+func (s *Singleton) Stop() {
+	s.mu.Lock()
+	var partitions []string
+	for partition := range s.runs {
+		partitions = append(partitions, partition)
+	}
+	s.mu.Unlock()
+	for _, partition := range partitions {
+		s.stop(partition)
+	}
+}
+
+func (s *Singleton) start(partition string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.runs[partition]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &singletonRun{cancel: cancel, done: make(chan struct{})}
+	s.runs[partition] = run
+	s.scope.Gauge("leader").Update(float64(len(s.runs)))
+	s.logger.Info("singleton elected leader, starting", zap.String("partition", partition))
+	go func() {
+		defer close(run.done)
+		err := s.fn(ctx, partition)
+		if err != nil && ctx.Err() == nil {
+			s.scope.Counter("failures").Inc(1)
+			s.logger.Error("singleton function failed", zap.String("partition", partition), zap.Error(err))
+		}
+	}()
+}
+
+// stop cancels the function of the partition and waits for it to return
+func (s *Singleton) stop(partition string) {
+	s.mu.Lock()
+	run, ok := s.runs[partition]
+	delete(s.runs, partition)
+	s.scope.Gauge("leader").Update(float64(len(s.runs)))
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.logger.Info("singleton lost leadership, stopping", zap.String("partition", partition))
+	run.cancel()
+	<-run.done
+}
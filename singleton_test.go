@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func singletonTransition(t *testing.T, processor *StateModelProcessor, partition, fromState, toState string) {
+	handler, ok := processor.handler(fromState, toState)
+	assert.True(t, ok)
+	msg := model.NewMsg("id")
+	msg.SetPartitionName(partition)
+	assert.NoError(t, handler(context.Background(), msg))
+}
+
+func TestSingleton(t *testing.T) {
+	started := make(chan string, 10)
+	stopped := make(chan string, 10)
+	singleton := NewSingleton(zap.NewNop(), tally.NoopScope, func(ctx context.Context, partition string) error {
+		started <- partition
+		<-ctx.Done()
+		stopped <- partition
+		return nil
+	})
+	processor := singleton.StateModelProcessor()
+
+	singletonTransition(t, processor, "p_0", StateModelStateOffline, StateModelStateStandby)
+	assert.False(t, singleton.IsLeader("p_0"))
+	singletonTransition(t, processor, "p_0", StateModelStateStandby, StateModelStateLeader)
+	assert.True(t, singleton.IsLeader("p_0"))
+	assert.Equal(t, "p_0", <-started)
+
+	// the function has returned once the leadership is given up
+	singletonTransition(t, processor, "p_0", StateModelStateLeader, StateModelStateStandby)
+	assert.False(t, singleton.IsLeader("p_0"))
+	assert.Len(t, stopped, 1)
+	assert.Equal(t, "p_0", <-stopped)
+
+	// the function is stopped when the session expires
+	singletonTransition(t, processor, "p_0", StateModelStateStandby, StateModelStateLeader)
+	singletonTransition(t, processor, "p_1", StateModelStateStandby, StateModelStateLeader)
+	<-started
+	<-started
+	eventLog := NewEventLog(zap.NewNop(), 10, singleton)
+	eventLog.Record(Event{Type: EventTypeSessionEstablished})
+	assert.True(t, singleton.IsLeader("p_1"))
+	eventLog.Record(Event{Type: EventTypeSessionExpired})
+	assert.False(t, singleton.IsLeader("p_0"))
+	assert.False(t, singleton.IsLeader("p_1"))
+	assert.Len(t, stopped, 2)
+}
@@ -21,12 +21,22 @@
 package helix
 
 import (
+	"context"
+
 	"github.com/uber-go/go-helix/model"
 )
 
 // StateTransitionHandler is type for handler method
 type StateTransitionHandler func(msg *model.Message) error
 
+// ContextStateTransitionHandler is type for handler method receiving the context of the transition,
+// which carries the trace context when the participant is configured with WithTracerProvider
+type ContextStateTransitionHandler func(ctx context.Context, msg *model.Message) error
+
+// TransitionInterceptor is called around a state transition, it calls next to continue the chain
+// and can fail the transition without calling next, e.g. to veto the transition
+type TransitionInterceptor func(ctx context.Context, msg *model.Message, next ContextStateTransitionHandler) error
+
 // Transition associates a handler function with state transitions
 type Transition struct {
 	FromState string
@@ -39,12 +49,17 @@ type Transition struct {
 type StateModelProcessor struct {
 	// fromState->toState->StateTransitionHandler
 	Transitions map[string]map[string]StateTransitionHandler
+	// fromState->toState->ContextStateTransitionHandler
+	ContextTransitions map[string]map[string]ContextStateTransitionHandler
+	// Interceptors are called around every transition in the order they are added
+	Interceptors []TransitionInterceptor
 }
 
 // NewStateModelProcessor functions similarly to StateMachineEngine
 func NewStateModelProcessor() *StateModelProcessor {
 	return &StateModelProcessor{
-		Transitions: map[string]map[string]StateTransitionHandler{},
+		Transitions:        map[string]map[string]StateTransitionHandler{},
+		ContextTransitions: map[string]map[string]ContextStateTransitionHandler{},
 	}
 }
 
@@ -55,3 +70,52 @@ func (p *StateModelProcessor) AddTransition(fromState string, toState string, ha
 	}
 	p.Transitions[fromState][toState] = handler
 }
+
+// AddContextTransition adds a new transition handler receiving the context of the transition
+func (p *StateModelProcessor) AddContextTransition(
+	fromState string, toState string, handler ContextStateTransitionHandler) {
+	if p.ContextTransitions == nil {
+		p.ContextTransitions = map[string]map[string]ContextStateTransitionHandler{}
+	}
+	if _, ok := p.ContextTransitions[fromState]; !ok {
+		p.ContextTransitions[fromState] = make(map[string]ContextStateTransitionHandler)
+	}
+	p.ContextTransitions[fromState][toState] = handler
+}
+
+// AddInterceptor adds an interceptor called around every transition of the state model,
+// the first added interceptor is the outermost one
+func (p *StateModelProcessor) AddInterceptor(interceptor TransitionInterceptor) {
+	p.Interceptors = append(p.Interceptors, interceptor)
+}
+
+// handler returns the handler of a transition wrapped by the interceptors,
+// plain handlers are adapted to take the context
+func (p *StateModelProcessor) handler(fromState string, toState string) (ContextStateTransitionHandler, bool) {
+	if handler, ok := p.ContextTransitions[fromState][toState]; ok {
+		return p.intercept(handler), true
+	}
+	if handler, ok := p.Transitions[fromState][toState]; ok {
+		return p.intercept(func(_ context.Context, msg *model.Message) error {
+			return handler(msg)
+		}), true
+	}
+	return nil, false
+}
+
+func (p *StateModelProcessor) intercept(handler ContextStateTransitionHandler) ContextStateTransitionHandler {
+	for i := len(p.Interceptors) - 1; i >= 0; i-- {
+		interceptor, next := p.Interceptors[i], handler
+		handler = func(ctx context.Context, msg *model.Message) error {
+			return interceptor(ctx, msg, next)
+		}
+	}
+	return handler
+}
+
+// hasFromState returns if any handler is registered for transitions from the state
+func (p *StateModelProcessor) hasFromState(fromState string) bool {
+	_, ok := p.Transitions[fromState]
+	_, contextOk := p.ContextTransitions[fromState]
+	return ok || contextOk
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+	"sync"
+)
+
+// stateModelKey identifies a registration by state model definition and factory name,
+// mirrors the keys of org.apache.helix.participant.HelixStateMachineEngine
+type stateModelKey struct {
+	stateModel string
+	factory    string
+}
+
+// registeredStateModel is a processor or a factory of partition state models registered with
+// the participant, the transitions are serialized by its lock and do not wait for the other
+// registrations
+type registeredStateModel struct {
+	sync.Mutex
+	processor *StateModelProcessor
+	factory   PartitionStateModelFactory
+
+	partitionsMu sync.Mutex
+	// resource -> partition -> state model created by factory
+	partitions map[string]map[string]PartitionStateModel
+}
+
+// stateModelRegistry holds the processors of the state models handled by a participant, e.g.
+// MasterSlave for a resource and OnlineOffline for another one
+type stateModelRegistry struct {
+	mu      sync.RWMutex
+	entries map[stateModelKey]*registeredStateModel
+}
+
+func newStateModelRegistry() *stateModelRegistry {
+	return &stateModelRegistry{entries: make(map[stateModelKey]*registeredStateModel)}
+}
+
+// register adds the processor of the state model and factory, replacing the previous one
+func (r *stateModelRegistry) register(stateModel string, factory string, processor *StateModelProcessor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[stateModelKey{stateModel, factory}] = &registeredStateModel{processor: processor}
+}
+
+// registerFactory adds the factory of the partition state models of the state model and factory
+// name, replacing the previous registration
+func (r *stateModelRegistry) registerFactory(
+	stateModel string, factoryName string, factory PartitionStateModelFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[stateModelKey{stateModel, factoryName}] = &registeredStateModel{
+		factory:    factory,
+		partitions: make(map[string]map[string]PartitionStateModel),
+	}
+}
+
+// resetPartitions resets the partition state models of all the registrations
+func (r *stateModelRegistry) resetPartitions() {
+	r.mu.RLock()
+	entries := make([]*registeredStateModel, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	r.mu.RUnlock()
+	for _, entry := range entries {
+		entry.resetPartitions()
+	}
+}
+
+// lookup returns the processor registered for the state model and factory,
+// falling back to the processor of the default factory
+func (r *stateModelRegistry) lookup(stateModel string, factory string) (*registeredStateModel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if entry, ok := r.entries[stateModelKey{stateModel, factory}]; ok {
+		return entry, true
+	}
+	entry, ok := r.entries[stateModelKey{stateModel, StateModelFactoryNameDefault}]
+	return entry, ok
+}
+
+// stateModels returns the sorted names of the registered state models
+func (r *stateModelRegistry) stateModels() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]struct{}, len(r.entries))
+	var names []string
+	for key := range r.entries {
+		if _, ok := seen[key.stateModel]; !ok {
+			seen[key.stateModel] = struct{}{}
+			names = append(names, key.stateModel)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateModelRegistry(t *testing.T) {
+	registry := newStateModelRegistry()
+	_, ok := registry.lookup(StateModelNameOnlineOffline, StateModelFactoryNameDefault)
+	assert.False(t, ok)
+
+	defaultProcessor, customProcessor := NewStateModelProcessor(), NewStateModelProcessor()
+	registry.register(StateModelNameOnlineOffline, StateModelFactoryNameDefault, defaultProcessor)
+	registry.register(StateModelNameOnlineOffline, "custom", customProcessor)
+	registry.register(StateModelNameLeaderStandby, "custom", NewStateModelProcessor())
+
+	entry, ok := registry.lookup(StateModelNameOnlineOffline, "custom")
+	assert.True(t, ok)
+	assert.True(t, entry.processor == customProcessor)
+	// the factories not registered fall back to the default one
+	entry, ok = registry.lookup(StateModelNameOnlineOffline, "other")
+	assert.True(t, ok)
+	assert.True(t, entry.processor == defaultProcessor)
+	_, ok = registry.lookup(StateModelNameLeaderStandby, StateModelFactoryNameDefault)
+	assert.False(t, ok)
+	assert.Equal(t, []string{StateModelNameLeaderStandby, StateModelNameOnlineOffline}, registry.stateModels())
+}
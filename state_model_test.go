@@ -21,9 +21,12 @@
 package helix
 
 import (
+	"context"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber-go/go-helix/model"
 )
 
 const (
@@ -92,3 +95,60 @@ func (s *StateModelTestSuite) TestRemoveNonExistentState() {
 	_, exist = stateModel.GetState(_testResource, _testPartition)
 	s.False(exist)
 }
+
+func (s *StateModelTestSuite) TestContextTransition() {
+	processor := NewStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		return nil
+	})
+	processor.AddContextTransition(StateModelStateOnline, StateModelStateOffline,
+		func(ctx context.Context, m *model.Message) error {
+			return ctx.Err()
+		})
+
+	handler, ok := processor.handler(StateModelStateOffline, StateModelStateOnline)
+	s.True(ok)
+	s.NoError(handler(context.Background(), model.NewMsg("msg")))
+	handler, ok = processor.handler(StateModelStateOnline, StateModelStateOffline)
+	s.True(ok)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Equal(context.Canceled, handler(ctx, model.NewMsg("msg")))
+	_, ok = processor.handler(StateModelStateOnline, StateModelStateDropped)
+	s.False(ok)
+	s.True(processor.hasFromState(StateModelStateOnline))
+	s.False(processor.hasFromState(StateModelStateDropped))
+}
+
+func (s *StateModelTestSuite) TestTransitionInterceptors() {
+	var calls []string
+	processor := NewStateModelProcessor()
+	processor.AddTransition(StateModelStateOffline, StateModelStateOnline, func(m *model.Message) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	processor.AddInterceptor(func(ctx context.Context, m *model.Message, next ContextStateTransitionHandler) error {
+		calls = append(calls, "first-pre")
+		err := next(ctx, m)
+		calls = append(calls, "first-post")
+		return err
+	})
+	processor.AddInterceptor(func(ctx context.Context, m *model.Message, next ContextStateTransitionHandler) error {
+		if partition, _ := m.GetPartitionName(); partition == "vetoed" {
+			return errors.New("vetoed")
+		}
+		calls = append(calls, "second-pre")
+		return next(ctx, m)
+	})
+
+	handler, ok := processor.handler(StateModelStateOffline, StateModelStateOnline)
+	s.True(ok)
+	s.NoError(handler(context.Background(), model.NewMsg("msg")))
+	s.Equal([]string{"first-pre", "second-pre", "handler", "first-post"}, calls)
+
+	calls = nil
+	msg := model.NewMsg("msg")
+	msg.SetPartitionName("vetoed")
+	s.EqualError(handler(context.Background(), msg), "vetoed")
+	s.Equal([]string{"first-pre", "first-post"}, calls)
+}
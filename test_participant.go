@@ -40,9 +40,10 @@ func NewTestParticipant(
 	resourceName string,
 	host string,
 	port int32,
+	options ...ParticipantOption,
 ) (*TestParticipant, <-chan error) {
-	participant, fatalErrChan :=
-		NewParticipant(logger, scope, zkConnectString, application, clusterName, resourceName, host, port)
+	participant, fatalErrChan := NewParticipant(logger, scope, zkConnectString, application,
+		clusterName, resourceName, host, port, options...)
 	return &TestParticipant{participant}, fatalErrChan
 }
 
@@ -50,7 +50,7 @@ type BaseHelixTestSuite struct {
 	Admin *Admin
 }
 
-// SetupSuite ensures zk server is up
+// SetupSuite ensures zk server is up and the test cluster is set up in the chroot of the suite
 func (s *BaseHelixTestSuite) SetupSuite() {
 	s.BaseZkTestSuite.SetupSuite()
 	admin, err := NewAdmin(s.ZkConnectString)
@@ -60,11 +60,12 @@ func (s *BaseHelixTestSuite) SetupSuite() {
 	s.ensureHelixClusterUp()
 }
 
-// TearDownSuite disconnects zk if not done already
+// TearDownSuite disconnects zk if not done already and deletes the chroot of the suite
 func (s *BaseHelixTestSuite) TearDownSuite() {
-	if s.Admin.zkClient.IsConnected() {
+	if s.Admin != nil && s.Admin.zkClient.IsConnected() {
 		s.Admin.zkClient.Disconnect()
 	}
+	s.BaseZkTestSuite.TearDownSuite()
 }
 
 // GetRandomPort returns random valid port number (1~65535)
@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/uber-go/go-helix/model"
+)
+
+const _defaultDomainValuePrefix = "Helix_default_"
+
+// Topology groups the instances of a cluster by fault zone. With topology awareness enabled
+// in the cluster config, the fault zone of an instance is the path of its DOMAIN values from
+// the top of the TOPOLOGY down to the FAULT_ZONE_TYPE, e.g. z1/r1 for /zone/rack/instance
+// and rack. Otherwise the ZONE_ID of the instance is used, and the instances without one
+// form a zone of their own.
+// This mirrors org.apache.helix.controller.rebalancer.topology.Topology
+type Topology struct {
+	zoneOf  map[string]string
+	zones   map[string][]string
+	weights map[string]int
+}
+
+// NewTopology creates the Topology of the instances, clusterConfig can be nil
+func NewTopology(clusterConfig *model.ClusterConfig, instances []*model.InstanceConfig) *Topology {
+	t := &Topology{
+		zoneOf:  map[string]string{},
+		zones:   map[string][]string{},
+		weights: map[string]int{},
+	}
+	levels := topologyLevels(clusterConfig)
+	for _, instance := range instances {
+		zone := faultZoneOf(instance, levels)
+		t.zoneOf[instance.ID] = zone
+		t.zones[zone] = append(t.zones[zone], instance.ID)
+		t.weights[zone] += instance.GetWeight()
+	}
+	for _, zoneInstances := range t.zones {
+		sort.Strings(zoneInstances)
+	}
+	return t
+}
+
+// topologyLevels returns the levels of the topology down to the fault zone type,
+// or nil if the placement is not topology aware
+func topologyLevels(clusterConfig *model.ClusterConfig) []string {
+	if clusterConfig == nil || !clusterConfig.IsTopologyAwareEnabled() {
+		return nil
+	}
+	var levels []string
+	faultZoneType := clusterConfig.GetFaultZoneType()
+	for _, level := range strings.Split(clusterConfig.GetTopology(), "/") {
+		if level == "" {
+			continue
+		}
+		levels = append(levels, level)
+		if level == faultZoneType {
+			break
+		}
+	}
+	return levels
+}
+
+func faultZoneOf(instance *model.InstanceConfig, levels []string) string {
+	if len(levels) == 0 {
+		if zoneID := instance.GetZoneID(); zoneID != "" {
+			return zoneID
+		}
+		return instance.ID
+	}
+	domain := instance.GetDomainAsMap()
+	values := make([]string, 0, len(levels))
+	for _, level := range levels {
+		value, ok := domain[level]
+		if !ok {
+			value = _defaultDomainValuePrefix + level
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, "/")
+}
+
+// Zones returns the sorted fault zones
+func (t *Topology) Zones() []string {
+	zones := make([]string, 0, len(t.zones))
+	for zone := range t.zones {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// FaultZone returns the fault zone of the instance
+func (t *Topology) FaultZone(instance string) (string, bool) {
+	zone, ok := t.zoneOf[instance]
+	return zone, ok
+}
+
+// InstancesInZone returns the sorted instances of the fault zone
+func (t *Topology) InstancesInZone(zone string) []string {
+	return t.zones[zone]
+}
+
+// GroupByZone groups the instances by fault zone, the instances not in the topology are skipped
+func (t *Topology) GroupByZone(instances []string) map[string][]string {
+	result := map[string][]string{}
+	for _, instance := range instances {
+		if zone, ok := t.zoneOf[instance]; ok {
+			result[zone] = append(result[zone], instance)
+		}
+	}
+	return result
+}
+
+// ZoneWeight returns the sum of the weights of the instances of the fault zone
+func (t *Topology) ZoneWeight(zone string) int {
+	return t.weights[zone]
+}
+
+// MaxReplicasPerZone returns the replicas of a partition each fault zone holds at most
+// when the replicas are spread evenly over the zones
+func (t *Topology) MaxReplicasPerZone(replicas int) int {
+	if len(t.zones) == 0 {
+		return 0
+	}
+	return (replicas + len(t.zones) - 1) / len(t.zones)
+}
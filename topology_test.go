@@ -0,0 +1,100 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func newTestDomainInstances(domains ...string) []*model.InstanceConfig {
+	instances := newTestInstances(make([]string, len(domains))...)
+	for i, domain := range domains {
+		instances[i].SetDomain(domain)
+	}
+	return instances
+}
+
+func TestTopologyFaultZones(t *testing.T) {
+	clusterConfig := model.NewClusterConfig("cluster")
+	clusterConfig.SetTopology("/zone/rack/instance")
+	clusterConfig.SetFaultZoneType("rack")
+	clusterConfig.SetTopologyAwareEnabled(true)
+	instances := newTestDomainInstances(
+		"zone=z1,rack=r1,instance=i0",
+		"zone=z1,rack=r1,instance=i1",
+		"zone=z1,rack=r2,instance=i2",
+		"zone=z2,rack=r1,instance=i3",
+		"rack=r1,instance=i4",
+	)
+	instances[1].SetWeight(500)
+	topology := NewTopology(clusterConfig, instances)
+
+	assert.Equal(t, []string{"Helix_default_zone/r1", "z1/r1", "z1/r2", "z2/r1"}, topology.Zones())
+	zone, ok := topology.FaultZone(instances[2].ID)
+	assert.True(t, ok)
+	assert.Equal(t, "z1/r2", zone)
+	_, ok = topology.FaultZone("unknown")
+	assert.False(t, ok)
+	assert.Equal(t, []string{instances[0].ID, instances[1].ID}, topology.InstancesInZone("z1/r1"))
+	assert.Equal(t, 1500, topology.ZoneWeight("z1/r1"))
+	assert.Equal(t, map[string][]string{"z1/r1": {instances[0].ID}, "z2/r1": {instances[3].ID}},
+		topology.GroupByZone([]string{instances[0].ID, instances[3].ID, "unknown"}))
+	assert.Equal(t, 1, topology.MaxReplicasPerZone(3))
+	assert.Equal(t, 2, topology.MaxReplicasPerZone(5))
+
+	clusterConfig.SetFaultZoneType("zone")
+	topology = NewTopology(clusterConfig, instances)
+	assert.Equal(t, []string{"Helix_default_zone", "z1", "z2"}, topology.Zones())
+}
+
+func TestTopologyWithoutTopologyAwareness(t *testing.T) {
+	instances := newTestInstances("r1", "r1", "")
+	topology := NewTopology(nil, instances)
+	assert.Equal(t, []string{instances[2].ID, "r1"}, topology.Zones())
+	assert.Equal(t, 0, NewTopology(nil, nil).MaxReplicasPerZone(3))
+}
+
+func TestCrushStrategyWithTopology(t *testing.T) {
+	clusterConfig := model.NewClusterConfig("cluster")
+	clusterConfig.SetTopology("/zone/instance")
+	clusterConfig.SetFaultZoneType("zone")
+	clusterConfig.SetTopologyAwareEnabled(true)
+	instances := newTestDomainInstances(
+		"zone=z1,instance=i0", "zone=z1,instance=i1",
+		"zone=z2,instance=i2", "zone=z2,instance=i3",
+	)
+	topology := NewTopology(clusterConfig, instances)
+	partitions := newTestPartitions(20)
+	for _, strategy := range []PlacementStrategy{
+		CrushStrategy{ClusterConfig: clusterConfig},
+		RackAwareStrategy{ClusterConfig: clusterConfig},
+	} {
+		lists := strategy.ComputePreferenceLists(partitions, instances, 2)
+		assertDistinctReplicas(t, lists, partitions, 2)
+		for _, preferenceList := range lists {
+			zones := topology.GroupByZone(preferenceList)
+			assert.Len(t, zones, 2)
+		}
+	}
+}
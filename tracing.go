@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+
+	"github.com/uber-go/go-helix/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of the participant
+const TracerName = "github.com/uber-go/go-helix"
+
+// WithTracerProvider enables OpenTelemetry spans for message handling, state transitions
+// and ZK round trips, the round trips of the message handling are children of its span.
+// The trace context is passed to the handlers added by AddContextTransition
+func WithTracerProvider(tp trace.TracerProvider) ParticipantOption {
+	return func(p *participant) {
+		p.tracerProvider = tp
+	}
+}
+
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(TracerName)
+}
+
+// startMsgSpan starts a span with the attributes of the message
+func (p *participant) startMsgSpan(
+	ctx context.Context, name string, msg *model.Message) (context.Context, trace.Span) {
+	partition, _ := msg.GetPartitionName()
+	return p.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("helix.cluster", p.clusterName),
+		attribute.String("helix.instance", p.instanceName),
+		attribute.String("helix.msg.id", msg.ID),
+		attribute.String("helix.msg.type", msg.GetMsgType()),
+		attribute.String("helix.resource", msg.GetResourceName()),
+		attribute.String("helix.partition", partition),
+		attribute.String("helix.from_state", msg.GetFromState()),
+		attribute.String("helix.to_state", msg.GetToState()),
+	))
+}
+
+// endSpan records the error if any and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
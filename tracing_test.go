@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestMessageTracingZkSpans(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	p, _ := NewParticipant(zap.NewNop(), tally.NoopScope, "", testApplication, TestClusterName, TestResource,
+		testParticipantHost, 1, WithTracerProvider(tp),
+		WithParticipantZkClientOptions(cluster.zkClientOptions()...))
+	pImpl := p.(*participant)
+	pImpl.RegisterStateModel(StateModelNameOnlineOffline, createNoopStateModelProcessor())
+	require.NoError(t, pImpl.Connect())
+	defer pImpl.Disconnect()
+
+	msg := model.NewMsg(CreateRandomString())
+	msg.SetMsgType(MsgTypeStateTransition)
+	msg.SetSimpleField(model.FieldKeyStateModelDef, StateModelNameOnlineOffline)
+	msg.SetSimpleField(model.FieldKeyTargetSessionID, pImpl.zkClient.GetSessionID())
+	msg.SetSimpleField(model.FieldKeyFromState, StateModelStateOffline)
+	msg.SetSimpleField(model.FieldKeyToState, StateModelStateOnline)
+	msg.SetSimpleField(model.FieldKeyResourceName, CreateRandomString())
+	msg.SetSimpleField(model.FieldKeyPartitionName, strconv.Itoa(1))
+	msg.SetMsgState(model.MessageStateNew)
+	msg.SetCorrelationID(CreateRandomString())
+	msg.SetSrcName("controller")
+	assert.NoError(t, pImpl.handleMsg(msg))
+
+	var msgSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "helix.handle_message" {
+			msgSpan = span
+		}
+	}
+	require.NotNil(t, msgSpan)
+	// the ZK round trips of the message handling are children of the span of the message:
+	// the state model definition read, the message deletion and the reply
+	children := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == msgSpan.SpanContext().SpanID() {
+			assert.Equal(t, msgSpan.SpanContext().TraceID(), span.SpanContext().TraceID())
+			children[span.Name()] = true
+		}
+	}
+	assert.True(t, children["zk.get"], "%v", children)
+	assert.True(t, children["zk.children"], "%v", children)
+	assert.True(t, children["zk.create"], "%v", children)
+}
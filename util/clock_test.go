@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Second)
+		close(done)
+	}()
+	after := clock.After(2 * time.Second)
+	clock.BlockUntil(2)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, clock.Since(start))
+	select {
+	case <-done:
+		assert.Fail(t, "slept less than the duration")
+	case <-after:
+		assert.Fail(t, "fired before the deadline")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	<-done
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-after)
+
+	// the past deadlines fire right away
+	assert.Equal(t, start.Add(2*time.Second), <-clock.After(0))
+}
+
+func TestRealClock(t *testing.T) {
+	start := RealClock.Now()
+	RealClock.Sleep(time.Millisecond)
+	<-RealClock.After(time.Millisecond)
+	assert.True(t, RealClock.Since(start) >= 2*time.Millisecond)
+}
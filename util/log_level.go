@@ -0,0 +1,87 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	_logLevelsMu sync.Mutex
+	// _logLevels are the runtime log levels by component
+	_logLevels = map[string]zap.AtomicLevel{}
+)
+
+// LogLevel returns the runtime log level of the component, changing it applies at once to the
+// loggers of the component. It starts at DebugLevel, which lets through all the lines the loggers
+// would write
+func LogLevel(component string) zap.AtomicLevel {
+	_logLevelsMu.Lock()
+	defer _logLevelsMu.Unlock()
+	level, ok := _logLevels[component]
+	if !ok {
+		level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+		_logLevels[component] = level
+	}
+	return level
+}
+
+// WithLogLevel returns the logger dropping the lines below the runtime log level of the component
+func WithLogLevel(logger Logger, component string) Logger {
+	return levelLogger{logger: logger, level: LogLevel(component)}
+}
+
+// levelLogger is a Logger dropping the lines below a level
+type levelLogger struct {
+	logger Logger
+	level  zapcore.LevelEnabler
+}
+
+func (l levelLogger) Debug(msg string, fields ...LogField) {
+	if l.level.Enabled(zapcore.DebugLevel) {
+		l.logger.Debug(msg, fields...)
+	}
+}
+
+func (l levelLogger) Info(msg string, fields ...LogField) {
+	if l.level.Enabled(zapcore.InfoLevel) {
+		l.logger.Info(msg, fields...)
+	}
+}
+
+func (l levelLogger) Warn(msg string, fields ...LogField) {
+	if l.level.Enabled(zapcore.WarnLevel) {
+		l.logger.Warn(msg, fields...)
+	}
+}
+
+func (l levelLogger) Error(msg string, fields ...LogField) {
+	if l.level.Enabled(zapcore.ErrorLevel) {
+		l.logger.Error(msg, fields...)
+	}
+}
+
+func (l levelLogger) With(fields ...LogField) Logger {
+	return levelLogger{logger: l.logger.With(fields...), level: l.level}
+}
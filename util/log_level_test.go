@@ -0,0 +1,48 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithLogLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := WithLogLevel(LoggerFromZap(zap.New(core)), "test").With(Field("cluster", "c1"))
+	logger.Debug("dropped by the logger")
+	logger.Info("written")
+	assert.Equal(t, 1, logs.Len())
+
+	LogLevel("test").SetLevel(zapcore.WarnLevel)
+	defer LogLevel("test").SetLevel(zapcore.DebugLevel)
+	logger.Info("dropped by the level of the component")
+	logger.Warn("written")
+	assert.Equal(t, 2, logs.Len())
+	assert.Equal(t, zapcore.WarnLevel, logs.All()[1].Level)
+	assert.Equal(t, map[string]interface{}{"cluster": "c1"}, logs.All()[1].ContextMap())
+	// the other components are not affected
+	assert.Equal(t, zapcore.DebugLevel, LogLevel("other").Level())
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"go.uber.org/zap"
+)
+
+// LogField is a key-value pair of a structured log line
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Field returns the LogField of the key and value
+func Field(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// ErrorField returns the LogField of the error, under the key "error"
+func ErrorField(err error) LogField {
+	return LogField{Key: "error", Value: err}
+}
+
+// Logger is the minimal logger the Helix components log to, which lets the users of other
+// logging libraries than zap, e.g. logrus or zerolog, plug theirs in
+type Logger interface {
+	Debug(msg string, fields ...LogField)
+	Info(msg string, fields ...LogField)
+	Warn(msg string, fields ...LogField)
+	Error(msg string, fields ...LogField)
+	// With returns a Logger adding the fields to all its log lines
+	With(fields ...LogField) Logger
+}
+
+// LoggerFromZap adapts a zap logger to the Logger interface
+func LoggerFromZap(logger *zap.Logger) Logger {
+	return zapLogger{logger}
+}
+
+// NopLogger returns a Logger dropping all the lines
+func NopLogger() Logger {
+	return zapLogger{zap.NewNop()}
+}
+
+// zapLogger is the Logger writing to a zap logger
+type zapLogger struct {
+	logger *zap.Logger
+}
+
+func (l zapLogger) Debug(msg string, fields ...LogField) {
+	l.logger.Debug(msg, zapFields(fields)...)
+}
+
+func (l zapLogger) Info(msg string, fields ...LogField) {
+	l.logger.Info(msg, zapFields(fields)...)
+}
+
+func (l zapLogger) Warn(msg string, fields ...LogField) {
+	l.logger.Warn(msg, zapFields(fields)...)
+}
+
+func (l zapLogger) Error(msg string, fields ...LogField) {
+	l.logger.Error(msg, zapFields(fields)...)
+}
+
+func (l zapLogger) With(fields ...LogField) Logger {
+	return zapLogger{l.logger.With(zapFields(fields)...)}
+}
+
+// zapFields converts the LogFields to zap fields, skipping the nil values like zap.Error does
+// for nil errors
+func zapFields(fields []LogField) []zap.Field {
+	result := make([]zap.Field, 0, len(fields))
+	for _, field := range fields {
+		switch value := field.Value.(type) {
+		case nil:
+		case error:
+			result = append(result, zap.NamedError(field.Key, value))
+		default:
+			result = append(result, zap.Any(field.Key, value))
+		}
+	}
+	return result
+}
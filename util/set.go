@@ -20,6 +20,8 @@
 
 package util
 
+import "sort"
+
 // StringSet is a wrapper for a hash set that stores string keys
 type StringSet map[string]struct{}
 
@@ -64,3 +66,13 @@ func (s StringSet) Size() int {
 func (s StringSet) IsEmpty() bool {
 	return len(s) == 0
 }
+
+// ToSortedSlice returns the keys of the set in ascending order
+func (s StringSet) ToSortedSlice() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -40,4 +40,7 @@ func TestSet(t *testing.T) {
 	set.AddAll("a", "b")
 	assert.Equal(t, 2, set.Size())
 	assert.False(t, set.IsEmpty())
+	set.AddAll("c", "0")
+	assert.Equal(t, []string{"0", "a", "b", "c"}, set.ToSortedSlice())
+	assert.Equal(t, []string{}, NewStringSet().ToSortedSlice())
 }
@@ -0,0 +1,271 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// DefaultVerifierPollInterval is the default interval the external views are verified at by VerifyByPolling
+const DefaultVerifierPollInterval = time.Second
+
+// ErrExternalViewNotConverged is returned by VerifyByPolling if the external views
+// do not converge to the best possible mapping before the timeout
+var ErrExternalViewNotConverged = errors.New("external view not converged to the best possible mapping")
+
+// ExternalViewMismatch is a partition whose external view differs from the best possible mapping
+type ExternalViewMismatch struct {
+	Resource  string
+	Partition string
+	// Expected and Actual are the states by instance, leaving out the initial and DROPPED states
+	Expected map[string]string
+	Actual   map[string]string
+}
+
+func (m ExternalViewMismatch) String() string {
+	return fmt.Sprintf("%s %s: expected %v, actual %v", m.Resource, m.Partition, m.Expected, m.Actual)
+}
+
+// VerifierOption configures optional settings of a BestPossibleExternalViewVerifier
+type VerifierOption func(*BestPossibleExternalViewVerifier)
+
+// WithVerifiedResources limits the verification to the resources, all the resources
+// with ideal states are verified by default
+func WithVerifiedResources(resources ...string) VerifierOption {
+	return func(v *BestPossibleExternalViewVerifier) {
+		v.resources = util.NewStringSet(resources...)
+	}
+}
+
+// WithVerifierRebalancer registers the rebalancer computing the best possible mapping of the
+// USER_DEFINED resources whose REBALANCER_CLASS_NAME is the name, as with Controller.RegisterRebalancer
+func WithVerifierRebalancer(name string, rebalancer Rebalancer) VerifierOption {
+	return func(v *BestPossibleExternalViewVerifier) {
+		v.rebalancers[name] = rebalancer
+	}
+}
+
+// WithVerifierPollInterval sets the interval the external views are verified at by VerifyByPolling
+func WithVerifierPollInterval(interval time.Duration) VerifierOption {
+	return func(v *BestPossibleExternalViewVerifier) {
+		v.pollInterval = interval
+	}
+}
+
+// BestPossibleExternalViewVerifier verifies that the external views of a cluster match
+// the best possible mapping computed from the ideal states and the enabled live instances,
+// e.g. to wait in integration tests or to gate rollouts until a cluster is stable.
+// The initial and DROPPED states are left out of the comparison.
+// This mirrors org.apache.helix.tools.ClusterVerifiers.BestPossibleExternalViewVerifier
+type BestPossibleExternalViewVerifier struct {
+	logger       *zap.Logger
+	zkClient     *uzk.Client
+	dataAccessor *DataAccessor
+	resources    util.StringSet
+	rebalancers  map[string]Rebalancer
+	pollInterval time.Duration
+}
+
+// NewBestPossibleExternalViewVerifier creates a BestPossibleExternalViewVerifier of the cluster
+func NewBestPossibleExternalViewVerifier(
+	logger *zap.Logger,
+	scope tally.Scope,
+	zkConnectString string,
+	clusterName string,
+	options ...VerifierOption,
+) *BestPossibleExternalViewVerifier {
+	v := &BestPossibleExternalViewVerifier{
+		logger:       logger.With(zap.String("cluster", clusterName)),
+		rebalancers:  map[string]Rebalancer{},
+		pollInterval: DefaultVerifierPollInterval,
+	}
+	for _, option := range options {
+		option(v)
+	}
+	v.zkClient = uzk.NewClient(logger, scope, uzk.WithZkSvr(zkConnectString),
+		uzk.WithSessionTimeout(uzk.DefaultSessionTimeout))
+	v.dataAccessor = newDataAccessor(v.zkClient, &KeyBuilder{clusterName})
+	return v
+}
+
+// Connect connects the verifier to Zookeeper
+func (v *BestPossibleExternalViewVerifier) Connect() error {
+	if v.zkClient.IsConnected() {
+		return nil
+	}
+	return errors.Wrap(v.zkClient.Connect(), "helix verifier")
+}
+
+// Disconnect disconnects the verifier from Zookeeper
+func (v *BestPossibleExternalViewVerifier) Disconnect() {
+	v.zkClient.Disconnect()
+}
+
+// Verify returns the partitions whose external view differs from the best possible mapping,
+// sorted by resource and partition, the cluster is stable if none is returned
+func (v *BestPossibleExternalViewVerifier) Verify() ([]ExternalViewMismatch, error) {
+	cache, err := loadClusterDataCache(v.dataAccessor)
+	if err != nil {
+		return nil, err
+	}
+	externalViews, err := v.dataAccessor.ExternalViews()
+	if err != nil {
+		return nil, err
+	}
+	currentStates := &ClusterEvent{Cache: cache}
+	if err := (&currentStateStage{}).Process(currentStates); err != nil {
+		return nil, err
+	}
+
+	resources := util.NewStringSet()
+	for resource := range cache.IdealStates {
+		resources.Add(resource)
+	}
+	for resource := range externalViews {
+		resources.Add(resource)
+	}
+	var mismatches []ExternalViewMismatch
+	for _, resource := range resources.ToSortedSlice() {
+		if v.resources != nil && !v.resources.Contains(resource) {
+			continue
+		}
+		idealState, ok := cache.IdealStates[resource]
+		if ok && idealState.GetRebalanceMode() == model.RebalanceModeTask {
+			continue
+		}
+		expected := ResourceMapping{}
+		initialState := ""
+		if ok {
+			stateModelDef, ok := cache.StateModelDefs[idealState.GetStateModelDefRef()]
+			if !ok {
+				return nil, errors.Wrapf(ErrStateModelDefNotExist, "resource %s", resource)
+			}
+			initialState = stateModelDef.GetInitialState()
+			expected, err = computeBestPossibleMapping(idealState, cache, currentStates.CurrentStates, v.getRebalancer)
+			if err != nil {
+				return nil, err
+			}
+		}
+		actual := ResourceMapping{}
+		if externalView, ok := externalViews[resource]; ok {
+			actual = externalView.MapFields
+		}
+		mismatches = append(mismatches, diffResourceMappings(resource, initialState, expected, actual)...)
+	}
+	return mismatches, nil
+}
+
+// VerifyByPolling verifies the external views every poll interval until they match
+// the best possible mapping, it returns ErrExternalViewNotConverged after the timeout
+func (v *BestPossibleExternalViewVerifier) VerifyByPolling(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		mismatches, err := v.Verify()
+		if err != nil {
+			return err
+		}
+		if len(mismatches) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return errors.Wrapf(ErrExternalViewNotConverged, "%d partitions differ, first %v",
+				len(mismatches), mismatches[0])
+		}
+		v.logger.Debug("external view not converged", zap.Int("partitions", len(mismatches)))
+		time.Sleep(v.pollInterval)
+	}
+}
+
+func (v *BestPossibleExternalViewVerifier) getRebalancer(name string) (Rebalancer, bool) {
+	rebalancer, ok := v.rebalancers[name]
+	return rebalancer, ok
+}
+
+// assignStates assigns the states to the instances in the order of preference, from the state
+// of the highest priority, each state is assigned to up to its count of instances
+func assignStates(stateModelDef *model.StateModelDef, instances []string,
+	replicas int, liveInstances int) map[string]string {
+	states := map[string]string{}
+	next := 0
+	for _, state := range stateModelDef.GetStatesPriorityList() {
+		count := 0
+		switch countValue := stateModelDef.GetStateCount(state); countValue {
+		case "R":
+			count = replicas
+		case "N":
+			count = liveInstances
+		default:
+			count, _ = strconv.Atoi(countValue)
+		}
+		for i := 0; i < count && next < len(instances); i++ {
+			states[instances[next]] = state
+			next++
+		}
+	}
+	return states
+}
+
+// diffResourceMappings returns the partitions whose states differ between the mappings,
+// leaving out the initial and DROPPED states
+func diffResourceMappings(resource string, initialState string,
+	expected ResourceMapping, actual ResourceMapping) []ExternalViewMismatch {
+	partitions := util.NewStringSet()
+	for partition := range expected {
+		partitions.Add(partition)
+	}
+	for partition := range actual {
+		partitions.Add(partition)
+	}
+	var mismatches []ExternalViewMismatch
+	for _, partition := range partitions.ToSortedSlice() {
+		expectedStates := activeStates(expected[partition], initialState)
+		actualStates := activeStates(actual[partition], initialState)
+		if !reflect.DeepEqual(expectedStates, actualStates) {
+			mismatches = append(mismatches, ExternalViewMismatch{
+				Resource:  resource,
+				Partition: partition,
+				Expected:  expectedStates,
+				Actual:    actualStates,
+			})
+		}
+	}
+	return mismatches
+}
+
+func activeStates(states map[string]string, initialState string) map[string]string {
+	active := map[string]string{}
+	for instance, state := range states {
+		if state != initialState && state != StateModelStateDropped {
+			active[instance] = state
+		}
+	}
+	return active
+}
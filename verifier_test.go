@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	uzk "github.com/uber-go/go-helix/zk"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestAssignStates(t *testing.T) {
+	record, err := model.NewRecordFromBytes([]byte(_helixDefaultNodes["MasterSlave"]))
+	assert.NoError(t, err)
+	masterSlave := &model.StateModelDef{ZNRecord: *record}
+	assert.Equal(t, map[string]string{"i1": "MASTER", "i2": "SLAVE", "i3": "SLAVE"},
+		assignStates(masterSlave, []string{"i1", "i2", "i3"}, 3, 3))
+	// the replicas of the preference list cap the slaves
+	assert.Equal(t, map[string]string{"i2": "MASTER", "i3": "SLAVE"},
+		assignStates(masterSlave, []string{"i2", "i3"}, 2, 2))
+	assert.Empty(t, assignStates(masterSlave, nil, 3, 0))
+}
+
+func TestBestPossibleExternalViewVerifier(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	fakeZK, admin, keyBuilder, accessor := cluster.zk, cluster.admin, cluster.keyBuilder, cluster.accessor
+	for _, instance := range []string{"localhost_1", "localhost_2"} {
+		assert.NoError(t, admin.AddNode(TestClusterName, instance))
+		assert.NoError(t, admin.EnableInstance(TestClusterName, instance))
+		assert.NoError(t, accessor.createData(keyBuilder.liveInstance(instance),
+			model.NewLiveInstance(instance, "s").ZNRecord))
+	}
+	assert.NoError(t, admin.AddResource(TestClusterName, "r1", 1, StateModelNameOnlineOffline))
+	idealState := model.NewIdealState("r1")
+	idealState.SetRebalanceMode(model.RebalanceModeSemiAuto)
+	idealState.SetStateModelDefRef(StateModelNameOnlineOffline)
+	idealState.SetPreferenceList("r1_0", []string{"localhost_1", "localhost_2"})
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r1"), &idealState.ZNRecord))
+	customized := model.NewIdealState("r2")
+	customized.SetRebalanceMode(model.RebalanceModeCustomized)
+	customized.SetStateModelDefRef(StateModelNameOnlineOffline)
+	customized.SetMapField("r2_0", "localhost_2", StateModelStateOnline)
+	customized.SetMapField("r2_0", "localhost_3", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r2"), &customized.ZNRecord))
+
+	verifier := NewBestPossibleExternalViewVerifier(zap.NewNop(), tally.NoopScope, "", TestClusterName,
+		WithVerifierPollInterval(10*time.Millisecond))
+	verifier.zkClient = uzk.NewClient(zap.NewNop(), tally.NoopScope, uzk.WithConnFactory(fakeZK),
+		uzk.WithRetryTimeout(time.Second))
+	verifier.dataAccessor = newDataAccessor(verifier.zkClient, keyBuilder)
+	assert.NoError(t, verifier.Connect())
+	defer verifier.Disconnect()
+
+	mismatches, err := verifier.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, []ExternalViewMismatch{
+		{
+			Resource:  "r1",
+			Partition: "r1_0",
+			Expected:  map[string]string{"localhost_1": StateModelStateOnline, "localhost_2": StateModelStateOnline},
+			Actual:    map[string]string{},
+		},
+		{
+			Resource:  "r2",
+			Partition: "r2_0",
+			Expected:  map[string]string{"localhost_2": StateModelStateOnline},
+			Actual:    map[string]string{},
+		},
+	}, mismatches)
+	err = verifier.VerifyByPolling(50 * time.Millisecond)
+	assert.Equal(t, ErrExternalViewNotConverged, errors.Cause(err))
+
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "localhost_1", StateModelStateOnline)
+	view.SetState("r1_0", "localhost_2", StateModelStateOffline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	view = model.NewExternalView("r2")
+	view.SetState("r2_0", "localhost_2", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r2"), &view.ZNRecord))
+	mismatches, err = verifier.Verify()
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, "r1", mismatches[0].Resource)
+
+	// the partitions of the disabled instance are expected in the initial state
+	assert.NoError(t, admin.DisableInstance(TestClusterName, "localhost_2"))
+	view.SetState("r2_0", "localhost_2", StateModelStateOffline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r2"), &view.ZNRecord))
+	assert.NoError(t, verifier.VerifyByPolling(time.Second))
+
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_2"))
+	WithVerifiedResources("r2")(verifier)
+	mismatches, err = verifier.Verify()
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, "r2", mismatches[0].Resource)
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"go.uber.org/zap"
+)
+
+// WaitForPartitionState blocks until the external view holds the partition in the state on all
+// the instances, or on any instance if none is given. The external view is watched, so the
+// change is seen as soon as the controller writes it. It returns the error of ctx if it is
+// done first
+func (adm Admin) WaitForPartitionState(ctx context.Context, cluster string, resource string, partition string,
+	state string, instances ...string) error {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	builder := &KeyBuilder{cluster}
+	accessor := newDataAccessor(adm.zkClient, builder)
+	path := builder.externalViewForResource(resource)
+	var states map[string]string
+	for {
+		// the watch is set before reading, so no change after the read is missed
+		_, eventCh, err := adm.zkClient.ExistsW(path)
+		if err != nil {
+			return err
+		}
+		view, err := accessor.ExternalView(resource)
+		if err != nil && errors.Cause(err) != zk.ErrNoNode {
+			return err
+		}
+		states = nil
+		if view != nil {
+			states = view.GetStateMap(partition)
+		}
+		if partitionInState(states, state, instances) {
+			return nil
+		}
+		if err := waitWatchEvents(ctx, eventCh); err != nil {
+			return errors.Wrapf(err, "partition %s of %s not %s, states %v", partition, resource, state, states)
+		}
+	}
+}
+
+// partitionInState returns whether the partition is in the state on all the instances,
+// or on any instance if none is given
+func partitionInState(states map[string]string, state string, instances []string) bool {
+	if len(instances) == 0 {
+		for _, s := range states {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+	for _, instance := range instances {
+		if states[instance] != state {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForClusterConverged blocks until the external views match the best possible mapping
+// computed from the ideal states and the enabled live instances, as verified by the
+// BestPossibleExternalViewVerifier configured by the options. The ideal states, the external
+// views and the live instances are watched instead of polled. It returns the error of ctx if
+// it is done first
+func (adm Admin) WaitForClusterConverged(ctx context.Context, cluster string, options ...VerifierOption) error {
+	if ok, err := adm.isClusterSetup(cluster); !ok || err != nil {
+		return ErrClusterNotSetup
+	}
+	v := &BestPossibleExternalViewVerifier{
+		logger:       zap.NewNop(),
+		zkClient:     adm.zkClient,
+		dataAccessor: newDataAccessor(adm.zkClient, &KeyBuilder{cluster}),
+		rebalancers:  map[string]Rebalancer{},
+	}
+	for _, option := range options {
+		option(v)
+	}
+	return v.WaitConverged(ctx)
+}
+
+// WaitConverged blocks until the external views match the best possible mapping, the cluster
+// is verified again on each change of the ideal states, the external views, the instance
+// configs and the live instances. It returns the error of ctx if it is done first
+func (v *BestPossibleExternalViewVerifier) WaitConverged(ctx context.Context) error {
+	for {
+		eventChs, err := v.watchCluster()
+		if err != nil {
+			return err
+		}
+		mismatches, err := v.Verify()
+		if err != nil {
+			return err
+		}
+		if len(mismatches) == 0 {
+			return nil
+		}
+		v.logger.Debug("external view not converged", zap.Int("partitions", len(mismatches)))
+		if err := waitWatchEvents(ctx, eventChs...); err != nil {
+			return errors.Wrapf(err, "%v, %d partitions differ, first %v",
+				ErrExternalViewNotConverged, len(mismatches), mismatches[0])
+		}
+	}
+}
+
+// watchCluster sets the watches of the data the verification depends on
+func (v *BestPossibleExternalViewVerifier) watchCluster() ([]<-chan zk.Event, error) {
+	builder := v.dataAccessor.KeyBuilder()
+	var eventChs []<-chan zk.Event
+	watchChildren := func(path string) ([]string, error) {
+		children, eventCh, err := v.zkClient.ChildrenW(path)
+		if err != nil {
+			return nil, err
+		}
+		eventChs = append(eventChs, eventCh)
+		return children, nil
+	}
+	watchData := func(path string) error {
+		_, eventCh, err := v.zkClient.ExistsW(path)
+		if err != nil {
+			return err
+		}
+		eventChs = append(eventChs, eventCh)
+		return nil
+	}
+	if _, err := watchChildren(builder.liveInstances()); err != nil {
+		return nil, err
+	}
+	instances, err := watchChildren(builder.participantConfigs())
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instances {
+		if err := watchData(builder.participantConfig(instance)); err != nil {
+			return nil, err
+		}
+	}
+	for _, parent := range []string{builder.idealStates(), builder.externalView()} {
+		resources, err := watchChildren(parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			if v.resources != nil && !v.resources.Contains(resource) {
+				continue
+			}
+			if err := watchData(parent + "/" + resource); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return eventChs, nil
+}
+
+// waitWatchEvents blocks until an event is received on any of the channels or ctx is done,
+// the watches lost with the session also deliver an event so they are set again
+func waitWatchEvents(ctx context.Context, eventChs ...<-chan zk.Event) error {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	for _, eventCh := range eventChs {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(eventCh)})
+	}
+	if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+)
+
+func TestWaitForPartitionState(t *testing.T) {
+	cluster := newFakeCluster(t)
+	defer cluster.close()
+	admin, keyBuilder, accessor := cluster.admin, cluster.keyBuilder, cluster.accessor
+
+	// the wait times out while the external view does not exist
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := admin.WaitForPartitionState(ctx, TestClusterName, "r1", "r1_0", StateModelStateOnline)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- admin.WaitForPartitionState(context.Background(), TestClusterName, "r1", "r1_0",
+			StateModelStateOnline)
+	}()
+	go func() {
+		errCh <- admin.WaitForPartitionState(context.Background(), TestClusterName, "r1", "r1_0",
+			StateModelStateOnline, "localhost_1", "localhost_2")
+	}()
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "localhost_1", StateModelStateOnline)
+	view.SetState("r1_0", "localhost_2", StateModelStateOffline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	assert.NoError(t, receiveErr(t, errCh))
+	select {
+	case err := <-errCh:
+		assert.Fail(t, "the partition is not online on all the instances", "%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	view.SetState("r1_0", "localhost_2", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	assert.NoError(t, receiveErr(t, errCh))
+}
+
+func TestWaitForClusterConverged(t *testing.T) {
+	cluster := newFakeCluster(t, "localhost_1")
+	defer cluster.close()
+	admin, keyBuilder, accessor := cluster.admin, cluster.keyBuilder, cluster.accessor
+	assert.NoError(t, admin.EnableInstance(TestClusterName, "localhost_1"))
+	assert.NoError(t, accessor.createData(keyBuilder.liveInstance("localhost_1"),
+		model.NewLiveInstance("localhost_1", "s").ZNRecord))
+	idealState := model.NewIdealState("r1")
+	idealState.SetRebalanceMode(model.RebalanceModeSemiAuto)
+	idealState.SetStateModelDefRef(StateModelNameOnlineOffline)
+	idealState.SetPreferenceList("r1_0", []string{"localhost_1"})
+	assert.NoError(t, accessor.SetProperty(keyBuilder.IdealState("r1"), &idealState.ZNRecord))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := admin.WaitForClusterConverged(ctx, TestClusterName)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- admin.WaitForClusterConverged(context.Background(), TestClusterName)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	view := model.NewExternalView("r1")
+	view.SetState("r1_0", "localhost_1", StateModelStateOnline)
+	assert.NoError(t, accessor.SetProperty(keyBuilder.ExternalView("r1"), &view.ZNRecord))
+	assert.NoError(t, receiveErr(t, errCh))
+}
+
+func receiveErr(t *testing.T, errCh <-chan error) error {
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "the wait did not return")
+		return nil
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+const (
+	// WebhookSignatureHeader carries the hex HMAC-SHA256 of the body signed with the secret of
+	// the publisher, prefixed with sha256=
+	WebhookSignatureHeader = "X-Helix-Signature"
+
+	_defaultWebhookQueueSize = 1000
+	_defaultWebhookAttempts  = 3
+	_defaultWebhookBackoff   = time.Second
+	_defaultWebhookTimeout   = 10 * time.Second
+)
+
+// ErrWebhookQueueFull is returned by WebhookPublisher.Write when the event is dropped since
+// the endpoints can't keep up
+var ErrWebhookQueueFull = errors.New("helix: webhook queue is full")
+
+// WebhookOption configures a WebhookPublisher
+type WebhookOption func(*WebhookPublisher)
+
+// WithWebhookSecret signs the bodies with HMAC-SHA256 in the WebhookSignatureHeader, so the
+// endpoints can check the events come from the cluster
+func WithWebhookSecret(secret []byte) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.secret = secret
+	}
+}
+
+// WithWebhookEventTypes publishes only the events of the types, all the events by default
+func WithWebhookEventTypes(types ...EventType) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.types = make(map[EventType]struct{}, len(types))
+		for _, t := range types {
+			p.types[t] = struct{}{}
+		}
+	}
+}
+
+// WithWebhookRetries sets the attempts to post an event to an endpoint, 3 by default, and the
+// backoff before the first retry, doubled after each retry. The client errors are not retried
+func WithWebhookRetries(attempts int, backoff time.Duration) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.attempts = attempts
+		p.backoff = backoff
+	}
+}
+
+// WithWebhookHTTPClient sets the HTTP client posting the events, e.g. with TLS settings
+func WithWebhookHTTPClient(client *http.Client) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.httpClient = client
+	}
+}
+
+// WithWebhookQueueSize sets the number of events waiting to be posted, 1000 by default
+func WithWebhookQueueSize(size int) WebhookOption {
+	return func(p *WebhookPublisher) {
+		p.queueSize = size
+	}
+}
+
+// WebhookPublisher is an EventSink posting the events as JSON to the URLs, e.g. to alert when
+// an instance goes down or a partition enters ERROR without running a watcher service. The
+// events are posted in order from a goroutine, so Write never waits for the endpoints
+type WebhookPublisher struct {
+	logger     *zap.Logger
+	scope      tally.Scope
+	urls       []string
+	secret     []byte
+	types      map[EventType]struct{}
+	attempts   int
+	backoff    time.Duration
+	httpClient *http.Client
+	queueSize  int
+
+	eventCh   chan Event
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWebhookPublisher creates a WebhookPublisher posting to the URLs until Close
+func NewWebhookPublisher(logger *zap.Logger, scope tally.Scope, urls []string,
+	options ...WebhookOption) *WebhookPublisher {
+	p := &WebhookPublisher{
+		logger:     logger,
+		scope:      scope.SubScope("helix.webhook"),
+		urls:       urls,
+		attempts:   _defaultWebhookAttempts,
+		backoff:    _defaultWebhookBackoff,
+		httpClient: &http.Client{Timeout: _defaultWebhookTimeout},
+		queueSize:  _defaultWebhookQueueSize,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	if p.attempts < 1 {
+		p.attempts = 1
+	}
+	p.eventCh = make(chan Event, p.queueSize)
+	go p.run()
+	return p
+}
+
+// Write queues the event to be posted, it implements EventSink
+func (p *WebhookPublisher) Write(e Event) error {
+	if p.types != nil {
+		if _, ok := p.types[e.Type]; !ok {
+			return nil
+		}
+	}
+	select {
+	case p.eventCh <- e:
+		return nil
+	default:
+		p.scope.Counter("dropped").Inc(1)
+		return ErrWebhookQueueFull
+	}
+}
+
+// Close stops posting, the queued events are dropped
+func (p *WebhookPublisher) Close() {
+	p.closeOnce.Do(func() {
+		close(p.stopCh)
+		<-p.doneCh
+	})
+}
+
+func (p *WebhookPublisher) run() {
+	defer close(p.doneCh)
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case e := <-p.eventCh:
+			body, err := json.Marshal(e)
+			if err != nil {
+				p.logger.Warn("failed to encode event", zap.Any("event", e), zap.Error(err))
+				continue
+			}
+			for _, url := range p.urls {
+				if err := p.post(url, body); err != nil {
+					p.scope.Counter("failures").Inc(1)
+					p.logger.Warn("failed to post event to webhook", zap.String("url", url),
+						zap.String("type", string(e.Type)), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// post sends the body to the URL, retrying the network and server errors with backoff
+func (p *WebhookPublisher) post(url string, body []byte) error {
+	backoff := p.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		if retryable, err = p.send(url, body); err == nil {
+			p.scope.Counter("posted").Inc(1)
+			return nil
+		}
+		if !retryable || attempt >= p.attempts {
+			return err
+		}
+		p.scope.Counter("retries").Inc(1)
+		select {
+		case <-p.stopCh:
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (p *WebhookPublisher) send(url string, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "invalid webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(p.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookBody(p.secret, body))
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return false, nil
+}
+
+// SignWebhookBody returns the value of the WebhookSignatureHeader of the body, for the
+// endpoints to compare with hmac.Equal
+func SignWebhookBody(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package helix
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	secret := []byte("secret")
+	var mu sync.Mutex
+	var received []Event
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.True(t, hmac.Equal([]byte(SignWebhookBody(secret, body)),
+			[]byte(r.Header.Get(WebhookSignatureHeader))))
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		// the first attempt fails with a server error and is retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		received = append(received, e)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(zap.NewNop(), tally.NoopScope, []string{server.URL},
+		WithWebhookSecret(secret), WithWebhookRetries(3, time.Millisecond),
+		WithWebhookEventTypes(EventTypeLiveInstanceDown, EventTypePartitionError))
+	defer publisher.Close()
+	eventLog := NewEventLog(zap.NewNop(), 10, publisher)
+	eventLog.Record(Event{Type: EventTypeLiveInstanceDown, Instance: "host_1"})
+	eventLog.Record(Event{Type: EventTypeExternalViewChanged, Resource: "db"})
+	eventLog.Record(Event{Type: EventTypePartitionError, Resource: "db", Partition: "db_0"})
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, EventTypeLiveInstanceDown, received[0].Type)
+	assert.Equal(t, "host_1", received[0].Instance)
+	assert.Equal(t, EventTypePartitionError, received[1].Type)
+}
+
+func TestWebhookPublisherClientError(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	publisher := NewWebhookPublisher(zap.NewNop(), tally.NoopScope, []string{server.URL},
+		WithWebhookRetries(3, time.Millisecond))
+	// the client errors are not retried
+	retryable, err := publisher.send(server.URL, []byte("{}"))
+	assert.Error(t, err)
+	assert.False(t, retryable)
+	assert.Error(t, publisher.post(server.URL, []byte("{}")))
+	publisher.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"path"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// ACLProvider chooses the ACL of the nodes created by the client without an explicit ACL, e.g.
+// to restrict the CONFIGS of the clusters while the PROPERTYSTORE stays open.
+// Mirrors org.apache.helix.zookeeper.impl.client.ACLProvider
+type ACLProvider interface {
+	// ACL returns the ACL of the node created at path
+	ACL(path string) []zk.ACL
+}
+
+// ACLProviderFunc adapts a function to an ACLProvider
+type ACLProviderFunc func(path string) []zk.ACL
+
+// ACL calls f
+func (f ACLProviderFunc) ACL(path string) []zk.ACL {
+	return f(path)
+}
+
+// DefaultACLProvider gives all permissions to everyone on every node, as ACLPermAll
+var DefaultACLProvider ACLProvider = ACLProviderFunc(func(string) []zk.ACL { return ACLPermAll })
+
+// PathACLProvider assigns ACLs by path pattern. A pattern is a path whose segments are matched
+// as path.Match patterns against the leading segments of the node path, so /*/CONFIGS matches
+// the configs of every cluster and their descendants. The first matching pattern wins, the
+// nodes matched by no pattern get the default ACL
+type PathACLProvider struct {
+	defaultACL []zk.ACL
+	rules      []aclRule
+}
+
+type aclRule struct {
+	segments []string
+	acl      []zk.ACL
+}
+
+// NewPathACLProvider returns a PathACLProvider giving defaultACL to the nodes matched by no pattern
+func NewPathACLProvider(defaultACL []zk.ACL) *PathACLProvider {
+	return &PathACLProvider{defaultACL: defaultACL}
+}
+
+// Add assigns the ACL to the nodes matching the pattern, after the patterns already added
+func (p *PathACLProvider) Add(pattern string, acl []zk.ACL) *PathACLProvider {
+	p.rules = append(p.rules, aclRule{segments: splitPath(pattern), acl: acl})
+	return p
+}
+
+// ACL returns the ACL of the first pattern matching the path, or the default ACL
+func (p *PathACLProvider) ACL(nodePath string) []zk.ACL {
+	segments := splitPath(nodePath)
+	for _, rule := range p.rules {
+		if matchSegments(rule.segments, segments) {
+			return rule.acl
+		}
+	}
+	return p.defaultACL
+}
+
+// WithACLProvider sets the provider of the ACL of the nodes created without an explicit ACL,
+// including the nodes created by Helix. DefaultACLProvider by default
+func WithACLProvider(provider ACLProvider) ClientOption {
+	return func(c *Client) {
+		c.aclProvider = provider
+	}
+}
+
+// acl returns the ACL of the node created at path, given acl if not empty
+func (c *Client) acl(path string, acl []zk.ACL) []zk.ACL {
+	if len(acl) > 0 {
+		return acl
+	}
+	return c.aclProvider.ACL(path)
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func matchSegments(patterns []string, segments []string) bool {
+	if len(patterns) > len(segments) {
+		return false
+	}
+	for i, pattern := range patterns {
+		if matched, err := path.Match(pattern, segments[i]); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
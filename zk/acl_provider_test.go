@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestPathACLProvider(t *testing.T) {
+	secure := zk.DigestACL(zk.PermAll, "admin", "secret")
+	readOnly := zk.WorldACL(zk.PermRead)
+	provider := NewPathACLProvider(ACLPermAll).
+		Add("/*/CONFIGS", secure).
+		Add("/*/INSTANCES/*/MESSAGES", ACLPermAll).
+		Add("/*/INSTANCES", readOnly)
+
+	assert.Equal(t, secure, provider.ACL("/cluster/CONFIGS"))
+	assert.Equal(t, secure, provider.ACL("/cluster/CONFIGS/PARTICIPANT/localhost_1"))
+	assert.Equal(t, ACLPermAll, provider.ACL("/cluster/INSTANCES/localhost_1/MESSAGES/m"))
+	assert.Equal(t, readOnly, provider.ACL("/cluster/INSTANCES/localhost_1/CURRENTSTATES"))
+	assert.Equal(t, ACLPermAll, provider.ACL("/cluster/PROPERTYSTORE/p"))
+	assert.Equal(t, ACLPermAll, provider.ACL("/cluster"))
+	assert.Equal(t, ACLPermAll, provider.ACL("/"))
+}
+
+func TestClientACLProvider(t *testing.T) {
+	secure := zk.DigestACL(zk.PermAll, "admin", "secret")
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithACLProvider(NewPathACLProvider(ACLPermAll).Add("/*/CONFIGS", secure)))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	assert.NoError(t, client.CreateDataWithPath("/cluster/CONFIGS/c", nil))
+	assert.NoError(t, client.CreateEmptyNode("/cluster/PROPERTYSTORE"))
+	// an explicit ACL is kept
+	assert.NoError(t, client.Create("/cluster/CONFIGS/d", nil, FlagsZero, ACLPermAll))
+
+	history := client.getConn().(*FakeZkConn).GetHistory()
+	acls := map[string]interface{}{}
+	for _, call := range history.GetHistoryForMethod("Create") {
+		acls[call.Params[0].(string)] = call.Params[3]
+	}
+	for _, call := range history.GetHistoryForMethod("CreateContainer") {
+		acls[call.Params[0].(string)] = call.Params[2]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"/cluster":               ACLPermAll,
+		"/cluster/CONFIGS":       secure,
+		"/cluster/CONFIGS/c":     secure,
+		"/cluster/PROPERTYSTORE": ACLPermAll,
+		"/cluster/CONFIGS/d":     ACLPermAll,
+	}, acls)
+}
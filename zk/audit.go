@@ -0,0 +1,182 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"strings"
+	"time"
+
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
+	"go.uber.org/zap"
+)
+
+// AuditRecord describes a mutating ZK operation made by the client
+type AuditRecord struct {
+	Time time.Time
+	// Principal identifies the component using the client, e.g. "controller"
+	Principal string
+	SessionID string
+	Op        string
+	Path      string
+	// Version is the expected version of the znode, -1 matches any version
+	Version int32
+	// Size is the number of bytes written
+	Size int
+	// Err is the error of the operation, nil if it succeeded
+	Err error
+	// Diff is the changes of the fields of the ZNRecord of the znode, set with WithAuditDiffs
+	// if the znode holds a ZNRecord
+	Diff model.RecordDiff
+}
+
+// AuditSink receives the audit records of the mutating ZK operations
+type AuditSink interface {
+	Write(r AuditRecord) error
+}
+
+// AuditSinkFunc adapts a callback to an AuditSink
+type AuditSinkFunc func(r AuditRecord) error
+
+// Write calls the callback
+func (f AuditSinkFunc) Write(r AuditRecord) error {
+	return f(r)
+}
+
+type loggerAuditSink struct {
+	logger *zap.Logger
+}
+
+// NewLoggerAuditSink returns an AuditSink logging the records at info level
+func NewLoggerAuditSink(logger *zap.Logger) AuditSink {
+	return &loggerAuditSink{logger: logger}
+}
+
+func (s *loggerAuditSink) Write(r AuditRecord) error {
+	s.logger.Info("zk audit",
+		zap.Time("time", r.Time),
+		zap.String("principal", r.Principal),
+		zap.String("sessionID", r.SessionID),
+		zap.String("op", r.Op),
+		zap.String("path", r.Path),
+		zap.Int32("version", r.Version),
+		zap.Int("size", r.Size),
+		zap.Stringer("diff", r.Diff),
+		zap.Error(r.Err))
+	return nil
+}
+
+// WithAuditSink writes an audit record of each create, set and delete made by the client to sink
+func WithAuditSink(sink AuditSink) ClientOption {
+	return func(c *Client) {
+		c.auditSink = sink
+	}
+}
+
+// WithAuditPrincipal sets the principal of the audit records, e.g. the name of the component
+func WithAuditPrincipal(principal string) ClientOption {
+	return func(c *Client) {
+		c.auditPrincipal = principal
+	}
+}
+
+// WithAuditPathPrefixes only audits the operations on the paths with one of the prefixes,
+// e.g. "/cluster/IDEALSTATES", all the paths are audited by default
+func WithAuditPathPrefixes(prefixes ...string) ClientOption {
+	return func(c *Client) {
+		c.auditPathPrefixes = prefixes
+	}
+}
+
+// WithAuditDiffs adds the changes of the fields of the ZNRecords written to the audit records,
+// the sets and deletes read the znode before changing it
+func WithAuditDiffs() ClientOption {
+	return func(c *Client) {
+		c.auditDiffs = true
+	}
+}
+
+// auditPrevious returns the data of the znode before a set or delete if the diffs are audited
+func (c *Client) auditPrevious(path string) []byte {
+	if c.auditSink == nil || !c.auditDiffs || !c.audited(path) {
+		return nil
+	}
+	data, _, err := c.getConn().Get(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// audit writes the audit record of a mutating operation if the path is audited, previous is
+// the data of the znode before the operation read by auditPrevious
+func (c *Client) audit(op string, path string, version int32, previous []byte, data []byte, err error) {
+	if c.auditSink == nil || !c.audited(path) {
+		return
+	}
+	r := AuditRecord{
+		Time:      time.Now(),
+		Principal: c.auditPrincipal,
+		SessionID: c.GetSessionID(),
+		Op:        op,
+		Path:      path,
+		Version:   version,
+		Size:      len(data),
+		Err:       err,
+	}
+	if c.auditDiffs && err == nil {
+		r.Diff = diffRecordData(previous, data)
+	}
+	if err := c.auditSink.Write(r); err != nil {
+		c.scope.Counter("audit-failures").Inc(1)
+		c.logger.Warn("failed to write audit record", util.Field("op", op), util.Field("path", path),
+			util.ErrorField(err))
+	}
+}
+
+// diffRecordData returns the changes of the fields between the ZNRecords of the data,
+// nil if one of them is not a ZNRecord. Empty data has no field
+func diffRecordData(previous []byte, data []byte) model.RecordDiff {
+	var records [2]*model.ZNRecord
+	for i, d := range [][]byte{previous, data} {
+		if len(d) == 0 {
+			continue
+		}
+		record, err := model.NewRecordFromBytes(d)
+		if err != nil {
+			return nil
+		}
+		records[i] = record
+	}
+	return model.DiffRecords(records[0], records[1])
+}
+
+func (c *Client) audited(path string) bool {
+	if len(c.auditPathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.auditPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
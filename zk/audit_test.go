@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	client := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))), WithRetryTimeout(time.Second),
+		WithAuditSink(sink), WithAuditPrincipal("controller"), WithAuditPathPrefixes("/cluster/IDEALSTATES"))
+	assert.NoError(t, client.Connect())
+
+	assert.NoError(t, client.CreateEmptyNode("/cluster"))
+	assert.NoError(t, client.CreateEmptyNode("/cluster/IDEALSTATES"))
+	assert.NoError(t, client.Create("/cluster/IDEALSTATES/r", []byte("is"), FlagsZero, ACLPermAll))
+	assert.NoError(t, client.Set("/cluster/IDEALSTATES/r", []byte("is2"), 0))
+	err := client.Set("/cluster/IDEALSTATES/r", []byte("is3"), 0)
+	assert.Equal(t, zk.ErrBadVersion, errors.Cause(err))
+	_, _, err = client.Get("/cluster/IDEALSTATES/r")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Delete("/cluster/IDEALSTATES/r"))
+
+	ops := make([]string, 0, len(records))
+	for _, r := range records {
+		ops = append(ops, r.Op)
+		assert.Equal(t, "controller", r.Principal)
+		assert.Equal(t, client.GetSessionID(), r.SessionID)
+		assert.False(t, r.Time.IsZero())
+	}
+	assert.Equal(t, []string{"create", "create", "set", "set", "delete"}, ops)
+	assert.Equal(t, "/cluster/IDEALSTATES", records[0].Path)
+	assert.Equal(t, 2, records[1].Size)
+	assert.Equal(t, int32(0), records[2].Version)
+	assert.NoError(t, records[2].Err)
+	assert.Equal(t, zk.ErrBadVersion, errors.Cause(records[3].Err))
+}
+
+func TestAuditDiffs(t *testing.T) {
+	var records []AuditRecord
+	sink := AuditSinkFunc(func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	client := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))), WithRetryTimeout(time.Second),
+		WithAuditSink(sink), WithAuditDiffs(), WithAuditPathPrefixes("/cluster/CONFIGS"))
+	assert.NoError(t, client.Connect())
+
+	record := model.NewRecord("host_1")
+	record.SetSimpleField("HELIX_ENABLED", "true")
+	data, err := record.Marshal()
+	assert.NoError(t, err)
+	assert.NoError(t, client.CreateDataWithPath("/cluster/CONFIGS/host_1", data))
+	record.SetSimpleField("HELIX_ENABLED", "false")
+	data, err = record.Marshal()
+	assert.NoError(t, err)
+	assert.NoError(t, client.Set("/cluster/CONFIGS/host_1", data, -1))
+	assert.NoError(t, client.Delete("/cluster/CONFIGS/host_1"))
+
+	var diffs []string
+	for _, r := range records {
+		if r.Path == "/cluster/CONFIGS/host_1" {
+			diffs = append(diffs, r.Diff.String())
+		}
+	}
+	assert.Equal(t, []string{
+		"+simpleFields.HELIX_ENABLED: true",
+		"~simpleFields.HELIX_ENABLED: true -> false",
+		"-simpleFields.HELIX_ENABLED: false",
+	}, diffs)
+}
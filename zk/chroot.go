@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// splitChroot splits a connect string like host1:2181,host2:2181/chroot into the servers
+// and the chroot, the chroot is empty if the connect string has none
+func splitChroot(connectString string) (string, string) {
+	i := strings.Index(connectString, "/")
+	if i < 0 {
+		return connectString, ""
+	}
+	return connectString[:i], normalizeChroot(connectString[i:])
+}
+
+func normalizeChroot(chroot string) string {
+	chroot = path.Clean("/" + strings.TrimSpace(chroot))
+	if chroot == "/" {
+		return ""
+	}
+	return chroot
+}
+
+// chrootConn makes the paths of the operations relative to the chroot
+type chrootConn struct {
+	Connection
+	chroot string
+}
+
+func newChrootConn(conn Connection, chroot string) *chrootConn {
+	return &chrootConn{Connection: conn, chroot: chroot}
+}
+
+func (c *chrootConn) fullPath(p string) string {
+	if p == "/" {
+		return c.chroot
+	}
+	return c.chroot + p
+}
+
+func (c *chrootConn) relativePath(p string) string {
+	if p == c.chroot {
+		return "/"
+	}
+	return strings.TrimPrefix(p, c.chroot)
+}
+
+// relativeEvents translates the paths of the watch events
+func (c *chrootConn) relativeEvents(events <-chan zk.Event) <-chan zk.Event {
+	if events == nil {
+		return nil
+	}
+	relative := make(chan zk.Event, 1)
+	go func() {
+		defer close(relative)
+		for ev := range events {
+			if ev.Path != "" {
+				ev.Path = c.relativePath(ev.Path)
+			}
+			relative <- ev
+		}
+	}()
+	return relative
+}
+
+// ensureChroot creates the chroot if it doesn't exist
+func (c *chrootConn) ensureChroot() error {
+	var created string
+	for _, segment := range strings.Split(strings.TrimPrefix(c.chroot, "/"), "/") {
+		created += "/" + segment
+		_, err := c.Connection.Create(created, nil, FlagsZero, ACLPermAll)
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *chrootConn) Children(p string) ([]string, *zk.Stat, error) {
+	return c.Connection.Children(c.fullPath(p))
+}
+
+func (c *chrootConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, events, err := c.Connection.ChildrenW(c.fullPath(p))
+	return children, stat, c.relativeEvents(events), err
+}
+
+func (c *chrootConn) Get(p string) ([]byte, *zk.Stat, error) {
+	return c.Connection.Get(c.fullPath(p))
+}
+
+func (c *chrootConn) GetW(p string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	data, stat, events, err := c.Connection.GetW(c.fullPath(p))
+	return data, stat, c.relativeEvents(events), err
+}
+
+func (c *chrootConn) Exists(p string) (bool, *zk.Stat, error) {
+	return c.Connection.Exists(c.fullPath(p))
+}
+
+func (c *chrootConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	exists, stat, events, err := c.Connection.ExistsW(c.fullPath(p))
+	return exists, stat, c.relativeEvents(events), err
+}
+
+func (c *chrootConn) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	return c.Connection.Set(c.fullPath(p), data, version)
+}
+
+func (c *chrootConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	name, err := c.Connection.Create(c.fullPath(p), data, flags, acl)
+	return c.relativePath(name), err
+}
+
+func (c *chrootConn) CreateContainer(p string, data []byte, acl []zk.ACL) (string, error) {
+	creator, ok := c.Connection.(ExtendedCreator)
+	if !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	name, err := creator.CreateContainer(c.fullPath(p), data, acl)
+	return c.relativePath(name), err
+}
+
+func (c *chrootConn) CreateTTL(p string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) (string, error) {
+	creator, ok := c.Connection.(ExtendedCreator)
+	if !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	name, err := creator.CreateTTL(c.fullPath(p), data, flags, acl, ttl)
+	return c.relativePath(name), err
+}
+
+func (c *chrootConn) Delete(p string, version int32) error {
+	return c.Connection.Delete(c.fullPath(p), version)
+}
+
+func (c *chrootConn) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
+	fullOps := make([]interface{}, 0, len(ops))
+	for _, op := range ops {
+		switch op := op.(type) {
+		case *zk.CreateRequest:
+			fullOp := *op
+			fullOp.Path = c.fullPath(op.Path)
+			fullOps = append(fullOps, &fullOp)
+		case *zk.DeleteRequest:
+			fullOp := *op
+			fullOp.Path = c.fullPath(op.Path)
+			fullOps = append(fullOps, &fullOp)
+		case *zk.SetDataRequest:
+			fullOp := *op
+			fullOp.Path = c.fullPath(op.Path)
+			fullOps = append(fullOps, &fullOp)
+		case *zk.CheckVersionRequest:
+			fullOp := *op
+			fullOp.Path = c.fullPath(op.Path)
+			fullOps = append(fullOps, &fullOp)
+		default:
+			return nil, errors.Errorf("unsupported multi op %T with chroot", op)
+		}
+	}
+	responses, err := c.Connection.Multi(fullOps...)
+	for i := range responses {
+		if responses[i].String != "" {
+			responses[i].String = c.relativePath(responses[i].String)
+		}
+	}
+	return responses, err
+}
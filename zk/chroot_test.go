@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestSplitChroot(t *testing.T) {
+	tests := []struct {
+		connectString string
+		servers       string
+		chroot        string
+	}{
+		{"localhost:2181", "localhost:2181", ""},
+		{"h1:2181,h2:2181/helix/env1", "h1:2181,h2:2181", "/helix/env1"},
+		{"localhost:2181/", "localhost:2181", ""},
+		{"localhost:2181/helix/", "localhost:2181", "/helix"},
+	}
+	for _, test := range tests {
+		servers, chroot := splitChroot(test.connectString)
+		assert.Equal(t, test.servers, servers, test.connectString)
+		assert.Equal(t, test.chroot, chroot, test.connectString)
+	}
+}
+
+func TestClientChroot(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithZkSvr("localhost:2181/helix/env1"),
+		WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	raw := NewFakeZkConn(z)
+	exists, _, err := raw.Exists("/helix/env1")
+	assert.NoError(t, err)
+	assert.True(t, exists, "chroot is created on connect")
+
+	assert.NoError(t, client.CreateDataWithPath("/a/b", []byte("b")))
+	data, _, err := raw.Get("/helix/env1/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), data)
+	children, err := client.Children("/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, children)
+
+	_, events, err := client.GetW("/a/b")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Set("/a/b", []byte("bb"), -1))
+	ev := <-events
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Type)
+	assert.Equal(t, "/a/b", ev.Path)
+
+	name, err := client.getConn().Create("/a/seq-", nil, zk.FlagSequence, ACLPermAll)
+	assert.NoError(t, err)
+	assert.Equal(t, "/a/seq-0000000001", name)
+	_, err = client.getConn().Multi(
+		&zk.CreateRequest{Path: "/c", Acl: ACLPermAll},
+		&zk.DeleteRequest{Path: "/a/b", Version: -1},
+	)
+	assert.NoError(t, err)
+	exists, _, err = raw.Exists("/helix/env1/c")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// an explicit chroot takes precedence over the connect string
+	other := NewClient(zap.NewNop(), tally.NoopScope, WithZkSvr("localhost:2181/helix/env1"),
+		WithChroot("/helix/env2"), WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, other.Connect())
+	defer other.Disconnect()
+	children, err = other.Children("/")
+	assert.NoError(t, err)
+	assert.Empty(t, children)
+}
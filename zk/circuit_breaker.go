@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+)
+
+// CircuitState is the state of the circuit breaker of the writes
+type CircuitState string
+
+const (
+	// CircuitClosed lets the writes through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails the writes fast with ErrCircuitOpen
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single write through to probe if ZK recovered
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+const (
+	_defaultBreakerFailureRate  = 0.5
+	_defaultBreakerMinRequests  = 20
+	_defaultBreakerWindow       = 10 * time.Second
+	_defaultBreakerSlowCall     = 5 * time.Second
+	_defaultBreakerOpenDuration = 30 * time.Second
+)
+
+// CircuitBreakerOption configures the circuit breaker of WithWriteCircuitBreaker
+type CircuitBreakerOption func(*circuitBreaker)
+
+// WithBreakerFailureRate sets the rate of failed writes in the window opening the circuit, 0.5 by default
+func WithBreakerFailureRate(rate float64) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.failureRate = rate
+	}
+}
+
+// WithBreakerMinRequests sets the number of writes in the window before the failure rate
+// is considered, 20 by default
+func WithBreakerMinRequests(requests int) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.minRequests = requests
+	}
+}
+
+// WithBreakerWindow sets the window the failure rate is measured over, 10s by default
+func WithBreakerWindow(window time.Duration) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.window = window
+	}
+}
+
+// WithBreakerSlowCall sets the latency from which a successful write counts as failed,
+// 5s by default, 0 disables it
+func WithBreakerSlowCall(latency time.Duration) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.slowCall = latency
+	}
+}
+
+// WithBreakerOpenDuration sets how long the circuit stays open before a write probes ZK,
+// 30s by default
+func WithBreakerOpenDuration(d time.Duration) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.openDuration = d
+	}
+}
+
+// WithWriteCircuitBreaker opens a circuit breaker on the writes of the client, i.e. set, create,
+// delete and multi, once the rate of writes failing on connection errors or slower than the
+// slow call latency crosses the threshold. The writes of an open circuit fail fast with
+// ErrCircuitOpen instead of blocking until the retry timeout, a write probes ZK once the circuit
+// was open for the open duration and closes it on success
+func WithWriteCircuitBreaker(options ...CircuitBreakerOption) ClientOption {
+	b := &circuitBreaker{
+		state:        CircuitClosed,
+		failureRate:  _defaultBreakerFailureRate,
+		minRequests:  _defaultBreakerMinRequests,
+		window:       _defaultBreakerWindow,
+		slowCall:     _defaultBreakerSlowCall,
+		openDuration: _defaultBreakerOpenDuration,
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return func(c *Client) {
+		c.writeBreaker = b
+	}
+}
+
+// WriteCircuitState returns the state of the circuit breaker of the writes,
+// CircuitClosed if the client has none
+func (c *Client) WriteCircuitState() CircuitState {
+	if c.writeBreaker == nil {
+		return CircuitClosed
+	}
+	c.writeBreaker.mu.Lock()
+	defer c.writeBreaker.mu.Unlock()
+	return c.writeBreaker.state
+}
+
+// circuitBreaker counts the writes and their failures in the current window
+type circuitBreaker struct {
+	failureRate  float64
+	minRequests  int
+	window       time.Duration
+	slowCall     time.Duration
+	openDuration time.Duration
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// allow returns whether a write is let through, in the half-open state only the probe is
+func (b *circuitBreaker) allow(now time.Time) (bool, CircuitState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.openDuration {
+			return false, ""
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true, CircuitHalfOpen
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, ""
+		}
+		b.probing = true
+	}
+	return true, ""
+}
+
+// record counts the outcome of a write let through, it returns the new state if it changed
+func (b *circuitBreaker) record(now time.Time, failed bool) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		if failed {
+			b.open(now)
+			return CircuitOpen
+		}
+		b.state = CircuitClosed
+		b.resetWindow(now)
+		return CircuitClosed
+	}
+	if b.state == CircuitOpen {
+		// a write let through before the circuit opened
+		return ""
+	}
+	if now.Sub(b.windowStart) >= b.window {
+		b.resetWindow(now)
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.minRequests && float64(b.failures) >= b.failureRate*float64(b.requests) && b.failures > 0 {
+		b.open(now)
+		return CircuitOpen
+	}
+	return ""
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = CircuitOpen
+	b.openedAt = now
+	b.resetWindow(now)
+}
+
+func (b *circuitBreaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
+
+// breakerFailure returns whether the error of a write shows ZK degraded, the errors of
+// the requests themselves, e.g. ErrNodeExists or ErrBadVersion, do not count
+func breakerFailure(err error) bool {
+	switch err {
+	case zk.ErrConnectionClosed, zk.ErrSessionExpired, zk.ErrNoServer, zk.ErrClosing, zk.ErrUnknown, zk.ErrAPIError:
+		return true
+	}
+	return false
+}
+
+// guarded wraps a write so each attempt is let through by the circuit breaker of the writes
+func (c *Client) guarded(op string, fn func() error) func() error {
+	b := c.writeBreaker
+	if b == nil {
+		return fn
+	}
+	return func() error {
+		allowed, state := b.allow(c.clock.Now())
+		if state != "" {
+			c.circuitStateChanged(state)
+		}
+		if !allowed {
+			c.scope.Tagged(map[string]string{_opTag: op}).Counter("circuit-rejected").Inc(1)
+			return ErrCircuitOpen
+		}
+		start := c.clock.Now()
+		err := fn()
+		failed := breakerFailure(err) || (err == nil && b.slowCall > 0 && c.clock.Since(start) >= b.slowCall)
+		if state := b.record(c.clock.Now(), failed); state != "" {
+			c.circuitStateChanged(state)
+		}
+		return err
+	}
+}
+
+func (c *Client) circuitStateChanged(state CircuitState) {
+	c.scope.Tagged(map[string]string{"state": string(state)}).Counter("circuit-state-changes").Inc(1)
+	open := 0.0
+	if state == CircuitOpen {
+		open = 1
+	}
+	c.scope.Gauge("circuit-open").Update(open)
+	c.logger.Warn("zk write circuit breaker changed state", util.Field("state", string(state)))
+}
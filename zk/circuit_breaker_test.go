@@ -0,0 +1,112 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b := &circuitBreaker{
+		state:        CircuitClosed,
+		failureRate:  0.5,
+		minRequests:  4,
+		window:       time.Minute,
+		openDuration: time.Minute,
+	}
+	now := time.Unix(0, 0)
+	b.resetWindow(now)
+	for _, failed := range []bool{true, false, true} {
+		allowed, _ := b.allow(now)
+		assert.True(t, allowed)
+		assert.Equal(t, CircuitState(""), b.record(now, failed))
+	}
+	// the failures of the previous window do not count
+	now = now.Add(time.Minute)
+	for _, failed := range []bool{true, false, true} {
+		assert.Equal(t, CircuitState(""), b.record(now, failed))
+	}
+	assert.Equal(t, CircuitOpen, b.record(now, false))
+
+	allowed, _ := b.allow(now.Add(time.Second))
+	assert.False(t, allowed)
+	// a single write probes once the circuit was open for the open duration
+	now = now.Add(time.Minute)
+	allowed, state := b.allow(now)
+	assert.True(t, allowed)
+	assert.Equal(t, CircuitHalfOpen, state)
+	allowed, _ = b.allow(now)
+	assert.False(t, allowed)
+	assert.Equal(t, CircuitOpen, b.record(now, true))
+
+	now = now.Add(time.Minute)
+	allowed, _ = b.allow(now)
+	assert.True(t, allowed)
+	assert.Equal(t, CircuitClosed, b.record(now, false))
+	allowed, _ = b.allow(now)
+	assert.True(t, allowed)
+}
+
+func TestWriteCircuitBreaker(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(NewFaultConnFactory(z, WithMultiFailureRate(1))),
+		WithRetryTimeout(5*time.Second),
+		WithWriteCircuitBreaker(WithBreakerMinRequests(5), WithBreakerOpenDuration(100*time.Millisecond)))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	assert.NoError(t, client.Create("/a", nil, FlagsZero, ACLPermAll))
+	// the errors of the requests themselves do not open the circuit
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, zk.ErrNodeExists, errors.Cause(client.Create("/a", nil, FlagsZero, ACLPermAll)))
+	}
+	assert.Equal(t, CircuitClosed, client.WriteCircuitState())
+
+	// the write failing on a broken connection fails fast once the circuit opens
+	start := time.Now()
+	err := client.Multi(&zk.SetDataRequest{Path: "/a", Data: []byte("a"), Version: -1})
+	assert.Equal(t, ErrCircuitOpen, errors.Cause(err))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, CircuitOpen, client.WriteCircuitState())
+	assert.Equal(t, ErrCircuitOpen, errors.Cause(client.Set("/a", nil, -1)))
+	// the reads are not guarded
+	_, _, err = client.Get("/a")
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, client.Set("/a", []byte("b"), -1))
+	assert.Equal(t, CircuitClosed, client.WriteCircuitState())
+
+	changes := map[string]int64{}
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.zk.circuit-state-changes" {
+			changes[counter.Tags()["state"]] = counter.Value()
+		}
+	}
+	assert.Equal(t, map[string]int64{"open": 1, "half-open": 1, "closed": 1}, changes)
+}
@@ -21,6 +21,7 @@
 package zk
 
 import (
+	"context"
 	"path"
 	"strconv"
 	"strings"
@@ -30,7 +31,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/samuel/go-zookeeper/zk"
 	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/go-helix/util"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -46,6 +49,13 @@ const (
 	FlagsEphemeral = int32(zk.FlagEphemeral)
 
 	_defaultRetryTimeout = 1 * time.Minute
+
+	// LogComponent is the component of the runtime log level of the ZK clients
+	LogComponent = "zk"
+
+	// the backoff between the attempts of UpdateWithRetry
+	_updateInitialBackoff = 10 * time.Millisecond
+	_updateMaxBackoff     = time.Second
 )
 
 var (
@@ -53,10 +63,6 @@ var (
 	ACLPermAll = zk.WorldACL(zk.PermAll)
 )
 
-var (
-	errOpBeforeConnect = errors.New("zookeeper: called connect() before any ops")
-)
-
 // Connection is the thread safe interface for ZK connection
 type Connection interface {
 	AddAuth(scheme string, auth []byte) error
@@ -83,29 +89,42 @@ type ConnFactory interface {
 
 // connFactory creates connections to real/embedded ZK
 type connFactory struct {
+	logger         util.Logger
 	zkServers      []string
 	sessionTimeout time.Duration
+	// serverListProvider provides the servers instead of zkServers if it is set
+	serverListProvider ServerListProvider
+	// onSessionEstablished reports the sessions established with the negotiated timeouts if it is set
+	onSessionEstablished func(sessionID int64, negotiatedTimeout time.Duration)
 }
 
 // NewConnFactory creates new connFactory
 func NewConnFactory(zkServers []string, sessionTimeout time.Duration) ConnFactory {
 	return &connFactory{
+		logger:         util.NopLogger(),
 		zkServers:      zkServers,
 		sessionTimeout: sessionTimeout,
 	}
 }
 
-// NewConn creates new ZK connection to real/embedded ZK
+// NewConn creates new ZK connection to real/embedded ZK, the hostnames of the servers
+// are resolved again on each reconnect
 func (f *connFactory) NewConn() (Connection, <-chan zk.Event, error) {
-	return zk.Connect(f.zkServers, f.sessionTimeout)
+	hostProvider := newResolvingHostProvider(f.logger, f.serverListProvider)
+	if f.onSessionEstablished != nil {
+		logger := &sessionLogger{Logger: zk.DefaultLogger, onSessionEstablished: f.onSessionEstablished}
+		return zk.Connect(f.zkServers, f.sessionTimeout, zk.WithHostProvider(hostProvider), zk.WithLogger(logger))
+	}
+	return zk.Connect(f.zkServers, f.sessionTimeout, zk.WithHostProvider(hostProvider))
 }
 
 // Client wraps utils to communicate with ZK
 type Client struct {
-	logger *zap.Logger
+	logger util.Logger
 	scope  tally.Scope
 
 	zkSvr          string
+	chroot         string
 	sessionTimeout time.Duration
 	retryTimeout   time.Duration
 	connFactory    ConnFactory
@@ -115,7 +134,74 @@ type Client struct {
 	cond *sync.Cond
 
 	zkEventWatchersMu *sync.RWMutex
-	zkEventWatchers   []Watcher
+	zkEventWatchers   []*watcherQueue
+	// watcherQueueSize and watcherOverflow configure the queues of the watchers
+	watcherQueueSize int
+	watcherOverflow  OverflowPolicy
+
+	// stateMu guards the state listeners and the last state they were notified of
+	stateMu        sync.Mutex
+	stateListeners []*stateListener
+	lastState      zk.State
+
+	// tags the op metrics by the top-level path segment
+	pathTag bool
+	tracer  trace.Tracer
+
+	// serverListProvider provides the servers of a dynamic ensemble
+	serverListProvider ServerListProvider
+
+	// budgets of the read and write requests, nil if unlimited
+	readLimiter  *rateLimiter
+	writeLimiter *rateLimiter
+
+	// audit records of the mutating operations, not written if auditSink is nil
+	auditSink         AuditSink
+	auditPrincipal    string
+	auditPathPrefixes []string
+
+	// serializer of the values of GetValue, SetValue and CreateValue,
+	// the ZNRecords of the Helix system paths are always serialized by ZNRecordSerializer
+	serializer Serializer
+
+	// dual-writes the mutations to a secondary ensemble, nil unless migrating
+	migration *Migration
+
+	// largest create or set request sent, unlimited if not positive
+	maxPayloadSize int
+
+	// ACL of the nodes created without an explicit ACL
+	aclProvider ACLProvider
+
+	// rejects the mutations if set
+	readOnly bool
+
+	// adds the diffs of the ZNRecords written to the audit records
+	auditDiffs bool
+
+	// fails the writes fast once ZK is degraded, nil if disabled
+	writeBreaker *circuitBreaker
+
+	// measures the retry timeouts and the backoffs
+	clock util.Clock
+
+	// window of the random delay before setting the watches and the ephemeral nodes
+	// of a new session again, no delay if not positive
+	reconnectJitter time.Duration
+
+	// listeners of the sessions established, the connections of the default factory report the
+	// negotiated session timeouts, the requested timeout is reported for the other factories
+	sessionListeners sessionListeners
+	reportsSessions  bool
+
+	// sharedRefs counts the references of the managers sharing the client, see Acquire
+	sharedMu   sync.Mutex
+	sharedRefs int
+
+	// watchManager keeps the watches of GetWatch, ExistsWatch and ChildrenWatch set,
+	// it is created on first use
+	watchManagerOnce sync.Once
+	watchManager     *WatchManager
 }
 
 // Watcher mirrors org.apache.zookeeper.Watcher
@@ -133,6 +219,23 @@ func WithZkSvr(zkSvr string) ClientOption {
 	}
 }
 
+// WithChroot makes the paths of the client relative to the chroot, the chroot is created
+// on connect if it doesn't exist. A chroot suffix in the connect string, e.g. host:2181/chroot,
+// is used if the option is not set
+func WithChroot(chroot string) ClientOption {
+	return func(c *Client) {
+		c.chroot = normalizeChroot(chroot)
+	}
+}
+
+// WithServerListProvider gets the ZK servers from the provider on each reconnect instead of
+// the connect string, for ensembles whose members change over time
+func WithServerListProvider(provider ServerListProvider) ClientOption {
+	return func(c *Client) {
+		c.serverListProvider = provider
+	}
+}
+
 // WithSessionTimeout configures sessionTimeout
 func WithSessionTimeout(t time.Duration) ClientOption {
 	return func(c *Client) {
@@ -154,39 +257,87 @@ func WithConnFactory(connFactory ConnFactory) ClientOption {
 	}
 }
 
+// WithSerializer sets the serializer of the values read and written with GetValue, SetValue and
+// CreateValue, e.g. to store protobuf payloads in the property store. JSONSerializer by default
+func WithSerializer(serializer Serializer) ClientOption {
+	return func(c *Client) {
+		c.serializer = serializer
+	}
+}
+
+// WithClock sets the clock measuring the retry timeouts, the backoffs, the rate limits, the
+// watch coalesce windows and the latency metrics, e.g. a util.FakeClock in tests.
+// util.RealClock by default
+func WithClock(clock util.Clock) ClientOption {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithLogger sets the logger of the client instead of the zap logger passed to NewClient, for
+// the users of other logging libraries than zap
+func WithLogger(logger util.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
 // NewClient returns new ZK client
 func NewClient(logger *zap.Logger, scope tally.Scope, options ...ClientOption) *Client {
 	mu := &sync.Mutex{}
 	c := &Client{
 		cond:              sync.NewCond(mu),
 		retryTimeout:      _defaultRetryTimeout,
+		maxPayloadSize:    DefaultMaxPayloadSize,
+		tracer:            newNoopTracer(),
+		serializer:        JSONSerializer{},
+		aclProvider:       DefaultACLProvider,
+		clock:             util.RealClock,
+		lastState:         zk.StateUnknown,
 		zkConnMu:          &sync.RWMutex{},
 		zkEventWatchersMu: &sync.RWMutex{},
+		watcherQueueSize:  DefaultWatcherQueueSize,
 	}
 	for _, option := range options {
 		option(c)
 	}
-	c.logger = logger.With(zap.String("zkSvr", c.zkSvr))
+	if c.logger == nil {
+		c.logger = util.LoggerFromZap(logger)
+	}
+	c.logger = util.WithLogLevel(c.logger, LogComponent).With(util.Field("zkSvr", c.zkSvr))
 	c.scope = scope.SubScope("helix.zk").Tagged(map[string]string{"zkSvr": c.zkSvr})
+	servers, chroot := splitChroot(c.zkSvr)
+	if c.chroot == "" {
+		c.chroot = chroot
+	}
 	if c.connFactory == nil {
-		zkServers := strings.Split(strings.TrimSpace(c.zkSvr), ",")
-		c.connFactory = NewConnFactory(zkServers, c.sessionTimeout)
+		c.connFactory = &connFactory{
+			logger:               c.logger,
+			zkServers:            strings.Split(strings.TrimSpace(servers), ","),
+			sessionTimeout:       c.sessionTimeout,
+			serverListProvider:   c.serverListProvider,
+			onSessionEstablished: c.sessionEstablished,
+		}
+		c.reportsSessions = true
 	}
 	return c
 }
 
-// AddWatcher adds a Watcher to zk session event
+// AddWatcher adds a Watcher to zk session event. Each Watcher has its own bounded queue
+// configured by WithWatcherQueue, and processes its events in order from its own goroutine
 func (c *Client) AddWatcher(w Watcher) {
-	c.zkEventWatchersMu.Lock()
-	c.zkEventWatchers = append(c.zkEventWatchers, w)
-	c.zkEventWatchersMu.Unlock()
+	c.AddWatcherWithQueue(w, c.watcherQueueSize, c.watcherOverflow)
 }
 
 // ClearWatchers removes all the watchers the client has
 func (c *Client) ClearWatchers() {
 	c.zkEventWatchersMu.Lock()
+	watchers := c.zkEventWatchers
 	c.zkEventWatchers = nil
 	c.zkEventWatchersMu.Unlock()
+	for _, q := range watchers {
+		q.stop()
+	}
 }
 
 // Connect sets up ZK connection
@@ -195,6 +346,11 @@ func (c *Client) Connect() error {
 	if err != nil {
 		return err
 	}
+	var chrootConn *chrootConn
+	if c.chroot != "" {
+		chrootConn = newChrootConn(zkConn, c.chroot)
+		zkConn = chrootConn
+	}
 	c.zkConnMu.Lock()
 	if c.zkConn != nil {
 		c.zkConn.Close()
@@ -204,7 +360,12 @@ func (c *Client) Connect() error {
 	go c.processEvents(eventCh)
 	connected := c.waitUntilConnected(c.sessionTimeout)
 	if !connected {
-		return errors.New("zookeeper: failed to connect")
+		return ErrConnectFailed
+	}
+	c.reportSession(zkConn)
+	if chrootConn != nil {
+		err := c.retryUntilConnected(chrootConn.ensureChroot)
+		return errors.Wrapf(err, "zk client failed to create chroot %s", c.chroot)
 	}
 	return nil
 }
@@ -219,9 +380,13 @@ func (c *Client) processEvents(eventCh <-chan zk.Event) {
 			}
 			switch ev.Type {
 			case zk.EventSession:
-				c.logger.Info("receive EventSession", zap.Any("state", ev.State))
+				c.logger.Info("receive EventSession", util.Field("state", ev.State))
 				c.cond.Broadcast()
 				c.processSessionEvents(ev)
+				c.notifyStateListeners(ev.State)
+				if ev.State == zk.StateHasSession {
+					c.reportSession(c.getConn())
+				}
 			case zk.EventNotWatching:
 				c.logger.Info("watchers have been invalidated. zk client should be trying to reconnect")
 			default:
@@ -235,8 +400,8 @@ func (c *Client) processSessionEvents(ev zk.Event) {
 	c.zkEventWatchersMu.RLock()
 	watchers := c.zkEventWatchers
 	c.zkEventWatchersMu.RUnlock()
-	for _, watcher := range watchers {
-		watcher.Process(ev)
+	for _, q := range watchers {
+		q.push(ev)
 	}
 }
 
@@ -266,23 +431,74 @@ func (c *Client) Disconnect() {
 
 // CreateEmptyNode creates an empty node for future use
 func (c *Client) CreateEmptyNode(path string) error {
-	return c.Create(path, []byte(""), FlagsZero, ACLPermAll)
+	return c.Create(path, []byte(""), FlagsZero, nil)
 }
 
-// CreateDataWithPath creates a path with a string
+// CreateDataWithPath creates a path with a string, the missing parents are created as container
+// nodes if the connection supports them, so the server deletes them once they are empty again
 func (c *Client) CreateDataWithPath(p string, data []byte) error {
+	return c.CreateDataWithPathContext(context.Background(), p, data)
+}
+
+// CreateDataWithPathContext is CreateDataWithPath with the round trips traced in the span of ctx
+func (c *Client) CreateDataWithPathContext(ctx context.Context, p string, data []byte) error {
 	parent := path.Dir(p)
-	if err := c.ensurePath(parent); err != nil {
+	if err := c.ensureContainerPath(ctx, parent); err != nil {
 		return err
 	}
-	return c.Create(p, data, FlagsZero, ACLPermAll)
+	err := c.CreateContext(ctx, p, data, FlagsZero, nil)
+	if errors.Cause(err) == zk.ErrNoNode {
+		// the empty container parent was deleted by the server meanwhile
+		if err := c.ensureContainerPath(ctx, parent); err != nil {
+			return err
+		}
+		err = c.CreateContext(ctx, p, data, FlagsZero, nil)
+	}
+	return err
+}
+
+// CreateIfNotExists creates the persistent node with the data and its missing parents, it returns
+// false if the node already exists, including when a concurrent client created it first
+func (c *Client) CreateIfNotExists(p string, data []byte) (bool, error) {
+	for {
+		if _, err := c.EnsurePath(path.Dir(p)); err != nil {
+			return false, err
+		}
+		err := c.Create(p, data, FlagsZero, nil)
+		switch errors.Cause(err) {
+		case nil:
+			return true, nil
+		case zk.ErrNodeExists:
+			return false, nil
+		case zk.ErrNoNode:
+			// a parent was deleted concurrently, it is created again
+			continue
+		default:
+			return false, err
+		}
+	}
+}
+
+// EnsurePath makes sure the path exists, the missing nodes are created as empty persistent nodes,
+// it returns false if the node already exists, including when a concurrent client created it first
+func (c *Client) EnsurePath(p string) (bool, error) {
+	exists, _, err := c.Exists(p)
+	if err != nil || exists {
+		return false, err
+	}
+	return c.CreateIfNotExists(p, []byte(""))
 }
 
 // Exists checks if a key exists in ZK
 func (c *Client) Exists(path string) (bool, *zk.Stat, error) {
+	return c.ExistsContext(context.Background(), path)
+}
+
+// ExistsContext is Exists with the round trip traced in the span of ctx
+func (c *Client) ExistsContext(ctx context.Context, path string) (bool, *zk.Stat, error) {
 	var res bool
 	var stat *zk.Stat
-	err := c.retryUntilConnected(func() error {
+	err := c.retryUntilConnected(c.limited("exists", requestKindRead, 0, c.instrumented(ctx, "exists", path, func() error {
 		r, s, err := c.getConn().Exists(path)
 		if err != nil {
 			return err
@@ -290,10 +506,26 @@ func (c *Client) Exists(path string) (bool, *zk.Stat, error) {
 		res = r
 		stat = s
 		return nil
-	})
+	})))
 	return res, stat, errors.Wrapf(err, "zk client failed to check existence of %s", path)
 }
 
+// ExistsW returns if path exists and watches the creation, deletion or data change of path
+func (c *Client) ExistsW(path string) (bool, <-chan zk.Event, error) {
+	var exists bool
+	var events <-chan zk.Event
+	err := c.retryUntilConnected(c.limited("existsw", requestKindRead, 0, c.instrumented(context.Background(), "existsw", path, func() error {
+		res, _, evts, err := c.getConn().ExistsW(path)
+		if err != nil {
+			return err
+		}
+		exists = res
+		events = evts
+		return nil
+	})))
+	return exists, events, errors.Wrapf(err, "zk client failed to check existence and watch %s", path)
+}
+
 // ExistsAll returns if all paths exist
 func (c *Client) ExistsAll(paths ...string) (bool, error) {
 	for _, path := range paths {
@@ -306,17 +538,31 @@ func (c *Client) ExistsAll(paths ...string) (bool, error) {
 
 // Get returns data in ZK path
 func (c *Client) Get(path string) ([]byte, *zk.Stat, error) {
+	return c.GetContext(context.Background(), path)
+}
+
+// GetContext is Get with the round trip traced in the span of ctx
+func (c *Client) GetContext(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	data, stat, err := c.get(ctx, path)
+	if err == nil && c.migration != nil {
+		c.migration.compareData(path, data)
+	}
+	return data, stat, err
+}
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
 	var data []byte
 	var stat *zk.Stat
-	err := c.retryUntilConnected(func() error {
+	err := c.retryUntilConnected(c.limited("get", requestKindRead, 0, c.instrumented(ctx, "get", path, func() error {
 		d, s, err := c.getConn().Get(path)
 		if err != nil {
 			return err
 		}
+		c.chargeRead(len(d))
 		data = d
 		stat = s
 		return nil
-	})
+	})))
 	return data, stat, errors.Wrapf(err, "zk client failed to get data at %s", path)
 }
 
@@ -324,24 +570,41 @@ func (c *Client) Get(path string) ([]byte, *zk.Stat, error) {
 func (c *Client) GetW(path string) ([]byte, <-chan zk.Event, error) {
 	var data []byte
 	var events <-chan zk.Event
-	err := c.retryUntilConnected(func() error {
+	err := c.retryUntilConnected(c.limited("getw", requestKindRead, 0, c.instrumented(context.Background(), "getw", path, func() error {
 		d, _, evts, err := c.getConn().GetW(path)
 		if err != nil {
 			return err
 		}
+		c.chargeRead(len(d))
 		data = d
 		events = evts
 		return nil
-	})
+	})))
 	return data, events, errors.Wrapf(err, "zk client failed to get and watch data at %s", path)
 }
 
 // Set sets data in ZK path
 func (c *Client) Set(path string, data []byte, version int32) error {
-	err := c.retryUntilConnected(func() error {
+	return c.SetContext(context.Background(), path, data, version)
+}
+
+// SetContext is Set with the round trip traced in the span of ctx
+func (c *Client) SetContext(ctx context.Context, path string, data []byte, version int32) error {
+	if err := c.checkWritable("set"); err != nil {
+		return errors.Wrapf(err, "zk client failed to set data at %s", path)
+	}
+	if err := c.checkPayload(path, data, nil); err != nil {
+		return errors.Wrapf(err, "zk client failed to set data at %s", path)
+	}
+	previous := c.auditPrevious(path)
+	err := c.retryUntilConnected(c.limited("set", requestKindWrite, len(data), c.guarded("set", c.instrumented(ctx, "set", path, func() error {
 		_, err := c.getConn().Set(path, data, version)
 		return err
-	})
+	}))))
+	c.audit("set", path, version, previous, data, err)
+	if err == nil && c.migration != nil {
+		c.migration.mirrorSet(path, data)
+	}
 	return errors.Wrapf(err, "zk client failed to set data at %s", path)
 }
 
@@ -350,26 +613,57 @@ func (c *Client) SetWithDefaultVersion(path string, data []byte) error {
 	return c.Set(path, data, -1)
 }
 
-// Create creates ZK path with data
+// Create creates ZK path with data, the ACL is chosen by the ACL provider of the client if acl is empty
 func (c *Client) Create(path string, data []byte, flags int32, acl []zk.ACL) error {
-	err := c.retryUntilConnected(func() error {
-		_, err := c.getConn().Create(path, data, flags, acl)
+	return c.CreateContext(context.Background(), path, data, flags, acl)
+}
+
+// CreateContext is Create with the round trip traced in the span of ctx
+func (c *Client) CreateContext(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) error {
+	if err := c.checkWritable("create"); err != nil {
+		return errors.Wrapf(err, "zk client failed to create data at %s", path)
+	}
+	acl = c.acl(path, acl)
+	if err := c.checkPayload(path, data, acl); err != nil {
+		return errors.Wrapf(err, "zk client failed to create data at %s", path)
+	}
+	var name string
+	err := c.retryUntilConnected(c.limited("create", requestKindWrite, len(data), c.guarded("create", c.instrumented(ctx, "create", path, func() error {
+		var err error
+		name, err = c.getConn().Create(path, data, flags, acl)
 		return err
-	})
+	}))))
+	c.audit("create", path, -1, nil, data, err)
+	if err == nil && c.migration != nil {
+		c.migration.mirrorCreate(name, data, flags, acl)
+	}
 	return errors.Wrapf(err, "zk client failed to create data at %s", path)
 }
 
 // Children returns children of ZK path
 func (c *Client) Children(path string) ([]string, error) {
+	return c.ChildrenContext(context.Background(), path)
+}
+
+// ChildrenContext is Children with the round trip traced in the span of ctx
+func (c *Client) ChildrenContext(ctx context.Context, path string) ([]string, error) {
+	children, err := c.children(ctx, path)
+	if err == nil && c.migration != nil {
+		c.migration.compareChildren(path, children)
+	}
+	return children, err
+}
+
+func (c *Client) children(ctx context.Context, path string) ([]string, error) {
 	var children []string
-	err := c.retryUntilConnected(func() error {
+	err := c.retryUntilConnected(c.limited("children", requestKindRead, 0, c.instrumented(ctx, "children", path, func() error {
 		res, _, err := c.getConn().Children(path)
 		if err != nil {
 			return err
 		}
 		children = res
 		return nil
-	})
+	})))
 	return children, errors.Wrapf(err, "zk client failed to get children of %s", path)
 }
 
@@ -378,7 +672,7 @@ func (c *Client) ChildrenW(path string) ([]string, <-chan zk.Event, error) {
 	children := []string{}
 	eventCh := make(<-chan zk.Event)
 
-	err := c.retryUntilConnected(func() error {
+	err := c.retryUntilConnected(c.limited("childrenw", requestKindRead, 0, c.instrumented(context.Background(), "childrenw", path, func() error {
 		res, _, evts, err := c.getConn().ChildrenW(path)
 		if err != nil {
 			return err
@@ -386,7 +680,7 @@ func (c *Client) ChildrenW(path string) ([]string, <-chan zk.Event, error) {
 		children = res
 		eventCh = evts
 		return nil
-	})
+	})))
 
 	return children, eventCh,
 		errors.Wrapf(err, "zk client failed to get and watch children of %s", path)
@@ -394,13 +688,100 @@ func (c *Client) ChildrenW(path string) ([]string, <-chan zk.Event, error) {
 
 // Delete removes ZK path
 func (c *Client) Delete(path string) error {
-	err := c.retryUntilConnected(func() error {
+	return c.DeleteContext(context.Background(), path)
+}
+
+// DeleteContext is Delete with the round trip traced in the span of ctx
+func (c *Client) DeleteContext(ctx context.Context, path string) error {
+	if err := c.checkWritable("delete"); err != nil {
+		return errors.Wrapf(err, "zk client failed to delete node at %s", path)
+	}
+	previous := c.auditPrevious(path)
+	err := c.retryUntilConnected(c.limited("delete", requestKindWrite, 0, c.guarded("delete", c.instrumented(ctx, "delete", path, func() error {
 		err := c.getConn().Delete(path, -1)
 		return err
-	})
+	}))))
+	c.audit("delete", path, -1, previous, nil, err)
+	if err == nil && c.migration != nil {
+		c.migration.mirrorDelete(path)
+	}
 	return errors.Wrapf(err, "zk client failed to delete node at %s", path)
 }
 
+// RetryTimeout returns the time the client retries an operation before giving up
+func (c *Client) RetryTimeout() time.Duration {
+	return c.retryTimeout
+}
+
+// Clock returns the clock measuring the retry timeouts and the backoffs
+func (c *Client) Clock() util.Clock {
+	return c.clock
+}
+
+// UpdateFunc computes the new data of a node from its current data and stat, data and stat are
+// nil if the node does not exist. An error aborts the update and is returned as is
+type UpdateFunc func(data []byte, stat *zk.Stat) ([]byte, error)
+
+// UpdateWithRetry updates the node by compare-and-swap: it reads the data and the version of
+// the node, applies update and sets the result only if the version is unchanged, the node is
+// created if it does not exist. When the node is changed concurrently, the update is applied
+// again to the new data after a backoff, until the retry timeout
+func (c *Client) UpdateWithRetry(path string, update UpdateFunc) error {
+	return c.UpdateWithRetryContext(context.Background(), path, update)
+}
+
+// UpdateWithRetryContext is UpdateWithRetry with the round trips traced in the span of ctx
+func (c *Client) UpdateWithRetryContext(ctx context.Context, path string, update UpdateFunc) error {
+	backoff := util.Backoff{Initial: _updateInitialBackoff, Max: _updateMaxBackoff}
+	startTime := c.clock.Now()
+	for attempts := 1; ; attempts++ {
+		data, stat, err := c.GetContext(ctx, path)
+		exists := true
+		if errors.Cause(err) == zk.ErrNoNode {
+			exists, data, stat = false, nil, nil
+		} else if err != nil {
+			return err
+		}
+		data, err = update(data, stat)
+		if err != nil {
+			return err
+		}
+		var conflict bool
+		if exists {
+			err = c.SetContext(ctx, path, data, stat.Version)
+			cause := errors.Cause(err)
+			conflict = cause == zk.ErrBadVersion || cause == zk.ErrNoNode
+		} else {
+			err = c.CreateContext(ctx, path, data, FlagsZero, nil)
+			conflict = errors.Cause(err) == zk.ErrNodeExists
+		}
+		if !conflict {
+			return err
+		}
+		c.scope.Counter("update-conflicts").Inc(1)
+		if c.clock.Since(startTime) > c.retryTimeout {
+			return errors.Wrapf(err, "zk client gave up updating %s after %d attempts", path, attempts)
+		}
+		c.clock.Sleep(backoff.Next())
+	}
+}
+
+// updateRecord updates the record of an existing node with UpdateWithRetry
+func (c *Client) updateRecord(
+	ctx context.Context, path string, update func(record *model.ZNRecord)) error {
+	return c.UpdateWithRetryContext(ctx, path, func(data []byte, stat *zk.Stat) ([]byte, error) {
+		if stat == nil {
+			return nil, errors.Wrapf(zk.ErrNoNode, "zk client failed to update record at %s", path)
+		}
+		record, err := model.NewRecordFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		update(record)
+		return record.Marshal()
+	})
+}
+
 // UpdateMapField updates a map field for path
 // key is the top-level key in the MapFields
 // mapProperty is the inner key
@@ -418,56 +799,22 @@ func (c *Client) Delete(path string) error {
 //     "/CLUSTER/INSTANCES/{instance}/CURRENT_STATE/{sessionID}/{db}",
 //     "partition_1", "CURRENT_STATE", "ONLINE")
 func (c *Client) UpdateMapField(path string, key string, property string, value string) error {
-	data, stat, err := c.Get(path)
-	if err != nil {
-		return err
-	}
-
-	// convert the result into Message
-	node, err := model.NewRecordFromBytes(data)
-	if err != nil {
-		return err
-	}
-
-	// update the value
-	node.SetMapField(key, property, value)
-
-	// marshall to bytes
-	data, err = node.Marshal()
-	if err != nil {
-		return err
-	}
+	return c.UpdateMapFieldContext(context.Background(), path, key, property, value)
+}
 
-	// copy back to zookeeper
-	err = c.Set(path, data, stat.Version)
-	return err
+// UpdateMapFieldContext is UpdateMapField with the round trips traced in the span of ctx
+func (c *Client) UpdateMapFieldContext(
+	ctx context.Context, path string, key string, property string, value string) error {
+	return c.updateRecord(ctx, path, func(record *model.ZNRecord) {
+		record.SetMapField(key, property, value)
+	})
 }
 
 // UpdateSimpleField updates a simple field
 func (c *Client) UpdateSimpleField(path string, key string, value string) error {
-	data, stat, err := c.Get(path)
-	if err != nil {
-		return err
-	}
-
-	// convert the result into Message
-	node, err := model.NewRecordFromBytes(data)
-	if err != nil {
-		return err
-	}
-
-	// update the value
-	node.SetSimpleField(key, value)
-
-	// marshall to bytes
-	data, err = node.Marshal()
-	if err != nil {
-		return err
-	}
-
-	// copy back to zookeeper
-	err = c.Set(path, data, stat.Version)
-	return err
+	return c.updateRecord(context.Background(), path, func(record *model.ZNRecord) {
+		record.SetSimpleField(key, value)
+	})
 }
 
 // GetSimpleFieldValueByKey returns value in simple field by key
@@ -490,69 +837,88 @@ func (c *Client) GetSimpleFieldValueByKey(path string, key string) (string, erro
 	return v, nil
 }
 
-// DeleteTree removes ZK path and its children
+// DeleteTree removes ZK path and its children with the default DeleteTreeOptions
 func (c *Client) DeleteTree(path string) error {
-	if exists, _, err := c.Exists(path); !exists || err != nil {
-		return err
-	}
+	return c.DeleteTreeWithOptions(path)
+}
 
-	children, err := c.Children(path)
-	if err != nil {
-		return err
-	}
+// DeleteTreeContext is DeleteTree with the round trips traced in the span of ctx
+func (c *Client) DeleteTreeContext(ctx context.Context, path string) error {
+	return c.DeleteTreeWithOptionsContext(ctx, path)
+}
 
-	if len(children) == 0 {
-		err := c.Delete(path)
-		return err
-	}
+// RemoveMapFieldKey removes a map field by key
+func (c *Client) RemoveMapFieldKey(path string, key string) error {
+	return c.RemoveMapFieldKeyContext(context.Background(), path, key)
+}
 
-	for _, child := range children {
-		p := path + "/" + child
-		e := c.DeleteTree(p)
-		if e != nil {
-			return e
-		}
-	}
+// RemoveMapFieldKeyContext is RemoveMapFieldKey with the round trips traced in the span of ctx
+func (c *Client) RemoveMapFieldKeyContext(ctx context.Context, path string, key string) error {
+	return c.updateRecord(ctx, path, func(record *model.ZNRecord) {
+		record.RemoveMapField(key)
+	})
+}
 
-	return c.Delete(path)
+// GetRecordFromPath returns message by ZK path
+func (c *Client) GetRecordFromPath(path string) (*model.ZNRecord, error) {
+	return c.GetRecordFromPathContext(context.Background(), path)
 }
 
-// RemoveMapFieldKey removes a map field by key
-func (c *Client) RemoveMapFieldKey(path string, key string) error {
-	data, stat, err := c.Get(path)
+// GetRecordFromPathContext is GetRecordFromPath with the round trip traced in the span of ctx
+func (c *Client) GetRecordFromPathContext(ctx context.Context, path string) (*model.ZNRecord, error) {
+	record := &model.ZNRecord{}
+	stat, err := c.getValue(ctx, path, record, ZNRecordSerializer{})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	record.Version = stat.Version
+	return record, nil
+}
+
+// Serializer returns the serializer of the values of GetValue, SetValue and CreateValue
+func (c *Client) Serializer() Serializer {
+	return c.serializer
+}
+
+// GetValue decodes the data of the path into value with the serializer of the client,
+// value is a pointer like for json.Unmarshal
+func (c *Client) GetValue(path string, value interface{}) (*zk.Stat, error) {
+	return c.getValue(context.Background(), path, value, c.serializer)
+}
 
-	node, err := model.NewRecordFromBytes(data)
+// SetValue sets the data of the path to the value serialized by the serializer of the client,
+// the version -1 matches any version
+func (c *Client) SetValue(path string, value interface{}, version int32) error {
+	data, err := c.serializer.Serialize(value)
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "failed to serialize the value of %s", path)
 	}
+	return c.Set(path, data, version)
+}
 
-	node.RemoveMapField(key)
-
-	data, err = node.Marshal()
+// CreateValue creates the path, and its missing parents, with the value serialized by
+// the serializer of the client
+func (c *Client) CreateValue(p string, value interface{}, flags int32) error {
+	data, err := c.serializer.Serialize(value)
 	if err != nil {
+		return errors.Wrapf(err, "failed to serialize the value of %s", p)
+	}
+	if _, err := c.EnsurePath(path.Dir(p)); err != nil {
 		return err
 	}
-
-	// save the data back to zookeeper
-	err = c.Set(path, data, stat.Version)
-	return err
+	return c.Create(p, data, flags, nil)
 }
 
-// GetRecordFromPath returns message by ZK path
-func (c *Client) GetRecordFromPath(path string) (*model.ZNRecord, error) {
-	data, stat, err := c.Get(path)
+func (c *Client) getValue(
+	ctx context.Context, path string, value interface{}, serializer Serializer) (*zk.Stat, error) {
+	data, stat, err := c.GetContext(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	record, err := model.NewRecordFromBytes(data)
-	if err != nil {
-		return nil, err
+	if err := serializer.Deserialize(data, value); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize the data of %s", path)
 	}
-	record.Version = stat.Version
-	return record, nil
+	return stat, nil
 }
 
 // SetDataForPath updates data at given ZK path
@@ -560,6 +926,11 @@ func (c *Client) SetDataForPath(path string, data []byte, version int32) error {
 	return c.Set(path, data, version)
 }
 
+// SetDataForPathContext is SetDataForPath with the round trip traced in the span of ctx
+func (c *Client) SetDataForPathContext(ctx context.Context, path string, data []byte, version int32) error {
+	return c.SetContext(ctx, path, data, version)
+}
+
 // SetRecordForPath sets a record in give ZK path
 func (c *Client) SetRecordForPath(path string, r *model.ZNRecord) error {
 	version, err := c.getVersionFromPath(path)
@@ -567,7 +938,7 @@ func (c *Client) SetRecordForPath(path string, r *model.ZNRecord) error {
 		return err
 	}
 
-	data, err := r.Marshal()
+	data, err := ZNRecordSerializer{}.Serialize(r)
 	if err != nil {
 		return err
 	}
@@ -584,45 +955,28 @@ func (c *Client) getVersionFromPath(p string) (int32, error) {
 	exists, s, _ := c.Exists(p)
 	if !exists {
 		version := int32(0)
-		err := c.ensurePath(p)
+		_, err := c.EnsurePath(p)
 		if err != nil {
-			return version, errors.Wrap(err, "failed to get version from path: %v")
+			return version, errors.Wrapf(err, "failed to get version from path: %v", p)
 		}
 		return version, nil
 	}
 	return s.Version, nil
 }
 
-// EnsurePath makes sure the specified path exists.
-// If not, create it
-func (c *Client) ensurePath(p string) error {
-	exists, _, err := c.Exists(p)
-	if err != nil {
-		return err
-	}
-	if exists {
-		return nil
-	}
-	err = c.ensurePath(path.Dir(p))
-	if err != nil {
-		return err
-	}
-	return c.CreateEmptyNode(p)
-}
-
 // Mirrors org.I0Itec.zkclient.Client#retryUntilConnected
 func (c *Client) retryUntilConnected(fn func() error) error {
 	conn := c.getConn()
 	if conn == nil {
-		return errOpBeforeConnect
+		return ErrNotConnected
 	}
-	startTime := time.Now()
+	startTime := c.clock.Now()
 	for {
 		if conn.State() == zk.StateDisconnected {
-			return errors.New("zookeeper: client disconnected")
+			return ErrDisconnected
 		}
-		if (time.Since(startTime)) > c.retryTimeout {
-			return errors.New("zookeeper: retry has timed out")
+		if c.clock.Since(startTime) > c.retryTimeout {
+			return ErrRetryTimeout
 		}
 		err := fn()
 		if err == zk.ErrConnectionClosed || err == zk.ErrSessionExpired {
@@ -641,9 +995,9 @@ func (c *Client) retryUntilConnected(fn func() error) error {
 // ZooKeeper state change is broadcast by the cond variable of the client,
 // note c.cond.L is not locked when Wait first resumes
 func (c *Client) waitUntilConnected(t time.Duration) bool {
-	startTime := time.Now()
+	startTime := c.clock.Now()
 	for !c.IsConnected() {
-		if time.Since(startTime) > t {
+		if c.clock.Since(startTime) > t {
 			return false
 		}
 		doneCh := make(chan struct{})
@@ -654,7 +1008,7 @@ func (c *Client) waitUntilConnected(t time.Duration) bool {
 			close(doneCh)
 		}()
 		select {
-		case <-time.After(t):
+		case <-c.clock.After(t):
 		case <-doneCh:
 		}
 	}
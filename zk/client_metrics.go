@@ -0,0 +1,109 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/tally"
+)
+
+const (
+	_opTag   = "op"
+	_pathTag = "path"
+	_codeTag = "code"
+)
+
+var (
+	_latencyBuckets = tally.MustMakeExponentialDurationBuckets(time.Millisecond, 2, 14)
+
+	_errorCodes = map[error]string{
+		zk.ErrConnectionClosed:        "CONNECTIONCLOSED",
+		zk.ErrUnknown:                 "UNKNOWN",
+		zk.ErrAPIError:                "APIERROR",
+		zk.ErrNoNode:                  "NONODE",
+		zk.ErrNoAuth:                  "NOAUTH",
+		zk.ErrBadVersion:              "BADVERSION",
+		zk.ErrNoChildrenForEphemerals: "NOCHILDRENFOREPHEMERALS",
+		zk.ErrNodeExists:              "NODEEXISTS",
+		zk.ErrNotEmpty:                "NOTEMPTY",
+		zk.ErrSessionExpired:          "SESSIONEXPIRED",
+		zk.ErrInvalidACL:              "INVALIDACL",
+		zk.ErrAuthFailed:              "AUTHFAILED",
+		zk.ErrClosing:                 "CLOSING",
+		zk.ErrNothing:                 "NOTHING",
+		zk.ErrSessionMoved:            "SESSIONMOVED",
+	}
+)
+
+// WithPathTag configures whether the metrics of ZK operations are tagged by
+// the top-level path segment, which is the cluster name for Helix znodes
+func WithPathTag(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.pathTag = enabled
+	}
+}
+
+// instrumented wraps a ZK round trip so each attempt reports its latency and result,
+// tagged by op type and optionally by the top-level path segment, and is traced in a span child
+// of the span of ctx
+func (c *Client) instrumented(ctx context.Context, op string, path string, fn func() error) func() error {
+	tags := map[string]string{_opTag: op}
+	if c.pathTag {
+		tags[_pathTag] = topLevelSegment(path)
+	}
+	scope := c.scope.SubScope("op").Tagged(tags)
+	return func() error {
+		span := c.startSpan(ctx, op, path)
+		start := c.clock.Now()
+		err := fn()
+		latency := c.clock.Since(start)
+		endSpan(span, err)
+		scope.Timer("latency").Record(latency)
+		scope.Histogram("latency-histogram", _latencyBuckets).RecordDuration(latency)
+		if err != nil {
+			scope.Tagged(map[string]string{_codeTag: errorCode(err)}).Counter("failure").Inc(1)
+		} else {
+			scope.Counter("success").Inc(1)
+		}
+		return err
+	}
+}
+
+// errorCode returns the ZooKeeper error code name of err
+func errorCode(err error) string {
+	if code, ok := _errorCodes[err]; ok {
+		return code
+	}
+	return "OTHER"
+}
+
+// topLevelSegment returns the first segment of path, e.g. "cluster" for "/cluster/CONFIGS"
+func topLevelSegment(path string) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if segments[0] == "" {
+		return "/"
+	}
+	return segments[0]
+}
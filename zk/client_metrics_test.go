@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestClientOpMetrics(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))),
+		WithRetryTimeout(time.Second), WithPathTag(true))
+	assert.NoError(t, client.Connect())
+	assert.NoError(t, client.Create("/cluster", nil, FlagsZero, ACLPermAll))
+	_, _, err := client.Get("/cluster")
+	assert.NoError(t, err)
+	_, _, err = client.Get("/cluster/missing")
+	assert.Error(t, err)
+
+	snapshot := scope.Snapshot()
+	counters := map[string]int64{}
+	for _, c := range snapshot.Counters() {
+		tags := c.Tags()
+		counters[c.Name()+":"+tags[_opTag]+":"+tags[_pathTag]+":"+tags[_codeTag]] = c.Value()
+	}
+	assert.Equal(t, int64(1), counters["helix.zk.op.success:create:cluster:"])
+	assert.Equal(t, int64(1), counters["helix.zk.op.success:get:cluster:"])
+	assert.Equal(t, int64(1), counters["helix.zk.op.failure:get:cluster:NONODE"])
+
+	var getLatencies int
+	for _, timer := range snapshot.Timers() {
+		if timer.Name() == "helix.zk.op.latency" && timer.Tags()[_opTag] == "get" {
+			getLatencies += len(timer.Values())
+		}
+	}
+	assert.Equal(t, 2, getLatencies)
+	assert.NotEmpty(t, snapshot.Histograms())
+}
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, "NONODE", errorCode(zk.ErrNoNode))
+	assert.Equal(t, "BADVERSION", errorCode(zk.ErrBadVersion))
+	assert.Equal(t, "OTHER", errorCode(ErrNotConnected))
+}
+
+func TestTopLevelSegment(t *testing.T) {
+	assert.Equal(t, "cluster", topLevelSegment("/cluster/CONFIGS/PARTICIPANT"))
+	assert.Equal(t, "cluster", topLevelSegment("/cluster"))
+	assert.Equal(t, "/", topLevelSegment("/"))
+}
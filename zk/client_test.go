@@ -76,12 +76,13 @@ func (s *ZKClientTestSuite) TearDownTest() {
 }
 
 func (s *ZKClientTestSuite) TestEmbeddedZk() {
-	err := EnsureZookeeperUp(s.EmbeddedZkPath)
-	s.NoError(err)
-	err = StopZookeeper(s.EmbeddedZkPath)
-	s.NoError(err)
-	err = EnsureZookeeperUp(s.EmbeddedZkPath)
+	s.Server.Stop()
+	s.NoError(s.Server.Start())
+	c := s.CreateAndConnectClient()
+	defer c.Disconnect()
+	exists, _, err := c.Exists("/")
 	s.NoError(err)
+	s.True(exists)
 }
 
 func (s *ZKClientTestSuite) TestZKConnectAndDisconnect() {
@@ -106,7 +107,7 @@ func (s *ZKClientTestSuite) TestBasicZkOps() {
 	testPath1 := fmt.Sprintf("/%d/%d", rand.Int63(), rand.Int63())
 
 	err := s.zkClient.CreateDataWithPath(testPath, []byte(testData))
-	s.Equal(errOpBeforeConnect, errors.Cause(err))
+	s.Equal(ErrNotConnected, errors.Cause(err))
 	err = s.zkClient.Connect()
 	s.NoError(err)
 	s.True(s.zkClient.IsConnected())
@@ -291,3 +292,20 @@ func getFailOnceFunc(invokeCounter *int) func() error {
 		return zk.ErrSessionExpired
 	}
 }
+
+func (s *ZKClientTestSuite) TestNegotiatedSessionTimeout() {
+	sessions := make(chan time.Duration, 1)
+	s.zkClient.OnSessionEstablished(func(sessionID string, negotiatedTimeout time.Duration) {
+		s.Equal(s.zkClient.GetSessionID(), sessionID)
+		sessions <- negotiatedTimeout
+	})
+	s.Equal(time.Duration(0), s.zkClient.NegotiatedSessionTimeout())
+	s.NoError(s.zkClient.Connect())
+	select {
+	case timeout := <-sessions:
+		s.True(timeout > 0)
+		s.Equal(timeout, s.zkClient.NegotiatedSessionTimeout())
+	case <-time.After(5 * time.Second):
+		s.Fail("no session established")
+	}
+}
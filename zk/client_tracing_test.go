@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+func TestClientTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))),
+		WithRetryTimeout(time.Second), WithTracerProvider(tp))
+	assert.NoError(t, client.Connect())
+	assert.NoError(t, client.Create("/a", nil, FlagsZero, ACLPermAll))
+	_, _, err := client.Get("/b")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "zk.create", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "zk.get", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "NONODE", spans[1].Status().Description)
+}
+
+func TestClientTracingParentSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))),
+		WithRetryTimeout(time.Second), WithTracerProvider(tp))
+	assert.NoError(t, client.Connect())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	assert.NoError(t, client.CreateContext(ctx, "/a", []byte(`{"id":"a"}`), FlagsZero, ACLPermAll))
+	assert.NoError(t, client.UpdateMapFieldContext(ctx, "/a", "key", "property", "value"))
+	assert.NoError(t, client.DeleteTreeContext(ctx, "/a"))
+	parent.End()
+	assert.NoError(t, client.Create("/b", nil, FlagsZero, ACLPermAll))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 7)
+	for _, span := range spans[:5] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID(), span.Name())
+	}
+	assert.Equal(t, "parent", spans[5].Name())
+	// the round trips without a context are root spans
+	assert.Equal(t, "zk.create", spans[6].Name())
+	assert.False(t, spans[6].Parent().IsValid())
+}
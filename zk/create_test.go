@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestCreateIfNotExists(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	created, err := client.CreateIfNotExists("/a/b/c", []byte("data"))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	data, _, err := client.Get("/a/b/c")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	_, stat, err := client.Get("/a/b")
+	assert.NoError(t, err)
+	assert.Zero(t, stat.EphemeralOwner)
+
+	// the existing node is kept
+	created, err = client.CreateIfNotExists("/a/b/c", []byte("other"))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	data, _, err = client.Get("/a/b/c")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	created, err = client.EnsurePath("/a/b")
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	// only one of the concurrent creators creates the node
+	var wg sync.WaitGroup
+	var count int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := client.EnsurePath("/x/y/z")
+			assert.NoError(t, err)
+			if created {
+				atomic.AddInt32(&count, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), count)
+	exists, err := client.ExistsAll("/x", "/x/y", "/x/y/z")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
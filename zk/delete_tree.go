@@ -0,0 +1,236 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+)
+
+const (
+	_defaultDeletePageSize    = 1000
+	_defaultDeleteConcurrency = 8
+	_defaultDeleteRetryBudget = 100
+)
+
+type deleteTreeOptions struct {
+	pageSize    int
+	concurrency int
+	opsPerSec   int
+	retryBudget int
+}
+
+// DeleteTreeOption configures DeleteTreeWithOptions
+type DeleteTreeOption func(*deleteTreeOptions)
+
+// WithDeletePageSize sets the number of children deleted at a time under a node,
+// bounding the goroutines and memory used for nodes with many children
+func WithDeletePageSize(size int) DeleteTreeOption {
+	return func(o *deleteTreeOptions) {
+		o.pageSize = size
+	}
+}
+
+// WithDeleteConcurrency sets the number of ZK requests in flight while deleting
+func WithDeleteConcurrency(concurrency int) DeleteTreeOption {
+	return func(o *deleteTreeOptions) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithDeleteRate limits the ZK requests per second while deleting, 0 means unlimited
+func WithDeleteRate(opsPerSec int) DeleteTreeOption {
+	return func(o *deleteTreeOptions) {
+		o.opsPerSec = opsPerSec
+	}
+}
+
+// WithDeleteRetryBudget sets the number of failed ZK requests retried while deleting
+// the whole tree, e.g. deleting a node a child was concurrently added to
+func WithDeleteRetryBudget(retries int) DeleteTreeOption {
+	return func(o *deleteTreeOptions) {
+		o.retryBudget = retries
+	}
+}
+
+// treeDeleter holds the state shared by the goroutines deleting a tree
+type treeDeleter struct {
+	client    *Client
+	ctx       context.Context
+	pageSize  int
+	sem       chan struct{}
+	limiter   *opLimiter
+	retries   int64
+	deleted   int64
+	firstErr  error
+	firstErrM sync.Mutex
+}
+
+// DeleteTreeWithOptions removes ZK path and its children. The children of each node are
+// deleted in pages with bounded concurrency and an optional rate limit. Failures in a subtree
+// do not stop the deletion of the other subtrees, failed requests are retried within the retry
+// budget and the first error not recovered from is returned once the rest is deleted
+func (c *Client) DeleteTreeWithOptions(path string, options ...DeleteTreeOption) error {
+	return c.DeleteTreeWithOptionsContext(context.Background(), path, options...)
+}
+
+// DeleteTreeWithOptionsContext is DeleteTreeWithOptions with the round trips traced in the span of ctx
+func (c *Client) DeleteTreeWithOptionsContext(
+	ctx context.Context, path string, options ...DeleteTreeOption) error {
+	o := &deleteTreeOptions{
+		pageSize:    _defaultDeletePageSize,
+		concurrency: _defaultDeleteConcurrency,
+		retryBudget: _defaultDeleteRetryBudget,
+	}
+	for _, option := range options {
+		option(o)
+	}
+	if o.pageSize < 1 {
+		o.pageSize = 1
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+	d := &treeDeleter{
+		client:   c,
+		ctx:      ctx,
+		pageSize: o.pageSize,
+		sem:      make(chan struct{}, o.concurrency),
+		limiter:  newOpLimiter(c.clock, o.opsPerSec),
+		retries:  int64(o.retryBudget),
+	}
+	start := time.Now()
+	d.deleteTree(path)
+	c.scope.Timer("delete-tree-latency").Record(time.Since(start))
+	c.scope.Counter("delete-tree-nodes").Inc(atomic.LoadInt64(&d.deleted))
+	return d.firstErr
+}
+
+func (d *treeDeleter) deleteTree(path string) {
+	for {
+		var children []string
+		err := d.do(func() (err error) {
+			children, err = d.client.ChildrenContext(d.ctx, path)
+			return err
+		})
+		if errors.Cause(err) == zk.ErrNoNode {
+			return
+		}
+		if err != nil {
+			if d.retry() {
+				continue
+			}
+			d.fail(err)
+			return
+		}
+
+		for start := 0; start < len(children); start += d.pageSize {
+			end := start + d.pageSize
+			if end > len(children) {
+				end = len(children)
+			}
+			var wg sync.WaitGroup
+			for _, child := range children[start:end] {
+				wg.Add(1)
+				go func(child string) {
+					defer wg.Done()
+					d.deleteTree(path + "/" + child)
+				}(child)
+			}
+			wg.Wait()
+		}
+
+		err = d.do(func() error {
+			return d.client.DeleteContext(d.ctx, path)
+		})
+		switch cause := errors.Cause(err); {
+		case cause == nil:
+			atomic.AddInt64(&d.deleted, 1)
+			return
+		case cause == zk.ErrNoNode:
+			return
+		case d.retry():
+			// e.g. ErrNotEmpty when a child was added concurrently, list the children again
+			continue
+		default:
+			d.fail(err)
+			return
+		}
+	}
+}
+
+// do runs the ZK request within the concurrency and rate limits
+func (d *treeDeleter) do(request func() error) error {
+	d.sem <- struct{}{}
+	defer func() { <-d.sem }()
+	d.limiter.wait()
+	return request()
+}
+
+// retry takes a retry from the budget, it returns false if the budget is used up
+func (d *treeDeleter) retry() bool {
+	return atomic.AddInt64(&d.retries, -1) >= 0
+}
+
+func (d *treeDeleter) fail(err error) {
+	d.firstErrM.Lock()
+	defer d.firstErrM.Unlock()
+	if d.firstErr == nil {
+		d.firstErr = err
+	}
+}
+
+// opLimiter spaces the requests evenly to not exceed the rate
+type opLimiter struct {
+	clock    util.Clock
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newOpLimiter creates a limiter of opsPerSec, it returns nil which never waits if opsPerSec is 0
+func newOpLimiter(clock util.Clock, opsPerSec int) *opLimiter {
+	if opsPerSec <= 0 {
+		return nil
+	}
+	return &opLimiter{clock: clock, interval: time.Second / time.Duration(opsPerSec)}
+}
+
+func (l *opLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := l.clock.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	l.clock.Sleep(wait)
+}
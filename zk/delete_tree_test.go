@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// failingDeleteConnFactory makes connections failing the deletes of a path with ErrNotEmpty
+type failingDeleteConnFactory struct {
+	ConnFactory
+	path     string
+	failures int32
+}
+
+func (f *failingDeleteConnFactory) NewConn() (Connection, <-chan zk.Event, error) {
+	conn, eventCh, err := f.ConnFactory.NewConn()
+	return &failingDeleteConn{Connection: conn, factory: f}, eventCh, err
+}
+
+type failingDeleteConn struct {
+	Connection
+	factory *failingDeleteConnFactory
+}
+
+func (c *failingDeleteConn) Delete(path string, version int32) error {
+	if path == c.factory.path && atomic.AddInt32(&c.factory.failures, -1) >= 0 {
+		return zk.ErrNotEmpty
+	}
+	return c.Connection.Delete(path, version)
+}
+
+func createTestTree(t *testing.T, client *Client, root string, fanOut int, depth int) int {
+	assert.NoError(t, client.CreateEmptyNode(root))
+	if depth == 0 {
+		return 1
+	}
+	count := 1
+	for i := 0; i < fanOut; i++ {
+		count += createTestTree(t, client, fmt.Sprintf("%s/%d", root, i), fanOut, depth-1)
+	}
+	return count
+}
+
+func TestDeleteTreeWithOptions(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))),
+		WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	nodes := createTestTree(t, client, "/cluster", 6, 3)
+
+	assert.NoError(t, client.DeleteTreeWithOptions("/cluster",
+		WithDeletePageSize(4), WithDeleteConcurrency(3)))
+	exists, _, err := client.Exists("/cluster")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	var deleted int64
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.zk.delete-tree-nodes" {
+			deleted += counter.Value()
+		}
+	}
+	assert.Equal(t, int64(nodes), deleted)
+
+	assert.NoError(t, client.DeleteTree("/cluster"), "deleting a missing tree is a no-op")
+}
+
+func TestDeleteTreeRetryBudget(t *testing.T) {
+	factory := &failingDeleteConnFactory{
+		ConnFactory: NewFakeZk(DefaultConnectionState(zk.StateHasSession)),
+		path:        "/cluster/1",
+		failures:    2,
+	}
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(factory), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	createTestTree(t, client, "/cluster", 3, 2)
+
+	err := client.DeleteTreeWithOptions("/cluster", WithDeleteRetryBudget(1))
+	assert.Equal(t, zk.ErrNotEmpty, errors.Cause(err))
+	// the other subtrees are deleted regardless of the failure
+	children, err := client.Children("/cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, children)
+
+	factory.failures = 1
+	assert.NoError(t, client.DeleteTreeWithOptions("/cluster", WithDeleteRetryBudget(1)))
+	exists, _, err := client.Exists("/cluster")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestOpLimiter(t *testing.T) {
+	assert.Nil(t, newOpLimiter(util.RealClock, 0))
+	newOpLimiter(util.RealClock, 0).wait()
+
+	limiter := newOpLimiter(util.RealClock, 100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		limiter.wait()
+	}
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
@@ -0,0 +1,429 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// The operations of the mutations recorded in a dry run
+const (
+	MutationCreate          = "create"
+	MutationCreateContainer = "createcontainer"
+	MutationCreateTTL       = "createttl"
+	MutationSet             = "set"
+	MutationDelete          = "delete"
+)
+
+// Mutation is a change of a znode, recorded instead of being applied in a dry run
+type Mutation struct {
+	Op   string
+	Path string
+	// Data is the data of the created or set znode
+	Data []byte
+	// Version is the expected version of the set or deleted znode, -1 matches any version
+	Version int32
+	// Flags are the flags of the created znode, e.g. FlagsEphemeral
+	Flags int32
+	// PreviousData is the data of the set or deleted znode before the mutation
+	PreviousData []byte
+}
+
+func (m Mutation) String() string {
+	switch m.Op {
+	case MutationDelete:
+		return fmt.Sprintf("%s %s", m.Op, m.Path)
+	default:
+		return fmt.Sprintf("%s %s (%d bytes)", m.Op, m.Path, len(m.Data))
+	}
+}
+
+// Diff returns the changes of the fields of the ZNRecord of the znode, nil if the data
+// is not a ZNRecord
+func (m Mutation) Diff() model.RecordDiff {
+	return diffRecordData(m.PreviousData, m.Data)
+}
+
+// DryRunRecorder records the mutations of a dry run client
+type DryRunRecorder struct {
+	mu        sync.Mutex
+	mutations []Mutation
+}
+
+// Mutations returns the mutations recorded so far in order
+func (r *DryRunRecorder) Mutations() []Mutation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Mutation(nil), r.mutations...)
+}
+
+func (r *DryRunRecorder) record(m Mutation) {
+	r.mu.Lock()
+	r.mutations = append(r.mutations, m)
+	r.mu.Unlock()
+}
+
+// NewDryRunClient returns a client sharing the session of client whose mutations are recorded
+// by the returned recorder instead of being applied. Its reads see the znodes of client with the
+// recorded mutations applied, so an operation of several steps records the mutations it would
+// perform, e.g. the parents created before a node. The dry run client is disconnected once done,
+// client is left connected
+func NewDryRunClient(client *Client) (*Client, *DryRunRecorder, error) {
+	recorder := &DryRunRecorder{}
+	dryRun := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(&dryRunConnFactory{client: client, recorder: recorder}),
+		WithRetryTimeout(client.retryTimeout),
+		WithSerializer(client.serializer),
+	)
+	dryRun.maxPayloadSize = client.maxPayloadSize
+	dryRun.aclProvider = client.aclProvider
+	dryRun.readOnly = client.readOnly
+	dryRun.clock = client.clock
+	if err := dryRun.Connect(); err != nil {
+		return nil, nil, err
+	}
+	return dryRun, recorder, nil
+}
+
+type dryRunConnFactory struct {
+	client   *Client
+	recorder *DryRunRecorder
+}
+
+func (f *dryRunConnFactory) NewConn() (Connection, <-chan zk.Event, error) {
+	if f.client.getConn() == nil {
+		return nil, nil, ErrNotConnected
+	}
+	eventCh := make(chan zk.Event)
+	return &dryRunConn{
+		client:   f.client,
+		recorder: f.recorder,
+		eventCh:  eventCh,
+		nodes:    map[string]*dryRunNode{},
+	}, eventCh, nil
+}
+
+// dryRunNode is a znode created, set or deleted in the dry run
+type dryRunNode struct {
+	data    []byte
+	version int32
+	deleted bool
+	// created is set if the node is created in the dry run, its children are then
+	// only the ones created in the dry run
+	created bool
+}
+
+// dryRunConn serves the reads from the connection of the client overlaid with the mutations
+// recorded in the dry run
+type dryRunConn struct {
+	client   *Client
+	recorder *DryRunRecorder
+	eventCh  chan zk.Event
+
+	mu    sync.Mutex
+	nodes map[string]*dryRunNode
+	// seq is the counter of the sequential nodes created in the dry run
+	seq int
+	// closed is set once eventCh is closed
+	closed bool
+}
+
+func (c *dryRunConn) base() Connection {
+	return c.client.getConn()
+}
+
+func (c *dryRunConn) AddAuth(scheme string, auth []byte) error {
+	return nil
+}
+
+func (c *dryRunConn) Get(p string) ([]byte, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(p)
+}
+
+func (c *dryRunConn) GetW(p string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	_, _, events, err := c.base().GetW(p)
+	if err != nil && err != zk.ErrNoNode {
+		return nil, nil, nil, err
+	}
+	data, stat, err := c.Get(p)
+	return data, stat, events, err
+}
+
+func (c *dryRunConn) Exists(p string) (bool, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exists(p)
+}
+
+func (c *dryRunConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	_, _, events, err := c.base().ExistsW(p)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	exists, stat, err := c.Exists(p)
+	return exists, stat, events, err
+}
+
+func (c *dryRunConn) Children(p string) ([]string, *zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.children(p)
+}
+
+func (c *dryRunConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	_, _, events, err := c.base().ChildrenW(p)
+	if err != nil && err != zk.ErrNoNode {
+		return nil, nil, nil, err
+	}
+	children, stat, err := c.Children(p)
+	return children, stat, events, err
+}
+
+func (c *dryRunConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.create(MutationCreate, p, data, flags)
+}
+
+// CreateContainer records the creation of a container node if the connection of the client can create one
+func (c *dryRunConn) CreateContainer(p string, data []byte, acl []zk.ACL) (string, error) {
+	if _, ok := c.base().(ExtendedCreator); !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.create(MutationCreateContainer, p, data, FlagsZero)
+}
+
+// CreateTTL records the creation of a TTL node if the connection of the client can create one
+func (c *dryRunConn) CreateTTL(p string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) (string, error) {
+	if _, ok := c.base().(ExtendedCreator); !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.create(MutationCreateTTL, p, data, flags)
+}
+
+func (c *dryRunConn) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.set(p, data, version)
+}
+
+func (c *dryRunConn) Delete(p string, version int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.delete(p, version)
+}
+
+// Multi records the mutations of the operations if they all succeed, none otherwise
+func (c *dryRunConn) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make(map[string]*dryRunNode, len(c.nodes))
+	for p, node := range c.nodes {
+		copied := *node
+		snapshot[p] = &copied
+	}
+	c.recorder.mu.Lock()
+	recorded := len(c.recorder.mutations)
+	c.recorder.mu.Unlock()
+
+	responses := make([]zk.MultiResponse, len(ops))
+	var opErr error
+	for i, op := range ops {
+		var err error
+		switch op := op.(type) {
+		case *zk.CreateRequest:
+			responses[i].String, err = c.create(MutationCreate, op.Path, op.Data, op.Flags)
+		case *zk.SetDataRequest:
+			responses[i].Stat, err = c.set(op.Path, op.Data, op.Version)
+		case *zk.DeleteRequest:
+			err = c.delete(op.Path, op.Version)
+		case *zk.CheckVersionRequest:
+			var stat *zk.Stat
+			if _, stat, err = c.get(op.Path); err == nil && op.Version != -1 && op.Version != stat.Version {
+				err = zk.ErrBadVersion
+			}
+		default:
+			return nil, fmt.Errorf("unknown operation type %T", op)
+		}
+		responses[i].Error = err
+		if err != nil {
+			opErr = err
+			break
+		}
+	}
+	if opErr != nil {
+		c.nodes = snapshot
+		c.recorder.mu.Lock()
+		c.recorder.mutations = c.recorder.mutations[:recorded]
+		c.recorder.mu.Unlock()
+		return responses, opErr
+	}
+	return responses, nil
+}
+
+func (c *dryRunConn) SessionID() int64 {
+	return c.base().SessionID()
+}
+
+func (c *dryRunConn) SetLogger(zk.Logger) {}
+
+func (c *dryRunConn) State() zk.State {
+	if conn := c.base(); conn != nil {
+		return conn.State()
+	}
+	return zk.StateDisconnected
+}
+
+// Close stops the event processing of the dry run client, the connection of the client is left open
+func (c *dryRunConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.eventCh)
+	}
+}
+
+func (c *dryRunConn) get(p string) ([]byte, *zk.Stat, error) {
+	if node, ok := c.nodes[p]; ok {
+		if node.deleted {
+			return nil, nil, zk.ErrNoNode
+		}
+		return node.data, &zk.Stat{Version: node.version}, nil
+	}
+	return c.base().Get(p)
+}
+
+func (c *dryRunConn) exists(p string) (bool, *zk.Stat, error) {
+	if node, ok := c.nodes[p]; ok {
+		if node.deleted {
+			return false, nil, nil
+		}
+		return true, &zk.Stat{Version: node.version}, nil
+	}
+	return c.base().Exists(p)
+}
+
+func (c *dryRunConn) children(p string) ([]string, *zk.Stat, error) {
+	exists, stat, err := c.exists(p)
+	if err != nil {
+		return nil, nil, err
+	} else if !exists {
+		return nil, nil, zk.ErrNoNode
+	}
+	names := map[string]struct{}{}
+	if node, ok := c.nodes[p]; !ok || !node.created {
+		children, _, err := c.base().Children(p)
+		if err != nil && err != zk.ErrNoNode {
+			return nil, nil, err
+		}
+		for _, child := range children {
+			names[child] = struct{}{}
+		}
+	}
+	for nodePath, node := range c.nodes {
+		if path.Dir(nodePath) != p || nodePath == p {
+			continue
+		}
+		name := path.Base(nodePath)
+		if node.deleted {
+			delete(names, name)
+		} else {
+			names[name] = struct{}{}
+		}
+	}
+	children := make([]string, 0, len(names))
+	for name := range names {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+	return children, stat, nil
+}
+
+func (c *dryRunConn) create(op string, p string, data []byte, flags int32) (string, error) {
+	if flags&zk.FlagSequence != 0 {
+		c.seq++
+		p = fmt.Sprintf("%s%010d", p, c.seq)
+	}
+	if exists, _, err := c.exists(p); err != nil {
+		return "", err
+	} else if exists {
+		return "", zk.ErrNodeExists
+	}
+	if parent := path.Dir(p); parent != "/" {
+		if exists, _, err := c.exists(parent); err != nil {
+			return "", err
+		} else if !exists {
+			return "", zk.ErrNoNode
+		}
+	}
+	c.nodes[p] = &dryRunNode{data: data, created: true}
+	c.recorder.record(Mutation{Op: op, Path: p, Data: data, Version: -1, Flags: flags})
+	return p, nil
+}
+
+func (c *dryRunConn) set(p string, data []byte, version int32) (*zk.Stat, error) {
+	previous, stat, err := c.get(p)
+	if err != nil {
+		return nil, err
+	}
+	if version != -1 && version != stat.Version {
+		return nil, zk.ErrBadVersion
+	}
+	node, ok := c.nodes[p]
+	c.nodes[p] = &dryRunNode{data: data, version: stat.Version + 1, created: ok && node.created}
+	c.recorder.record(Mutation{Op: MutationSet, Path: p, Data: data, Version: version, PreviousData: previous})
+	return &zk.Stat{Version: stat.Version + 1}, nil
+}
+
+func (c *dryRunConn) delete(p string, version int32) error {
+	previous, stat, err := c.get(p)
+	if err != nil {
+		return err
+	}
+	if version != -1 && version != stat.Version {
+		return zk.ErrBadVersion
+	}
+	children, _, err := c.children(p)
+	if err != nil {
+		return err
+	} else if len(children) > 0 {
+		return zk.ErrNotEmpty
+	}
+	c.nodes[p] = &dryRunNode{deleted: true}
+	c.recorder.record(Mutation{Op: MutationDelete, Path: p, Version: version, PreviousData: previous})
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestDryRunClient(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	assert.NoError(t, client.CreateDataWithPath("/a/b", []byte("b")))
+
+	dryRun, recorder, err := NewDryRunClient(client)
+	assert.NoError(t, err)
+	assert.NoError(t, dryRun.CreateDataWithPath("/a/c/d", []byte("d")))
+	assert.NoError(t, dryRun.Set("/a/b", []byte("b2"), -1))
+	assert.NoError(t, dryRun.Delete("/a/b"))
+	assert.Equal(t, ErrNodeExists, errors.Cause(dryRun.CreateEmptyNode("/a")))
+	assert.Equal(t, ErrNotEmpty, errors.Cause(dryRun.Delete("/a")))
+
+	// the dry run reads see the recorded mutations
+	data, _, err := dryRun.Get("/a/c/d")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("d"), data)
+	children, err := dryRun.Children("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, children)
+
+	var ops []string
+	for _, m := range recorder.Mutations() {
+		ops = append(ops, m.String())
+	}
+	assert.Equal(t, []string{
+		"createcontainer /a/c (0 bytes)",
+		"create /a/c/d (1 bytes)",
+		"set /a/b (2 bytes)",
+		"delete /a/b",
+	}, ops)
+	// the data is not a ZNRecord
+	assert.Nil(t, recorder.Mutations()[2].Diff())
+	assert.Equal(t, []byte("b"), recorder.Mutations()[2].PreviousData)
+
+	// the client is not changed
+	dryRun.Disconnect()
+	assert.True(t, client.IsConnected())
+	data, _, err = client.Get("/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), data)
+	exists, _, err := client.Exists("/a/c")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+)
+
+// EphemeralEventType is the type of the changes of the node of an EphemeralGuard
+type EphemeralEventType string
+
+const (
+	// EphemeralEventCreated is sent when the guard creates the node for the session
+	EphemeralEventCreated EphemeralEventType = "CREATED"
+	// EphemeralEventLost is sent when the node of the session vanishes
+	EphemeralEventLost EphemeralEventType = "LOST"
+	// EphemeralEventConflict is sent when the node is held by another session,
+	// the guard waits for the node to be deleted before creating it again
+	EphemeralEventConflict EphemeralEventType = "CONFLICT"
+)
+
+// EphemeralEvent is delivered to the listener of an EphemeralGuard
+type EphemeralEvent struct {
+	Type EphemeralEventType
+	Path string
+	// SessionID is the session that created, lost or conflicts on the node
+	SessionID string
+	// Owner is the session holding the node on EphemeralEventConflict
+	Owner string
+	// Err is zk.ErrSessionExpired if the node was lost with the session,
+	// or zk.ErrNoNode if it was deleted by another client
+	Err error
+}
+
+// EphemeralGuardOption configures an EphemeralGuard
+type EphemeralGuardOption func(*EphemeralGuard)
+
+// WithEphemeralListener calls fn on the changes of the node, fn is called from
+// the goroutine of the guard and must not block
+func WithEphemeralListener(fn func(EphemeralEvent)) EphemeralGuardOption {
+	return func(g *EphemeralGuard) {
+		g.listener = fn
+	}
+}
+
+// EphemeralGuard owns an ephemeral node of the session of the client, e.g. a live instance,
+// a leader node or a lock. It watches the node, notifies the listener when the node is lost
+// because the session expired or another client deleted it, and creates it again once it is
+// safe, that is when the client has a session and no other session holds the node
+type EphemeralGuard struct {
+	client   *Client
+	logger   util.Logger
+	scope    tally.Scope
+	path     string
+	data     func() ([]byte, error)
+	listener func(EphemeralEvent)
+
+	mu sync.Mutex
+	// heldSession is the session holding the node, empty if the node is not held
+	heldSession string
+	// quitCh stops the watch of the node, nil if the guard is not started
+	quitCh chan struct{}
+}
+
+// NewEphemeralGuard creates an EphemeralGuard of the path, data is called on each creation
+// of the node so the data may refer to the current session
+func NewEphemeralGuard(
+	client *Client,
+	path string,
+	data func() ([]byte, error),
+	options ...EphemeralGuardOption,
+) *EphemeralGuard {
+	g := &EphemeralGuard{
+		client: client,
+		logger: client.logger.With(util.Field("path", path)),
+		scope:  client.scope.SubScope("ephemeral"),
+		path:   path,
+		data:   data,
+	}
+	for _, option := range options {
+		option(g)
+	}
+	client.AddWatcher(g)
+	return g
+}
+
+// Process reports the loss of the node as soon as the session expires,
+// the node is created again once the next session is established
+func (g *EphemeralGuard) Process(e zk.Event) {
+	if e.State == zk.StateExpired {
+		g.lose("", zk.ErrSessionExpired)
+	}
+}
+
+// Ensure creates the node for the session of the client if it does not exist. It returns
+// zk.ErrNodeExists if the node is held by another session, e.g. the previous session of
+// the owner that has not timed out yet
+func (g *EphemeralGuard) Ensure() error {
+	data, err := g.data()
+	if err != nil {
+		return errors.Wrapf(err, "failed to create data of ephemeral node %s", g.path)
+	}
+	sessionID := g.client.GetSessionID()
+	err = g.client.Create(g.path, data, FlagsEphemeral, nil)
+	if err == nil {
+		g.hold(sessionID)
+		g.scope.Counter("created").Inc(1)
+		g.notify(EphemeralEvent{Type: EphemeralEventCreated, SessionID: sessionID})
+		return nil
+	}
+	if errors.Cause(err) != zk.ErrNodeExists {
+		return err
+	}
+	owner, err := g.owner()
+	if err != nil {
+		return err
+	}
+	if owner != sessionID {
+		return errors.Wrapf(zk.ErrNodeExists, "ephemeral node %s is held by session %s", g.path, owner)
+	}
+	g.hold(sessionID)
+	return nil
+}
+
+// Start ensures the node exists and watches it until Stop is called
+func (g *EphemeralGuard) Start() error {
+	if err := g.Ensure(); err != nil {
+		return err
+	}
+	g.startWatch()
+	return nil
+}
+
+// Contend watches the node until Stop is called like Start, but the node held by another
+// session is not an error: it is created once that session deletes it or expires,
+// e.g. to elect a leader among the clients contending for the node
+func (g *EphemeralGuard) Contend() error {
+	if err := g.Ensure(); err != nil && errors.Cause(err) != zk.ErrNodeExists {
+		return err
+	}
+	g.startWatch()
+	return nil
+}
+
+func (g *EphemeralGuard) startWatch() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.quitCh == nil {
+		g.quitCh = make(chan struct{})
+		go g.watch(g.quitCh)
+	}
+}
+
+// Stop stops watching the node, the node is left for the session to remove
+func (g *EphemeralGuard) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.quitCh != nil {
+		close(g.quitCh)
+		g.quitCh = nil
+	}
+	g.heldSession = ""
+}
+
+// Release stops watching the node and deletes it if it is held by the session of the client
+func (g *EphemeralGuard) Release() error {
+	g.Stop()
+	owner, err := g.owner()
+	if errors.Cause(err) == zk.ErrNoNode || (err == nil && owner != g.client.GetSessionID()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = g.client.Delete(g.path)
+	if errors.Cause(err) == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// IsHeld returns if the node is held by the session of the client
+func (g *EphemeralGuard) IsHeld() bool {
+	owner, err := g.owner()
+	return err == nil && owner == g.client.GetSessionID()
+}
+
+func (g *EphemeralGuard) watch(quitCh chan struct{}) {
+	// conflict is the other session last reported to hold the node
+	var conflict string
+	for {
+		exists, eventCh, err := g.client.ExistsW(g.path)
+		if isClosed(quitCh) {
+			return
+		}
+		if err != nil {
+			g.logger.Warn("failed to watch ephemeral node", util.ErrorField(err))
+			if !g.client.sleepUnlessClosed(quitCh, _rearmBackoff) {
+				return
+			}
+			continue
+		}
+		sessionID := g.client.GetSessionID()
+		if !exists {
+			g.lose(sessionID, zk.ErrNoNode)
+			if err := g.Ensure(); err != nil && errors.Cause(err) != zk.ErrNodeExists {
+				g.logger.Warn("failed to create ephemeral node", util.ErrorField(err))
+				if !g.client.sleepUnlessClosed(quitCh, _rearmBackoff) {
+					return
+				}
+			}
+			continue
+		}
+		// the watch is still awaited if the owner can't be read, it fires if the node
+		// was deleted or the session expired in the meantime
+		owner, err := g.owner()
+		if err != nil {
+			g.logger.Warn("failed to read owner of ephemeral node", util.ErrorField(err))
+		} else if owner != sessionID {
+			g.lose(sessionID, zk.ErrSessionExpired)
+			if owner != conflict {
+				conflict = owner
+				g.logger.Warn("ephemeral node is held by another session", util.Field("owner", owner))
+				g.scope.Counter("conflicts").Inc(1)
+				g.notify(EphemeralEvent{Type: EphemeralEventConflict, SessionID: sessionID, Owner: owner})
+			}
+		} else {
+			conflict = ""
+		}
+
+		select {
+		case <-quitCh:
+			return
+		case ev := <-eventCh:
+			if ev.Type == zk.EventNotWatching && ev.Err == zk.ErrSessionExpired {
+				// report the loss right away instead of once the next session is established
+				g.lose("", zk.ErrSessionExpired)
+				if !g.client.waitReconnectJitter(quitCh) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// owner returns the session holding the node
+func (g *EphemeralGuard) owner() (string, error) {
+	exists, stat, err := g.client.Exists(g.path)
+	if err != nil {
+		return "", err
+	} else if !exists {
+		return "", errors.Wrapf(zk.ErrNoNode, "ephemeral node %s does not exist", g.path)
+	}
+	return strconv.FormatInt(stat.EphemeralOwner, 10), nil
+}
+
+func (g *EphemeralGuard) hold(sessionID string) {
+	g.mu.Lock()
+	g.heldSession = sessionID
+	g.mu.Unlock()
+}
+
+// lose notifies the loss of the node if it was held, err is the reason if the session
+// still holding the node is sessionID, otherwise the node was lost with the session
+func (g *EphemeralGuard) lose(sessionID string, err error) {
+	g.mu.Lock()
+	held := g.heldSession
+	g.heldSession = ""
+	g.mu.Unlock()
+	if held == "" {
+		return
+	}
+	if held != sessionID {
+		err = zk.ErrSessionExpired
+	}
+	g.logger.Warn("ephemeral node lost", util.Field("sessionID", held), util.ErrorField(err))
+	g.scope.Counter("lost").Inc(1)
+	g.notify(EphemeralEvent{Type: EphemeralEventLost, SessionID: held, Err: err})
+}
+
+func (g *EphemeralGuard) notify(e EphemeralEvent) {
+	if g.listener == nil {
+		return
+	}
+	e.Path = g.path
+	g.listener(e)
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepUnlessClosed sleeps for d on the clock of the client, it returns false if ch is closed in
+// the meantime
+func (c *Client) sleepUnlessClosed(ch chan struct{}, d time.Duration) bool {
+	select {
+	case <-ch:
+		return false
+	case <-c.clock.After(d):
+		return true
+	}
+}
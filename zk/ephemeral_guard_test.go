@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestEphemeralGuard(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	other := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, other.Connect())
+	defer other.Disconnect()
+
+	events := make(chan EphemeralEvent, 10)
+	data := func() ([]byte, error) { return []byte(client.GetSessionID()), nil }
+	g := NewEphemeralGuard(client, "/e", data, WithEphemeralListener(func(e EphemeralEvent) { events <- e }))
+	assert.NoError(t, g.Start())
+	defer g.Stop()
+	sessionID := client.GetSessionID()
+	assert.Equal(t, EphemeralEvent{Type: EphemeralEventCreated, Path: "/e", SessionID: sessionID},
+		receiveEphemeralEvent(t, events))
+	assert.True(t, g.IsHeld())
+	// the node already held by the session is kept
+	assert.NoError(t, g.Ensure())
+
+	// the node deleted by another client is created again
+	assert.NoError(t, other.Delete("/e"))
+	assert.Equal(t, EphemeralEvent{Type: EphemeralEventLost, Path: "/e", SessionID: sessionID, Err: zk.ErrNoNode},
+		receiveEphemeralEvent(t, events))
+	assert.Equal(t, EphemeralEventCreated, receiveEphemeralEvent(t, events).Type)
+	assert.True(t, g.IsHeld())
+	// leave time to set the watch again
+	time.Sleep(50 * time.Millisecond)
+
+	// the node lost with the session is not created while another session holds it
+	conn := client.getConn().(*FakeZkConn)
+	z.SetState(conn, zk.StateExpired)
+	assert.Equal(t, EphemeralEvent{Type: EphemeralEventLost, Path: "/e", SessionID: sessionID, Err: zk.ErrSessionExpired},
+		receiveEphemeralEvent(t, events))
+	assert.NoError(t, other.Create("/e", nil, FlagsEphemeral, ACLPermAll))
+	z.SetState(conn, zk.StateHasSession)
+	e := receiveEphemeralEvent(t, events)
+	assert.Equal(t, EphemeralEventConflict, e.Type)
+	assert.Equal(t, other.GetSessionID(), e.Owner)
+	assert.False(t, g.IsHeld())
+	assert.Equal(t, zk.ErrNodeExists, errors.Cause(g.Ensure()))
+
+	assert.NoError(t, other.Delete("/e"))
+	e = receiveEphemeralEvent(t, events)
+	assert.Equal(t, EphemeralEventCreated, e.Type)
+	assert.NotEqual(t, sessionID, e.SessionID)
+	assert.True(t, g.IsHeld())
+
+	// the released node is not created again
+	assert.NoError(t, g.Release())
+	exists, _, err := other.Exists("/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	select {
+	case e := <-events:
+		assert.Fail(t, "unexpected event", "%+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func receiveEphemeralEvent(t *testing.T, events <-chan EphemeralEvent) EphemeralEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "no ephemeral event received")
+		return EphemeralEvent{}
+	}
+}
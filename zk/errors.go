@@ -0,0 +1,67 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Errors returned by the client, possibly wrapped with context. Callers can
+// branch on them with errors.Cause, or errors.Is since they are wrapped by
+// github.com/pkg/errors.
+var (
+	// ErrNotConnected is returned by operations called before Connect
+	ErrNotConnected = errors.New("zookeeper: called connect() before any ops")
+	// ErrConnectFailed is returned by Connect when no session is established in the session timeout
+	ErrConnectFailed = errors.New("zookeeper: failed to connect")
+	// ErrDisconnected is returned by operations of a disconnected client
+	ErrDisconnected = errors.New("zookeeper: client disconnected")
+	// ErrRetryTimeout is returned when an operation is not completed in the retry timeout
+	ErrRetryTimeout = errors.New("zookeeper: retry has timed out")
+	// ErrReadOnly is returned by the mutations of a client made with WithReadOnly
+	ErrReadOnly = errors.New("zookeeper: mutation of a read-only client")
+	// ErrCircuitOpen is returned by the writes rejected by the open circuit breaker of the client
+	ErrCircuitOpen = errors.New("zookeeper: write circuit breaker is open")
+
+	// ErrSessionExpired is the ZooKeeper SESSIONEXPIRED error
+	ErrSessionExpired = zk.ErrSessionExpired
+	// ErrConnectionClosed is the error of the operations of a closed ZooKeeper connection
+	ErrConnectionClosed = zk.ErrConnectionClosed
+	// ErrBadVersion is the ZooKeeper BADVERSION error of a conditional write
+	ErrBadVersion = zk.ErrBadVersion
+	// ErrNodeExists is the ZooKeeper NODEEXISTS error
+	ErrNodeExists = zk.ErrNodeExists
+	// ErrNoNode is the ZooKeeper NONODE error
+	ErrNoNode = zk.ErrNoNode
+	// ErrNotEmpty is the ZooKeeper NOTEMPTY error deleting a node with children
+	ErrNotEmpty = zk.ErrNotEmpty
+)
+
+// IsRetryable returns whether err is caused by the loss of the connection or
+// the session, so the operation may succeed once the client reconnects
+func IsRetryable(err error) bool {
+	switch errors.Cause(err) {
+	case ErrNotConnected, ErrConnectFailed, ErrDisconnected, ErrRetryTimeout, ErrSessionExpired, ErrConnectionClosed:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestErrors(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+
+	err := client.CreateEmptyNode("/a")
+	assert.True(t, stderrors.Is(err, ErrNotConnected))
+	assert.True(t, IsRetryable(err))
+
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	err = client.CreateEmptyNode("/a")
+	assert.True(t, stderrors.Is(err, ErrNodeExists))
+	assert.False(t, IsRetryable(err))
+	_, _, err = client.Get("/b")
+	assert.True(t, stderrors.Is(errors.Wrap(err, "context"), ErrNoNode))
+	assert.Equal(t, ErrNoNode, errors.Cause(err))
+	err = client.Set("/a", nil, 10)
+	assert.True(t, stderrors.Is(err, ErrBadVersion))
+
+	assert.True(t, IsRetryable(errors.Wrap(ErrSessionExpired, "context")))
+}
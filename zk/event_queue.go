@@ -0,0 +1,214 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+)
+
+const (
+	// DefaultWatcherQueueSize is the default number of session events queued per Watcher
+	DefaultWatcherQueueSize = 64
+	// _watcherStarvation is the time an event waits in the queue of a Watcher before the
+	// Watcher is counted as starved
+	_watcherStarvation = time.Second
+)
+
+// OverflowPolicy is what the event queue of a Watcher does with a new event when it is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue, no event is lost but the dispatch of the
+	// events to the other watchers waits for the slow one
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued event to make room for the new one
+	OverflowDropOldest
+	// OverflowCoalesce drops the new events equal to a queued one, and replaces the newest
+	// queued event if full, for the watchers only acting on the latest state
+	OverflowCoalesce
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowCoalesce:
+		return "coalesce"
+	default:
+		return "unknown"
+	}
+}
+
+// WithWatcherQueue sets the size and the overflow policy of the event queues of the watchers
+// added with AddWatcher, DefaultWatcherQueueSize and OverflowBlock by default
+func WithWatcherQueue(size int, policy OverflowPolicy) ClientOption {
+	return func(c *Client) {
+		c.watcherQueueSize = size
+		c.watcherOverflow = policy
+	}
+}
+
+// AddWatcherWithQueue adds a Watcher to zk session event with its own queue size and
+// overflow policy, e.g. OverflowCoalesce for a watcher that may fall behind
+func (c *Client) AddWatcherWithQueue(w Watcher, size int, policy OverflowPolicy) {
+	q := newWatcherQueue(c, w, size, policy)
+	c.zkEventWatchersMu.Lock()
+	c.zkEventWatchers = append(c.zkEventWatchers, q)
+	c.zkEventWatchersMu.Unlock()
+}
+
+type queuedEvent struct {
+	event  zk.Event
+	queued time.Time
+}
+
+// watcherQueue delivers the session events to a Watcher in order from its own goroutine,
+// so a slow Watcher does not delay the others
+type watcherQueue struct {
+	watcher Watcher
+	size    int
+	policy  OverflowPolicy
+	logger  util.Logger
+	scope   tally.Scope
+	clock   util.Clock
+
+	mu     sync.Mutex
+	events []queuedEvent
+	// notEmptyCh and notFullCh are signaled without blocking when an event is pushed or popped
+	notEmptyCh chan struct{}
+	notFullCh  chan struct{}
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+func newWatcherQueue(c *Client, w Watcher, size int, policy OverflowPolicy) *watcherQueue {
+	if size <= 0 {
+		size = 1
+	}
+	name := fmt.Sprintf("%T", w)
+	q := &watcherQueue{
+		watcher:    w,
+		size:       size,
+		policy:     policy,
+		logger:     c.logger.With(util.Field("watcher", name)),
+		scope:      c.scope.Tagged(map[string]string{"watcher": name, "policy": policy.String()}),
+		clock:      c.clock,
+		notEmptyCh: make(chan struct{}, 1),
+		notFullCh:  make(chan struct{}, 1),
+		stopCh:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// push queues the event, applying the overflow policy if the queue is full
+func (q *watcherQueue) push(ev zk.Event) {
+	q.mu.Lock()
+	if q.policy == OverflowCoalesce {
+		for _, queued := range q.events {
+			if queued.event == ev {
+				q.mu.Unlock()
+				q.scope.Counter("watcher-events-coalesced").Inc(1)
+				return
+			}
+		}
+	}
+	for len(q.events) >= q.size {
+		switch q.policy {
+		case OverflowDropOldest:
+			q.events = q.events[1:]
+			q.scope.Counter("watcher-events-dropped").Inc(1)
+		case OverflowCoalesce:
+			q.events = q.events[:len(q.events)-1]
+			q.scope.Counter("watcher-events-coalesced").Inc(1)
+		default:
+			q.mu.Unlock()
+			q.scope.Counter("watcher-queue-full").Inc(1)
+			select {
+			case <-q.notFullCh:
+			case <-q.stopCh:
+				return
+			}
+			q.mu.Lock()
+		}
+	}
+	q.events = append(q.events, queuedEvent{event: ev, queued: q.clock.Now()})
+	q.scope.Gauge("watcher-queue-length").Update(float64(len(q.events)))
+	q.mu.Unlock()
+	signal(q.notEmptyCh)
+}
+
+func (q *watcherQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.events) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.notEmptyCh:
+				continue
+			case <-q.stopCh:
+				return
+			}
+		}
+		e := q.events[0]
+		q.events = q.events[1:]
+		q.scope.Gauge("watcher-queue-length").Update(float64(len(q.events)))
+		q.mu.Unlock()
+		signal(q.notFullCh)
+
+		latency := q.clock.Since(e.queued)
+		q.scope.Timer("watcher-queue-latency").Record(latency)
+		if latency > _watcherStarvation {
+			q.scope.Counter("watcher-starved").Inc(1)
+			q.logger.Warn("session event waited for a slow watcher", util.Field("latency", latency),
+				util.Field("state", e.event.State))
+		}
+		select {
+		case <-q.stopCh:
+			return
+		default:
+		}
+		q.watcher.Process(e.event)
+	}
+}
+
+// stop discards the queued events, it does not wait for the event being processed so a
+// Watcher can remove itself
+func (q *watcherQueue) stop() {
+	q.stopOnce.Do(func() {
+		close(q.stopCh)
+	})
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// blockedWatcher processes its events once unblocked
+type blockedWatcher struct {
+	unblockCh chan struct{}
+	events    chan zk.Event
+}
+
+func newBlockedWatcher() *blockedWatcher {
+	return &blockedWatcher{unblockCh: make(chan struct{}), events: make(chan zk.Event, 100)}
+}
+
+func (w *blockedWatcher) Process(e zk.Event) {
+	<-w.unblockCh
+	w.events <- e
+}
+
+func TestWatcherQueueSlowWatcher(t *testing.T) {
+	client := NewClient(zap.NewNop(), tally.NoopScope)
+	defer client.ClearWatchers()
+	slow, fast := newBlockedWatcher(), newChanWatcher()
+	client.AddWatcher(slow)
+	client.AddWatcher(fast)
+
+	// the fast watcher is not delayed by the slow one
+	states := []zk.State{zk.StateConnecting, zk.StateConnected, zk.StateHasSession}
+	for _, state := range states {
+		client.processSessionEvents(zk.Event{Type: zk.EventSession, State: state})
+	}
+	for _, state := range states {
+		assert.Equal(t, state, receiveEvent(t, fast.events).State)
+	}
+	close(slow.unblockCh)
+	for _, state := range states {
+		assert.Equal(t, state, receiveEvent(t, slow.events).State)
+	}
+}
+
+func TestWatcherQueueOverflowPolicies(t *testing.T) {
+	events := []zk.Event{
+		{Type: zk.EventSession, State: zk.StateDisconnected},
+		{Type: zk.EventSession, State: zk.StateConnecting},
+		{Type: zk.EventSession, State: zk.StateHasSession},
+		{Type: zk.EventSession, State: zk.StateConnecting},
+	}
+	tests := []struct {
+		policy OverflowPolicy
+		want   []zk.State
+	}{
+		// the first event is being processed when the others are queued
+		{OverflowDropOldest, []zk.State{zk.StateDisconnected, zk.StateHasSession, zk.StateConnecting}},
+		{OverflowCoalesce, []zk.State{zk.StateDisconnected, zk.StateConnecting, zk.StateHasSession}},
+	}
+	for _, test := range tests {
+		client := NewClient(zap.NewNop(), tally.NoopScope)
+		w := newBlockedWatcher()
+		client.AddWatcherWithQueue(w, 2, test.policy)
+		client.processSessionEvents(events[0])
+		waitForQueueLength(t, client.zkEventWatchers[0], 0)
+		for _, ev := range events[1:] {
+			client.processSessionEvents(ev)
+		}
+		close(w.unblockCh)
+		var got []zk.State
+		for range test.want {
+			got = append(got, receiveEvent(t, w.events).State)
+		}
+		assert.Equal(t, test.want, got, test.policy.String())
+		client.ClearWatchers()
+	}
+}
+
+func TestWatcherQueueBlock(t *testing.T) {
+	client := NewClient(zap.NewNop(), tally.NoopScope)
+	defer client.ClearWatchers()
+	w := newBlockedWatcher()
+	client.AddWatcherWithQueue(w, 1, OverflowBlock)
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for _, state := range []zk.State{zk.StateDisconnected, zk.StateConnecting, zk.StateHasSession} {
+			client.processSessionEvents(zk.Event{Type: zk.EventSession, State: state})
+		}
+	}()
+	select {
+	case <-doneCh:
+		assert.FailNow(t, "dispatch not blocked by the full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(w.unblockCh)
+	<-doneCh
+	for _, state := range []zk.State{zk.StateDisconnected, zk.StateConnecting, zk.StateHasSession} {
+		assert.Equal(t, state, receiveEvent(t, w.events).State)
+	}
+}
+
+func receiveEvent(t *testing.T, events <-chan zk.Event) zk.Event {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		assert.FailNow(t, "timed out waiting for the event")
+		return zk.Event{}
+	}
+}
+
+func waitForQueueLength(t *testing.T, q *watcherQueue, length int) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		q.mu.Lock()
+		n := len(q.events)
+		q.mu.Unlock()
+		if n == length {
+			return
+		}
+	}
+	assert.FailNow(t, "timed out waiting for the queue")
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// _maxTTL is the largest TTL accepted by ZooKeeper
+const _maxTTL = time.Duration(0xFFFFFFFFFF) * time.Millisecond
+
+var (
+	// ErrExtendedNodesNotSupported the connection can't create container and TTL nodes,
+	// e.g. the ZooKeeper client library or the server predates 3.5.3
+	ErrExtendedNodesNotSupported = errors.New("zookeeper: container and TTL nodes are not supported")
+
+	errInvalidTTL = errors.New("zookeeper: TTL nodes are persistent with a TTL between 1ms and 0xFFFFFFFFFF ms")
+)
+
+// ExtendedCreator is implemented by the connections creating the node types of ZooKeeper 3.5.3+,
+// the connections made by NewConnFactory don't as the client library lacks their opcodes
+type ExtendedCreator interface {
+	// CreateContainer creates a container node, the server deletes it once its last child is deleted
+	CreateContainer(path string, data []byte, acl []zk.ACL) (string, error)
+	// CreateTTL creates a persistent node, optionally sequential, the server deletes it once it
+	// has no children and has not been modified for the TTL
+	CreateTTL(path string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) (string, error)
+}
+
+// CreateContainer creates a container node, it returns ErrExtendedNodesNotSupported if the
+// connection can't create one. The ACL is chosen by the ACL provider of the client if acl is empty.
+// Mirrors org.apache.zookeeper.CreateMode#CONTAINER
+func (c *Client) CreateContainer(path string, data []byte, acl []zk.ACL) error {
+	acl = c.acl(path, acl)
+	return c.createExtended("createcontainer", path, data, acl, func(creator ExtendedCreator) (string, error) {
+		return creator.CreateContainer(path, data, acl)
+	}, func(secondary *Client, name string) error {
+		return secondary.CreateContainer(name, data, acl)
+	})
+}
+
+// CreateTTL creates a persistent node deleted by the server once it has no children and has not
+// been modified for the TTL, flags may only be FlagsZero or zk.FlagSequence. It returns
+// ErrExtendedNodesNotSupported if the connection can't create one, TTL nodes must also be
+// enabled on the server by zookeeper.extendedTypesEnabled. The ACL is chosen by the ACL provider
+// of the client if acl is empty. Mirrors org.apache.zookeeper.CreateMode#PERSISTENT_WITH_TTL
+func (c *Client) CreateTTL(path string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) error {
+	acl = c.acl(path, acl)
+	if err := validateTTL(flags, ttl); err != nil {
+		return errors.Wrapf(err, "zk client failed to create TTL node at %s", path)
+	}
+	return c.createExtended("createttl", path, data, acl, func(creator ExtendedCreator) (string, error) {
+		return creator.CreateTTL(path, data, flags, acl, ttl)
+	}, func(secondary *Client, name string) error {
+		// the sequential node is mirrored with the name given by the primary
+		return secondary.CreateTTL(name, data, flags&^zk.FlagSequence, acl, ttl)
+	})
+}
+
+func validateTTL(flags int32, ttl time.Duration) error {
+	if flags&zk.FlagEphemeral != 0 || ttl < time.Millisecond || ttl > _maxTTL {
+		return errInvalidTTL
+	}
+	return nil
+}
+
+// createExtended creates a node with create, the node created is mirrored in the secondary
+// ensemble of the migration with the same mode by mirror
+func (c *Client) createExtended(op string, path string, data []byte, acl []zk.ACL,
+	create func(ExtendedCreator) (string, error), mirror func(secondary *Client, name string) error) error {
+	if err := c.checkWritable(op); err != nil {
+		return errors.Wrapf(err, "zk client failed to %s at %s", op, path)
+	}
+	if err := c.checkPayload(path, data, acl); err != nil {
+		return errors.Wrapf(err, "zk client failed to %s at %s", op, path)
+	}
+	var name string
+	err := c.retryUntilConnected(c.limited(op, requestKindWrite, len(data), c.guarded(op, c.instrumented(context.Background(), op, path, func() error {
+		creator, ok := c.getConn().(ExtendedCreator)
+		if !ok {
+			return ErrExtendedNodesNotSupported
+		}
+		var err error
+		name, err = create(creator)
+		return err
+	}))))
+	c.audit(op, path, -1, nil, data, err)
+	if err == nil && c.migration != nil {
+		c.migration.mirrorCreateExtended(op, name, data, mirror)
+	}
+	return errors.Wrapf(err, "zk client failed to %s at %s", op, path)
+}
+
+// ensureContainerPath makes sure the path exists, the missing nodes are created as container
+// nodes, or persistent nodes if the connection can't create them
+func (c *Client) ensureContainerPath(ctx context.Context, p string) error {
+	exists, _, err := c.ExistsContext(ctx, p)
+	if err != nil || exists {
+		return err
+	}
+	if err := c.ensureContainerPath(ctx, path.Dir(p)); err != nil {
+		return err
+	}
+	err = c.CreateContainer(p, nil, nil)
+	if errors.Cause(err) == ErrExtendedNodesNotSupported {
+		err = c.CreateContext(ctx, p, []byte(""), FlagsZero, nil)
+	}
+	if errors.Cause(err) == zk.ErrNodeExists {
+		return nil
+	}
+	return err
+}
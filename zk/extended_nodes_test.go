@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// basicConnFactory makes connections without the container and TTL nodes
+type basicConnFactory struct {
+	ConnFactory
+}
+
+func (f basicConnFactory) NewConn() (Connection, <-chan zk.Event, error) {
+	conn, events, err := f.ConnFactory.NewConn()
+	return struct{ Connection }{conn}, events, err
+}
+
+func TestContainerAndTTLNodes(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithChroot("/root"))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	// the container node is deleted with its last child
+	assert.NoError(t, client.CreateContainer("/c", nil, ACLPermAll))
+	assert.NoError(t, client.CreateEmptyNode("/c/child"))
+	assert.NoError(t, client.Delete("/c/child"))
+	assertNodeExists(t, client, "/c", false)
+
+	// the missing parents are created as containers
+	assert.NoError(t, client.CreateEmptyNode("/kept"))
+	assert.NoError(t, client.CreateDataWithPath("/kept/a/b/leaf", []byte("leaf")))
+	assert.NoError(t, client.Delete("/kept/a/b/leaf"))
+	assertNodeExists(t, client, "/kept/a", false)
+	assertNodeExists(t, client, "/kept", true)
+
+	// the TTL node expires once it has no children and is not modified for the TTL
+	assert.NoError(t, client.CreateTTL("/ttl", nil, FlagsZero, ACLPermAll, 20*time.Millisecond))
+	assert.NoError(t, client.CreateTTL("/parent", nil, FlagsZero, ACLPermAll, 20*time.Millisecond))
+	assert.NoError(t, client.CreateEmptyNode("/parent/child"))
+	time.Sleep(30 * time.Millisecond)
+	assertNodeExists(t, client, "/ttl", false)
+	assertNodeExists(t, client, "/parent", true)
+	err := client.CreateTTL("/ttl", nil, FlagsEphemeral, ACLPermAll, time.Minute)
+	assert.Equal(t, errInvalidTTL, errors.Cause(err))
+
+	basic := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(basicConnFactory{z}),
+		WithRetryTimeout(time.Second))
+	assert.NoError(t, basic.Connect())
+	defer basic.Disconnect()
+	err = basic.CreateContainer("/c", nil, ACLPermAll)
+	assert.Equal(t, ErrExtendedNodesNotSupported, errors.Cause(err))
+	// the parents are persistent nodes instead
+	assert.NoError(t, basic.CreateDataWithPath("/p/leaf", nil))
+	assert.NoError(t, basic.Delete("/p/leaf"))
+	assertNodeExists(t, basic, "/p", true)
+}
+
+func assertNodeExists(t *testing.T, client *Client, path string, expected bool) {
+	exists, _, err := client.Exists(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, exists, path)
+}
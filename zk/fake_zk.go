@@ -22,6 +22,8 @@ package zk
 
 import (
 	"fmt"
+	"sync/atomic"
+
 	"github.com/samuel/go-zookeeper/zk"
 )
 
@@ -30,12 +32,23 @@ type connInfo struct {
 	eventCh chan zk.Event
 }
 
-// FakeZk provides utility to make fake connections and manipulate connection states
+// FakeZk provides utility to make fake connections and manipulate connection states.
+// It also emulates the ZooKeeper data tree in memory, with version checks,
+// ephemeral nodes bound to the connection sessions and one-time watches
 type FakeZk struct {
 	connToConnInfo map[Connection]*connInfo
 	opChan         chan interface{}
 
 	defaultConnectionState zk.State
+
+	// the data tree and watches are only accessed by the run goroutine
+	nodes         map[string]*fakeNode
+	watchers      map[watchKey][]*fakeWatcher
+	pendingEvents []pendingEvent
+	zxid          int64
+	lastSessionID int64
+	// hasTTLNodes is set once a TTL node is created, the expired ones are deleted before each op
+	hasTTLNodes bool
 }
 
 // FakeZkOption is the optional arg to create a FakeZk
@@ -54,6 +67,8 @@ func NewFakeZk(opts ...FakeZkOption) *FakeZk {
 		connToConnInfo:         map[Connection]*connInfo{},
 		opChan:                 make(chan interface{}, 1),
 		defaultConnectionState: zk.StateDisconnected,
+		nodes:                  newFakeNodes(),
+		watchers:               map[watchKey][]*fakeWatcher{},
 	}
 	for _, opt := range opts {
 		opt(z)
@@ -121,6 +136,10 @@ func (z *FakeZk) performOp(op interface{}) {
 		z.setConnState(op)
 	case getConnStateReq:
 		z.getConnState(op)
+	case closeConnReq:
+		z.closeConn(op)
+	case treeOpReq:
+		z.performTreeOp(op)
 	default:
 		panic(fmt.Sprintf("fake zk received unknown op %v", op))
 	}
@@ -154,14 +173,32 @@ func (z *FakeZk) setConnState(op setConnStateReq) {
 	if !ok {
 		panic(fmt.Sprintf("fake zk has no connection for op %+v", op))
 	}
+	conn := op.conn.(*FakeZkConn)
+	if op.state == zk.StateHasSession && connInfo.state == zk.StateExpired {
+		// a new session is established after the previous one expired
+		conn.setSessionID(z.newSessionID())
+	}
 	connInfo.state = op.state
 	connInfo.eventCh <- zk.Event{State: op.state, Type: op.eType}
 	if op.state == zk.StateExpired {
-		op.conn.(*FakeZkConn).invalidateWatchers(zk.ErrSessionExpired)
+		z.invalidateWatchers(conn, zk.ErrSessionExpired)
+		z.deleteEphemerals(conn.SessionID())
+		z.flushEvents()
 	}
 	op.c <- struct{}{}
 }
 
+func (z *FakeZk) closeConn(op closeConnReq) {
+	z.invalidateWatchers(op.conn, zk.ErrClosing)
+	z.deleteEphemerals(op.conn.SessionID())
+	z.flushEvents()
+	close(op.c)
+}
+
+func (z *FakeZk) newSessionID() int64 {
+	return atomic.AddInt64(&z.lastSessionID, 1)
+}
+
 type makeConnReq struct {
 	c chan makeConnResp
 }
@@ -183,3 +220,8 @@ type setConnStateReq struct {
 	conn  Connection
 	c     chan struct{}
 }
+
+type closeConnReq struct {
+	conn *FakeZkConn
+	c    chan struct{}
+}
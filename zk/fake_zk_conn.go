@@ -22,15 +22,18 @@ package zk
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/samuel/go-zookeeper/zk"
 )
 
-// FakeZkConn is a fake ZK connection for testing
+// FakeZkConn is a fake ZK connection for testing,
+// the operations are performed on the in-memory data tree of FakeZk
 type FakeZkConn struct {
-	pathWatchers
-	history *MethodCallHistory
-	zk      *FakeZk
+	history   *MethodCallHistory
+	zk        *FakeZk
+	sessionID int64
 }
 
 // NewFakeZkConn creates a FakeZkConn
@@ -40,6 +43,7 @@ func NewFakeZkConn(zk *FakeZk) *FakeZkConn {
 		history: &MethodCallHistory{
 			dict: make(map[string][]*MethodCall),
 		},
+		sessionID: zk.newSessionID(),
 	}
 }
 
@@ -52,70 +56,213 @@ func (c *FakeZkConn) AddAuth(scheme string, auth []byte) error {
 // Children returns children of a path
 func (c *FakeZkConn) Children(path string) ([]string, *zk.Stat, error) {
 	c.history.addToHistory("Children", path)
-	return nil, nil, nil
+	if err := c.checkSession(); err != nil {
+		return nil, nil, err
+	}
+	var children []string
+	var stat *zk.Stat
+	var err error
+	c.zk.doTreeOp(func() {
+		children, stat, err = c.zk.children(path)
+	})
+	return children, stat, err
 }
 
 // ChildrenW returns children and watcher channel of a path
 func (c *FakeZkConn) ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
-	eventCh := c.addWatcher()
 	c.history.addToHistory("ChildrenW", path)
-	return nil, nil, eventCh, nil
+	if err := c.checkSession(); err != nil {
+		return nil, nil, nil, err
+	}
+	var children []string
+	var stat *zk.Stat
+	var eventCh <-chan zk.Event
+	var err error
+	c.zk.doTreeOp(func() {
+		children, stat, err = c.zk.children(path)
+		if err == nil {
+			eventCh = c.zk.addWatch(c, watchKey{path, watchTypeChild})
+		}
+	})
+	return children, stat, eventCh, err
 }
 
 // Get returns node by path
 func (c *FakeZkConn) Get(path string) ([]byte, *zk.Stat, error) {
 	c.history.addToHistory("Get", path)
-	return nil, nil, nil
+	if err := c.checkSession(); err != nil {
+		return nil, nil, err
+	}
+	var data []byte
+	var stat *zk.Stat
+	var err error
+	c.zk.doTreeOp(func() {
+		data, stat, err = c.zk.get(path)
+	})
+	return data, stat, err
 }
 
 // GetW returns node and watcher channel of path
 func (c *FakeZkConn) GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
-	eventCh := c.addWatcher()
 	c.history.addToHistory("GetW", path)
-	return nil, nil, eventCh, nil
+	if err := c.checkSession(); err != nil {
+		return nil, nil, nil, err
+	}
+	var data []byte
+	var stat *zk.Stat
+	var eventCh <-chan zk.Event
+	var err error
+	c.zk.doTreeOp(func() {
+		data, stat, err = c.zk.get(path)
+		if err == nil {
+			eventCh = c.zk.addWatch(c, watchKey{path, watchTypeData})
+		}
+	})
+	return data, stat, eventCh, err
 }
 
 // Exists returns if the path exists
 func (c *FakeZkConn) Exists(path string) (bool, *zk.Stat, error) {
 	c.history.addToHistory("Exists", path)
-	return true, nil, nil
+	if err := c.checkSession(); err != nil {
+		return false, nil, err
+	}
+	var exists bool
+	var stat *zk.Stat
+	var err error
+	c.zk.doTreeOp(func() {
+		exists, stat, err = c.zk.exists(path)
+	})
+	return exists, stat, err
 }
 
 // ExistsW returns if path exists and watcher chan of path
 func (c *FakeZkConn) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
-	eventCh := c.addWatcher()
 	c.history.addToHistory("ExistsW", path)
-	return false, nil, eventCh, nil
+	if err := c.checkSession(); err != nil {
+		return false, nil, nil, err
+	}
+	var exists bool
+	var stat *zk.Stat
+	var eventCh <-chan zk.Event
+	var err error
+	c.zk.doTreeOp(func() {
+		exists, stat, err = c.zk.exists(path)
+		if err == nil {
+			eventCh = c.zk.addWatch(c, watchKey{path, watchTypeData})
+		}
+	})
+	return exists, stat, eventCh, err
 }
 
 // Set sets data for path
 func (c *FakeZkConn) Set(path string, data []byte, version int32) (*zk.Stat, error) {
 	c.history.addToHistory("Set", path, data, version)
-	return nil, nil
+	if err := c.checkSession(); err != nil {
+		return nil, err
+	}
+	var stat *zk.Stat
+	var err error
+	c.zk.doTreeOp(func() {
+		stat, err = c.zk.set(path, data, version)
+	})
+	return stat, err
 }
 
 // Create creates new ZK node
 func (c *FakeZkConn) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
 	c.history.addToHistory("Create", path, data, flags, acl)
-	return "", nil
+	if err := c.checkSession(); err != nil {
+		return "", err
+	}
+	var name string
+	var err error
+	c.zk.doTreeOp(func() {
+		name, err = c.zk.create(c, path, data, flags)
+	})
+	return name, err
+}
+
+// CreateContainer creates a container node, deleted with its last child
+func (c *FakeZkConn) CreateContainer(path string, data []byte, acl []zk.ACL) (string, error) {
+	c.history.addToHistory("CreateContainer", path, data, acl)
+	if err := c.checkSession(); err != nil {
+		return "", err
+	}
+	var name string
+	var err error
+	c.zk.doTreeOp(func() {
+		name, err = c.zk.createExtended(c, path, data, FlagsZero, 0)
+	})
+	return name, err
+}
+
+// CreateTTL creates a TTL node, deleted once it has no children and is not modified for the TTL
+func (c *FakeZkConn) CreateTTL(path string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) (string, error) {
+	c.history.addToHistory("CreateTTL", path, data, flags, acl, ttl)
+	if err := c.checkSession(); err != nil {
+		return "", err
+	}
+	if err := validateTTL(flags, ttl); err != nil {
+		return "", err
+	}
+	var name string
+	var err error
+	c.zk.doTreeOp(func() {
+		name, err = c.zk.createExtended(c, path, data, flags, ttl)
+	})
+	return name, err
 }
 
 // Delete deletes ZK node
 func (c *FakeZkConn) Delete(path string, version int32) error {
 	c.history.addToHistory("Delete", path, version)
-	return nil
+	if err := c.checkSession(); err != nil {
+		return err
+	}
+	var err error
+	c.zk.doTreeOp(func() {
+		err = c.zk.delete(path, version)
+	})
+	return err
 }
 
 // Multi executes multiple ZK operations
 func (c *FakeZkConn) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
 	c.history.addToHistory("Multi", ops)
-	return nil, nil
+	if err := c.checkSession(); err != nil {
+		return nil, err
+	}
+	var responses []zk.MultiResponse
+	var err error
+	c.zk.doTreeOp(func() {
+		responses, err = c.zk.multi(c, ops...)
+	})
+	return responses, err
+}
+
+// checkSession fails the operations of the connection after its session expired,
+// until a new session is established
+func (c *FakeZkConn) checkSession() error {
+	var expired bool
+	c.zk.doTreeOp(func() {
+		info, ok := c.zk.connToConnInfo[c]
+		expired = ok && info.state == zk.StateExpired
+	})
+	if expired {
+		return zk.ErrSessionExpired
+	}
+	return nil
 }
 
 // SessionID returns session ID
 func (c *FakeZkConn) SessionID() int64 {
 	c.history.addToHistory("SessionID")
-	return int64(0)
+	return atomic.LoadInt64(&c.sessionID)
+}
+
+func (c *FakeZkConn) setSessionID(sessionID int64) {
+	atomic.StoreInt64(&c.sessionID, sessionID)
 }
 
 // SetLogger sets loggeer for the client
@@ -129,9 +276,11 @@ func (c *FakeZkConn) State() zk.State {
 	return c.zk.GetState(c)
 }
 
-// Close closes the connection to ZK
+// Close closes the connection to ZK, the ephemeral nodes of the session are removed
 func (c *FakeZkConn) Close() {
-	c.invalidateWatchers(zk.ErrClosing)
+	closed := make(chan struct{})
+	c.zk.opChan <- closeConnReq{conn: c, c: closed}
+	<-closed
 	c.history.addToHistory("Close")
 }
 
@@ -140,30 +289,6 @@ func (c *FakeZkConn) GetHistory() *MethodCallHistory {
 	return c.history
 }
 
-type pathWatchers struct {
-	sync.RWMutex
-	watchers []chan zk.Event
-}
-
-func (p *pathWatchers) addWatcher() chan zk.Event {
-	eventCh := make(chan zk.Event)
-	p.Lock()
-	p.watchers = append(p.watchers, eventCh)
-	p.Unlock()
-	return eventCh
-}
-
-func (p *pathWatchers) invalidateWatchers(err error) {
-	ev := zk.Event{Type: zk.EventNotWatching, State: zk.StateDisconnected, Err: err}
-	p.Lock()
-	for _, watcher := range p.watchers {
-		watcher <- ev
-		close(watcher)
-	}
-	p.watchers = nil
-	p.Unlock()
-}
-
 // MethodCall represents a call record
 type MethodCall struct {
 	MethodName string
@@ -23,11 +23,12 @@ package zk
 import (
 	"testing"
 
+	"github.com/samuel/go-zookeeper/zk"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
-	_defaultPath    = "/"
+	_defaultPath    = "/test"
 	_defaultVersion = int32(0)
 )
 
@@ -35,6 +36,8 @@ func TestFakeZkConn(t *testing.T) {
 	conn := NewFakeZkConn(NewFakeZk())
 	err := conn.AddAuth(_defaultPath, nil)
 	assert.NoError(t, err)
+	_, err = conn.Create(_defaultPath, nil, FlagsZero, nil)
+	assert.NoError(t, err)
 	_, _, err = conn.Children(_defaultPath)
 	assert.NoError(t, err)
 	_, _, childrenCh, err := conn.ChildrenW(_defaultPath)
@@ -49,9 +52,7 @@ func TestFakeZkConn(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = conn.Set(_defaultPath, nil, _defaultVersion)
 	assert.NoError(t, err)
-	conn.Create(_defaultPath, nil, _defaultVersion, nil)
-	assert.NoError(t, err)
-	err = conn.Delete(_defaultPath, _defaultVersion)
+	err = conn.Delete(_defaultPath, _defaultVersion+1)
 	assert.NoError(t, err)
 	_, err = conn.Multi()
 	assert.NoError(t, err)
@@ -64,19 +65,150 @@ func TestFakeZkConn(t *testing.T) {
 	allHistory := conn.GetHistory().GetHistory()
 	assert.Equal(t, 13, len(allHistory))
 
-	// close and cleanup
-	doneCh := make(chan struct{})
+	// watches are triggered by the data change and the deletion
+	ev := <-getCh
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Type)
+	ev = <-existsCh
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Type)
+	ev = <-childrenCh
+	assert.Equal(t, zk.EventNodeDeleted, ev.Type)
+	conn.Close()
+}
+
+func TestFakeZkDataTree(t *testing.T) {
+	conn := NewFakeZkConn(NewFakeZk())
+	_, err := conn.Create("/a/b", nil, FlagsZero, nil)
+	assert.Equal(t, zk.ErrNoNode, err)
+	_, err = conn.Create("/a", []byte("a"), FlagsZero, nil)
+	assert.NoError(t, err)
+	_, err = conn.Create("/a", nil, FlagsZero, nil)
+	assert.Equal(t, zk.ErrNodeExists, err)
+	_, err = conn.Create("/a/c", nil, FlagsZero, nil)
+	assert.NoError(t, err)
+	_, err = conn.Create("/a/b", nil, FlagsZero, nil)
+	assert.NoError(t, err)
+	name, err := conn.Create("/a/seq-", nil, zk.FlagSequence, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/a/seq-0000000002", name)
+
+	children, stat, err := conn.Children("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "seq-0000000002"}, children)
+	assert.Equal(t, int32(3), stat.NumChildren)
+
+	data, stat, err := conn.Get("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), data)
+	assert.Equal(t, int32(0), stat.Version)
+	_, err = conn.Set("/a", []byte("aa"), 1)
+	assert.Equal(t, zk.ErrBadVersion, err)
+	stat, err = conn.Set("/a", []byte("aa"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), stat.Version)
+	_, err = conn.Set("/x", nil, -1)
+	assert.Equal(t, zk.ErrNoNode, err)
+
+	assert.Equal(t, zk.ErrNotEmpty, conn.Delete("/a", -1))
+	assert.Equal(t, zk.ErrBadVersion, conn.Delete("/a/b", 1))
+	assert.NoError(t, conn.Delete("/a/b", 0))
+	exists, _, err := conn.Exists("/a/b")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, _, err = conn.Get("/a/b")
+	assert.Equal(t, zk.ErrNoNode, err)
+	_, err = conn.Create("a", nil, FlagsZero, nil)
+	assert.Error(t, err)
+}
+
+func TestFakeZkMulti(t *testing.T) {
+	conn := NewFakeZkConn(NewFakeZk())
+	_, err := conn.Multi(
+		&zk.CreateRequest{Path: "/a"},
+		&zk.CreateRequest{Path: "/a/b"},
+		&zk.CheckVersionRequest{Path: "/a", Version: 1},
+	)
+	assert.Equal(t, zk.ErrBadVersion, err)
+	exists, _, err := conn.Exists("/a")
+	assert.NoError(t, err)
+	assert.False(t, exists, "failed multi should not change the tree")
+
+	_, err = conn.Multi(
+		&zk.CreateRequest{Path: "/a"},
+		&zk.CreateRequest{Path: "/a/b"},
+		&zk.SetDataRequest{Path: "/a", Data: []byte("a"), Version: 0},
+		&zk.DeleteRequest{Path: "/a/b", Version: -1},
+	)
+	assert.NoError(t, err)
+	data, _, err := conn.Get("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), data)
+}
+
+func TestFakeZkWatches(t *testing.T) {
+	conn := NewFakeZkConn(NewFakeZk())
+	exists, _, existsCh, err := conn.ExistsW("/a")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, _, rootCh, err := conn.ChildrenW("/")
+	assert.NoError(t, err)
+
+	_, err = conn.Create("/a", nil, FlagsZero, nil)
+	assert.NoError(t, err)
+	ev := <-existsCh
+	assert.Equal(t, zk.EventNodeCreated, ev.Type)
+	assert.Equal(t, "/a", ev.Path)
+	ev = <-rootCh
+	assert.Equal(t, zk.EventNodeChildrenChanged, ev.Type)
+	assert.Equal(t, "/", ev.Path)
+
+	// watches are triggered only once
+	_, err = conn.Create("/b", nil, FlagsZero, nil)
+	assert.NoError(t, err)
+	_, ok := <-rootCh
+	assert.False(t, ok)
+
+	_, _, getCh, err := conn.GetW("/a")
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Delete("/a", -1))
+	ev = <-getCh
+	assert.Equal(t, zk.EventNodeDeleted, ev.Type)
+}
+
+func TestFakeZkEphemeralNodes(t *testing.T) {
+	fakeZk := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	conn, eventCh, err := fakeZk.NewConn()
+	assert.NoError(t, err)
+	fakeConn := conn.(*FakeZkConn)
 	go func() {
-		for {
-			select {
-			case <-childrenCh:
-			case <-getCh:
-			case <-existsCh:
-			case <-doneCh:
-				break
-			}
+		// session events must be consumed for SetState to return
+		for range eventCh {
 		}
 	}()
-	conn.Close()
-	doneCh <- struct{}{}
+	other := NewFakeZkConn(fakeZk)
+
+	_, err = conn.Create("/e", nil, FlagsEphemeral, nil)
+	assert.NoError(t, err)
+	_, stat, err := conn.Get("/e")
+	assert.NoError(t, err)
+	assert.Equal(t, conn.SessionID(), stat.EphemeralOwner)
+	_, err = conn.Create("/e/child", nil, FlagsZero, nil)
+	assert.Equal(t, zk.ErrNoChildrenForEphemerals, err)
+	_, _, otherCh, err := other.ExistsW("/e")
+	assert.NoError(t, err)
+	_, _, connCh, err := conn.GetW("/e")
+	assert.NoError(t, err)
+
+	sessionID := conn.SessionID()
+	fakeZk.SetState(fakeConn, zk.StateExpired)
+	ev := <-connCh
+	assert.Equal(t, zk.EventNotWatching, ev.Type)
+	assert.Equal(t, zk.ErrSessionExpired, ev.Err)
+	ev = <-otherCh
+	assert.Equal(t, zk.EventNodeDeleted, ev.Type)
+	exists, _, err := other.Exists("/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	fakeZk.SetState(fakeConn, zk.StateHasSession)
+	assert.NotEqual(t, sessionID, conn.SessionID())
 }
@@ -0,0 +1,401 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+var errFakeZkInvalidPath = errors.New("fake zk: invalid path")
+
+// fakeNode is a znode in the in-memory data tree of FakeZk
+type fakeNode struct {
+	data     []byte
+	stat     zk.Stat
+	children map[string]struct{}
+	// container nodes are deleted with their last child, as ZooKeeper does eventually
+	container bool
+	// ttl is set for the TTL nodes, deleted once they have no children and are not modified for the TTL
+	ttl time.Duration
+}
+
+func (n *fakeNode) copy() *fakeNode {
+	children := make(map[string]struct{}, len(n.children))
+	for child := range n.children {
+		children[child] = struct{}{}
+	}
+	return &fakeNode{data: n.data, stat: n.stat, children: children, container: n.container, ttl: n.ttl}
+}
+
+type watchType int
+
+const (
+	// watchTypeData is set by GetW, or ExistsW on both existing and missing nodes
+	watchTypeData watchType = iota
+	// watchTypeChild is set by ChildrenW
+	watchTypeChild
+)
+
+type watchKey struct {
+	path  string
+	wType watchType
+}
+
+type fakeWatcher struct {
+	conn    *FakeZkConn
+	eventCh chan zk.Event
+}
+
+type pendingEvent struct {
+	key watchKey
+	ev  zk.Event
+}
+
+// treeOpReq runs fn on the FakeZk goroutine, so the data tree is never accessed concurrently
+type treeOpReq struct {
+	fn func()
+	c  chan struct{}
+}
+
+func newFakeNodes() map[string]*fakeNode {
+	return map[string]*fakeNode{
+		"/": {children: map[string]struct{}{}},
+	}
+}
+
+func (z *FakeZk) doTreeOp(fn func()) {
+	c := make(chan struct{})
+	z.opChan <- treeOpReq{fn: fn, c: c}
+	<-c
+}
+
+func (z *FakeZk) performTreeOp(op treeOpReq) {
+	if z.hasTTLNodes {
+		z.deleteExpiredTTLNodes()
+	}
+	op.fn()
+	z.flushEvents()
+	close(op.c)
+}
+
+func validatePath(p string) error {
+	if p == "/" {
+		return nil
+	}
+	if p == "" || !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") ||
+		strings.Contains(p, "//") || path.Clean(p) != p {
+		return errFakeZkInvalidPath
+	}
+	return nil
+}
+
+func (z *FakeZk) nextZxid() int64 {
+	z.zxid++
+	return z.zxid
+}
+
+func (z *FakeZk) create(conn *FakeZkConn, p string, data []byte, flags int32) (string, error) {
+	if err := validatePath(p); err != nil {
+		return "", err
+	}
+	if p == "/" {
+		return "", zk.ErrNodeExists
+	}
+	parentPath := path.Dir(p)
+	parent, ok := z.nodes[parentPath]
+	if !ok {
+		return "", zk.ErrNoNode
+	}
+	if parent.stat.EphemeralOwner != 0 {
+		return "", zk.ErrNoChildrenForEphemerals
+	}
+	if flags&zk.FlagSequence != 0 {
+		p = fmt.Sprintf("%s%010d", p, parent.stat.Cversion)
+	}
+	if _, ok := z.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+
+	zxid := z.nextZxid()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	node := &fakeNode{
+		data: data,
+		stat: zk.Stat{
+			Czxid:      zxid,
+			Mzxid:      zxid,
+			Pzxid:      zxid,
+			Ctime:      now,
+			Mtime:      now,
+			DataLength: int32(len(data)),
+		},
+		children: map[string]struct{}{},
+	}
+	if flags&zk.FlagEphemeral != 0 {
+		node.stat.EphemeralOwner = conn.SessionID()
+	}
+	z.nodes[p] = node
+
+	parent = parent.copy()
+	parent.children[path.Base(p)] = struct{}{}
+	parent.stat.Cversion++
+	parent.stat.NumChildren = int32(len(parent.children))
+	parent.stat.Pzxid = zxid
+	z.nodes[parentPath] = parent
+
+	z.addEvent(watchKey{p, watchTypeData}, zk.EventNodeCreated, p)
+	z.addEvent(watchKey{parentPath, watchTypeChild}, zk.EventNodeChildrenChanged, parentPath)
+	return p, nil
+}
+
+func (z *FakeZk) get(p string) ([]byte, *zk.Stat, error) {
+	node, ok := z.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	stat := node.stat
+	return node.data, &stat, nil
+}
+
+func (z *FakeZk) exists(p string) (bool, *zk.Stat, error) {
+	if err := validatePath(p); err != nil {
+		return false, nil, err
+	}
+	node, ok := z.nodes[p]
+	if !ok {
+		return false, nil, nil
+	}
+	stat := node.stat
+	return true, &stat, nil
+}
+
+func (z *FakeZk) children(p string) ([]string, *zk.Stat, error) {
+	node, ok := z.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	children := make([]string, 0, len(node.children))
+	for child := range node.children {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+	stat := node.stat
+	return children, &stat, nil
+}
+
+func (z *FakeZk) set(p string, data []byte, version int32) (*zk.Stat, error) {
+	node, ok := z.nodes[p]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	if version != -1 && version != node.stat.Version {
+		return nil, zk.ErrBadVersion
+	}
+	node = node.copy()
+	node.data = data
+	node.stat.Version++
+	node.stat.Mzxid = z.nextZxid()
+	node.stat.Mtime = time.Now().UnixNano() / int64(time.Millisecond)
+	node.stat.DataLength = int32(len(data))
+	z.nodes[p] = node
+
+	z.addEvent(watchKey{p, watchTypeData}, zk.EventNodeDataChanged, p)
+	stat := node.stat
+	return &stat, nil
+}
+
+func (z *FakeZk) delete(p string, version int32) error {
+	if p == "/" {
+		return errFakeZkInvalidPath
+	}
+	node, ok := z.nodes[p]
+	if !ok {
+		return zk.ErrNoNode
+	}
+	if version != -1 && version != node.stat.Version {
+		return zk.ErrBadVersion
+	}
+	if len(node.children) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(z.nodes, p)
+
+	parentPath := path.Dir(p)
+	parent := z.nodes[parentPath].copy()
+	delete(parent.children, path.Base(p))
+	parent.stat.Cversion++
+	parent.stat.NumChildren = int32(len(parent.children))
+	parent.stat.Pzxid = z.nextZxid()
+	z.nodes[parentPath] = parent
+
+	z.addEvent(watchKey{p, watchTypeData}, zk.EventNodeDeleted, p)
+	z.addEvent(watchKey{p, watchTypeChild}, zk.EventNodeDeleted, p)
+	z.addEvent(watchKey{parentPath, watchTypeChild}, zk.EventNodeChildrenChanged, parentPath)
+	if parent.container && len(parent.children) == 0 {
+		return z.delete(parentPath, -1)
+	}
+	return nil
+}
+
+// createExtended creates a container node, or a TTL node if ttl is set
+func (z *FakeZk) createExtended(
+	conn *FakeZkConn, p string, data []byte, flags int32, ttl time.Duration) (string, error) {
+	name, err := z.create(conn, p, data, flags)
+	if err != nil {
+		return "", err
+	}
+	// the node was just created, so it is not shared with a multi snapshot
+	node := z.nodes[name]
+	node.container = ttl == 0
+	node.ttl = ttl
+	if ttl > 0 {
+		z.hasTTLNodes = true
+	}
+	return name, nil
+}
+
+func (z *FakeZk) deleteExpiredTTLNodes() {
+	now := time.Now()
+	var expired []string
+	for p, node := range z.nodes {
+		mtime := time.Unix(0, node.stat.Mtime*int64(time.Millisecond))
+		if node.ttl > 0 && len(node.children) == 0 && now.Sub(mtime) >= node.ttl {
+			expired = append(expired, p)
+		}
+	}
+	for _, p := range expired {
+		z.delete(p, -1)
+	}
+}
+
+// multi applies the ops atomically, the tree is restored and no watch is triggered
+// if any of the ops fails
+func (z *FakeZk) multi(conn *FakeZkConn, ops ...interface{}) ([]zk.MultiResponse, error) {
+	snapshot := make(map[string]*fakeNode, len(z.nodes))
+	for p, node := range z.nodes {
+		snapshot[p] = node
+	}
+	zxid := z.zxid
+
+	responses := make([]zk.MultiResponse, len(ops))
+	var opErr error
+	for i, op := range ops {
+		var err error
+		switch op := op.(type) {
+		case *zk.CreateRequest:
+			responses[i].String, err = z.create(conn, op.Path, op.Data, op.Flags)
+		case *zk.SetDataRequest:
+			responses[i].Stat, err = z.set(op.Path, op.Data, op.Version)
+		case *zk.DeleteRequest:
+			err = z.delete(op.Path, op.Version)
+		case *zk.CheckVersionRequest:
+			node, ok := z.nodes[op.Path]
+			if !ok {
+				err = zk.ErrNoNode
+			} else if op.Version != -1 && op.Version != node.stat.Version {
+				err = zk.ErrBadVersion
+			}
+		default:
+			return nil, fmt.Errorf("unknown operation type %T", op)
+		}
+		responses[i].Error = err
+		if err != nil {
+			opErr = err
+			break
+		}
+	}
+	if opErr != nil {
+		z.nodes = snapshot
+		z.zxid = zxid
+		z.pendingEvents = nil
+		return responses, opErr
+	}
+	return responses, nil
+}
+
+func (z *FakeZk) addWatch(conn *FakeZkConn, key watchKey) <-chan zk.Event {
+	// buffered so that triggering watches never blocks the FakeZk goroutine
+	eventCh := make(chan zk.Event, 1)
+	z.watchers[key] = append(z.watchers[key], &fakeWatcher{conn: conn, eventCh: eventCh})
+	return eventCh
+}
+
+func (z *FakeZk) addEvent(key watchKey, eType zk.EventType, p string) {
+	z.pendingEvents = append(z.pendingEvents, pendingEvent{
+		key: key,
+		ev:  zk.Event{Type: eType, State: zk.StateHasSession, Path: p},
+	})
+}
+
+// flushEvents triggers the watches of the changes made by the last op,
+// each watch is triggered at most once like ZooKeeper
+func (z *FakeZk) flushEvents() {
+	for _, pending := range z.pendingEvents {
+		for _, watcher := range z.watchers[pending.key] {
+			watcher.eventCh <- pending.ev
+			close(watcher.eventCh)
+		}
+		delete(z.watchers, pending.key)
+	}
+	z.pendingEvents = nil
+}
+
+// invalidateWatchers removes all the watches of the connection, the watchers receive
+// EventNotWatching with the error, as the watches are lost when the session expires
+func (z *FakeZk) invalidateWatchers(conn *FakeZkConn, err error) {
+	for key, watchers := range z.watchers {
+		remaining := watchers[:0]
+		for _, watcher := range watchers {
+			if watcher.conn != conn {
+				remaining = append(remaining, watcher)
+				continue
+			}
+			watcher.eventCh <- zk.Event{
+				Type: zk.EventNotWatching, State: zk.StateDisconnected, Path: key.path, Err: err,
+			}
+			close(watcher.eventCh)
+		}
+		if len(remaining) == 0 {
+			delete(z.watchers, key)
+		} else {
+			z.watchers[key] = remaining
+		}
+	}
+}
+
+// deleteEphemerals removes the ephemeral nodes owned by the session
+func (z *FakeZk) deleteEphemerals(sessionID int64) {
+	var paths []string
+	for p, node := range z.nodes {
+		if node.stat.EphemeralOwner == sessionID {
+			paths = append(paths, p)
+		}
+	}
+	for _, p := range paths {
+		z.delete(p, -1)
+	}
+}
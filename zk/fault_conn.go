@@ -0,0 +1,372 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// FaultConnFactory wraps a ConnFactory and injects faults into the connections it makes,
+// so the state model callbacks and the reconnection logic can be tested under failures.
+// Use it with WithConnFactory:
+//
+//	factory := NewFaultConnFactory(NewConnFactory(servers, timeout), WithDroppedWatchRate(0.1))
+//	client := NewClient(logger, scope, WithConnFactory(factory))
+type FaultConnFactory struct {
+	factory ConnFactory
+
+	latency          time.Duration
+	latencyJitter    time.Duration
+	droppedWatchRate float64
+	multiFailureRate float64
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	connsMu sync.Mutex
+	conns   map[*faultConn]struct{}
+}
+
+// FaultOption configures the faults injected by FaultConnFactory
+type FaultOption func(*FaultConnFactory)
+
+// WithInjectedLatency delays every ZK operation by latency plus a random duration up to jitter
+func WithInjectedLatency(latency, jitter time.Duration) FaultOption {
+	return func(f *FaultConnFactory) {
+		f.latency = latency
+		f.latencyJitter = jitter
+	}
+}
+
+// WithDroppedWatchRate configures the probability that a watch set by GetW, ExistsW
+// or ChildrenW never fires
+func WithDroppedWatchRate(rate float64) FaultOption {
+	return func(f *FaultConnFactory) {
+		f.droppedWatchRate = rate
+	}
+}
+
+// WithMultiFailureRate configures the probability that a multi-op fails with
+// zk.ErrConnectionClosed. A failed multi-op is either not applied at all,
+// or applied with its response lost, as it happens when the connection breaks
+func WithMultiFailureRate(rate float64) FaultOption {
+	return func(f *FaultConnFactory) {
+		f.multiFailureRate = rate
+	}
+}
+
+// WithFaultSeed seeds the random source deciding which operations fail
+func WithFaultSeed(seed int64) FaultOption {
+	return func(f *FaultConnFactory) {
+		f.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewFaultConnFactory creates a FaultConnFactory making connections with factory
+func NewFaultConnFactory(factory ConnFactory, options ...FaultOption) *FaultConnFactory {
+	f := &FaultConnFactory{
+		factory: factory,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		conns:   map[*faultConn]struct{}{},
+	}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// NewConn creates a new connection with the wrapped factory and injects faults into it
+func (f *FaultConnFactory) NewConn() (Connection, <-chan zk.Event, error) {
+	conn, eventCh, err := f.factory.NewConn()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &faultConn{
+		factory: f,
+		eventCh: make(chan zk.Event, 16),
+	}
+	c.setConn(conn, eventCh)
+	f.connsMu.Lock()
+	f.conns[c] = struct{}{}
+	f.connsMu.Unlock()
+	return c, c.eventCh, nil
+}
+
+// ExpireSessions forces the sessions of all open connections to expire.
+// The underlying connections are closed, which removes their ephemeral nodes,
+// a StateExpired session event is sent, and new sessions are established.
+func (f *FaultConnFactory) ExpireSessions() error {
+	f.connsMu.Lock()
+	conns := make([]*faultConn, 0, len(f.conns))
+	for c := range f.conns {
+		conns = append(conns, c)
+	}
+	f.connsMu.Unlock()
+	for _, c := range conns {
+		if err := c.expireSession(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FaultConnFactory) removeConn(c *faultConn) {
+	f.connsMu.Lock()
+	delete(f.conns, c)
+	f.connsMu.Unlock()
+}
+
+func (f *FaultConnFactory) shouldFail(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.randMu.Lock()
+	defer f.randMu.Unlock()
+	return f.rand.Float64() < rate
+}
+
+func (f *FaultConnFactory) delay() {
+	d := f.latency
+	if f.latencyJitter > 0 {
+		f.randMu.Lock()
+		d += time.Duration(f.rand.Int63n(int64(f.latencyJitter)))
+		f.randMu.Unlock()
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// faultConn is a Connection with injected faults
+type faultConn struct {
+	factory *FaultConnFactory
+	// eventCh receives the events of the current underlying connection
+	eventCh chan zk.Event
+
+	// lifecycleMu serializes session expiry and close
+	lifecycleMu sync.Mutex
+	closed      bool
+
+	mu   sync.RWMutex
+	conn Connection
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (c *faultConn) setConn(conn Connection, eventCh <-chan zk.Event) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.conn = conn
+	c.stop = stop
+	c.done = done
+	c.mu.Unlock()
+	go c.forwardEvents(eventCh, stop, done)
+}
+
+func (c *faultConn) forwardEvents(eventCh <-chan zk.Event, stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-eventCh:
+			if !ok {
+				return
+			}
+			select {
+			case c.eventCh <- ev:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// detach stops forwarding the events of the underlying connection and closes it
+func (c *faultConn) detach() {
+	c.mu.RLock()
+	conn, stop, done := c.conn, c.stop, c.done
+	c.mu.RUnlock()
+	close(stop)
+	<-done
+	conn.Close()
+}
+
+func (c *faultConn) expireSession() error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.detach()
+	c.eventCh <- zk.Event{Type: zk.EventSession, State: zk.StateExpired, Err: zk.ErrSessionExpired}
+	conn, eventCh, err := c.factory.factory.NewConn()
+	if err != nil {
+		return err
+	}
+	c.setConn(conn, eventCh)
+	return nil
+}
+
+func (c *faultConn) current() Connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// getConn returns the underlying connection after the injected latency
+func (c *faultConn) getConn() Connection {
+	c.factory.delay()
+	return c.current()
+}
+
+func (c *faultConn) watch(eventCh <-chan zk.Event) <-chan zk.Event {
+	if c.factory.shouldFail(c.factory.droppedWatchRate) {
+		return make(chan zk.Event)
+	}
+	return eventCh
+}
+
+// AddAuth adds auth info
+func (c *faultConn) AddAuth(scheme string, auth []byte) error {
+	return c.getConn().AddAuth(scheme, auth)
+}
+
+// Children returns children of a path
+func (c *faultConn) Children(path string) ([]string, *zk.Stat, error) {
+	return c.getConn().Children(path)
+}
+
+// ChildrenW returns children and watcher channel of a path, the watch may be dropped
+func (c *faultConn) ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, eventCh, err := c.getConn().ChildrenW(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return children, stat, c.watch(eventCh), nil
+}
+
+// Get returns node by path
+func (c *faultConn) Get(path string) ([]byte, *zk.Stat, error) {
+	return c.getConn().Get(path)
+}
+
+// GetW returns node and watcher channel of path, the watch may be dropped
+func (c *faultConn) GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	data, stat, eventCh, err := c.getConn().GetW(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return data, stat, c.watch(eventCh), nil
+}
+
+// Exists returns if the path exists
+func (c *faultConn) Exists(path string) (bool, *zk.Stat, error) {
+	return c.getConn().Exists(path)
+}
+
+// ExistsW returns if path exists and watcher chan of path, the watch may be dropped
+func (c *faultConn) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	exists, stat, eventCh, err := c.getConn().ExistsW(path)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	return exists, stat, c.watch(eventCh), nil
+}
+
+// Set sets data for path
+func (c *faultConn) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+	return c.getConn().Set(path, data, version)
+}
+
+// Create creates new ZK node
+func (c *faultConn) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	return c.getConn().Create(path, data, flags, acl)
+}
+
+// CreateContainer creates a container node if the wrapped connection can
+func (c *faultConn) CreateContainer(path string, data []byte, acl []zk.ACL) (string, error) {
+	creator, ok := c.getConn().(ExtendedCreator)
+	if !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	return creator.CreateContainer(path, data, acl)
+}
+
+// CreateTTL creates a TTL node if the wrapped connection can
+func (c *faultConn) CreateTTL(path string, data []byte, flags int32, acl []zk.ACL, ttl time.Duration) (string, error) {
+	creator, ok := c.getConn().(ExtendedCreator)
+	if !ok {
+		return "", ErrExtendedNodesNotSupported
+	}
+	return creator.CreateTTL(path, data, flags, acl, ttl)
+}
+
+// Delete deletes ZK node
+func (c *faultConn) Delete(path string, version int32) error {
+	return c.getConn().Delete(path, version)
+}
+
+// Multi executes multiple ZK operations, the multi-op may fail with zk.ErrConnectionClosed
+func (c *faultConn) Multi(ops ...interface{}) ([]zk.MultiResponse, error) {
+	conn := c.getConn()
+	if !c.factory.shouldFail(c.factory.multiFailureRate) {
+		return conn.Multi(ops...)
+	}
+	if c.factory.shouldFail(0.5) {
+		// the multi-op is applied but the response is lost
+		conn.Multi(ops...)
+	}
+	return nil, zk.ErrConnectionClosed
+}
+
+// SessionID returns session ID
+func (c *faultConn) SessionID() int64 {
+	return c.current().SessionID()
+}
+
+// SetLogger sets logger for the client
+func (c *faultConn) SetLogger(l zk.Logger) {
+	c.current().SetLogger(l)
+}
+
+// State returns state of the client
+func (c *faultConn) State() zk.State {
+	return c.current().State()
+}
+
+// Close closes the underlying connection
+func (c *faultConn) Close() {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.factory.removeConn(c)
+	c.detach()
+	close(c.eventCh)
+}
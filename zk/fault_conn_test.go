@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFaultConn(t *testing.T, options ...FaultOption) (*FaultConnFactory, Connection, <-chan zk.Event) {
+	factory := NewFaultConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession)),
+		append(options, WithFaultSeed(1))...)
+	conn, eventCh, err := factory.NewConn()
+	assert.NoError(t, err)
+	return factory, conn, eventCh
+}
+
+func TestFaultConnLatency(t *testing.T) {
+	_, conn, _ := newFaultConn(t, WithInjectedLatency(20*time.Millisecond, 10*time.Millisecond))
+	start := time.Now()
+	_, _, err := conn.Exists("/")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	conn.Close()
+}
+
+func TestFaultConnDroppedWatches(t *testing.T) {
+	_, conn, _ := newFaultConn(t, WithDroppedWatchRate(1))
+	_, err := conn.Create("/a", nil, FlagsZero, nil)
+	assert.NoError(t, err)
+	_, _, eventCh, err := conn.GetW("/a")
+	assert.NoError(t, err)
+	_, err = conn.Set("/a", []byte("a"), -1)
+	assert.NoError(t, err)
+	select {
+	case ev := <-eventCh:
+		t.Fatalf("dropped watch fired: %v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.Close()
+}
+
+func TestFaultConnMultiFailure(t *testing.T) {
+	_, conn, _ := newFaultConn(t, WithMultiFailureRate(1))
+	for i := 0; i < 10; i++ {
+		_, err := conn.Multi(&zk.CreateRequest{Path: "/a"})
+		assert.Equal(t, zk.ErrConnectionClosed, err)
+	}
+	// some of the failed multi-ops are applied
+	exists, _, err := conn.Exists("/a")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	conn.Close()
+}
+
+func TestFaultConnExpireSessions(t *testing.T) {
+	factory, conn, eventCh := newFaultConn(t)
+	_, err := conn.Create("/e", nil, FlagsEphemeral, nil)
+	assert.NoError(t, err)
+	sessionID := conn.SessionID()
+
+	assert.NoError(t, factory.ExpireSessions())
+	ev := <-eventCh
+	assert.Equal(t, zk.EventSession, ev.Type)
+	assert.Equal(t, zk.StateExpired, ev.State)
+	assert.NotEqual(t, sessionID, conn.SessionID())
+	exists, _, err := conn.Exists("/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	conn.Close()
+	_, ok := <-eventCh
+	assert.False(t, ok)
+	assert.NoError(t, factory.ExpireSessions())
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/util"
+)
+
+// ServerListProvider provides the ZK servers as host:port of a dynamic ensemble,
+// e.g. the members of a headless Kubernetes service
+type ServerListProvider interface {
+	Servers() ([]string, error)
+}
+
+// ServerListProviderFunc adapts a func to ServerListProvider
+type ServerListProviderFunc func() ([]string, error)
+
+// Servers returns the ZK servers
+func (f ServerListProviderFunc) Servers() ([]string, error) {
+	return f()
+}
+
+// resolvingHostProvider implements zk.HostProvider. Unlike the default zk.DNSHostProvider
+// which resolves the servers once, it gets the server list and resolves the hostnames again
+// on each reconnect and each time all the known addresses failed
+type resolvingHostProvider struct {
+	logger     util.Logger
+	provider   ServerListProvider
+	lookupHost func(string) ([]string, error)
+
+	mu        sync.Mutex
+	addresses []string
+	curr      int
+	last      int
+	// refresh is set once connected, so the addresses are refreshed when reconnecting
+	refresh bool
+}
+
+func newResolvingHostProvider(logger util.Logger, provider ServerListProvider) *resolvingHostProvider {
+	return &resolvingHostProvider{
+		logger:     logger,
+		provider:   provider,
+		lookupHost: net.LookupHost,
+	}
+}
+
+// Init resolves the servers, the servers of the connect string are used
+// if there is no ServerListProvider
+func (p *resolvingHostProvider) Init(servers []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		static := append([]string(nil), servers...)
+		p.provider = ServerListProviderFunc(func() ([]string, error) { return static, nil })
+	}
+	return p.resolve()
+}
+
+// Len returns the number of the resolved addresses
+func (p *resolvingHostProvider) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.addresses)
+}
+
+// Next returns the next address to connect to, retryStart is true if all the addresses
+// have been tried since the last successful connection
+func (p *resolvingHostProvider) Next() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.curr = (p.curr + 1) % len(p.addresses)
+	retryStart := p.curr == p.last
+	if p.refresh || retryStart {
+		p.refresh = false
+		// the previous addresses are kept if the servers can't be resolved
+		if err := p.resolve(); err != nil {
+			p.logger.Warn("failed to resolve zk servers", util.ErrorField(err))
+		} else {
+			p.curr = 0
+		}
+	}
+	if p.last == -1 {
+		p.last = 0
+	}
+	return p.addresses[p.curr], retryStart
+}
+
+// Connected notifies the provider of a successful connection
+func (p *resolvingHostProvider) Connected() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = p.curr
+	p.refresh = true
+}
+
+// resolve gets the servers and resolves their addresses in random order, p.mu is expected to be held
+func (p *resolvingHostProvider) resolve() error {
+	servers, err := p.provider.Servers()
+	if err != nil {
+		return errors.Wrap(err, "failed to get zk servers")
+	}
+	var addresses []string
+	for _, server := range servers {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			return errors.Wrapf(err, "invalid zk server %s", server)
+		}
+		hostAddresses, err := p.lookupHost(host)
+		if err != nil {
+			p.logger.Warn("failed to resolve zk server", util.Field("server", server), util.ErrorField(err))
+			continue
+		}
+		for _, address := range hostAddresses {
+			addresses = append(addresses, net.JoinHostPort(address, port))
+		}
+	}
+	if len(addresses) == 0 {
+		return errors.Errorf("no address found for zk servers %v", servers)
+	}
+	rand.Shuffle(len(addresses), func(i, j int) {
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	})
+	p.addresses = addresses
+	p.curr = -1
+	p.last = -1
+	return nil
+}
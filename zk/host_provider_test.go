@@ -0,0 +1,87 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/util"
+)
+
+func TestResolvingHostProvider(t *testing.T) {
+	hosts := map[string][]string{
+		"zk1": {"10.0.0.1"},
+		"zk2": {"10.0.0.2", "10.0.0.3"},
+	}
+	provider := newResolvingHostProvider(util.NopLogger(), nil)
+	provider.lookupHost = func(host string) ([]string, error) {
+		if addresses, ok := hosts[host]; ok {
+			return addresses, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	assert.NoError(t, provider.Init([]string{"zk1:2181", "zk2:2181"}))
+	assert.Equal(t, 3, provider.Len())
+	var addresses []string
+	for i := 0; i < 3; i++ {
+		address, retryStart := provider.Next()
+		assert.False(t, retryStart)
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	assert.Equal(t, []string{"10.0.0.1:2181", "10.0.0.2:2181", "10.0.0.3:2181"}, addresses)
+	provider.Connected()
+
+	// the hostnames are resolved again on reconnect
+	hosts["zk1"] = []string{"10.0.0.4"}
+	delete(hosts, "zk2")
+	address, _ := provider.Next()
+	assert.Equal(t, "10.0.0.4:2181", address)
+	assert.Equal(t, 1, provider.Len())
+
+	// the previous addresses are kept if no server can be resolved
+	provider.Connected()
+	delete(hosts, "zk1")
+	address, _ = provider.Next()
+	assert.Equal(t, "10.0.0.4:2181", address)
+
+	assert.Error(t, newResolvingHostProvider(util.NopLogger(), nil).Init([]string{"zk1"}))
+}
+
+func TestResolvingHostProviderServerList(t *testing.T) {
+	servers := []string{"10.0.0.1:2181"}
+	provider := newResolvingHostProvider(util.NopLogger(), ServerListProviderFunc(func() ([]string, error) {
+		return servers, nil
+	}))
+	// the servers of the connect string are ignored
+	assert.NoError(t, provider.Init([]string{"ignored:2181"}))
+	address, _ := provider.Next()
+	assert.Equal(t, "10.0.0.1:2181", address)
+
+	// the server list is read again after all the addresses failed
+	servers = []string{"10.0.0.2:2181"}
+	address, retryStart := provider.Next()
+	assert.True(t, retryStart)
+	assert.Equal(t, "10.0.0.2:2181", address)
+}
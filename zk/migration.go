@@ -0,0 +1,344 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+)
+
+var errNoMigration = errors.New("zookeeper: client has no migration")
+
+// MigrationMismatchType is the kind of difference between the primary and the secondary ensemble
+type MigrationMismatchType string
+
+const (
+	// MigrationMismatchMissing the node of the primary is missing in the secondary
+	MigrationMismatchMissing MigrationMismatchType = "MISSING"
+	// MigrationMismatchExtra the node of the secondary is missing in the primary
+	MigrationMismatchExtra MigrationMismatchType = "EXTRA"
+	// MigrationMismatchData the data of the node differs
+	MigrationMismatchData MigrationMismatchType = "DATA"
+)
+
+// MigrationMismatch is a difference between the primary and the secondary ensemble
+type MigrationMismatch struct {
+	Type MigrationMismatchType
+	Path string
+}
+
+// MigrationOption configures a Migration
+type MigrationOption func(*Migration)
+
+// WithMigrationReadComparison also reads the secondary on each Get and Children of the client and
+// reports the differences, the reads wait for the secondary
+func WithMigrationReadComparison() MigrationOption {
+	return func(m *Migration) {
+		m.compareReads = true
+	}
+}
+
+// WithMigrationMismatchListener calls fn with the differences found by the read comparison
+func WithMigrationMismatchListener(fn func(MigrationMismatch)) MigrationOption {
+	return func(m *Migration) {
+		m.listener = fn
+	}
+}
+
+// Migration dual-writes the mutations of a client to a secondary ensemble, to move the Helix
+// metadata to another ZK cluster without downtime: the clients write to both ensembles while
+// SyncMigration copies the existing nodes, VerifyMigration checks the ensembles match and the
+// clients are then pointed to the secondary. The primary stays the source of truth, the failures
+// of the secondary are logged and counted but never fail the operation
+type Migration struct {
+	logger util.Logger
+	scope  tally.Scope
+
+	// secondary is connected and disconnected by the caller
+	secondary    *Client
+	compareReads bool
+	listener     func(MigrationMismatch)
+}
+
+// NewMigration returns a Migration to the ensemble of the connected secondary client
+func NewMigration(secondary *Client, options ...MigrationOption) *Migration {
+	m := &Migration{
+		logger:    secondary.logger.With(util.Field("migration", "secondary")),
+		scope:     secondary.scope.SubScope("migration"),
+		secondary: secondary,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// WithMigration dual-writes the creates, sets and deletes of the client to the secondary of
+// the migration
+func WithMigration(m *Migration) ClientOption {
+	return func(c *Client) {
+		c.migration = m
+	}
+}
+
+// mirrorCreate creates the node in the secondary, the node is overwritten if it exists there.
+// The sequential nodes are created with the name given by the primary
+func (m *Migration) mirrorCreate(p string, data []byte, flags int32, acl []zk.ACL) {
+	flags &^= zk.FlagSequence
+	_, err := m.secondary.EnsurePath(path.Dir(p))
+	if err == nil {
+		err = m.secondary.Create(p, data, flags, acl)
+		if errors.Cause(err) == zk.ErrNodeExists {
+			err = m.secondary.Set(p, data, -1)
+		}
+	}
+	m.mirrored("create", p, err)
+}
+
+// mirrorCreateExtended creates the container or TTL node in the secondary with create, so it keeps
+// its mode and TTL. The mirror fails if the secondary can't create the node type
+func (m *Migration) mirrorCreateExtended(
+	op string, p string, data []byte, create func(secondary *Client, name string) error) {
+	_, err := m.secondary.EnsurePath(path.Dir(p))
+	if err == nil {
+		err = create(m.secondary, p)
+		if errors.Cause(err) == zk.ErrNodeExists {
+			err = m.secondary.Set(p, data, -1)
+		}
+	}
+	m.mirrored(op, p, err)
+}
+
+// mirrorSet sets the data of the node in the secondary regardless of its version, the versions
+// of the ensembles differ. The node is created if it was not copied yet
+func (m *Migration) mirrorSet(p string, data []byte) {
+	err := m.secondary.Set(p, data, -1)
+	if errors.Cause(err) == zk.ErrNoNode {
+		err = m.secondary.CreateDataWithPath(p, data)
+	}
+	m.mirrored("set", p, err)
+}
+
+func (m *Migration) mirrorDelete(p string) {
+	err := m.secondary.Delete(p)
+	if errors.Cause(err) == zk.ErrNoNode {
+		err = nil
+	}
+	m.mirrored("delete", p, err)
+}
+
+func (m *Migration) mirrored(op string, p string, err error) {
+	if err != nil {
+		m.scope.Counter("write-failures").Inc(1)
+		m.logger.Warn("failed to mirror zk write", util.Field("op", op), util.Field("path", p), util.ErrorField(err))
+		return
+	}
+	m.scope.Counter("mirrored-writes").Inc(1)
+}
+
+// compareData reports if the data read from the primary differs in the secondary
+func (m *Migration) compareData(p string, data []byte) {
+	if !m.compareReads {
+		return
+	}
+	secondary, _, err := m.secondary.Get(p)
+	switch {
+	case errors.Cause(err) == zk.ErrNoNode:
+		m.mismatch(MigrationMismatch{Type: MigrationMismatchMissing, Path: p})
+	case err != nil:
+		m.scope.Counter("read-failures").Inc(1)
+	case !bytes.Equal(data, secondary):
+		m.mismatch(MigrationMismatch{Type: MigrationMismatchData, Path: p})
+	}
+}
+
+// compareChildren reports the children read from the primary that differ in the secondary
+func (m *Migration) compareChildren(p string, children []string) {
+	if !m.compareReads {
+		return
+	}
+	secondary, err := m.secondary.Children(p)
+	if errors.Cause(err) == zk.ErrNoNode {
+		m.mismatch(MigrationMismatch{Type: MigrationMismatchMissing, Path: p})
+		return
+	}
+	if err != nil {
+		m.scope.Counter("read-failures").Inc(1)
+		return
+	}
+	for _, mismatch := range diffChildren(p, children, secondary) {
+		m.mismatch(mismatch)
+	}
+}
+
+func (m *Migration) mismatch(mismatch MigrationMismatch) {
+	m.scope.Counter("read-mismatches").Inc(1)
+	m.logger.Warn("zk ensembles differ", util.Field("type", string(mismatch.Type)),
+		util.Field("path", mismatch.Path))
+	if m.listener != nil {
+		m.listener(mismatch)
+	}
+}
+
+// diffChildren returns the children missing in either ensemble
+func diffChildren(p string, primary []string, secondary []string) []MigrationMismatch {
+	var mismatches []MigrationMismatch
+	inSecondary := make(map[string]bool, len(secondary))
+	for _, child := range secondary {
+		inSecondary[child] = true
+	}
+	for _, child := range primary {
+		if !inSecondary[child] {
+			mismatches = append(mismatches, MigrationMismatch{Type: MigrationMismatchMissing, Path: path.Join(p, child)})
+		}
+		delete(inSecondary, child)
+	}
+	extra := make([]string, 0, len(inSecondary))
+	for child := range inSecondary {
+		extra = append(extra, child)
+	}
+	sort.Strings(extra)
+	for _, child := range extra {
+		mismatches = append(mismatches, MigrationMismatch{Type: MigrationMismatchExtra, Path: path.Join(p, child)})
+	}
+	return mismatches
+}
+
+// VerifyMigration compares the tree of root in the primary and the secondary ensemble and returns
+// the differences, none means the clients can be pointed to the secondary. The trees are read node
+// by node, so the differences written meanwhile may be reported
+func (c *Client) VerifyMigration(root string) ([]MigrationMismatch, error) {
+	if c.migration == nil {
+		return nil, errNoMigration
+	}
+	var mismatches []MigrationMismatch
+	err := c.walkMigration(root, func(mismatch MigrationMismatch, data []byte) error {
+		mismatches = append(mismatches, mismatch)
+		return nil
+	})
+	return mismatches, err
+}
+
+// SyncMigration copies the nodes of the tree of root missing or differing in the secondary
+// ensemble and deletes the ones missing in the primary, it returns the number of nodes changed.
+// The ephemeral nodes are copied as persistent nodes of the secondary
+func (c *Client) SyncMigration(root string) (int, error) {
+	if c.migration == nil {
+		return 0, errNoMigration
+	}
+	secondary := c.migration.secondary
+	synced := 0
+	err := c.walkMigration(root, func(mismatch MigrationMismatch, data []byte) error {
+		var err error
+		switch mismatch.Type {
+		case MigrationMismatchMissing:
+			err = secondary.CreateDataWithPath(mismatch.Path, data)
+		case MigrationMismatchData:
+			err = secondary.Set(mismatch.Path, data, -1)
+		case MigrationMismatchExtra:
+			err = secondary.DeleteTree(mismatch.Path)
+		}
+		if err != nil {
+			return err
+		}
+		synced++
+		return nil
+	})
+	return synced, err
+}
+
+// walkMigration calls fn with each difference of the tree of root, parents first, and the data
+// of the node in the primary
+func (c *Client) walkMigration(p string, fn func(MigrationMismatch, []byte) error) error {
+	data, _, err := c.get(context.Background(), p)
+	if err != nil {
+		return err
+	}
+	secondaryData, _, err := c.migration.secondary.Get(p)
+	switch {
+	case errors.Cause(err) == zk.ErrNoNode:
+		return c.walkMissing(p, data, fn)
+	case err != nil:
+		return err
+	case !bytes.Equal(data, secondaryData):
+		if err := fn(MigrationMismatch{Type: MigrationMismatchData, Path: p}, data); err != nil {
+			return err
+		}
+	}
+	children, err := c.children(context.Background(), p)
+	if err != nil {
+		return err
+	}
+	secondaryChildren, err := c.migration.secondary.Children(p)
+	if err != nil {
+		return err
+	}
+	// the children missing in the secondary are reported by walking them
+	for _, mismatch := range diffChildren(p, children, secondaryChildren) {
+		if mismatch.Type != MigrationMismatchExtra {
+			continue
+		}
+		if err := fn(mismatch, nil); err != nil {
+			return err
+		}
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		// the child deleted meanwhile is skipped
+		if err := c.walkMigration(path.Join(p, child), fn); err != nil && errors.Cause(err) != zk.ErrNoNode {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkMissing calls fn with the node missing in the secondary and its descendants
+func (c *Client) walkMissing(p string, data []byte, fn func(MigrationMismatch, []byte) error) error {
+	if err := fn(MigrationMismatch{Type: MigrationMismatchMissing, Path: p}, data); err != nil {
+		return err
+	}
+	children, err := c.children(context.Background(), p)
+	if err != nil {
+		return err
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		childPath := path.Join(p, child)
+		childData, _, err := c.get(context.Background(), childPath)
+		if errors.Cause(err) == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.walkMissing(childPath, childData, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestMigration(t *testing.T) {
+	secondary := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))), WithRetryTimeout(time.Second))
+	assert.NoError(t, secondary.Connect())
+	defer secondary.Disconnect()
+	var mismatches []MigrationMismatch
+	migration := NewMigration(secondary, WithMigrationReadComparison(),
+		WithMigrationMismatchListener(func(m MigrationMismatch) { mismatches = append(mismatches, m) }))
+	primaryZK := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	plain := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(primaryZK), WithRetryTimeout(time.Second))
+	assert.NoError(t, plain.Connect())
+	defer plain.Disconnect()
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(primaryZK), WithRetryTimeout(time.Second),
+		WithMigration(migration))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	// the nodes written before the migration are missing in the secondary
+	assert.NoError(t, plain.CreateDataWithPath("/c/old", []byte("old")))
+	_, _, err := client.Get("/c/old")
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationMismatch{{Type: MigrationMismatchMissing, Path: "/c/old"}}, mismatches)
+
+	// the writes are mirrored
+	assert.NoError(t, client.CreateDataWithPath("/c/new/a", []byte("a")))
+	assert.NoError(t, client.Set("/c/new/a", []byte("b"), 0))
+	assert.NoError(t, client.Create("/c/new/e", nil, FlagsEphemeral, ACLPermAll))
+	assert.NoError(t, client.Delete("/c/new/e"))
+	data, _, err := secondary.Get("/c/new/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), data)
+	exists, _, err := secondary.Exists("/c/new/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	// the set of a node not copied yet creates it
+	assert.NoError(t, client.Set("/c/old", []byte("old2"), -1))
+	data, _, err = secondary.Get("/c/old")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old2"), data)
+
+	// the ensembles are synced then verified before the cutover
+	assert.NoError(t, plain.CreateDataWithPath("/c/x/y", []byte("y")))
+	assert.NoError(t, plain.Set("/c/new/a", []byte("c"), -1))
+	assert.NoError(t, secondary.CreateDataWithPath("/c/stale/z", nil))
+	diff, err := client.VerifyMigration("/c")
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationMismatch{
+		{Type: MigrationMismatchExtra, Path: "/c/stale"},
+		{Type: MigrationMismatchData, Path: "/c/new/a"},
+		{Type: MigrationMismatchMissing, Path: "/c/x"},
+		{Type: MigrationMismatchMissing, Path: "/c/x/y"},
+	}, diff)
+	synced, err := client.SyncMigration("/c")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, synced)
+	diff, err = client.VerifyMigration("/c")
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+	mismatches = nil
+	children, err := client.Children("/c")
+	assert.NoError(t, err)
+	assert.Len(t, children, 3)
+	assert.Empty(t, mismatches)
+
+	_, err = plain.VerifyMigration("/c")
+	assert.Equal(t, errNoMigration, err)
+}
+
+func TestMigrationExtendedNodes(t *testing.T) {
+	secondaryZK := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	secondary := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(secondaryZK),
+		WithRetryTimeout(time.Second))
+	assert.NoError(t, secondary.Connect())
+	defer secondary.Disconnect()
+	client := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))), WithRetryTimeout(time.Second),
+		WithMigration(NewMigration(secondary)))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	// the container and TTL nodes keep their mode in the secondary
+	assert.NoError(t, client.CreateContainer("/c", nil, ACLPermAll))
+	assert.NoError(t, client.CreateEmptyNode("/c/child"))
+	assert.NoError(t, client.Delete("/c/child"))
+	assertNodeExists(t, secondary, "/c", false)
+	assert.NoError(t, client.CreateTTL("/ttl", nil, FlagsZero, ACLPermAll, 20*time.Millisecond))
+	assertNodeExists(t, secondary, "/ttl", true)
+	time.Sleep(30 * time.Millisecond)
+	assertNodeExists(t, secondary, "/ttl", false)
+
+	// the node is not mirrored as a persistent node if the secondary can't create its type
+	scope := tally.NewTestScope("", nil)
+	basic := NewClient(zap.NewNop(), scope, WithConnFactory(basicConnFactory{secondaryZK}),
+		WithRetryTimeout(time.Second))
+	assert.NoError(t, basic.Connect())
+	defer basic.Disconnect()
+	mirrored := NewClient(zap.NewNop(), tally.NoopScope,
+		WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))), WithRetryTimeout(time.Second),
+		WithMigration(NewMigration(basic)))
+	assert.NoError(t, mirrored.Connect())
+	defer mirrored.Disconnect()
+	assert.NoError(t, mirrored.CreateContainer("/unsupported", nil, ACLPermAll))
+	assertNodeExists(t, basic, "/unsupported", false)
+	var failures int64
+	for _, counter := range scope.Snapshot().Counters() {
+		if strings.HasSuffix(counter.Name(), "migration.write-failures") {
+			failures += counter.Value()
+		}
+	}
+	assert.Equal(t, int64(1), failures)
+}
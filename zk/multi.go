@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Multi applies the creates, sets, deletes and version checks atomically in one transaction,
+// none of them is applied if any fails. The error of the first failed op is returned, the ACL
+// of the creates is chosen by the ACL provider of the client if empty
+func (c *Client) Multi(ops ...interface{}) error {
+	if err := c.checkWritable("multi"); err != nil {
+		return errors.Wrap(err, "zk client failed to apply multi ops")
+	}
+	size := 0
+	for _, op := range ops {
+		switch op := op.(type) {
+		case *zk.CreateRequest:
+			op.Acl = c.acl(op.Path, op.Acl)
+			size += len(op.Data)
+			if err := c.checkPayload(op.Path, op.Data, op.Acl); err != nil {
+				return errors.Wrap(err, "zk client failed to apply multi ops")
+			}
+		case *zk.SetDataRequest:
+			size += len(op.Data)
+			if err := c.checkPayload(op.Path, op.Data, nil); err != nil {
+				return errors.Wrap(err, "zk client failed to apply multi ops")
+			}
+		}
+	}
+	if c.maxPayloadSize > 0 && size > c.maxPayloadSize {
+		c.scope.Counter("payload-too-large").Inc(1)
+		return errors.Wrap(&ErrPayloadTooLarge{Path: multiPath(ops), Size: size, Limit: c.maxPayloadSize},
+			"zk client failed to apply multi ops")
+	}
+
+	previous := make([][]byte, len(ops))
+	for i, op := range ops {
+		switch op := op.(type) {
+		case *zk.SetDataRequest:
+			previous[i] = c.auditPrevious(op.Path)
+		case *zk.DeleteRequest:
+			previous[i] = c.auditPrevious(op.Path)
+		}
+	}
+	var responses []zk.MultiResponse
+	err := c.retryUntilConnected(c.limited("multi", requestKindWrite, size, c.guarded("multi", c.instrumented(context.Background(), "multi", multiPath(ops), func() error {
+		var err error
+		responses, err = c.getConn().Multi(ops...)
+		if err != nil {
+			return err
+		}
+		// the transaction succeeds as a request even if one of its ops fails
+		for _, response := range responses {
+			if response.Error != nil {
+				return response.Error
+			}
+		}
+		return nil
+	}))))
+	for i, op := range ops {
+		c.auditMultiOp(op, previous[i], err)
+	}
+	if err == nil && c.migration != nil {
+		for i, op := range ops {
+			switch op := op.(type) {
+			case *zk.CreateRequest:
+				c.migration.mirrorCreate(responses[i].String, op.Data, op.Flags, op.Acl)
+			case *zk.SetDataRequest:
+				c.migration.mirrorSet(op.Path, op.Data)
+			case *zk.DeleteRequest:
+				c.migration.mirrorDelete(op.Path)
+			}
+		}
+	}
+	return errors.Wrap(err, "zk client failed to apply multi ops")
+}
+
+func (c *Client) auditMultiOp(op interface{}, previous []byte, err error) {
+	switch op := op.(type) {
+	case *zk.CreateRequest:
+		c.audit("create", op.Path, -1, nil, op.Data, err)
+	case *zk.SetDataRequest:
+		c.audit("set", op.Path, op.Version, previous, op.Data, err)
+	case *zk.DeleteRequest:
+		c.audit("delete", op.Path, op.Version, previous, nil, err)
+	}
+}
+
+// multiPath returns the path of the first op, the ops of a transaction usually share a parent
+func multiPath(ops []interface{}) string {
+	if len(ops) == 0 {
+		return ""
+	}
+	switch op := ops[0].(type) {
+	case *zk.CreateRequest:
+		return op.Path
+	case *zk.SetDataRequest:
+		return op.Path
+	case *zk.DeleteRequest:
+		return op.Path
+	case *zk.CheckVersionRequest:
+		return op.Path
+	}
+	return ""
+}
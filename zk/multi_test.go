@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestClientMulti(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithMaxPayloadSize(100))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	assert.NoError(t, client.Multi(
+		&zk.CreateRequest{Path: "/a", Data: []byte("a")},
+		&zk.CreateRequest{Path: "/a/b"},
+	))
+	assertNodeExists(t, client, "/a/b", true)
+
+	// the failed op rolls back the others
+	err := client.Multi(
+		&zk.CreateRequest{Path: "/a/c"},
+		&zk.SetDataRequest{Path: "/a", Data: []byte("b"), Version: 1},
+	)
+	assert.Equal(t, zk.ErrBadVersion, errors.Cause(err))
+	assertNodeExists(t, client, "/a/c", false)
+
+	// the transaction is limited as a whole
+	data := make([]byte, 60)
+	err = client.Multi(
+		&zk.CreateRequest{Path: "/a/c", Data: data},
+		&zk.CreateRequest{Path: "/a/d", Data: data},
+	)
+	assert.IsType(t, &ErrPayloadTooLarge{}, errors.Cause(err))
+	assertNodeExists(t, client, "/a/c", false)
+
+	readOnly := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithReadOnly())
+	assert.NoError(t, readOnly.Connect())
+	defer readOnly.Disconnect()
+	assert.Equal(t, ErrReadOnly, errors.Cause(readOnly.Multi(&zk.DeleteRequest{Path: "/a/b", Version: -1})))
+	assertNodeExists(t, client, "/a/b", true)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// DefaultMaxPayloadSize is the default jute.maxbuffer of ZooKeeper, the largest request
+	// accepted by the server
+	DefaultMaxPayloadSize = 0xfffff
+
+	// _requestOverhead is the size of the request header, the length prefixes and the flags
+	_requestOverhead = 32
+	// _aclOverhead is the size of the permissions and the length prefixes of an ACL
+	_aclOverhead = 12
+)
+
+// ErrPayloadTooLarge is returned by the creates and sets whose request exceeds the payload limit
+// of the client, the server would drop the connection instead of failing the request
+type ErrPayloadTooLarge struct {
+	Path string
+	// Size is the estimated size of the request
+	Size  int
+	Limit int
+}
+
+func (e *ErrPayloadTooLarge) Error() string {
+	return fmt.Sprintf("zookeeper: request of %d bytes at %s exceeds the limit of %d bytes",
+		e.Size, e.Path, e.Limit)
+}
+
+// WithMaxPayloadSize sets the largest request the client sends, it should match the jute.maxbuffer
+// of the servers. DefaultMaxPayloadSize by default, 0 disables the check
+func WithMaxPayloadSize(size int) ClientOption {
+	return func(c *Client) {
+		c.maxPayloadSize = size
+	}
+}
+
+// EstimateRequestSize returns the size of the create or set request of data at path, acl is nil
+// for a set
+func EstimateRequestSize(path string, data []byte, acl []zk.ACL) int {
+	size := _requestOverhead + len(path) + len(data)
+	for _, a := range acl {
+		size += _aclOverhead + len(a.Scheme) + len(a.ID)
+	}
+	return size
+}
+
+// checkPayload returns ErrPayloadTooLarge if the request exceeds the payload limit
+func (c *Client) checkPayload(path string, data []byte, acl []zk.ACL) error {
+	if c.maxPayloadSize <= 0 {
+		return nil
+	}
+	size := EstimateRequestSize(path, data, acl)
+	if size <= c.maxPayloadSize {
+		return nil
+	}
+	c.scope.Counter("payload-too-large").Inc(1)
+	return &ErrPayloadTooLarge{Path: path, Size: size, Limit: c.maxPayloadSize}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestMaxPayloadSize(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithMaxPayloadSize(100))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	data := make([]byte, 100)
+	err := client.Create("/large", data, FlagsZero, ACLPermAll)
+	tooLarge, ok := errors.Cause(err).(*ErrPayloadTooLarge)
+	assert.True(t, ok)
+	assert.Equal(t, &ErrPayloadTooLarge{Path: "/large", Size: EstimateRequestSize("/large", data, ACLPermAll), Limit: 100},
+		tooLarge)
+	assertNodeExists(t, client, "/large", false)
+
+	assert.NoError(t, client.Create("/small", nil, FlagsZero, ACLPermAll))
+	err = client.Set("/small", data, -1)
+	assert.IsType(t, &ErrPayloadTooLarge{}, errors.Cause(err))
+	assert.NoError(t, client.Set("/small", data[:10], -1))
+
+	unlimited := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithMaxPayloadSize(0))
+	assert.NoError(t, unlimited.Connect())
+	defer unlimited.Disconnect()
+	assert.NoError(t, unlimited.Create("/large", data, FlagsZero, ACLPermAll))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+	"time"
+)
+
+// requestKind is the budget of the rate limiter a ZK request is charged to
+type requestKind string
+
+const (
+	requestKindRead  requestKind = "read"
+	requestKindWrite requestKind = "write"
+
+	_kindTag = "kind"
+)
+
+// WithReadRateLimit limits the read requests of the client, i.e. exists, get and children,
+// to requestsPerSec and the data read to bytesPerSec. 0 means unlimited. The requests over
+// the limit wait for the budget, so a busy component does not overload the ZK ensemble
+func WithReadRateLimit(requestsPerSec, bytesPerSec int) ClientOption {
+	return func(c *Client) {
+		c.readLimiter = newRateLimiter(requestsPerSec, bytesPerSec)
+	}
+}
+
+// WithWriteRateLimit limits the write requests of the client, i.e. set, create and delete,
+// to requestsPerSec and the data written to bytesPerSec. 0 means unlimited
+func WithWriteRateLimit(requestsPerSec, bytesPerSec int) ClientOption {
+	return func(c *Client) {
+		c.writeLimiter = newRateLimiter(requestsPerSec, bytesPerSec)
+	}
+}
+
+// rateLimiter holds the request and byte budgets of a kind of requests
+type rateLimiter struct {
+	requests *tokenBucket
+	bytes    *tokenBucket
+}
+
+// newRateLimiter creates a rateLimiter, it returns nil which never waits if both rates are 0
+func newRateLimiter(requestsPerSec, bytesPerSec int) *rateLimiter {
+	if requestsPerSec <= 0 && bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		requests: newTokenBucket(requestsPerSec),
+		bytes:    newTokenBucket(bytesPerSec),
+	}
+}
+
+// reserve takes a request and size bytes from the budgets at now and returns how long to wait
+// before sending the request
+func (l *rateLimiter) reserve(now time.Time, size int) time.Duration {
+	if l == nil {
+		return 0
+	}
+	wait := l.requests.reserve(now, 1)
+	if bytesWait := l.bytes.reserve(now, size); bytesWait > wait {
+		wait = bytesWait
+	}
+	return wait
+}
+
+// charge takes size bytes from the byte budget once the size of a response is known,
+// the following requests wait for the budget to be paid back
+func (l *rateLimiter) charge(now time.Time, size int) {
+	if l == nil {
+		return
+	}
+	l.bytes.reserve(now, size)
+}
+
+// tokenBucket is filled at rate tokens per second up to a burst of one second. Reservations
+// may take the bucket below 0, the debt is paid back by waiting before sending the request
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full tokenBucket, it returns nil which never waits if rate is 0
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate)}
+}
+
+// reserve takes n tokens at now, the times are passed by the client so they are told by its clock
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.last = now
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limited wraps a ZK request so each attempt waits for the budget of its kind,
+// size is the number of bytes sent by the request
+func (c *Client) limited(op string, kind requestKind, size int, fn func() error) func() error {
+	limiter := c.readLimiter
+	if kind == requestKindWrite {
+		limiter = c.writeLimiter
+	}
+	if limiter == nil {
+		return fn
+	}
+	scope := c.scope.SubScope("op").Tagged(map[string]string{_opTag: op, _kindTag: string(kind)})
+	return func() error {
+		if wait := limiter.reserve(c.clock.Now(), size); wait > 0 {
+			scope.Counter("throttled").Inc(1)
+			scope.Timer("throttled-latency").Record(wait)
+			c.clock.Sleep(wait)
+		}
+		return fn()
+	}
+}
+
+// chargeRead takes the bytes of a response from the read budget
+func (c *Client) chargeRead(size int) {
+	c.readLimiter.charge(c.clock.Now(), size)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestTokenBucket(t *testing.T) {
+	assert.Nil(t, newTokenBucket(0))
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), (*tokenBucket)(nil).reserve(now, 1))
+	assert.Nil(t, newRateLimiter(0, 0))
+
+	b := newTokenBucket(10)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), b.reserve(now, 1), "the burst is not throttled")
+	}
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now, 1))
+	assert.Equal(t, 1100*time.Millisecond, b.reserve(now, 10))
+	// the bucket is filled as the time passes
+	assert.Equal(t, 600*time.Millisecond, b.reserve(now.Add(500*time.Millisecond), 0))
+}
+
+func TestClientRateLimit(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(NewFakeZk(DefaultConnectionState(zk.StateHasSession))),
+		WithRetryTimeout(5*time.Second), WithWriteRateLimit(10, 0), WithReadRateLimit(0, 1000))
+	assert.NoError(t, client.Connect())
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		assert.NoError(t, client.Create(fmt.Sprintf("/node%d", i), make([]byte, 500), FlagsZero, ACLPermAll))
+	}
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, "the writes over the burst wait")
+
+	// the bytes of the responses are charged to the read budget
+	start = time.Now()
+	for i := 0; i < 4; i++ {
+		_, _, err := client.Get("/node0")
+		assert.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, "the reads over the byte budget wait")
+
+	throttled := map[string]int64{}
+	for _, counter := range scope.Snapshot().Counters() {
+		if counter.Name() == "helix.zk.op.throttled" {
+			throttled[counter.Tags()[_kindTag]] += counter.Value()
+		}
+	}
+	assert.True(t, throttled["write"] >= 4, "throttled writes %d", throttled["write"])
+	assert.Equal(t, int64(1), throttled["read"])
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+// WithReadOnly makes the client reject the creations, the updates and the deletions with
+// ErrReadOnly without sending them, so the processes only reading the cluster, e.g. the
+// spectators, can't modify it through code paths shared with the participants
+func WithReadOnly() ClientOption {
+	return func(c *Client) {
+		c.readOnly = true
+	}
+}
+
+// IsReadOnly returns whether the client rejects the mutations
+func (c *Client) IsReadOnly() bool {
+	return c.readOnly
+}
+
+// checkWritable returns ErrReadOnly if the client is read-only
+func (c *Client) checkWritable(op string) error {
+	if !c.readOnly {
+		return nil
+	}
+	c.scope.Tagged(map[string]string{_opTag: op}).Counter("read-only-rejected").Inc(1)
+	return ErrReadOnly
+}
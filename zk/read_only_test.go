@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestReadOnly(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	writer := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, writer.Connect())
+	defer writer.Disconnect()
+	assert.NoError(t, writer.CreateDataWithPath("/a/b", []byte("data")))
+
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithReadOnly())
+	assert.True(t, client.IsReadOnly())
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	data, _, err := client.Get("/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	children, err := client.Children("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, children)
+
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.Set("/a/b", nil, -1)))
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.CreateEmptyNode("/a/c")))
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.CreateContainer("/c", nil, nil)))
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.Delete("/a/b")))
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.DeleteTree("/a")))
+	assert.Equal(t, ErrReadOnly, errors.Cause(client.UpdateWithRetry("/a/b",
+		func(data []byte, _ *zk.Stat) ([]byte, error) { return data, nil })))
+
+	// nothing was sent to the server
+	conn := client.getConn().(*FakeZkConn)
+	for _, method := range []string{"Set", "Create", "CreateContainer", "Delete"} {
+		assert.Empty(t, conn.GetHistory().GetHistoryForMethod(method), method)
+	}
+	data, _, err = writer.Get("/a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
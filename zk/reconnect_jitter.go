@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"math/rand"
+	"time"
+)
+
+const _reconnectPollInterval = 100 * time.Millisecond
+
+// WithReconnectJitter spreads the work done when a session is established again over
+// a random delay up to window: the lost watches of the WatchManager and the ephemeral
+// nodes of the EphemeralGuard are set again after the delay, so the clients reconnecting
+// at once, e.g. during a rolling restart of the ensemble, don't all hit it at the same time.
+// The work is done right away by default
+func WithReconnectJitter(window time.Duration) ClientOption {
+	return func(c *Client) {
+		c.reconnectJitter = window
+	}
+}
+
+// ReconnectDelay returns a random delay up to the reconnect jitter window to wait before
+// re-registering the watches and the ephemeral nodes of a new session, 0 if not configured
+func (c *Client) ReconnectDelay() time.Duration {
+	if c.reconnectJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(c.reconnectJitter)))
+}
+
+// waitReconnectJitter waits until the session is established, then for the reconnect delay.
+// It returns false if stopCh is closed in the meantime
+func (c *Client) waitReconnectJitter(stopCh chan struct{}) bool {
+	if c.reconnectJitter <= 0 {
+		return true
+	}
+	for !c.IsConnected() {
+		if !c.sleepUnlessClosed(stopCh, _reconnectPollInterval) {
+			return false
+		}
+	}
+	delay := c.ReconnectDelay()
+	c.scope.Timer("reconnect-jitter").Record(delay)
+	return c.sleepUnlessClosed(stopCh, delay)
+}
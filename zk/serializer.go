@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/uber-go/go-helix/model"
+)
+
+// ErrUnsupportedValue the value is not of a type the serializer supports
+var ErrUnsupportedValue = errors.New("zookeeper: value not supported by the serializer")
+
+// Serializer converts the values stored in the ZK nodes to and from bytes, Deserialize decodes
+// into value, which is a pointer like for json.Unmarshal
+// This mirrors org.apache.helix.zookeeper.zkclient.serialize.ZkSerializer
+type Serializer interface {
+	Serialize(value interface{}) ([]byte, error)
+	Deserialize(data []byte, value interface{}) error
+}
+
+// JSONSerializer serializes the values with encoding/json, it is the default serializer of the client
+type JSONSerializer struct{}
+
+// Serialize encodes the value as JSON
+func (JSONSerializer) Serialize(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// Deserialize decodes the JSON data into value
+func (JSONSerializer) Deserialize(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// ZNRecordSerializer serializes the ZNRecords in the JSON format of the Java Helix, it is used for
+// the Helix system paths whatever the serializer of the client is
+// This mirrors org.apache.helix.zookeeper.datamodel.serializer.ZNRecordSerializer
+type ZNRecordSerializer struct{}
+
+// Serialize encodes a ZNRecord or a *ZNRecord
+func (ZNRecordSerializer) Serialize(value interface{}) ([]byte, error) {
+	switch record := value.(type) {
+	case *model.ZNRecord:
+		return record.Marshal()
+	case model.ZNRecord:
+		return record.Marshal()
+	}
+	return nil, ErrUnsupportedValue
+}
+
+// Deserialize decodes the data into a *ZNRecord
+func (ZNRecordSerializer) Deserialize(data []byte, value interface{}) error {
+	record, ok := value.(*model.ZNRecord)
+	if !ok {
+		return ErrUnsupportedValue
+	}
+	decoded, err := model.NewRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+	*record = *decoded
+	return nil
+}
+
+// SerializerFuncs adapts a pair of marshal functions to a Serializer, e.g. for msgpack:
+//
+//	SerializerFuncs{Marshal: msgpack.Marshal, Unmarshal: msgpack.Unmarshal}
+//
+// or for protobuf:
+//
+//	SerializerFuncs{
+//		Marshal:   func(v interface{}) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//		Unmarshal: func(data []byte, v interface{}) error { return proto.Unmarshal(data, v.(proto.Message)) },
+//	}
+type SerializerFuncs struct {
+	Marshal   func(value interface{}) ([]byte, error)
+	Unmarshal func(data []byte, value interface{}) error
+}
+
+// Serialize encodes the value with Marshal
+func (s SerializerFuncs) Serialize(value interface{}) ([]byte, error) {
+	return s.Marshal(value)
+}
+
+// Deserialize decodes the data into value with Unmarshal
+func (s SerializerFuncs) Deserialize(data []byte, value interface{}) error {
+	return s.Unmarshal(data, value)
+}
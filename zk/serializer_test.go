@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/go-helix/model"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type testPayload struct {
+	Name    string
+	Weights map[string]int
+}
+
+var gobSerializer = SerializerFuncs{
+	Marshal: func(value interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		err := gob.NewEncoder(&buf).Encode(value)
+		return buf.Bytes(), err
+	},
+	Unmarshal: func(data []byte, value interface{}) error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+	},
+}
+
+func TestZNRecordSerializer(t *testing.T) {
+	record := model.NewRecord("resource")
+	record.SetSimpleField("REPLICAS", "3")
+	data, err := ZNRecordSerializer{}.Serialize(record)
+	assert.NoError(t, err)
+	expected, err := record.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+	data, err = ZNRecordSerializer{}.Serialize(*record)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+	_, err = ZNRecordSerializer{}.Serialize("resource")
+	assert.Equal(t, ErrUnsupportedValue, err)
+
+	decoded := &model.ZNRecord{}
+	assert.NoError(t, ZNRecordSerializer{}.Deserialize(data, decoded))
+	assert.Equal(t, "3", decoded.GetStringField("REPLICAS", ""))
+	assert.Equal(t, ErrUnsupportedValue, ZNRecordSerializer{}.Deserialize(data, &testPayload{}))
+}
+
+func TestClientSerializer(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	payload := testPayload{Name: "p1", Weights: map[string]int{"CPU": 2}}
+	for _, serializer := range []Serializer{nil, gobSerializer} {
+		options := []ClientOption{WithConnFactory(z), WithRetryTimeout(time.Second)}
+		if serializer != nil {
+			options = append(options, WithSerializer(serializer))
+		}
+		client := NewClient(zap.NewNop(), tally.NoopScope, options...)
+		assert.NoError(t, client.Connect())
+		if serializer == nil {
+			assert.Equal(t, JSONSerializer{}, client.Serializer())
+		}
+
+		assert.NoError(t, client.CreateValue("/store/p1", payload, FlagsZero))
+		var read testPayload
+		stat, err := client.GetValue("/store/p1", &read)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, read)
+		assert.NoError(t, client.SetValue("/store/p1", testPayload{Name: "p2"}, stat.Version))
+		assert.Equal(t, zk.ErrBadVersion, errors.Cause(client.SetValue("/store/p1", payload, stat.Version)))
+		read = testPayload{}
+		_, err = client.GetValue("/store/p1", &read)
+		assert.NoError(t, err)
+		assert.Equal(t, "p2", read.Name)
+
+		// the ZNRecords stay on the JSON format of the Java Helix
+		record := model.NewRecord("r1")
+		record.SetSimpleField("k", "v")
+		assert.NoError(t, client.SetRecordForPath("/store/r1", record))
+		data, _, err := client.Get("/store/r1")
+		assert.NoError(t, err)
+		expected, err := record.Marshal()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, data)
+		record, err = client.GetRecordFromPath("/store/r1")
+		assert.NoError(t, err)
+		assert.Equal(t, "v", record.GetStringField("k", ""))
+
+		assert.NoError(t, client.DeleteTree("/store"))
+		client.Disconnect()
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+)
+
+// _authenticatedLogFormat is logged by zk.Conn with the session ID and the negotiated
+// session timeout in ms once a session is established, the only place it exposes the timeout
+const _authenticatedLogFormat = "Authenticated: id=%d, timeout=%d"
+
+// sessionLogger forwards the logs of zk.Conn and reports the sessions established
+type sessionLogger struct {
+	zk.Logger
+	onSessionEstablished func(sessionID int64, negotiatedTimeout time.Duration)
+}
+
+func (l *sessionLogger) Printf(format string, args ...interface{}) {
+	if format == _authenticatedLogFormat && len(args) == 2 {
+		sessionID, idOK := args[0].(int64)
+		timeoutMs, timeoutOK := args[1].(int32)
+		if idOK && timeoutOK {
+			l.onSessionEstablished(sessionID, time.Duration(timeoutMs)*time.Millisecond)
+		}
+	}
+	l.Logger.Printf(format, args...)
+}
+
+// sessionListeners are called once the sessions are established
+type sessionListeners struct {
+	mu        sync.Mutex
+	listeners []func(sessionID string, negotiatedTimeout time.Duration)
+	// queue of the sessions to notify, delivered in order by a Go routine running while it isn't empty
+	queue   []establishedSession
+	running bool
+	// negotiatedTimeout of the last session established in ns, 0 before any session
+	negotiatedTimeout int64
+	// last session reported for the connections which don't report their sessions
+	lastSession   Connection
+	lastSessionID int64
+}
+
+type establishedSession struct {
+	sessionID         string
+	negotiatedTimeout time.Duration
+}
+
+// OnSessionEstablished calls the listener each time the client establishes a session or
+// re-establishes it on a new connection, with the session timeout negotiated with the server.
+// The server bounds the timeout by its tickTime, so it may be lower than the requested one.
+// The listeners are called in order from their own Go routine
+func (c *Client) OnSessionEstablished(listener func(sessionID string, negotiatedTimeout time.Duration)) {
+	c.sessionListeners.mu.Lock()
+	defer c.sessionListeners.mu.Unlock()
+	c.sessionListeners.listeners = append(c.sessionListeners.listeners, listener)
+}
+
+// NegotiatedSessionTimeout returns the session timeout negotiated with the server for the last
+// session established, 0 before any session. ZK pings the idle connections every third of it
+func (c *Client) NegotiatedSessionTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.sessionListeners.negotiatedTimeout))
+}
+
+// RequestedSessionTimeout returns the session timeout requested by the client
+func (c *Client) RequestedSessionTimeout() time.Duration {
+	return c.sessionTimeout
+}
+
+// reportSession reports the session of the connections which don't report the negotiated timeouts,
+// e.g. FakeZk, once per session with the requested timeout
+func (c *Client) reportSession(conn Connection) {
+	if c.reportsSessions || conn == nil || conn.State() != zk.StateHasSession {
+		return
+	}
+	sessionID := conn.SessionID()
+	l := &c.sessionListeners
+	l.mu.Lock()
+	reported := l.lastSession == conn && l.lastSessionID == sessionID
+	l.lastSession, l.lastSessionID = conn, sessionID
+	l.mu.Unlock()
+	if !reported {
+		c.sessionEstablished(sessionID, c.sessionTimeout)
+	}
+}
+
+// sessionEstablished records the negotiated timeout of the session and notifies the listeners
+func (c *Client) sessionEstablished(sessionID int64, negotiatedTimeout time.Duration) {
+	atomic.StoreInt64(&c.sessionListeners.negotiatedTimeout, int64(negotiatedTimeout))
+	c.scope.Gauge("negotiated-session-timeout-ms").Update(float64(negotiatedTimeout / time.Millisecond))
+	id := strconv.FormatInt(sessionID, 10)
+	if negotiatedTimeout != c.sessionTimeout {
+		c.logger.Warn("negotiated session timeout differs from the requested one", util.Field("sessionID", id),
+			util.Field("requested", c.sessionTimeout), util.Field("negotiated", negotiatedTimeout))
+	} else {
+		c.logger.Info("session established", util.Field("sessionID", id),
+			util.Field("negotiated", negotiatedTimeout))
+	}
+
+	c.sessionListeners.notify(establishedSession{sessionID: id, negotiatedTimeout: negotiatedTimeout})
+}
+
+// notify queues the session to the listeners, so they block neither the connection nor the client
+func (l *sessionListeners) notify(session establishedSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.listeners) == 0 {
+		return
+	}
+	l.queue = append(l.queue, session)
+	if !l.running {
+		l.running = true
+		go l.run()
+	}
+}
+
+func (l *sessionListeners) run() {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		session := l.queue[0]
+		l.queue = l.queue[1:]
+		listeners := l.listeners
+		l.mu.Unlock()
+		for _, listener := range listeners {
+			listener(session.sessionID, session.negotiatedTimeout)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+type recordingLogger []string
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestSessionLogger(t *testing.T) {
+	var forwarded recordingLogger
+	var established []string
+	logger := &sessionLogger{Logger: &forwarded, onSessionEstablished: func(sessionID int64, timeout time.Duration) {
+		established = append(established, fmt.Sprintf("%d %v", sessionID, timeout))
+	}}
+	logger.Printf("Connected to %s", "127.0.0.1:2181")
+	logger.Printf(_authenticatedLogFormat, int64(42), int32(4000))
+	assert.Equal(t, recordingLogger{"Connected to 127.0.0.1:2181", "Authenticated: id=42, timeout=4000"}, forwarded)
+	assert.Equal(t, []string{"42 4s"}, established)
+}
+
+func TestOnSessionEstablished(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(z), WithSessionTimeout(6*time.Second),
+		WithRetryTimeout(time.Second))
+	type session struct {
+		id      string
+		timeout time.Duration
+	}
+	sessions := make(chan session, 10)
+	client.OnSessionEstablished(func(sessionID string, negotiatedTimeout time.Duration) {
+		sessions <- session{sessionID, negotiatedTimeout}
+	})
+	receive := func() session {
+		select {
+		case s := <-sessions:
+			return s
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no session established")
+			return session{}
+		}
+	}
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	// the fake connections don't negotiate, the requested timeout is reported
+	assert.Equal(t, session{client.GetSessionID(), 6 * time.Second}, receive())
+	assert.Equal(t, 6*time.Second, client.NegotiatedSessionTimeout())
+	assert.Equal(t, 6*time.Second, client.RequestedSessionTimeout())
+
+	// the timeout reduced by the server is reported
+	client.sessionEstablished(42, 4*time.Second)
+	assert.Equal(t, session{"42", 4 * time.Second}, receive())
+	assert.Equal(t, 4*time.Second, client.NegotiatedSessionTimeout())
+	for _, gauge := range scope.Snapshot().Gauges() {
+		if gauge.Name() == "helix.zk.negotiated-session-timeout-ms" {
+			assert.Equal(t, float64(4000), gauge.Value())
+		}
+	}
+}
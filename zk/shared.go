@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+// Acquire takes a reference on the client shared by several managers of the process, e.g. a
+// participant, a spectator and an admin, so they use one session. The first reference connects
+// the client, each Acquire is paired with a Release
+func (c *Client) Acquire() error {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	if c.sharedRefs == 0 && !c.IsConnected() {
+		if err := c.Connect(); err != nil {
+			return err
+		}
+	}
+	c.sharedRefs++
+	return nil
+}
+
+// Release drops a reference taken by Acquire, the last one disconnects the client
+func (c *Client) Release() {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	if c.sharedRefs == 0 {
+		return
+	}
+	c.sharedRefs--
+	if c.sharedRefs == 0 {
+		c.Disconnect()
+	}
+}
+
+// References returns the number of references taken by Acquire and not released
+func (c *Client) References() int {
+	c.sharedMu.Lock()
+	defer c.sharedMu.Unlock()
+	return c.sharedRefs
+}
+
+// RemoveWatcher removes a Watcher added by AddWatcher, e.g. when a manager sharing the client
+// disconnects while the others keep the session. Its queued events are discarded
+func (c *Client) RemoveWatcher(w Watcher) {
+	c.zkEventWatchersMu.Lock()
+	defer c.zkEventWatchersMu.Unlock()
+	for i, q := range c.zkEventWatchers {
+		if q.watcher == w {
+			c.zkEventWatchers = append(c.zkEventWatchers[:i:i], c.zkEventWatchers[i+1:]...)
+			q.stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestSharedClient(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	other := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, other.Connect())
+	defer other.Disconnect()
+
+	// the first reference connects the client, the next ones share its session
+	assert.NoError(t, client.Acquire())
+	sessionID := client.GetSessionID()
+	assert.NoError(t, client.Acquire())
+	assert.Equal(t, sessionID, client.GetSessionID())
+	assert.Equal(t, 2, client.References())
+	assert.NoError(t, client.Create("/e", nil, FlagsEphemeral, ACLPermAll))
+
+	// the session is kept until the last reference is released
+	client.Release()
+	assert.Equal(t, 1, client.References())
+	exists, _, err := other.Exists("/e")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	client.Release()
+	assert.Equal(t, 0, client.References())
+	exists, _, err = other.Exists("/e")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	// the extra releases are ignored
+	client.Release()
+	assert.Equal(t, 0, client.References())
+}
+
+func TestRemoveWatcher(t *testing.T) {
+	client := NewClient(zap.NewNop(), tally.NoopScope)
+	first, second := newChanWatcher(), newChanWatcher()
+	client.AddWatcher(first)
+	client.AddWatcher(second)
+	client.RemoveWatcher(first)
+	client.processSessionEvents(zk.Event{Type: zk.EventSession, State: zk.StateHasSession})
+	assert.Equal(t, zk.StateHasSession, (<-second.events).State)
+	select {
+	case <-first.events:
+		assert.Fail(t, "removed watcher notified")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// chanWatcher sends the events it processes to its channel
+type chanWatcher struct {
+	events chan zk.Event
+}
+
+func newChanWatcher() *chanWatcher {
+	return &chanWatcher{events: make(chan zk.Event, 100)}
+}
+
+func (w *chanWatcher) Process(e zk.Event) {
+	w.events <- e
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// stateListener delivers the states to a listener in order, from a Go routine running
+// while states are queued so a slow listener blocks neither the client nor the other listeners
+type stateListener struct {
+	fn func(zk.State)
+
+	mu      sync.Mutex
+	queue   []zk.State
+	running bool
+	removed bool
+}
+
+func (l *stateListener) notify(state zk.State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.removed {
+		return
+	}
+	l.queue = append(l.queue, state)
+	if !l.running {
+		l.running = true
+		go l.run()
+	}
+}
+
+func (l *stateListener) run() {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 || l.removed {
+			l.queue = nil
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		state := l.queue[0]
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+		l.fn(state)
+	}
+}
+
+func (l *stateListener) remove() {
+	l.mu.Lock()
+	l.removed = true
+	l.mu.Unlock()
+}
+
+// AddStateListener calls listener on each transition of the session state of the client, e.g.
+// StateHasSession, StateExpired and StateDisconnected. The states are delivered in order,
+// a listener is never called concurrently with itself and a slow listener delays no one else.
+// The listeners are kept across Disconnect and Connect, the returned function removes it
+func (c *Client) AddStateListener(listener func(zk.State)) func() {
+	l := &stateListener{fn: listener}
+	c.stateMu.Lock()
+	c.stateListeners = append(c.stateListeners, l)
+	c.stateMu.Unlock()
+	return func() {
+		l.remove()
+		c.stateMu.Lock()
+		defer c.stateMu.Unlock()
+		for i, other := range c.stateListeners {
+			if other == l {
+				c.stateListeners = append(c.stateListeners[:i:i], c.stateListeners[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// notifyStateListeners queues the state to the listeners if it differs from the previous one
+func (c *Client) notifyStateListeners(state zk.State) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if state == c.lastState {
+		return
+	}
+	c.lastState = state
+	for _, l := range c.stateListeners {
+		l.notify(state)
+	}
+}
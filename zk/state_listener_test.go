@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestStateListener(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	states := make(chan zk.State, 10)
+	client.AddStateListener(func(state zk.State) { states <- state })
+	// a blocked listener delays no one else
+	unblock := make(chan struct{})
+	blocked := make(chan zk.State, 10)
+	removeBlocked := client.AddStateListener(func(state zk.State) {
+		<-unblock
+		blocked <- state
+	})
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	conn := client.getConn().(*FakeZkConn)
+	z.SetState(conn, zk.StateExpired)
+	// repeated states are not transitions
+	z.SetState(conn, zk.StateExpired)
+	z.SetState(conn, zk.StateHasSession)
+	assert.Equal(t, zk.StateExpired, receiveState(t, states))
+	assert.Equal(t, zk.StateHasSession, receiveState(t, states))
+
+	// the states queued for the blocked listener are delivered in order
+	close(unblock)
+	assert.Equal(t, zk.StateExpired, receiveState(t, blocked))
+	assert.Equal(t, zk.StateHasSession, receiveState(t, blocked))
+
+	removeBlocked()
+	z.SetState(conn, zk.StateDisconnected)
+	assert.Equal(t, zk.StateDisconnected, receiveState(t, states))
+	select {
+	case state := <-blocked:
+		assert.Fail(t, "removed listener called", "%v", state)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func receiveState(t *testing.T, states <-chan zk.State) zk.State {
+	select {
+	case state := <-states:
+		return state
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "no state received")
+		return zk.StateUnknown
+	}
+}
@@ -21,43 +21,88 @@
 package zk
 
 import (
-	"bufio"
-	"errors"
-	"log"
-	"os"
-	"os/exec"
-	"path"
+	"net"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/samuel/go-zookeeper/zk"
 	"github.com/stretchr/testify/suite"
+	"github.com/uber-go/go-helix/zk/testutil"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
 
 // EmbeddedZkServer is the connect string for embedded ZK server
+//
+// Deprecated: the suites connect to the test server of TestServer on a free port, use
+// BaseZkTestSuite.ZkConnectString or testutil.Server.ConnectString
 const EmbeddedZkServer = "localhost:2181"
 
-var mu = sync.Mutex{}
+const _embeddedZkPort = 2181
+
+var (
+	serverOnce sync.Once
+	server     *testutil.Server
+	serverErr  error
+
+	embeddedMu     sync.Mutex
+	embeddedServer *testutil.Server
+)
 
-// BaseZkTestSuite provides utility to test Zookeeper functions without Helix admin
+// TestServer returns the ZooKeeper server shared by the test suites of the test binary,
+// it is started on first use by testutil.StartServer
+func TestServer() (*testutil.Server, error) {
+	return testServer()
+}
+
+// testServer starts the shared server with the options of the first caller
+func testServer(options ...testutil.ServerOption) (*testutil.Server, error) {
+	serverOnce.Do(func() {
+		server, serverErr = testutil.StartServer(options...)
+	})
+	return server, serverErr
+}
+
+// BaseZkTestSuite provides utility to test Zookeeper functions without Helix admin. Each suite
+// runs in its own chroot of the shared test server. The suite fails if the server can't be
+// launched, unless testutil.SkipEnvVar is set and the ZooKeeper jar or java is missing
 type BaseZkTestSuite struct {
 	suite.Suite
 
-	EmbeddedZkPath  string
+	// EmbeddedZkPath is the directory of the ZooKeeper jar used to start the shared test server
+	//
+	// Deprecated: the jar is located by testutil, set testutil.JarEnvVar to override it
+	EmbeddedZkPath string
+	// ZkConnectString is the connect string of the server with the chroot of the suite
 	ZkConnectString string
+	Server          *testutil.Server
+	chroot          string
 }
 
-// SetupSuite ensures ZK server is up
+// SetupSuite starts the test server if needed and creates the chroot of the suite
 func (s *BaseZkTestSuite) SetupSuite() {
-	s.ZkConnectString = EmbeddedZkServer
+	var options []testutil.ServerOption
+	if s.EmbeddedZkPath != "" {
+		jarPath := filepath.Join(s.EmbeddedZkPath, testutil.DefaultJarName)
+		options = append(options, testutil.WithJarPath(jarPath))
+	}
+	server, err := testServer(options...)
+	if testutil.Skippable(err) {
+		s.T().Skip(err.Error())
+	}
+	s.Require().NoError(err)
+	s.Server = server
+	s.chroot, err = server.NewChroot(strings.Replace(s.T().Name(), "/", "_", -1))
+	s.Require().NoError(err)
+	s.ZkConnectString = server.ConnectString() + s.chroot
+}
 
-	if s.EmbeddedZkPath == "" {
-		s.EmbeddedZkPath = path.Join(os.Getenv("APP_ROOT"), "zk/embedded")
+// TearDownSuite deletes the chroot of the suite
+func (s *BaseZkTestSuite) TearDownSuite() {
+	if s.chroot != "" {
+		s.NoError(s.Server.DeleteChroot(s.chroot))
 	}
-	err := EnsureZookeeperUp(s.EmbeddedZkPath)
-	s.NoError(err)
 }
 
 // CreateAndConnectClient creates ZK client and connects to ZK server
@@ -69,107 +114,41 @@ func (s *BaseZkTestSuite) CreateAndConnectClient() *Client {
 	return zkClient
 }
 
-// EnsureZookeeperUp starts the embedded (test) Zookeeper if not running.
+// EnsureZookeeperUp starts the embedded (test) Zookeeper at EmbeddedZkServer if not running,
+// with the jar in scriptRelativeDirPath
+//
+// Deprecated: use TestServer or testutil.StartServer
 func EnsureZookeeperUp(scriptRelativeDirPath string) error {
-	mu.Lock()
-	defer mu.Unlock()
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
 
-	if isEmbeddedZookeeperStarted(3 * time.Second) {
+	if embeddedServer != nil {
 		return nil
 	}
-
-	err := startEmbeddedZookeeper(scriptRelativeDirPath)
-	if err != nil {
-		log.Println("Unable to start Zookeeper server: ", err)
-		return err
-	}
-
-	log.Println("Zookeeper server is up.")
-
-	return nil
-}
-
-// StopZookeeper stops the embedded (test) Zookeeper if running.
-func StopZookeeper(scriptRelativeDirPath string) error {
-	mu.Lock()
-	defer mu.Unlock()
-
-	_, _, err := zk.Connect([]string{EmbeddedZkServer}, time.Second)
-	if err != nil {
+	if conn, err := net.DialTimeout("tcp", EmbeddedZkServer, time.Second); err == nil {
+		// started outside of this process
+		conn.Close()
 		return nil
 	}
-
-	err = stopEmbeddedZookeeper(scriptRelativeDirPath)
-	if err != nil {
-		log.Println("Unable to stop Zookeeper server: ", err)
-		return err
-	}
-	log.Println("Zookeeper server is stopped.")
-	return nil
-}
-
-func isEmbeddedZookeeperStarted(timeout time.Duration) bool {
-	zkConn, _, err := zk.Connect([]string{EmbeddedZkServer}, time.Second)
-	if err == nil && zkConn != nil {
-		defer zkConn.Close()
-		done := time.After(timeout)
-	loop:
-		for { // zk.Connect is async
-			if zkConn.State() == zk.StateHasSession {
-				return true
-			}
-			select {
-			case <-done:
-				break loop
-			default:
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-
-	log.Printf("Unable to connect Zookeeper %s: %v\n", EmbeddedZkServer, err)
-	return false
-}
-
-func startEmbeddedZookeeper(scriptRelativeDirPath string) error {
-	err := runCmd(scriptRelativeDirPath, "start.sh")
+	server, err := testutil.StartServer(testutil.WithPort(_embeddedZkPort),
+		testutil.WithJarPath(filepath.Join(scriptRelativeDirPath, testutil.DefaultJarName)))
 	if err != nil {
 		return err
-	} else if !isEmbeddedZookeeperStarted(5 * time.Second) {
-		return errors.New("embedded zk is not started")
 	}
+	embeddedServer = server
 	return nil
 }
 
-func stopEmbeddedZookeeper(scriptRelativeDirPath string) error {
-	return runCmd(scriptRelativeDirPath, "stop.sh")
-}
-
-func runCmd(scriptRelativeDirPath, scriptFileName string) error {
-	cmd := exec.Cmd{
-		Path: "/bin/bash",
-		Args: []string{"/bin/bash", scriptFileName},
-		Dir:  scriptRelativeDirPath,
-	}
-
-	cmdReader, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Println("Error creating StdoutPipe: ", err)
-		return err
-	}
+// StopZookeeper stops the embedded (test) Zookeeper started by EnsureZookeeperUp
+//
+// Deprecated: use testutil.Server.Close
+func StopZookeeper(scriptRelativeDirPath string) error {
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
 
-	err = cmd.Start()
-	if err != nil {
-		return err
+	if embeddedServer != nil {
+		embeddedServer.Close()
+		embeddedServer = nil
 	}
-
-	in := bufio.NewScanner(cmdReader)
-	go func() {
-		for in.Scan() {
-			log.Println(in.Text())
-		}
-	}()
-
-	time.Sleep(5 * time.Second) // wait some time as cmd.Start doesn't wait
 	return nil
 }
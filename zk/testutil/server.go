@@ -0,0 +1,316 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package testutil launches standalone ZooKeeper servers for integration tests,
+// so tests don't need a locally running ZooKeeper
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// JarEnvVar is the environment variable to locate the ZooKeeper fat jar
+	JarEnvVar = "ZOOKEEPER_JAR"
+	// SkipEnvVar is the environment variable opting out of the tests needing the server,
+	// they are skipped instead of failing when the jar or java is missing
+	SkipEnvVar = "HELIX_SKIP_ZK_TESTS"
+	// DefaultJarName is the file name of the ZooKeeper fat jar in zk/embedded
+	DefaultJarName = "zookeeper-3.4.9-fatjar.jar"
+
+	_defaultStartTimeout = 30 * time.Second
+	_tickTime            = 200
+)
+
+var (
+	// ErrJarNotFound means the ZooKeeper fat jar cannot be located
+	ErrJarNotFound = errors.New("zookeeper test server: jar not found")
+	// ErrJavaNotFound means java is not available to launch the server
+	ErrJavaNotFound = errors.New("zookeeper test server: java not found")
+)
+
+// Server is a standalone ZooKeeper server running in a child process
+type Server struct {
+	port         int
+	dataDir      string
+	jarPath      string
+	startTimeout time.Duration
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// ServerOption provides options for the test server
+type ServerOption func(*Server)
+
+// WithJarPath configures the path of the ZooKeeper fat jar
+func WithJarPath(jarPath string) ServerOption {
+	return func(s *Server) {
+		s.jarPath = jarPath
+	}
+}
+
+// WithPort configures the client port, a free port is allocated by default
+func WithPort(port int) ServerOption {
+	return func(s *Server) {
+		s.port = port
+	}
+}
+
+// WithStartTimeout configures how long to wait for the server to accept sessions
+func WithStartTimeout(t time.Duration) ServerOption {
+	return func(s *Server) {
+		s.startTimeout = t
+	}
+}
+
+// StartServer launches a new ZooKeeper server with its own data directory and port,
+// callers are expected to Stop the server when done
+func StartServer(options ...ServerOption) (*Server, error) {
+	s := &Server{
+		startTimeout: _defaultStartTimeout,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.jarPath == "" {
+		jarPath, err := findJar()
+		if err != nil {
+			return nil, err
+		}
+		s.jarPath = jarPath
+	}
+	if s.port == 0 {
+		port, err := FreePort()
+		if err != nil {
+			return nil, err
+		}
+		s.port = port
+	}
+	dataDir, err := ioutil.TempDir("", "zookeeper-test-server")
+	if err != nil {
+		return nil, errors.Wrap(err, "zookeeper test server: failed to create data dir")
+	}
+	s.dataDir = dataDir
+	if err := s.Start(); err != nil {
+		os.RemoveAll(dataDir)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start launches the server process, it can be used to restart a stopped server
+// with the same port and data
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd != nil {
+		return nil
+	}
+	java, err := exec.LookPath("java")
+	if err != nil {
+		return ErrJavaNotFound
+	}
+	cfgPath := filepath.Join(s.dataDir, "zk.cfg")
+	cfg := fmt.Sprintf("tickTime=%d\ndataDir=%s\nclientPort=%d\nmaxClientCnxns=0\n",
+		_tickTime, s.dataDir, s.port)
+	if err := ioutil.WriteFile(cfgPath, []byte(cfg), 0644); err != nil {
+		return errors.Wrap(err, "zookeeper test server: failed to write config")
+	}
+	logFile, err := os.Create(filepath.Join(s.dataDir, "zookeeper.log"))
+	if err != nil {
+		return errors.Wrap(err, "zookeeper test server: failed to create log file")
+	}
+	cmd := exec.Command(java, "-Dname=embedded-zookeeper", "-jar", s.jarPath, "server", cfgPath)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return errors.Wrap(err, "zookeeper test server: failed to start")
+	}
+	s.cmd = cmd
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+	}()
+	if !s.waitUntilServing(s.startTimeout) {
+		s.stopLocked()
+		return errors.Errorf("zookeeper test server: not serving at %s after %v",
+			s.ConnectString(), s.startTimeout)
+	}
+	return nil
+}
+
+// Stop kills the server process, the data is kept so the server can be restarted
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+// Close stops the server and removes its data
+func (s *Server) Close() {
+	s.Stop()
+	os.RemoveAll(s.dataDir)
+}
+
+// Port returns the client port of the server
+func (s *Server) Port() int {
+	return s.port
+}
+
+// ConnectString returns the connect string of the server
+func (s *Server) ConnectString() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(s.port))
+}
+
+// NewChroot creates an isolated root node for a test suite and returns its path,
+// use DeleteChroot to clean it up
+func (s *Server) NewChroot(prefix string) (string, error) {
+	chroot := fmt.Sprintf("/%s_%d", strings.Trim(prefix, "/"), rand.Int63())
+	conn, err := s.connect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_, err = conn.Create(chroot, nil, 0, zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return "", errors.Wrapf(err, "zookeeper test server: failed to create chroot %s", chroot)
+	}
+	return chroot, nil
+}
+
+// DeleteChroot removes the chroot and all its children
+func (s *Server) DeleteChroot(chroot string) error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return deleteTree(conn, chroot)
+}
+
+func (s *Server) stopLocked() {
+	if s.cmd == nil {
+		return
+	}
+	s.cmd.Process.Kill()
+	s.cmd = nil
+}
+
+func (s *Server) connect() (*zk.Conn, error) {
+	conn, _, err := zk.Connect([]string{s.ConnectString()}, time.Second, zk.WithLogger(nopLogger{}))
+	if err != nil {
+		return nil, errors.Wrap(err, "zookeeper test server: failed to connect")
+	}
+	return conn, nil
+}
+
+func (s *Server) waitUntilServing(timeout time.Duration) bool {
+	conn, err := s.connect()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if conn.State() == zk.StateHasSession {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func deleteTree(conn *zk.Conn, path string) error {
+	children, _, err := conn.Children(path)
+	if err == zk.ErrNoNode {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := deleteTree(conn, path+"/"+child); err != nil {
+			return err
+		}
+	}
+	err = conn.Delete(path, -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// FreePort asks the kernel for a free TCP port
+func FreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errors.Wrap(err, "zookeeper test server: failed to allocate port")
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Skippable returns true if err means the server can't be launched in this environment and the
+// tests needing it are opted out by SkipEnvVar
+func Skippable(err error) bool {
+	return (err == ErrJarNotFound || err == ErrJavaNotFound) && os.Getenv(SkipEnvVar) != ""
+}
+
+// findJar locates the ZooKeeper fat jar from the environment variable,
+// or the zk/embedded directory of this repository
+func findJar() (string, error) {
+	if jarPath := os.Getenv(JarEnvVar); jarPath != "" {
+		return jarPath, nil
+	}
+	candidates := []string{filepath.Join(os.Getenv("APP_ROOT"), "zk/embedded", DefaultJarName)}
+	if wd, err := os.Getwd(); err == nil {
+		// walk up from the working directory, tests run in the package directory
+		for dir := wd; ; dir = filepath.Dir(dir) {
+			candidates = append(candidates, filepath.Join(dir, "zk/embedded", DefaultJarName))
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", ErrJarNotFound
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
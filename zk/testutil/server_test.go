@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package testutil
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreePort(t *testing.T) {
+	port, err := FreePort()
+	assert.NoError(t, err)
+	assert.True(t, port > 0)
+}
+
+func TestStartServerWithoutJar(t *testing.T) {
+	_, err := StartServer(WithJarPath("/nonexistent/zookeeper.jar"), WithStartTimeout(time.Second))
+	assert.Error(t, err)
+}
+
+func TestSkippable(t *testing.T) {
+	defer os.Setenv(SkipEnvVar, os.Getenv(SkipEnvVar))
+	os.Setenv(SkipEnvVar, "")
+	assert.False(t, Skippable(ErrJavaNotFound))
+	os.Setenv(SkipEnvVar, "1")
+	assert.True(t, Skippable(ErrJavaNotFound))
+	assert.True(t, Skippable(ErrJarNotFound))
+	assert.False(t, Skippable(assert.AnError))
+	assert.False(t, Skippable(nil))
+}
+
+func TestServerLifecycle(t *testing.T) {
+	server, err := StartServer()
+	if Skippable(err) {
+		t.Skip(err.Error())
+	}
+	require.NoError(t, err)
+	defer server.Close()
+
+	chroot, err := server.NewChroot("test")
+	require.NoError(t, err)
+	conn, _, err := zk.Connect([]string{server.ConnectString()}, time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Create(chroot+"/child", nil, 0, zk.WorldACL(zk.PermAll))
+	assert.NoError(t, err)
+
+	assert.NoError(t, server.DeleteChroot(chroot))
+	exists, _, err := conn.Exists(chroot)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// restart keeps the port
+	server.Stop()
+	assert.NoError(t, server.Start())
+}
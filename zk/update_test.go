@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestUpdateWithRetry(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(5*time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	increment := func(data []byte, stat *zk.Stat) ([]byte, error) {
+		if stat == nil {
+			return []byte("1"), nil
+		}
+		n, err := strconv.Atoi(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+
+	// the missing node is created
+	assert.NoError(t, client.UpdateWithRetry("/counter", increment))
+	data, _, err := client.Get("/counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(data))
+
+	// the concurrent updates conflict and are retried
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.UpdateWithRetry("/counter", increment))
+		}()
+	}
+	wg.Wait()
+	data, _, err = client.Get("/counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "11", string(data))
+
+	// an error of the update aborts it
+	errAbort := errors.New("abort")
+	err = client.UpdateWithRetry("/counter", func([]byte, *zk.Stat) ([]byte, error) { return nil, errAbort })
+	assert.Equal(t, errAbort, err)
+	data, _, err = client.Get("/counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "11", string(data))
+}
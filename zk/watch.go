@@ -0,0 +1,120 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// _watchBufferSize is the number of events buffered by a Watch before the events of its path wait
+const _watchBufferSize = 16
+
+// Watch is a watch of a path kept set by the client: it is set again after each event and after
+// the session is lost, unlike the one-time watches of GetW, ExistsW and ChildrenW. The events of the
+// path are delivered in order on Events until Stop
+type Watch struct {
+	client   *Client
+	key      managedWatchKey
+	events   chan WatchEvent
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// Events returns the channel of the events of the watched path, closed once the watch is stopped.
+// A WatchEvent with Resync set means events may have been missed while the watch was lost
+func (w *Watch) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Path returns the watched path
+func (w *Watch) Path() string {
+	return w.key.path
+}
+
+// Type returns the type of the watch
+func (w *Watch) Type() WatchType {
+	return w.key.watchType
+}
+
+// Stop stops the watch and closes its event channel, it is safe to call Stop more than once
+func (w *Watch) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		w.client.watches().unwatch(w.key)
+		close(w.events)
+	})
+}
+
+// GetWatch returns the data of the path and keeps watching it. The watch follows the path once
+// deleted and reports its creation, it fails if the path does not exist
+func (c *Client) GetWatch(path string) ([]byte, *Watch, error) {
+	data, eventCh, err := c.GetW(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, c.newWatch(path, WatchTypeData, eventCh), nil
+}
+
+// ExistsWatch returns if the path exists and keeps watching its creation, deletion and data
+func (c *Client) ExistsWatch(path string) (bool, *Watch, error) {
+	exists, eventCh, err := c.ExistsW(path)
+	if err != nil {
+		return false, nil, err
+	}
+	return exists, c.newWatch(path, WatchTypeExists, eventCh), nil
+}
+
+// ChildrenWatch returns the children of the path and keeps watching them. The watch follows the
+// path once deleted and reports its creation, it fails if the path does not exist
+func (c *Client) ChildrenWatch(path string) ([]string, *Watch, error) {
+	children, eventCh, err := c.ChildrenW(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return children, c.newWatch(path, WatchTypeChildren, eventCh), nil
+}
+
+func (c *Client) watches() *WatchManager {
+	c.watchManagerOnce.Do(func() {
+		c.watchManager = NewWatchManager(c)
+	})
+	return c.watchManager
+}
+
+// newWatch keeps the watch set by a read of the path
+func (c *Client) newWatch(path string, watchType WatchType, eventCh <-chan zk.Event) *Watch {
+	m := c.watches()
+	w := &Watch{
+		client: c,
+		key:    m.nextKey(path, watchType),
+		events: make(chan WatchEvent, _watchBufferSize),
+		stopCh: make(chan struct{}),
+	}
+	m.watch(w.key, func(ev WatchEvent) {
+		select {
+		case w.events <- ev:
+		case <-w.stopCh:
+		}
+	}, eventCh)
+	return w
+}
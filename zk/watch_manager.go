@@ -0,0 +1,315 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/uber-go/go-helix/util"
+	"github.com/uber-go/tally"
+)
+
+const _rearmBackoff = time.Second
+
+// WatchType is the type of the ZK watch of a path
+type WatchType int
+
+const (
+	// WatchTypeData watches the data of the path, and its creation if it does not exist
+	WatchTypeData WatchType = iota
+	// WatchTypeChildren watches the children of the path, and its creation if it does not exist
+	WatchTypeChildren
+	// WatchTypeExists watches the creation, deletion and data of the path
+	WatchTypeExists
+)
+
+func (t WatchType) String() string {
+	switch t {
+	case WatchTypeData:
+		return "data"
+	case WatchTypeChildren:
+		return "children"
+	case WatchTypeExists:
+		return "exists"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent is delivered to the WatchHandler of a path
+type WatchEvent struct {
+	Path string
+	Type WatchType
+	// Event is the last ZK event of the path in the coalescing window
+	Event zk.Event
+	// Count is the number of ZK events coalesced into the WatchEvent
+	Count int
+	// Resync is set when the watch was re-established after it was lost, e.g. on session
+	// expiry, the changes while the watch was not set are not reported otherwise
+	Resync bool
+}
+
+// WatchHandler handles the events of a watched path, the events of a path are
+// delivered one at a time
+type WatchHandler func(event WatchEvent)
+
+type managedWatchKey struct {
+	path      string
+	watchType WatchType
+	// id tells apart the watches of a path set by the Watch methods of the client,
+	// it is 0 for the watches set by Watch
+	id uint64
+}
+
+type managedWatch struct {
+	managedWatchKey
+	handler WatchHandler
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// WatchManager keeps the registered watches set: the one-time ZK watches are set again
+// after each event and re-established after the session is lost, and the events
+// of a path within the coalescing window are delivered as one WatchEvent
+type WatchManager struct {
+	client *Client
+	logger util.Logger
+	scope  tally.Scope
+	window time.Duration
+
+	mu        sync.Mutex
+	watches   map[managedWatchKey]*managedWatch
+	sessionCh chan struct{}
+	lastID    uint64
+}
+
+// WatchManagerOption configures a WatchManager
+type WatchManagerOption func(*WatchManager)
+
+// WithCoalesceWindow delivers the events of a path within the window as one WatchEvent,
+// the events are delivered right away by default
+func WithCoalesceWindow(window time.Duration) WatchManagerOption {
+	return func(m *WatchManager) {
+		m.window = window
+	}
+}
+
+// NewWatchManager creates a WatchManager of the client
+func NewWatchManager(client *Client, options ...WatchManagerOption) *WatchManager {
+	m := &WatchManager{
+		client:    client,
+		logger:    client.logger,
+		scope:     client.scope.SubScope("watch"),
+		watches:   map[managedWatchKey]*managedWatch{},
+		sessionCh: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	client.AddWatcher(m)
+	return m
+}
+
+// Watch sets a watch of the type on the path, it returns an error if the initial watch
+// can't be set. Watching a watched path replaces its handler
+func (m *WatchManager) Watch(path string, watchType WatchType, handler WatchHandler) error {
+	key := managedWatchKey{path: path, watchType: watchType}
+	eventCh, err := m.arm(key)
+	if err != nil {
+		return err
+	}
+	m.watch(key, handler, eventCh)
+	return nil
+}
+
+// nextKey returns a key of the path not used by the other watches
+func (m *WatchManager) nextKey(path string, watchType WatchType) managedWatchKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	return managedWatchKey{path: path, watchType: watchType, id: m.lastID}
+}
+
+// watch delivers the events of the watch already set to the handler
+func (m *WatchManager) watch(key managedWatchKey, handler WatchHandler, eventCh <-chan zk.Event) {
+	w := &managedWatch{
+		managedWatchKey: key,
+		handler:         handler,
+		stopCh:          make(chan struct{}),
+		doneCh:          make(chan struct{}),
+	}
+	m.mu.Lock()
+	previous := m.watches[key]
+	m.watches[key] = w
+	m.updateGauge()
+	m.mu.Unlock()
+	if previous != nil {
+		previous.stop()
+	}
+	go m.run(w, eventCh)
+}
+
+// Unwatch stops watching the path, the handler is not called after Unwatch returns
+func (m *WatchManager) Unwatch(path string, watchType WatchType) {
+	m.unwatch(managedWatchKey{path: path, watchType: watchType})
+}
+
+func (m *WatchManager) unwatch(key managedWatchKey) {
+	m.mu.Lock()
+	w := m.watches[key]
+	delete(m.watches, key)
+	m.updateGauge()
+	m.mu.Unlock()
+	if w != nil {
+		w.stop()
+	}
+}
+
+// Close stops all the watches
+func (m *WatchManager) Close() {
+	m.mu.Lock()
+	watches := m.watches
+	m.watches = map[managedWatchKey]*managedWatch{}
+	m.updateGauge()
+	m.mu.Unlock()
+	for _, w := range watches {
+		w.stop()
+	}
+}
+
+// Process implements Watcher, the lost watches are set again once the session is established
+func (m *WatchManager) Process(e zk.Event) {
+	if e.Type != zk.EventSession || e.State != zk.StateHasSession {
+		return
+	}
+	m.mu.Lock()
+	close(m.sessionCh)
+	m.sessionCh = make(chan struct{})
+	m.mu.Unlock()
+}
+
+func (m *WatchManager) updateGauge() {
+	m.scope.Gauge("count").Update(float64(len(m.watches)))
+}
+
+func (w *managedWatch) stop() {
+	close(w.stopCh)
+	<-w.doneCh
+}
+
+// arm sets the one-time ZK watch, the data and children watches of a missing path
+// watch the creation of the path
+func (m *WatchManager) arm(key managedWatchKey) (<-chan zk.Event, error) {
+	var eventCh <-chan zk.Event
+	var err error
+	switch key.watchType {
+	case WatchTypeData:
+		_, eventCh, err = m.client.GetW(key.path)
+	case WatchTypeChildren:
+		_, eventCh, err = m.client.ChildrenW(key.path)
+	}
+	if key.watchType == WatchTypeExists || errors.Cause(err) == zk.ErrNoNode {
+		var exists bool
+		exists, eventCh, err = m.client.ExistsW(key.path)
+		if err == nil && exists && key.watchType != WatchTypeExists {
+			// created in between, watch the data or children instead
+			return m.arm(key)
+		}
+	}
+	return eventCh, err
+}
+
+// rearm sets the watch again after it was lost, it retries until the watch is set
+// or stopped and returns nil if stopped
+func (m *WatchManager) rearm(w *managedWatch) <-chan zk.Event {
+	for {
+		m.mu.Lock()
+		sessionCh := m.sessionCh
+		m.mu.Unlock()
+		eventCh, err := m.arm(w.managedWatchKey)
+		if err == nil {
+			m.scope.Counter("reregistrations").Inc(1)
+			return eventCh
+		}
+		m.logger.Warn("failed to set watch again", util.Field("path", w.path),
+			util.Field("type", w.watchType), util.ErrorField(err))
+		select {
+		case <-w.stopCh:
+			return nil
+		case <-sessionCh:
+		case <-m.client.clock.After(_rearmBackoff):
+		}
+	}
+}
+
+func (m *WatchManager) run(w *managedWatch, eventCh <-chan zk.Event) {
+	defer close(w.doneCh)
+	var pending *WatchEvent
+	var windowCh <-chan time.Time
+	deliver := func() {
+		if pending != nil {
+			w.handler(*pending)
+			pending = nil
+			windowCh = nil
+		}
+	}
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-windowCh:
+			deliver()
+		case ev, ok := <-eventCh:
+			lost := !ok || ev.Type == zk.EventNotWatching
+			if lost {
+				if !m.client.waitReconnectJitter(w.stopCh) {
+					return
+				}
+				if eventCh = m.rearm(w); eventCh == nil {
+					return
+				}
+			} else {
+				m.scope.Tagged(map[string]string{"type": w.watchType.String()}).Counter("events").Inc(1)
+				var err error
+				if eventCh, err = m.arm(w.managedWatchKey); err != nil {
+					if eventCh = m.rearm(w); eventCh == nil {
+						return
+					}
+				}
+			}
+			if pending == nil {
+				pending = &WatchEvent{Path: w.path, Type: w.watchType}
+				windowCh = m.client.clock.After(m.window)
+			} else {
+				m.scope.Counter("coalesced").Inc(1)
+			}
+			pending.Event = ev
+			pending.Count++
+			pending.Resync = pending.Resync || lost
+			if m.window <= 0 {
+				deliver()
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestWatchManager(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	m := NewWatchManager(client)
+	defer m.Close()
+
+	events := make(chan WatchEvent, 10)
+	handler := func(ev WatchEvent) { events <- ev }
+	assert.NoError(t, m.Watch("/a", WatchTypeData, handler))
+	assert.NoError(t, m.Watch("/", WatchTypeChildren, handler))
+
+	// the data watch of a missing path fires on creation
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	received := receiveWatchEvents(t, events, 2)
+	assert.Contains(t, received, WatchEvent{Path: "/a", Type: WatchTypeData,
+		Event: zk.Event{Type: zk.EventNodeCreated, State: zk.StateHasSession, Path: "/a"}, Count: 1})
+	assert.Contains(t, received, WatchEvent{Path: "/", Type: WatchTypeChildren,
+		Event: zk.Event{Type: zk.EventNodeChildrenChanged, State: zk.StateHasSession, Path: "/"}, Count: 1})
+
+	// the watch is set again after it fires
+	assert.NoError(t, client.Set("/a", []byte("a"), -1))
+	ev := receiveWatchEvents(t, events, 1)[0]
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Event.Type)
+
+	m.Unwatch("/a", WatchTypeData)
+	assert.NoError(t, client.Set("/a", []byte("b"), -1))
+	assert.NoError(t, client.CreateEmptyNode("/b"))
+	ev = receiveWatchEvents(t, events, 1)[0]
+	assert.Equal(t, "/", ev.Path)
+}
+
+func TestWatchManagerCoalescing(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	m := NewWatchManager(client, WithCoalesceWindow(200*time.Millisecond))
+	defer m.Close()
+
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	events := make(chan WatchEvent, 10)
+	assert.NoError(t, m.Watch("/a", WatchTypeData, func(ev WatchEvent) { events <- ev }))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, client.Set("/a", []byte{byte(i)}, -1))
+		// leave time to set the watch again
+		time.Sleep(20 * time.Millisecond)
+	}
+	ev := receiveWatchEvents(t, events, 1)[0]
+	assert.Equal(t, 3, ev.Count)
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Event.Type)
+	select {
+	case ev := <-events:
+		assert.Fail(t, "unexpected event", "%+v", ev)
+	case <-time.After(300 * time.Millisecond):
+	}
+	for _, gauge := range scope.Snapshot().Gauges() {
+		if gauge.Name() == "helix.zk.watch.count" {
+			assert.Equal(t, float64(1), gauge.Value())
+		}
+	}
+}
+
+func TestWatchManagerSessionExpiry(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	m := NewWatchManager(client)
+	defer m.Close()
+
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	events := make(chan WatchEvent, 10)
+	assert.NoError(t, m.Watch("/a", WatchTypeData, func(ev WatchEvent) { events <- ev }))
+
+	z.SetState(client.zkConn, zk.StateExpired)
+	z.SetState(client.zkConn, zk.StateHasSession)
+	ev := receiveWatchEvents(t, events, 1)[0]
+	assert.True(t, ev.Resync)
+	assert.Equal(t, zk.EventNotWatching, ev.Event.Type)
+
+	assert.NoError(t, client.Set("/a", []byte("a"), -1))
+	ev = receiveWatchEvents(t, events, 1)[0]
+	assert.False(t, ev.Resync)
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Event.Type)
+}
+
+func TestWatchManagerReconnectJitter(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	scope := tally.NewTestScope("", nil)
+	client := NewClient(zap.NewNop(), scope, WithConnFactory(z), WithRetryTimeout(time.Second),
+		WithReconnectJitter(200*time.Millisecond))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+	m := NewWatchManager(client)
+	defer m.Close()
+	for i := 0; i < 10; i++ {
+		delay := client.ReconnectDelay()
+		assert.True(t, delay >= 0 && delay < 200*time.Millisecond)
+	}
+
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	events := make(chan WatchEvent, 10)
+	assert.NoError(t, m.Watch("/a", WatchTypeData, func(ev WatchEvent) { events <- ev }))
+	z.SetState(client.zkConn, zk.StateExpired)
+	z.SetState(client.zkConn, zk.StateHasSession)
+	ev := receiveWatchEvents(t, events, 1)[0]
+	assert.True(t, ev.Resync)
+	timers := scope.Snapshot().Timers()
+	if assert.Contains(t, timers, "helix.zk.reconnect-jitter+zkSvr=") {
+		values := timers["helix.zk.reconnect-jitter+zkSvr="].Values()
+		assert.Len(t, values, 1)
+		assert.True(t, values[0] < 200*time.Millisecond)
+	}
+}
+
+func receiveWatchEvents(t *testing.T, events <-chan WatchEvent, n int) []WatchEvent {
+	var received []WatchEvent
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-events:
+			received = append(received, ev)
+		case <-time.After(time.Second):
+			assert.FailNow(t, "timed out waiting for watch events")
+		}
+	}
+	return received
+}
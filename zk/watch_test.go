@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func TestClientWatches(t *testing.T) {
+	z := NewFakeZk(DefaultConnectionState(zk.StateHasSession))
+	client := NewClient(zap.NewNop(), tally.NoopScope, WithConnFactory(z), WithRetryTimeout(time.Second))
+	assert.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	_, _, err := client.GetWatch("/a")
+	assert.Equal(t, zk.ErrNoNode, errors.Cause(err))
+	exists, existsWatch, err := client.ExistsWatch("/a")
+	require.NoError(t, err)
+	defer existsWatch.Stop()
+	assert.False(t, exists)
+	assert.Equal(t, WatchTypeExists, existsWatch.Type())
+
+	assert.NoError(t, client.CreateDataWithPath("/a", []byte("a")))
+	ev := receiveWatchEvents(t, existsWatch.Events(), 1)[0]
+	assert.Equal(t, "/a", ev.Path)
+	assert.Equal(t, zk.EventNodeCreated, ev.Event.Type)
+
+	// the watches of a path are independent and set again after each event
+	data, dataWatch, err := client.GetWatch("/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), data)
+	_, otherWatch, err := client.GetWatch("/a")
+	require.NoError(t, err)
+	children, childrenWatch, err := client.ChildrenWatch("/")
+	require.NoError(t, err)
+	defer childrenWatch.Stop()
+	assert.Contains(t, children, "a")
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, client.Set("/a", []byte{byte(i)}, -1))
+		assert.Equal(t, zk.EventNodeDataChanged, receiveWatchEvents(t, dataWatch.Events(), 1)[0].Event.Type)
+		assert.Equal(t, zk.EventNodeDataChanged, receiveWatchEvents(t, otherWatch.Events(), 1)[0].Event.Type)
+		assert.Equal(t, zk.EventNodeDataChanged, receiveWatchEvents(t, existsWatch.Events(), 1)[0].Event.Type)
+	}
+	assert.NoError(t, client.CreateEmptyNode("/b"))
+	assert.Equal(t, zk.EventNodeChildrenChanged, receiveWatchEvents(t, childrenWatch.Events(), 1)[0].Event.Type)
+
+	// a stopped watch closes its channel, the other watches of the path are kept
+	otherWatch.Stop()
+	otherWatch.Stop()
+	_, ok := <-otherWatch.Events()
+	assert.False(t, ok)
+
+	// the watches survive the loss of the session
+	z.SetState(client.zkConn, zk.StateExpired)
+	z.SetState(client.zkConn, zk.StateHasSession)
+	ev = receiveWatchEvents(t, dataWatch.Events(), 1)[0]
+	assert.True(t, ev.Resync)
+	assert.NoError(t, client.Set("/a", []byte("b"), -1))
+	for {
+		ev = receiveWatchEvents(t, dataWatch.Events(), 1)[0]
+		if !ev.Resync {
+			break
+		}
+	}
+	assert.Equal(t, zk.EventNodeDataChanged, ev.Event.Type)
+
+	// the data watch follows the path once deleted
+	assert.NoError(t, client.Delete("/a"))
+	assert.Equal(t, zk.EventNodeDeleted, receiveWatchEvents(t, dataWatch.Events(), 1)[0].Event.Type)
+	assert.NoError(t, client.CreateEmptyNode("/a"))
+	assert.Equal(t, zk.EventNodeCreated, receiveWatchEvents(t, dataWatch.Events(), 1)[0].Event.Type)
+	dataWatch.Stop()
+}